@@ -0,0 +1,51 @@
+// egggen generates Go structs (with egg: tags) for use with eggql from a GraphQL schema (SDL), eg:
+//
+//	egggen -pkg starwars -o schema.go schema.graphql
+//
+// Several .graphql files can be given (eg if the schema is split into modules) and are combined.  The generated
+// resolvers are nil funcs, so the code needs to be completed (see eggql.GenerateGo).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/andrewwphillips/eggql"
+)
+
+func main() {
+	pkg := flag.String("pkg", "main", "name of the package of the generated code")
+	out := flag.String("o", "", "name of the file to write (default standard output)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: egggen [-pkg name] [-o file.go] schema.graphql...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var sdl []string
+	for _, filename := range flag.Args() {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		sdl = append(sdl, string(b))
+	}
+	src, err := eggql.GenerateGo(strings.Join(sdl, "\n"), *pkg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		os.Stdout.Write(src)
+	} else if err = os.WriteFile(*out, src, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,71 @@
+package eggql
+
+// context.go has functions for use in resolvers that take a context.Context (as 1st parameter)
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/handler"
+)
+
+// RemainingBudget returns how much time a resolver has left before its context expires, and false if there
+// is no deadline.  The deadline is set by the OperationTimeout option and (more tightly) by the "timeout"
+// option of a field's egg: tag.  A resolver can use it to pass a tightened deadline on to downstream calls
+// or to return partial data (rather than nothing) when the time remaining is too short to do the full job.
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	if remaining := time.Until(deadline); remaining > 0 {
+		return remaining, true
+	}
+	return 0, true // already expired
+}
+
+// SetHeader sets a header of the HTTP response of a query or mutation, replacing any value already set.  The
+// header is buffered until the response is written, so it is safe to call from resolvers running concurrently.
+// It returns false if the header can't be set, eg for an operation received on a websocket.
+func SetHeader(ctx context.Context, key, value string) bool {
+	return handler.SetHeader(ctx, key, value)
+}
+
+// AddHeader is like SetHeader but adds to any values of the header already set
+func AddHeader(ctx context.Context, key, value string) bool {
+	return handler.AddHeader(ctx, key, value)
+}
+
+// SetCookie adds a cookie to the HTTP response (Set-Cookie header) of a query or mutation - see SetHeader
+func SetCookie(ctx context.Context, cookie *http.Cookie) bool {
+	return handler.SetCookie(ctx, cookie)
+}
+
+// WithChaos returns a context that turns fault injection (see the Chaos option) on or off for a request, eg in a
+// ContextFunc to exclude health checks.  Fault injection is on by default when built with the "chaos" build tag.
+func WithChaos(ctx context.Context, on bool) context.Context {
+	return handler.WithChaos(ctx, on)
+}
+
+// ArgsProvided returns the arguments (by name) that the query supplied to a resolver, so that the resolver can tell
+// an omitted argument from one given the same value as its default, eg for a mutation that only updates the fields
+// supplied.  It returns nil if ctx is not the context passed to a resolver with arguments.
+func ArgsProvided(ctx context.Context) map[string]bool {
+	return handler.ArgsProvided(ctx)
+}
+
+// Meta returns read-only information about the types, fields and enums of the schema, eg so that a generic resolver
+// (such as for dynamic sorting or filtering) can validate the field names it is given.  It returns nil if ctx is not
+// (derived from) the context passed to a resolver.
+func Meta(ctx context.Context) *SchemaMeta {
+	return handler.Meta(ctx)
+}
+
+// Parent returns a pointer to the Go struct containing the function resolver that was passed the context, so
+// that the resolver can use the struct's other fields (including unexported ones), eg a Height resolver of a
+// Human can use eggql.Parent(ctx).(*Human).height rather than being a closure made for each Human.  It returns
+// nil if ctx is not the context passed to a resolver.
+func Parent(ctx context.Context) interface{} {
+	return handler.Parent(ctx)
+}
@@ -45,12 +45,7 @@ package eggql
 
 // TODO:
 // complexity limiting:
-//   - add complexity(len, <int>, <arg>, <arg>) option
-//     where len = length for field returning a list and the value *can* be precalculated
-//           <int> = integer literal (eg 10)
-//           <arg> = integer argument
-//   -  calc complexity (recursively) before running a root query (if below option on) (eg <int>*<arg>*<arg>)
-//   -  add complexity throttling option - so complex queries are not even attempted
+//   - add "len" to complexity option for a field returning a list where the length *can* be precalculated
 // query aggregator to avoid N+1 problem (cf Apollo dataloader)
 // add hooks for OpenTelemetry
 // server-sent events for subscriptions
@@ -14,7 +14,10 @@ package eggql
 // You can also set options such as websocket timeouts and ping frequency for subscriptions.
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/andrewwphillips/eggql/internal/handler"
@@ -26,9 +29,13 @@ type (
 	// outside the eggql package, but you can obtain one by calling eggql.New()
 	// then call its public methods.
 	gql struct {
-		enums   map[string][]string
-		qms     [][3]interface{} // each slice element represents a schema (with a root query, mutation and subscription)
-		options []func(*handler.Handler)
+		enums        map[string][]string
+		qms          [][3]interface{} // each slice element represents a schema (with a root query, mutation and subscription)
+		options      []func(*handler.Handler)
+		strict       bool                 // see SetStrict
+		stitched     bool                 // see NewStitched
+		extensions   []string             // see ExtendSchema
+		buildOptions []schema.BuildOption // see SetLiteralLimits and SetNamedDefault
 	}
 )
 
@@ -45,6 +52,19 @@ func New(q ...interface{}) gql {
 	return g
 }
 
+// NewStitched creates a new instance that combines the query structs of several modules (eg service1.Query{},
+// service2.Query{}) into one schema, as if each was passed to the Add method.  Unlike Add, it is an error (reported
+// by GetHandler etc) if the structs of different modules provide the same query field or declare different
+// types with the same name, rather than one extending the other.  Mutation and subscription structs can be
+// added using Add, eg g.Add(nil, service1.Mutation{}).
+func NewStitched(queries ...interface{}) gql {
+	g := gql{stitched: true}
+	for _, q := range queries {
+		g.Add(q)
+	}
+	return g
+}
+
 // Add allows adding of another query, mutation and/or subscription.
 // Up to 3 parameters can be given, but they must be structs and passed in that
 // order (query, mutation, subscription) but any may be nil (eg use nil for the
@@ -78,34 +98,41 @@ func (g *gql) AddEnum(name string, values []string) {
 	g.enums[name] = values
 }
 
-// GetSchema builds and returns the GraphQL schema
+// GetSchema builds and returns the GraphQL schema.  If more than one query (or mutation or subscription) was added
+// the fields of the others are added to the type declared by the first using "extend type".
 func (g *gql) GetSchema() (string, error) {
-	var schemaString string
-	for _, schemaQMS := range g.qms {
-		s, err := schema.Build(g.enums, schemaQMS[:]...)
-		if err != nil {
-			return "", err
-		}
-		schemaString += s // should we do more than concatenate the schemas?
+	s, err := schema.BuildAll(g.enums, g.qms, g.schemaOptions()...)
+	if err != nil {
+		return "", err
 	}
-	return schemaString, nil
+	return strings.Join(append([]string{s}, g.extensions...), "\n"), nil
+}
+
+// ExtendSchema adds GraphQL schema (SDL) text to the generated schema, eg to add fields using "extend type", which
+// are resolved by the "wildcard" resolver of the type (see the ExtendSchema option).
+func (g *gql) ExtendSchema(sdl string) {
+	g.extensions = append(g.extensions, sdl)
+}
+
+// GetDocs builds the schema and returns documentation of its types (fields, arguments, enum values, etc)
+// as Markdown text, or as an HTML page if html is true.  (See also the ServeDocs option.)
+func (g *gql) GetDocs(html bool) (string, error) {
+	s, err := schema.BuildAll(g.enums, g.qms, g.schemaOptions()...)
+	if err != nil {
+		return "", err
+	}
+	return handler.Docs(append([]string{s}, g.extensions...), html)
 }
 
 // GetHandler uses the previously added Query, Enums, options, etc to build the
 // schema and return the HTTP handler
 func (g *gql) GetHandler() (http.Handler, error) {
-	var schemaStrings []string
+	s, err := schema.BuildAll(g.enums, g.qms, g.schemaOptions()...)
+	if err != nil {
+		return nil, err
+	}
 	var schemaQMS [3][]interface{}
 	for _, qms := range g.qms {
-		s, err := schema.Build(g.enums, qms[:]...)
-		if err != nil {
-			return nil, err
-		}
-		if len(schemaStrings) == 0 {
-			schemaStrings = append(schemaStrings, s)
-		} else {
-			schemaStrings = append(schemaStrings, "extend "+s)
-		}
 		if qms[0] != nil {
 			schemaQMS[0] = append(schemaQMS[0], qms[0])
 		}
@@ -116,7 +143,131 @@ func (g *gql) GetHandler() (http.Handler, error) {
 			schemaQMS[2] = append(schemaQMS[2], qms[2])
 		}
 	}
-	return handler.New(schemaStrings, g.enums, schemaQMS, g.options...), nil
+	return handler.NewE(append([]string{s}, g.extensions...), g.enums, schemaQMS, g.options...)
+}
+
+// CacheStats returns statistics of the resolver caches (hits, misses, number of entries and an estimate of
+// memory used) of a handler returned by MustRun or GetHandler, or nil if h is not one of those handlers.
+// It can be used to check whether caching (eg the FuncCache option) is actually helping.
+func CacheStats(h http.Handler) []CacheStat {
+	if eh, ok := h.(*handler.Handler); ok {
+		return eh.CacheStats()
+	}
+	return nil
+}
+
+// SmokeTest generates a simple query for each field of the root query of a handler returned by MustRun or
+// GetHandler, runs it and returns the results (with any errors), eg in a test to find nil or broken resolvers.
+// See the README for how the queries are generated.  It returns nil if h is not one of those handlers.
+func SmokeTest(ctx context.Context, h http.Handler) []SmokeResult {
+	if eh, ok := h.(*handler.Handler); ok {
+		return eh.SmokeTest(ctx)
+	}
+	return nil
+}
+
+// DeprecatedUsage returns how many operations of each client have used each deprecated field or argument, for
+// a handler returned by MustRun or GetHandler with the DeprecationUsage option on, or nil otherwise
+func DeprecatedUsage(h http.Handler) []DeprecatedUse {
+	if eh, ok := h.(*handler.Handler); ok {
+		return eh.DeprecatedUsage()
+	}
+	return nil
+}
+
+// Freeze ends the initialisation of the resolvers of the root structs of a handler returned by MustRun or
+// GetHandler with the LazyInit option, after which requests are handled.  It returns an error if a resolver
+// function is still nil (unless the NilResolver option is on), or if h is not one of those handlers.
+func Freeze(h http.Handler) error {
+	if eh, ok := h.(*handler.Handler); ok {
+		return eh.Freeze()
+	}
+	return errors.New("eggql.Freeze: not an eggql handler")
+}
+
+// InvalidateCache removes cached resolver values of a handler returned by MustRun or GetHandler, eg from a mutation
+// that changes the data returned by the resolvers.  typeName is the GraphQL type (eg "Query") and fieldName the
+// field, but either may be empty to match all types or fields.  It returns the number of values removed.
+func InvalidateCache(h http.Handler, typeName, fieldName string) int {
+	if eh, ok := h.(*handler.Handler); ok {
+		return eh.InvalidateCache(typeName, fieldName)
+	}
+	return 0
+}
+
+// Close stops any go-routines (eg for the Audit option) of a handler returned by MustRun or GetHandler, after
+// passing on any queued audit records.  It does nothing if h is not one of those handlers.
+func Close(h http.Handler) {
+	if eh, ok := h.(*handler.Handler); ok {
+		eh.Close()
+	}
+}
+
+// Schema returns the GraphQL schema (SDL text) of a handler returned by MustRun or GetHandler, or an empty string
+// if h is not one of those handlers.  (See also the ServeSchema option.)
+func Schema(h http.Handler) string {
+	if eh, ok := h.(*handler.Handler); ok {
+		return eh.Schema()
+	}
+	return ""
+}
+
+// ServeWebTransport (experimental) handles GraphQL operations (including subscriptions) sent on a WebTransport
+// stream, using the same messages as the graphql-transport-ws websocket sub-protocol.  h must be a handler returned
+// by MustRun or GetHandler, r is the request that established the WebTransport session and stream is a stream
+// accepted from the session.  It returns when the stream is closed.
+func ServeWebTransport(h http.Handler, r *http.Request, stream TransportStream) error {
+	eh, ok := h.(*handler.Handler)
+	if !ok {
+		_ = stream.Close()
+		return errors.New("ServeWebTransport requires a handler returned by MustRun or GetHandler")
+	}
+	return eh.ServeWebTransport(r, stream)
+}
+
+// schemaOptions returns the options used when building the schema
+func (g *gql) schemaOptions() []schema.BuildOption {
+	options := g.buildOptions
+	if g.strict {
+		options = append([]schema.BuildOption{schema.Strict()}, options...)
+	}
+	if g.stitched {
+		options = append([]schema.BuildOption{schema.Stitched()}, options...)
+	}
+	return options
+}
+
+// SetStrict turns on strict checking of the structs when the schema is built - see the Strict option.
+func (g *gql) SetStrict(on bool) {
+	g.strict = on
+}
+
+// SetDateTime turns on/off the DateTime scalar for time.Time fields and arguments - see the DateTime option.
+func (g *gql) SetDateTime(on bool) {
+	g.buildOptions = append(g.buildOptions, schema.DateTime(on))
+}
+
+// SetDateTimeFormat sets the layout of DateTime values - see the DateTimeFormat option.
+func (g *gql) SetDateTimeFormat(layout string) {
+	g.buildOptions = append(g.buildOptions, schema.DateTimeFormat(layout))
+	g.options = append(g.options, handler.DateTimeFormat(layout))
+}
+
+// AddTypes adds object types to the schema that are not reachable from the query, mutation or subscription
+// structs - see the RegisterTypes option.
+func (g *gql) AddTypes(values ...interface{}) {
+	g.buildOptions = append(g.buildOptions, schema.Types(values...))
+	g.options = append(g.options, handler.Types(values...))
+}
+
+// SetLiteralLimits limits the size of default values in tags and of enums - see the LiteralLimits option.
+func (g *gql) SetLiteralLimits(maxLength, maxElements, maxEnumValues int) {
+	g.buildOptions = append(g.buildOptions, schema.LiteralLimits(maxLength, maxElements, maxEnumValues))
+}
+
+// SetNamedDefault saves a default value that can be used in tags by name - see the NamedDefault option.
+func (g *gql) SetNamedDefault(name, literal string) {
+	g.buildOptions = append(g.buildOptions, schema.NamedDefault(name, literal))
 }
 
 // SetInitialTimeout sets the initial websocket (subscription) timeout.  This is only used if manually setting
@@ -126,6 +277,36 @@ func (g *gql) SetInitialTimeout(timeout time.Duration) {
 	g.options = append(g.options, handler.InitialTimeout(timeout))
 }
 
+// SetMaxComplexity rejects operations that are too complex - see the MaxComplexity option.
+func (g *gql) SetMaxComplexity(limit int) {
+	g.options = append(g.options, handler.MaxComplexity(limit))
+}
+
+// SetMaxErrors limits the number of errors in a response - see the MaxErrors option.
+func (g *gql) SetMaxErrors(n int) {
+	g.options = append(g.options, handler.MaxErrors(n))
+}
+
+// SetServeDocs turns on serving of documentation of the schema - see the ServeDocs option.
+func (g *gql) SetServeDocs(on bool) {
+	g.options = append(g.options, handler.ServeDocs(on))
+}
+
+// SetServeSchema turns on serving of the schema (SDL) - see the ServeSchema option.
+func (g *gql) SetServeSchema(on bool) {
+	g.options = append(g.options, handler.ServeSchema(on))
+}
+
+// SetShadow registers candidate resolvers to be compared with the current resolvers - see the Shadow option.
+func (g *gql) SetShadow(candidates map[string]interface{}) {
+	g.options = append(g.options, handler.Shadow(candidates))
+}
+
+// SetObserver sets a function to receive events that are not returned to clients - see the Observer option.
+func (g *gql) SetObserver(f ObserverFunc) {
+	g.options = append(g.options, handler.Observer(f))
+}
+
 func (g *gql) SetPingFrequency(freq time.Duration) {
 	g.options = append(g.options, handler.PingFrequency(freq))
 }
@@ -3,11 +3,18 @@ package eggql_test
 // End-to-end tests (also see low-level tests in the field, schema and handler packages)
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/andrewwphillips/eggql"
 )
@@ -21,8 +28,22 @@ type (
 		Name string
 		Age  int
 	}
+
+	// Character is a Go interface (implemented by Human and Droid) used as a GraphQL interface - see TestGoInterface
+	Character interface{ character() }
+	Human     struct {
+		Name   string
+		Height float64
+	}
+	Droid struct {
+		Name            string
+		PrimaryFunction string
+	}
 )
 
+func (Human) character()  {}
+func (*Droid) character() {}
+
 // TestQuery performs high-level (end to end) tests of GraphQL queries.  More thorough low-level tests are included
 // in the internal packages (field, schema, and handler).
 func TestQuery(t *testing.T) {
@@ -68,6 +89,19 @@ func TestQuery(t *testing.T) {
 			query:    `{ friend(id: 602) { id name age } }`,
 			expected: JsonObject{"friend": JsonObject{"id": 602.0, "name": "Cam", "age": 74.0}},
 		},
+		"remaining_budget": {
+			// field timeout option sets a deadline for the resolver
+			q: struct {
+				F func(context.Context) bool `egg:",timeout=1s"`
+			}{
+				F: func(ctx context.Context) bool {
+					remaining, ok := eggql.RemainingBudget(ctx)
+					return ok && remaining > 0 && remaining <= time.Second
+				},
+			},
+			query:    "{ f }",
+			expected: JsonObject{"f": true},
+		},
 		"map": {
 			// get list of objects using a map, incl. fake "id" field (field_id option)
 			// Note: Originally this succeeded but occasionally failed due to random iteration of Friends map
@@ -180,6 +214,1008 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+// TestAdd tests that fields of query structs added separately can be queried together
+func TestAdd(t *testing.T) {
+	gql := eggql.New(struct{ Message string }{"hello"})
+	gql.Add(struct {
+		Friends []Person
+		Double  func(int) int `egg:"(value)"`
+	}{
+		Friends: []Person{{"Al", 21}},
+		Double:  func(v int) int { return 2 * v },
+	})
+	s, err := gql.GetSchema()
+	Assertf(t, err == nil && strings.Contains(s, "extend type Query"), "GetSchema: expected extend got %q (%v)", s, err)
+
+	h, err := gql.GetHandler()
+	if err != nil {
+		t.Fatalf("GetHandler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+	inBody := `{ "query": "{ message friends { name } double(value: 3) }" }`
+	resp, err := server.Client().Post(server.URL, "application/json", strings.NewReader(inBody))
+	if err != nil {
+		t.Fatalf("Error POSTing the query: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"message": "hello",
+		"friends": []interface{}{JsonObject{"name": "Al"}},
+		"double":  6.0,
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+}
+
+// TestNewStitched tests that the query structs of different modules are combined, and that conflicts are errors
+func TestNewStitched(t *testing.T) {
+	users := struct{ Friends []Person }{[]Person{{"Al", 21}}}
+	orders := struct {
+		Customer Person
+		Total    float64
+	}{Person{"Bo", 42}, 9.5}
+	gql := eggql.NewStitched(users, orders)
+	h, err := gql.GetHandler()
+	if err != nil {
+		t.Fatalf("GetHandler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+	inBody := `{ "query": "{ friends { name } customer { age } total }" }`
+	resp, err := server.Client().Post(server.URL, "application/json", strings.NewReader(inBody))
+	if err != nil {
+		t.Fatalf("Error POSTing the query: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"friends":  []interface{}{JsonObject{"name": "Al"}},
+		"customer": JsonObject{"age": 42.0},
+		"total":    9.5,
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+
+	// Both modules provide the total field
+	gql = eggql.NewStitched(orders, struct{ Total float64 }{})
+	_, err = gql.GetHandler()
+	Assertf(t, err != nil && strings.Contains(err.Error(), `field "total" of "Query" is provided by more than one struct`),
+		"expected conflict error got %v", err)
+}
+
+// TestSchemaString checks that the schema can be obtained from the MustRun parameters or from the handler
+func TestSchemaString(t *testing.T) {
+	q := struct {
+		Message string
+		Role    int `egg:":Role"`
+	}{"hello", 0}
+	enums := map[string][]string{"Role": {"ADMIN", "GUEST"}}
+
+	s, err := eggql.SchemaString(enums, q, eggql.ServeSchema(true))
+	Assertf(t, err == nil && strings.Contains(s, "message :String!") && strings.Contains(s, "enum Role"),
+		"SchemaString: expected message and Role got %q (%v)", s, err)
+	h := eggql.MustRun(enums, q)
+	Assertf(t, eggql.Schema(h) == s, "Schema: expected %q got %q", s, eggql.Schema(h))
+
+	_, err = eggql.SchemaString(struct{ Bad func() chan int }{})
+	Assertf(t, err != nil, "SchemaString: expected an error for an invalid resolver")
+}
+
+// TestVerify checks that Verify reports the differences between the schema of the Go types and the SDL
+func TestVerify(t *testing.T) {
+	q := struct {
+		Latest Episode
+		Role   int `egg:":Role!"`
+	}{}
+	m := struct {
+		Rate func(Episode, int) bool `egg:"(episode,stars=5)"`
+	}{}
+	const sdl = `type Query { latest: Episode!, role: Role! } type Mutation { rate(episode: Episode!, stars: Int! = 5): Boolean! }
+		enum Role { ADMIN GUEST } enum Episode { NEWHOPE EMPIRE JEDI }`
+
+	err := eggql.Verify(sdl, q, m, nil)
+	Assertf(t, err == nil, "Verify: expected no error got %v", err)
+
+	err = eggql.Verify(strings.Replace(sdl, "JEDI", "JEDI PHANTOM", 1), q, nil, nil)
+	Assertf(t, err != nil && strings.Contains(err.Error(), `type "Mutation" is missing`) &&
+		strings.Contains(err.Error(), `enum value "PHANTOM" of "Episode" is missing`),
+		"Verify: expected missing Mutation and enum value got %v", err)
+}
+
+// TestWildcard checks that fields added to the schema in SDL are resolved by the wildcard resolver
+func TestWildcard(t *testing.T) {
+	q := struct {
+		_       Person // so that the Person type (returned by the wildcard resolver) is known
+		Message string
+		Other   func(context.Context, string, map[string]interface{}) (interface{}, error) `egg:",wildcard"`
+	}{
+		Message: "hello",
+		Other: func(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+			switch name {
+			case "weather":
+				return "sunny in " + args["city"].(string), nil
+			case "friend":
+				return Person{Name: "Al", Age: 21}, nil
+			}
+			return nil, errors.New("unknown field " + name)
+		},
+	}
+	h := eggql.MustRun(q, eggql.ExtendSchema(`extend type Query { weather(city: String! = "Paris"): String! `+
+		`friend: Person! }`))
+	Assertf(t, strings.Contains(eggql.Schema(h), "weather(city"), "Schema: expected weather field")
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+	inBody := `{ "query": "{ message weather friend { name } other: weather(city: \"Rome\") }" }`
+	resp, err := server.Client().Post(server.URL, "application/json", strings.NewReader(inBody))
+	if err != nil {
+		t.Fatalf("Error POSTing the query: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"message": "hello",
+		"weather": "sunny in Paris",
+		"friend":  JsonObject{"name": "Al"},
+		"other":   "sunny in Rome",
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+}
+
+// TestGoInterface checks resolvers that return a Go interface, which is a GraphQL interface of the structs that
+// implement it
+func TestGoInterface(t *testing.T) {
+	q := struct {
+		_          Human
+		_          *Droid
+		Hero       func(int) Character `egg:"(episode)"`
+		Characters []Character
+	}{
+		Hero: func(episode int) Character {
+			if episode == 0 {
+				return Human{Name: "Luke", Height: 1.72}
+			}
+			return &Droid{Name: "R2-D2", PrimaryFunction: "Astromech"}
+		},
+		Characters: []Character{Human{Name: "Leia", Height: 1.5}, &Droid{Name: "C-3PO"}, nil},
+	}
+	h := eggql.MustRun(q)
+	Assertf(t, strings.Contains(eggql.Schema(h), "type Droid implements Character"),
+		"Schema: expected Droid to implement Character, got %s", eggql.Schema(h))
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+
+		`{ luke: hero(episode: 0) { __typename name } r2: hero(episode: 1) { __typename ... on Droid { primaryFunction } } `+
+		`characters { name ... on Human { height } } }"}`)))
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"luke": JsonObject{"__typename": "Human", "name": "Luke"},
+		"r2":   JsonObject{"__typename": "Droid", "primaryFunction": "Astromech"},
+		"characters": []interface{}{
+			JsonObject{"name": "Leia", "height": 1.5},
+			JsonObject{"name": "C-3PO"},
+			nil,
+		},
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+}
+
+// TestRegisterTypes checks that types returned by resolvers of interface type can be registered instead of adding
+// dummy fields to the query struct
+func TestRegisterTypes(t *testing.T) {
+	q := struct {
+		Hero  func(int) Character `egg:"(episode)"`
+		Droid func() interface{}  `egg:":Droid"`
+	}{
+		Hero: func(episode int) Character {
+			if episode == 0 {
+				return Human{Name: "Luke", Height: 1.72}
+			}
+			return &Droid{Name: "R2-D2", PrimaryFunction: "Astromech"}
+		},
+		Droid: func() interface{} { return &Droid{Name: "C-3PO"} },
+	}
+	h := eggql.MustRun(q, eggql.RegisterTypes(Human{}, &Droid{}))
+	Assertf(t, strings.Contains(eggql.Schema(h), "type Human implements Character"),
+		"Schema: expected Human to implement Character, got %s", eggql.Schema(h))
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+
+		`{ hero(episode: 0) { __typename name } droid { __typename name } }"}`)))
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"hero":  JsonObject{"__typename": "Human", "name": "Luke"},
+		"droid": JsonObject{"__typename": "Droid", "name": "C-3PO"},
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+}
+
+// Episode is a Go enum type (see TestGoEnums)
+type Episode uint8
+
+func (Episode) EnumValues() []string {
+	return []string{"NEWHOPE", "EMPIRE", "JEDI# Return of the Jedi"}
+}
+
+// TestGoEnums checks that a Go type with an EnumValues method is an enum (without being in the enums map) for
+// fields, arguments (including defaults and lists) and input types
+func TestGoEnums(t *testing.T) {
+	type Filter struct{ Episodes []Episode }
+	h := eggql.MustRun(struct {
+		Latest    Episode
+		AppearsIn []Episode
+		Next      func(Episode) *Episode  `egg:"(episode=EMPIRE)"`
+		Count     func(Filter) int        `egg:"(filter)"`
+		Tagged    func(e Episode) Episode `egg:"(e):Episode!"`
+		Missing   func() Episode
+	}{
+		Latest:    2,
+		AppearsIn: []Episode{0, 2},
+		Next: func(e Episode) *Episode {
+			if e >= 2 {
+				return nil
+			}
+			e++
+			return &e
+		},
+		Count:   func(f Filter) int { return len(f.Episodes) },
+		Tagged:  func(e Episode) Episode { return e },
+		Missing: func() Episode { return 3 },
+	})
+	schema := eggql.Schema(h)
+	Assertf(t, strings.Contains(schema, "enum Episode"), "Schema: expected enum Episode, got %s", schema)
+	Assertf(t, strings.Contains(schema, "Return of the Jedi"), "Schema: expected enum description, got %s", schema)
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+
+		`{ latest appearsIn next last: next(episode: JEDI) count(filter: {episodes: [NEWHOPE, JEDI]}) tagged(e: NEWHOPE) }"}`)))
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"latest":    "JEDI",
+		"appearsIn": []interface{}{"NEWHOPE", "JEDI"},
+		"next":      "JEDI",
+		"last":      nil,
+		"count":     2.0,
+		"tagged":    "NEWHOPE",
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+
+	writer = httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "{ missing }"}`)))
+	result.Errors = nil
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	Assertf(t, len(result.Errors) == 1 && strings.Contains(result.Errors[0].Message, "out of range"),
+		"expected out of range error, got %v", result.Errors)
+
+	_, err := eggql.Run(map[string][]string{"Episode": {"A", "B"}}, struct{ E Episode }{})
+	Assertf(t, err != nil, "expected error for enum in map and Go type")
+}
+
+// TestDynamic checks that maps of type Dynamic (and nested maps and slices) are served as objects of types declared in SDL
+func TestDynamic(t *testing.T) {
+	movies := []eggql.Dynamic{
+		{"title": "A New Hope", "year": 1977, "cast": []interface{}{map[string]interface{}{"name": "Luke"}}},
+		{"title": "The Empire Strikes Back", "rating": "PG"},
+	}
+	h := eggql.MustRun(struct {
+		Movies []eggql.Dynamic `egg:":[Movie!]!"`
+		Latest eggql.Dynamic   `egg:":Movie"`
+		Bad    eggql.Dynamic   `egg:":Movie"`
+	}{
+		Movies: movies,
+		Latest: movies[1],
+		Bad:    eggql.Dynamic{"year": 1980},
+	}, eggql.ExtendSchema(`type Movie { title: String! year: Int rating: Rating cast: [Person!] } `+
+		`type Person { name: String! } enum Rating { G PG }`))
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+
+		`{ movies { title year cast { name } } latest { __typename ... on Movie { name: title rating } } }"}`)))
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"movies": []interface{}{
+			JsonObject{"title": "A New Hope", "year": 1977.0, "cast": []interface{}{JsonObject{"name": "Luke"}}},
+			JsonObject{"title": "The Empire Strikes Back", "year": nil, "cast": nil},
+		},
+		"latest": JsonObject{"__typename": "Movie", "name": "The Empire Strikes Back", "rating": "PG"},
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+
+	writer = httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "{ bad { title } }"}`)))
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	Assertf(t, len(result.Errors) == 1 && strings.Contains(result.Errors[0].Message, "non-nullable"),
+		"expected error for missing non-nullable field, got %v", result.Errors)
+
+	_, err := eggql.Run(struct{ D eggql.Dynamic }{})
+	Assertf(t, err != nil, "expected error for Dynamic field without a type")
+}
+
+// TestParent checks that a function resolver can get the struct that contains it
+func TestParent(t *testing.T) {
+	type Person struct {
+		Name   string
+		height float64
+		Height func(ctx context.Context, feet bool) float64 `egg:"(feet=false)"`
+	}
+	height := func(ctx context.Context, feet bool) float64 {
+		p := eggql.Parent(ctx).(*Person)
+		if feet {
+			return p.height * 10
+		}
+		return p.height
+	}
+	people := []Person{{Name: "Luke", height: 1.5, Height: height}, {Name: "Leia", height: 1.25, Height: height}}
+	h := eggql.MustRun(struct {
+		People  []Person
+		Tallest func(context.Context) bool
+	}{
+		People:  people,
+		Tallest: func(ctx context.Context) bool { return eggql.Parent(ctx) != nil },
+	})
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+
+		`{ people { name height feet: height(feet: true) } tallest }"}`)))
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"people": []interface{}{
+			JsonObject{"name": "Luke", "height": 1.5, "feet": 15.0},
+			JsonObject{"name": "Leia", "height": 1.25, "feet": 12.5},
+		},
+		"tallest": true,
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+	Assertf(t, eggql.Parent(context.Background()) == nil, "expected no parent outside a resolver")
+}
+
+// Review is an input type with a Validate method (see TestValidateInput)
+type Review struct {
+	Stars   int
+	Comment string
+}
+
+func (r Review) Validate() error {
+	if r.Stars < 1 || r.Stars > 5 {
+		return fmt.Errorf("stars (%d) must be from 1 to 5", r.Stars)
+	}
+	return nil
+}
+
+// TestValidateInput checks that an input object's Validate method is called before the resolver
+func TestValidateInput(t *testing.T) {
+	var called int
+	h := eggql.MustRun(struct{ Len int }{}, struct {
+		Add    func(Review) int    `egg:"(review)"`
+		AddAll func([]*Review) int `egg:"(reviews)"`
+	}{
+		Add:    func(r Review) int { called++; return r.Stars },
+		AddAll: func(r []*Review) int { called++; return len(r) },
+	})
+
+	for name, testData := range map[string]struct {
+		query     string
+		expected  interface{}
+		errorPath string // expected "argument" in the extensions of the error
+	}{
+		"valid":        {`mutation { add(review: {stars: 5, comment: \"good\"}) }`, JsonObject{"add": 5.0}, ""},
+		"invalid":      {`mutation { add(review: {stars: 0, comment: \"bad\"}) }`, nil, "review"},
+		"list":         {`mutation { addAll(reviews: [{stars: 1, comment: \"\"}, {stars: 2, comment: \"\"}]) }`, JsonObject{"addAll": 2.0}, ""},
+		"list invalid": {`mutation { addAll(reviews: [{stars: 1, comment: \"\"}, {stars: 6, comment: \"\"}]) }`, nil, "reviews[1]"},
+	} {
+		called = 0
+		writer := httptest.NewRecorder()
+		h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+testData.query+`"}`)))
+		var result struct {
+			Data   interface{}
+			Errors []struct {
+				Message    string
+				Extensions map[string]interface{}
+			}
+		}
+		if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+			t.Fatalf("%12s: Error decoding JSON: %v", name, err)
+		}
+		if testData.errorPath == "" {
+			Assertf(t, result.Errors == nil, "%12s: expected no error and got %v", name, result.Errors)
+			Assertf(t, reflect.DeepEqual(result.Data, testData.expected), "%12s: expected %v, got %v", name, testData.expected, result.Data)
+			Assertf(t, called == 1, "%12s: expected resolver to be called", name)
+			continue
+		}
+		Assertf(t, len(result.Errors) == 1, "%12s: expected an error, got %v", name, result.Errors)
+		if len(result.Errors) == 1 {
+			Assertf(t, result.Errors[0].Extensions["argument"] == testData.errorPath && result.Errors[0].Extensions["code"] == "BAD_USER_INPUT",
+				"%12s: expected error for argument %q, got %v", name, testData.errorPath, result.Errors[0])
+		}
+		Assertf(t, called == 0, "%12s: expected resolver not to be called", name)
+	}
+}
+
+// TestInputDefaults checks that defaults of input fields are in the schema and used if a field is omitted
+func TestInputDefaults(t *testing.T) {
+	type Rating struct {
+		Stars    int       `egg:"stars=5"`
+		Episodes []Episode `egg:"=[JEDI]"`
+		Comment  *string
+	}
+	h := eggql.MustRun(struct {
+		Rate func(Rating) string `egg:"(rating)"`
+	}{
+		Rate: func(r Rating) string { return fmt.Sprintf("%d %v %v", r.Stars, r.Episodes, r.Comment) },
+	})
+	schema := eggql.Schema(h)
+	Assertf(t, strings.Contains(schema, "stars :Int! = 5"), "Schema: expected default for stars, got %s", schema)
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+
+		`{ defaults: rate(rating: {}) given: rate(rating: {stars: 1, episodes: [NEWHOPE, EMPIRE]}) }"}`)))
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{"defaults": "5 [2] <nil>", "given": "1 [0 1] <nil>"}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+
+	_, err := eggql.Run(struct {
+		R struct {
+			Stars int `egg:"stars=5"`
+		}
+	}{})
+	Assertf(t, err != nil, "expected error for default value of a field of an object type")
+}
+
+// TestSmokeTest checks that a query is generated and run for each field of the root query
+func TestSmokeTest(t *testing.T) {
+	type Character struct {
+		Name    string
+		Friends func() []Character
+		Height  func(unit string) float64 `egg:"(unit)"`
+	}
+	var luke Character
+	luke = Character{Name: "Luke", Friends: func() []Character { return []Character{luke} }}
+	h := eggql.MustRun(struct {
+		Hero    func(Episode) Character       `egg:"(episode)"`
+		Search  func(string, int) []Character `egg:"(text,limit=10)"`
+		Broken  func() (int, error)
+		Missing func() string
+	}{
+		Hero:   func(Episode) Character { return luke },
+		Search: func(string, int) []Character { return []Character{} },
+		Broken: func() (int, error) { return 0, errors.New("broken") },
+	})
+
+	results := eggql.SmokeTest(context.Background(), h)
+	expected := []eggql.SmokeResult{
+		{Field: "Query.broken", Query: "{ broken }", Errors: []string{"broken"}},
+		{Field: "Query.hero", Query: "{ hero(episode: NEWHOPE) { friends { friends { name } name } name } }"},
+		{Field: "Query.missing", Query: "{ missing }", Errors: []string{`function for "missing" is not implemented (nil)`}},
+		{Field: "Query.search", Query: `{ search(text: "") { friends { friends { name } name } name } }`},
+	}
+	Assertf(t, reflect.DeepEqual(results, expected), "expected %v, got %v", expected, results)
+	Assertf(t, eggql.SmokeTest(context.Background(), http.NotFoundHandler()) == nil, "expected nil for other handler")
+}
+
+// TestDateTime checks that time.Time fields and arguments are a DateTime scalar (RFC 3339 unless DateTimeFormat is
+// used) by default, or if the type is given in the tag when the DateTime option is off
+func TestDateTime(t *testing.T) {
+	start := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	builtIn := eggql.MustRun(struct {
+		Start time.Time
+		End   *time.Time
+		Times []time.Time
+		Add   func(time.Time, int) time.Time `egg:"(t=\"2000-01-01T00:00:00Z\",days)"`
+	}{
+		Start: start,
+		Times: []time.Time{start, start.Add(time.Hour)},
+		Add:   func(t time.Time, days int) time.Time { return t.AddDate(0, 0, days) },
+	})
+	withTag := eggql.MustRun(struct {
+		Created time.Time `egg:":DateTime!"`
+	}{start}, eggql.DateTime(false))
+	withFormat := eggql.MustRun(struct {
+		Start time.Time
+		Next  func(time.Time) time.Time `egg:"(t=\"2000-01-01\")"`
+	}{
+		Start: start,
+		Next:  func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	}, eggql.DateTimeFormat("2006-01-02"))
+
+	data := map[string]struct {
+		h        http.Handler
+		query    string
+		expected interface{}
+	}{
+		"Field": {builtIn, `{ start end }`, JsonObject{"start": "2022-03-04T05:06:07Z", "end": nil}},
+		"List": {builtIn, `{ times }`,
+			JsonObject{"times": []interface{}{"2022-03-04T05:06:07Z", "2022-03-04T06:06:07Z"}}},
+		"Arg": {builtIn, `{ add(t: \"2022-12-31T23:00:00+01:00\", days: 1) }`,
+			JsonObject{"add": "2023-01-01T23:00:00+01:00"}},
+		"Default":       {builtIn, `{ add(days: 2) }`, JsonObject{"add": "2000-01-03T00:00:00Z"}},
+		"Tag":           {withTag, `{ created }`, JsonObject{"created": "2022-03-04T05:06:07Z"}},
+		"Format":        {withFormat, `{ start next(t: \"2022-02-28\") }`, JsonObject{"start": "2022-03-04", "next": "2022-03-01"}},
+		"FormatDefault": {withFormat, `{ next }`, JsonObject{"next": "2000-01-02"}},
+	}
+	for name, test := range data {
+		t.Run(name, func(t *testing.T) {
+			Assertf(t, strings.Contains(eggql.Schema(test.h), "scalar DateTime"), "expected DateTime scalar in %s",
+				eggql.Schema(test.h))
+			writer := httptest.NewRecorder()
+			test.h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+test.query+`"}`)))
+			var result struct {
+				Data   interface{}
+				Errors []struct{ Message string }
+			}
+			if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+				t.Fatalf("Error decoding JSON: %v", err)
+			}
+			Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+			Assertf(t, reflect.DeepEqual(result.Data, test.expected), "expected %v, got %v", test.expected, result.Data)
+		})
+	}
+
+	_, err := eggql.SchemaString(struct {
+		At func(time.Time) int `egg:"(t=\"yesterday\")"`
+	}{})
+	Assertf(t, err != nil && strings.Contains(err.Error(), "not a valid DateTime"), "expected invalid default, got %v", err)
+	_, err = eggql.SchemaString(struct {
+		At func(time.Time) int `egg:"(t=\"2000-01-01T00:00:00Z\")"`
+	}{}, eggql.DateTimeFormat("2006-01-02"))
+	Assertf(t, err != nil && strings.Contains(err.Error(), "not a valid DateTime"), "expected invalid default, got %v", err)
+}
+
+// TestJSON checks that fields with the json option are a JSON scalar (eg a map is an object not a list)
+func TestJSON(t *testing.T) {
+	type Point struct{ X, Y int }
+	h := eggql.MustRun(struct {
+		Metadata map[string]interface{} `egg:",json"`
+		Extra    interface{}            `egg:",json"`
+		Tags     func() []string        `egg:",json"`
+		Point    *Point                 `egg:",json"`
+	}{
+		Metadata: map[string]interface{}{"colour": "red", "size": 42, "nested": map[string]bool{"ok": true}},
+		Tags:     func() []string { return []string{"a", "b"} },
+		Point:    &Point{1, 2},
+	})
+	schema := eggql.Schema(h)
+	Assertf(t, strings.Contains(schema, "scalar JSON") && strings.Contains(schema, "metadata :JSON!") &&
+		strings.Contains(schema, "extra :JSON ") && strings.Contains(schema, "point :JSON "),
+		"expected JSON fields in schema, got %s", schema)
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "{ metadata extra tags point }"}`)))
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"metadata": JsonObject{"colour": "red", "size": 42.0, "nested": JsonObject{"ok": true}},
+		"extra":    nil,
+		"tags":     []interface{}{"a", "b"},
+		"point":    JsonObject{"X": 1.0, "Y": 2.0},
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+}
+
+// TestRun checks that Run returns an error (rather than terminating the program) if the handler can't be created
+func TestRun(t *testing.T) {
+	h, err := eggql.Run(struct{ Message string }{"hello"})
+	Assertf(t, h != nil && err == nil, "expected a handler and no error, got %v", err)
+
+	errorData := map[string]struct {
+		params   []interface{}
+		expected string // expected error text
+	}{
+		"BadParam":     {[]interface{}{struct{ V int }{}, nil, nil, 42}, "unexpected parameter type (int) in Run"},
+		"BadTag":       {[]interface{}{struct{ V func(int) int }{}}, "no args found"},
+		"BadIDPattern": {[]interface{}{struct{ V int }{}, eggql.IDPattern("[")}, "invalid ID pattern"},
+	}
+	for name, data := range errorData {
+		t.Run(name, func(t *testing.T) {
+			h, err := eggql.Run(data.params...)
+			Assertf(t, h == nil && err != nil && strings.Contains(err.Error(), data.expected),
+				"expected error %q got %v", data.expected, err)
+		})
+	}
+}
+
+// TestFromSDL checks that resolvers are bound to a schema provided as SDL (and that binding errors are found)
+func TestFromSDL(t *testing.T) {
+	const sdl = `type Query { hello: String! user(id: Int!): User nickname: String colour: Colour! }
+		type User { name: String! friends: [Person!]! }
+		type Person { name: String! }
+		enum Colour { RED GREEN }`
+	type User struct {
+		Name    string
+		Friends []Person
+	}
+	q := struct {
+		Hello  string
+		User   func(int) *User `egg:"(id)"`
+		Colour string
+	}{
+		Hello: "hello",
+		User: func(id int) *User {
+			if id != 1 {
+				return nil
+			}
+			return &User{Name: "Andrew", Friends: []Person{{Name: "Al", Age: 21}}}
+		},
+		Colour: "GREEN",
+	}
+	h, err := eggql.FromSDL(sdl, q)
+	if err != nil {
+		t.Fatalf("FromSDL: %v", err)
+	}
+	Assertf(t, eggql.Schema(h) == sdl, "Schema: expected the SDL")
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+	inBody := `{ "query": "{ hello user(id: 1) { name friends { name } } other: user(id: 2) { name } nickname colour }" }`
+	resp, err := server.Client().Post(server.URL, "application/json", strings.NewReader(inBody))
+	if err != nil {
+		t.Fatalf("Error POSTing the query: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	expected := JsonObject{
+		"hello":    "hello",
+		"user":     JsonObject{"name": "Andrew", "friends": []interface{}{JsonObject{"name": "Al"}}},
+		"other":    nil,
+		"nickname": nil,
+		"colour":   "GREEN",
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	Assertf(t, reflect.DeepEqual(result.Data, expected), "expected %v, got %v", expected, result.Data)
+
+	_, err = eggql.FromSDL(sdl, struct{ Hello string }{})
+	Assertf(t, err != nil && strings.Contains(err.Error(), "Query.colour"), "expected unbound field error, got %v", err)
+	_, err = eggql.FromSDL(`type Query { double(value: Int!): Int! }`, struct {
+		Double func(int) int `egg:"(v)"`
+	}{})
+	Assertf(t, err != nil && strings.Contains(err.Error(), `argument "v"`), "expected argument error, got %v", err)
+	_, err = eggql.FromSDL(`type Query { hello: Strin! }`, struct{ Hello string }{})
+	Assertf(t, err != nil, "expected error for invalid SDL")
+	_, err = eggql.FromSDL(`type Query { hello: String! }`, struct{ Hello string }{}, eggql.FloatFormat('x', 2))
+	Assertf(t, err != nil && strings.Contains(err.Error(), "float format"), "expected option error, got %v", err)
+	_, err = eggql.FromSDL(`type Query { hello: String! }`, struct{ Hello string }{}, eggql.IDPattern("[A-Z"))
+	Assertf(t, err != nil && strings.Contains(err.Error(), "ID pattern"), "expected ID pattern error, got %v", err)
+}
+
+type (
+	listItem  struct{ Name string }
+	listTag   struct{ Value int }
+	listEntry struct {
+		Name string
+		Tags map[string]listTag `egg:",field_id=tag"`
+	}
+)
+
+// TestIntrospectFabricated checks that introspection of the fabricated "id" fields and subscript arguments (see
+// "field_id" and "subscript" options) is the same as for a schema written by hand
+func TestIntrospectFabricated(t *testing.T) {
+	const sdl = `type Query {
+		  entry("""position of the element in the list (the first element is 1)""" idx: Int!): listEntry!
+		  items: [listItem!]!
+		}
+		type listItem {
+		  """position of the element in its list"""
+		  id: Int!
+		  name: String!
+		}
+		type listEntry {
+		  """position of the element in its list"""
+		  idx: Int!
+		  name: String!
+		  tags: [listTag!]!
+		}
+		type listTag {
+		  """key of the element in its map"""
+		  tag: String!
+		  value: Int!
+		}`
+	q := struct {
+		Items []listItem  `egg:",field_id"`
+		Entry []listEntry `egg:",subscript=idx,base=1"`
+	}{
+		Items: []listItem{{"a"}, {"b"}},
+		Entry: []listEntry{{Name: "e", Tags: map[string]listTag{"x": {42}}}},
+	}
+	generated := eggql.MustRun(q)
+	written, err := eggql.FromSDL(sdl, q)
+	if err != nil {
+		t.Fatalf("FromSDL: %v", err)
+	}
+
+	for _, query := range []string{
+		`{ __type(name: \"Query\") { fields { name args { name description defaultValue type { kind ofType { name } } } } } }`,
+		`{ __type(name: \"listEntry\") { fields { name description type { kind ofType { name } } } } }`,
+		`{ __type(name: \"listItem\") { fields { name description type { kind ofType { name } } } } }`,
+		`{ __type(name: \"listTag\") { fields { name description type { kind ofType { name } } } } }`,
+		`{ items { id name } entry(idx: 1) { idx name tags { tag value } } }`,
+	} {
+		var results [2]string
+		for i, h := range []http.Handler{generated, written} {
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "`+query+`"}`)))
+			results[i] = writer.Body.String()
+		}
+		Assertf(t, !strings.Contains(results[0], "errors"), "%s: expected no errors, got %s", query, results[0])
+		Assertf(t, results[0] == results[1], "%s: expected %s, got %s", query, results[1], results[0])
+	}
+}
+
+// TestLazyInit checks that resolvers of a root struct can be assigned after the handler is created
+func TestLazyInit(t *testing.T) {
+	q := &struct {
+		Hello func() string
+	}{}
+	h := eggql.MustRun(q, eggql.LazyInit(true))
+	request := func() *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "{ hello }"}`)))
+		return writer
+	}
+
+	writer := request()
+	Assertf(t, writer.Code == http.StatusServiceUnavailable, "expected status 503 before Freeze, got %d", writer.Code)
+	err := eggql.Freeze(h)
+	Assertf(t, err != nil && strings.Contains(err.Error(), "Hello"), "expected unassigned resolver error, got %v", err)
+	Assertf(t, request().Code == http.StatusServiceUnavailable, "expected status 503 after failed Freeze")
+
+	q.Hello = func() string { return "hi" }
+	Assertf(t, eggql.Freeze(h) == nil, "expected Freeze to succeed")
+	writer = request()
+	Assertf(t, writer.Code == http.StatusOK && writer.Body.String() == `{"data":{"hello":"hi"}}`,
+		"expected result after Freeze, got %d %s", writer.Code, writer.Body)
+}
+
+// TestOptionsFromEnv checks that options are set from environment variables and that invalid ones are reported
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("EGGQL_TEST_NO_INTROSPECTION", "true")
+	t.Setenv("EGGQL_TEST_WS_PING_FREQUENCY", "30s")
+	option, err := eggql.OptionsFromEnv("EGGQL_TEST")
+	if err != nil {
+		t.Fatalf("OptionsFromEnv: %v", err)
+	}
+	h := eggql.MustRun(struct{ Hello string }{"hi"}, option)
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": "{ __schema { types { name } } }"}`)))
+	Assertf(t, strings.Contains(writer.Body.String(), "errors"), "expected introspection to be off, got %s", writer.Body)
+
+	t.Setenv("EGGQL_TEST_MAX_COMPLEXITY", "lots")
+	_, err = eggql.OptionsFromEnv("EGGQL_TEST")
+	Assertf(t, err != nil && strings.Contains(err.Error(), "EGGQL_TEST_MAX_COMPLEXITY"), "expected invalid value error, got %v", err)
+	t.Setenv("EGGQL_TEST_MAX_COMPLEXITY", "100")
+	t.Setenv("EGGQL_TEST_PING_FREQUENCY", "30s")
+	_, err = eggql.OptionsFromEnv("EGGQL_TEST")
+	Assertf(t, err != nil && strings.Contains(err.Error(), "not an eggql option"), "expected unknown option error, got %v", err)
+}
+
+// TestMiddleware tests the HTTP middleware (logging, recovery, timeout and gzip) chained around the handler
+func TestMiddleware(t *testing.T) {
+	h := eggql.MustRun(struct {
+		Hello func() string
+		Slow  func(context.Context) (string, error)
+	}{
+		Hello: func() string { return "hi" },
+		Slow: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	})
+	var logged []string
+	logf := func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	post := func(h http.Handler, body string, gzipped bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+		if gzipped {
+			r.Header.Set("Accept-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// Logging includes the operation type and name (body is still seen by the GraphQL handler)
+	w := post(eggql.Chain(h, eggql.LoggingMiddleware(logf)), `{"query": "query Greet { hello }"}`, false)
+	Assertf(t, strings.Contains(w.Body.String(), `"hi"`), "Logging: expected result, got %s", w.Body.String())
+	Assertf(t, len(logged) == 1 && strings.HasPrefix(logged[0], "POST query Greet 200 "), "Logging: got %v", logged)
+
+	// Logging does not read all of a huge body - the operation is not logged but the handler still gets the body
+	w = post(eggql.Chain(h, eggql.LoggingMiddleware(logf)), `{"query": "query Greet { hello`+
+		strings.Repeat(" ", 2<<20)+`}"}`, false)
+	Assertf(t, strings.Contains(w.Body.String(), `"hi"`), "Logging: expected result, got %s", w.Body.String())
+	Assertf(t, len(logged) == 2 && strings.HasPrefix(logged[1], "POST - 200 "), "Logging: got %v", logged)
+	logged = logged[:1]
+
+	// Recovery returns a GraphQL error
+	w = post(eggql.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("oops") }),
+		eggql.RecoveryMiddleware(logf)), `{"query": "{ hello }"}`, false)
+	Assertf(t, w.Code == http.StatusInternalServerError && strings.Contains(w.Body.String(), `"errors"`),
+		"Recovery: got %d %s", w.Code, w.Body.String())
+	Assertf(t, len(logged) == 2 && strings.Contains(logged[1], "oops"), "Recovery: got %v", logged)
+
+	// Timeout returns a GraphQL error (JSON) and cancels the context
+	w = post(eggql.Chain(h, eggql.TimeoutMiddleware(10*time.Millisecond)), `{"query": "{ slow }"}`, false)
+	Assertf(t, w.Code == http.StatusServiceUnavailable && strings.Contains(w.Body.String(), `"timeout after 10ms"`),
+		"Timeout: got %d %s", w.Code, w.Body.String())
+	w = post(eggql.Chain(h, eggql.TimeoutMiddleware(time.Second)), `{"query": "{ hello }"}`, false)
+	Assertf(t, w.Code == http.StatusOK && strings.Contains(w.Body.String(), `"hi"`), "NoTimeout: got %d %s", w.Code, w.Body.String())
+
+	// Gzip compresses the response if accepted
+	w = post(eggql.Chain(h, eggql.GzipMiddleware()), `{"query": "{ hello }"}`, true)
+	Assertf(t, w.Header().Get("Content-Encoding") == "gzip", "Gzip: expected gzip encoding")
+	var body []byte
+	if gz, err := gzip.NewReader(w.Body); err == nil {
+		body, _ = ioutil.ReadAll(gz)
+	}
+	Assertf(t, strings.Contains(string(body), `"hi"`), "Gzip: expected result, got %q", body)
+	w = post(eggql.Chain(h, eggql.GzipMiddleware()), `{"query": "{ hello }"}`, false)
+	Assertf(t, w.Header().Get("Content-Encoding") == "" && strings.Contains(w.Body.String(), `"hi"`), "NoGzip: got %s", w.Body.String())
+}
+
+// TestOrderedMap tests that an OrderedMap is listed in order, and can be used with the subscript and field_id options
+func TestOrderedMap(t *testing.T) {
+	var people eggql.OrderedMap[string, Person]
+	people.Set("zed", Person{"Zed", 30})
+	people.Set("al", Person{"Al", 21})
+	people.Set("bob", Person{"Bob", 22})
+	people.Set("al", Person{"Alan", 21}) // replaces value but keeps position
+	var scores eggql.OrderedMap[int, int]
+	scores.Set(3, 30)
+	scores.Set(1, 10)
+	scores.Set(2, 20)
+	scores.Delete(1)
+
+	schema, err := eggql.SchemaString(struct {
+		People eggql.OrderedMap[string, Person] `egg:",field_id=key"`
+	}{})
+	Assertf(t, err == nil && strings.Contains(schema, "[Person!]!"), "Schema: expected list of Person, got %v %s", err, schema)
+
+	h := eggql.MustRun(struct {
+		People   eggql.OrderedMap[string, Person]  `egg:",field_id=key"`
+		Person   *eggql.OrderedMap[string, Person] `egg:",subscript=key"`
+		Scores   func() eggql.OrderedMap[int, int]
+		NoScores eggql.OrderedMap[int, int]
+	}{People: people, Person: &people, Scores: func() eggql.OrderedMap[int, int] { return scores }})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp, err := server.Client().Post(server.URL, "application/json",
+		strings.NewReader(`{"query": "{ people { key name } person(key: \"bob\") { name } scores noScores }"}`))
+	if err != nil {
+		t.Fatalf("Error POSTing the query: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	expected := `{"data":{"people":[{"key":"zed","name":"Zed"},{"key":"al","name":"Alan"},{"key":"bob","name":"Bob"}],` +
+		`"person":{"name":"Bob"},"scores":[30,20],"noScores":[]}}`
+	Assertf(t, string(body) == expected, "Query: expected %s, got %s", expected, body)
+}
+
+// TestConnection tests the generic pagination types (Connection, Edge and PageInfo) and Paginate
+func TestConnection(t *testing.T) {
+	people := []Person{{"Al", 21}, {"Bob", 22}, {"Cy", 23}}
+	q := struct {
+		People func(first int, after string) (eggql.Connection[Person], error) `egg:"(first=-1,after=\"\")"`
+	}{
+		People: func(first int, after string) (eggql.Connection[Person], error) {
+			return eggql.Paginate(people, first, after)
+		},
+	}
+	schema, err := eggql.SchemaString(q)
+	Assertf(t, err == nil, "Schema: expected no error, got %v", err)
+	for _, want := range []string{"typePersonConnection{", "edges:[PersonEdge!]!", "pageInfo:PageInfo!",
+		`people(first:Int!=-1,after:String!=""):PersonConnection!`, "typePersonEdge{", "node:Person!"} {
+		Assertf(t, strings.Contains(strings.Join(strings.Fields(schema), ""), want), "Schema: expected %q in %s", want, schema)
+	}
+
+	h := eggql.MustRun(q)
+	server := httptest.NewServer(h)
+	defer server.Close()
+	query := func(args string) string {
+		resp, err := server.Client().Post(server.URL, "application/json", strings.NewReader(`{"query": "{ people`+args+
+			` { totalCount edges { node { name } cursor } pageInfo { hasNextPage hasPreviousPage endCursor } } }"}`))
+		if err != nil {
+			t.Fatalf("Error POSTing the query: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	got := query(`(first: 2)`)
+	expected := `{"data":{"people":{"totalCount":3,"edges":[{"node":{"name":"Al"},"cursor":"` + eggql.OffsetCursor(0) +
+		`"},{"node":{"name":"Bob"},"cursor":"` + eggql.OffsetCursor(1) + `"}],"pageInfo":{"hasNextPage":true,` +
+		`"hasPreviousPage":false,"endCursor":"` + eggql.OffsetCursor(1) + `"}}}}`
+	Assertf(t, got == expected, "First: expected %s, got %s", expected, got)
+
+	got = query(`(after: \"` + eggql.OffsetCursor(1) + `\")`)
+	expected = `{"data":{"people":{"totalCount":3,"edges":[{"node":{"name":"Cy"},"cursor":"` + eggql.OffsetCursor(2) +
+		`"}],"pageInfo":{"hasNextPage":false,"hasPreviousPage":true,"endCursor":"` + eggql.OffsetCursor(2) + `"}}}}`
+	Assertf(t, got == expected, "After: expected %s, got %s", expected, got)
+
+	got = query(`(after: \"` + eggql.OffsetCursor(2) + `\")`)
+	expected = `{"data":{"people":{"totalCount":3,"edges":[],"pageInfo":{"hasNextPage":false,"hasPreviousPage":true,"endCursor":null}}}}`
+	Assertf(t, got == expected, "End: expected %s, got %s", expected, got)
+
+	got = query(`(after: \"junk\")`)
+	Assertf(t, strings.Contains(got, `invalid cursor`), "Invalid: expected error, got %s", got)
+}
+
 // Assertf displays a tick or cross depending on the success of the test (succeeded)
 // It also displays a nicely formated message if the test failed, and also displays the message for successful tests if
 // all results are displayed (-v testing option) OR any other test run at the same time fails
@@ -196,3 +1232,89 @@ func Assertf(t *testing.T, succeeded bool, format string, args ...interface{}) {
 		t.Logf("%-6s"+format, append([]interface{}{succeed}, args...)...)
 	}
 }
+
+// TestSplitDescription checks that a description with a summary and details (on separate lines) is returned by
+// introspection and can be split
+func TestSplitDescription(t *testing.T) {
+	h := eggql.MustRun(map[string][]string{"Unit# Units of measurement\nSI units only": {"METRE# the metre\nabout a yard"}},
+		struct {
+			Height func(int) float64 `egg:"(unit:Unit=METRE# Units\n  the default is metres)# How tall they are\nMeasured without shoes"`
+			Mass   int               `egg:"# Just a summary"`
+		}{Height: func(int) float64 { return 1.8 }})
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": `+
+		`"{ __type(name: \"Query\") { fields { description args { description } } } }"}`)))
+	var result struct {
+		Data struct {
+			Type struct {
+				Fields []struct {
+					Description string
+					Args        []struct{ Description string }
+				}
+			} `json:"__type"`
+		}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	fields := result.Data.Type.Fields
+	Assertf(t, len(fields) == 2 && len(fields[0].Args) == 1, "expected 2 fields got %v", fields)
+	Assertf(t, fields[0].Description == " How tall they are\nMeasured without shoes",
+		"expected description of 2 lines got %q", fields[0].Description)
+	Assertf(t, fields[0].Args[0].Description == " Units\n  the default is metres",
+		"expected argument description of 2 lines got %q", fields[0].Args[0].Description)
+
+	summary, details := eggql.SplitDescription(fields[0].Description)
+	Assertf(t, summary == "How tall they are" && details == "Measured without shoes",
+		"expected summary and details got %q and %q", summary, details)
+	summary, details = eggql.SplitDescription(fields[1].Description)
+	Assertf(t, summary == "Just a summary" && details == "", "expected just a summary got %q and %q", summary, details)
+}
+
+// TestDescriptionEscapes checks that descriptions containing quotes, backslashes, brackets, etc are returned intact
+// by introspection (ie the schema is valid and the tags are parsed correctly)
+func TestDescriptionEscapes(t *testing.T) {
+	h := eggql.MustRun(map[string][]string{"Unit": {`METRE# the "metre" \ m`}},
+		struct {
+			A func(int) int `egg:"(unit:Unit=METRE# in (\"units\"\\, eg #1\\)),# say \"\"\"hi\"\"\""`
+			B int           `egg:"# ends with a \"quote\""`
+			C int           `egg:"# ends with a backslash \\"`
+			D int           `egg:"# summary\nsays \"\"\"hi\"\"\" \\ bye"`
+		}{A: func(int) int { return 1 }})
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query": `+
+		`"{ __type(name: \"Query\") { fields { description args { description } } } `+
+		`unit: __type(name: \"Unit\") { enumValues { description } } }"}`)))
+	var result struct {
+		Data struct {
+			Type struct {
+				Fields []struct {
+					Description string
+					Args        []struct{ Description string }
+				}
+			} `json:"__type"`
+			Unit struct {
+				EnumValues []struct{ Description string }
+			}
+		}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	Assertf(t, result.Errors == nil, "expected no error and got %v", result.Errors)
+	fields := result.Data.Type.Fields
+	Assertf(t, len(fields) == 4 && len(fields[0].Args) == 1, "expected 4 fields got %v", fields)
+	expected := []string{` say """hi"""`, ` ends with a "quote"`, ` ends with a backslash \`, " summary\nsays \"\"\"hi\"\"\" \\ bye"}
+	for i, field := range fields {
+		Assertf(t, field.Description == expected[i], "expected %q got %q", expected[i], field.Description)
+	}
+	Assertf(t, fields[0].Args[0].Description == ` in ("units", eg #1)`,
+		"expected argument description got %q", fields[0].Args[0].Description)
+	values := result.Data.Unit.EnumValues
+	Assertf(t, len(values) == 1 && values[0].Description == ` the "metre" \ m`, "expected enum value description got %v", values)
+}
@@ -0,0 +1,112 @@
+package eggql
+
+// env.go gets options from environment variables so that a deployment can tune the server without recompiling
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEnvPrefix is the prefix of the names of the environment variables used by OptionsFromEnv if none is given
+const DefaultEnvPrefix = "EGGQL"
+
+// envOptions maps the name of each environment variable (after the prefix and underscore) to a function that
+// sets the option from the variable's value
+var envOptions = map[string]func(opt *options, value string) error{
+	"CACHE":                   envBool(func(opt *options, on bool) { opt.funcCache = on }),
+	"CACHE_TTL":               envDuration(func(opt *options, d time.Duration) { opt.cacheTTL = d }),
+	"CACHE_MAX_ENTRIES":       envInt(func(opt *options, n int) { opt.cacheMaxEntries = n }),
+	"NO_INTROSPECTION":        envBool(func(opt *options, on bool) { opt.noIntrospection = on }),
+	"NO_CONCURRENCY":          envBool(func(opt *options, on bool) { opt.noConcurrency = on }),
+	"MAX_RESOLVER_GOROUTINES": envInt(func(opt *options, n int) { opt.maxResolverGoroutines = n }),
+	"REQUEST_WORKERS":         envInt(func(opt *options, n int) { opt.requestWorkers = n }),
+	"OMIT_NULLS":              envBool(func(opt *options, on bool) { opt.omitNulls = on }),
+	"ADD_TYPENAME":            envBool(func(opt *options, on bool) { opt.addTypename = on }),
+	"INT_ENUMS":               envBool(func(opt *options, on bool) { opt.intEnums = on }),
+	"OPERATION_TIMEOUT":       envDuration(func(opt *options, d time.Duration) { opt.operationTimeout = d }),
+	"MAX_REQUEST_SIZE":        envInt(func(opt *options, n int) { opt.maxRequestSize = int64(n) }),
+	"MAX_BATCH_SIZE":          envInt(func(opt *options, n int) { opt.maxBatchSize = n }),
+	"MAX_COMPLEXITY":          envInt(func(opt *options, n int) { opt.maxComplexity = n }),
+	"MAX_ERRORS":              envInt(func(opt *options, n int) { opt.maxErrors = n }),
+	"MAX_CONCURRENT_REQUESTS": envInt(func(opt *options, n int) { opt.maxConcurrentRequests = n }),
+	"RATE_LIMIT": func(opt *options, value string) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		opt.requestRate = rate
+		return err
+	},
+	"RATE_LIMIT_BURST":       envInt(func(opt *options, n int) { opt.requestBurst = n }),
+	"TRACING":                envBool(func(opt *options, on bool) { opt.tracing = on }),
+	"SERVE_DOCS":             envBool(func(opt *options, on bool) { opt.serveDocs = on }),
+	"SERVE_SCHEMA":           envBool(func(opt *options, on bool) { opt.serveSchema = on }),
+	"WS_INITIAL_TIMEOUT":     envDuration(func(opt *options, d time.Duration) { opt.initialTimeout = d }),
+	"WS_PING_FREQUENCY":      envDuration(func(opt *options, d time.Duration) { opt.pingFrequency = d }),
+	"WS_PONG_TIMEOUT":        envDuration(func(opt *options, d time.Duration) { opt.pongTimeout = d }),
+	"WS_REQUIRE_SUBPROTOCOL": envBool(func(opt *options, on bool) { opt.requireSubprotocol = on }),
+}
+
+// OptionsFromEnv returns an option (to pass to MustRun etc) that sets the options given in environment variables,
+// so that a deployment can tune the server without recompiling.  The names of the variables are the prefix (or
+// DefaultEnvPrefix if prefix is empty) and an underscore followed by the name of the option, eg EGGQL_CACHE=true
+// or EGGQL_WS_PING_FREQUENCY=30s.  (See the README for the full list.)  An error is returned if a value is invalid
+// or a variable with the prefix is not the name of an option (eg misspelt).  Options given after this option (in
+// the parameters of MustRun) override those from the environment.
+func OptionsFromEnv(prefix string) (func(*options), error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	prefix += "_"
+
+	var setters []func(*options)
+	var names []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, prefix) {
+			names = append(names, kv)
+		}
+	}
+	sort.Strings(names) // so that errors are reported in a consistent order
+	for _, kv := range names {
+		name, value, _ := strings.Cut(kv, "=")
+		set, ok := envOptions[strings.TrimPrefix(name, prefix)]
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not an eggql option", name)
+		}
+		if err := set(&options{}, value); err != nil {
+			return nil, fmt.Errorf("environment variable %s has an invalid value %q", name, value)
+		}
+		setters = append(setters, func(opt *options) { _ = set(opt, value) })
+	}
+	return func(opt *options) {
+		for _, set := range setters {
+			set(opt)
+		}
+	}, nil
+}
+
+// envBool, envInt and envDuration make the functions that set an option from the value of an environment variable
+func envBool(f func(*options, bool)) func(*options, string) error {
+	return func(opt *options, value string) error {
+		on, err := strconv.ParseBool(value)
+		f(opt, on)
+		return err
+	}
+}
+
+func envInt(f func(*options, int)) func(*options, string) error {
+	return func(opt *options, value string) error {
+		n, err := strconv.Atoi(value)
+		f(opt, n)
+		return err
+	}
+}
+
+func envDuration(f func(*options, time.Duration)) func(*options, string) error {
+	return func(opt *options, value string) error {
+		d, err := time.ParseDuration(value)
+		f(opt, d)
+		return err
+	}
+}
@@ -18,35 +18,35 @@ const (
 	userIDClaim = "jti"
 	expiryClaim = "exp"
 	issuerClaim = "iss"
-)
 
-type authHandler struct {
-	inner http.Handler
-}
+	tokenCookie = "token" // cookie set by the login mutation
+)
 
-// ServeHTTP gets the user ID from the JWT token in the HTTP Authorization Header
-// and adds it to the request context so the handler can check that it's authorised.
-func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.inner.ServeHTTP(w, func(r *http.Request) *http.Request {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			return r // no auth hdr
+// authContext gets the user ID from the JWT token in the HTTP Authorization Header (or the token cookie)
+// and adds it to the request context so the resolvers can check that it's authorised.
+func authContext(ctx context.Context, r *http.Request) (context.Context, error) {
+	var tokenString string
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		tokenString = authHeader[len("Bearer "):]
+	} else if cookie, err := r.Cookie(tokenCookie); err == nil {
+		tokenString = cookie.Value
+	} else {
+		return ctx, nil // no auth hdr or cookie
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
 		}
-		token, err := jwt.Parse(authHeader[len("Bearer "):], func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
-			}
-			return []byte(APP_SECRET), nil
-		})
-		if err != nil || !token.Valid {
-			return r // token invalid
-		}
-		ID := token.Claims.(jwt.MapClaims)["jti"]
-		if ID == nil {
-			return r // no ID
-		}
-		return r.WithContext(context.WithValue(r.Context(), "user", ID))
-	}(r))
+		return []byte(APP_SECRET), nil
+	})
+	if err != nil || !token.Valid {
+		return ctx, nil // token invalid
+	}
+	ID := token.Claims.(jwt.MapClaims)["jti"]
+	if ID == nil {
+		return ctx, nil // no ID
+	}
+	return context.WithValue(ctx, "user", ID), nil
 }
 
 // GetToken returns a JWT token for the given user ID.  This JWT indicates what user
@@ -20,9 +20,9 @@ type (
 	}
 
 	Mutation struct {
-		Post   func(context.Context, string, string) (Link, error) `egg:"post(url,description)"`
-		Signup func(string, string, string) (AuthPayload, error)   `egg:"signup(email,password,name)"`
-		Login  func(string, string) (AuthPayload, error)           `egg:"login(email,password)"`
+		Post   func(context.Context, string, string) (Link, error)        `egg:"post(url,description)"`
+		Signup func(string, string, string) (AuthPayload, error)          `egg:"signup(email,password,name)"`
+		Login  func(context.Context, string, string) (AuthPayload, error) `egg:"login(email,password)"`
 	}
 )
 
@@ -36,10 +36,10 @@ func main() {
 			Signup: Signup,
 			Login:  Login,
 		},
+		eggql.ContextFunc(authContext),
 	)
 
-	handler = http.TimeoutHandler(handler, 15*time.Second, `{"errors":[{"message":"timeout"}]}`)
-	handler = &authHandler{inner: handler}
+	handler = eggql.Chain(handler, eggql.RecoveryMiddleware(log.Printf), eggql.TimeoutMiddleware(15*time.Second))
 	http.Handle(path, handler)
 
 	log.Println("starting server on: http://", address+path)
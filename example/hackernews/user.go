@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"math/rand"
+	"net/http"
 	"strconv"
 
 	"github.com/andrewwphillips/eggql"
@@ -46,8 +48,8 @@ func Signup(email, password, name string) (AuthPayload, error) {
 	return AuthPayload{Token: tokenString, User: users[ID]}, nil
 }
 
-// Login authenticates a user.
-func Login(email, password string) (AuthPayload, error) {
+// Login authenticates a user.  The token is returned and also set as a cookie (for browser clients).
+func Login(ctx context.Context, email, password string) (AuthPayload, error) {
 	for ID, user := range users {
 		if user.Email == email {
 			if err := bcrypt.CompareHashAndPassword([]byte(user.password), []byte(password)); err == nil {
@@ -55,6 +57,8 @@ func Login(email, password string) (AuthPayload, error) {
 				if err != nil {
 					return AuthPayload{}, err
 				}
+				eggql.SetCookie(ctx, &http.Cookie{Name: tokenCookie, Value: tokenString, Path: "/",
+					MaxAge: 24 * 60 * 60, HttpOnly: true, SameSite: http.SameSiteStrictMode})
 				return AuthPayload{Token: tokenString, User: user}, nil
 			}
 			// break - don't break in case of multiple logins with the same email addr.
@@ -405,7 +405,6 @@ func main() {
 			},
 		},
 	)
-	//handler = http.TimeoutHandler(handler, 15*time.Second, `{"errors":[{"message":"timeout"}]}`)
 	http.Handle("/graphql", handler)
 
 	log.Println("starting server")
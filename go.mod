@@ -1,12 +1,13 @@
 module github.com/andrewwphillips/eggql
 
-go 1.16
+go 1.18
 
 require (
+	github.com/agnivade/levenshtein v1.0.1 // indirect
 	github.com/dolmen-go/jsonmap v0.0.0-20210331234024-f4ef59ae53f6
 	github.com/golang-jwt/jwt/v4 v4.4.1
 	github.com/gorilla/websocket v1.5.0
+	github.com/posener/wstest v1.2.0
 	github.com/vektah/gqlparser/v2 v2.4.1
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
-	github.com/posener/wstest v1.2.0
 )
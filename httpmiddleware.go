@@ -0,0 +1,287 @@
+package eggql
+
+// httpmiddleware.go has HTTP middleware tailored to the GraphQL handler (logging, recovery, timeout and gzip)
+// that can be chained together to wrap the handler returned by MustRun (see Chain)
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// Middleware wraps an http.Handler (such as the one returned by MustRun) to add behaviour - see Chain
+type Middleware = func(http.Handler) http.Handler
+
+// Chain wraps a handler in middleware, where the first middleware is the outermost (sees the request first), eg:
+//
+//	http.Handle("/graphql", eggql.Chain(eggql.MustRun(q), eggql.RecoveryMiddleware(log.Printf), eggql.GzipMiddleware()))
+func Chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// LoggingMiddleware logs each request using logf (eg log.Printf) after it has been handled, including the
+// GraphQL operation (type and name), the response status and how long it took, eg:
+//
+//	POST query Hero 200 1.2ms
+func LoggingMiddleware(logf func(format string, args ...interface{})) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			operation := requestOperation(r)
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			logf("%s %s %d %v", r.Method, operation, sw.status, time.Since(start))
+		})
+	}
+}
+
+// maxLoggedBody is the most of a POST request body that LoggingMiddleware reads to find the operation
+const maxLoggedBody = 1 << 20
+
+// requestOperation returns the type and name of the GraphQL operation of a request (eg "query Hero").  The request
+// body is restored so that it can still be read by the GraphQL handler.  To avoid holding a huge body in memory no
+// more than maxLoggedBody bytes are read - if the body is larger the operation is not logged.
+func requestOperation(r *http.Request) string {
+	if isWebSocket(r) {
+		return "websocket"
+	}
+	var request struct {
+		Query         string `json:"query"`
+		OperationName string `json:"operationName"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		request.Query = r.URL.Query().Get("query")
+		request.OperationName = r.URL.Query().Get("operationName")
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+		if len(body) > maxLoggedBody {
+			// Too big - leave it to the handler to read the rest of the body (and reject it if over its limit)
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			return "-"
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil || json.Unmarshal(body, &request) != nil {
+			return "-"
+		}
+	default:
+		return "-"
+	}
+
+	doc, err := parser.ParseQuery(&ast.Source{Input: request.Query})
+	if err != nil || len(doc.Operations) == 0 {
+		return "-"
+	}
+	op := doc.Operations[0]
+	if request.OperationName != "" {
+		if op = doc.Operations.ForName(request.OperationName); op == nil {
+			return "- " + request.OperationName
+		}
+	}
+	if op.Name == "" {
+		return string(op.Operation)
+	}
+	return string(op.Operation) + " " + op.Name
+}
+
+// statusWriter records the status of a response (for logging) while still allowing a websocket connection
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// RecoveryMiddleware recovers from a panic in the handler, logging it using logf (if not nil) and returning a
+// GraphQL error with status 500 (Internal Server Error), rather than closing the connection.
+func RecoveryMiddleware(logf func(format string, args ...interface{})) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec) // used deliberately to abort a response
+					}
+					if logf != nil {
+						logf("panic handling %s %s: %v", r.Method, r.URL.Path, rec)
+					}
+					writeError(w, http.StatusInternalServerError, "internal server error")
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TimeoutMiddleware is like http.TimeoutHandler but returns a GraphQL error (JSON) response with status 503
+// (Service Unavailable) if the handler has not finished before the timeout.  The request's context is cancelled
+// at the timeout so that resolvers that take a context.Context can stop.  Websocket connections (subscriptions)
+// are not subject to the timeout.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWebSocket(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						panicked <- rec
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case rec := <-panicked:
+				panic(rec) // propagate panic (eg to RecoveryMiddleware) in the request's goroutine
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				for k, v := range tw.header {
+					w.Header()[k] = v
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("timeout after %v", timeout))
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a response until the handler has finished (see TimeoutMiddleware)
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header { return w.header }
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
+
+// GzipMiddleware compresses responses (using gzip) if the client accepts it (Accept-Encoding header)
+func GzipMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWebSocket(r) || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Add("Vary", "Accept-Encoding")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			next.ServeHTTP(&gzipWriter{ResponseWriter: w, w: gz}, r)
+		})
+	}
+}
+
+// gzipWriter sends the body of a response through a gzip.Writer
+type gzipWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length") // length of uncompressed body is wrong
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	return w.w.Write(p)
+}
+
+// isWebSocket returns true if the request is to open a websocket (for subscriptions)
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// writeError writes a response with a status and a GraphQL error with a message
+func writeError(w http.ResponseWriter, status int, message string) {
+	msg, _ := json.Marshal(message)
+	w.Header().Set("Content-Type", "application/graphql+json")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"data": null,"errors": [{"message": ` + string(msg) + `}]}`))
+}
@@ -0,0 +1,14 @@
+package field
+
+// dynamic.go has the Dynamic type used to serve semi-structured data (eg JSON documents) without declaring structs
+
+import "reflect"
+
+// Dynamic is a "dynamic object" whose fields are the keys of the map.  The GraphQL type of a field of type Dynamic
+// (or a list of Dynamic) must be given in the egg: tag and declared in SDL (eg using the ExtendSchema option).
+// The value of each map entry is converted according to the type of the field in the schema, where a nested object
+// is a map[string]interface{} (or Dynamic) and a list is a slice.
+type Dynamic map[string]interface{}
+
+// DynamicType is the dynamic type of Dynamic, used to recognise fields that are dynamic objects
+var DynamicType = reflect.TypeOf(Dynamic(nil))
@@ -0,0 +1,32 @@
+package field
+
+// enum.go recognises Go types that are GraphQL enums, ie named integer types with an EnumValues method, so that
+// enums can be declared with the Go type rather than in the map of enums passed to MustRun
+
+import (
+	"reflect"
+)
+
+// EnumValuer is implemented by a named integer type to make it a GraphQL enum of the same name.  EnumValues returns
+// the names of the enum values in order, so that the Go value 0 is the first name, 1 the second, etc.  As with
+// the map of enums, a name may be followed by a description after a hash (#), eg "JEDI# Return of the Jedi".
+type EnumValuer interface {
+	EnumValues() []string
+}
+
+// enumValuerType is the dynamic type of the EnumValuer interface
+var enumValuerType = reflect.TypeOf((*EnumValuer)(nil)).Elem()
+
+// EnumName returns the GraphQL name of an enum type (and true) if t is a named integer type with an EnumValues
+// method (with a value receiver), or false if t is not an enum type
+func EnumName(t reflect.Type) (string, bool) {
+	if t.Kind() < reflect.Int || t.Kind() > reflect.Uint64 || t.Name() == "" || !t.Implements(enumValuerType) {
+		return "", false
+	}
+	return TypeName(t), true
+}
+
+// EnumValues returns the values (and any descriptions) of an enum type (see EnumName)
+func EnumValues(t reflect.Type) []string {
+	return reflect.Zero(t).Interface().(EnumValuer).EnumValues()
+}
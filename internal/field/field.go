@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -19,6 +20,10 @@ type (
 	// ID indicates that a field is to be used as a GraphQL ID type
 	ID string
 
+	// IntID is a GraphQL ID that is backed by an integer - it is always numeric and is encoded as an Int
+	// (in query results) but a client can supply it as an Int or a String (containing only digits)
+	IntID int64
+
 	// Unmarshaler must be implemented by custom scalar types to decode a string into the type
 	// It must be able to handle a string created with MarshalerEGGQL() (below) [or String() if there is no marshaler]
 	Unmarshaler interface {
@@ -33,6 +38,33 @@ type (
 	}
 )
 
+// IDType and IntIDType are the dynamic types of ID and IntID, used to recognise fields of GraphQL ID type
+var (
+	IDType    = reflect.TypeOf(ID(""))
+	IntIDType = reflect.TypeOf(IntID(0))
+)
+
+// IsID returns true if t is one of the Go types used for a GraphQL ID (or a pointer to one)
+func IsID(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == IDType || t == IntIDType
+}
+
+// DateTimeName is the name of the GraphQL scalar for time.Time values, which are encoded as an RFC 3339 string
+// (unless another format is given with the DateTimeFormat option)
+const DateTimeName = "DateTime"
+
+// DefaultDateTimeFormat is the layout (see time.Format) used to encode and decode DateTime values by default
+const DefaultDateTimeFormat = time.RFC3339
+
+// JSONName is the name of the GraphQL scalar for fields with the "json" option
+const JSONName = "JSON"
+
+// TimeType is the dynamic type of time.Time, used to recognise fields of the DateTime scalar type
+var TimeType = reflect.TypeOf(time.Time{})
+
 // UnmarshalerType is the dynamic type of the Unmarshaler interface
 // It's used to check if a type has an UnmarshalEGGQL method, which indicates it is a custom scalar type.
 // The way it is obtained is a little tricky - you first get the type of a ptr to an Unmarshaler (which
@@ -56,6 +88,8 @@ type Info struct {
 	ArgTypes        []string // corresp. type names - usually deduced from function parameter type but needed for ID and enums
 	ArgDefaults     []string // corresp. default value(s) (as strings) where an empty string means there is no default
 	ArgDescriptions []string // corresp. description of the argument
+	ArgDirectives   []string // corresp. directive, eg @deprecated(reason: "...") from the {deprecated} option, or empty
+	SecretArgs      []string // name(s) of args with the {secret} option whose values are redacted from errors
 	HasContext      bool     // 1st function parameter is a context.Context (not a query argument)
 	HasError        bool     // has 2 return values the 2nd of which is a Go error
 
@@ -65,10 +99,52 @@ type Info struct {
 	NoCache  bool // never cache this resolver
 	IsChan   bool // field must be/return a channel for subscription fields (only)
 
+	// Batch is set using the "batch" option for a resolver function (of the elements of a list) that is called once
+	// for all elements with a slice of their keys (or the elements themselves) and returns a slice of results
+	Batch bool
+
+	// Wildcard is set using the "wildcard" option for a function (see WildcardType) that resolves all the fields of
+	// the GraphQL type that do not have a Go field, ie fields added to the schema in SDL (see ExtendSchema option)
+	Wildcard bool
+
+	// OptionalFunc is set using the "optional_func" option to allow a resolver function to be nil (resolves to null)
+	OptionalFunc bool
+
+	// JSON is set using the "json" option so that the field is a JSON scalar, ie its value (of any type) is encoded
+	// as JSON, eg so that a map[string]interface{} is a free-form object rather than a list
+	JSON bool
+
+	// Default is the default value (as a GraphQL literal or named default) of a field of an input type, given after
+	// an equals sign (eg "stars=5"), which is used if the client omits the field from an input object
+	Default string
+
+	// Initial is the Go name of another field (of the same struct) that provides the current value which is sent
+	// to the client as soon as it subscribes, before any values from the channel (see "initial" option)
+	Initial string
+
 	Directives []string // directives to apply to the field (eg "@deprecated")
 
-	// Note: Subscript and FieldID are only used if the struct field is a container (slice/array/map) and
-	//       either the "subscript" or the "field_id" option has been used in the field's egg: tag string.
+	// RateLimit and RateLimitPeriod are set using the "rateLimit" option (eg rateLimit=10/m)
+	RateLimit       int           // max. number of times a client can resolve the field in the period (0 = no limit)
+	RateLimitPeriod time.Duration // length of the rate limit window
+
+	// Complexity is set using the "complexity" option (eg complexity(10,first)) - the factors (integers or names of
+	// arguments) are multiplied to estimate how many results the field returns when checking query complexity
+	Complexity []string
+
+	// Timeout is set using the "timeout" option (eg timeout=200ms) to tighten the context deadline of the resolver
+	Timeout time.Duration
+
+	// CacheStale and CacheMaxAge are set using the "cache" option (eg cache=swr:30s,max:5m) for stale-while-revalidate
+	// caching: a cached value older than CacheStale is still used but is refreshed in the background, while a value
+	// older than CacheMaxAge (if not zero) is not used
+	CacheStale  time.Duration
+	CacheMaxAge time.Duration
+	// CacheTTL is set using the "cache" option with just a duration (eg cache=30s) - cached values expire after this
+	CacheTTL time.Duration
+
+	// Note: Subscript and FieldID are only used if the struct field is a container (slice/array/map), or a function
+	//       returning one, and either the "subscript" or the "field_id" option has been used in the field's egg: tag.
 	// subscript: the GraphQL schema field represents a single element of the container and the resolver
 	//            takes a single parameter of Int! type (for slice/array) or key type (for a map)
 	// field_id: the container is presented as a GraphQL list with a fabricated field for the integer index
@@ -84,10 +160,16 @@ type Info struct {
 	BaseIndex int
 	// IndexType is the type used to index into a map/slice/array - only used if FieldID or Subscript are used
 	IndexType reflect.Type //  int for slice/array, type of the key for maps
+	// MapIndex is true if the index (see IndexType) is the key of a map, rather than the position in a slice/array
+	MapIndex bool
 	// Description is text used as a GraphQL description for the field - taken from the tag string after any # character (outside brackets)
 	Description string // All text in the tag after the first hash (#) [unless the # is in brackets or in a string]
 }
 
+// WildcardType is the type of a resolver with the "wildcard" option, which is passed the name and arguments of the
+// field to resolve
+var WildcardType = reflect.TypeOf((func(context.Context, string, map[string]interface{}) (interface{}, error))(nil))
+
 // contextType is used to check if a resolver function takes a context.Context (1st) parameter
 var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 
@@ -98,7 +180,8 @@ var errorType = reflect.TypeOf((*error)(nil)).Elem()
 //
 //	field name, derived from the Go field name (with 1st char lower-cased) or taken from the tag (metadata).
 //	It also returns other stuff like whether the result is nullable and GraphQL parameters (and default
-//	parameter values) if the resolver is a function.
+//	parameter values) if the resolver is a function.  Any metadata registered (see Describe) for the
+//	field of the struct type (parent) is merged with the tag info.
 //
 // Returns
 //   - ptr to field.Info, or nil if the field is not used (ie: not exported or metadata is just a dash (-))
@@ -107,7 +190,7 @@ var errorType = reflect.TypeOf((*error)(nil)).Elem()
 //   - malformed metadata such as an unknown option (not one of args, nullable, subscript, field_id, base)
 //   - type of the field is invalid (eg resolver function with no return value)
 //   - inconsistency between the type and metadata (eg function parameters do not match the "args" option)
-func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
+func Get(parent reflect.Type, f *reflect.StructField) (fieldInfo *Info, err error) {
 	if f.Name != "_" && f.PkgPath != "" {
 		return // ignore unexported field unless it's underscore (_)
 	}
@@ -127,6 +210,11 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 	if fieldInfo == nil {
 		return // explicitly omitted field
 	}
+	if meta, ok := GetMeta(parent, f.Name); ok {
+		if err = fieldInfo.merge(meta); err != nil {
+			return nil, fmt.Errorf("%w in metadata registered for field %q", err, f.Name)
+		}
+	}
 
 	// if no type name was provided in the tag generate a GraphQL name from the field name
 	if fieldInfo.Name == "" {
@@ -135,10 +223,26 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 		fieldInfo.Name = string(unicode.ToLower(first)) + f.Name[n:]
 	}
 
+	if fieldInfo.Wildcard {
+		if f.Type != WildcardType {
+			return nil, fmt.Errorf("wildcard resolver %s must be of type %s", f.Name, WildcardType)
+		}
+		if fieldInfo.Args != nil || fieldInfo.Batch || fieldInfo.Subscript != "" || fieldInfo.FieldID != "" {
+			return nil, errors.New("wildcard resolver " + f.Name + " cannot have arguments or other options")
+		}
+		fieldInfo.HasContext, fieldInfo.HasError = true, true
+		fieldInfo.ResultType = f.Type.Out(0)
+		return
+	}
+
 	// Now we use the field type for info, validation and (directly or indirectly) the resolver return type
 	t := f.Type
 
 	// check for embedded struct (used to signal a GraphQL interface) and *empty* embedded struct (union)
+	// A pointer to a struct can also be embedded, eg so that objects can share the same interface values
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && f.Anonymous {
+		t = t.Elem()
+	}
 	if t.Kind() == reflect.Struct && f.Anonymous {
 		// Embedded (anon) struct
 		fieldInfo.Embedded = true
@@ -164,7 +268,14 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 			fieldInfo.HasContext = true
 			firstIndex++
 		}
-		if t.NumIn()-firstIndex != len(fieldInfo.Args) {
+		if fieldInfo.Batch {
+			if t.NumIn()-firstIndex != 1 || t.In(firstIndex).Kind() != reflect.Slice {
+				return nil, errors.New("batch resolver " + f.Name + " must take a slice (of keys) as its only parameter")
+			}
+			if len(fieldInfo.Args) > 0 {
+				return nil, errors.New("batch resolver " + f.Name + " cannot have arguments")
+			}
+		} else if t.NumIn()-firstIndex != len(fieldInfo.Args) {
 			if len(fieldInfo.Args) == 0 {
 				return nil, fmt.Errorf("no args found in %q metadata key for %q but %d required", TagKey, f.Name, t.NumIn()-firstIndex)
 			}
@@ -188,10 +299,22 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 			return nil, errors.New("resolver " + f.Name + " returns too many values")
 		}
 		t = t.Out(0) // now use return type of func as resolver type
+		if fieldInfo.Batch {
+			if t.Kind() != reflect.Slice {
+				return nil, errors.New("batch resolver " + f.Name + " must return a slice (of results)")
+			}
+			t = t.Elem() // the field's value is one element of the returned slice
+		}
 	} else {
+		if fieldInfo.Batch {
+			return nil, errors.New(`cannot use "batch" option since field ` + f.Name + " is not a function")
+		}
 		if fieldInfo.Args != nil {
 			return nil, errors.New("arguments cannot be supplied for non-function resolver " + f.Name)
 		}
+		if fieldInfo.OptionalFunc {
+			return nil, errors.New(`cannot use "optional_func" option since field ` + f.Name + " is not a function")
+		}
 	}
 
 	// If field is (or returns) a chan (used for subscriptions) we need to get the channel type
@@ -203,9 +326,13 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 		t = t.Elem()
 	}
 
+	if fieldInfo.Initial != "" && !fieldInfo.IsChan {
+		return nil, errors.New(`cannot use "initial" option since field ` + f.Name + " is not a subscription (channel)")
+	}
+
 	// TODO allow for "nullable" option on strings too?
 	// Check that "nullable" flag was only used on slice/map
-	if fieldInfo.Nullable && t.Kind() != reflect.Slice && t.Kind() != reflect.Map {
+	if fieldInfo.Nullable && t.Kind() != reflect.Slice && t.Kind() != reflect.Map && !fieldInfo.JSON {
 		return nil, errors.New("cannot use nullable option since field " + f.Name + " is not a slice, or map (try using a pointer)")
 	}
 
@@ -214,6 +341,22 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 		fieldInfo.Nullable = true // Pointer types can be null
 		t = t.Elem()              // follow indirection
 	}
+	if fieldInfo.OptionalFunc {
+		fieldInfo.Nullable = true // resolves to null if the function is nil
+	}
+	// A JSON scalar can be of any type, so its elements (if a map/slice) are not resolved as GraphQL fields
+	if fieldInfo.JSON {
+		if fieldInfo.Subscript != "" || fieldInfo.FieldID != "" || fieldInfo.BaseIndex > 0 {
+			return nil, errors.New(`cannot use "json" option with "subscript", "field_id" or "base" in field ` + f.Name)
+		}
+		if t.Kind() == reflect.Interface {
+			fieldInfo.Nullable = true // an interface{} can be nil
+		}
+		fieldInfo.ResultType = t
+		return
+	}
+	// An ordered map (see OrderedMapTypes) is used like a map with keys of type orderedKey
+	orderedKey, orderedElem, ordered := OrderedMapTypes(t)
 
 	// Validation of "subscript", "field_id", "base" etc
 	if fieldInfo.FieldID != "" && fieldInfo.Subscript != "" {
@@ -221,7 +364,7 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 	}
 
 	if fieldInfo.Subscript != "" {
-		if t.Kind() != reflect.Map && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		if t.Kind() != reflect.Map && t.Kind() != reflect.Slice && t.Kind() != reflect.Array && !ordered {
 			return nil, errors.New("cannot use subscript option since field " + f.Name + " is not a slice, array, or map")
 		}
 		// Note that "subscript" option can be used with a function but the function should have no parameters (except for
@@ -233,7 +376,7 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 	}
 
 	if fieldInfo.FieldID != "" {
-		if t.Kind() != reflect.Map && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		if t.Kind() != reflect.Map && t.Kind() != reflect.Slice && t.Kind() != reflect.Array && !ordered {
 			return nil, errors.New("cannot use field_id option since field " + f.Name + " is not a slice, array, or map")
 		}
 	}
@@ -249,8 +392,13 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 	if fieldInfo.FieldID != "" || fieldInfo.Subscript != "" {
 		// Get the "subscript" type - int (for slice/array) or scalar type for map key
 		fieldInfo.IndexType = reflect.TypeOf(1)
-		if t.Kind() == reflect.Map {
-			fieldInfo.IndexType = t.Key()
+		if t.Kind() == reflect.Map || ordered {
+			fieldInfo.MapIndex = true
+			if ordered {
+				fieldInfo.IndexType = orderedKey
+			} else {
+				fieldInfo.IndexType = t.Key()
+			}
 			if (fieldInfo.IndexType.Kind() < reflect.Int || fieldInfo.IndexType.Kind() > reflect.Float64) &&
 				fieldInfo.IndexType.Kind() != reflect.String {
 				// for now we only allow string or int types for map subscripts
@@ -263,6 +411,8 @@ func Get(f *reflect.StructField) (fieldInfo *Info, err error) {
 	if t.Kind() == reflect.Map || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
 		// a GraphQL list has the type of it's elements
 		fieldInfo.ResultType = t.Elem()
+	} else if ordered {
+		fieldInfo.ResultType = orderedElem
 	}
 
 	return
@@ -2,7 +2,9 @@ package field_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/andrewwphillips/eggql/internal/field"
 )
@@ -92,12 +94,54 @@ func TestGetTagInfo(t *testing.T) {
 		//"SubscriptEmpty": {`,subscript=`, field.Info{Subscript: "id"}},  // now an error since it could catch a typo
 		"SubscriptNamed": {`,subscript=idx`, field.Info{Subscript: "idx"}},
 		"FieldDesc":      {`# abc`, field.Info{Description: " abc"}},
+		"RateLimit":      {`,rateLimit=10/m`, field.Info{RateLimit: 10, RateLimitPeriod: time.Minute}},
+		"Timeout":        {`,timeout=200ms`, field.Info{Timeout: 200 * time.Millisecond}},
+		"Initial":        {`,initial=Current`, field.Info{Initial: "Current"}},
+		"CacheSWR":       {`,cache=swr:30s,max:5m`, field.Info{CacheStale: 30 * time.Second, CacheMaxAge: 5 * time.Minute}},
+		"CacheSWRNoMax":  {`,cache=swr:1m`, field.Info{CacheStale: time.Minute}},
+		"CacheTTL":       {`,cache=30s`, field.Info{CacheTTL: 30 * time.Second}},
+		"OptionalFunc":   {`,optional_func`, field.Info{OptionalFunc: true}},
+		"JSON":           {`,json`, field.Info{JSON: true}},
+		"InputDefault":   {`stars:Int=5`, field.Info{Name: "stars", GQLTypeName: "Int", Default: "5"}},
+		"DefaultOnly":    {`=[JEDI]`, field.Info{Default: "[JEDI]"}},
+		"Deprecated":     {`,deprecated`, field.Info{Directives: []string{"@deprecated"}}},
+		"DeprecatedWhy": {
+			`oldField,deprecated="use newField"`, field.Info{
+				Name: "oldField", Directives: []string{`@deprecated(reason: "use newField")`},
+			},
+		},
+		"Batch":    {`,batch`, field.Info{Batch: true}},
+		"Wildcard": {`,wildcard`, field.Info{Wildcard: true}},
+		"Complexity": {
+			`posts(first),complexity(2,first)`, field.Info{
+				Name: "posts", Args: []string{"first"}, ArgTypes: []string{""}, ArgDefaults: []string{""},
+				ArgDescriptions: []string{""}, Complexity: []string{"2", "first"},
+			},
+		},
+		"RateLimitHour": {`search,rateLimit=1/h`, field.Info{Name: "search", RateLimit: 1, RateLimitPeriod: time.Hour}},
+		"NamedDefault": {
+			`(a=$field_test_list)`, field.Info{
+				Args: []string{"a"}, ArgTypes: []string{""}, ArgDefaults: []string{"$field_test_list"}, ArgDescriptions: []string{""},
+			},
+		},
 		"ArgDesc": {
 			`(a#desc)`, field.Info{
 				Args: []string{"a"}, ArgTypes: []string{""}, ArgDefaults: []string{""},
 				ArgDescriptions: []string{"desc"},
 			},
 		},
+		"ArgDescEscapes": {
+			`(a="#"#say "(hi" \, #1 \) \\,b#[x)# (d")`, field.Info{
+				Args: []string{"a", "b"}, ArgTypes: []string{"", ""}, ArgDefaults: []string{`"#"`, ""},
+				ArgDescriptions: []string{`say "(hi" , #1 ) \`, "[x"}, Description: ` (d")`,
+			},
+		},
+		"ArgDeprecated": {
+			`(a{deprecated="use b, not a"}=1,b:Int{deprecated})`, field.Info{
+				Args: []string{"a", "b"}, ArgTypes: []string{"", "Int"}, ArgDefaults: []string{"1", ""},
+				ArgDescriptions: []string{"", ""}, ArgDirectives: []string{`@deprecated(reason: "use b, not a")`, "@deprecated"},
+			},
+		},
 
 		"AllOptions": {
 			`a(c:d=e#f,g=h#i i i i):b,,,subscript=h#d #d`, // Note that this is invalid at a higher level as you can't use both "args" and "subscript" options together
@@ -132,11 +176,27 @@ func TestGetTagInfo(t *testing.T) {
 			if got.ArgDescriptions != nil || data.exp.ArgDescriptions != nil {
 				Assertf(t, reflect.DeepEqual(got.ArgDescriptions, data.exp.ArgDescriptions), "Arg Desc : expected %q got %q", data.exp.ArgDescriptions, got.ArgDescriptions)
 			}
+			if data.exp.ArgDirectives != nil {
+				Assertf(t, reflect.DeepEqual(got.ArgDirectives, data.exp.ArgDirectives), "Arg Dir  : expected %q got %q", data.exp.ArgDirectives, got.ArgDirectives)
+			}
+			Assertf(t, reflect.DeepEqual(got.Directives, data.exp.Directives), "Directive: expected %q got %q", data.exp.Directives, got.Directives)
 
 			Assertf(t, got.Nullable == data.exp.Nullable, "Nullable : expected %v got %v", data.exp.Nullable, got.Nullable)
 			if got.Subscript != "" || data.exp.Subscript != "" {
 				Assertf(t, got.Subscript == data.exp.Subscript, "Subscript: expected %q got %q", data.exp.Subscript, got.Subscript)
 			}
+			Assertf(t, got.RateLimit == data.exp.RateLimit && got.RateLimitPeriod == data.exp.RateLimitPeriod,
+				"RateLimit: expected %d/%v got %d/%v", data.exp.RateLimit, data.exp.RateLimitPeriod, got.RateLimit, got.RateLimitPeriod)
+			Assertf(t, got.Initial == data.exp.Initial, "Initial  : expected %q got %q", data.exp.Initial, got.Initial)
+			Assertf(t, got.Timeout == data.exp.Timeout, "Timeout  : expected %v got %v", data.exp.Timeout, got.Timeout)
+			Assertf(t, got.CacheStale == data.exp.CacheStale && got.CacheMaxAge == data.exp.CacheMaxAge,
+				"Cache    : expected %v/%v got %v/%v", data.exp.CacheStale, data.exp.CacheMaxAge, got.CacheStale, got.CacheMaxAge)
+			Assertf(t, got.CacheTTL == data.exp.CacheTTL, "CacheTTL : expected %v got %v", data.exp.CacheTTL, got.CacheTTL)
+			Assertf(t, reflect.DeepEqual(got.SecretArgs, data.exp.SecretArgs), "Secrets  : expected %q got %q", data.exp.SecretArgs, got.SecretArgs)
+			Assertf(t, reflect.DeepEqual(got.Complexity, data.exp.Complexity), "Complexity: expected %q got %q", data.exp.Complexity, got.Complexity)
+			Assertf(t, got.Wildcard == data.exp.Wildcard, "Wildcard : expected %v got %v", data.exp.Wildcard, got.Wildcard)
+			Assertf(t, got.OptionalFunc == data.exp.OptionalFunc, "Optional : expected %v got %v", data.exp.OptionalFunc, got.OptionalFunc)
+			Assertf(t, got.JSON == data.exp.JSON, "JSON     : expected %v got %v", data.exp.JSON, got.JSON)
 			if got.Description != "" || data.exp.Description != "" {
 				Assertf(t, got.Description == data.exp.Description, "Descript: expected %q got %q", data.exp.Description, got.Description)
 			}
@@ -144,6 +204,116 @@ func TestGetTagInfo(t *testing.T) {
 	}
 }
 
+type (
+	generic[T any]     struct{ V T }
+	generic2[K, V any] struct{}
+	genericUser        struct{}
+	genericID          string
+)
+
+// TestTypeName checks the GraphQL names made for instantiated generic types (and the hook to override them)
+func TestTypeName(t *testing.T) {
+	testData := map[string]struct {
+		in  reflect.Type
+		exp string
+	}{
+		"NotGeneric": {reflect.TypeOf(genericUser{}), "genericUser"},
+		"Anon":       {reflect.TypeOf(struct{}{}), ""},
+		"Struct":     {reflect.TypeOf(generic[genericUser]{}), "GenericUsergeneric"},
+		"Scalar":     {reflect.TypeOf(generic[int64]{}), "Intgeneric"},
+		"Named":      {reflect.TypeOf(generic[genericID]{}), "GenericIDgeneric"},
+		"Pointer":    {reflect.TypeOf(generic[*genericUser]{}), "GenericUsergeneric"},
+		"Slice":      {reflect.TypeOf(generic[[]genericUser]{}), "GenericUserListgeneric"},
+		"Map":        {reflect.TypeOf(generic[map[string][]int]{}), "StringIntListMapgeneric"},
+		"Two":        {reflect.TypeOf(generic2[string, bool]{}), "StringBooleangeneric2"},
+		"Nested":     {reflect.TypeOf(generic[generic2[int, genericUser]]{}), "IntGenericUsergeneric2generic"},
+		"Time":       {reflect.TypeOf(generic[time.Time]{}), "Timegeneric"},
+	}
+	for name, data := range testData {
+		got := field.TypeName(data.in)
+		Assertf(t, got == data.exp, "%-10s: expected %q got %q", name, data.exp, got)
+	}
+
+	defer field.SetGenericTypeName(nil)
+	field.SetGenericTypeName(func(name string, typeArgs []string) string {
+		if name == "generic2" {
+			return "" // use the default
+		}
+		return strings.ToUpper(name[:1]) + name[1:] + "Of" + strings.Join(typeArgs, "And")
+	})
+	got := field.TypeName(reflect.TypeOf(generic[generic2[int, genericUser]]{}))
+	Assertf(t, got == "GenericOfIntGenericUsergeneric2", "Hook      : expected %q got %q", "GenericOfIntGenericUsergeneric2", got)
+}
+
+// TestDescribe checks that registered metadata is merged with the tag info and that invalid registrations fail
+func TestDescribe(t *testing.T) {
+	type described struct {
+		F func(int) int `egg:"(a),@deprecated#tag desc"`
+	}
+	typ := reflect.TypeOf(described{})
+	err := field.Describe(typ, map[string]field.Meta{"F": {
+		Description: "meta desc", Directives: []string{"@x"}, Args: []string{"b:Int=2#the b"},
+	}})
+	Assertf(t, err == nil, "Describe : expected no error got %v", err)
+
+	tf := typ.Field(0)
+	got, err := field.Get(typ, &tf)
+	Assertf(t, err == nil, "Get      : expected no error got %v", err)
+	Assertf(t, got.Description == "meta desc", "Descript: expected %q got %q", "meta desc", got.Description)
+	Assertf(t, reflect.DeepEqual(got.Directives, []string{"@deprecated", "@x"}), "Directives: got %q", got.Directives)
+	Assertf(t, reflect.DeepEqual(got.Args, []string{"b"}) && got.ArgTypes[0] == "Int" && got.ArgDefaults[0] == "2" &&
+		got.ArgDescriptions[0] == "the b", "Args     : got %q %q %q %q", got.Args, got.ArgTypes, got.ArgDefaults, got.ArgDescriptions)
+
+	err = field.Describe(typ, map[string]field.Meta{"G": {Description: "no such field"}})
+	Assertf(t, err != nil && strings.Contains(err.Error(), "not a field"), "Error    : expected not a field got %v", err)
+	err = field.Describe(reflect.TypeOf(42), nil)
+	Assertf(t, err != nil && strings.Contains(err.Error(), "not a struct"), "Error    : expected not a struct got %v", err)
+}
+
+type (
+	lintOK struct {
+		A int
+		B func(int) string `egg:"(x)"`
+	}
+	lintChild struct {
+		Bad   int    `egg:",no_such_option"`
+		Count func() `egg:"(a)"`
+	}
+	lintRoot struct {
+		Good  lintOK
+		Child *lintChild
+		List  []lintChild   // each struct type is only checked once
+		Name  string        `egg:"name"`
+		Other string        `egg:"name"`
+		Weird func(int) int `egg:"1st(__x)"`
+		Omit  int           `egg:"-"`
+	}
+)
+
+// TestLint checks that Lint finds all problems in a tree of structs
+func TestLint(t *testing.T) {
+	Assertf(t, field.Lint(reflect.TypeOf(lintOK{})) == nil, "Lint OK : expected no diagnostics")
+
+	got := field.Lint(reflect.TypeOf(&lintRoot{}))
+	want := []struct {
+		kind       field.DiagnosticKind
+		typ, field string
+		contains   string
+	}{
+		{field.BadTag, "field_test.lintChild", "Bad", "no_such_option"},
+		{field.TypeMismatch, "field_test.lintChild", "Count", ""},
+		{field.SuspiciousName, "field_test.lintRoot", "Other", `"name" is also used by field Name`},
+		{field.SuspiciousName, "field_test.lintRoot", "Weird", `"1st" is not a valid`},
+		{field.SuspiciousName, "field_test.lintRoot", "Weird", `"__x" is not a valid`},
+	}
+	Assertf(t, len(got) == len(want), "Count   : expected %d diagnostics got %d: %v", len(want), len(got), got)
+	for i := 0; i < len(got) && i < len(want); i++ {
+		Assertf(t, got[i].Kind == want[i].kind && got[i].Type == want[i].typ && got[i].Field == want[i].field &&
+			strings.Contains(got[i].Message, want[i].contains), "Diag %d  : expected %v %s.%s %q got %v",
+			i, want[i].kind, want[i].typ, want[i].field, want[i].contains, got[i])
+	}
+}
+
 func Assertf(t *testing.T, succeeded bool, format string, args ...interface{}) {
 	const (
 		succeed = "\u2713" // tick
@@ -0,0 +1,135 @@
+package field
+
+// lint.go checks the egg: tags of all the structs used to build a schema, reporting every problem found (rather
+// than stopping at the first) so that tag mistakes can be caught by tests or vet-style tools run in CI
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+type (
+	// DiagnosticKind categorises a problem found by Lint
+	DiagnosticKind int
+
+	// Diagnostic describes a problem found with the egg: tag of a field of a struct
+	Diagnostic struct {
+		Kind    DiagnosticKind
+		Type    string // Go type of the struct, eg "main.Query"
+		Field   string // Go name of the field
+		Tag     string // the field's egg: tag (may be empty)
+		Message string
+	}
+)
+
+const (
+	BadTag         DiagnosticKind = iota // tag can't be parsed, eg an unknown option or malformed resolver args
+	TypeMismatch                         // tag does not match the field's type, eg arg count != func params
+	SuspiciousName                       // name is not a valid GraphQL name or is used by another field
+)
+
+func (k DiagnosticKind) String() string {
+	switch k {
+	case BadTag:
+		return "bad tag"
+	case TypeMismatch:
+		return "type mismatch"
+	case SuspiciousName:
+		return "suspicious name"
+	}
+	return fmt.Sprintf("DiagnosticKind(%d)", int(k))
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s.%s: %s: %s", d.Type, d.Field, d.Kind, d.Message)
+}
+
+var lintNameRegex = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+// Lint checks the fields of the struct types (eg the query, mutation and subscription types) and of all struct
+// types reachable from them - through field types, including the parameter and return types of resolver funcs.
+// It returns a diagnostic for every problem found, or nil if all tags are OK.
+func Lint(types ...reflect.Type) (r []Diagnostic) {
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		if t == nil || seen[t] {
+			return
+		}
+		seen[t] = true
+		if reflect.PtrTo(t).Implements(UnmarshalerType) {
+			return // custom scalar
+		}
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+			walk(t.Elem())
+		case reflect.Func:
+			for i := 0; i < t.NumIn(); i++ {
+				walk(t.In(i)) // input (struct) types
+			}
+			for i := 0; i < t.NumOut(); i++ {
+				walk(t.Out(i))
+			}
+		case reflect.Struct:
+			if IsOrderedMap(t) {
+				walk(ElemType(t))
+				return
+			}
+			r = append(r, lintStruct(t, walk)...)
+		}
+	}
+	for _, t := range types {
+		walk(t)
+	}
+	return r
+}
+
+// lintStruct checks the fields of one struct, calling walk for the type of each field
+func lintStruct(t reflect.Type, walk func(reflect.Type)) (r []Diagnostic) {
+	names := make(map[string]string) // Go field name for each GraphQL field name used in the struct
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Name != "_" && f.PkgPath != "" {
+			continue // unexported
+		}
+		tag := f.Tag.Get(TagKey)
+		if tag == "" {
+			tag = f.Tag.Get("graphql") // see Get
+		}
+		d := Diagnostic{Type: t.String(), Field: f.Name, Tag: tag}
+		if _, err := GetInfoFromTag(tag); err != nil {
+			d.Kind, d.Message = BadTag, err.Error()
+			r = append(r, d)
+			continue
+		}
+		fieldInfo, err := Get(t, &f)
+		if err != nil {
+			d.Kind, d.Message = TypeMismatch, err.Error()
+			r = append(r, d)
+			continue
+		}
+		if fieldInfo == nil {
+			continue // field omitted (tag is "-")
+		}
+		walk(f.Type)
+		if f.Name == "_" || fieldInfo.Embedded {
+			continue // no GraphQL field
+		}
+
+		d.Kind = SuspiciousName
+		for _, name := range append([]string{fieldInfo.Name}, fieldInfo.Args...) {
+			if !lintNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+				d.Message = fmt.Sprintf("%q is not a valid GraphQL name", name)
+				r = append(r, d)
+			}
+		}
+		if other, ok := names[fieldInfo.Name]; ok {
+			d.Message = fmt.Sprintf("GraphQL name %q is also used by field %s", fieldInfo.Name, other)
+			r = append(r, d)
+		}
+		names[fieldInfo.Name] = f.Name
+	}
+	return r
+}
@@ -0,0 +1,81 @@
+package field
+
+// meta.go stores metadata for struct fields that is registered in code (see Describe) rather than in egg: tags
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Meta is metadata for a field of a struct (or for the struct itself) that is merged with the field's tag info
+type Meta struct {
+	Description string   // replaces the description in the tag (if any)
+	Directives  []string // added to the directives in the tag (eg "@deprecated")
+	Args        []string // if not nil, replaces the resolver args of the tag - same format, eg "episode:Episode=JEDI#desc"
+}
+
+var (
+	metaMtx sync.RWMutex
+	metas   map[reflect.Type]map[string]Meta // metadata registered for struct types (inner map key is Go field name)
+)
+
+// Describe registers metadata for the fields of a struct type, where the map keys are the (Go) field names.
+// Metadata for the struct itself (currently just the description) uses the blank identifier (_) as the key.
+// An error is returned if t is not a struct (or pointer to struct) or a map key is not the name of a field.
+func Describe(t reflect.Type, m map[string]Meta) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot describe %v as it is not a struct", t)
+	}
+	for name := range m {
+		if _, ok := t.FieldByName(name); !ok && name != "_" {
+			return fmt.Errorf("cannot describe %q as it is not a field of %v", name, t)
+		}
+	}
+
+	metaMtx.Lock()
+	defer metaMtx.Unlock()
+	if metas == nil {
+		metas = make(map[reflect.Type]map[string]Meta)
+	}
+	if metas[t] == nil {
+		metas[t] = make(map[string]Meta, len(m))
+	}
+	for name, meta := range m {
+		metas[t][name] = meta
+	}
+	return nil
+}
+
+// GetMeta returns the metadata (if any) registered for a field of a struct type, or the struct itself if name is "_"
+func GetMeta(t reflect.Type, name string) (Meta, bool) {
+	metaMtx.RLock()
+	defer metaMtx.RUnlock()
+	meta, ok := metas[t][name]
+	return meta, ok
+}
+
+// merge adds registered metadata to the info obtained from the field's tag
+func (r *Info) merge(meta Meta) error {
+	if meta.Description != "" {
+		r.Description = meta.Description
+	}
+	r.Directives = append(r.Directives, meta.Directives...)
+	if meta.Args != nil {
+		if err := r.setArgs(meta.Args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitDescription splits a description into the summary (the first line) and the details (the rest, if any),
+// following the convention that a long description is a one-line summary, then a newline and the details
+func SplitDescription(desc string) (summary, details string) {
+	summary, details, _ = strings.Cut(desc, "\n")
+	return strings.TrimSpace(summary), strings.TrimSpace(details)
+}
@@ -0,0 +1,77 @@
+package field
+
+// ordered.go recognizes ordered maps (see eggql.OrderedMap) which can be used like a Go map as the type of a list
+// field (including the "subscript" and "field_id" options which use the map keys) but keep their elements in order
+
+import (
+	"reflect"
+	"sync"
+)
+
+// orderedMapInfo is the key and element types of an ordered map (both nil if the type is not an ordered map)
+type orderedMapInfo struct {
+	key, elem reflect.Type
+}
+
+var orderedMaps sync.Map // map[reflect.Type]orderedMapInfo
+
+// OrderedMapTypes returns the key and element types if t is an ordered map.  An ordered map is a struct with these
+// methods (with value receivers) where K is the key type and V is the element type:
+//
+//	Len() int
+//	At(int) (K, V)
+//	Get(K) (V, bool)
+func OrderedMapTypes(t reflect.Type) (key, elem reflect.Type, ok bool) {
+	if t.Kind() != reflect.Struct || t.NumMethod() < 3 {
+		return nil, nil, false
+	}
+	if info, found := orderedMaps.Load(t); found {
+		info := info.(orderedMapInfo)
+		return info.key, info.elem, info.key != nil
+	}
+
+	var info orderedMapInfo
+	// Note that the method types include the receiver as the first parameter
+	lenMethod, ok1 := t.MethodByName("Len")
+	at, ok2 := t.MethodByName("At")
+	get, ok3 := t.MethodByName("Get")
+	if ok1 && ok2 && ok3 &&
+		lenMethod.Type.NumIn() == 1 && lenMethod.Type.NumOut() == 1 && lenMethod.Type.Out(0).Kind() == reflect.Int &&
+		at.Type.NumIn() == 2 && at.Type.In(1).Kind() == reflect.Int && at.Type.NumOut() == 2 &&
+		get.Type.NumIn() == 2 && get.Type.In(1) == at.Type.Out(0) &&
+		get.Type.NumOut() == 2 && get.Type.Out(0) == at.Type.Out(1) && get.Type.Out(1).Kind() == reflect.Bool {
+		info = orderedMapInfo{key: at.Type.Out(0), elem: at.Type.Out(1)}
+	}
+	orderedMaps.Store(t, info)
+	return info.key, info.elem, info.key != nil
+}
+
+// IsOrderedMap returns true if t is an ordered map - see OrderedMapTypes
+func IsOrderedMap(t reflect.Type) bool {
+	_, _, ok := OrderedMapTypes(t)
+	return ok
+}
+
+// OrderedMapAt returns the key and value of the i-th element of ordered map v
+func OrderedMapAt(v reflect.Value, i int) (key, value reflect.Value) {
+	r := v.MethodByName("At").Call([]reflect.Value{reflect.ValueOf(i)})
+	return r[0], r[1]
+}
+
+// OrderedMapGet returns the value of ordered map v with a key, or an invalid value if the key is not found
+func OrderedMapGet(v reflect.Value, key reflect.Value) reflect.Value {
+	r := v.MethodByName("Get").Call([]reflect.Value{key})
+	if !r[1].Bool() {
+		return reflect.Value{}
+	}
+	return r[0]
+}
+
+// ElemType returns the element type of a container (slice, array, map, ordered map, etc) - like t.Elem() but also
+// handles ordered maps
+func ElemType(t reflect.Type) reflect.Type {
+	if _, elem, ok := OrderedMapTypes(t); ok {
+		return elem
+	}
+	return t.Elem()
+}
@@ -10,19 +10,63 @@ import (
 // SplitArgs splits a string on commas and returns the resulting slice of strings.
 // It ignores commas within strings, round brackets, square brackets or braces, which
 // allows for "nested" structures. For example "a,b(c,d),e"  => []string{ "a", "b(c,d)", "e" }
+// It also allows for a description (after #) at the end of each string, eg "a#desc,b#desc" (see scan).
 // An error is returned if there is a problem with the input string such as unmatched brackets.
 func SplitArgs(s string) ([]string, error) {
-	// First count the number of commas that aren't within brackets
-	var count, round, square, brace int
-	var inString bool
+	commas, _, err := scan(s, false)
+	if err != nil {
+		return nil, err
+	}
+	return split(s, commas), nil
+}
 
-	for _, c := range s {
+// SplitWithDesc is like SplitArgs but also allows a trailing "description" (anything after the first #).
+// On success, it returns a list of strings, the description (if any) and a nil error.
+// A non-nil error is returned if there is a problem with the input string such as unmatched brackets.
+func SplitWithDesc(s string) ([]string, string, error) {
+	commas, hash, err := scan(s, true)
+	if err != nil {
+		return nil, "", err
+	}
+	desc := ""
+	if hash > -1 {
+		desc = s[hash+1:]
+		s = s[:hash]
+	}
+	return split(s, commas), desc, nil
+}
+
+// scan finds the positions of the "top-level" commas of a string, ie not within strings, brackets (round or square)
+// or braces.  If withDesc is true it stops at the first top-level hash (#), returning its position (else -1), as the
+// rest of the string is a description.  A hash within round brackets (or at the top-level if withDesc is false)
+// starts the description of a resolver argument, which ends at the next comma or closing bracket, so that it may
+// contain brackets, quotes, etc.  A comma, closing bracket or backslash in an argument description must be escaped
+// by a preceding backslash (see ArgDescription).
+func scan(s string, withDesc bool) (commas []int, hash int, err error) {
+	var round, square, brace int
+	var inString, inArgDesc, escaped bool
+	hash = -1
+loop:
+	for i, c := range s {
 		if inString {
 			if c == '"' {
 				inString = false
 			}
 			continue
 		}
+		if inArgDesc {
+			switch {
+			case escaped:
+				escaped = false
+				continue
+			case c == '\\':
+				escaped = true
+				continue
+			case c != ',' && c != ')':
+				continue
+			}
+			inArgDesc = false // comma or bracket ends the description
+		}
 		switch c {
 		case '"':
 			inString = true
@@ -35,100 +79,69 @@ func SplitArgs(s string) ([]string, error) {
 		case ')':
 			round--
 			if round < 0 {
-				return nil, fmt.Errorf("unmatched right bracket ')` in %q", s)
+				return nil, -1, fmt.Errorf("unmatched right bracket ')` in %q", s)
 			}
 		case ']':
 			square--
 			if square < 0 {
-				return nil, fmt.Errorf("unmatched right square bracket ']' in %q", s)
+				return nil, -1, fmt.Errorf("unmatched right square bracket ']' in %q", s)
 			}
 		case '}':
 			brace--
 			if brace < 0 {
-				return nil, fmt.Errorf("unmatched right brace '}' in %q", s)
+				return nil, -1, fmt.Errorf("unmatched right brace '}' in %q", s)
 			}
 		case ',':
 			if round == 0 && square == 0 && brace == 0 { // only count "top-level" commas
-				count++
+				commas = append(commas, i)
+			}
+		case '#':
+			if square > 0 || brace > 0 {
+				break // ignore # in a default value (list or object)
 			}
+			if withDesc && round == 0 {
+				hash = i
+				break loop
+			}
+			inArgDesc = true
 		}
 	}
 	if inString {
-		return nil, fmt.Errorf("unmatched quote (unterminated string) in %q", s)
+		return nil, -1, fmt.Errorf("unmatched quote (unterminated string) in %q", s)
 	}
 	if round > 0 {
-		return nil, fmt.Errorf("unmatched left bracket '(' in %q", s)
+		return nil, -1, fmt.Errorf("unmatched left bracket '(' in %q", s)
 	}
 	if square > 0 {
-		return nil, fmt.Errorf("unmatched left square bracket '[' in %q", s)
+		return nil, -1, fmt.Errorf("unmatched left square bracket '[' in %q", s)
 	}
 	if brace > 0 {
-		return nil, fmt.Errorf("unmatched left brace '{' in %q", s)
+		return nil, -1, fmt.Errorf("unmatched left brace '{' in %q", s)
 	}
+	return commas, hash, nil
+}
 
-	retval := make([]string, 0, count+1)
-
-	for sepNum := 0; sepNum < count; sepNum++ {
-		// Find the next comma (that's outside brackets)
-		end := -1
-	findComma:
-		for i, c := range s {
-			if inString {
-				if c == '"' {
-					inString = false
-				}
-				continue
-			}
-			switch c {
-			case '"':
-				inString = true
-			case '(':
-				round++
-			case '[':
-				square++
-			case '{':
-				brace++
-			case ')':
-				round--
-			case ']':
-				square--
-			case '}':
-				brace--
-			case ',':
-				if round == 0 && square == 0 && brace == 0 {
-					end = i
-					break findComma
-				}
-			}
-		}
-		if end == -1 {
-			return nil, fmt.Errorf("comma not found in %q", s)
-		}
-		retval = append(retval, strings.Trim(s[:end], " "))
-		s = s[end+1:]
+// split splits a string at the commas (positions found by scan) and trims spaces from the resulting strings
+func split(s string, commas []int) []string {
+	retval := make([]string, 0, len(commas)+1)
+	start := 0
+	for _, end := range commas {
+		retval = append(retval, strings.Trim(s[start:end], " "))
+		start = end + 1
 	}
 	// Add last (or only) segment
-	retval = append(retval, strings.Trim(s, " "))
-
-	return retval, nil
+	return append(retval, strings.Trim(s[start:], " "))
 }
 
-// TODO somehow reduce duplicate code in SplitArgs/SplitWithDesc
-
-// SplitWithDesc is like SplitArgs but also allows a trailing "description" (anything after the first #).
-// On success, it returns a list of strings, the description (if any) and a nil error.
-// A non-nil error is returned if there is a problem with the input string such as unmatched brackets.
-func SplitWithDesc(s string) ([]string, string, error) {
-	// First count the number of commas that aren't within brackets
-	var count, round, square, brace int
+// ArgDescription splits a resolver argument (from the tag) into the argument (name, type, etc) and its description
+// which follows the first hash (#) that is not within a string or brackets.  Any backslash escapes (eg \, for a
+// comma) in the description are removed.
+func ArgDescription(s string) (arg, desc string) {
+	var round, square, brace int
 	var inString bool
-	hash := -1
-loop:
 	for i, c := range s {
 		if inString {
-			if c == '"' {
-				inString = false
-			}
+			inString = c != '"'
 			continue
 		}
 		switch c {
@@ -142,92 +155,33 @@ loop:
 			brace++
 		case ')':
 			round--
-			if round < 0 {
-				return nil, "", fmt.Errorf("unmatched right bracket ')` in %q", s)
-			}
 		case ']':
 			square--
-			if square < 0 {
-				return nil, "", fmt.Errorf("unmatched right square bracket ']' in %q", s)
-			}
 		case '}':
 			brace--
-			if brace < 0 {
-				return nil, "", fmt.Errorf("unmatched right brace '}' in %q", s)
-			}
-		case ',':
-			if round == 0 && square == 0 && brace == 0 { // only count "top-level" commas
-				count++
-			}
 		case '#':
-			if hash == -1 && round == 0 && square == 0 && brace == 0 { // ignore # in brackets
-				hash = i
-				break loop
+			if round == 0 && square == 0 && brace == 0 {
+				return s[:i], unescape(s[i+1:])
 			}
 		}
 	}
-	if inString {
-		return nil, "", fmt.Errorf("unmatched quote (unterminated string) in %q", s)
-	}
-	if round > 0 {
-		return nil, "", fmt.Errorf("unmatched left bracket '(' in %q", s)
-	}
-	if square > 0 {
-		return nil, "", fmt.Errorf("unmatched left square bracket '[' in %q", s)
-	}
-	if brace > 0 {
-		return nil, "", fmt.Errorf("unmatched left brace '{' in %q", s)
-	}
+	return s, ""
+}
 
-	desc := ""
-	if hash > -1 {
-		desc = s[hash+1:]
-		s = s[:hash]
+// unescape removes the backslash from each backslash escape, eg a\,b becomes a,b
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
 	}
-
-	retval := make([]string, 0, count+1)
-
-	for sepNum := 0; sepNum < count; sepNum++ {
-		// Find the next comma (that's outside brackets)
-		end := -1
-	findComma:
-		for i, c := range s {
-			if inString {
-				if c == '"' {
-					inString = false
-				}
-				continue
-			}
-			switch c {
-			case '"':
-				inString = true
-			case '(':
-				round++
-			case '[':
-				square++
-			case '{':
-				brace++
-			case ')':
-				round--
-			case ']':
-				square--
-			case '}':
-				brace--
-			case ',':
-				if round == 0 && square == 0 && brace == 0 {
-					end = i
-					break findComma
-				}
-			}
-		}
-		if end == -1 {
-			return nil, "", fmt.Errorf("comma not found in %q", s)
+	builder := &strings.Builder{}
+	escaped := false
+	for _, c := range s {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
 		}
-		retval = append(retval, strings.Trim(s[:end], " "))
-		s = s[end+1:]
+		escaped = false
+		builder.WriteRune(c)
 	}
-	// Add last (or only) segment
-	retval = append(retval, strings.Trim(s, " "))
-
-	return retval, desc, nil
+	return builder.String()
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -41,6 +42,14 @@ func GetInfoFromTag(tag string) (*Info, error) {
 		if part == "" {
 			continue // ignore empty sections
 		}
+		if part == "deprecated" || strings.HasPrefix(part, "deprecated=") {
+			directive, err := getDeprecated(strings.TrimPrefix(part, "deprecated"))
+			if err != nil {
+				return nil, fmt.Errorf("%w in %q", err, tag)
+			}
+			fieldInfo.Directives = append(fieldInfo.Directives, directive)
+			continue
+		}
 		if part[0] == '@' {
 			// anything starting with @ is assumed to be a directive & stored without validation TODO: validate that brackets match?
 			fieldInfo.Directives = append(fieldInfo.Directives, part)
@@ -70,6 +79,68 @@ func GetInfoFromTag(tag string) (*Info, error) {
 			fieldInfo.NoCache = true
 			continue
 		}
+		if part == "batch" {
+			fieldInfo.Batch = true
+			continue
+		}
+		if part == "wildcard" {
+			fieldInfo.Wildcard = true
+			continue
+		}
+		if part == "optional_func" {
+			fieldInfo.OptionalFunc = true
+			continue
+		}
+		if part == "json" {
+			fieldInfo.JSON = true
+			continue
+		}
+		if strings.HasPrefix(part, "rateLimit=") {
+			if fieldInfo.RateLimit, fieldInfo.RateLimitPeriod, err = getRateLimit(part); err != nil {
+				return nil, fmt.Errorf("%w in %q", err, tag)
+			}
+			continue
+		}
+		if strings.HasPrefix(part, "initial=") {
+			fieldInfo.Initial = strings.TrimPrefix(part, "initial=")
+			continue
+		}
+		if strings.HasPrefix(part, "timeout=") {
+			if fieldInfo.Timeout, err = time.ParseDuration(strings.TrimPrefix(part, "timeout=")); err != nil || fieldInfo.Timeout <= 0 {
+				return nil, fmt.Errorf("timeout option %q must be a positive duration (eg 200ms) in %q", part, tag)
+			}
+			continue
+		}
+		if strings.HasPrefix(part, "cache=") && !strings.HasPrefix(part, "cache=swr:") {
+			fieldInfo.CacheTTL, err = time.ParseDuration(strings.TrimPrefix(part, "cache="))
+			if err != nil || fieldInfo.CacheTTL <= 0 {
+				return nil, fmt.Errorf("cache option %q must be like cache=30s or cache=swr:30s,max:5m in %q", part, tag)
+			}
+			continue
+		}
+		if strings.HasPrefix(part, "cache=") {
+			if fieldInfo.CacheStale, err = getCacheDuration(part, "cache=swr:"); err != nil {
+				return nil, fmt.Errorf("%w in %q", err, tag)
+			}
+			continue
+		}
+		if strings.HasPrefix(part, "max:") && fieldInfo.CacheStale > 0 && fieldInfo.CacheMaxAge == 0 {
+			// max age of a stale-while-revalidate cache (must follow the cache option)
+			if fieldInfo.CacheMaxAge, err = getCacheDuration(part, "max:"); err != nil {
+				return nil, fmt.Errorf("%w in %q", err, tag)
+			}
+			if fieldInfo.CacheMaxAge <= fieldInfo.CacheStale {
+				return nil, fmt.Errorf("cache max age %v must be greater than the stale time %v in %q",
+					fieldInfo.CacheMaxAge, fieldInfo.CacheStale, tag)
+			}
+			continue
+		}
+		if strings.HasPrefix(part, "complexity") {
+			if fieldInfo.Complexity, err = getComplexity(part); err != nil {
+				return nil, fmt.Errorf("%w in %q", err, tag)
+			}
+			continue
+		}
 		if strings.HasPrefix(part, "args") {
 			return nil, errors.New(`args option is no longer supported - add arguments (in brackets) after resolver name`)
 		}
@@ -81,6 +152,22 @@ func GetInfoFromTag(tag string) (*Info, error) {
 		return nil, fmt.Errorf(`you can't use "base" option without "subscript" or "field_id" (%s)`, tag)
 	}
 
+	var deprecated int
+	for _, directive := range fieldInfo.Directives {
+		if directive == "@deprecated" || strings.HasPrefix(directive, "@deprecated(") {
+			deprecated++
+		}
+	}
+	if deprecated > 1 {
+		return nil, fmt.Errorf("field deprecated more than once in %q", tag)
+	}
+
+	for _, factor := range fieldInfo.Complexity {
+		if _, err := strconv.Atoi(factor); err != nil && !isArg(fieldInfo, factor) {
+			return nil, fmt.Errorf("complexity factor %q is not an integer or argument name in %q", factor, tag)
+		}
+	}
+
 	fieldInfo.Description = description
 
 	return fieldInfo, nil
@@ -90,10 +177,19 @@ func GetInfoFromTag(tag string) (*Info, error) {
 //
 //	also include a type after a colon (:) and resolvers arguments (comma-separated and within brackets), where
 //	each argument can have a name, type (after :) and default value (after =).  Note that many of these things
-//	can be deduced (from the GO field name/type) and left out (except for the names of arguments).
+//	can be deduced (from the GO field name/type) and left out (except for the names of arguments).  A field of an
+//	input type can have a default value after an equals sign (=), eg "stars:Int=5".
 func getMain(s string) (r *Info, err error) {
 	r = &Info{}
 
+	// A default value (of an input field) follows the name and type, so is before any resolver arguments
+	if i := strings.IndexAny(s, "=("); i > -1 && s[i] == '=' {
+		if r.Default = strings.TrimSpace(s[i+1:]); r.Default == "" {
+			return nil, fmt.Errorf("missing default value")
+		}
+		s = s[:i]
+	}
+
 	// First check if there is a resolver name (if not it is later derived from the field name)
 	if s == "" || s[0] != ':' && s[0] != '(' {
 		i := strings.IndexAny(s, ":(")
@@ -127,35 +223,99 @@ loop:
 	if err != nil {
 		return nil, fmt.Errorf("%w getting resolver args", err)
 	} else if list != nil {
-		// use empty strings for default values for arg lists
-		r.Args = make([]string, len(list))
-		r.ArgTypes = make([]string, len(list))
-		r.ArgDefaults = make([]string, len(list))
-		r.ArgDescriptions = make([]string, len(list))
-		for paramIndex, s := range list {
-			// Strip description after hash (#)
-			subParts := strings.SplitN(s, "#", 2)
-			s = subParts[0]
-			if len(subParts) > 1 {
-				r.ArgDescriptions[paramIndex] = subParts[1]
-			}
-			// Strip of default value (if any) after equals sign (=)
-			subParts = strings.Split(s, "=")
-			s = subParts[0]
-			if len(subParts) > 1 {
-				r.ArgDefaults[paramIndex] = strings.Trim(subParts[1], " ")
+		if err = r.setArgs(list); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// secretArg follows the name (and type) of a resolver argument whose values must not be disclosed (see SecretArgs)
+const secretArg = "{secret}"
+
+// deprecatedArg starts the option (eg "{deprecated}" or "{deprecated=\"reason\"}") for a deprecated resolver argument
+const deprecatedArg = "{deprecated"
+
+// setArgs sets the resolver arguments from a list of strings (one per argument) in the format used in the tag,
+// where each argument has a name, optional type (after :), default value (after =) and description (after #)
+func (r *Info) setArgs(list []string) (err error) {
+	// use empty strings for default values for arg lists
+	r.Args = make([]string, len(list))
+	r.ArgTypes = make([]string, len(list))
+	r.ArgDefaults = make([]string, len(list))
+	r.ArgDescriptions = make([]string, len(list))
+	r.ArgDirectives = make([]string, len(list))
+	r.SecretArgs = nil
+	for paramIndex, s := range list {
+		// Strip description after hash (#)
+		s, r.ArgDescriptions[paramIndex] = ArgDescription(s)
+		// Strip of deprecated option (eg "old{deprecated=\"use new\"}") - before the default as the reason may contain =
+		if start := strings.Index(s, deprecatedArg); start > -1 {
+			end := closingBrace(s, start)
+			if end == -1 {
+				return fmt.Errorf("unterminated deprecated option for argument %q", strings.Trim(s[:start], " "))
 			}
-			// Strip of enum name after colon (:)
-			subParts = strings.Split(s, ":")
-			s = subParts[0]
-			if len(subParts) > 1 {
-				r.ArgTypes[paramIndex] = strings.Trim(subParts[1], " ")
+			if r.ArgDirectives[paramIndex], err = getDeprecated(s[start+len(deprecatedArg) : end]); err != nil {
+				return fmt.Errorf("%w for argument %q", err, strings.Trim(s[:start], " "))
 			}
+			s = s[:start] + s[end+1:]
+		}
+		// Strip of default value (if any) after equals sign (=)
+		subParts := strings.Split(s, "=")
+		s = subParts[0]
+		if len(subParts) > 1 {
+			r.ArgDefaults[paramIndex] = strings.Trim(subParts[1], " ")
+		}
+		// Strip of secret option (eg "password:String!{secret}")
+		if trimmed := strings.TrimRight(s, " "); strings.HasSuffix(trimmed, secretArg) {
+			s = strings.TrimSuffix(trimmed, secretArg)
+			r.SecretArgs = append(r.SecretArgs, strings.Trim(strings.Split(s, ":")[0], " "))
+		}
+		// Strip of enum name after colon (:)
+		subParts = strings.Split(s, ":")
+		s = subParts[0]
+		if len(subParts) > 1 {
+			r.ArgTypes[paramIndex] = strings.Trim(subParts[1], " ")
+		}
+
+		r.Args[paramIndex] = strings.Trim(s, " ")
+	}
+	return nil
+}
 
-			r.Args[paramIndex] = strings.Trim(s, " ")
+// closingBrace returns the index of the right brace that closes the option starting at start, ignoring braces
+// within quoted strings, or -1 if not found
+func closingBrace(s string, start int) int {
+	var inString, escaped bool
+	for i := start; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			inString = !inString
+		case !inString && s[i] == '}':
+			return i
 		}
 	}
-	return
+	return -1
+}
+
+// getDeprecated returns the @deprecated directive for the deprecated option, where s is empty (no reason) or an
+// equals sign followed by the reason as a quoted string, eg ="use newField"
+func getDeprecated(s string) (string, error) {
+	if s == "" {
+		return "@deprecated", nil
+	}
+	reason := strings.Trim(strings.TrimPrefix(s, "="), " ")
+	if !strings.HasPrefix(s, "=") || len(reason) < 2 || reason[0] != '"' {
+		return "", fmt.Errorf("deprecated reason %q must be a quoted string", reason)
+	}
+	if _, err := strconv.Unquote(reason); err != nil {
+		return "", fmt.Errorf("deprecated reason %s is not a valid string", reason)
+	}
+	return "@deprecated(reason: " + reason + ")", nil
 }
 
 // getSubscript checks for the subscript option string and if found returns the value (after
@@ -201,6 +361,76 @@ func getBaseIndex(s string) int {
 	return 0
 }
 
+// rateLimitPeriods maps the unit after the slash in a "rateLimit" option to the length of the period
+var rateLimitPeriods = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// getRateLimit gets the limit and the period from the "rateLimit" option, eg "rateLimit=10/m" means that the
+// field can be resolved at most 10 times per minute (for each client).  The period is one of s, m, h or d.
+func getRateLimit(s string) (int, time.Duration, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "rateLimit="), "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("rateLimit option %q must have a count and period (eg 10/m)", s)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("rateLimit option %q must have a positive count", s)
+	}
+	period, ok := rateLimitPeriods[strings.TrimSpace(parts[1])]
+	if !ok {
+		return 0, 0, fmt.Errorf("rateLimit option %q period must be s, m, h or d", s)
+	}
+	return limit, period, nil
+}
+
+// getCacheDuration gets the duration from an option of a stale-while-revalidate cache, eg "cache=swr:30s,max:5m"
+// where prefix is the part before the duration (eg "cache=swr:")
+func getCacheDuration(s, prefix string) (time.Duration, error) {
+	if !strings.HasPrefix(s, prefix) {
+		return 0, fmt.Errorf("cache option %q must be like cache=swr:30s,max:5m", s)
+	}
+	d, err := time.ParseDuration(strings.TrimPrefix(s, prefix))
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("cache option %q must have a positive duration (eg 30s)", s)
+	}
+	return d, nil
+}
+
+// getComplexity gets the factors from the "complexity" option (eg "complexity(10,first)"), which are non-negative
+// integers or argument names, and are multiplied to estimate the number of results (see handler.MaxComplexity)
+func getComplexity(s string) ([]string, error) {
+	if !AllowComplexity {
+		return nil, fmt.Errorf("unknown option %q", s)
+	}
+	list, err := getBracketedList(s, "complexity")
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("complexity option %q must have at least one factor (eg complexity(10))", s)
+	}
+	for _, factor := range list {
+		if n, err := strconv.Atoi(factor); err == nil && n < 0 {
+			return nil, fmt.Errorf("complexity factor %q must not be negative", factor)
+		}
+	}
+	return list, nil
+}
+
+// isArg returns true if name is one of the resolver's arguments
+func isArg(fieldInfo *Info, name string) bool {
+	for _, arg := range fieldInfo.Args {
+		if arg == name {
+			return true
+		}
+	}
+	return false
+}
+
 // getBracketedList gets a list of values from a string enclosed in brackets and preceded by a keyword
 // This is used to extract info from the metadata (tag) of a struct field used
 // for GraphQL resolvers, such as resolver arguments.
@@ -76,10 +76,11 @@ func TestSplitArgs(t *testing.T) {
 			[]string{`list=[1,3,6]#arg1`, `obj={a:"][][["}#arg2`},
 		},
 
-		"Desc0": {`# abc`, []string{"# abc"}},
-		"Desc1": {`,# abc`, []string{"", "# abc"}},
-		"Desc2": {`,z# abc`, []string{"", "z# abc"}},
-		"Desc3": {`"#"# abc`, []string{`"#"# abc`}},
+		"Desc0":        {`# abc`, []string{"# abc"}},
+		"Desc1":        {`,# abc`, []string{"", "# abc"}},
+		"Desc2":        {`,z# abc`, []string{"", "z# abc"}},
+		"Desc3":        {`"#"# abc`, []string{`"#"# abc`}},
+		"DescBrackets": {`a#(b]"\) \, c \\,d#{`, []string{`a#(b]"\) \, c \\`, `d#{`}},
 	}
 	for name, data := range splitArgsData {
 		t.Run(name, func(t *testing.T) {
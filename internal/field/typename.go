@@ -0,0 +1,133 @@
+package field
+
+// typename.go makes the GraphQL names of Go types, in particular of instantiated generic types (eg
+// Connection[User]) whose Go names contain characters (brackets, dots, etc) that are not allowed in GraphQL
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	typeNameMtx     sync.RWMutex                                // protects genericTypeName
+	genericTypeName func(name string, typeArgs []string) string // if not nil, overrides the default generic names
+)
+
+// SetGenericTypeName sets a function that makes the GraphQL name of an instantiated generic type from the name of
+// the generic type and the names of its type arguments, eg ("Connection", ["User"]).  The function may return an
+// empty string to use the default name.  Passing nil restores the default.
+func SetGenericTypeName(f func(name string, typeArgs []string) string) {
+	typeNameMtx.Lock()
+	defer typeNameMtx.Unlock()
+	genericTypeName = f
+}
+
+// TypeName returns the GraphQL name of a Go type, which is the same as t.Name() (possibly "" for an unnamed type)
+// except for an instantiated generic type.  By default, the name of a generic type is prefixed with the names of
+// its type arguments, eg Connection[User] is "UserConnection" and Pair[string, int] is "StringIntPair".
+func TypeName(t reflect.Type) string {
+	name := t.Name()
+	if strings.IndexByte(name, '[') < 0 {
+		return name
+	}
+	return genericName(name)
+}
+
+// genericName makes a GraphQL name from the Go name of an instantiated generic type, eg "Connection[main.User]"
+func genericName(goName string) string {
+	i := strings.IndexByte(goName, '[')
+	base := goName[:i]
+	var args []string
+	for _, arg := range splitTypeArgs(goName[i+1 : len(goName)-1]) {
+		args = append(args, typeArgName(arg))
+	}
+
+	typeNameMtx.RLock()
+	f := genericTypeName
+	typeNameMtx.RUnlock()
+	if f != nil {
+		if name := f(base, args); name != "" {
+			return name
+		}
+	}
+	return strings.Join(args, "") + base
+}
+
+// splitTypeArgs splits the (Go) type arguments of a generic type at the commas that are not within brackets
+func splitTypeArgs(s string) (r []string) {
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				r = append(r, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(r, strings.TrimSpace(s[start:]))
+}
+
+// closingBracket returns the index of the square bracket that closes one opened just before the start of s
+func closingBracket(s string) int {
+	depth := 1
+	for i, c := range s {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// scalarArgNames are the names used for built-in types when used as type arguments
+var scalarArgNames = map[string]string{
+	"bool": "Boolean", "string": "String", "float32": "Float", "float64": "Float",
+	"int": "Int", "int8": "Int", "int16": "Int", "int32": "Int", "int64": "Int",
+	"uint": "Int", "uint8": "Int", "uint16": "Int", "uint32": "Int", "uint64": "Int",
+}
+
+// typeArgName makes a name (for use in a GraphQL name) for a Go type argument such as "*github.com/x/y.User"
+func typeArgName(arg string) string {
+	switch {
+	case strings.HasPrefix(arg, "*"):
+		return typeArgName(arg[1:]) // pointer
+	case strings.HasPrefix(arg, "map["):
+		kv := arg[len("map["):]
+		if i := closingBracket(kv); i > -1 {
+			return typeArgName(kv[:i]) + typeArgName(kv[i+1:]) + "Map"
+		}
+	case strings.HasPrefix(arg, "["):
+		if i := strings.IndexByte(arg, ']'); i > -1 {
+			return typeArgName(arg[i+1:]) + "List" // slice or array
+		}
+	}
+	if name, ok := scalarArgNames[arg]; ok {
+		return name
+	}
+
+	// Remove the package path, ie everything up to the last dot before any type arguments
+	name := arg
+	if i := strings.IndexByte(name, '['); i > -1 {
+		name = name[:i]
+	}
+	if i := strings.LastIndexByte(name, '.'); i > -1 {
+		arg = arg[i+1:]
+	}
+	if strings.IndexByte(arg, '[') > -1 {
+		return genericName(arg)
+	}
+	first, size := utf8.DecodeRuneInString(arg)
+	return string(unicode.ToUpper(first)) + arg[size:]
+}
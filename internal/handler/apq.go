@@ -0,0 +1,140 @@
+package handler
+
+// apq.go implements automatic persisted queries (the Apollo APQ protocol) where a client sends the SHA-256 hash
+// of a query (in the persistedQuery request extension) instead of the query text.  If the server does not know the
+// hash the client is told (PersistedQueryNotFound) so it can resend the request with the query text and the hash,
+// which the server saves in the query store for later requests.  In allow-list mode the server never saves queries
+// sent by clients so only queries added to the store in advance can be executed.
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// persistedQueryExtension is the name of the request extension used by APQ clients to send the hash of a query
+const persistedQueryExtension = "persistedQuery"
+
+type (
+	// QueryStore saves the text of queries (keyed by the hex SHA-256 hash of the text) for automatic persisted
+	// queries (see AutomaticPersistedQueries option).  It may be called concurrently by different requests.
+	// A store shared between servers (eg using Redis) allows a query saved by one server to be used by the others.
+	QueryStore interface {
+		Get(hash string) (query string, ok bool)
+		Put(hash, query string)
+	}
+
+	// LRUQueryStore is an in-memory QueryStore that keeps a limited number of queries, discarding the least
+	// recently used query when it is full
+	LRUQueryStore struct {
+		mu       sync.Mutex
+		capacity int                      // max. number of queries (zero for no limit)
+		order    *list.List               // queries (storedQuery) from most to least recently used
+		queries  map[string]*list.Element // element of order for each hash
+	}
+
+	// storedQuery is an element of the LRU list of an LRUQueryStore
+	storedQuery struct {
+		hash, query string
+	}
+)
+
+// NewLRUQueryStore creates an in-memory query store that holds up to capacity queries, where a capacity of zero
+// means there is no limit (eg for an allow-list).  Any queries given are added to the store.
+func NewLRUQueryStore(capacity int, queries ...string) *LRUQueryStore {
+	s := &LRUQueryStore{
+		capacity: capacity,
+		order:    list.New(),
+		queries:  make(map[string]*list.Element),
+	}
+	for _, query := range queries {
+		s.Put(QueryHash(query), query)
+	}
+	return s
+}
+
+// Get returns the query with the hash (if in the store) and marks it as most recently used
+func (s *LRUQueryStore) Get(hash string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elt, ok := s.queries[hash]
+	if !ok {
+		return "", false
+	}
+	s.order.MoveToFront(elt)
+	return elt.Value.(storedQuery).query, true
+}
+
+// Put adds a query to the store (discarding the least recently used query if the store is full)
+func (s *LRUQueryStore) Put(hash, query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elt, ok := s.queries[hash]; ok {
+		s.order.MoveToFront(elt)
+		return
+	}
+	if s.capacity > 0 && s.order.Len() >= s.capacity {
+		oldest := s.order.Remove(s.order.Back()).(storedQuery)
+		delete(s.queries, oldest.hash)
+	}
+	s.queries[hash] = s.order.PushFront(storedQuery{hash: hash, query: query})
+}
+
+// QueryHash returns the hash of a query as used by automatic persisted queries (hex encoded SHA-256)
+func QueryHash(query string) string {
+	hash := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(hash[:])
+}
+
+// persistedQuery gets the query text of a request that uses automatic persisted queries (APQ) - ie the request
+// extensions contain a persistedQuery object with a sha256Hash.  If the request has no query text it is found in
+// the store, otherwise the query text is checked against the hash and saved in the store.  In allow-list mode
+// all queries (even without the persistedQuery extension) must already be in the store.
+func (h *Handler) persistedQuery(query string, extensions map[string]interface{}) (string, *gqlerror.Error) {
+	apq, _ := extensions[persistedQueryExtension].(map[string]interface{})
+	hash, _ := apq["sha256Hash"].(string)
+	if h.queryStore == nil {
+		if query == "" && apq != nil {
+			return "", apqError("PersistedQueryNotSupported", "PERSISTED_QUERY_NOT_SUPPORTED")
+		}
+		return query, nil
+	}
+	if hash == "" {
+		if h.apqAllowList && query != "" {
+			hash = QueryHash(query) // query must be in the allow-list
+		} else {
+			return query, nil
+		}
+	}
+
+	if query == "" {
+		stored, ok := h.queryStore.Get(hash)
+		if !ok {
+			return "", apqError("PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND")
+		}
+		return stored, nil
+	}
+	if QueryHash(query) != hash {
+		return "", apqError("provided sha256Hash does not match query", "PERSISTED_QUERY_HASH_MISMATCH")
+	}
+	if h.apqAllowList {
+		if _, ok := h.queryStore.Get(hash); !ok {
+			return "", apqError("query is not in the allow-list", "PERSISTED_QUERY_NOT_ALLOWED")
+		}
+		return query, nil
+	}
+	h.queryStore.Put(hash, query)
+	return query, nil
+}
+
+// apqError makes an automatic persisted query error, where message is what APQ clients expect (eg
+// PersistedQueryNotFound tells the client to resend the query text)
+func apqError(message, code string) *gqlerror.Error {
+	return &gqlerror.Error{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
@@ -0,0 +1,145 @@
+package handler
+
+// arena.go reuses the maps and slices used to build query results (see ResultArena option) to reduce the load on
+// the garbage collector when there are many large responses - they are obtained from pools while the request is
+// processed and are all returned to the pools once the response has been encoded
+
+import (
+	"sync"
+
+	"github.com/dolmen-go/jsonmap"
+)
+
+const (
+	// Maps and slices larger than these are not returned to the pools so that a few very large results do not
+	// keep a lot of memory in use (a map does not shrink when its entries are deleted)
+	arenaMaxMap  = 1024
+	arenaMaxList = 64 * 1024
+)
+
+var (
+	arenaMaps   = sync.Pool{New: func() interface{} { return make(map[string]interface{}) }}
+	arenaOrders = sync.Pool{New: func() interface{} { return new([]string) }}
+	arenaLists  = sync.Pool{New: func() interface{} { return new([]interface{}) }}
+)
+
+// resultArena keeps track of the maps and slices used for the result of a request, so they can be reused.
+// A nil *resultArena is valid and just allocates maps and slices normally.
+type resultArena struct {
+	mtx    sync.Mutex // protects the following (resolvers may run concurrently)
+	maps   []map[string]interface{}
+	orders []*[]string
+	lists  []*[]interface{}
+	// abandoned is set if resolvers may still be running after the result is returned (eg after an error), in
+	// which case the maps and slices are left to the garbage collector as they may still be in use
+	abandoned bool
+}
+
+// ordered returns an empty jsonmap.Ordered, which can hold n entries without growing the Order slice
+func (a *resultArena) ordered(n int) jsonmap.Ordered {
+	if a == nil {
+		return jsonmap.Ordered{Data: make(map[string]interface{}), Order: make([]string, 0, n)}
+	}
+	m := arenaMaps.Get().(map[string]interface{})
+	order := arenaOrders.Get().(*[]string)
+	if cap(*order) < n {
+		*order = make([]string, 0, n)
+	}
+	a.mtx.Lock()
+	a.maps = append(a.maps, m)
+	a.orders = append(a.orders, order)
+	a.mtx.Unlock()
+	return jsonmap.Ordered{Data: m, Order: (*order)[:0]}
+}
+
+// list returns an empty (non-nil) slice that can hold n elements without growing
+func (a *resultArena) list(n int) []interface{} {
+	if a == nil {
+		return make([]interface{}, 0, n)
+	}
+	list := arenaLists.Get().(*[]interface{})
+	if cap(*list) < n {
+		*list = make([]interface{}, 0, n)
+	}
+	a.mtx.Lock()
+	a.lists = append(a.lists, list)
+	a.mtx.Unlock()
+	return (*list)[:0]
+}
+
+// abandon says that the result is incomplete, and resolvers may still be using the maps and slices
+func (a *resultArena) abandon() {
+	if a == nil {
+		return
+	}
+	a.mtx.Lock()
+	a.abandoned = true
+	a.mtx.Unlock()
+}
+
+// release clears the maps and slices (so they don't keep values alive) and returns them to the pools
+// It must only be called once the result is no longer used (ie after it has been encoded).
+func (a *resultArena) release() {
+	if a == nil {
+		return
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.abandoned {
+		return
+	}
+	for _, m := range a.maps {
+		if len(m) > arenaMaxMap {
+			continue
+		}
+		for k := range m {
+			delete(m, k)
+		}
+		arenaMaps.Put(m)
+	}
+	for _, order := range a.orders {
+		if cap(*order) > arenaMaxList {
+			continue
+		}
+		full := (*order)[:cap(*order)]
+		for i := range full {
+			full[i] = ""
+		}
+		arenaOrders.Put(order)
+	}
+	for _, list := range a.lists {
+		if cap(*list) > arenaMaxList {
+			continue
+		}
+		full := (*list)[:cap(*list)]
+		for i := range full {
+			full[i] = nil
+		}
+		arenaLists.Put(list)
+	}
+	a.maps, a.orders, a.lists = nil, nil, nil
+}
+
+// copyResult makes a copy of a (resolved) result that does not use the arena's maps and slices, eg to keep
+// it in a resolver cache
+func copyResult(v interface{}) interface{} {
+	switch v := v.(type) {
+	case jsonmap.Ordered:
+		r := jsonmap.Ordered{Data: make(map[string]interface{}, len(v.Data)), Order: make([]string, len(v.Order))}
+		copy(r.Order, v.Order)
+		for k, elt := range v.Data {
+			r.Data[k] = copyResult(elt)
+		}
+		return r
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		r := make([]interface{}, len(v))
+		for i, elt := range v {
+			r[i] = copyResult(elt)
+		}
+		return r
+	}
+	return v
+}
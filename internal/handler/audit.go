@@ -0,0 +1,148 @@
+package handler
+
+// audit.go sends a record of every executed operation to an (optional) audit sink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	defaultAuditBatchSize     = 100         // max. number of records passed to the sink in one call
+	defaultAuditFlushInterval = time.Second // max. time a record is held before being passed to the sink
+)
+
+type (
+	// OperationRecord describes an executed operation (query, mutation or subscription) for auditing.
+	// Note that requests rejected before any operation is run (eg invalid query syntax) are not recorded.
+	OperationRecord struct {
+		Hash          string        // SHA-256 (hex) of the request's query text
+		Name          string        // operation name (may be empty)
+		Operation     string        // "query", "mutation" or "subscription"
+		VariablesSize int           // size of the request's variables (as JSON) in bytes
+		Start         time.Time     // when the operation started
+		Duration      time.Duration // how long the operation took (for subscriptions, how long it took to start)
+		Errors        []string      // error message(s) if anything went wrong
+		ClientID      string        // identifies the client (see RateLimitKey option)
+		CacheHits     int64         // number of resolver values found in the cache (see CacheStats)
+		CacheMisses   int64         // number of resolver values not found in the cache (so the resolver was called)
+		Deprecated    []string      // deprecated fields (eg "Query.hero") and arguments (eg "Query.hero(episode)") used
+	}
+
+	// AuditSink receives records of executed operations.  Records are passed in batches, from a single
+	// go-routine, so that Audit does not need to handle concurrent calls.  If Audit is slow to return then
+	// records queue up, and if the queue fills then requests are blocked until there is room (backpressure).
+	AuditSink interface {
+		Audit(records []OperationRecord)
+	}
+
+	// auditor queues operation records and passes them to the sink in batches
+	auditor struct {
+		sink          AuditSink
+		batchSize     int
+		flushInterval time.Duration
+		queue         chan OperationRecord
+		done          chan struct{} // closed to stop the go-routine
+		stopped       chan struct{} // closed by the go-routine when it has finished
+	}
+)
+
+// newAuditor creates an auditor and starts the go-routine that passes batches of records to the sink
+func newAuditor(sink AuditSink, batchSize int, flushInterval time.Duration) *auditor {
+	if batchSize <= 0 {
+		batchSize = defaultAuditBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultAuditFlushInterval
+	}
+	a := &auditor{
+		sink:          sink,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		queue:         make(chan OperationRecord, 4*batchSize),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// record queues a record for the sink - it blocks if the queue is full (ie the sink is not keeping up)
+func (a *auditor) record(rec OperationRecord) {
+	a.queue <- rec
+}
+
+// stop ends the go-routine, after any queued records have been passed to the sink
+func (a *auditor) stop() {
+	close(a.done)
+	<-a.stopped
+}
+
+// run collects records into batches which are passed to the sink when full or when the flush interval expires
+func (a *auditor) run() {
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+	defer close(a.stopped)
+
+	batch := make([]OperationRecord, 0, a.batchSize)
+	for {
+		select {
+		case rec := <-a.queue:
+			batch = append(batch, rec)
+			if len(batch) < a.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-a.done:
+			// Pass on anything still queued then exit
+		drain:
+			for {
+				select {
+				case rec := <-a.queue:
+					batch = append(batch, rec)
+				default:
+					break drain
+				}
+			}
+			if len(batch) > 0 {
+				a.sink.Audit(batch)
+			}
+			return
+		}
+		a.sink.Audit(batch)
+		batch = make([]OperationRecord, 0, a.batchSize) // the sink may retain the previous batch
+	}
+}
+
+// operationRecord creates the audit record of an operation of the request
+func (g *gqlRequest) operationRecord(operation *ast.OperationDefinition, start time.Time, errs gqlerror.List,
+) OperationRecord {
+	hash := sha256.Sum256([]byte(g.Query))
+	r := OperationRecord{
+		Hash:      hex.EncodeToString(hash[:]),
+		Name:      operation.Name,
+		Operation: string(operation.Operation),
+		Start:     start,
+		Duration:  time.Since(start),
+		ClientID:  g.clientKey,
+	}
+	r.CacheHits, r.CacheMisses = g.cacheCounts.get()
+	r.Deprecated = deprecatedUses(operation)
+	if len(g.Variables) > 0 {
+		if buf, err := json.Marshal(g.Variables); err == nil {
+			r.VariablesSize = len(buf)
+		}
+	}
+	for _, e := range errs {
+		r.Errors = append(r.Errors, e.Message)
+	}
+	return r
+}
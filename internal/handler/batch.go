@@ -0,0 +1,230 @@
+package handler
+
+// batch.go handles resolvers with the "batch" option (like a dataloader) to avoid the "N+1 problem".  Instead of
+// calling the resolver function of every element of a list, the function (of the first element) is called once
+// with the keys of all the elements (map keys or slice indexes) and returns a slice with a result for each key.
+// If the function's parameter is a slice of the element type the elements are passed instead of the keys.
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type (
+	// batchKey is the context key for the batchElement of the list element being resolved
+	batchKey struct{}
+
+	// listBatch has the results of the batch resolvers called for all the elements of a list
+	listBatch struct {
+		results map[batchField]batchResult
+		types   []reflect.Type // struct type of each element (nil if not a struct, eg a nil pointer)
+		pos     []int          // position of each element in the results of elements of the same type
+	}
+
+	// batchField identifies a batch resolver by its response name (alias), which is unique in the results of an
+	// element (see collectFields) - the elements of a list may be of different types (eg an interface)
+	batchField struct {
+		alias string
+		t     reflect.Type
+	}
+
+	// batchResult is the slice of values (or error) returned by a batch resolver
+	batchResult struct {
+		values reflect.Value
+		err    error
+	}
+
+	// batchElement is stored in the context of an element of a list so its batch resolvers can find their value
+	batchElement struct {
+		batch *listBatch
+		index int
+	}
+)
+
+// batchList calls the batch resolvers, selected in set, for all the elements of a list.  The elements and keys
+// (map keys or indexes) are in the order of the list.  It returns nil if there are no batch resolvers.
+func (op *gqlOperation) batchList(ctx context.Context, set ast.SelectionSet, elements, keys []reflect.Value,
+) *listBatch {
+	var batch *listBatch
+	groups := make(map[reflect.Type][]int) // indexes of the elements of each type
+	var order []reflect.Type
+	for i, element := range elements {
+		for element.Kind() == reflect.Ptr || element.Kind() == reflect.Interface {
+			if element.IsNil() {
+				break
+			}
+			element = element.Elem()
+		}
+		if element.Kind() != reflect.Struct || !op.hasBatch(element.Type()) {
+			continue
+		}
+		if batch == nil {
+			batch = &listBatch{results: make(map[batchField]batchResult), types: make([]reflect.Type, len(elements)),
+				pos: make([]int, len(elements))}
+		}
+		t := element.Type()
+		if _, ok := groups[t]; !ok {
+			order = append(order, t)
+		}
+		batch.types[i], batch.pos[i] = t, len(groups[t])
+		groups[t] = append(groups[t], i)
+	}
+	for _, t := range order {
+		op.batchFields(set, t, func(astField *ast.Field, data ResolverData) {
+			key := batchField{alias: astField.Alias, t: t}
+			if _, ok := batch.results[key]; !ok {
+				batch.results[key] = op.callBatch(ctx, astField, data, elements, keys, groups[t])
+			}
+		})
+	}
+	return batch
+}
+
+// mayBatch returns true if the elements of a list of type t (the element type) may have batch resolvers
+func (op *gqlOperation) mayBatch(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Interface || t.Kind() == reflect.Struct && op.hasBatch(t)
+}
+
+// hasBatch returns true if a struct type has any resolvers with the "batch" option
+func (op *gqlOperation) hasBatch(t reflect.Type) bool {
+	for _, data := range op.resolverLookup[t] {
+		if data.Batch {
+			return true
+		}
+	}
+	return false
+}
+
+// batchFields calls f for every batch resolver (of struct type t) selected in set, including in fragments
+func (op *gqlOperation) batchFields(set ast.SelectionSet, t reflect.Type, f func(*ast.Field, ResolverData)) {
+	for _, s := range set {
+		switch s := s.(type) {
+		case *ast.Field:
+			if data, ok := op.resolverLookup[t][s.Name]; ok && data.Batch && !op.directiveBypass(s.Directives) {
+				f(s, data)
+			}
+		case *ast.InlineFragment:
+			if !op.directiveBypass(s.Directives) && op.hasTypeCondition(t, s.TypeCondition) {
+				op.batchFields(s.SelectionSet, t, f)
+			}
+		case *ast.FragmentSpread:
+			if !op.directiveBypass(s.Directives) && op.hasTypeCondition(t, s.Definition.TypeCondition) {
+				op.batchFields(s.Definition.SelectionSet, t, f)
+			}
+		}
+	}
+}
+
+// callBatch calls the batch resolver function (of the first element) for the elements at indexes
+func (op *gqlOperation) callBatch(ctx context.Context, astField *ast.Field, data ResolverData,
+	elements, keys []reflect.Value, indexes []int,
+) (r batchResult) {
+	defer func() {
+		if recoverValue := recover(); recoverValue != nil {
+			r = batchResult{err: fmt.Errorf("Internal error: panic %v", recoverValue)}
+		}
+	}()
+	if err := ctx.Err(); err != nil {
+		return batchResult{err: err}
+	}
+	element := elements[indexes[0]]
+	for element.Kind() == reflect.Ptr || element.Kind() == reflect.Interface {
+		element = element.Elem()
+	}
+	fn := element.Field(data.Index)
+	if fn.IsNil() {
+		return batchResult{err: fmt.Errorf("batch resolver %q is nil", astField.Name)}
+	}
+	fnType := fn.Type()
+
+	var args []reflect.Value
+	if fnType.NumIn() > 1 {
+		args = append(args, reflect.ValueOf(ctx))
+	}
+	paramType := fnType.In(fnType.NumIn() - 1)
+	param := reflect.MakeSlice(paramType, len(indexes), len(indexes))
+	for i, index := range indexes {
+		value, err := batchParam(paramType.Elem(), elements[index], keys[index])
+		if err != nil {
+			return batchResult{err: fmt.Errorf("%w for batch resolver %q", err, astField.Name)}
+		}
+		param.Index(i).Set(value)
+	}
+	out := fn.Call(append(args, param))
+	if len(out) > 1 && !out[1].IsNil() {
+		return batchResult{err: out[1].Interface().(error)}
+	}
+	if out[0].Len() != len(indexes) {
+		return batchResult{err: fmt.Errorf("batch resolver %q returned %d results for %d keys", astField.Name,
+			out[0].Len(), len(indexes))}
+	}
+	return batchResult{values: out[0]}
+}
+
+// batchParam returns the value passed to a batch resolver (in a slice of type t) for a list element - the element
+// itself (or a pointer to it) if t is the element type, otherwise the element's key
+func batchParam(t reflect.Type, element, key reflect.Value) (reflect.Value, error) {
+	for {
+		if element.Type().AssignableTo(t) {
+			return element, nil
+		}
+		if element.Kind() == reflect.Struct && reflect.PtrTo(element.Type()).AssignableTo(t) {
+			if element.CanAddr() {
+				return element.Addr(), nil
+			}
+			ptr := reflect.New(element.Type())
+			ptr.Elem().Set(element)
+			return ptr, nil
+		}
+		if element.Kind() != reflect.Ptr && element.Kind() != reflect.Interface {
+			break
+		}
+		element = element.Elem()
+	}
+	// Only convert between keys of the same kind (eg int to int64), apart from a list index (or other integer key)
+	// which is formatted as a decimal string if the function takes strings
+	switch {
+	case isIntKind(key.Kind()) && isIntKind(t.Kind()), key.Kind() == reflect.String && t.Kind() == reflect.String:
+		return key.Convert(t), nil
+	case isIntKind(key.Kind()) && t.Kind() == reflect.String:
+		if key.Kind() <= reflect.Int64 {
+			return reflect.ValueOf(strconv.FormatInt(key.Int(), 10)).Convert(t), nil
+		}
+		return reflect.ValueOf(strconv.FormatUint(key.Uint(), 10)).Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("key of type %s cannot be converted to %s", key.Type(), t)
+}
+
+// isIntKind returns true for the kinds of the (signed and unsigned) integer types
+func isIntKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Uint64
+}
+
+// element returns the context for resolving the element (at index) of a list
+func (b *listBatch) element(ctx context.Context, index int) context.Context {
+	if b == nil || b.types[index] == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, batchKey{}, batchElement{batch: b, index: index})
+}
+
+// batchValue returns the value of a batch resolver for the list element being resolved
+func batchValue(ctx context.Context, astField *ast.Field) (reflect.Value, error) {
+	be, ok := ctx.Value(batchKey{}).(batchElement)
+	if ok {
+		if result, ok := be.batch.results[batchField{alias: astField.Alias, t: be.batch.types[be.index]}]; ok {
+			if result.err != nil {
+				return reflect.Value{}, result.err
+			}
+			return result.values.Index(be.batch.pos[be.index]), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("batch resolver %q can only be used for the elements of a list", astField.Name)
+}
@@ -1,9 +1,13 @@
 package handler_test
 
 import (
+	"fmt"
 	"net/http/httptest"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/andrewwphillips/eggql/internal/handler"
 )
@@ -79,3 +83,165 @@ func BenchmarkQuery(b *testing.B) {
 		writer.Body.Reset()
 	}
 }
+
+// BenchmarkSkipList benchmarks a query of a large list using a fragment with a static (literal) @skip directive
+// ~5.9 millisec, 31727 allocs (Intel Xeon) - directives checked for every list element
+// ~2.9 millisec, 26726 allocs (Intel Xeon) - literal directives folded once per request (see foldDirectives)
+func BenchmarkSkipList(b *testing.B) {
+	const query = `{ "Query": "{ list { ...f @skip(if: true) v w @include(if: false) } } fragment f on E { v }" }`
+	list := make([]struct{ V, W int }, 1000)
+	h := handler.New([]string{"type Query { list: [E!]! } type E { v: Int! w: Int! }"},
+		nil,
+		[3][]interface{}{{struct{ List []struct{ V, W int } }{list}}, nil, nil},
+	)
+
+	body := strings.NewReader(query)
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Add("Content-Type", "application/json")
+	writer := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(writer, request)
+		if !strings.Contains(writer.Body.String(), `"data":{"list":[{"v":0}`) {
+			b.Error("GraphQL query failed:\n", writer.Result().StatusCode, writer.Body.String())
+		}
+		body.Reset(query)
+		writer.Body.Reset()
+	}
+}
+
+// BenchmarkResultArena benchmarks a query with a large result, with and without the ResultArena option
+// ~18.1 millisec, 4.36 MB, 71721 allocs (Intel Xeon) - arena=false
+// ~18.7 millisec, 3.88 MB, 66755 allocs (Intel Xeon) - arena=true
+// Note that the time is dominated by other allocations (go-routines, channels, etc) so the arena mainly helps by
+// reducing garbage (hence GC pauses) rather than making a single request faster
+func BenchmarkResultArena(b *testing.B) {
+	const query = `{ "Query": "{ list { v w n { v } } }" }`
+	type N struct{ V int }
+	list := make([]struct {
+		V, W int
+		N    N
+	}, 1000)
+	for _, on := range []bool{false, true} {
+		b.Run(fmt.Sprintf("arena=%v", on), func(b *testing.B) {
+			h := handler.New([]string{"type Query { list: [E!]! } type E { v: Int! w: Int! n: N! } type N { v: Int! }"},
+				nil,
+				[3][]interface{}{{struct {
+					List []struct {
+						V, W int
+						N    N
+					}
+				}{list}}, nil, nil},
+				handler.ResultArena(on),
+			)
+
+			body := strings.NewReader(query)
+			request := httptest.NewRequest("POST", "/", body)
+			request.Header.Add("Content-Type", "application/json")
+			writer := httptest.NewRecorder()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(writer, request)
+				if !strings.Contains(writer.Body.String(), `"data":{"list":[{"v":0,"w":0,"n":{"v":0}}`) {
+					b.Error("GraphQL query failed:\n", writer.Result().StatusCode, writer.Body.String())
+				}
+				body.Reset(query)
+				writer.Body.Reset()
+			}
+		})
+	}
+}
+
+// BenchmarkResolverGoroutines benchmarks a wide query (200 aliases of a slow field) in a list, with and without a
+// limit on resolver go-routines, reporting the peak number of go-routines and stack memory in use at that time
+// ~ 6.3 millisec, 206 peak-goroutines, 720 KB peak-stack-bytes (Intel Xeon) - max=0 (no limit)
+// ~75.4 millisec,  13 peak-goroutines, 491 KB peak-stack-bytes (Intel Xeon) - max=8
+// Note that limiting the go-routines saves memory at the cost of latency when resolvers are slow (block)
+func BenchmarkResolverGoroutines(b *testing.B) {
+	var peak, peakStack int64
+	v := func() int {
+		if n := int64(runtime.NumGoroutine()); n > atomic.LoadInt64(&peak) {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			atomic.StoreInt64(&peak, n)
+			atomic.StoreInt64(&peakStack, int64(stats.StackInuse))
+		}
+		time.Sleep(50 * time.Microsecond)
+		return 1
+	}
+	var fields strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&fields, "a%d: v ", i)
+	}
+	query := `{ "Query": "{ list { ` + fields.String() + `} }" }`
+	type E struct{ V func() int }
+	list := []E{{v}, {v}}
+
+	for _, max := range []int{0, 8} {
+		b.Run(fmt.Sprintf("max=%d", max), func(b *testing.B) {
+			h := handler.New([]string{"type Query { list: [E!]! } type E { v: Int! }"},
+				nil,
+				[3][]interface{}{{struct{ List []E }{list}}, nil, nil},
+				handler.MaxResolverGoroutines(max),
+			)
+
+			body := strings.NewReader(query)
+			request := httptest.NewRequest("POST", "/", body)
+			request.Header.Add("Content-Type", "application/json")
+			writer := httptest.NewRecorder()
+			atomic.StoreInt64(&peak, 0)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(writer, request)
+				if !strings.Contains(writer.Body.String(), `"data":{"list":[{"a0":1,`) {
+					b.Error("GraphQL query failed:\n", writer.Result().StatusCode, writer.Body.String())
+				}
+				body.Reset(query)
+				writer.Body.Reset()
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&peak)), "peak-goroutines")
+			b.ReportMetric(float64(atomic.LoadInt64(&peakStack)), "peak-stack-bytes")
+		})
+	}
+}
+
+// BenchmarkTrivialFields benchmarks small selection sets of fields that are just struct field reads (and
+// __typename), which are resolved without starting a go-routine
+// ~47 microsec,  200 allocs (Intel Xeon) - { a b }, go-routine per field
+// ~35 microsec,  196 allocs (Intel Xeon) - { a b }, trivial fields resolved directly
+// ~1.4 millisec, 5111 allocs (Intel Xeon) - list of 100, go-routine per field
+// ~1.0 millisec, 4711 allocs (Intel Xeon) - list of 100, trivial fields resolved directly
+func BenchmarkTrivialFields(b *testing.B) {
+	type E struct{ V, W int }
+	h := handler.New([]string{"type Query { a: Int! b: String! list: [E!]! } type E { v: Int! w: Int! }"},
+		nil,
+		[3][]interface{}{{struct {
+			A    int
+			B    string
+			List []E
+		}{1, "b", make([]E, 100)}}, nil, nil},
+	)
+	for _, query := range []string{
+		`{ __typename }`,
+		`{ a b }`,
+		`{ list { __typename v w } }`,
+	} {
+		b.Run(query, func(b *testing.B) {
+			body := `{ "Query": "` + query + `" }`
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				writer := httptest.NewRecorder()
+				h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+				if !strings.Contains(writer.Body.String(), `"data":{`) {
+					b.Error("GraphQL query failed:\n", writer.Result().StatusCode, writer.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
 	"math/rand"
 	"net/http"
@@ -8,8 +9,10 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/andrewwphillips/eggql/internal/handler"
 )
@@ -247,22 +250,28 @@ func TestCacheArgs(t *testing.T) {
 	getNext := func(a int) int { return a * int(atomic.AddInt32(&next, 1)) }
 	// getNext3 increments next and returns the value multiplied by all its parameters
 	getNext3 := func(a, b, c int) int { return a * b * c * int(atomic.AddInt32(&next, 1)) }
-	const schemaString = "type Query { y(a:Int!):Int! n(a:Int!):Int! yyy(a:Int!,b:Int!,c:Int!):Int! nnn(a:Int!,b:Int!,c:Int!):Int!}"
+	// getNextList increments next and returns the value multiplied by the length of the list
+	getNextList := func(a []int) int { return len(a) * int(atomic.AddInt32(&next, 1)) }
+	const schemaString = "type Query { y(a:Int!):Int! n(a:Int!):Int! yyy(a:Int!,b:Int!,c:Int!):Int! nnn(a:Int!,b:Int!,c:Int!):Int! " +
+		"l(a:[Int!]!):Int! }"
 	queryData := struct {
 		Y   func(int) int           `egg:"(a)"`
 		N   func(int) int           `egg:"(a),no_cache"`
 		Yyy func(int, int, int) int `egg:"(a,b,c)"`
 		Nnn func(int, int, int) int `egg:"(a,b,c),no_cache"`
+		L   func([]int) int         `egg:"(a)"`
 	}{
 		Y:   getNext,
 		N:   getNext,
 		Yyy: getNext3,
 		Nnn: getNext3,
+		L:   getNextList,
 	}
 
 	data := map[string]struct {
-		query    string      // GraphQL query to send to the handler (query syntax)
-		expected interface{} // expected result after decoding the returned JSON
+		query     string      // GraphQL query to send to the handler (query syntax)
+		variables string      // variables (JSON object) or empty string if none
+		expected  interface{} // expected result after decoding the returned JSON
 	}{
 		"SameParam": {
 			// same resolver called with same param should be cached
@@ -313,6 +322,20 @@ func TestCacheArgs(t *testing.T) {
 			query:    "{ nnn(a:2, b:3, c:5) nnn2:nnn(a:2, b:3, c:5) }",
 			expected: JsonObject{"nnn": 30.0, "nnn2": 60.0},
 		},
+		"VariablesSame": {
+			query:     "query($x:Int!, $z:Int!) { y(a:$x) y2:y(a:$z) y3:y(a:3) }",
+			variables: `{"x":3, "z":3}`,
+			expected:  JsonObject{"y": 3.0, "y2": 3.0, "y3": 3.0},
+		},
+		"VariablesDiff": {
+			query:     "query($x:Int!, $z:Int!) { y(a:$x) y2:y(a:$z) }",
+			variables: `{"x":2, "z":5}`,
+			expected:  JsonObject{"y": 2.0, "y2": 10.0},
+		},
+		"ListParamsDiff": {
+			query:    "{ l(a:[1]) l2:l(a:[1,2]) l3:l(a:[1]) }",
+			expected: JsonObject{"l": 1.0, "l2": 4.0, "l3": 1.0},
+		},
 	}
 
 	for name, testData := range data {
@@ -335,6 +358,10 @@ func TestCacheArgs(t *testing.T) {
 			body.WriteString(`{"query":"`)
 			body.WriteString(testData.query)
 			body.WriteString(`"`)
+			if testData.variables != "" {
+				body.WriteString(`,"variables":`)
+				body.WriteString(testData.variables)
+			}
 			body.WriteString(`}`)
 
 			request := httptest.NewRequest("POST", "/", strings.NewReader(body.String()))
@@ -367,3 +394,312 @@ func TestCacheArgs(t *testing.T) {
 		})
 	}
 }
+
+// TestCacheStats checks that cache hits and misses are counted, for each resolver and in the audit record
+func TestCacheStats(t *testing.T) {
+	const schemaString = "type Query { i: Int! j: Int! s(a: String!): String! }"
+	queryData := struct {
+		I func() int
+		J func() int          `egg:",no_cache"`
+		S func(string) string `egg:"(a)"`
+	}{
+		I: func() int { return 1 },
+		J: func() int { return 2 },
+		S: func(a string) string { return strings.Repeat(a, 100) },
+	}
+	sink := make(auditRecorder, 1)
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.FuncCache(true),
+		handler.NoConcurrency(true),
+		handler.NoIntrospection(true),
+		handler.Audit(sink, 1, time.Millisecond),
+	)
+
+	doRequest(t, h, `{"query":"{ i i2:i j s(a:\"x\") s2:s(a:\"y\") s3:s(a:\"x\") }"}`)
+
+	stats := make(map[string]handler.CacheStat)
+	for _, stat := range h.(*handler.Handler).CacheStats() {
+		stats[stat.Field] = stat
+	}
+	_, ok := stats["j"]
+	Assertf(t, !ok, "Expected no stats for uncached field j")
+	i, s := stats["i"], stats["s"]
+	Assertf(t, i.Hits == 1 && i.Misses == 1 && i.Entries == 1, "Expected i: 1 hit, 1 miss, 1 entry and got %+v", i)
+	Assertf(t, s.Hits == 1 && s.Misses == 2 && s.Entries == 2, "Expected s: 1 hit, 2 misses, 2 entries and got %+v", s)
+	Assertf(t, s.Size >= 200, "Expected s size of at least 200 bytes and got %d", s.Size)
+
+	select {
+	case records := <-sink:
+		Assertf(t, records[0].CacheHits == 2 && records[0].CacheMisses == 3, "Expected 2 hits, 3 misses and got %d, %d",
+			records[0].CacheHits, records[0].CacheMisses)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected an audit record")
+	}
+}
+
+// TestStaleWhileRevalidate checks that a stale cached value is returned while it is refreshed in the background,
+// and that a value older than the max age is not used
+func TestStaleWhileRevalidate(t *testing.T) {
+	var next int32
+	getNext := func() int { return int(atomic.AddInt32(&next, 1)) }
+	queryData := struct {
+		I func() int `egg:",cache=swr:50ms,max:300ms"`
+		J func() int // not cached (FuncCache option is off)
+	}{I: getNext, J: getNext}
+	h := handler.New([]string{"type Query { i: Int! j: Int! }"}, nil, [3][]interface{}{{queryData}, nil, nil})
+
+	steps := []struct {
+		name     string
+		wait     time.Duration // time to wait before the query
+		query    string
+		expected interface{}
+	}{
+		{"Miss", 0, "{ i }", JsonObject{"i": 1.0}},
+		{"Fresh", 0, "{ i }", JsonObject{"i": 1.0}},
+		{"NotCached", 0, "{ j }", JsonObject{"j": 2.0}},
+		{"Stale", 100 * time.Millisecond, "{ i }", JsonObject{"i": 1.0}}, // starts refresh (3)
+		{"Refreshed", 20 * time.Millisecond, "{ i }", JsonObject{"i": 3.0}},
+		{"Expired", 400 * time.Millisecond, "{ i }", JsonObject{"i": 4.0}},
+	}
+	for _, step := range steps {
+		time.Sleep(step.wait)
+		data, errs := doRequest(t, h, `{"query":"`+step.query+`"}`)
+		Assertf(t, errs == nil, "%-9s: expected no errors got %v", step.name, errs)
+		Assertf(t, reflect.DeepEqual(data, step.expected), "%-9s: expected %v got %v", step.name, step.expected, data)
+	}
+}
+
+// TestRefresh checks that only one refresh of a stale value is done at a time and that a failed refresh is
+// passed to the observer
+func TestRefresh(t *testing.T) {
+	var calls int32
+	queryData := struct {
+		I func() int `egg:",cache=swr:20ms,max:60ms"`
+	}{I: func() int {
+		n := atomic.AddInt32(&calls, 1)
+		switch n {
+		case 2:
+			time.Sleep(100 * time.Millisecond) // slow refresh
+		case 3:
+			panic("refresh failed")
+		}
+		return int(n)
+	}}
+	events := make(chan interface{}, 10)
+	h := handler.New([]string{"type Query { i: Int! }"}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.Observer(func(event interface{}) { events <- event }),
+	)
+
+	steps := []struct {
+		name     string
+		wait     time.Duration // time to wait before the query
+		expected interface{}
+	}{
+		{"Miss", 0, JsonObject{"i": 1.0}},
+		{"Stale", 30 * time.Millisecond, JsonObject{"i": 1.0}},   // starts a (slow) refresh (2)
+		{"Expired", 50 * time.Millisecond, JsonObject{"i": 2.0}}, // waits for the refresh rather than calling again
+		{"Failed", 30 * time.Millisecond, JsonObject{"i": 2.0}},  // starts a refresh (3) that panics
+		{"Kept", 10 * time.Millisecond, JsonObject{"i": 2.0}},    // stale value was kept
+	}
+	for _, step := range steps {
+		time.Sleep(step.wait)
+		data, errs := doRequest(t, h, `{"query":"{ i }"}`)
+		Assertf(t, errs == nil, "%-9s: expected no errors got %v", step.name, errs)
+		Assertf(t, reflect.DeepEqual(data, step.expected), "%-9s: expected %v got %v", step.name, step.expected, data)
+	}
+	select {
+	case event := <-events:
+		e, ok := event.(handler.RefreshError)
+		Assertf(t, ok && e.Field == "Query.i" && strings.Contains(e.Err.Error(), "refresh failed"),
+			"Expected refresh error and got %v", event)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a refresh error")
+	}
+}
+
+// TestCacheLimits checks that cached values expire (CacheTTL option and "cache" tag option), that the least recently
+// used values are evicted (CacheMaxEntries option) and that values can be removed using InvalidateCache
+func TestCacheLimits(t *testing.T) {
+	var next int32
+	getNext := func(int) int { return int(atomic.AddInt32(&next, 1)) }
+	queryData := struct {
+		I func(int) int `egg:"(a)"`
+		J func(int) int `egg:"(a),cache=50ms"`
+	}{I: getNext, J: getNext}
+	h := handler.New([]string{"type Query { i(a: Int!): Int! j(a: Int!): Int! }"}, nil,
+		[3][]interface{}{{queryData}, nil, nil},
+		handler.FuncCache(true), handler.CacheTTL(time.Hour), handler.CacheMaxEntries(2),
+	)
+
+	steps := []struct {
+		name       string
+		wait       time.Duration // time to wait before the query
+		invalidate string        // field to invalidate before the query
+		query      string
+		expected   interface{}
+	}{
+		{"Miss", 0, "", "{ i(a:1) }", JsonObject{"i": 1.0}},
+		{"Hit", 0, "", "{ i(a:1) }", JsonObject{"i": 1.0}},
+		{"Miss2", 0, "", "{ i(a:2) }", JsonObject{"i": 2.0}},
+		{"Use1", 0, "", "{ i(a:1) }", JsonObject{"i": 1.0}},   // a:1 is now the most recently used
+		{"Evict2", 0, "", "{ i(a:3) }", JsonObject{"i": 3.0}}, // evicts a:2
+		{"Kept1", 0, "", "{ i(a:1) }", JsonObject{"i": 1.0}},
+		{"Evicted2", 0, "", "{ i(a:2) }", JsonObject{"i": 4.0}},
+		{"FieldTTL", 0, "", "{ j(a:1) }", JsonObject{"j": 5.0}},
+		{"Fresh", 0, "", "{ j(a:1) }", JsonObject{"j": 5.0}},
+		{"Expired", 100 * time.Millisecond, "", "{ j(a:1) }", JsonObject{"j": 6.0}},
+		{"Invalidate", 0, "i", "{ i(a:1) }", JsonObject{"i": 7.0}},
+		{"NotInvalidated", 0, "i", "{ j(a:1) }", JsonObject{"j": 6.0}},
+	}
+	for _, step := range steps {
+		time.Sleep(step.wait)
+		if step.invalidate != "" {
+			h.(*handler.Handler).InvalidateCache("Query", step.invalidate)
+		}
+		data, errs := doRequest(t, h, `{"query":"`+step.query+`"}`)
+		Assertf(t, errs == nil, "%-14s: expected no errors got %v", step.name, errs)
+		Assertf(t, reflect.DeepEqual(data, step.expected), "%-14s: expected %v got %v", step.name, step.expected, data)
+	}
+}
+
+// mapBackend is a cache backend (see handler.SharedCache) for testing
+type mapBackend struct {
+	mtx    sync.Mutex
+	values map[string][]byte
+	ttl    map[string]time.Duration
+}
+
+func (b *mapBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	value, ok := b.values[key]
+	return value, ok, nil
+}
+
+func (b *mapBackend) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.values[key], b.ttl[key] = value, ttl
+	return nil
+}
+
+func (b *mapBackend) Delete(_ context.Context, key string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.values, key)
+	return nil
+}
+
+// TestSharedCache checks that two handlers share cached values using a cache backend
+func TestSharedCache(t *testing.T) {
+	type Obj struct {
+		B, A int
+	}
+	var next int32
+	getNext := func(int) int { return int(atomic.AddInt32(&next, 1)) }
+	getObj := func() Obj { return Obj{B: int(atomic.AddInt32(&next, 1)), A: 0} }
+	backend := &mapBackend{values: make(map[string][]byte), ttl: make(map[string]time.Duration)}
+	newHandler := func() http.Handler {
+		return handler.New([]string{"type Query { i(a: Int!): Int! o: Obj! } type Obj { b: Int! a: Int! }"}, nil,
+			[3][]interface{}{{struct {
+				I func(int) int `egg:"(a)"`
+				O func() Obj
+			}{I: getNext, O: getObj}}, nil, nil},
+			handler.FuncCache(true), handler.CacheTTL(time.Minute), handler.SharedCache(backend),
+		)
+	}
+	h1, h2 := newHandler(), newHandler()
+
+	steps := []struct {
+		name       string
+		h          http.Handler
+		invalidate bool // invalidate the i field (of h1) before the query
+		query      string
+		expected   string // JSON of the data so that the order of fields is checked
+	}{
+		{"Miss", h1, false, "{ i(a:1) }", `{"i":1}`},
+		{"Hit", h1, false, "{ i(a:1) }", `{"i":1}`},
+		{"Shared", h2, false, "{ i(a:1) }", `{"i":1}`},
+		{"Args", h2, false, "{ i(a:2) }", `{"i":2}`},
+		{"Object", h1, false, "{ o { b a } }", `{"o":{"b":3,"a":0}}`},
+		{"ObjectShared", h2, false, "{ o { b a } }", `{"o":{"b":3,"a":0}}`},
+		{"Invalidate", h1, true, "{ i(a:1) }", `{"i":4}`},
+		{"OtherKept", h2, false, "{ i(a:2) }", `{"i":2}`}, // only values saved by h1 are invalidated
+	}
+	for _, step := range steps {
+		if step.invalidate {
+			h1.(*handler.Handler).InvalidateCache("Query", "i")
+		}
+		request := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"`+step.query+`"}`))
+		request.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		step.h.ServeHTTP(w, request)
+		var result struct {
+			Data   json.RawMessage
+			Errors []interface{}
+		}
+		Assertf(t, json.Unmarshal(w.Body.Bytes(), &result) == nil, "%-16s: error decoding %s", step.name, w.Body)
+		Assertf(t, result.Errors == nil, "%-16s: expected no errors got %v", step.name, result.Errors)
+		Assertf(t, string(result.Data) == step.expected, "%-16s: expected %s got %s", step.name, step.expected,
+			result.Data)
+	}
+	for key, ttl := range backend.ttl {
+		Assertf(t, ttl == time.Minute, "expected TTL of %q to be 1m got %v", key, ttl)
+	}
+}
+
+// TestElementCache checks that the resolvers of list elements are cached, for each element and arguments, while
+// the request runs
+func TestElementCache(t *testing.T) {
+	type Elem struct {
+		Name  string
+		Score func(int) int `egg:"(a)"`
+	}
+	var calls int32
+	newElem := func(name string) Elem {
+		return Elem{Name: name, Score: func(a int) int { atomic.AddInt32(&calls, 1); return len(name) * a }}
+	}
+	queryData := struct {
+		List  []Elem
+		List2 []Elem
+		Map   map[string]Elem
+	}{
+		List:  []Elem{newElem("a"), newElem("bb")},
+		List2: []Elem{newElem("eeeee"), newElem("ffffff")},
+		Map:   map[string]Elem{"x": newElem("ccc"), "y": newElem("dddd")},
+	}
+	h := handler.New([]string{`type Query { list: [Elem!]! list2: [Elem!]! map: [Elem!]! }
+		type Elem { name: String! score(a: Int!): Int! }`}, nil,
+		[3][]interface{}{{queryData}, nil, nil},
+		handler.FuncCache(true),
+		handler.NoConcurrency(true), // so that x is cached before y is resolved
+	)
+
+	list := func(scores ...float64) []interface{} {
+		r := make([]interface{}, len(scores))
+		for i, score := range scores {
+			r[i] = JsonObject{"score": score}
+		}
+		return r
+	}
+	steps := []struct {
+		name     string
+		query    string
+		expected interface{}
+		calls    int32 // number of resolver calls expected
+	}{
+		{"List", "{ x:list { score(a:1) } y:list { score(a:1) } }", JsonObject{"x": list(1, 2), "y": list(1, 2)}, 2},
+		{"NextRequest", "{ x:list { score(a:1) } }", JsonObject{"x": list(1, 2)}, 2}, // not kept after the request
+		{"ListArgs", "{ x:list { score(a:1) } y:list { score(a:2) } }", JsonObject{"x": list(1, 2), "y": list(2, 4)}, 4},
+		{"DiffList", "{ x:list { score(a:1) } y:list2 { score(a:1) } }", JsonObject{"x": list(1, 2), "y": list(5, 6)}, 4},
+		{"Map", "{ x:map { score(a:1) } y:map { score(a:1) } }", JsonObject{"x": list(3, 4), "y": list(3, 4)}, 2},
+	}
+	for _, step := range steps {
+		atomic.StoreInt32(&calls, 0)
+		data, errs := doRequest(t, h, `{"query":"`+step.query+`"}`)
+		Assertf(t, errs == nil, "%-12s: expected no errors got %v", step.name, errs)
+		Assertf(t, reflect.DeepEqual(data, step.expected), "%-12s: expected %v got %v", step.name, step.expected, data)
+		Assertf(t, atomic.LoadInt32(&calls) == step.calls, "%-12s: expected %d calls got %d", step.name, step.calls,
+			atomic.LoadInt32(&calls))
+	}
+}
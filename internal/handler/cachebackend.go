@@ -0,0 +1,171 @@
+package handler
+
+// cachebackend.go allows the cached values of resolvers to be kept in an external cache (see CacheBackend and the
+// SharedCache option), such as Redis or memcached, so that they are shared by multiple instances of a server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/dolmen-go/jsonmap"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type (
+	// CacheBackend stores cached values of resolvers outside the process.  A value is the JSON encoding of the
+	// result of a field, and the key is made from the type and name of the field, the path in the results of the
+	// object it belongs to, and its arguments.  Get returns false (and no error) if the key is not found.
+	CacheBackend interface {
+		Get(ctx context.Context, key string) ([]byte, bool, error)
+		Set(ctx context.Context, key string, value []byte, ttl time.Duration) error // ttl is zero for no expiry
+		Delete(ctx context.Context, key string) error
+	}
+
+	// sharedCache is the part of a ResolverCache used when values are kept in a CacheBackend.
+	// Note that keys is protected by the mutex of the ResolverCache.
+	sharedCache struct {
+		backend CacheBackend
+		keys    map[string]struct{} // keys of values saved by this handler (see InvalidateCache)
+	}
+)
+
+// newSharedCache returns the shared part of a resolver's cache or nil if there is no cache backend
+func (h *Handler) newSharedCache() *sharedCache {
+	if h.cacheBackend == nil {
+		return nil
+	}
+	return &sharedCache{backend: h.cacheBackend, keys: make(map[string]struct{})}
+}
+
+// resolveShared resolves a field whose values are cached in the cache backend, returning the cached value if found
+func (op *gqlOperation) resolveShared(ctx context.Context, astField *ast.Field, v, vID reflect.Value,
+	fieldInfo *field.Info, cache ResolverCache,
+) *gqlValue {
+	key := backendKey(ctx, astField, op.variables)
+	if b, ok, err := cache.shared.backend.Get(ctx, key); err != nil {
+		log.Printf("eggql: error getting %q from cache backend: %v", logKey(key), err)
+	} else if ok {
+		if value, err := decodeCached(b); err == nil {
+			cache.stats.hit()
+			op.cacheCounts.hit()
+			return &gqlValue{name: astField.Alias, value: value}
+		}
+	}
+	cache.stats.miss()
+	op.cacheCounts.miss()
+
+	retval := op.resolve(ctx, astField, v, vID, fieldInfo, ResolverCache{})
+	if retval == nil || retval.err != nil || retval.value == nil {
+		return retval
+	}
+	b, err := json.Marshal(retval.value)
+	if err != nil {
+		return retval // can't be cached (eg a channel)
+	}
+	var ttl time.Duration
+	if cache.limits != nil {
+		ttl = cache.limits.ttl
+	}
+	if err := cache.shared.backend.Set(ctx, key, b, ttl); err != nil {
+		log.Printf("eggql: error saving %q in cache backend: %v", logKey(key), err)
+		return retval
+	}
+	cache.Mtx.Lock()
+	cache.shared.keys[key] = struct{}{}
+	cache.Mtx.Unlock()
+	return retval
+}
+
+// clear deletes the values saved in the cache backend (with the cache's mutex locked), returning how many
+func (sc *sharedCache) clear() int {
+	n := 0
+	for key := range sc.keys {
+		if err := sc.backend.Delete(context.Background(), key); err != nil {
+			log.Printf("eggql: error deleting %q from cache backend: %v", logKey(key), err)
+			continue
+		}
+		delete(sc.keys, key)
+		n++
+	}
+	return n
+}
+
+// backendKey returns the key of a field's value in the cache backend.  As well as the field and its arguments it
+// includes the path of the object containing the field since different objects of the same type have different
+// values.
+func backendKey(ctx context.Context, astField *ast.Field, variables map[string]interface{}) string {
+	var sb strings.Builder
+	sb.WriteString("eggql:")
+	if astField.ObjectDefinition != nil {
+		sb.WriteString(astField.ObjectDefinition.Name)
+		sb.WriteByte('.')
+	}
+	sb.WriteString(astField.Name)
+	sb.WriteByte(0)
+	sb.WriteString(getPath(ctx).String())
+	sb.WriteByte(0)
+	sb.WriteString(argsKey(astField.Arguments, variables))
+	return sb.String()
+}
+
+// logKey returns a key of the cache backend without the field's arguments, which may be secret, for logging
+func logKey(key string) string {
+	if i := strings.LastIndexByte(key, 0); i > -1 {
+		return key[:i]
+	}
+	return key
+}
+
+// decodeCached decodes a value from the cache backend, keeping the order of the fields of objects
+func decodeCached(b []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decodeValue(decoder)
+}
+
+// decodeValue decodes the next JSON value, where objects are decoded as a jsonmap.Ordered
+func decodeValue(decoder *json.Decoder) (interface{}, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		r := jsonmap.Ordered{Data: make(map[string]interface{})}
+		for decoder.More() {
+			tok, err = decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := tok.(string)
+			if !ok {
+				return nil, errors.New("object key expected")
+			}
+			if r.Data[name], err = decodeValue(decoder); err != nil {
+				return nil, err
+			}
+			r.Order = append(r.Order, name)
+		}
+		_, err = decoder.Token() // closing brace
+		return r, err
+	case json.Delim('['):
+		r := []interface{}{}
+		for decoder.More() {
+			value, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, value)
+		}
+		_, err = decoder.Token() // closing bracket
+		return r, err
+	}
+	return tok, nil
+}
@@ -0,0 +1,163 @@
+package handler
+
+// cachelimits.go limits how long values are kept in a resolver cache (see CacheTTL option and the "cache" tag
+// option, eg `egg:",cache=30s"`) and how many values are kept (see CacheMaxEntries) by evicting the least recently
+// used, and allows cached values to be removed (see InvalidateCache), eg when a mutation changes the data
+
+import (
+	"container/list"
+	"reflect"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type (
+	// cacheLimits records when each value of a resolver cache was saved and the order they were used in.
+	// Note that it is protected by the mutex of the ResolverCache.
+	cacheLimits struct {
+		ttl        time.Duration // if not zero, values are not used after this time
+		maxEntries int           // if not zero, the least recently used values are evicted to keep this many
+		entries    map[CacheKey]*list.Element
+		lru        *list.List // of *cacheEntry with the most recently used at the front
+	}
+
+	// cacheEntry is when a value was saved in a cache
+	cacheEntry struct {
+		key   CacheKey
+		saved time.Time
+	}
+)
+
+// newCacheLimits returns the limits of a resolver's cache, or nil if its values are kept forever
+func (h *Handler) newCacheLimits(fieldInfo *field.Info) *cacheLimits {
+	ttl := h.cacheTTL
+	if fieldInfo.CacheTTL > 0 {
+		ttl = fieldInfo.CacheTTL
+	}
+	if ttl <= 0 && h.cacheMaxEntries <= 0 {
+		return nil
+	}
+	return &cacheLimits{ttl: ttl, maxEntries: h.cacheMaxEntries, entries: make(map[CacheKey]*list.Element),
+		lru: list.New()}
+}
+
+// scoped returns an empty cacheLimits with the same settings, for an operation's own (scoped) caches
+func (cl *cacheLimits) scoped() *cacheLimits {
+	if cl == nil {
+		return nil
+	}
+	return &cacheLimits{ttl: cl.ttl, maxEntries: cl.maxEntries, entries: make(map[CacheKey]*list.Element),
+		lru: list.New()}
+}
+
+// check is called (with the cache's mutex locked) when a value is found in the cache.  It returns false (and
+// removes the value from the cache) if the value has expired, otherwise it marks the value as recently used.
+func (cache ResolverCache) check(key CacheKey) bool {
+	cl := cache.limits
+	if cl == nil {
+		return true
+	}
+	elem, ok := cl.entries[key]
+	if !ok {
+		return true // not tracked (should not happen) so just use it
+	}
+	if cl.ttl > 0 && time.Since(elem.Value.(*cacheEntry).saved) > cl.ttl {
+		cache.remove(key)
+		return false
+	}
+	cl.lru.MoveToFront(elem)
+	return true
+}
+
+// save saves a value in the cache (with the cache's mutex locked), evicting the least recently used values if
+// the cache is full
+func (cache ResolverCache) save(key CacheKey, value reflect.Value) {
+	cache.Saved[key] = value
+	cache.swr.save(key)
+	cl := cache.limits
+	if cl == nil {
+		return
+	}
+	if elem, ok := cl.entries[key]; ok {
+		elem.Value.(*cacheEntry).saved = time.Now()
+		cl.lru.MoveToFront(elem)
+	} else {
+		cl.entries[key] = cl.lru.PushFront(&cacheEntry{key: key, saved: time.Now()})
+	}
+	for cl.maxEntries > 0 && cl.lru.Len() > cl.maxEntries {
+		cache.remove(cl.lru.Back().Value.(*cacheEntry).key)
+	}
+}
+
+// remove removes a value from the cache (with the cache's mutex locked)
+func (cache ResolverCache) remove(key CacheKey) {
+	delete(cache.Saved, key)
+	if cache.swr != nil {
+		delete(cache.swr.saved, key)
+	}
+	if cl := cache.limits; cl != nil {
+		if elem, ok := cl.entries[key]; ok {
+			cl.lru.Remove(elem)
+			delete(cl.entries, key)
+		}
+	}
+}
+
+// clear removes all values from the cache, returning how many were removed
+func (cache ResolverCache) clear() int {
+	cache.Mtx.Lock()
+	defer cache.Mtx.Unlock()
+	n := len(cache.Saved)
+	for key := range cache.Saved {
+		cache.remove(key)
+	}
+	if cache.shared != nil {
+		n += cache.shared.clear()
+	}
+	return n
+}
+
+// InvalidateCache removes the cached values of resolvers, eg after a mutation has changed the data they return.
+// typeName is the GraphQL type (eg "Query" or "Character") and fieldName the field, but either may be empty to
+// match any type or field.  It returns the number of values removed.  Note that values cached by running
+// subscriptions (which have their own caches) are not affected, and if there is a cache backend (see SharedCache)
+// only the values saved by this handler are deleted from it.
+func (h *Handler) InvalidateCache(typeName, fieldName string) int {
+	n := 0
+	for t, lookup := range h.resolverLookup {
+		if typeName != "" && !h.isTypeName(t, typeName) {
+			continue
+		}
+		for name, data := range lookup {
+			if data.Cache.Saved != nil && (fieldName == "" || name == fieldName) {
+				n += data.Cache.clear()
+			}
+		}
+	}
+	return n
+}
+
+// isTypeName checks if the GraphQL name of a struct type is typeName, where the (possibly anonymous) structs of the
+// root query, mutation and subscription have the names of the root types in the schema
+func (h *Handler) isTypeName(t reflect.Type, typeName string) bool {
+	if field.TypeName(t) == typeName {
+		return true
+	}
+	roots := []struct {
+		data       []interface{}
+		definition *ast.Definition
+	}{{h.qData, h.schema.Query}, {h.mData, h.schema.Mutation}, {h.subscriptionData, h.schema.Subscription}}
+	for _, root := range roots {
+		if root.definition == nil || root.definition.Name != typeName {
+			continue
+		}
+		for _, v := range root.data {
+			if v != nil && structType(reflect.TypeOf(v)) == t {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package handler
+
+// cachestats.go counts cache hits and misses (for each resolver and for each operation) and reports statistics
+// about the resolver caches, so that it can be seen whether caching (eg the FuncCache option) is worthwhile
+
+import (
+	"reflect"
+	"sort"
+	"sync/atomic"
+)
+
+type (
+	// CacheStat has statistics of the cache of one resolver - see Handler.CacheStats
+	CacheStat struct {
+		Type    string // Go type of the struct containing the resolver, eg "main.Query"
+		Field   string // GraphQL name of the resolver (field)
+		Hits    int64  // number of times a value was found in the cache
+		Misses  int64  // number of times a value was not found in the cache (so the resolver was called)
+		Entries int    // number of values in the cache (excludes values cached by running subscriptions)
+		Size    int64  // estimate of the memory used by the cached values in bytes (excludes shared memory)
+	}
+
+	// cacheCounts counts cache hits and misses.  Note that the counts must be the first fields (to be 64-bit
+	// aligned for atomic access) so a cacheCounts should be allocated on its own (not embedded in another struct).
+	cacheCounts struct {
+		hits, misses int64
+	}
+)
+
+// hit counts a cache hit - it does nothing if cc is nil
+func (cc *cacheCounts) hit() {
+	if cc != nil {
+		atomic.AddInt64(&cc.hits, 1)
+	}
+}
+
+// miss counts a cache miss - it does nothing if cc is nil
+func (cc *cacheCounts) miss() {
+	if cc != nil {
+		atomic.AddInt64(&cc.misses, 1)
+	}
+}
+
+// get returns the current counts
+func (cc *cacheCounts) get() (hits, misses int64) {
+	if cc == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&cc.hits), atomic.LoadInt64(&cc.misses)
+}
+
+// CacheStats returns statistics for the cache of every resolver that has one (eg when the FuncCache option is on,
+// or the field has a @cacheControl directive) sorted by type and field name.  Hits and misses include the use
+// of caches by subscriptions, which have their own caches that are released when the subscription ends.
+func (h *Handler) CacheStats() []CacheStat {
+	var r []CacheStat
+	for t, lookup := range h.resolverLookup {
+		for name, data := range lookup {
+			cache := data.Cache
+			if cache.Saved == nil {
+				continue
+			}
+			stat := CacheStat{Type: t.String(), Field: name}
+			stat.Hits, stat.Misses = cache.stats.get()
+			seen := make(map[uintptr]bool)
+			cache.Mtx.Lock()
+			stat.Entries = len(cache.Saved)
+			for key, value := range cache.Saved {
+				stat.Size += int64(len(key.args)) + sizeOf(value, seen)
+			}
+			cache.Mtx.Unlock()
+			r = append(r, stat)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Type != r[j].Type {
+			return r[i].Type < r[j].Type
+		}
+		return r[i].Field < r[j].Field
+	})
+	return r
+}
+
+// sizeOf estimates the memory used by a value (including memory it refers to).  Memory referred to by pointers
+// that have already been seen is not included again.
+func sizeOf(v reflect.Value, seen map[uintptr]bool) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	return int64(v.Type().Size()) + indirectSize(v, seen)
+}
+
+// indirectSize estimates the memory referred to by a value (not including the value itself)
+func indirectSize(v reflect.Value, seen map[uintptr]bool) (r int64) {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		if v.Kind() == reflect.Ptr {
+			if seen[v.Pointer()] {
+				return 0
+			}
+			seen[v.Pointer()] = true
+		}
+		return sizeOf(v.Elem(), seen)
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		r = int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			r += indirectSize(v.Index(i), seen)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			r += indirectSize(v.Index(i), seen)
+		}
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		iter := v.MapRange()
+		for iter.Next() {
+			r += sizeOf(iter.Key(), seen) + sizeOf(iter.Value(), seen)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			r += indirectSize(v.Field(i), seen)
+		}
+	}
+	return r
+}
@@ -8,8 +8,8 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
-	"unicode"
-	"unicode/utf8"
+	"strings"
+	"time"
 
 	"github.com/andrewwphillips/eggql/internal/field"
 	"github.com/vektah/gqlparser/v2/ast"
@@ -24,7 +24,7 @@ import (
 func (op *gqlOperation) fromFunc(ctx context.Context, astField *ast.Field, v reflect.Value, fieldInfo *field.Info,
 ) (vReturn reflect.Value, err error) {
 	if v.IsNil() {
-		if !op.nilResolver {
+		if !op.nilResolver && !fieldInfo.OptionalFunc {
 			err = fmt.Errorf("function for %q is not implemented (nil)", astField.Name)
 		}
 		return
@@ -34,6 +34,9 @@ func (op *gqlOperation) fromFunc(ctx context.Context, astField *ast.Field, v ref
 	foundArgs := 0                                  // to ensure the
 
 	if fieldInfo.HasContext {
+		if len(fieldInfo.Args) > 0 && fieldInfo.Subscript == "" {
+			ctx = withArgsProvided(ctx, astField, op.variables) // see ArgsProvided
+		}
 		args[baseArg] = reflect.ValueOf(ctx)
 		baseArg++ // we're now expecting one less value in params/defaults lists
 		foundArgs++
@@ -48,14 +51,15 @@ func (op *gqlOperation) fromFunc(ctx context.Context, astField *ast.Field, v ref
 			for paramNum, paramName := range fieldInfo.Args {
 				if paramName == argument.Name {
 					if n != -1 {
-						// Note this is a BUG not an "error" as it should have been caught by validator
-						panic("argument specified more than once: " + argument.Name + " in " + astField.Name)
+						// This should have been caught by the validator (or when the resolver args were read from the tag)
+						err = argsMismatch(astField, fieldInfo, "argument %q is listed more than once", argument.Name)
+						return
 					}
 					n = paramNum
 				}
 			}
-			if n == -1 {
-				err = fmt.Errorf("unknown argument %q in resolver %q", argument.Name, astField.Name)
+			if n == -1 || baseArg+n >= len(args) {
+				err = argsMismatch(astField, fieldInfo, "unknown argument %q", argument.Name)
 				return
 			}
 
@@ -69,7 +73,7 @@ func (op *gqlOperation) fromFunc(ctx context.Context, astField *ast.Field, v ref
 			}
 
 			// Now convert the "raw" value into the expected Go parameter type
-			if args[baseArg+n], err = op.getValue(v.Type().In(baseArg+n), argument.Name, fieldInfo.ArgTypes[n], rawValue); err != nil {
+			if args[baseArg+n], err = op.getValue(v.Type().In(baseArg+n), argument.Name, argType(fieldInfo, n), rawValue); err != nil {
 				return
 			}
 			foundArgs++
@@ -79,34 +83,36 @@ func (op *gqlOperation) fromFunc(ctx context.Context, astField *ast.Field, v ref
 		for argNum, arg := range args {
 			// if the argument has not yet been set
 			if !arg.IsValid() {
+				if argNum-baseArg >= len(fieldInfo.Args) {
+					err = argsMismatch(astField, fieldInfo, "resolver function has %d parameters but %d args are listed",
+						len(args)-baseArg, len(fieldInfo.Args))
+					return
+				}
 				// Find the arg in the field definition and get the default value
 				// (which should come from the text of fieldInfo.ArgDefaults[argNum-baseArg])
-				ok := false
-				for _, defArg := range astField.Definition.Arguments {
-					if defArg.Name == fieldInfo.Args[argNum-baseArg] {
-						tmp, err := defArg.DefaultValue.Value(op.variables)
-						if err != nil {
-							panic(err)
-						}
-						args[argNum], err = op.getValue(v.Type().In(argNum), defArg.Name, fieldInfo.ArgTypes[argNum-baseArg], tmp)
-						if err != nil {
-							panic(err)
-						}
-						foundArgs++
-						ok = true
-						break
-					}
+				name := fieldInfo.Args[argNum-baseArg]
+				defArg := astField.Definition.Arguments.ForName(name)
+				if defArg == nil {
+					err = argsMismatch(astField, fieldInfo, "argument %q is not in the schema so has no default value", name)
+					return
+				}
+				var tmp interface{}
+				if tmp, err = defArg.DefaultValue.Value(op.variables); err != nil {
+					err = argsMismatch(astField, fieldInfo, "default value of argument %q is invalid: %v", name, err)
+					return
 				}
-				if !ok {
-					panic("default not found for " + fieldInfo.Args[argNum-baseArg])
+				if args[argNum], err = op.getValue(v.Type().In(argNum), name, argType(fieldInfo, argNum-baseArg), tmp); err != nil {
+					err = argsMismatch(astField, fieldInfo, "default value of argument %q: %v", name, err)
+					return
 				}
+				foundArgs++
 			}
 		}
 	}
 	// Check that we got the correct numbers of parameters
 	if foundArgs != len(args) {
 		// This should only be possible if there is a bug in schema generation
-		err = fmt.Errorf("found %d args but expecting %d for resolver %q", foundArgs, len(args), astField.Name)
+		err = argsMismatch(astField, fieldInfo, "found %d args but expecting %d", foundArgs, len(args))
 		return
 	}
 
@@ -132,6 +138,29 @@ func (op *gqlOperation) fromFunc(ctx context.Context, astField *ast.Field, v ref
 	return out[0], err
 }
 
+// argsMismatch returns an error for when the arguments of a query (and the schema) do not match the resolver's
+// args (from the tag), giving the resolver name, the args it expects and the args received in the query
+func argsMismatch(astField *ast.Field, fieldInfo *field.Info, format string, a ...interface{}) error {
+	name := astField.Name
+	if astField.ObjectDefinition != nil {
+		name = astField.ObjectDefinition.Name + "." + name
+	}
+	received := make([]string, 0, len(astField.Arguments))
+	for _, argument := range astField.Arguments {
+		received = append(received, argument.Name)
+	}
+	return fmt.Errorf("%s in resolver %q (expected args: (%s), received: (%s))", fmt.Sprintf(format, a...),
+		name, strings.Join(fieldInfo.Args, ", "), strings.Join(received, ", "))
+}
+
+// argType returns the type name (if any) given in the tag for a resolver argument
+func argType(fieldInfo *field.Info, n int) string {
+	if n < len(fieldInfo.ArgTypes) {
+		return fieldInfo.ArgTypes[n]
+	}
+	return ""
+}
+
 // getValue returns a value (eg for a resolver argument) given an interface{} and an expected Go type
 // Parameters:
 //   t = expected type
@@ -145,14 +174,40 @@ func (op *gqlOperation) getValue(t reflect.Type, name string, typeName string, v
 		return reflect.ValueOf(reflect.New(t).Elem().Interface()), nil
 	}
 
-	deref := false // keeps tracks of whether we're returning the value or a reference (ptr) to it
+	// A pointer is handled by getting the value pointed to then taking its address, so that all types
+	// (custom scalars, IDs, enums, etc) are decoded the same way whether or not they are nullable
 	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-		deref = true
+		v, err := op.getValue(t.Elem(), name, typeName, value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	}
+
+	// A time.Time is a DateTime scalar which is decoded from an RFC 3339 string
+	if t == field.TimeType {
+		return op.getDateTime(name, value)
+	}
+
+	// It's a custom scalar if the type implements field.Unmarshaler - ie. has method t.UnmarshalEGGQL(string) error
+	// Note that this must be checked first as a custom scalar may be a struct (eg eggql.Time) or have an integer type
+	if reflect.PtrTo(t).Implements(field.UnmarshalerType) {
+		return op.getCustomScalar(t, name, value)
+	}
+
+	// IDs can be supplied as a String or an Int but must be converted to the Go type (string or integer)
+	if field.IsID(t) || baseTypeName(typeName) == "ID" {
+		return op.getID(t, name, value)
 	}
 
 	// If it's an enum we need to convert the enum name (string) to corresp. int
-	if typeName != "" && typeName != "ID" && t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64 {
+	if enumName, ok := field.EnumName(t); ok && typeName == "" {
+		typeName = enumName // Go enum type
+	}
+	if typeName != "" && t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64 {
+		typeName = strings.TrimSuffix(typeName, "!") // eg for the elements of a list of type [Unit!]
 		toFind, ok := value.(string)
 		if !ok {
 			return reflect.Value{}, fmt.Errorf("getting enum (%s) for %q expected string", typeName, name)
@@ -168,23 +223,9 @@ func (op *gqlOperation) getValue(t reflect.Type, name string, typeName string, v
 		return reflect.ValueOf(value), nil // no conversion necessary
 	}
 
-	// It's a custom scalar if the type it implements field.Unmarshaler - ie. has method t.UnmarshalEGGQL(string) error
-	if reflect.TypeOf(reflect.New(t).Interface()).Implements(reflect.TypeOf((*field.Unmarshaler)(nil)).Elem()) {
-		in, ok := value.(string)
-		if !ok {
-			in = fmt.Sprintf("%v", value)
-		}
-		out := reflect.New(t).Interface().(field.Unmarshaler) // where to decode into (ptr)
-		if err := out.UnmarshalEGGQL(in); err != nil {
-			return reflect.Value{}, fmt.Errorf("%w unmarshaling custom scalar %q", err, value.(string))
-		}
-		if deref {
-			return reflect.ValueOf(out), nil // return pointer to the new value
-		}
-		return reflect.ValueOf(out).Elem(), nil // return the actual value pointed to
-	}
-
 	// Try to convert the type of the variable to the expected type
+	var r reflect.Value
+	var err error
 	switch kind {
 	case reflect.Map:
 		// GraphQL "input" variables are decoded from JSON as a map[string]interface{} which we use to make
@@ -193,62 +234,146 @@ func (op *gqlOperation) getValue(t reflect.Type, name string, typeName string, v
 		if !ok {
 			return reflect.Value{}, fmt.Errorf("decoding %q - expected map[string] of interface{}", name)
 		}
-		return op.getStruct(t, name, m)
+		return op.getStruct(t, name, typeName, m)
 	case reflect.Slice:
 		list, ok := value.([]interface{})
 		if !ok {
 			return reflect.Value{}, fmt.Errorf("decoding variable %q - expected slice of interface{}", name)
 		}
+		typeName = strings.TrimSuffix(typeName, "!") // eg [Unit!]! is a non-null list
 		if len(typeName) > 2 && typeName[0] == '[' && typeName[len(typeName)-1] == ']' {
 			typeName = typeName[1 : len(typeName)-1]
 		}
 		return op.getList(t, name, typeName, list)
 	case reflect.String:
-		return op.getString(t, value.(string))
+		r, err = op.getString(t, value.(string))
 	case reflect.Int:
-		return op.getInt(t, int64(value.(int)))
+		r, err = op.getInt(t, int64(value.(int)))
 	case reflect.Int8:
-		return op.getInt(t, int64(value.(int8)))
+		r, err = op.getInt(t, int64(value.(int8)))
 	case reflect.Int16:
-		return op.getInt(t, int64(value.(int16)))
+		r, err = op.getInt(t, int64(value.(int16)))
 	case reflect.Int32:
-		return op.getInt(t, int64(value.(int32)))
+		r, err = op.getInt(t, int64(value.(int32)))
 	case reflect.Int64:
-		return op.getInt(t, value.(int64))
+		r, err = op.getInt(t, value.(int64))
 	case reflect.Uint:
-		return op.getInt(t, int64(value.(uint)))
+		r, err = op.getInt(t, int64(value.(uint)))
 	case reflect.Uint8:
-		return op.getInt(t, int64(value.(uint8)))
+		r, err = op.getInt(t, int64(value.(uint8)))
 	case reflect.Uint16:
-		return op.getInt(t, int64(value.(uint16)))
+		r, err = op.getInt(t, int64(value.(uint16)))
 	case reflect.Uint32:
-		return op.getInt(t, int64(value.(uint32)))
+		r, err = op.getInt(t, int64(value.(uint32)))
 	case reflect.Uint64:
-		return op.getInt(t, int64(value.(uint64)))
+		r, err = op.getInt(t, int64(value.(uint64)))
 	case reflect.Float32:
-		return op.getFloat(t, float64(value.(float32)))
+		r, err = op.getFloat(t, float64(value.(float32)))
 	case reflect.Float64:
-		return op.getFloat(t, value.(float64))
+		r, err = op.getFloat(t, value.(float64))
+	case reflect.Bool:
+		if t.Kind() != reflect.Bool {
+			return reflect.Value{}, fmt.Errorf("variable %q of type Boolean cannot be used for %v", name, t)
+		}
+		r = reflect.ValueOf(value)
 	default:
 		return reflect.Value{}, fmt.Errorf("variable %q is of unsupported type (kind %v)", name, kind.String())
 	}
+	if err == nil && r.Type() != t && r.Kind() == t.Kind() {
+		r = r.Convert(t) // eg an int to a named integer type
+	}
+	return r, err
+}
+
+// getCustomScalar decodes a custom scalar value by calling the UnmarshalEGGQL method of the type (t).
+// The value is normally a string but a scalar supplied as a number (eg a BigInt) is decoded from its text.
+func (op *gqlOperation) getCustomScalar(t reflect.Type, name string, value interface{}) (reflect.Value, error) {
+	var in string
+	switch v := value.(type) {
+	case string:
+		in = v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		in = fmt.Sprintf("%v", v)
+	default:
+		return reflect.Value{}, fmt.Errorf("custom scalar %q (%v) cannot be decoded from %T", name, t, value)
+	}
+	out := reflect.New(t).Interface().(field.Unmarshaler) // where to decode into (ptr)
+	if err := out.UnmarshalEGGQL(in); err != nil {
+		return reflect.Value{}, fmt.Errorf("%w unmarshaling custom scalar %q", err, in)
+	}
+	return reflect.ValueOf(out).Elem(), nil // return the actual value pointed to
+}
+
+// getDateTime decodes a DateTime value (string in the format of the DateTimeFormat option) into a time.Time
+func (op *gqlOperation) getDateTime(name string, value interface{}) (reflect.Value, error) {
+	in, ok := value.(string)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("DateTime %q cannot be decoded from %T", name, value)
+	}
+	t, err := time.Parse(op.dateTimeFormat, in)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("%w decoding DateTime %q", err, in)
+	}
+	return reflect.ValueOf(t), nil
+}
+
+// getID converts an ID value, which a client may supply as a String or an Int, into the Go type of the ID
+// A string type accepts any ID (Ints are converted to a string of digits) but an integer type requires
+// the value to be numeric.  If the handler has an ID pattern (see IDPattern option) the ID must match it.
+func (op *gqlOperation) getID(t reflect.Type, name string, value interface{}) (reflect.Value, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s = fmt.Sprintf("%d", v)
+	default:
+		return reflect.Value{}, fmt.Errorf("ID %q must be a String or an Int (not %T)", name, value)
+	}
+	if op.idPattern != nil && !op.idPattern.MatchString(s) {
+		return reflect.Value{}, fmt.Errorf("ID %q value %q does not match the ID pattern", name, s)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(s).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("ID %q value %q must be numeric", name, s)
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("ID %q value %q must be numeric", name, s)
+		}
+		return reflect.ValueOf(u).Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("ID %q must have a Go string or integer type (not %v)", name, t.Kind())
 }
 
 // getStruct converts a map (eg a from JSON decoder) to a struct including any nested structs, and slices
 // Parameters
 //  t = type of the struct that we need to fill in from the GraphQL object
 //  name = name of the argument
+//  typeName = GraphQL type name (if given in the tag) else it's the name of the Go type
 //  m = map key is field names of the object, map value is field values
-func (op *gqlOperation) getStruct(t reflect.Type, name string, m map[string]interface{}) (reflect.Value, error) {
+func (op *gqlOperation) getStruct(t reflect.Type, name string, typeName string, m map[string]interface{},
+) (reflect.Value, error) {
 	if t.Kind() != reflect.Struct {
 		return reflect.Value{}, fmt.Errorf("argument %q is not an GraphQL INPUT type", name)
 	}
+	if typeName = baseTypeName(typeName); typeName == "" {
+		typeName = field.TypeName(t)
+	}
+	def := op.schema.Types[typeName] // used for the default values of fields (if any)
 
 	// Create an instance of the struct and fill in the exported fields using m
 	r := reflect.New(t).Elem()
 	for idx := 0; idx < t.NumField(); idx++ {
 		tf := t.Field(idx)
-		fieldInfo, err2 := field.Get(&tf)
+		fieldInfo, err2 := field.Get(t, &tf)
 		if err2 != nil {
 			return reflect.Value{}, fmt.Errorf("%w getting field %q", err2, tf.Name)
 		}
@@ -256,21 +381,27 @@ func (op *gqlOperation) getStruct(t reflect.Type, name string, m map[string]inte
 			continue // ignore unexported field
 		}
 
-		first, n := utf8.DecodeRuneInString(fieldInfo.Name)
-		if first == utf8.RuneError {
-			return reflect.Value{}, fmt.Errorf("field %q of variable %q is not valid non-empty UTF8 string", fieldInfo.Name, name)
-		}
-		goField := r.FieldByName(string(unicode.ToUpper(first)) + fieldInfo.Name[n:])
-		if !goField.IsValid() {
-			return reflect.Value{}, fmt.Errorf("field %q of %q is not a field name of the GraphQL INPUT type", fieldInfo.Name, name)
+		goField := r.Field(idx) // Note: fieldInfo.Name may have come from the tag so is not necessarily the Go name
+		value, ok := m[fieldInfo.Name]
+		if !ok && def != nil && def.Kind == ast.InputObject {
+			// The field was omitted so use its default value (if any)
+			if fieldDef := def.Fields.ForName(fieldInfo.Name); fieldDef != nil && fieldDef.DefaultValue != nil {
+				if value, err2 = fieldDef.DefaultValue.Value(nil); err2 != nil {
+					return reflect.Value{}, fmt.Errorf("%w getting default value of field %q of %q", err2, fieldInfo.Name, name)
+				}
+			}
 		}
-		v, err := op.getValue(goField.Type(), fieldInfo.Name, fieldInfo.GQLTypeName, m[fieldInfo.Name])
+		v, err := op.getValue(goField.Type(), name+"."+fieldInfo.Name, fieldInfo.GQLTypeName, value)
 		if err != nil {
 			return reflect.Value{}, fmt.Errorf("converting field %q of %q: %w", fieldInfo.Name, name, err)
 		}
 
 		goField.Set(v)
 	}
+	// Check the values using the struct's Validate method (if any) - see Validator
+	if err := validateInput(r, name); err != nil {
+		return reflect.Value{}, err
+	}
 	return r, nil
 }
 
@@ -355,11 +486,7 @@ func (op *gqlOperation) getInt(t reflect.Type, i int64) (reflect.Value, error) {
 	case reflect.Float64:
 		return reflect.ValueOf(float64(i)), nil
 	case reflect.String:
-		s := strconv.FormatInt(i, 10)
-		if t.Name() == "ID" {
-			return reflect.ValueOf(field.ID(s)), nil
-		}
-		return reflect.ValueOf(s), nil
+		return reflect.ValueOf(strconv.FormatInt(i, 10)).Convert(t), nil
 	}
 	return reflect.Value{}, errors.New("TODO")
 }
@@ -434,10 +561,7 @@ func (op *gqlOperation) getString(t reflect.Type, s string) (reflect.Value, erro
 		floatValue, err := strconv.ParseFloat(s, 64)
 		return reflect.ValueOf(floatValue), err
 	case reflect.String:
-		if t.Name() == "ID" {
-			return reflect.ValueOf(field.ID(s)), nil
-		}
-		return reflect.ValueOf(s), nil
+		return reflect.ValueOf(s).Convert(t), nil
 	}
 
 	return reflect.Value{}, errors.New("unexpected type in getString") // TODO: check if we missed anything
@@ -0,0 +1,37 @@
+package handler
+
+// chaos.go has the types used for fault injection (see Chaos option) which is only compiled in when building with
+// the "chaos" build tag (see chaos_on.go), so that it can never be accidentally turned on in production builds
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// ChaosRule adds latency and/or errors to the resolvers of fields matching a pattern (see Chaos option)
+	ChaosRule struct {
+		// Pattern matches the GraphQL type and field name ("Type.field") using path.Match, eg "Query.*" or "*.name"
+		Pattern string
+		// Latency is added to each resolver call - a random duration up to Latency plus MinLatency
+		Latency, MinLatency time.Duration
+		// ErrorRate is the probability (0 to 1) that the resolver is not called and an error is returned instead
+		ErrorRate float64
+	}
+
+	// chaosKey is the context key for turning fault injection on or off for a request (see WithChaos)
+	chaosKey struct{}
+)
+
+// WithChaos returns a context that turns fault injection (see Chaos option) on or off for the resolvers that are
+// passed the context, eg to exclude requests from some clients.  If not set fault injection is on (if built with
+// the "chaos" build tag) so it is not usually necessary to turn it on.
+func WithChaos(ctx context.Context, on bool) context.Context {
+	return context.WithValue(ctx, chaosKey{}, on)
+}
+
+// chaosOn returns false if fault injection has been turned off for the context
+func chaosOn(ctx context.Context) bool {
+	on, ok := ctx.Value(chaosKey{}).(bool)
+	return on || !ok
+}
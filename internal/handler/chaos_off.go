@@ -0,0 +1,11 @@
+//go:build !chaos
+
+package handler
+
+// ChaosBuild is true if fault injection is compiled in (using the "chaos" build tag) so the Chaos option works
+const ChaosBuild = false
+
+// Chaos does nothing unless built with the "chaos" build tag (see chaos_on.go)
+func Chaos(rules ...ChaosRule) func(*Handler) {
+	return func(h *Handler) {}
+}
@@ -0,0 +1,63 @@
+//go:build chaos
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path"
+	"time"
+)
+
+// ChaosBuild is true if fault injection is compiled in (using the "chaos" build tag) so the Chaos option works
+const ChaosBuild = true
+
+// Chaos injects faults into resolvers for resilience testing, ie to check how clients cope with slow responses
+// and (partial) errors.  Each rule adds latency and/or errors to the resolvers of fields that match its pattern
+// (the first matching rule is used).  An injected error is an *Error with the code "CHAOS".  Fault injection can
+// be turned off for a request using WithChaos.  This option does nothing unless built with the "chaos" build tag.
+// It panics if a rule's pattern is malformed.
+func Chaos(rules ...ChaosRule) func(*Handler) {
+	if len(rules) == 0 {
+		return func(h *Handler) {}
+	}
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			panic(fmt.Sprintf("Chaos: invalid pattern %q: %v", rule.Pattern, err))
+		}
+	}
+	return ResolverMiddleware(func(ctx context.Context, info ResolverInfo, next Resolver) (interface{}, error) {
+		if !chaosOn(ctx) {
+			return next(ctx)
+		}
+		for _, rule := range rules {
+			if matched, _ := path.Match(rule.Pattern, info.TypeName+"."+info.FieldName); !matched {
+				continue
+			}
+			if delay := rule.delay(); delay > 0 {
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				}
+			}
+			if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+				return nil, &Error{Message: "chaos: injected error in " + info.Path, Code: "CHAOS"}
+			}
+			break
+		}
+		return next(ctx)
+	})
+}
+
+// delay returns the (random) latency to add to a resolver
+func (rule ChaosRule) delay() time.Duration {
+	delay := rule.MinLatency
+	if rule.Latency > 0 {
+		delay += time.Duration(rand.Int63n(int64(rule.Latency) + 1))
+	}
+	return delay
+}
@@ -0,0 +1,87 @@
+package handler
+
+// collect.go collects the fields of a selection set, including the fields of fragments, that apply to an object
+// so that each field of the results has its own (positional) slot when the fields are resolved (see GetSelections)
+
+import (
+	"reflect"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// maxLinearCollect is the number of fields after which a map is used to find fields with the same response name
+const maxLinearCollect = 16
+
+// collectFields returns the fields of a selection set, including the fields of fragments whose type condition
+// matches one of the structs (data), in the order they appear in the results (see CollectFields in the GraphQL
+// spec).  Fields with the same response name (alias) are merged into one field, by combining their selection
+// sets, and fields and fragments that are excluded by a @skip or @include directive are left out.
+func (op *gqlOperation) collectFields(set ast.SelectionSet, data []reflect.Value) []*ast.Field {
+	return op.collectMatching(set, func(typeCondition string) bool {
+		for _, v := range data {
+			if op.hasTypeCondition(v.Type(), typeCondition) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// collectMatching is like collectFields but uses matches to check if the type condition of a fragment applies
+func (op *gqlOperation) collectMatching(set ast.SelectionSet, matches func(typeCondition string) bool) []*ast.Field {
+	r := make([]*ast.Field, 0, len(set))
+	var index map[string]int // position in r of each response name (only used for large selection sets)
+	position := func(alias string) int {
+		if index != nil {
+			if i, ok := index[alias]; ok {
+				return i
+			}
+			return -1
+		}
+		for i, f := range r {
+			if f.Alias == alias {
+				return i
+			}
+		}
+		return -1
+	}
+	var collect func(set ast.SelectionSet)
+	collect = func(set ast.SelectionSet) {
+		for _, s := range set {
+			switch s := s.(type) {
+			case *ast.Field:
+				if op.directiveBypass(s.Directives) {
+					continue
+				}
+				if i := position(s.Alias); i > -1 {
+					if len(s.SelectionSet) > 0 {
+						merged := *r[i]
+						n := len(merged.SelectionSet)
+						merged.SelectionSet = append(merged.SelectionSet[:n:n], s.SelectionSet...)
+						r[i] = &merged
+					}
+					continue
+				}
+				r = append(r, s)
+				if index != nil {
+					index[s.Alias] = len(r) - 1
+				} else if len(r) > maxLinearCollect {
+					index = make(map[string]int, len(set))
+					for i, f := range r {
+						index[f.Alias] = i
+					}
+				}
+			case *ast.InlineFragment:
+				if !op.directiveBypass(s.Directives) && matches(s.TypeCondition) {
+					collect(s.SelectionSet)
+				}
+			case *ast.FragmentSpread:
+				if !op.directiveBypass(s.Directives) && matches(s.Definition.TypeCondition) {
+					collect(s.Definition.SelectionSet)
+				}
+			}
+		}
+	}
+	collect(set)
+	return r
+}
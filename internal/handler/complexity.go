@@ -0,0 +1,166 @@
+package handler
+
+// complexity.go estimates the complexity (cost) of an operation before it is executed so that operations that
+// are too expensive can be rejected (see MaxComplexity option).  Each field costs one plus the cost of its
+// sub-selections, but if the resolver has the "complexity" option, eg `egg:"posts(first),complexity(first)"`,
+// the cost is multiplied by the product of its factors (integers or the values of arguments).
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// maxCost is where complexity calculations stop increasing (to avoid overflow with huge argument values)
+const maxCost = 1 << 30
+
+// checkComplexity returns an error if the complexity of an operation exceeds the MaxComplexity option
+// where data are the struct(s) containing the resolvers of the operation's fields
+func (op *gqlOperation) checkComplexity(operation *ast.OperationDefinition, data []interface{}) *gqlerror.Error {
+	if op.maxComplexity <= 0 {
+		return nil
+	}
+	var types []reflect.Type
+	for _, v := range data {
+		if t := structType(reflect.TypeOf(v)); t != nil {
+			types = append(types, t)
+		}
+	}
+	cost := op.complexity(operation.SelectionSet, types)
+	if cost <= op.maxComplexity {
+		return nil
+	}
+	return &gqlerror.Error{
+		Message: fmt.Sprintf("operation complexity %d exceeds the limit of %d", cost, op.maxComplexity),
+		Extensions: map[string]interface{}{
+			"operation":     operation.Name,
+			"code":          "COMPLEXITY_LIMIT_EXCEEDED",
+			"complexity":    cost,
+			"maxComplexity": op.maxComplexity,
+		},
+	}
+}
+
+// complexity returns the estimated cost of resolving a selection set where types are the struct types that
+// contain the resolvers (or nil if not known, eg for fields returning a Go interface)
+func (op *gqlOperation) complexity(set ast.SelectionSet, types []reflect.Type) int {
+	cost := 0
+	for _, s := range set {
+		switch s := s.(type) {
+		case *ast.Field:
+			if op.directiveBypass(s.Directives) {
+				continue
+			}
+			data, childType := op.complexityLookup(types, s.Name)
+			var childTypes []reflect.Type
+			if childType != nil {
+				childTypes = []reflect.Type{childType}
+			}
+			factor, fieldCost := op.complexityFactor(s, data.Complexity), 1+op.complexity(s.SelectionSet, childTypes)
+			if factor > 0 && fieldCost > maxCost/factor {
+				return maxCost
+			}
+			cost += factor * fieldCost
+		case *ast.InlineFragment:
+			if !op.directiveBypass(s.Directives) {
+				cost += op.complexity(s.SelectionSet, types)
+			}
+		case *ast.FragmentSpread:
+			if !op.directiveBypass(s.Directives) {
+				cost += op.complexity(s.Definition.SelectionSet, types)
+			}
+		}
+		if cost > maxCost {
+			return maxCost
+		}
+	}
+	return cost
+}
+
+// complexityLookup finds the resolver of a field in one of the structs, returning its lookup data and the struct
+// type of its results (or nil if the resolver is not found or does not return struct(s))
+func (op *gqlOperation) complexityLookup(types []reflect.Type, name string) (ResolverData, reflect.Type) {
+	for _, t := range types {
+		data, ok := op.resolverLookup[t][name]
+		if !ok {
+			continue
+		}
+		tField := t.Field(data.Index)
+		if tField.Anonymous {
+			// promoted field of an embedded struct
+			if embedded := structType(tField.Type); embedded != nil {
+				if data2, ok := op.resolverLookup[embedded][name]; ok {
+					return data, structType(embedded.Field(data2.Index).Type)
+				}
+			}
+			return data, nil
+		}
+		return data, structType(tField.Type)
+	}
+	return ResolverData{}, nil
+}
+
+// complexityFactor returns the product of the factors of a "complexity" option for a field, where each factor is
+// an integer or the name of an argument (an argument that is null or not an integer is ignored)
+func (op *gqlOperation) complexityFactor(astField *ast.Field, factors []string) int {
+	if len(factors) == 0 {
+		return 1
+	}
+	var args map[string]interface{}
+	r := 1
+	for _, factor := range factors {
+		n, err := strconv.Atoi(factor)
+		if err != nil {
+			if args == nil {
+				args = astField.ArgumentMap(op.variables)
+			}
+			switch v := args[factor].(type) {
+			case int:
+				n = v
+			case int64:
+				n = int(v)
+			case float64:
+				n = int(v)
+			default:
+				continue
+			}
+		}
+		if n < 0 {
+			n = 0
+		}
+		if n > maxCost/(r+1) {
+			return maxCost
+		}
+		r *= n
+	}
+	return r
+}
+
+// structType returns the struct type of a resolver's results, by removing pointers, functions (return type) and
+// containers (element type), or nil if it's not a struct
+func structType(t reflect.Type) reflect.Type {
+	for t != nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+			t = t.Elem()
+		case reflect.Func:
+			if t.NumOut() == 0 {
+				return nil
+			}
+			t = t.Out(0)
+		case reflect.Struct:
+			if field.IsOrderedMap(t) {
+				t = field.ElemType(t)
+				continue
+			}
+			return t
+		default:
+			return nil
+		}
+	}
+	return nil
+}
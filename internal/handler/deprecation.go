@@ -0,0 +1,165 @@
+package handler
+
+// deprecation.go finds the deprecated fields and arguments used by an operation, so that HTTP responses can have
+// Deprecation and Sunset headers (see DeprecationHeaders option) and the uses can be counted for each client (see
+// DeprecationUsage option), passed to the observer (see Observer option) or sent to the audit sink, to help decide
+// when deprecated fields can be removed
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// DefaultMaxDeprecatedUses is the max. number of uses (name and client) counted if DeprecationUsageLimit is not used
+const DefaultMaxDeprecatedUses = 10000
+
+// otherClients is the client that uses are counted under once the max. number of uses are being counted
+const otherClients = "*"
+
+type (
+	// DeprecatedUse counts the operations of a client that used a deprecated field or argument - see
+	// Handler.DeprecatedUsage.  It is also passed to the observer (with a Count of 1) for each operation that
+	// uses a deprecated field or argument.
+	DeprecatedUse struct {
+		Name   string    // deprecated field (eg "Query.hero") or argument (eg "Query.hero(episode)")
+		Client string    // identifies the client (see RateLimitKey option)
+		Count  int64     // number of operations that used it
+		Last   time.Time // when it was last used
+	}
+
+	// deprecationUsage records the uses of deprecated fields and arguments by each client
+	deprecationUsage struct {
+		mtx  sync.Mutex
+		uses map[[2]string]*DeprecatedUse // keyed by name and client
+	}
+)
+
+// deprecatedUses returns the names of the deprecated fields and arguments used in an operation (each only once)
+func deprecatedUses(operation *ast.OperationDefinition) []string {
+	var r []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			r = append(r, name)
+		}
+	}
+	visited := make(map[*ast.FragmentDefinition]bool)
+	var walk func(set ast.SelectionSet)
+	walk = func(set ast.SelectionSet) {
+		for _, s := range set {
+			switch s := s.(type) {
+			case *ast.Field:
+				if s.Definition != nil && s.ObjectDefinition != nil {
+					name := s.ObjectDefinition.Name + "." + s.Name
+					if s.Definition.Directives.ForName("deprecated") != nil {
+						add(name)
+					}
+					for _, arg := range s.Arguments {
+						if def := s.Definition.Arguments.ForName(arg.Name); def != nil &&
+							def.Directives.ForName("deprecated") != nil {
+							add(name + "(" + arg.Name + ")")
+						}
+					}
+				}
+				walk(s.SelectionSet)
+			case *ast.InlineFragment:
+				walk(s.SelectionSet)
+			case *ast.FragmentSpread:
+				if s.Definition != nil && !visited[s.Definition] {
+					visited[s.Definition] = true
+					walk(s.Definition.SelectionSet)
+				}
+			}
+		}
+	}
+	walk(operation.SelectionSet)
+	return r
+}
+
+// checkDeprecated adds the Deprecation (and Sunset) headers to the HTTP response (see DeprecationHeaders option),
+// counts the uses by the client (see DeprecationUsage option) and passes them to the observer (if any), if the
+// operation uses anything deprecated
+func (h *Handler) checkDeprecated(ctx context.Context, operation *ast.OperationDefinition, clientKey string) {
+	if !h.deprecationHeaders && h.deprecationUsage == nil && h.observer == nil {
+		return
+	}
+	uses := deprecatedUses(operation)
+	if len(uses) == 0 {
+		return
+	}
+	if h.deprecationHeaders {
+		updateHeaders(ctx, func(header http.Header) {
+			if h.deprecatedSince.IsZero() {
+				header.Set("Deprecation", "true")
+			} else {
+				header.Set("Deprecation", "@"+strconv.FormatInt(h.deprecatedSince.Unix(), 10))
+			}
+			if !h.sunset.IsZero() {
+				header.Set("Sunset", h.sunset.UTC().Format(http.TimeFormat))
+			}
+		})
+	}
+	now := time.Now()
+	h.deprecationUsage.record(uses, clientKey, now, h.maxDeprecatedUses)
+	if h.observer != nil {
+		for _, name := range uses {
+			h.observe(DeprecatedUse{Name: name, Client: clientKey, Count: 1, Last: now})
+		}
+	}
+}
+
+// record counts the uses of deprecated fields and arguments by a client - it does nothing if du is nil.  Once
+// maxUses uses are being counted, uses by clients not already counted are counted under otherClients, so that the
+// table does not grow without limit if there are many clients.
+func (du *deprecationUsage) record(uses []string, clientKey string, now time.Time, maxUses int) {
+	if du == nil {
+		return
+	}
+	du.mtx.Lock()
+	defer du.mtx.Unlock()
+	for _, name := range uses {
+		key := [2]string{name, clientKey}
+		use, ok := du.uses[key]
+		if !ok && len(du.uses) >= maxUses {
+			key[1] = otherClients
+			use, ok = du.uses[key]
+		}
+		if !ok {
+			use = &DeprecatedUse{Name: name, Client: key[1]}
+			du.uses[key] = use
+		}
+		use.Count++
+		use.Last = now
+	}
+}
+
+// DeprecatedUsage returns how many operations of each client have used each deprecated field or argument, sorted
+// by name and client, or nil if the DeprecationUsage option is off.  If the limit on the number of uses counted
+// was reached (see DeprecationUsageLimit) then uses by other clients are counted under the client "*".  Note that a field is counted once per
+// operation however many times it appears in the operation.
+func (h *Handler) DeprecatedUsage() []DeprecatedUse {
+	du := h.deprecationUsage
+	if du == nil {
+		return nil
+	}
+	du.mtx.Lock()
+	r := make([]DeprecatedUse, 0, len(du.uses))
+	for _, use := range du.uses {
+		r = append(r, *use)
+	}
+	du.mtx.Unlock()
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Name != r[j].Name {
+			return r[i].Name < r[j].Name
+		}
+		return r[i].Client < r[j].Client
+	})
+	return r
+}
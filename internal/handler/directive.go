@@ -0,0 +1,83 @@
+package handler
+
+// directive.go handles directives when fields are resolved, using dispatch tables: the built-in directives that
+// exclude fields from the results (@skip/@include) and custom directives (see Directives option) which have a
+// function that is called around the resolving of a field that has the directive (in the schema or the query)
+
+import (
+	"context"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// DirectiveFunc is called when a field with a custom directive is resolved, with the directive's arguments, and
+// must call next to resolve the field (unless it returns an error or its own value instead).  It may also modify
+// the value returned by next (which is the value as it is encoded in the results), eg to upper-case a string.
+type DirectiveFunc func(ctx context.Context, args map[string]interface{}, next Resolver) (interface{}, error)
+
+// bypassDirectives is the dispatch table of the built-in directives that can exclude a field (or fragment) from
+// the results of a query - each returns true if the field is excluded
+var bypassDirectives = map[string]func(op *gqlOperation, d *ast.Directive) bool{
+	"skip": func(op *gqlOperation, d *ast.Directive) bool {
+		b, ok := op.ifArgument(d)
+		return ok && b
+	},
+	"include": func(op *gqlOperation, d *ast.Directive) bool {
+		b, ok := op.ifArgument(d)
+		return ok && !b
+	},
+}
+
+// directiveBypass handles field (or fragment) directives (see bypassDirectives) - just standard "skip" and "include"
+// Note that directives with literal arguments have already been handled (see foldDirectives).
+// Returns: true if a directive indicates the field is not to be processed
+func (op *gqlOperation) directiveBypass(directives ast.DirectiveList) bool {
+	for _, d := range directives {
+		if bypass, ok := bypassDirectives[d.Name]; ok && bypass(op, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifArgument returns the value of the "if" argument of a @skip or @include directive (ok is false if not found)
+func (op *gqlOperation) ifArgument(d *ast.Directive) (value, ok bool) {
+	for _, arg := range d.Arguments {
+		if arg.Name == "if" {
+			rawValue, err := arg.Value.Value(op.variables)
+			if err != nil {
+				panic(err)
+			}
+			value, ok = rawValue.(bool)
+			return
+		}
+	}
+	return
+}
+
+// directiveHook is a custom directive of a field and its arguments
+type directiveHook struct {
+	f    DirectiveFunc
+	args map[string]interface{}
+}
+
+// directiveHooks returns the custom directives (with a registered function) of a field, first those of the field
+// definition (schema) then those used in the query
+func (op *gqlOperation) directiveHooks(astField *ast.Field) (r []directiveHook) {
+	if len(op.directives) == 0 {
+		return nil
+	}
+	var lists [2]ast.DirectiveList
+	if astField.Definition != nil {
+		lists[0] = astField.Definition.Directives
+	}
+	lists[1] = astField.Directives
+	for _, list := range lists {
+		for _, d := range list {
+			if f, ok := op.directives[d.Name]; ok {
+				r = append(r, directiveHook{f: f, args: d.ArgumentMap(op.variables)})
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,281 @@
+package handler
+
+// docs.go generates documentation of a schema (types, fields, args, enum values, etc) as Markdown or HTML
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type (
+	// docSchema is the information used to generate the documentation (by the templates below)
+	docSchema struct {
+		Types      []docType
+		Directives []docDirective
+	}
+	docType struct {
+		Name, Kind, Description string
+		Interfaces, Members     []string // interfaces an object implements, or members of a union
+		Fields                  []docField
+		Values                  []docField // enum values (only Name, Description, Deprecated used)
+	}
+	docField struct {
+		Name, Type, Default, Description string
+		Directives                       string // directives (apart from @deprecated) as they appear in the schema
+		Deprecated                       string // deprecation reason or empty string if not deprecated
+		Args                             []docField
+	}
+	docDirective struct {
+		Name, Description, Locations string
+		Args                         []docField
+	}
+)
+
+// kindNames are the names used in the documentation for each kind of type
+var kindNames = map[ast.DefinitionKind]string{
+	ast.Scalar:      "scalar",
+	ast.Object:      "object",
+	ast.Interface:   "interface",
+	ast.Union:       "union",
+	ast.Enum:        "enum",
+	ast.InputObject: "input",
+}
+
+// Docs generates documentation of the types in the schema(s) - as Markdown, or as an HTML page if html is true
+func Docs(schemaStrings []string, html bool) (string, error) {
+	var sources []*ast.Source
+	for i, str := range schemaStrings {
+		sources = append(sources, &ast.Source{Name: "schema " + strconv.Itoa(i+1), Input: str})
+	}
+	schema, err := gqlparser.LoadSchema(sources...)
+	if err != nil {
+		return "", err
+	}
+	return docs(schema, html)
+}
+
+// docs generates the documentation for a (parsed) schema
+func docs(schema *ast.Schema, html bool) (string, error) {
+	builder := &strings.Builder{}
+	var err error
+	if html {
+		err = htmlDocsTemplate.Execute(builder, newDocSchema(schema))
+	} else {
+		err = markdownDocsTemplate.Execute(builder, newDocSchema(schema))
+	}
+	if err != nil {
+		return "", fmt.Errorf("error generating docs: %w", err)
+	}
+	return builder.String(), nil
+}
+
+// writeDocs sends the documentation (see ServeDocs option) - as HTML unless Markdown is requested (?format=markdown)
+// If the documentation could not be generated the error is returned (HTTP status 500).
+func (h *Handler) writeDocs(w http.ResponseWriter, r *http.Request) {
+	if h.docsErr != nil {
+		http.Error(w, h.docsErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		io.WriteString(w, h.docsMarkdown)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, h.docsHTML)
+}
+
+// newDocSchema gets the info to be documented from the schema, with the root types first then other types by name
+func newDocSchema(schema *ast.Schema) (r docSchema) {
+	var roots, others []docType
+	for _, definition := range schema.Types {
+		if definition.BuiltIn || strings.HasPrefix(definition.Name, "__") {
+			continue
+		}
+		t := newDocType(definition)
+		if definition == schema.Query || definition == schema.Mutation || definition == schema.Subscription {
+			roots = append(roots, t)
+		} else {
+			others = append(others, t)
+		}
+	}
+	rootOrder := map[string]int{}
+	for i, definition := range []*ast.Definition{schema.Query, schema.Mutation, schema.Subscription} {
+		if definition != nil {
+			rootOrder[definition.Name] = i
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return rootOrder[roots[i].Name] < rootOrder[roots[j].Name] })
+	sort.Slice(others, func(i, j int) bool { return others[i].Name < others[j].Name })
+	r.Types = append(roots, others...)
+
+	for _, directive := range schema.Directives {
+		if directive.Position != nil && directive.Position.Src != nil && directive.Position.Src.BuiltIn {
+			continue
+		}
+		d := docDirective{Name: directive.Name, Description: directive.Description}
+		locations := make([]string, 0, len(directive.Locations))
+		for _, location := range directive.Locations {
+			locations = append(locations, string(location))
+		}
+		d.Locations = strings.Join(locations, " | ")
+		for _, arg := range directive.Arguments {
+			d.Args = append(d.Args, newDocArg(arg))
+		}
+		r.Directives = append(r.Directives, d)
+	}
+	sort.Slice(r.Directives, func(i, j int) bool { return r.Directives[i].Name < r.Directives[j].Name })
+	return
+}
+
+func newDocType(definition *ast.Definition) docType {
+	r := docType{
+		Name:        definition.Name,
+		Kind:        kindNames[definition.Kind],
+		Description: definition.Description,
+		Interfaces:  definition.Interfaces,
+		Members:     definition.Types,
+	}
+	for _, f := range definition.Fields {
+		if strings.HasPrefix(f.Name, "__") {
+			continue // introspection fields (__schema and __type) added to the query by the parser
+		}
+		field := docField{Name: f.Name, Type: f.Type.String(), Description: f.Description}
+		if f.DefaultValue != nil {
+			field.Default = f.DefaultValue.String()
+		}
+		field.Directives, field.Deprecated = docDirectives(f.Directives)
+		for _, arg := range f.Arguments {
+			field.Args = append(field.Args, newDocArg(arg))
+		}
+		r.Fields = append(r.Fields, field)
+	}
+	for _, v := range definition.EnumValues {
+		value := docField{Name: v.Name, Description: v.Description}
+		_, value.Deprecated = docDirectives(v.Directives)
+		r.Values = append(r.Values, value)
+	}
+	return r
+}
+
+func newDocArg(arg *ast.ArgumentDefinition) docField {
+	r := docField{Name: arg.Name, Type: arg.Type.String(), Description: arg.Description}
+	if arg.DefaultValue != nil {
+		r.Default = arg.DefaultValue.String()
+	}
+	return r
+}
+
+// docDirectives returns the directives as text (except @deprecated) and the deprecation reason (if deprecated)
+func docDirectives(list ast.DirectiveList) (directives string, deprecated string) {
+	var text []string
+	for _, directive := range list {
+		if directive.Name == "deprecated" {
+			deprecated = "No longer supported" // default reason (see GraphQL spec)
+			if reason := directive.Arguments.ForName("reason"); reason != nil && reason.Value != nil {
+				deprecated = reason.Value.Raw
+			}
+			continue
+		}
+		s := "@" + directive.Name
+		if len(directive.Arguments) > 0 {
+			args := make([]string, 0, len(directive.Arguments))
+			for _, arg := range directive.Arguments {
+				args = append(args, arg.Name+": "+arg.Value.String())
+			}
+			s += "(" + strings.Join(args, ", ") + ")"
+		}
+		text = append(text, s)
+	}
+	return strings.Join(text, " "), deprecated
+}
+
+const markdownDocs = `# API Reference
+{{range .Types}}
+## {{.Name}}
+
+_{{.Kind}}_{{if .Interfaces}} implements {{range $i, $n := .Interfaces}}{{if $i}}, {{end}}{{$n}}{{end}}{{end}}{{if .Members}} = {{range $i, $n := .Members}}{{if $i}} | {{end}}{{$n}}{{end}}{{end}}
+{{if .Description}}
+{{.Description}}
+{{end}}{{if .Fields}}
+{{range .Fields}}- ` + "`" + `{{.Name}}{{if .Args}}({{range $i, $a := .Args}}{{if $i}}, {{end}}{{$a.Name}}: {{$a.Type}}{{if $a.Default}} = {{$a.Default}}{{end}}{{end}}){{end}}: {{.Type}}{{if .Default}} = {{.Default}}{{end}}` + "`" + `{{if .Directives}} ` + "`" + `{{.Directives}}` + "`" + `{{end}}{{if .Description}} - {{.Description}}{{end}}{{if .Deprecated}} **Deprecated:** {{.Deprecated}}{{end}}
+{{range .Args}}{{if .Description}}  - ` + "`" + `{{.Name}}` + "`" + ` - {{.Description}}
+{{end}}{{end}}{{end}}{{end}}{{if .Values}}
+{{range .Values}}- ` + "`" + `{{.Name}}` + "`" + `{{if .Description}} - {{.Description}}{{end}}{{if .Deprecated}} **Deprecated:** {{.Deprecated}}{{end}}
+{{end}}{{end}}{{end}}{{if .Directives}}
+## Directives
+{{range .Directives}}
+### @{{.Name}}
+
+_on {{.Locations}}_
+{{if .Description}}
+{{.Description}}
+{{end}}{{range .Args}}
+- ` + "`" + `{{.Name}}: {{.Type}}{{if .Default}} = {{.Default}}{{end}}` + "`" + `{{if .Description}} - {{.Description}}{{end}}{{end}}
+{{end}}{{end}}`
+
+const htmlDocs = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API Reference</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+.desc { white-space: pre-wrap; }
+.kind { color: gray; font-style: italic; }
+.deprecated { text-decoration: line-through; }
+code { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>API Reference</h1>
+<nav><ul>{{range .Types}}<li><a href="#{{.Name}}">{{.Name}}</a></li>{{end}}</ul></nav>
+{{range .Types}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<p class="kind">{{.Kind}}{{if .Interfaces}} implements {{range $i, $n := .Interfaces}}{{if $i}}, {{end}}<a href="#{{$n}}">{{$n}}</a>{{end}}{{end}}{{if .Members}} = {{range $i, $n := .Members}}{{if $i}} | {{end}}<a href="#{{$n}}">{{$n}}</a>{{end}}{{end}}</p>
+{{if .Description}}<p class="desc">{{.Description}}</p>{{end}}
+{{if .Fields}}<ul>{{range .Fields}}
+<li><code{{if .Deprecated}} class="deprecated"{{end}}>{{.Name}}{{if .Args}}({{range $i, $a := .Args}}{{if $i}}, {{end}}{{$a.Name}}: {{typeLink $a.Type}}{{if $a.Default}} = {{$a.Default}}{{end}}{{end}}){{end}}: {{typeLink .Type}}{{if .Default}} = {{.Default}}{{end}}</code>{{if .Directives}} <code>{{.Directives}}</code>{{end}}
+{{if .Description}}<div class="desc">{{.Description}}</div>{{end}}{{if .Deprecated}}<div><strong>Deprecated:</strong> {{.Deprecated}}</div>{{end}}
+{{if .Args}}<ul>{{range .Args}}{{if .Description}}<li><code>{{.Name}}</code> <span class="desc">{{.Description}}</span></li>{{end}}{{end}}</ul>{{end}}
+</li>{{end}}
+</ul>{{end}}
+{{if .Values}}<ul>{{range .Values}}
+<li><code{{if .Deprecated}} class="deprecated"{{end}}>{{.Name}}</code>{{if .Description}} <span class="desc">{{.Description}}</span>{{end}}{{if .Deprecated}} <strong>Deprecated:</strong> {{.Deprecated}}{{end}}</li>{{end}}
+</ul>{{end}}
+{{end}}
+{{if .Directives}}<h2>Directives</h2>{{range .Directives}}
+<h3>@{{.Name}}</h3>
+<p class="kind">on {{.Locations}}</p>
+{{if .Description}}<p class="desc">{{.Description}}</p>{{end}}
+{{if .Args}}<ul>{{range .Args}}<li><code>{{.Name}}: {{typeLink .Type}}{{if .Default}} = {{.Default}}{{end}}</code>{{if .Description}} <span class="desc">{{.Description}}</span>{{end}}</li>{{end}}</ul>{{end}}
+{{end}}{{end}}
+</body>
+</html>
+`
+
+var (
+	markdownDocsTemplate = texttemplate.Must(texttemplate.New("markdown").Parse(markdownDocs))
+	htmlDocsTemplate     = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{"typeLink": typeLink}).Parse(htmlDocs))
+)
+
+// typeLink makes HTML for a type (eg "[Character!]!") with the named type linked to its documentation
+func typeLink(typ string) htmltemplate.HTML {
+	name := strings.Trim(typ, "[]!")
+	escaped := htmltemplate.HTMLEscapeString(name)
+	switch name {
+	case "Int", "Float", "String", "Boolean", "ID":
+		return htmltemplate.HTML(htmltemplate.HTMLEscapeString(typ)) // built-in scalars are not documented
+	}
+	link := `<a href="#` + escaped + `">` + escaped + `</a>`
+	return htmltemplate.HTML(strings.Replace(htmltemplate.HTMLEscapeString(typ), escaped, link, 1))
+}
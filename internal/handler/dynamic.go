@@ -0,0 +1,109 @@
+package handler
+
+// dynamic.go resolves dynamic objects (see field.Dynamic), ie maps whose keys are the names of the fields of an
+// object type declared in SDL, so that semi-structured data (eg JSON documents) can be served without structs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/dolmen-go/jsonmap"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// dynamicValue returns the value of a field of a dynamic object (or a field of type Dynamic) converted according
+// to the type (t) of the field in the schema.  An object (map) has its fields resolved using the selection set
+// of the query, a list (slice or array) has each element converted, and scalars and enums are returned as is.
+func (op *gqlOperation) dynamicValue(ctx context.Context, astField *ast.Field, t *ast.Type, value interface{},
+) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		if t.NonNull {
+			return nil, fmt.Errorf("returning null for non-nullable field %q of dynamic object", astField.Alias)
+		}
+		return nil, nil
+	}
+
+	if t.Elem != nil {
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, fmt.Errorf("dynamic value for list %q has type %v", astField.Alias, v.Type())
+		}
+		results := op.arena.list(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			element, err := op.dynamicValue(ctx, astField, t.Elem, v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, element)
+		}
+		return results, nil
+	}
+
+	definition := op.schema.Types[t.NamedType]
+	if definition == nil {
+		return nil, fmt.Errorf("type %q of dynamic field %q is not in the schema", t.NamedType, astField.Alias)
+	}
+	switch definition.Kind {
+	case ast.Object, ast.Interface, ast.Union:
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("dynamic value for object %q has type %v (expected a map)", astField.Alias, v.Type())
+		}
+		m := make(map[string]interface{}, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			m[it.Key().String()] = it.Value().Interface()
+		}
+		if definition.Kind != ast.Object {
+			// The map must give the concrete type of an interface or union, eg {"__typename": "Human", ...}
+			name, _ := m["__typename"].(string)
+			if definition = op.schema.Types[name]; definition == nil || definition.Kind != ast.Object {
+				return nil, fmt.Errorf("dynamic value for %q (%s) must give its object type in __typename", astField.Alias, t.NamedType)
+			}
+		}
+		return op.dynamicObject(ctx, astField.SelectionSet, definition, m)
+	}
+	return v.Interface(), nil // scalar or enum
+}
+
+// dynamicObject resolves the selections of a dynamic object (m) of the object type (definition)
+func (op *gqlOperation) dynamicObject(ctx context.Context, set ast.SelectionSet, definition *ast.Definition,
+	m map[string]interface{},
+) (jsonmap.Ordered, error) {
+	if err := ctx.Err(); err != nil {
+		return jsonmap.Ordered{}, err
+	}
+	fields := op.collectMatching(set, func(typeCondition string) bool {
+		if typeCondition == "" || typeCondition == definition.Name {
+			return true
+		}
+		for _, possible := range op.schema.PossibleTypes[typeCondition] {
+			if possible.Name == definition.Name {
+				return true
+			}
+		}
+		return false
+	})
+
+	r := op.arena.ordered(len(fields) + 1)
+	for _, astField := range fields {
+		var value interface{}
+		if astField.Name == "__typename" {
+			value = definition.Name
+		} else {
+			var err error
+			if value, err = op.dynamicValue(ctx, astField, astField.Definition.Type, m[astField.Name]); err != nil {
+				return jsonmap.Ordered{}, err
+			}
+		}
+		r.Order = append(r.Order, astField.Alias)
+		r.Data[astField.Alias] = value
+	}
+	if _, ok := r.Data["__typename"]; op.addTypename && !ok {
+		r.Order = append(r.Order, "__typename")
+		r.Data["__typename"] = definition.Name
+	}
+	return r, nil
+}
@@ -0,0 +1,82 @@
+package handler
+
+// elementcache.go allows the values of resolvers of list elements to be cached.  An element (eg of a map) is often a
+// copy so the Go field holding its resolver is not the same each time (see CacheKey), so the element is instead
+// identified by its list and its key (or index) in the list.  The values are kept in the operation's own caches (see
+// gqlOperation.elementCaches) as the list is only identified while the operation runs.
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type (
+	// elementKey is the context key for the identity of the list element being resolved (an elementID)
+	elementKey struct{}
+
+	// elementID identifies an element of a list for caching the values of its resolvers
+	elementID struct {
+		list reflect.Value // identifies the list (see listIdentity) - invalid if the list can't be identified
+		key  interface{}   // key of the element in a map or index in a slice/array
+	}
+)
+
+// listIdentity returns a value that identifies a map or slice (or an addressable array), which refers to the list so
+// that it is not garbage collected (and its memory reused by another list) while a cache holds the value.  It returns
+// an invalid value if the list can't be identified, eg an ordered map or an array that is a copy.
+func listIdentity(list reflect.Value) reflect.Value {
+	switch list.Kind() {
+	case reflect.Map:
+		if list.CanInterface() {
+			return reflect.ValueOf(list.Interface())
+		}
+	case reflect.Slice, reflect.Array:
+		if list.Len() > 0 && list.Index(0).CanAddr() {
+			return list.Index(0).Addr()
+		}
+	}
+	return reflect.Value{}
+}
+
+// withElement returns the context for resolving an element (with key or index key) of a list
+func withElement(ctx context.Context, list, key reflect.Value) context.Context {
+	return context.WithValue(ctx, elementKey{}, elementID{list: listIdentity(list), key: key.Interface()})
+}
+
+// objectContext returns the context (with the path of astField) for resolving the fields of an object, which only
+// has the identity of a list element (see withElement) if the object is the element
+func objectContext(ctx context.Context, astField *ast.Field) context.Context {
+	ctx = fieldPath(ctx, astField)
+	if ctx.Value(elementKey{}) == nil {
+		return ctx
+	}
+	if p, _ := ctx.Value(pathKey{}).(*pathNode); p != nil && p.field == astField {
+		return ctx // the object is the element
+	}
+	return context.WithValue(ctx, elementKey{}, nil)
+}
+
+// cacheOf returns the cache to use in place of the shared cache of a resolver (see scopedCaches.get).  The values
+// of resolvers of a list element are kept in the operation's element caches, or are not cached if the list can't
+// be identified.
+func (op *gqlOperation) cacheOf(ctx context.Context, shared ResolverCache) ResolverCache {
+	if id, ok := ctx.Value(elementKey{}).(elementID); ok {
+		if !id.list.IsValid() || op.elementCaches == nil {
+			return ResolverCache{}
+		}
+		return op.elementCaches.get(shared)
+	}
+	return op.caches.get(shared)
+}
+
+// cacheKey returns the key of the value of a resolver (the field v of an object) in its cache, which has the
+// identity of the element (rather than the field) if the object is a list element
+func cacheKey(ctx context.Context, astField *ast.Field, v reflect.Value, variables map[string]interface{}) CacheKey {
+	key := CacheKey{fieldValue: v, args: argsKey(astField.Arguments, variables)}
+	if id, ok := ctx.Value(elementKey{}).(elementID); ok {
+		key.fieldValue, key.element = reflect.Value{}, id
+	}
+	return key
+}
@@ -4,6 +4,7 @@ package handler_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -21,6 +22,14 @@ type (
 		V1 int `egg:":E"`
 		V2 int `egg:":E"`
 	}
+	Count int
+	In3   struct {
+		V    int   `egg:":E"`
+		List []int `egg:":[E]"`
+		N    Count
+		S    SimpleScalar
+		Next *In3
+	}
 )
 
 // TestEnumQuery has test queries for checking enum fields, arguments, defaults, descriptions, etc
@@ -97,6 +106,63 @@ func TestEnumQuery(t *testing.T) {
 			enums:    map[string][]string{"E": {"E0", "E1", "E2"}},
 			expected: `{"f": 21.0}`,
 		},
+		"InputDefault": {
+			// default value of input type has enum, list of enum, named int, custom scalar and nested object fields
+			schema: "type Query { f(p:In3! = {v: E2, list: [E1, E0], n: 7, s: 5, next: {v: E1}}): String! } " +
+				"input In3 { v: E! list: [E!]! n: Int! s: SimpleScalar! next: In3 } enum E { E0 E1 E2 } scalar SimpleScalar",
+			data: struct {
+				F func(In3) string `egg:"(p={v: E2, list: [E1, E0], n: 7, s: 5, next: {v: E1}})"`
+			}{
+				F: func(in In3) string { return fmt.Sprint(in.V, in.List, in.N, in.S, in.Next.V) },
+			},
+			query:    "{ f }",
+			enums:    map[string][]string{"E": {"E0", "E1", "E2"}},
+			expected: `{"f": "2 [1 0] 7 5 1"}`,
+		},
+		"ListDefault": {
+			schema: "type Query { f(p:[E!]! = [E2, E0]): String! } enum E { E0 E1 E2 }",
+			data: struct {
+				F func([]int) string `egg:"(p:[E]=[E2, E0])"`
+			}{
+				F: func(p []int) string { return fmt.Sprint(p) },
+			},
+			query:    "{ f }",
+			enums:    map[string][]string{"E": {"E0", "E1", "E2"}},
+			expected: `{"f": "[2 0]"}`,
+		},
+		"NonNullParam": {
+			schema: "type Query { f(p:E!): Int! } enum E { E0 E1 E2 }",
+			data: struct {
+				F func(int) int `egg:"(p:E!)"`
+			}{
+				F: func(p int) int { return p },
+			},
+			query:    "{ f(p:E1) }",
+			enums:    map[string][]string{"E": {"E0", "E1", "E2"}},
+			expected: `{"f": 1.0}`,
+		},
+		"NonNullList": {
+			schema: "type Query { f(p:[E!]!): String! } enum E { E0 E1 E2 }",
+			data: struct {
+				F func([]int) string `egg:"(p:[E!]!)"`
+			}{
+				F: func(p []int) string { return fmt.Sprint(p) },
+			},
+			query:    "{ f(p:[E2, E1]) }",
+			enums:    map[string][]string{"E": {"E0", "E1", "E2"}},
+			expected: `{"f": "[2 1]"}`,
+		},
+		"NonNullListDefault": {
+			schema: "type Query { f(p:[E!]! = [E1, E2]): String! } enum E { E0 E1 E2 }",
+			data: struct {
+				F func([]int) string `egg:"(p:[E!]!=[E1,E2])"`
+			}{
+				F: func(p []int) string { return fmt.Sprint(p) },
+			},
+			query:    "{ f }",
+			enums:    map[string][]string{"E": {"E0", "E1", "E2"}},
+			expected: `{"f": "[1 2]"}`,
+		},
 		"EnumDescription": {
 			schema: "type Query { v: Int! } enum E { E0 E1 E2 }",
 			data: struct {
@@ -178,3 +244,128 @@ func TestEnumQuery(t *testing.T) {
 		})
 	}
 }
+
+// TestEnumInput checks the CaseInsensitiveEnums and UnknownEnumMessage options
+func TestEnumInput(t *testing.T) {
+	const schemaString = "enum E { RED GREEN BLUE } input In { v: E! } " +
+		"type Query { f(v: E!): Int! g(list: [E!]!): Int! h(in: In!): Int! }"
+	enums := map[string][]string{"E": {"RED", "GREEN", "BLUE"}}
+	queryData := struct {
+		F func(int) int   `egg:"(v:E)"`
+		G func([]int) int `egg:"(list:[E])"`
+		H func(In) int    `egg:"(in)"`
+	}{
+		F: func(v int) int { return v },
+		G: func(list []int) int {
+			r := 0
+			for _, v := range list {
+				r = r*10 + v
+			}
+			return r
+		},
+		H: func(in In) int { return in.V },
+	}
+	message := func(enum, value string, valid []string) string {
+		return fmt.Sprintf("%q is not a %s (use one of %s)", value, enum, strings.Join(valid, ", "))
+	}
+
+	enumData := map[string]struct {
+		options  []func(*handler.Handler)
+		body     string
+		expected interface{}
+		error    string // expected error message (if not empty)
+	}{
+		"Exact": {nil, `{"query":"{ f(v: BLUE) }"}`, JsonObject{"f": 2.0}, ""},
+		"NoCaseOff": {nil, `{"query":"{ f(v: blue) }"}`, nil,
+			`Value "blue" does not exist in "E!" enum. Did you mean the enum value "BLUE"?`},
+		"Literal":     {caseOn, `{"query":"{ f(v: blue) }"}`, JsonObject{"f": 2.0}, ""},
+		"List":        {caseOn, `{"query":"{ g(list: [Green, red]) }"}`, JsonObject{"g": 10.0}, ""},
+		"Input":       {caseOn, `{"query":"{ h(in: {v: green}) }"}`, JsonObject{"h": 1.0}, ""},
+		"Fragment":    {caseOn, `{"query":"{ ...F } fragment F on Query { f(v: Blue) }"}`, JsonObject{"f": 2.0}, ""},
+		"Default":     {caseOn, `{"query":"query($v: E! = green) { f(v: $v) }"}`, JsonObject{"f": 1.0}, ""},
+		"Variable":    {caseOn, `{"query":"query($v: E!) { f(v: $v) }","variables":{"v":"blue"}}`, JsonObject{"f": 2.0}, ""},
+		"VarList":     {caseOn, `{"query":"query($v: [E!]!) { g(list: $v) }","variables":{"v":["blue","Red"]}}`, JsonObject{"g": 20.0}, ""},
+		"VarInput":    {caseOn, `{"query":"query($v: In!) { h(in: $v) }","variables":{"v":{"v":"Blue"}}}`, JsonObject{"h": 2.0}, ""},
+		"Unknown":     {caseOn, `{"query":"{ f(v: PINK) }"}`, nil, `Value "PINK" does not exist in "E!" enum.`},
+		"Message":     {msgOn(message), `{"query":"{ f(v: PINK) }"}`, nil, `"PINK" is not a E (use one of RED, GREEN, BLUE)`},
+		"MessageCase": {msgOn(message), `{"query":"{ f(v: blue) }"}`, nil, `"blue" is not a E (use one of RED, GREEN, BLUE)`},
+		"MessageVar": {msgOn(message), `{"query":"query($v: [E!]!) { g(list: $v) }","variables":{"v":["RED","pink"]}}`,
+			nil, `"pink" is not a E (use one of RED, GREEN, BLUE)`},
+		"Both": {append(caseOn, msgOn(message)...), `{"query":"{ f(v: blue) g(list: [PINK]) }"}`, nil,
+			`"PINK" is not a E (use one of RED, GREEN, BLUE)`},
+	}
+
+	for name, testData := range enumData {
+		t.Run(name, func(t *testing.T) {
+			h := handler.New([]string{schemaString}, enums, [3][]interface{}{{queryData}, nil, nil}, testData.options...)
+			data, errs := doRequest(t, h, testData.body)
+			if testData.error != "" {
+				Assertf(t, len(errs) == 1 && errs[0] == testData.error, "Expected error %q and got %v", testData.error, errs)
+				return
+			}
+			Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+			Assertf(t, reflect.DeepEqual(data, testData.expected), "Expected %v and got %v", testData.expected, data)
+		})
+	}
+}
+
+var caseOn = []func(*handler.Handler){handler.CaseInsensitiveEnums(true)}
+
+// TestIntEnums checks the IntEnums option, for enum results and arguments/variables
+func TestIntEnums(t *testing.T) {
+	const schemaString = "enum E { RED GREEN BLUE } enum F { X Y } input In { v: E! } " +
+		"type Query { e: E! list: [E!]! f: F! g(v: E!): Int! h(in: In!): Int! }"
+	enums := map[string][]string{"E": {"RED", "GREEN", "BLUE"}, "F": {"X", "Y"}}
+	queryData := struct {
+		E    int           `egg:":E"`
+		List []int         `egg:":[E]"`
+		F    int           `egg:":F"`
+		G    func(int) int `egg:"(v:E)"`
+		H    func(In) int  `egg:"(in)"`
+	}{
+		E: 2, List: []int{1, 0}, F: 1,
+		G: func(v int) int { return v },
+		H: func(in In) int { return in.V },
+	}
+
+	enumData := map[string]struct {
+		options  []func(*handler.Handler)
+		body     string
+		expected interface{}
+		error    string // expected error message (if not empty)
+	}{
+		"Off":      {nil, `{"query":"{ e list f }"}`, JsonObject{"e": "BLUE", "list": []interface{}{"GREEN", "RED"}, "f": "Y"}, ""},
+		"All":      {intOn(), `{"query":"{ e list f }"}`, JsonObject{"e": 2.0, "list": []interface{}{1.0, 0.0}, "f": 1.0}, ""},
+		"Named":    {intOn("F"), `{"query":"{ e list f }"}`, JsonObject{"e": "BLUE", "list": []interface{}{"GREEN", "RED"}, "f": 1.0}, ""},
+		"Literal":  {intOn(), `{"query":"{ g(v: 1) }"}`, JsonObject{"g": 1.0}, ""},
+		"Name":     {intOn(), `{"query":"{ g(v: BLUE) }"}`, JsonObject{"g": 2.0}, ""},
+		"Input":    {intOn(), `{"query":"{ h(in: {v: 2}) }"}`, JsonObject{"h": 2.0}, ""},
+		"Variable": {intOn(), `{"query":"query($v: E!) { g(v: $v) }","variables":{"v":2}}`, JsonObject{"g": 2.0}, ""},
+		"VarInput": {intOn(), `{"query":"query($v: In!) { h(in: $v) }","variables":{"v":{"v":1}}}`, JsonObject{"h": 1.0}, ""},
+		"Range":    {intOn(), `{"query":"{ g(v: 3) }"}`, nil, `Enum "E!" cannot represent non-enum value: 3.`},
+		"NotNamed": {intOn("F"), `{"query":"{ g(v: 1) }"}`, nil, `Enum "E!" cannot represent non-enum value: 1.`},
+		"Intro": {intOn(), `{"query":"{ __type(name: \"E\") { kind } }"}`,
+			JsonObject{"__type": JsonObject{"kind": "ENUM"}}, ""},
+	}
+
+	for name, testData := range enumData {
+		t.Run(name, func(t *testing.T) {
+			h := handler.New([]string{schemaString}, enums, [3][]interface{}{{queryData}, nil, nil}, testData.options...)
+			data, errs := doRequest(t, h, testData.body)
+			if testData.error != "" {
+				Assertf(t, len(errs) == 1 && errs[0] == testData.error, "Expected error %q and got %v", testData.error, errs)
+				return
+			}
+			Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+			Assertf(t, reflect.DeepEqual(data, testData.expected), "Expected %v and got %v", testData.expected, data)
+		})
+	}
+}
+
+func intOn(enums ...string) []func(*handler.Handler) {
+	return []func(*handler.Handler){handler.IntEnums(true, enums...)}
+}
+
+func msgOn(f func(enum, value string, valid []string) string) []func(*handler.Handler) {
+	return []func(*handler.Handler){handler.UnknownEnumMessage(f)}
+}
@@ -0,0 +1,294 @@
+package handler
+
+// enuminput.go checks enum values supplied by the client (as literals in the query or in variables) when the
+// CaseInsensitiveEnums, UnknownEnumMessage or IntEnums options are used - matching values (or integers) are
+// converted to the value declared in the schema, and the error for an unknown value can be customised
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// enumWalker finds the enum literals of a query (using the schema to find the type of each argument)
+type enumWalker struct {
+	*Handler
+	errs gqlerror.List
+}
+
+// loadQuery parses and validates a query, like gqlparser.LoadQuery, but first checks the enum literals (if
+// the options require it) since the validator would reject values that are not exactly as in the schema
+func (h *Handler) loadQuery(query string) (*ast.QueryDocument, gqlerror.List) {
+	doc, errs := h.parseQuery(query)
+	if errs != nil {
+		return nil, errs
+	}
+	if errs := h.validateQuery(doc); errs != nil {
+		return nil, errs
+	}
+	return doc, nil
+}
+
+// parseQuery parses a query and checks its enum literals (see loadQuery)
+func (h *Handler) parseQuery(query string) (*ast.QueryDocument, gqlerror.List) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return nil, gqlerror.List{err}
+	}
+	if h.caseInsensitiveEnums || h.unknownEnumMessage != nil || h.intEnums {
+		w := enumWalker{Handler: h}
+		w.document(doc)
+		if w.errs != nil {
+			return nil, w.errs
+		}
+	}
+	return doc, nil
+}
+
+// validateQuery validates a parsed query against the schema
+func (h *Handler) validateQuery(doc *ast.QueryDocument) gqlerror.List {
+	return validator.Validate(h.schema, doc)
+}
+
+// enumValue returns the value (name) of the enum that matches the value from the client.  If there is no match
+// it returns an error message (if the UnknownEnumMessage option is used) or an empty string (to leave the
+// error to the validator).
+func (h *Handler) enumValue(def *ast.Definition, value string) (string, string) {
+	if def.EnumValues.ForName(value) != nil {
+		return value, ""
+	}
+	if h.caseInsensitiveEnums {
+		for _, v := range def.EnumValues {
+			if strings.EqualFold(v.Name, value) {
+				return v.Name, ""
+			}
+		}
+	}
+	if h.unknownEnumMessage == nil {
+		return value, ""
+	}
+	valid := make([]string, 0, len(def.EnumValues))
+	for _, v := range def.EnumValues {
+		valid = append(valid, v.Name)
+	}
+	return value, h.unknownEnumMessage(def.Name, value, valid)
+}
+
+// intEnum returns true if the values of an enum are integers (see IntEnums option)
+func (h *Handler) intEnum(name string) bool {
+	return h.intEnums && !strings.HasPrefix(name, "__") && (h.intEnumNames == nil || h.intEnumNames[name])
+}
+
+// enumName returns the name of the enum value for an integer from the client, or false if the enum's values are
+// not integers or idx is out of range (which is left to the validator to report)
+func (h *Handler) enumName(def *ast.Definition, idx int) (string, bool) {
+	if !h.intEnum(def.Name) || idx < 0 || idx >= len(h.enums[def.Name]) {
+		return "", false
+	}
+	return h.enums[def.Name][idx], true
+}
+
+// jsonInt returns the value of an integer decoded from JSON (see FixNumberVariables)
+func jsonInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int64:
+		return int(v), true
+	case int:
+		return v, true
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	case float64:
+		return int(v), v == float64(int(v))
+	}
+	return 0, false
+}
+
+// document checks the enum literals of all the operations and fragments of a query
+func (w *enumWalker) document(doc *ast.QueryDocument) {
+	for _, operation := range doc.Operations {
+		for _, v := range operation.VariableDefinitions {
+			w.value(v.DefaultValue, v.Type)
+		}
+		w.directives(operation.Directives)
+		var def *ast.Definition
+		switch operation.Operation {
+		case ast.Query:
+			def = w.schema.Query
+		case ast.Mutation:
+			def = w.schema.Mutation
+		case ast.Subscription:
+			def = w.schema.Subscription
+		}
+		w.selections(operation.SelectionSet, def)
+	}
+	for _, fragment := range doc.Fragments {
+		w.directives(fragment.Directives)
+		w.selections(fragment.SelectionSet, w.schema.Types[fragment.TypeCondition])
+	}
+}
+
+// selections checks the enum literals in the arguments of the fields of a selection set (of an object of type def)
+func (w *enumWalker) selections(set ast.SelectionSet, def *ast.Definition) {
+	for _, s := range set {
+		switch s := s.(type) {
+		case *ast.Field:
+			w.directives(s.Directives)
+			if def == nil {
+				continue
+			}
+			fieldDef := def.Fields.ForName(s.Name)
+			if fieldDef == nil {
+				continue // unknown field is reported by the validator
+			}
+			for _, arg := range s.Arguments {
+				if argDef := fieldDef.Arguments.ForName(arg.Name); argDef != nil {
+					w.value(arg.Value, argDef.Type)
+				}
+			}
+			w.selections(s.SelectionSet, w.schema.Types[fieldDef.Type.Name()])
+		case *ast.InlineFragment:
+			w.directives(s.Directives)
+			if s.TypeCondition != "" {
+				w.selections(s.SelectionSet, w.schema.Types[s.TypeCondition])
+			} else {
+				w.selections(s.SelectionSet, def)
+			}
+		case *ast.FragmentSpread:
+			w.directives(s.Directives)
+		}
+	}
+}
+
+// directives checks the enum literals in the arguments of directives
+func (w *enumWalker) directives(list ast.DirectiveList) {
+	for _, d := range list {
+		dirDef := w.schema.Directives[d.Name]
+		if dirDef == nil {
+			continue
+		}
+		for _, arg := range d.Arguments {
+			if argDef := dirDef.Arguments.ForName(arg.Name); argDef != nil {
+				w.value(arg.Value, argDef.Type)
+			}
+		}
+	}
+}
+
+// value checks a literal value of type t, including the elements of a list and the fields of an input object
+func (w *enumWalker) value(v *ast.Value, t *ast.Type) {
+	if v == nil || t == nil {
+		return
+	}
+	if t.Elem != nil {
+		if v.Kind != ast.ListValue {
+			w.value(v, t.Elem) // a single value is allowed for a list
+			return
+		}
+		for _, child := range v.Children {
+			w.value(child.Value, t.Elem)
+		}
+		return
+	}
+	def := w.schema.Types[t.NamedType]
+	if def == nil {
+		return
+	}
+	switch {
+	case def.Kind == ast.Enum && v.Kind == ast.IntValue:
+		if idx, err := strconv.Atoi(v.Raw); err == nil {
+			if name, ok := w.enumName(def, idx); ok {
+				v.Kind, v.Raw = ast.EnumValue, name
+			}
+		}
+	case def.Kind == ast.Enum && v.Kind == ast.EnumValue:
+		var message string
+		if v.Raw, message = w.enumValue(def, v.Raw); message != "" {
+			w.errs = append(w.errs, gqlerror.ErrorPosf(v.Position, "%s", message))
+		}
+	case def.Kind == ast.InputObject && v.Kind == ast.ObjectValue:
+		for _, child := range v.Children {
+			if fieldDef := def.Fields.ForName(child.Name); fieldDef != nil {
+				w.value(child.Value, fieldDef.Type)
+			}
+		}
+	}
+}
+
+// enumVariables checks the enum values in the variables of an operation, replacing values that match (ignoring
+// case) or integers (see IntEnums) with the value declared in the schema.  It returns an error if the
+// UnknownEnumMessage option is used and a value is not valid.
+func (h *Handler) enumVariables(operation *ast.OperationDefinition, variables map[string]interface{}) *gqlerror.Error {
+	if !h.caseInsensitiveEnums && h.unknownEnumMessage == nil && !h.intEnums {
+		return nil
+	}
+	for _, v := range operation.VariableDefinitions {
+		value, ok := variables[v.Variable]
+		if !ok {
+			continue
+		}
+		var err *gqlerror.Error
+		if variables[v.Variable], err = h.enumVariable(value, v.Type, ast.Path{ast.PathName("variable"), ast.PathName(v.Variable)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enumVariable checks the enum values in the value of a variable (decoded from JSON) of type t
+func (h *Handler) enumVariable(value interface{}, t *ast.Type, path ast.Path) (interface{}, *gqlerror.Error) {
+	if value == nil {
+		return nil, nil
+	}
+	if t.Elem != nil {
+		list, ok := value.([]interface{})
+		if !ok {
+			return h.enumVariable(value, t.Elem, path) // a single value is allowed for a list
+		}
+		for i, elem := range list {
+			var err *gqlerror.Error
+			if list[i], err = h.enumVariable(elem, t.Elem, append(path, ast.PathIndex(i))); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	def := h.schema.Types[t.NamedType]
+	if def == nil {
+		return value, nil
+	}
+	switch def.Kind {
+	case ast.Enum:
+		if idx, ok := jsonInt(value); ok {
+			if name, ok := h.enumName(def, idx); ok {
+				return name, nil
+			}
+		}
+		if s, ok := value.(string); ok {
+			s, message := h.enumValue(def, s)
+			if message != "" {
+				return nil, gqlerror.ErrorPathf(path, "%s", message)
+			}
+			return s, nil
+		}
+	case ast.InputObject:
+		if m, ok := value.(map[string]interface{}); ok {
+			for _, fieldDef := range def.Fields {
+				elem, ok := m[fieldDef.Name]
+				if !ok {
+					continue
+				}
+				var err *gqlerror.Error
+				if m[fieldDef.Name], err = h.enumVariable(elem, fieldDef.Type, append(path, ast.PathName(fieldDef.Name))); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return value, nil
+}
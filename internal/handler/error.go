@@ -0,0 +1,84 @@
+package handler
+
+// error.go allows resolvers to return errors with machine-readable details (see Error) which are added to the
+// "extensions" of the error in the response, eg {"message": "...", "extensions": {"code": "NOT_FOUND"}}, and
+// records the path of the field whose resolver returned an error
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type (
+	// Error is an error that a resolver can return (possibly wrapped) to provide details of the error to the client.
+	// The Code (if not empty) and Extensions are added to the "extensions" of the error in the response.  If Path
+	// is nil the path of the field whose resolver returned the error is used.
+	Error struct {
+		Message    string                 // error message (if empty the message of Err is used)
+		Code       string                 // machine-readable classification of the error, eg "NOT_FOUND"
+		Path       ast.Path               // path in the results (field names and list indexes)
+		Extensions map[string]interface{} // other details of the error (added to the "extensions" of the error)
+		Err        error                  // underlying error (if any)
+	}
+
+	// pathError records the path of the field whose resolver returned an error
+	pathError struct {
+		err  error
+		path ast.Path
+	}
+)
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e pathError) Error() string { return e.err.Error() }
+
+func (e pathError) Unwrap() error { return e.err }
+
+// withErrorPath returns the error of a resolver, recording the path of the field
+func withErrorPath(ctx context.Context, astField *ast.Field, err error) error {
+	var pe pathError
+	if errors.As(err, &pe) {
+		return err // already has the path of the (child) field that returned it
+	}
+	return pathError{err: err, path: getPath(fieldPath(ctx, astField))}
+}
+
+// gqlError converts an error to a GraphQL error for the response, including the details of an Error (if any)
+func gqlError(err error, operation *ast.OperationDefinition) *gqlerror.Error {
+	r := &gqlerror.Error{Message: err.Error()}
+	r.Path, r.Extensions = errorDetails(err, operation)
+	return r
+}
+
+// errorDetails returns the path and extensions of an error (see Error) including the operation name
+func errorDetails(err error, operation *ast.OperationDefinition) (path ast.Path, extensions map[string]interface{}) {
+	extensions = map[string]interface{}{"operation": operation.Name}
+	var pe pathError
+	if errors.As(err, &pe) {
+		path = pe.path
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return path, extensions
+	}
+	for k, v := range e.Extensions {
+		extensions[k] = v
+	}
+	if e.Code != "" {
+		extensions["code"] = e.Code
+	}
+	if e.Path != nil {
+		path = e.Path
+	}
+	return path, extensions
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/andrewwphillips/eggql/internal/handler"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 const (
@@ -41,7 +43,13 @@ func TestErrors(t *testing.T) {
 			"type Query{f(i:Int!):Int!}", struct {
 				F func(int) int `egg:"(j)"`
 			}{F: func(j int) int { return j }}, `{ f(i:1) }`, "",
-			`unknown argument "i" in resolver "f"`,
+			`unknown argument "i" in resolver "Query.f" (expected args: (j), received: (i))`,
+		},
+		"ArgNotInSchema": {
+			"type Query{f(a:Int!):Int!}", struct {
+				F func(int, int) int `egg:"(a,b)"`
+			}{F: func(a, b int) int { return a + b }}, `{ f(a:1) }`, "",
+			`argument "b" is not in the schema so has no default value in resolver "Query.f" (expected args: (a, b), received: (a))`,
 		},
 		"NullFromNonNullableSlice": {
 			"type Query{ list: [Int!]!}",
@@ -61,6 +69,12 @@ func TestErrors(t *testing.T) {
 			`{ list }`, "",
 			`returning null when list "list" is not nullable`,
 		},
+		"NilFunc": {
+			"type Query{ f: Int! }",
+			struct{ F func() int }{}, // nil func not allowed unless optional_func option (or NilResolver) used
+			`{ f }`, "",
+			`function for "f" is not implemented (nil)`,
+		},
 		// TODO test all error conditions
 	}
 
@@ -114,6 +128,177 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+type (
+	elementItem  struct{ V func() (int, error) }
+	elementOwner struct{ Items []elementItem }
+)
+
+// TestListElementErrors checks that an error resolving an element of a list is returned with the path of the
+// field in error, and that the rest of the list is still returned if the element is nullable
+func TestListElementErrors(t *testing.T) {
+	value := func(v int) func() (int, error) { return func() (int, error) { return v, nil } }
+	items := []elementItem{{value(1)}, {func() (int, error) { return 0, errors.New(errorMessage) }}, {value(3)}}
+	h := handler.New([]string{`type Query{ owners: [Owner] required: [Item!] }
+		type Owner{ items: [Item] }
+		type Item{ v: Int! }`}, nil,
+		[3][]interface{}{{struct {
+			Owners   []elementOwner
+			Required []elementItem
+		}{[]elementOwner{{items[:1]}, {items}}, items}}, nil, nil})
+
+	errorData := map[string]struct {
+		query   string
+		expData string // expected data as JSON
+		expPath string // expected path of the error as JSON
+	}{
+		"Nullable": {`{ owners { items { v } } }`, `{"owners":[{"items":[{"v":1}]},{"items":[{"v":1},null,{"v":3}]}]}`,
+			`["owners",1,"items",1,"v"]`},
+		// error in non-null element makes the (nullable) list null
+		"NonNull": {`{ required { v } }`, `{"required":null}`, `["required",1,"v"]`},
+	}
+	for name, testData := range errorData {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+testData.query+`"}`))
+			request.Header.Add("Content-Type", "application/json")
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, request)
+
+			var result struct {
+				Data   json.RawMessage
+				Errors []struct {
+					Message string
+					Path    json.RawMessage
+				}
+			}
+			if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+				t.Fatalf("Error decoding JSON: %v", err)
+			}
+			Assertf(t, string(result.Data) == testData.expData, "Expected data %s got %s", testData.expData, result.Data)
+			Assertf(t, len(result.Errors) == 1 && result.Errors[0].Message == errorMessage,
+				"Expected error %q got %v", errorMessage, result.Errors)
+			if len(result.Errors) == 1 {
+				path := string(result.Errors[0].Path)
+				if path == "" {
+					path = "null"
+				}
+				Assertf(t, path == testData.expPath, "Expected path %s got %s", testData.expPath, path)
+			}
+		})
+	}
+}
+
+// TestPartialResults checks that an error resolving a field makes the field (or its nearest nullable ancestor) null
+// while the data of other fields is still returned
+func TestPartialResults(t *testing.T) {
+	fail := func() (int, error) { return 0, errors.New(errorMessage) }
+	h := handler.New([]string{`type Query{ a: Int b: Int! c: Child d: Child! }
+		type Child{ x: Int! y: Int }`}, nil,
+		[3][]interface{}{{struct {
+			A, B func() (int, error)
+			C, D struct{ X, Y func() (int, error) }
+		}{
+			A: fail,
+			B: func() (int, error) { return 2, nil },
+			C: struct{ X, Y func() (int, error) }{X: fail},
+			D: struct{ X, Y func() (int, error) }{X: func() (int, error) { return 4, nil }, Y: fail},
+		}}, nil, nil})
+
+	errorData := map[string]struct {
+		query   string
+		expData string // expected data as JSON
+		expPath string // expected path of the error as JSON
+	}{
+		"Nullable":    {`{ a b }`, `{"a":null,"b":2}`, `["a"]`},
+		"NonNull":     {`{ b c { x } }`, `{"b":2,"c":null}`, `["c","x"]`},
+		"NestedField": {`{ d { x y } }`, `{"d":{"x":4,"y":null}}`, `["d","y"]`},
+		"Root":        {`{ b d { x } c { x } }`, `{"b":2,"d":{"x":4},"c":null}`, `["c","x"]`},
+	}
+	for name, testData := range errorData {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+testData.query+`"}`))
+			request.Header.Add("Content-Type", "application/json")
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, request)
+
+			var result struct {
+				Data   json.RawMessage
+				Errors []struct {
+					Message string
+					Path    json.RawMessage
+				}
+			}
+			if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+				t.Fatalf("Error decoding JSON: %v", err)
+			}
+			Assertf(t, string(result.Data) == testData.expData, "Expected data %s got %s", testData.expData, result.Data)
+			Assertf(t, len(result.Errors) == 1 && result.Errors[0].Message == errorMessage &&
+				string(result.Errors[0].Path) == testData.expPath,
+				"Expected error %q with path %s got %v", errorMessage, testData.expPath, result.Errors)
+		})
+	}
+}
+
+// TestErrorExtensions checks that the code, extensions and path of a handler.Error returned by a resolver are
+// added to the error in the response
+func TestErrorExtensions(t *testing.T) {
+	notFound := &handler.Error{Message: "not found", Code: "NOT_FOUND", Extensions: map[string]interface{}{"id": 42}}
+	h := handler.New([]string{`type Query{ plain: Int! found: Int! wrapped: Int! pathed: Int! outer: Outer! items: [Item] }
+		type Outer{ inner: Int! }
+		type Item{ v: Int! }`}, nil,
+		[3][]interface{}{{struct {
+			Plain   func() (int, error)
+			Found   func() (int, error)
+			Wrapped func() (int, error)
+			Pathed  func() (int, error)
+			Outer   struct{ Inner func() (int, error) }
+			Items   []elementItem
+		}{
+			Plain:   func() (int, error) { return 0, errors.New(errorMessage) },
+			Found:   func() (int, error) { return 0, notFound },
+			Wrapped: func() (int, error) { return 0, fmt.Errorf("lookup: %w", notFound) },
+			Pathed: func() (int, error) {
+				return 0, &handler.Error{Err: errors.New(errorMessage), Code: "BAD", Path: ast.Path{ast.PathName("x")}}
+			},
+			Outer: struct{ Inner func() (int, error) }{func() (int, error) { return 0, notFound }},
+			Items: []elementItem{{func() (int, error) { return 0, notFound }}},
+		}}, nil, nil})
+
+	errorData := map[string]struct {
+		query  string
+		expErr string // expected error as JSON
+	}{
+		"Plain": {`{ plain }`, `{"message":"resolver func error","path":["plain"],"extensions":{"operation":""}}`},
+		"Code": {`{ found }`,
+			`{"message":"not found","path":["found"],"extensions":{"code":"NOT_FOUND","id":42,"operation":""}}`},
+		"Wrapped": {`{ wrapped }`,
+			`{"message":"lookup: not found","path":["wrapped"],"extensions":{"code":"NOT_FOUND","id":42,"operation":""}}`},
+		"Path": {`query Op { pathed }`,
+			`{"message":"resolver func error","path":["x"],"extensions":{"code":"BAD","operation":"Op"}}`},
+		"Nested": {`{ outer { inner } }`,
+			`{"message":"not found","path":["outer","inner"],"extensions":{"code":"NOT_FOUND","id":42,"operation":""}}`},
+		"Element": {`{ items { v } }`,
+			`{"message":"not found","path":["items",0,"v"],"extensions":{"code":"NOT_FOUND","id":42,"operation":""}}`},
+	}
+	for name, testData := range errorData {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+testData.query+`"}`))
+			request.Header.Add("Content-Type", "application/json")
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, request)
+
+			var result struct{ Errors []json.RawMessage }
+			if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+				t.Fatalf("Error decoding JSON: %v", err)
+			}
+			Assertf(t, len(result.Errors) == 1, "Expected one error got %d", len(result.Errors))
+			if len(result.Errors) == 1 {
+				Assertf(t, string(result.Errors[0]) == testData.expErr, "Expected error %s got %s",
+					testData.expErr, result.Errors[0])
+			}
+		})
+	}
+}
+
 func TestQueryCancel(t *testing.T) {
 	h := handler.New([]string{"type Query{v:Int!}"},
 		nil,
@@ -145,6 +330,41 @@ func TestQueryCancel(t *testing.T) {
 	}
 }
 
+// TestClientDisconnect checks that resolvers are cancelled when the client goes away mid-request
+func TestClientDisconnect(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := func(ctx context.Context) int {
+		select {
+		case <-ctx.Done():
+			cancelled <- struct{}{}
+		case <-time.After(5 * time.Second):
+		}
+		return 0
+	}
+	h := handler.New([]string{"type Query{a:Int! b:Int!}"}, nil,
+		[3][]interface{}{{struct{ A, B func(context.Context) int }{slow, slow}}, nil, nil})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, "POST", server.URL, strings.NewReader(`{"query":"{a b}"}`))
+	request.Header.Add("Content-Type", "application/json")
+	if resp, err := http.DefaultClient.Do(request); err == nil {
+		resp.Body.Close()
+		t.Fatalf("Expected the request to time out")
+	}
+
+	// Both (concurrent) resolvers should see the context cancelled soon after the client disconnects
+	for i := 0; i < 2; i++ {
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected resolver %d to be cancelled when the client disconnected", i+1)
+		}
+	}
+}
+
 func TestMutationCancel(t *testing.T) {
 	h := handler.New(
 		[]string{"type Mutation{m:Int!}"},
@@ -191,3 +411,27 @@ func TestMutationCancel(t *testing.T) {
 		t.Fatalf("Expected returned JSON to contain an error about canceled context but got %q", writer.Body.String())
 	}
 }
+
+// TestNewE checks that problems creating a handler are returned as errors (rather than terminating the program)
+func TestNewE(t *testing.T) {
+	type Item struct {
+		Name string `egg:",unknown_option"`
+	}
+	errorData := map[string]struct {
+		schema   string
+		data     interface{}
+		expected string // expected error text
+	}{
+		"BadSchema": {"type Query { v: Int! ", struct{ V int }{}, "error making schema"},
+		"BadTag":    {"type Query { v: Int! }", struct{ V func(int) int }{}, "getting field V"},
+		"BadNested": {"type Query { item: Item! } type Item { name: String! }", struct{ Item Item }{},
+			"unknown option"},
+	}
+	for name, data := range errorData {
+		t.Run(name, func(t *testing.T) {
+			h, err := handler.NewE([]string{data.schema}, nil, [3][]interface{}{{data.data}, nil, nil})
+			Assertf(t, h == nil && err != nil && strings.Contains(err.Error(), data.expected),
+				"expected error %q got %v", data.expected, err)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+// errorbudget.go limits the number of errors in a response (see MaxErrors option) so that a pathological query
+// (eg a list of thousands of elements that all fail) does not produce a huge response (or flood the logs)
+
+import (
+	"fmt"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// limitErrors returns the errors to include in a response.  If there are more than maxErrors (and maxErrors is
+// not zero) the list is truncated and a final error is added saying how many more errors there were.
+func (h *Handler) limitErrors(errs gqlerror.List) gqlerror.List {
+	if h.maxErrors <= 0 || len(errs) <= h.maxErrors {
+		return errs
+	}
+	more := len(errs) - h.maxErrors
+	message := fmt.Sprintf("and %d more errors", more)
+	if more == 1 {
+		message = "and 1 more error"
+	}
+	return append(errs[:h.maxErrors:h.maxErrors], &gqlerror.Error{
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code":      "TOO_MANY_ERRORS",
+			"omitted":   more,
+			"maxErrors": h.maxErrors,
+		},
+	})
+}
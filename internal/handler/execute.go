@@ -5,9 +5,9 @@ package handler
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/dolmen-go/jsonmap"
-	"github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 	"github.com/vektah/gqlparser/v2/validator"
@@ -22,6 +22,13 @@ type (
 		Query         string
 		OperationName string
 		Variables     map[string]interface{} // raw variables from the JSON request
+		Extensions    map[string]interface{} // optional extensions (eg "omitNulls") from the JSON request
+
+		clientKey   string          // identifies the client for field rate limits
+		rateLimits  rateLimitReport // status of rate limited fields resolved in the request
+		cacheCounts *cacheCounts    // cache hits and misses of the current operation (for the audit record)
+		arena       *resultArena    // provides maps and slices for the result (see ResultArena option)
+		tracer      *tracer         // records the timing of the request (see Tracing option)
 	}
 
 	// gqlResult contains the result (or errors) of the request to be encoded in JSON
@@ -30,78 +37,201 @@ type (
 		// We use a jsonmap.Ordered rather than a map[string]interface{} to remember the order since
 		// the query result should have the same order as the query.  A nested query result is stored
 		// as a jsonmap.Ordered (as interface{}) within the Data whereas a list is stored as a slice.
-		Data   jsonmap.Ordered `json:"data,omitempty"`
-		Errors gqlerror.List   `json:"errors,omitempty"`
+		Data       jsonmap.Ordered        `json:"data,omitempty"`
+		Errors     gqlerror.List          `json:"errors,omitempty"`
+		Extensions map[string]interface{} `json:"extensions,omitempty"`
 	}
 )
 
+// omitNullsExtension is the name of the request extension a client can use to ask for null fields to be omitted
+const omitNullsExtension = "omitNulls"
+
+// addTypenameExtension is the name of the request extension a client can use to ask for __typename in all objects
+const addTypenameExtension = "addTypename"
+
+// extensionFlag returns true if the request extensions contain a boolean value of true for name
+func extensionFlag(extensions map[string]interface{}, name string) bool {
+	on, _ := extensions[name].(bool)
+	return on
+}
+
 // ExecuteHTTP parses and runs the request (Query field) and returns the result
 func (g *gqlRequest) ExecuteHTTP(ctx context.Context) (r gqlResult) {
+	if g.tracing {
+		g.tracer = newTracer()
+	}
+	defer func() {
+		r.Errors = g.limitErrors(r.Errors)
+		r.Extensions = g.rateLimits.extensions()
+		if g.tracer != nil {
+			if r.Extensions == nil {
+				r.Extensions = make(map[string]interface{}, 1)
+			}
+			r.Extensions[tracingExtension] = g.tracer.extension()
+		}
+	}()
+
+	if g.opTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.opTimeout)
+		defer cancel()
+	}
+
+	// Get the query text from the query store if the client only sent its hash (automatic persisted queries)
+	var err *gqlerror.Error
+	if g.Query, err = g.persistedQuery(g.Query, g.Extensions); err != nil {
+		r.Errors = gqlerror.List{err}
+		return
+	}
+
 	// Get the analysed and validated query from the query text
-	query, errors := gqlparser.LoadQuery(g.schema, g.Query)
+	secrets := g.secretValues(g.Query, g.Variables)
+	query, errors := g.tracer.loadQuery(g.Handler, g.Query)
 	if errors != nil {
+		redactErrors(errors, secrets)
 		r.Errors = errors
 		return
 	}
+	foldDirectives(query)
 
-	// Now process the operation(s)
+	// Now process the operation (selected using the operation name if the query has more than one)
+	operation, err := selectOperation(query, g.OperationName)
+	if err != nil {
+		r.Errors = gqlerror.List{err}
+		return
+	}
 	r.Data.Data = make(map[string]interface{})
-	for _, operation := range query.Operations {
-		op := gqlOperation{
-			Handler: g.Handler,
-		}
+	start := time.Now()
+	g.cacheCounts = &cacheCounts{}
+	g.checkDeprecated(ctx, operation, g.clientKey)
+	g.executeOperation(ctx, operation, &r)
+	redactErrors(r.Errors, secrets)
+	if g.auditor != nil {
+		g.auditor.record(g.operationRecord(operation, start, r.Errors))
+	}
+	return
+}
 
-		// Get variables associated with this operation if any
-		if len(operation.VariableDefinitions) > 0 {
-			var pgqlError *gqlerror.Error
-			if op.variables, pgqlError = validator.VariableValues(g.schema, operation, g.Variables); pgqlError != nil {
-				r.Errors = append(r.Errors, pgqlError)
-				continue // skip this op if we can't get the vars
+// selectOperation returns the operation of a query document to execute.  If the document has more than one
+// operation the name (operationName of the request) must be given to select one (see GraphQL spec. GetOperation).
+func selectOperation(query *ast.QueryDocument, name string) (*ast.OperationDefinition, *gqlerror.Error) {
+	if operation := query.Operations.ForName(name); operation != nil {
+		return operation, nil
+	}
+	if name != "" {
+		return nil, &gqlerror.Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+	}
+	return nil, &gqlerror.Error{Message: "Must provide operation name if query contains multiple operations."}
+}
+
+// operationVariables gets the (validated and coerced) values of the variables of an operation from the
+// raw (decoded JSON) variables of the request, after passing them to the variable hook (if any)
+func (h *Handler) operationVariables(ctx context.Context, operation *ast.OperationDefinition,
+	raw map[string]interface{},
+) (map[string]interface{}, *gqlerror.Error) {
+	if h.variableHook != nil {
+		raw = copyValue(raw).(map[string]interface{}) // so changes made by the hook don't affect other operations
+		if err := h.variableHook(ctx, raw); err != nil {
+			return nil, &gqlerror.Error{
+				Message:    err.Error(),
+				Extensions: map[string]interface{}{"operation": operation.Name},
 			}
 		}
+	}
+	if err := h.enumVariables(operation, raw); err != nil {
+		err.Extensions = map[string]interface{}{"operation": operation.Name}
+		return nil, err
+	}
+	return validator.VariableValues(h.schema, operation, raw)
+}
+
+// copyValue makes a deep copy of a value decoded from JSON (maps and slices are copied)
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(v))
+		for k, elt := range v {
+			r[k] = copyValue(elt)
+		}
+		return r
+	case []interface{}:
+		r := make([]interface{}, len(v))
+		for i, elt := range v {
+			r[i] = copyValue(elt)
+		}
+		return r
+	}
+	return v
+}
 
-		var data []interface{}
-		switch operation.Operation {
-		case ast.Query:
-			data = g.qData
-		case ast.Mutation:
-			op.isMutation = true
-			data = g.mData
-		case ast.Subscription:
-			op.isSubscription = true
-			// Subscriptions cannot be handled here (needs websocket handler)
-			r.Errors = append(r.Errors, &gqlerror.Error{
-				Message:    fmt.Sprintf("subscription %s requires websocket", operation.Name),
-				Extensions: map[string]interface{}{"operation": operation.Name},
-			})
-			return
-		default:
-			panic("unknown operation: " + string(operation.Operation))
+// executeOperation runs the operation of the request adding the results (or errors) to r
+func (g *gqlRequest) executeOperation(ctx context.Context, operation *ast.OperationDefinition, r *gqlResult) {
+	op := gqlOperation{
+		Handler:       g.Handler,
+		omitNulls:     g.Handler.omitNulls || extensionFlag(g.Extensions, omitNullsExtension),
+		addTypename:   g.Handler.addTypename || extensionFlag(g.Extensions, addTypenameExtension),
+		clientKey:     g.clientKey,
+		rateLimits:    &g.rateLimits,
+		cacheCounts:   g.cacheCounts,
+		arena:         g.arena,
+		tracer:        g.tracer,
+		elementErrors: &elementErrors{},
+		elementCaches: &scopedCaches{},
+		pool:          g.newWorkerPool(),
+	}
+
+	// Get variables associated with this operation if any
+	if len(operation.VariableDefinitions) > 0 {
+		var pgqlError *gqlerror.Error
+		if op.variables, pgqlError = g.operationVariables(ctx, operation, g.Variables); pgqlError != nil {
+			r.Errors = append(r.Errors, pgqlError)
+			return // can't run the op if we can't get the vars
 		}
-		result, err := op.GetSelections(ctx, operation.SelectionSet, data, nil)
-		if err != nil {
+	}
+
+	var data []interface{}
+	switch operation.Operation {
+	case ast.Query:
+		data = g.qData
+	case ast.Mutation:
+		op.isMutation = true
+		data = g.mData
+	case ast.Subscription:
+		op.isSubscription = true
+		// Subscriptions cannot be handled here (needs websocket handler)
+		r.Errors = append(r.Errors, &gqlerror.Error{
+			Message:    fmt.Sprintf("subscription %s requires websocket", operation.Name),
+			Extensions: map[string]interface{}{"operation": operation.Name},
+		})
+		return
+	default:
+		panic("unknown operation: " + string(operation.Operation))
+	}
+	if pgqlError := op.checkComplexity(operation, data); pgqlError != nil {
+		r.Errors = append(r.Errors, pgqlError)
+		return
+	}
+	ctx = withMeta(ctx, g.Handler) // see Meta
+	result, err := op.GetSelections(ctx, operation.SelectionSet, data, nil)
+	if err != nil {
+		r.Errors = append(r.Errors, gqlError(err, operation))
+		return
+	}
+	r.Errors = append(r.Errors, op.elementErrors.errors(operation)...)
+	// Add all the results to the map to be returned, checking for duplicates
+	for _, k := range result.Order {
+		if _, ok := r.Data.Data[k]; ok {
 			r.Errors = append(r.Errors, &gqlerror.Error{
-				Message:    err.Error(),
+				Message:    fmt.Sprintf("resolver %q in %s has duplicate name", k, operation.Name),
 				Extensions: map[string]interface{}{"operation": operation.Name},
 			})
 			return
 		}
-		// Add all the results to the map to be returned, checking for duplicates
-		for _, k := range result.Order {
-			if _, ok := r.Data.Data[k]; ok {
-				r.Errors = append(r.Errors, &gqlerror.Error{
-					Message:    fmt.Sprintf("resolver %q in %s has duplicate name", k, operation.Name),
-					Extensions: map[string]interface{}{"operation": operation.Name},
-				})
-				return
-			}
-			r.Data.Data[k] = result.Data[k]
-		}
-		// Add all the corresponding map keys
-		r.Data.Order = append(r.Data.Order, result.Order...)
-		if len(r.Data.Order) != len(r.Data.Data) {
-			panic("map and slice in the jsonmap.Ordered should be the same size")
-		}
+		r.Data.Data[k] = result.Data[k]
+	}
+	// Add all the corresponding map keys
+	r.Data.Order = append(r.Data.Order, result.Order...)
+	if len(r.Data.Order) != len(r.Data.Data) {
+		panic("map and slice in the jsonmap.Ordered should be the same size")
 	}
-	return
 }
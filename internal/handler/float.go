@@ -0,0 +1,24 @@
+package handler
+
+// float.go formats Float values in query results (see FloatFormat option) rather than leaving it to encoding/json
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// formatFloat returns the value of a float (of any float type, including custom scalars) formatted using the
+// FloatFormat option as a json.Number, so that it is encoded as a JSON number.  It returns false if the option is
+// not used, v is not a float or has a value (infinity or NaN) that can't be represented in JSON.
+func (op *gqlOperation) formatFloat(v reflect.Value) (json.Number, bool) {
+	if op.floatFormat == 0 || v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+		return "", false
+	}
+	f := v.Float()
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	return json.Number(strconv.FormatFloat(f, op.floatFormat, op.floatPrecision, v.Type().Bits())), true
+}
@@ -0,0 +1,70 @@
+package handler
+
+// fold.go removes selections excluded by @skip/@include directives with literal (not variable) arguments once per
+// request, rather than checking the directives every time a field is resolved (eg for every element of a list)
+
+import (
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// foldDirectives removes selections that are excluded by a @skip or @include directive with a literal argument
+// (eg @skip(if: true)), and removes those directives from selections that are not excluded.  Directives that use
+// a variable are left to be handled when the field is resolved (see directiveBypass).
+func foldDirectives(query *ast.QueryDocument) {
+	for _, operation := range query.Operations {
+		operation.SelectionSet = foldSelections(operation.SelectionSet)
+	}
+	// Fragments are folded once here (not for every spread) as spreads share the fragment definition
+	for _, fragment := range query.Fragments {
+		fragment.SelectionSet = foldSelections(fragment.SelectionSet)
+	}
+}
+
+// foldSelections returns the selections (recursively) that are not excluded by literal @skip/@include directives
+func foldSelections(set ast.SelectionSet) ast.SelectionSet {
+	r := set[:0] // filter in place
+	for _, s := range set {
+		switch s := s.(type) {
+		case *ast.Field:
+			var excluded bool
+			if s.Directives, excluded = foldDirectiveList(s.Directives); excluded {
+				continue
+			}
+			s.SelectionSet = foldSelections(s.SelectionSet)
+		case *ast.InlineFragment:
+			var excluded bool
+			if s.Directives, excluded = foldDirectiveList(s.Directives); excluded {
+				continue
+			}
+			s.SelectionSet = foldSelections(s.SelectionSet)
+		case *ast.FragmentSpread:
+			var excluded bool
+			if s.Directives, excluded = foldDirectiveList(s.Directives); excluded {
+				continue
+			}
+		}
+		r = append(r, s)
+	}
+	return r
+}
+
+// foldDirectiveList checks the @skip and @include directives that have a literal argument, returning true if the
+// selection is excluded, else the directives that still need to be checked (ie all except the literal ones)
+func foldDirectiveList(list ast.DirectiveList) (ast.DirectiveList, bool) {
+	r := list[:0:0] // don't filter in place as the list may be shared
+	for _, d := range list {
+		if d.Name != "skip" && d.Name != "include" {
+			r = append(r, d)
+			continue
+		}
+		arg := d.Arguments.ForName("if")
+		if arg == nil || arg.Value == nil || arg.Value.Kind != ast.BooleanValue {
+			r = append(r, d) // variable (decided when resolving)
+			continue
+		}
+		if (arg.Value.Raw == "true") == (d.Name == "skip") {
+			return nil, true
+		}
+	}
+	return r, false
+}
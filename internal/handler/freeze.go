@@ -0,0 +1,76 @@
+package handler
+
+// freeze.go allows the resolvers of root structs (passed as pointers) to be assigned after the handler is created,
+// eg by a dependency injection framework, with requests rejected until Freeze is called (see LazyInit option)
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+)
+
+// Freeze marks the end of the initialisation of the resolvers of the root structs (see LazyInit option), after which
+// requests are handled.  It returns an error (and requests are still rejected) if a resolver function of a root
+// struct is still nil, unless nil resolvers are allowed (see NilResolverAllowed).  The root structs must not be
+// changed after Freeze is called.  Calling Freeze more than once has no effect.
+func (h *Handler) Freeze() error {
+	if atomic.LoadInt32(&h.frozen) != 0 {
+		return nil
+	}
+	if !h.nilResolver {
+		for _, roots := range [][]interface{}{h.qData, h.mData, h.subscriptionData} {
+			for _, root := range roots {
+				if err := checkNilResolvers(reflect.ValueOf(root)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	atomic.StoreInt32(&h.frozen, 1) // requests (in other go-routines) now see the assigned resolvers
+	return nil
+}
+
+// checkNilResolvers returns an error if a struct (or an embedded struct) has a resolver function that is nil
+func checkNilResolvers(v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < v.NumField(); i++ {
+		tField := v.Type().Field(i)
+		if !tField.IsExported() {
+			continue
+		}
+		switch vField := v.Field(i); {
+		case tField.Anonymous:
+			if err := checkNilResolvers(vField); err != nil {
+				return err
+			}
+		case vField.Kind() == reflect.Func && vField.IsNil():
+			name := tField.Name
+			if v.Type().Name() != "" {
+				name = v.Type().Name() + "." + name
+			}
+			return fmt.Errorf("resolver %s has not been assigned", name)
+		}
+	}
+	return nil
+}
+
+// checkFrozen returns false (after sending a response with HTTP status 503) if the handler is waiting for the root
+// resolvers to be initialised (see LazyInit option)
+func (h *Handler) checkFrozen(w http.ResponseWriter) bool {
+	if !h.lazyInit || atomic.LoadInt32(&h.frozen) != 0 {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/graphql+json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"data": null,"errors": [{"message": "Error: resolvers have not been initialised"}]}`))
+	return false
+}
@@ -8,10 +8,16 @@ package handler
 // returned handler's ServeHTTP method (hence implements http.Handler interface)
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -40,6 +46,12 @@ type (
 		// Note: the map is created (or set to nil) before handling of queries so reading the map itself is safe
 		// to do concurrently but modifying its contents (adding entries, etc) must be protected with the mutex
 		Cache ResolverCache // cached values of this resolver
+		// Limiter limits how often each client can resolve the field, or is nil if there is no "rateLimit" option
+		Limiter *rateLimiter
+		// Batch is set for a resolver with the "batch" option, which is called once for all elements of a list
+		Batch bool
+		// Complexity has the factors (integers or argument names) of the "complexity" option (see MaxComplexity)
+		Complexity []string
 	}
 
 	// CacheKey allows us to uniquely identify a cached value for a resolver
@@ -50,12 +62,27 @@ type (
 	CacheKey struct {
 		fieldValue reflect.Value // the Go data (struct field) holding the resolver value
 		args       string        // arguments (zero or more) as strings separated by nul (\x00) bytes
+		element    elementID     // identifies the list element instead of fieldValue (see elementcache.go)
 		// TODO: allow for private cache by also including a connection (string?) in the key
 	}
 	// ResolverCache contains a map (see CacheKey above) and a mutex to protect concurrent access to it
 	ResolverCache struct {
 		Mtx   *sync.Mutex                // protects concurrent access of the following map
 		Saved map[CacheKey]reflect.Value // cached values of the resolver
+		stats *cacheCounts               // hits and misses of the resolver (see CacheStats)
+		swr   *swrCache                  // if not nil, when values were saved (see "cache" option in swr.go)
+		// limits (if not nil) expires and evicts values (see CacheTTL and CacheMaxEntries in cachelimits.go)
+		limits *cacheLimits
+		// shared (if not nil) means values are kept in a cache backend rather than Saved (see cachebackend.go)
+		shared *sharedCache
+	}
+	// scopedCaches holds the resolver caches of one operation (a subscription), which are used in place of the shared
+	// caches so that values cached by a long-running subscription are not kept after the subscription ends.
+	// The map key is the (shared) cache's mutex which uniquely identifies the resolver.
+	scopedCaches struct {
+		mtx   sync.Mutex
+		m     map[*sync.Mutex]ResolverCache
+		users int // number of subscription (chan) handlers using the caches - they are released when this goes to zero
 	}
 
 	// Handler stores the invariants (schema and structs) used in the GraphQL requests
@@ -82,36 +109,208 @@ type (
 		// resolver options
 		funcCache       bool // In the absence of cache directives results of resolver functions are cached (forever)
 		noIntrospection bool // Disallows introspection queries
-		noConcurrency   bool // Disables concurrent processing of queries (though mutations are never processed concurrently)
-		nilResolver     bool // If a resolver is a nil func then the resolver returns null instead of an error
+		// cacheTTL (if not zero) is how long cached resolver values are used and cacheMaxEntries (if not zero) limits
+		// the values in each resolver cache by evicting the least recently used (see cachelimits.go)
+		cacheTTL        time.Duration
+		cacheMaxEntries int
+		// cacheBackend (if not nil) keeps cached resolver values outside the process (see SharedCache option)
+		cacheBackend CacheBackend
+		// descriptions are the descriptions for introspection in other languages keyed by language then type/field
+		descriptions map[string]map[string]string
+		// introspectionPolicy (if not nil) decides which types/fields are visible in introspection for a request
+		introspectionPolicy func(ctx context.Context, typeName, fieldName string) bool
+		noConcurrency       bool                       // Disables concurrent processing of queries (though mutations are never processed concurrently)
+		resolverSem         chan struct{}              // if not nil, limits the number of go-routines running resolvers
+		requestWorkers      int                        // if > 0, resolvers of an operation are run by a pool of this many workers
+		lazyInit            bool                       // requests are rejected until Freeze is called (see freeze.go)
+		frozen              int32                      // set (atomically) by Freeze
+		nilResolver         bool                       // If a resolver is a nil func then the resolver returns null instead of an error
+		missingResolverNull bool                       // A nullable field with no resolver is null (for schemas supplied as SDL)
+		omitNulls           bool                       // Fields of nullable type that resolve to null are left out of the response
+		addTypename         bool                       // Every object in the response includes __typename even if not requested
+		idPattern           *regexp.Regexp             // if not nil, ID values supplied by the client must match
+		rateLimitKey        func(*http.Request) string // gets the key identifying a client for field rate limits
+		requestLimiter      *requestLimiter            // if not nil, limits the rate of requests of each client
+		requestSem          chan struct{}              // if not nil, limits the number of requests handled at once
+		opTimeout           time.Duration              // if not zero, the deadline for each query/mutation request
+		maxRequestSize      int64                      // max. size (bytes) of a POST request body
+		maxBatchSize        int                        // max. number of requests in a batch (negative = no batches)
+		maxComplexity       int                        // if not zero, operations with a greater complexity are rejected
+		maxErrors           int                        // if not zero, the max. number of errors in a response (see MaxErrors)
+		specVersion         string                     // version of the GraphQL spec the schema must conform to (eg June2018)
+		// lookupReported (if not nil) turns on diagnostics of resolver lookup misses and records those already
+		// reported (see lookupdiag.go)
+		lookupReported *sync.Map
+		// variableHook (if not nil) can inspect/modify an operation's variables before they are validated/coerced
+		variableHook func(ctx context.Context, variables map[string]interface{}) error
+		// resolverMiddleware are called (first to last) around the resolving of each field (see middleware.go)
+		resolverMiddleware []ResolverMiddlewareFunc
+		// directives are the functions of custom directives (keyed by name) called when resolving fields (see directive.go)
+		directives map[string]DirectiveFunc
+		// resultArena turns on reuse of the maps and slices used to build query results (see arena.go)
+		resultArena bool
+		// tracing adds the timing of resolvers to the response in the "tracing" extension (see tracing.go)
+		tracing bool
+		// secretArgs are the names of arguments whose values are redacted from error messages (see secrets.go)
+		secretArgs map[string]bool
+		// types are the (object) types only returned by resolvers that return an interface (see Types option)
+		types []reflect.Type
+		// dateTimeFormat is the layout used to encode and decode DateTime (time.Time) values (see DateTimeFormat)
+		dateTimeFormat string
+		// floatFormat and floatPrecision (see FloatFormat option) are used to format Float values in results
+		floatFormat    byte
+		floatPrecision int
+		// caseInsensitiveEnums allows clients to use enum values that only differ in case from those in the schema
+		caseInsensitiveEnums bool
+		// unknownEnumMessage (if not nil) makes the error message when a client uses a value not in an enum
+		unknownEnumMessage func(enum, value string, valid []string) string
+		// intEnums makes enums (all or those in intEnumNames) integers in results, arguments and variables
+		intEnums     bool
+		intEnumNames map[string]bool
+
+		// persistedOps are the queries registered for GET requests, which are checked and stored in persisted
+		persistedOps map[string]PersistedOperation
+		persisted    map[string]persistedQuery
+		// queryStore (if not nil) saves queries for automatic persisted queries (see apq.go) and in allow-list mode
+		// only queries already in the store can be executed
+		queryStore   QueryStore
+		apqAllowList bool
+
+		// sdl is the schema (GraphQL schema definition language) which is returned for GET requests to ".../schema"
+		// if serveSchema is on (see Schema method)
+		sdl         string
+		serveSchema bool
+
+		// shadowCandidates are the candidate resolvers (keyed by "Type.field") run alongside the current resolvers of
+		// queries with any differences in the results passed to the observer (see Shadow option)
+		shadowCandidates map[string]reflect.Value
+		shadowSem        chan struct{} // limits the number of candidates running at once
+
+		// observer (if not nil) is passed events that are not returned to clients (see Observer option)
+		observer ObserverFunc
+
+		// serveDocs enables documentation of the schema (in docsHTML or docsMarkdown) for GET requests to ".../docs"
+		serveDocs    bool
+		docsHTML     string
+		docsMarkdown string
+		docsErr      error // error generating docsHTML or docsMarkdown (returned by GET requests for the docs)
+		// servePlan enables the execution plan of a query (see plan.go) for GET requests to ".../plan"
+		servePlan bool
+
+		// audit options - if auditSink is not nil a record of every operation is sent to it (via the auditor)
+		auditSink          AuditSink
+		auditBatchSize     int
+		auditFlushInterval time.Duration
+		auditor            *auditor
+
+		// deprecation options - responses to requests using deprecated fields or arguments have a Deprecation header
+		// (and Sunset header if sunset is not zero) if deprecationHeaders is set, and uses are counted for each
+		// client if deprecationUsage is not nil (see deprecation.go)
+		deprecationHeaders      bool
+		deprecatedSince, sunset time.Time
+		deprecationUsage        *deprecationUsage
+		maxDeprecatedUses       int // max. number of uses counted (see DeprecationUsageLimit)
+
+		// contextFunc (if not nil) makes the context for a request (HTTP or websocket upgrade), eg for auth values
+		contextFunc func(ctx context.Context, r *http.Request) (context.Context, error)
 
 		// websocket options
+		// wsContext (if not nil) makes the context for all operations on a websocket from the upgrade request
+		wsContext func(ctx context.Context, r *http.Request) (context.Context, error)
+		// initContext (if not nil) adds to the context of a websocket using the payload of the connection_init message
+		initContext    func(ctx context.Context, payload map[string]interface{}) (context.Context, error)
 		initialTimeout time.Duration // how long to wait for connection_init after the WS is opened
 		pingFrequency  time.Duration // how often to send a ping (ka in old protocol) message to the client
 		pongTimeout    time.Duration // how long to wait for a pong after sending a ping
+		// subprotocols are the accepted websocket sub-protocols in order of preference, where the first is assumed
+		// if the client offers none of them, unless requireSubprotocol is set (the upgrade request is rejected)
+		subprotocols       []string
+		requireSubprotocol bool
 	}
 )
 
 // New creates a new handler with the given schema(s) and query/mutation/subscription struct(s)
+// It terminates the program (using log.Fatalf) if the handler can't be created - use NewE to handle the error.
 // Parameters:
 //
-//			schemaStrings - a slice of strings containing the GraphQL schema(s) - typically only 1
-//			enums - a map of enum names to a slice of strings containing the enum values for all the schemas
-//	       can be nil if there are no enums
-//			qms - a slice of query/mutation/subscription structs where:
-//			  qms[0] - query struct(s)
-//			  qms[1] - mutation struct(s)
-//			  qms[2] - subscription struct(s)
-//			options - zero or more options returned by calls to:
-//		      handler.FuncCache
-//		      handler.NoIntrospection
-//		      handler.NoConcurrency
-//		      handler.NilResolver
-//			  handler.InitialTimeout
-//			  handler.PingFrequency
-//			  handler.PongTimeout
+//	schemaStrings - a slice of strings containing the GraphQL schema(s) - typically only 1
+//	enums - a map of enum names to a slice of strings containing the enum values for all the schemas
+//	  can be nil if there are no enums
+//	qms - a slice of query/mutation/subscription structs where:
+//	  qms[0] - query struct(s)
+//	  qms[1] - mutation struct(s)
+//	  qms[2] - subscription struct(s)
+//	options - zero or more options returned by calls to:
+//	  handler.FuncCache
+//	  handler.CacheTTL
+//	  handler.CacheMaxEntries
+//	  handler.SharedCache
+//	  handler.NoIntrospection
+//	  handler.IntrospectionPolicy
+//	  handler.LocalizedDescriptions
+//	  handler.NoConcurrency
+//	  handler.MaxResolverGoroutines
+//	  handler.RequestWorkers
+//	  handler.NilResolver
+//	  handler.LazyInit
+//	  handler.MissingResolverNull
+//	  handler.LookupDiagnostics
+//	  handler.OmitNulls
+//	  handler.AddTypename
+//	  handler.IDPattern
+//	  handler.RateLimitKey
+//	  handler.RateLimit
+//	  handler.MaxConcurrentRequests
+//	  handler.OperationTimeout
+//	  handler.MaxRequestSize
+//	  handler.MaxBatchSize
+//	  handler.MaxComplexity
+//	  handler.MaxErrors
+//	  handler.SpecVersion
+//	  handler.VariableHook
+//	  handler.ResolverMiddleware
+//	  handler.Directives
+//	  handler.ResultArena
+//	  handler.Tracing
+//	  handler.SecretArgs
+//	  handler.Types
+//	  handler.DateTimeFormat
+//	  handler.FloatFormat
+//	  handler.CaseInsensitiveEnums
+//	  handler.UnknownEnumMessage
+//	  handler.IntEnums
+//	  handler.PersistedOperations
+//	  handler.AutomaticPersistedQueries
+//	  handler.Audit
+//	  handler.DeprecationHeaders
+//	  handler.DeprecationUsage
+//	  handler.DeprecationUsageLimit
+//	  handler.ServeDocs
+//	  handler.ServeSchema
+//	  handler.ServePlan
+//	  handler.Shadow
+//	  handler.Observer
+//	  handler.ContextFunc
+//	  handler.WebSocketContext
+//	  handler.InitContext
+//	  handler.InitialTimeout
+//	  handler.PingFrequency
+//	  handler.PongTimeout
+//	  handler.Subprotocols
+//	  handler.RequireSubprotocol
 func New(schemaStrings []string, enums map[string][]string, qms [3][]interface{}, options ...func(*Handler),
 ) http.Handler {
+	h, err := NewE(schemaStrings, enums, qms, options...)
+	if err != nil {
+		log.Fatalf("eggql.handler.New - %s\n", err)
+	}
+	return h
+}
+
+// NewE is like New but returns an error, rather than terminating the program, if the handler can't be created
+// (eg the schema is invalid)
+func NewE(schemaStrings []string, enums map[string][]string, qms [3][]interface{}, options ...func(*Handler),
+) (http.Handler, error) {
 	h := &Handler{}
 	h.SetOptions(options...)
 
@@ -125,10 +324,22 @@ func New(schemaStrings []string, enums map[string][]string, qms [3][]interface{}
 	var pgqlError *gqlerror.Error
 	h.schema, pgqlError = gqlparser.LoadSchema(sources...)
 	if pgqlError != nil {
-		log.Fatalf("eggql.handler.New - error making schema error %s\n", error(pgqlError))
+		h.Close()
+		return nil, fmt.Errorf("error making schema: %w", pgqlError)
+	}
+	if err := h.checkOptions(); err != nil {
+		h.Close()
+		return nil, err
 	}
 
+	h.sdl = strings.Join(schemaStrings, "\n")
 	h.enums, h.enumsReverse = makeEnumTables(enums)
+	h.addSchemaEnums()
+	if h.serveDocs {
+		if h.docsHTML, h.docsErr = docs(h.schema, true); h.docsErr == nil {
+			h.docsMarkdown, h.docsErr = docs(h.schema, false)
+		}
+	}
 
 	h.qData = qms[0]
 	h.mData = qms[1]
@@ -136,7 +347,7 @@ func New(schemaStrings []string, enums map[string][]string, qms [3][]interface{}
 
 	if !h.noIntrospection {
 		// Add data for introspection
-		h.qData = append(h.qData, NewIntrospectionData(h.schema))
+		h.qData = append(h.qData, newIntrospectionData(h.schema, h.introspectionPolicy, h.localDescriptions))
 		for enumName, list := range IntroEnums {
 			enum := make([]string, 0, len(list))
 			enumInt := make(map[string]int, len(list))
@@ -149,9 +360,58 @@ func New(schemaStrings []string, enums map[string][]string, qms [3][]interface{}
 		}
 	}
 
-	h.makeResolverTables()
+	if err := h.makeResolverTables(); err != nil {
+		h.Close()
+		return nil, err
+	}
 
-	return h
+	return h, nil
+}
+
+// checkOptions returns an error if an option is invalid (or not valid for the schema)
+func (h *Handler) checkOptions() error {
+	if err := CheckSpecVersion(h.schema, h.specVersion); err != nil {
+		return fmt.Errorf("schema error: %w", err)
+	}
+
+	for _, protocol := range h.subprotocols {
+		if protocol != oldSubprotocol && protocol != newSubprotocol {
+			return fmt.Errorf("unknown websocket sub-protocol %q", protocol)
+		}
+	}
+
+	if h.persistedOps != nil {
+		var err error
+		if h.persisted, err = loadPersisted(h.schema, h.persistedOps); err != nil {
+			return err
+		}
+	}
+
+	if h.floatFormat != 0 && !strings.ContainsRune("feEgG", rune(h.floatFormat)) {
+		return fmt.Errorf("invalid float format %q", h.floatFormat)
+	}
+	if h.shadowCandidates != nil && h.observer == nil {
+		return errors.New("shadow candidates need an Observer to report differences")
+	}
+	for name, candidate := range h.shadowCandidates {
+		if candidate.Kind() != reflect.Func {
+			return fmt.Errorf("shadow candidate for %q must be a function", name)
+		}
+		typeName, fieldName, _ := strings.Cut(name, ".")
+		def := h.schema.Types[typeName]
+		if def == nil || def.Kind != ast.Object || def.Fields.ForName(fieldName) == nil {
+			return fmt.Errorf("shadow candidate %q is not a field of an object type of the schema", name)
+		}
+		if def == h.schema.Mutation || def == h.schema.Subscription {
+			return fmt.Errorf("shadow candidate %q is not a query field", name)
+		}
+	}
+	return nil
+}
+
+// Schema returns the GraphQL schema (SDL) used by the handler, eg to save to a file or pass to code generators
+func (h *Handler) Schema() string {
+	return h.sdl
 }
 
 // ServerHTTP receives a GraphQL query as an HTTP request, executes the
@@ -164,6 +424,40 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	if h.serveDocs && r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/docs") {
+		h.writeDocs(w, r)
+		return
+	}
+	if h.serveSchema && r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/schema") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, h.sdl)
+		return
+	}
+	if h.servePlan && r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/plan") {
+		h.writePlan(w, r)
+		return
+	}
+	if !h.checkFrozen(w) {
+		return
+	}
+	if h.descriptions != nil {
+		r = r.WithContext(withLanguages(r.Context(), r.Header.Get("Accept-Language")))
+	}
+	if h.contextFunc != nil {
+		// Add values (eg the user from a JWT in the Authorization header) to the context seen by the resolvers
+		ctx, err := h.contextFunc(r.Context(), r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/graphql+json")
+			w.WriteHeader(http.StatusUnauthorized)
+			msg, _ := json.Marshal(err.Error())
+			w.Write([]byte(`{"data": null,"errors": [{"message": ` + string(msg) + `}]}`))
+			return
+		}
+		r = r.WithContext(ctx)
+	}
+	if !h.checkRequestRate(w, r) {
+		return
+	}
 	if r.Header.Get("Upgrade") == "websocket" {
 		// Call websocket handler
 		h.serveWS(w, r)
@@ -174,19 +468,44 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "GraphQL queries must use GET or POST", http.StatusMethodNotAllowed)
 		return
 	}
+	if !h.acquireRequest(w) {
+		return
+	}
+	defer h.releaseRequest()
 
 	// Decode the GET or POST request (JSON)
-	g := gqlRequest{Handler: h}
-	if r.Method == http.MethodGet {
+	g := gqlRequest{Handler: h, clientKey: h.rateLimitKey(r)}
+	if r.Method == http.MethodGet && h.persisted != nil && r.URL.Query().Get(persistedOperationParam) != "" {
+		// GET of a persisted operation (by name) with variables from the other query parameters
+		values := r.URL.Query()
+		p, ok := h.persisted[values.Get(persistedOperationParam)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"data": null,"errors": [{"message": "Error: persisted operation not found"}]}`))
+			return
+		}
+		g.Query = p.query
+		var err error
+		if g.Variables, err = p.getVariables(h.schema, values); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			msg, _ := json.Marshal("Error getting variables: " + err.Error())
+			w.Write([]byte(`{"data": null,"errors": [{"message": ` + string(msg) + `}]}`))
+			return
+		}
+	} else if r.Method == http.MethodGet {
 		// if it's a GET we assume the GraphQL query is passed as a "query" query parameter
 		values := r.URL.Query()
 		// find the query parameter with name "query" which contains the GraphQL query (or mutation or subscription)
-		if len(values["query"]) != 1 {
+		// which may be left out if the query's hash is given in the extensions (automatic persisted queries)
+		if len(values["query"]) > 1 || len(values["query"]) == 0 && len(values["extensions"]) == 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(`{"data": null,"errors": [{"message": "Error: query parameter is required"}]}`))
 			return
 		}
-		g.Query = values["query"][0]
+		if len(values["query"]) > 0 {
+			g.Query = values["query"][0]
+		}
+		g.OperationName = values.Get("operationName")
 		// get GraphQL variables from "variables" query parameter
 		if len(values["variables"]) > 0 {
 			vars := values["variables"][0]
@@ -201,23 +520,48 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
+		// get any extensions (JSON object) from "extensions" query parameter
+		if len(values["extensions"]) > 0 {
+			if err := json.Unmarshal([]byte(values["extensions"][0]), &g.Extensions); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"data": null,"errors": [{"message": "Error decoding JSON extensions:` + err.Error() + `"}]}`))
+				return
+			}
+		}
 	} else {
 		// for POST requests we assume the GraphQL query (+ optionally variables) are JSON encoded in the request body
-		decoder := json.NewDecoder(r.Body)
-		decoder.DisallowUnknownFields() // quickly find if a field name has been misspelt
-		decoder.UseNumber()             // allows us to distinguish ints from floats (see FixNumberVariables() below)
-		if err := decoder.Decode(&g); err != nil {
+		body := r.Body
+		if h.maxRequestSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, h.maxRequestSize)
+		}
+		reader := bufio.NewReader(body)
+		if isBatch(reader) {
+			// A JSON array of requests (see MaxBatchSize)
+			h.serveBatch(w, r, reader, g.clientKey)
+			return
+		}
+		if err := decodeRequest(reader, &g); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(`{"data": null,"errors": [{"message": "Error decoding JSON request:` + err.Error() + `"}]}`))
 			return
 		}
+		// Read the body to EOF as the server only detects the client disconnecting (cancelling the request's
+		// context, which stops the resolvers) once the body has been completely read - but no more than the limit
+		h.drain(reader)
 	}
 
 	// Since variables are sent as JSON (which does not distinguish int/float) we need to decide
 	g.Variables = FixNumbers(g.Variables).(map[string]interface{})
 
 	// Execute it and write the result or error to the HTTP response
-	if buf, err := json.Marshal(g.ExecuteHTTP(r.Context())); err != nil {
+	if h.resultArena {
+		g.arena = &resultArena{}
+		defer g.arena.release() // after the result has been encoded
+	}
+	ctx, headers := withResponseHeaders(r.Context())
+	result := g.ExecuteHTTP(ctx)
+	headers.write(w) // add headers set by resolvers (see SetHeader)
+	if buf, err := json.Marshal(result); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(`{"data": null,"errors": [{"message": "Error encoding JSON response:` + err.Error() + `"}]}`))
 	} else {
@@ -225,6 +569,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// drain reads the rest of a request body (see ServeHTTP), but no more than the MaxRequestSize limit (if any)
+func (h *Handler) drain(body io.Reader) {
+	if h.maxRequestSize > 0 {
+		body = io.LimitReader(body, h.maxRequestSize)
+	}
+	_, _ = io.Copy(io.Discard, body)
+}
+
 /*
 // FixNumberVariables goes through the structure created by the JSON decoder, converting any json.Number values to
 // either an int64 or a float64.  This assumes that all the JSON numbers were decoded into a json.Number type, rather
@@ -0,0 +1,79 @@
+package handler
+
+// headers.go allows resolvers to set HTTP response headers (eg cookies) - the headers are buffered in the context
+// passed to resolvers and added to the response just before it is written
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type (
+	// responseHeadersKey is the context key for the *responseHeaders of an HTTP request
+	responseHeadersKey struct{}
+
+	// responseHeaders buffers the headers set by resolvers (which may run concurrently)
+	responseHeaders struct {
+		mtx     sync.Mutex
+		header  http.Header
+		written bool // set once the response has started, after which headers are ignored
+	}
+)
+
+// withResponseHeaders returns a context that allows resolvers to set response headers
+func withResponseHeaders(ctx context.Context) (context.Context, *responseHeaders) {
+	rh := &responseHeaders{header: make(http.Header)}
+	return context.WithValue(ctx, responseHeadersKey{}, rh), rh
+}
+
+// SetHeader sets a header of the HTTP response, replacing any value already set by another resolver.  The ctx
+// must be the context passed to the resolver.  It returns false if the header could not be set, such as when
+// the operation was not received in an HTTP request (eg a subscription on a websocket), or the response has
+// already been written (eg the resolver was still running after the operation timed out).
+func SetHeader(ctx context.Context, key, value string) bool {
+	return updateHeaders(ctx, func(h http.Header) { h.Set(key, value) })
+}
+
+// AddHeader is like SetHeader but adds the value to any values of the header already set
+func AddHeader(ctx context.Context, key, value string) bool {
+	return updateHeaders(ctx, func(h http.Header) { h.Add(key, value) })
+}
+
+// SetCookie adds a Set-Cookie header to the HTTP response - see SetHeader.  An invalid cookie is ignored.
+func SetCookie(ctx context.Context, cookie *http.Cookie) bool {
+	v := cookie.String()
+	if v == "" {
+		return false
+	}
+	return AddHeader(ctx, "Set-Cookie", v)
+}
+
+// updateHeaders calls f to change the buffered headers (if any) of the HTTP request of ctx
+func updateHeaders(ctx context.Context, f func(http.Header)) bool {
+	rh, ok := ctx.Value(responseHeadersKey{}).(*responseHeaders)
+	if !ok {
+		return false
+	}
+	rh.mtx.Lock()
+	defer rh.mtx.Unlock()
+	if rh.written {
+		return false
+	}
+	f(rh.header)
+	return true
+}
+
+// write copies the buffered headers to the response - any headers set after this are ignored.  Headers already
+// in the response (eg Content-Type) are replaced, apart from cookies which are added.
+func (rh *responseHeaders) write(w http.ResponseWriter) {
+	rh.mtx.Lock()
+	defer rh.mtx.Unlock()
+	rh.written = true
+	for k, v := range rh.header {
+		if k == "Set-Cookie" {
+			v = append(w.Header()[k], v...)
+		}
+		w.Header()[k] = v
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+// inputcheck.go calls the Validate method (if any) of an input type, after it is decoded from a resolver argument,
+// so that checks on the values of an input object don't have to be repeated in every resolver that uses it
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Validator is implemented by an input type (struct) to check the values of an argument.  If Validate returns an
+// error the resolver is not called and the error is returned (with the path of the argument) for the field.
+type Validator interface {
+	Validate() error
+}
+
+// InvalidInputCode is the error code (in the extensions of the error) if an input object is not valid
+const InvalidInputCode = "BAD_USER_INPUT"
+
+// validateInput calls the Validate method of an input object (v must be addressable) if it has one, with a value or
+// pointer receiver.  The returned error has the path of the argument (name), eg "review" or "reviews[1].author".
+func validateInput(v reflect.Value, name string) error {
+	validator, ok := v.Addr().Interface().(Validator)
+	if !ok {
+		return nil
+	}
+	err := validator.Validate()
+	if err == nil {
+		return nil
+	}
+	r := &Error{
+		Message:    fmt.Sprintf("invalid %q: %v", name, err),
+		Code:       InvalidInputCode,
+		Extensions: map[string]interface{}{"argument": name},
+		Err:        err,
+	}
+	var e *Error
+	if errors.As(err, &e) && e.Code != "" {
+		r.Code = e.Code // keep the code of an Error returned by Validate
+	}
+	return r
+}
@@ -3,12 +3,21 @@ package handler
 // introspection.go implements the introspection type which handles the GraphQL __schema and __type queries
 
 import (
+	"context"
+	"strings"
+
 	"github.com/vektah/gqlparser/v2/ast"
 )
 
 type (
 	// introspectionSchema just embeds the gqlparser ast.Schema so that we can add methods to it
-	introspectionSchema struct{ *ast.Schema }
+	// It also has a function that decides which types and fields are visible (nil if all are visible)
+	// and descriptions in the languages accepted by the client, if any (see describe)
+	introspectionSchema struct {
+		*ast.Schema
+		visible      func(typeName, fieldName string) bool
+		descriptions []map[string]string
+	}
 
 	// introspectionObject represents a type definition (object)
 	introspectionObject struct {
@@ -52,9 +61,8 @@ type (
 	// query (__typename) can be included at any level of a query and is not handled here.
 	// (There is no root mutation/subscription for introspection as the schema does not change.)
 	introspectionQuery struct {
-		iss       introspectionSchema
-		GetSchema func() gqlSchema      `egg:"__schema"`
-		GetType   func(string) *gqlType `egg:"__type(name)"`
+		GetSchema func(context.Context) gqlSchema        `egg:"__schema"`
+		GetType   func(context.Context, string) *gqlType `egg:"__type(name)"`
 	}
 
 	// gqlSchema represents the GraphQL "__Schema" type returned by "__schema" query
@@ -77,7 +85,7 @@ type (
 		EnumValues        func(bool) []gqlEnumValue `egg:"(includeDeprecated=false),nullable"`
 		InputFields       func() []gqlInputValue
 		OfType            *gqlType // nil unless kind is "LIST" or "NON_NULL"
-		SpecifiedByUrl    string
+		SpecifiedByURL    *string  `egg:"specifiedByURL"` // URL from @specifiedBy directive (custom scalars only)
 	}
 
 	// gqlField represents the GraphQL "__Field" type
@@ -95,7 +103,7 @@ type (
 	gqlInputValue struct {
 		Name, Description string
 		Type              func() gqlType
-		DefaultValue      string
+		DefaultValue      *string // GraphQL literal, eg "[METER,FOOT]", or nil (null) if there is no default
 		// Remove deprecation - not (yet?) supported
 		//IsDeprecated      bool
 		//DeprecationReason string
@@ -183,11 +191,45 @@ func init() {
 	}
 }
 
-func NewIntrospectionData(astSchema *ast.Schema) interface{} {
-	pi := &introspectionQuery{iss: introspectionSchema{astSchema}}
-	pi.GetSchema = pi.iss.getSchema
-	pi.GetType = pi.iss.getType
-	return pi
+// NewIntrospectionData creates the root query object (resolvers) for introspection queries.  If policy is not
+// nil it is called (with the request context) to decide whether each type and field is visible, where the
+// fieldName is empty when deciding on the visibility of the type itself.
+func NewIntrospectionData(astSchema *ast.Schema, policy func(ctx context.Context, typeName, fieldName string) bool,
+) interface{} {
+	return newIntrospectionData(astSchema, policy, nil)
+}
+
+// newIntrospectionData is like NewIntrospectionData but descriptions (if not nil) gets the descriptions (eg in the
+// languages accepted by the client) used instead of those in the schema
+func newIntrospectionData(astSchema *ast.Schema, policy func(ctx context.Context, typeName, fieldName string) bool,
+	descriptions func(ctx context.Context) []map[string]string,
+) interface{} {
+	forRequest := func(ctx context.Context) introspectionSchema {
+		iss := introspectionSchema{Schema: astSchema}
+		if policy != nil {
+			iss.visible = func(typeName, fieldName string) bool { return policy(ctx, typeName, fieldName) }
+		}
+		if descriptions != nil {
+			iss.descriptions = descriptions(ctx)
+		}
+		return iss
+	}
+	return &introspectionQuery{
+		GetSchema: func(ctx context.Context) gqlSchema { return forRequest(ctx).getSchema() },
+		GetType:   func(ctx context.Context, name string) *gqlType { return forRequest(ctx).getType(name) },
+	}
+}
+
+// isVisible returns false if a type (or a field of the type) is to be hidden from introspection
+// Note that the introspection types (eg "__Type") and built-in scalars are always visible.
+func (iss introspectionSchema) isVisible(typeName, fieldName string) bool {
+	if iss.visible == nil || strings.HasPrefix(typeName, "__") {
+		return true
+	}
+	if definition := iss.Types[typeName]; definition != nil && definition.BuiltIn {
+		return true
+	}
+	return iss.visible(typeName, fieldName)
 }
 
 func (iss introspectionSchema) getSchema() gqlSchema {
@@ -205,7 +247,7 @@ func (iss introspectionSchema) getSchema() gqlSchema {
 func (iss introspectionSchema) getType(name string) *gqlType {
 	// Check the global list of "named" types
 	definition := iss.Types[name]
-	if definition == nil {
+	if definition == nil || !iss.isVisible(name, "") {
 		return nil
 	}
 
@@ -217,6 +259,9 @@ func (iss introspectionSchema) getType(name string) *gqlType {
 func (iss introspectionSchema) getTypes() []gqlType {
 	r := make([]gqlType, 0, len(iss.Types))
 	for _, definition := range iss.Types {
+		if !iss.isVisible(definition.Name, "") {
+			continue
+		}
 		r = append(r, introspectionObject{definition, iss}.getType())
 	}
 	return r
@@ -261,17 +306,28 @@ func (iss introspectionSchema) getDirectives() []gqlDirective {
 // getType gets the type info for a named GraphQL type
 func (iso introspectionObject) getType() gqlType {
 	return gqlType{
-		Kind:          getTypeKind(iso.Kind),
-		Name:          iso.Name,
-		Description:   iso.Description,
-		Fields:        iso.getFields, // TODO check this does not have input fields
-		Interfaces:    iso.getInterfaces,
-		PossibleTypes: nil, // TODO?
-		EnumValues:    iso.getEnumValues,
-		InputFields:   nil, // TODO
+		Kind:           getTypeKind(iso.Kind),
+		Name:           iso.Name,
+		Description:    iso.parent.describe(iso.Name, iso.Description),
+		Fields:         iso.getFields, // TODO check this does not have input fields
+		Interfaces:     iso.getInterfaces,
+		PossibleTypes:  nil, // TODO?
+		EnumValues:     iso.getEnumValues,
+		InputFields:    nil, // TODO
+		SpecifiedByURL: iso.getSpecifiedByURL(),
 	}
 }
 
+// getSpecifiedByURL returns the URL of the @specifiedBy directive of a custom scalar or nil if there is none
+func (iso introspectionObject) getSpecifiedByURL() *string {
+	if directive := iso.Directives.ForName("specifiedBy"); directive != nil {
+		if url := directive.Arguments.ForName("url"); url != nil && url.Value != nil {
+			return &url.Value.Raw
+		}
+	}
+	return nil
+}
+
 // getTypeKind returns the enum __TypeKind value (int) corresp. to a string
 func getTypeKind(kind ast.DefinitionKind) int {
 	return IntroEnumsReverse["__TypeKind"][string(kind)]
@@ -284,6 +340,14 @@ func (iso introspectionObject) getFields(includeDeprecated bool) []gqlField {
 	r := make([]gqlField, 0, len(iso.Fields))
 fieldLoop:
 	for _, field := range iso.Fields {
+		// skip the implicit meta-fields (__schema and __type) that gqlparser adds to the query type
+		if strings.HasPrefix(field.Name, "__") {
+			continue
+		}
+		// skip fields hidden by the policy including fields of a hidden type
+		if !iso.parent.isVisible(iso.Name, field.Name) || !iso.parent.isVisible(baseNamedType(field.Type), "") {
+			continue
+		}
 		if !includeDeprecated {
 			// skip deprecated fields
 			for _, directive := range field.Directives {
@@ -295,7 +359,7 @@ fieldLoop:
 		isf := introspectionField{field, iso}
 		r = append(r, gqlField{
 			Name:              isf.Name,
-			Description:       isf.Description,
+			Description:       iso.parent.describe(iso.Name+"."+isf.Name, isf.Description),
 			Args:              isf.getArgs,
 			Type:              isf.getType,
 			IsDeprecated:      isf.getIsDeprecated,
@@ -320,7 +384,7 @@ valueLoop:
 		isv := introspectionEnumValue{v, iso}
 		r = append(r, gqlEnumValue{
 			Name:              isv.Name,
-			Description:       isv.Description,
+			Description:       iso.parent.describe(iso.Name+"."+isv.Name, isv.Description),
 			IsDeprecated:      isv.getIsDeprecated,
 			DeprecationReason: isv.getDeprecationReason,
 		})
@@ -331,26 +395,27 @@ valueLoop:
 func (iso introspectionObject) getInterfaces() []gqlType {
 	r := make([]gqlType, 0, len(iso.Interfaces))
 	for _, name := range iso.Interfaces {
-		r = append(r, *iso.parent.getType(name))
+		if t := iso.parent.getType(name); t != nil {
+			r = append(r, *t)
+		}
 	}
 	return r
 }
 
 // getArgs gets a list of arguments for a field
-//func (isf introspectionField) getArgs(includeDeprecated bool) []gqlInputValue {
+// func (isf introspectionField) getArgs(includeDeprecated bool) []gqlInputValue {
 func (isf introspectionField) getArgs() []gqlInputValue {
 	r := make([]gqlInputValue, 0, len(isf.Arguments))
 	for _, arg := range isf.Arguments {
-		isa := introspectionArgument{arg, isf}
-		raw := ""
-		if arg.DefaultValue != nil {
-			raw = arg.DefaultValue.Raw
+		if !isf.parent.parent.isVisible(baseNamedType(arg.Type), "") {
+			continue
 		}
+		isa := introspectionArgument{arg, isf}
 		r = append(r, gqlInputValue{
 			Name:         arg.Name,
-			Description:  arg.Description,
+			Description:  isf.parent.parent.describe(isf.parent.Name+"."+isf.Name+"."+arg.Name, arg.Description),
 			Type:         isa.getType,
-			DefaultValue: raw,
+			DefaultValue: defaultValue(arg.DefaultValue),
 		})
 	}
 	return r
@@ -460,21 +525,35 @@ func (isd introspectionDirective) getArgs() []gqlInputValue {
 	r := make([]gqlInputValue, 0, len(isd.Arguments))
 	for _, arg := range isd.Arguments {
 		isda := introspectionDirectiveArgument{arg, isd}
-		raw := ""
-		if arg.DefaultValue != nil {
-			raw = arg.DefaultValue.Raw
-		}
 		r = append(r, gqlInputValue{
 			Name:         arg.Name,
 			Description:  arg.Description,
 			Type:         isda.getType,
-			DefaultValue: raw, // TODO check if we need to put quotes around a string type
+			DefaultValue: defaultValue(arg.DefaultValue),
 		})
 	}
 	return r
 }
 
+// defaultValue returns the default value of an argument as a GraphQL literal (eg strings are quoted and lists
+// of enums are like "[METER,FOOT]") as introspection requires, or nil if there is no default value
+func defaultValue(value *ast.Value) *string {
+	if value == nil {
+		return nil
+	}
+	s := value.String()
+	return &s
+}
+
 // getType gets the type associated with a GraphQL directive's argument
 func (isda introspectionDirectiveArgument) getType() gqlType {
 	return *introspectionType{isda.Type, isda.parent.parent}.getType()
 }
+
+// baseNamedType gets the name of the underlying named type of a type (eg "[Int!]!" => "Int")
+func baseNamedType(t *ast.Type) string {
+	for t.Elem != nil {
+		t = t.Elem
+	}
+	return t.NamedType
+}
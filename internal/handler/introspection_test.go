@@ -3,7 +3,9 @@ package handler_test
 // introspection_test.go tests that introspection queries produce the correct result
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -39,7 +41,8 @@ const (
 		`"Description M" type Mutation { f(e:E!): E! }` +
 		`"Description S" type Simple { i: Int! }` +
 		`"Description L" type ObjectList { list: [Simple!] }` +
-		`"Description E" enum E{E0 E1 E2}`
+		`"Description E" enum E{E0 E1 E2}` +
+		`scalar URL @specifiedBy(url: "https://tools.ietf.org/html/rfc3986")`
 )
 
 // TestIntrospection test that introspection queries work correctly
@@ -75,6 +78,14 @@ func TestIntrospection(t *testing.T) {
 			query:    `{ __type(name:\"Int\") { name kind } }`,
 			expected: `{"__type": {"name": "Int", "kind": "SCALAR"}}`,
 		},
+		"SpecifiedBy": {
+			query:    `{ __type(name:\"URL\") { name kind specifiedByURL } }`,
+			expected: `{"__type": {"name": "URL", "kind": "SCALAR", "specifiedByURL": "https://tools.ietf.org/html/rfc3986"}}`,
+		},
+		"NotSpecifiedBy": {
+			query:    `{ __type(name:\"Int\") { specifiedByURL } }`,
+			expected: `{"__type": {"specifiedByURL": null}}`,
+		},
 		"Type Nested": {
 			query:    `{ __type(name:\"Nested\") { name kind description } }`,
 			expected: `{"__type": {"name": "Nested", "kind": "OBJECT", "description": "Description N"}}`,
@@ -167,3 +178,172 @@ func TestIntrospection(t *testing.T) {
 		})
 	}
 }
+
+// TestIntrospectionPolicy checks that types and fields can be hidden from introspection depending on the request
+func TestIntrospectionPolicy(t *testing.T) {
+	type roleKey struct{}
+	const schemaString = "type Query { a:Int! b:Int! admin:Admin } type Admin { x:Int! }"
+	queryData := struct {
+		A, B  int
+		Admin *struct{ X int }
+	}{}
+	// Non-admin users can't see the "Admin" type or the "b" field
+	policy := func(ctx context.Context, typeName, fieldName string) bool {
+		if ctx.Value(roleKey{}) == "admin" {
+			return true
+		}
+		return typeName != "Admin" && !(typeName == "Query" && fieldName == "b")
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.IntrospectionPolicy(policy),
+	)
+
+	data := map[string]struct {
+		role     string
+		query    string
+		expected interface{}
+	}{
+		"AdminFields": {
+			"admin", `{ __type(name:\"Query\") { fields { name } } }`,
+			JsonObject{"__type": JsonObject{"fields": []interface{}{
+				JsonObject{"name": "a"}, JsonObject{"name": "b"}, JsonObject{"name": "admin"},
+			}}},
+		},
+		"UserFields": {
+			"user", `{ __type(name:\"Query\") { fields { name } } }`,
+			JsonObject{"__type": JsonObject{"fields": []interface{}{JsonObject{"name": "a"}}}},
+		},
+		"AdminType": {"admin", `{ __type(name:\"Admin\") { name } }`, JsonObject{"__type": JsonObject{"name": "Admin"}}},
+		"UserType":  {"user", `{ __type(name:\"Admin\") { name } }`, JsonObject{"__type": nil}},
+		"BuiltIn":   {"user", `{ __type(name:\"Int\") { name } }`, JsonObject{"__type": JsonObject{"name": "Int"}}},
+	}
+
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+testData.query+`"}`))
+			request = request.WithContext(context.WithValue(request.Context(), roleKey{}, testData.role))
+			request.Header.Add("Content-Type", "application/json")
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, request)
+
+			var result struct {
+				Data   interface{}
+				Errors []struct{ Message string }
+			}
+			if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+				t.Fatalf("Error decoding JSON response: %v", err)
+			}
+			Assertf(t, result.Errors == nil, "Expected no error and got %v", result.Errors)
+			Assertf(t, reflect.DeepEqual(result.Data, testData.expected), "Expected %v, got %v", testData.expected, result.Data)
+		})
+	}
+}
+
+// TestLocalizedDescriptions checks that introspection returns descriptions in the language of the client
+func TestLocalizedDescriptions(t *testing.T) {
+	const schemaString = `type Query { "the hero" hero("which episode" episode: Episode): String! } ` +
+		`"a film" enum Episode { "the first film" NEWHOPE JEDI }`
+	queryData := struct {
+		Hero func(int) string `egg:"(episode)"`
+	}{
+		Hero: func(int) string { return "" },
+	}
+	h := handler.New([]string{schemaString}, map[string][]string{"Episode": {"NEWHOPE", "JEDI"}},
+		[3][]interface{}{{queryData}, nil, nil},
+		handler.LocalizedDescriptions(map[string]map[string]string{
+			"fr":    {"Query.hero": "le héros", "Query.hero.episode": "quel épisode", "Episode": "un film"},
+			"fr-ca": {"Query.hero": "le héros (CA)"},
+			"de":    {"Query.hero": "der Held", "Episode.JEDI": "der sechste Film"},
+		}),
+	)
+	const query = `{ q: __type(name:\"Query\") { fields { description args { description } } } ` +
+		`e: __type(name:\"Episode\") { description enumValues { description } } }`
+	expected := func(hero, episode, film, jedi string) interface{} {
+		return JsonObject{
+			"q": JsonObject{"fields": []interface{}{
+				JsonObject{"description": hero, "args": []interface{}{JsonObject{"description": episode}}},
+			}},
+			"e": JsonObject{"description": film, "enumValues": []interface{}{
+				JsonObject{"description": "the first film"}, JsonObject{"description": jedi},
+			}},
+		}
+	}
+
+	data := map[string]struct {
+		language string
+		expected interface{}
+	}{
+		"None":     {"", expected("the hero", "which episode", "a film", "")},
+		"Unknown":  {"es", expected("the hero", "which episode", "a film", "")},
+		"French":   {"fr", expected("le héros", "quel épisode", "un film", "")},
+		"Region":   {"fr-CH", expected("le héros", "quel épisode", "un film", "")},
+		"Canadian": {"fr-CA", expected("le héros (CA)", "quel épisode", "un film", "")},
+		"Quality":  {"fr;q=0.5, de", expected("der Held", "quel épisode", "un film", "der sechste Film")},
+	}
+
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+query+`"}`))
+			request.Header.Add("Content-Type", "application/json")
+			if testData.language != "" {
+				request.Header.Add("Accept-Language", testData.language)
+			}
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, request)
+
+			var result struct {
+				Data   interface{}
+				Errors []struct{ Message string }
+			}
+			if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+				t.Fatalf("Error decoding JSON response: %v", err)
+			}
+			Assertf(t, result.Errors == nil, "Expected no error and got %v", result.Errors)
+			Assertf(t, reflect.DeepEqual(result.Data, testData.expected), "Expected %v, got %v", testData.expected, result.Data)
+		})
+	}
+}
+
+// TestDefaultValue checks that argument defaults, including lists of enums, are returned by introspection as
+// GraphQL literals and are the values passed to the resolver
+func TestDefaultValue(t *testing.T) {
+	const schemaString = "enum Unit { METER FOOT INCH } " +
+		`type Query { f(units:[Unit!]! = [METER, FOOT], unit:Unit! = INCH, name:String! = "x", n:Int): String! }`
+	queryData := struct {
+		F func([]int, int, string, *int) string `egg:"(units:[Unit!]!=[METER,FOOT],unit:Unit!=INCH,name=\"x\",n)"`
+	}{
+		F: func(units []int, unit int, name string, n *int) string {
+			return fmt.Sprintf("%v %d %s %t", units, unit, name, n == nil)
+		},
+	}
+	h := handler.New([]string{schemaString}, map[string][]string{"Unit": {"METER", "FOOT", "INCH"}},
+		[3][]interface{}{{queryData}, nil, nil})
+
+	data := map[string]struct {
+		query    string
+		expected interface{}
+	}{
+		"Introspection": {
+			`{ __type(name:\"Query\") { fields { args { name defaultValue } } } }`,
+			JsonObject{"__type": JsonObject{"fields": []interface{}{
+				JsonObject{"args": []interface{}{
+					JsonObject{"name": "units", "defaultValue": "[METER,FOOT]"},
+					JsonObject{"name": "unit", "defaultValue": "INCH"},
+					JsonObject{"name": "name", "defaultValue": `"x"`},
+					JsonObject{"name": "n", "defaultValue": nil},
+				}},
+			}}},
+		},
+		"Defaults": {`{ f }`, JsonObject{"f": "[0 1] 2 x true"}},
+		"Supplied": {`{ f(units:[INCH], unit:METER) }`, JsonObject{"f": "[2] 0 x true"}},
+		"Variable": {`query($u:[Unit!]!) { f(units:$u) }`, JsonObject{"f": "[] 2 x true"}},
+	}
+
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			result, errs := doRequest(t, h, `{"query":"`+testData.query+`","variables":{"u":[]}}`)
+			Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+			Assertf(t, reflect.DeepEqual(result, testData.expected), "Expected %v, got %v", testData.expected, result)
+		})
+	}
+}
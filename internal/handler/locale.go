@@ -0,0 +1,86 @@
+package handler
+
+// locale.go provides descriptions (of types, fields, arguments and enum values) in the language of the client,
+// for introspection queries, if descriptions have been registered for other languages (see LocalizedDescriptions
+// option).  The language(s) are taken from the Accept-Language header of the request (or the websocket upgrade).
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// languagesKey is the context key for the languages (in order of preference) accepted by the client
+type languagesKey struct{}
+
+// withLanguages returns a context with the languages from an Accept-Language header
+func withLanguages(ctx context.Context, header string) context.Context {
+	if header == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, languagesKey{}, acceptLanguages(header))
+}
+
+// acceptLanguages returns the language tags (lower case) of an Accept-Language header, eg "fr-CH, fr;q=0.9, en;q=0.8",
+// sorted by quality (highest first).  Languages with a quality of zero, or the wildcard (*), are left out.
+func acceptLanguages(header string) []string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	var list []language
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		l := language{tag: strings.ToLower(strings.TrimSpace(params[0])), quality: 1}
+		for _, param := range params[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					l.quality = q
+				}
+			}
+		}
+		if l.tag != "" && l.tag != "*" && l.quality > 0 {
+			list = append(list, l)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].quality > list[j].quality })
+
+	r := make([]string, 0, len(list))
+	for _, l := range list {
+		r = append(r, l.tag)
+	}
+	return r
+}
+
+// localDescriptions returns the registered descriptions for the languages accepted by the client (in order of
+// preference) where a language with a region (eg "en-AU") falls back to the base language (eg "en")
+func (h *Handler) localDescriptions(ctx context.Context) []map[string]string {
+	if h.descriptions == nil {
+		return nil
+	}
+	languages, _ := ctx.Value(languagesKey{}).([]string)
+	var r []map[string]string
+	for _, tag := range languages {
+		if m, ok := h.descriptions[tag]; ok {
+			r = append(r, m)
+		}
+		if i := strings.IndexByte(tag, '-'); i > 0 {
+			if m, ok := h.descriptions[tag[:i]]; ok {
+				r = append(r, m)
+			}
+		}
+	}
+	return r
+}
+
+// describe returns the description of a type (key is the type name), field or enum value (eg "Query.hero") or
+// argument (eg "Query.hero.episode") in the client's language, or the description in the schema if there is none
+func (iss introspectionSchema) describe(key, description string) string {
+	for _, m := range iss.descriptions {
+		if d, ok := m[key]; ok {
+			return d
+		}
+	}
+	return description
+}
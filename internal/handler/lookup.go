@@ -3,6 +3,7 @@ package handler
 // lookup.go is used to build lookup tables for quick lookup of enums and resolvers
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
@@ -42,11 +43,33 @@ func makeEnumTables(enums map[string][]string) (map[string][]string, map[string]
 	return byIndex, byName
 }
 
+// addSchemaEnums adds the enums of the schema that are not in the enums map (eg declared using Go enum types) to
+// the enum lookup tables.  The values are taken in the order they are declared in the schema.
+func (h *Handler) addSchemaEnums() {
+	for name, def := range h.schema.Types {
+		if def.Kind != ast.Enum || def.BuiltIn || strings.HasPrefix(name, "__") {
+			continue
+		}
+		if _, ok := h.enums[name]; ok {
+			continue
+		}
+		enum := make([]string, 0, len(def.EnumValues))
+		enumInt := make(map[string]int, len(def.EnumValues))
+		for i, v := range def.EnumValues {
+			enum = append(enum, v.Name)
+			enumInt[v.Name] = i
+		}
+		h.enums[name] = enum
+		h.enumsReverse[name] = enumInt
+	}
+}
+
 // makeResolverTables builds lookup tables for all query/mutation/subscription structs of a schema.
 // This allows us to quickly find the index of a field (resolver) given the struct type and resolver name.
 // At the top level we have a map indexed by all the struct's (its reflect.Type) used for the schema, then
 // for each struct we have a map indexed by the resolver name and giving the index of the field in the struct.
-func (h *Handler) makeResolverTables() {
+// It returns an error if the info for a field can't be obtained (eg its egg: tag is invalid).
+func (h *Handler) makeResolverTables() error {
 	h.resolverLookup = make(ResolverLookupTables)
 	for _, q := range [][]interface{}{h.qData, h.mData, h.subscriptionData} {
 		if q == nil {
@@ -56,15 +79,23 @@ func (h *Handler) makeResolverTables() {
 			if v == nil {
 				continue
 			}
-			h.addLookup(reflect.TypeOf(v))
+			if err := h.addLookup(reflect.TypeOf(v)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range h.types {
+		if err := h.addLookup(t); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 // addLookup gets info on all resolvers (public fields) in the parameter t.
 // If t is not struct it does nothing.
 // For each resolver in the struct it saves the field index (for fast lookups) and creates a cache
-func (h *Handler) addLookup(t reflect.Type) {
+func (h *Handler) addLookup(t reflect.Type) error {
 	// Get "base" type to see if it's a struct
 	for k := t.Kind(); k == reflect.Ptr; k = t.Kind() {
 		t = t.Elem()
@@ -72,14 +103,14 @@ func (h *Handler) addLookup(t reflect.Type) {
 	if t.Kind() == reflect.Func {
 		t = t.Out(0)
 	}
-	if k := t.Kind(); k == reflect.Map || k == reflect.Slice || k == reflect.Array || k == reflect.Chan {
-		t = t.Elem()
+	if k := t.Kind(); k == reflect.Map || k == reflect.Slice || k == reflect.Array || k == reflect.Chan || field.IsOrderedMap(t) {
+		t = field.ElemType(t)
 	}
 	if t.Kind() != reflect.Struct {
-		return
+		return nil
 	}
 	if _, ok := h.resolverLookup[t]; ok {
-		return // already done (or being done if nil)
+		return nil // already done (or being done if nil)
 	}
 	h.resolverLookup[t] = nil // Reserve this entry, so we don't do it again in recursive calls
 
@@ -87,19 +118,25 @@ func (h *Handler) addLookup(t reflect.Type) {
 	// Find all the fields that are resolvers
 	for i := 0; i < t.NumField(); i++ {
 		tField := t.Field(i)
-		fieldInfo, err := field.Get(&tField)
+		fieldInfo, err := field.Get(t, &tField)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("%w getting field %s of %v", err, tField.Name, t)
 		}
 		if fieldInfo == nil {
 			continue // ignore unexported field
 		}
 		if tField.Name == "_" {
 			// ignored field may have been included for the type declaration
-			h.addLookup(fieldInfo.ResultType)
+			if err := h.addLookup(fieldInfo.ResultType); err != nil {
+				return err
+			}
 			continue
 		}
 
+		if fieldInfo.Wildcard {
+			r[wildcardName] = ResolverData{Index: i}
+			continue
+		}
 		if fieldInfo.Embedded {
 			if fieldInfo.Empty {
 				continue // we don't need to look up anything in a union
@@ -107,37 +144,51 @@ func (h *Handler) addLookup(t reflect.Type) {
 			// Embedding means all the fields are "promoted" to the parent struct
 			for j := 0; j < fieldInfo.ResultType.NumField(); j++ {
 				tf2 := fieldInfo.ResultType.Field(j)
-				fieldInfo2, err2 := field.Get(&tf2)
+				fieldInfo2, err2 := field.Get(fieldInfo.ResultType, &tf2)
 				if err2 != nil {
-					continue // TODO: check error
+					return fmt.Errorf("%w getting field %s of %v", err2, tf2.Name, fieldInfo.ResultType)
 				}
 				if tf2.Name == "_" || fieldInfo2 == nil {
 					continue // ignore unexported field
 				}
-				r[fieldInfo2.Name] = ResolverData{Index: i}
-				h.addLookup(fieldInfo2.ResultType)
+				r[fieldInfo2.Name] = ResolverData{Index: i, Complexity: fieldInfo2.Complexity}
+				h.addSecretArgs(fieldInfo2.SecretArgs)
+				if err := h.addLookup(fieldInfo2.ResultType); err != nil {
+					return err
+				}
 			}
 		} else {
+			h.addSecretArgs(fieldInfo.SecretArgs)
 			var cache ResolverCache
 			// We leave the cache field nil unless we want a cache for this field
 			if h.wantCache(&tField, fieldInfo) {
 				cache.Mtx = &sync.Mutex{}
 				cache.Saved = make(map[CacheKey]reflect.Value)
+				cache.stats = &cacheCounts{}
+				cache.swr = newSWRCache(fieldInfo)
+				cache.limits = h.newCacheLimits(fieldInfo)
+				cache.shared = h.newSharedCache()
 			}
 			r[fieldInfo.Name] = ResolverData{
-				Index: i,
-				Cache: cache,
+				Index:      i,
+				Cache:      cache,
+				Limiter:    newRateLimiter(fieldInfo.RateLimit, fieldInfo.RateLimitPeriod),
+				Batch:      fieldInfo.Batch,
+				Complexity: fieldInfo.Complexity,
 			}
 		}
-		h.addLookup(fieldInfo.ResultType)
+		if err := h.addLookup(fieldInfo.ResultType); err != nil {
+			return err
+		}
 	}
 	h.resolverLookup[t] = r
+	return nil
 }
 
 // wantCache checks if we want to cache the values of a field
 func (h *Handler) wantCache(tField *reflect.StructField, fieldInfo *field.Info) bool {
-	if fieldInfo.NoCache {
-		return false // no cache ever
+	if fieldInfo.NoCache || fieldInfo.Batch {
+		return false // no cache ever (a batch resolver's results are for different elements of a list)
 	}
 	// Check if the field has a cacheControl directive
 	for _, directive := range fieldInfo.Directives {
@@ -147,14 +198,19 @@ func (h *Handler) wantCache(tField *reflect.StructField, fieldInfo *field.Info)
 		}
 	}
 
+	if fieldInfo.CacheStale > 0 || fieldInfo.CacheTTL > 0 {
+		return true // stale-while-revalidate or expiring cache (see "cache" option)
+	}
+
 	// In the absence of the above flags and directives:
 	// - return true if the global func cache option is on + resolver is a func
 	return h.funcCache && tField.Type.Kind() == reflect.Func
 }
 
 // argsKey takes the arguments for a resolver and returns a string that uniquely encodes them
-// This is used for the cache key so that the same resolver called with different args give different cache values
-func argsKey(args ast.ArgumentList) string {
+// This is used for the cache key so that the same resolver called with different args give different cache values.
+// Note that variables (and lists and objects, which may contain variables) are encoded using their values.
+func argsKey(args ast.ArgumentList, variables map[string]interface{}) string {
 	length := len(args)
 	for _, arg := range args {
 		length += len(arg.Value.Raw)
@@ -162,7 +218,13 @@ func argsKey(args ast.ArgumentList) string {
 	var sb strings.Builder
 	sb.Grow(length)
 	for _, arg := range args {
-		sb.WriteString(arg.Value.Raw)
+		switch arg.Value.Kind {
+		case ast.Variable, ast.ListValue, ast.ObjectValue:
+			value, _ := arg.Value.Value(variables)
+			fmt.Fprintf(&sb, "%#v", value)
+		default:
+			sb.WriteString(arg.Value.Raw)
+		}
 		sb.WriteByte(0) // sep. args with nul byte to avoid ambiguities
 	}
 	return sb.String()
@@ -0,0 +1,72 @@
+package handler
+
+// lookupdiag.go helps to find bugs in building the resolver lookup tables (see addLookup).  If the LookupDiagnostics
+// option is on, when a field is not found in the lookup table of a struct the struct is scanned for a matching
+// field.  If one is found (which should never happen) a report is logged and the field is used to resolve the query.
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+)
+
+// lookupMiss is called when the lookup table for the struct t has no resolver for the GraphQL field name.  It
+// scans the struct for a matching field, returning its index if found (after logging a report the first time).
+func (h *Handler) lookupMiss(t reflect.Type, name string) (ResolverData, bool) {
+	if h.lookupReported == nil || strings.HasPrefix(name, "__") {
+		return ResolverData{}, false
+	}
+	index, goName, ok := scanStruct(t, name)
+	if !ok {
+		return ResolverData{}, false // not a bug - eg the field is in another struct (of the same query)
+	}
+	if _, reported := h.lookupReported.LoadOrStore(lookupMissKey{t, name}, true); !reported {
+		lookup, known := h.resolverLookup[t]
+		names := make([]string, 0, len(lookup))
+		for n := range lookup {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		table := "has no lookup table"
+		if known {
+			table = "has resolvers [" + strings.Join(names, " ") + "]"
+		}
+		log.Printf("eggql: resolver lookup miss for %q in %s (which %s) but it matches Go field %s - "+
+			"using it anyway (please report this bug)", name, t, table, goName)
+	}
+	return ResolverData{Index: index}, true
+}
+
+// lookupMissKey identifies a struct and field name for which a lookup miss was reported (so that it is only
+// reported once)
+type lookupMissKey struct {
+	t    reflect.Type
+	name string
+}
+
+// scanStruct looks for the field of a struct (or of a struct embedded in it) that resolves the GraphQL field name,
+// returning the index of the field (or of the embedded struct) in t and the Go field name
+func scanStruct(t reflect.Type, name string) (int, string, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		tField := t.Field(i)
+		fieldInfo, err := field.Get(t, &tField)
+		if err != nil || fieldInfo == nil || tField.Name == "_" || fieldInfo.Wildcard {
+			continue
+		}
+		if fieldInfo.Embedded {
+			if embedded := structType(tField.Type); embedded != nil && !fieldInfo.Empty {
+				if _, goName, ok := scanStruct(embedded, name); ok {
+					return i, tField.Name + "." + goName, true
+				}
+			}
+			continue
+		}
+		if fieldInfo.Name == name {
+			return i, tField.Name, true
+		}
+	}
+	return 0, "", false
+}
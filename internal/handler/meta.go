@@ -0,0 +1,110 @@
+package handler
+
+// meta.go gives resolvers read-only information about the schema (see Meta), eg so that a generic resolver for
+// dynamic sorting or filtering can check the field names it is given without keeping a parallel list
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// metaKey is the context key for the schema information passed to resolvers
+type metaKey struct{}
+
+// withMeta returns a context (passed to the resolvers of an operation) that provides info about the schema
+func withMeta(ctx context.Context, h *Handler) context.Context {
+	return context.WithValue(ctx, metaKey{}, &SchemaMeta{h: h})
+}
+
+// SchemaMeta provides read-only information about the types (and their fields) and the enums of a schema
+type SchemaMeta struct {
+	h *Handler
+}
+
+// SchemaField describes a field of an object, interface or input type
+type SchemaField struct {
+	Name        string
+	Type        string   // GraphQL type, eg "[Int!]!"
+	Description string   // description (if any) in the schema
+	Args        []string // names of the arguments (if any) in the order declared
+	Deprecated  bool
+}
+
+// Meta returns information about the schema used by the handler executing the operation.  It returns nil if
+// ctx is not (derived from) the context passed to a resolver.
+func Meta(ctx context.Context) *SchemaMeta {
+	m, _ := ctx.Value(metaKey{}).(*SchemaMeta)
+	return m
+}
+
+// Types returns the names of the types of the schema (excluding built-in types) in alphabetical order
+func (m *SchemaMeta) Types() []string {
+	r := make([]string, 0, len(m.h.schema.Types))
+	for name, def := range m.h.schema.Types {
+		if !def.BuiltIn && !strings.HasPrefix(name, "__") {
+			r = append(r, name)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Kind returns the kind of a type (eg "OBJECT", "ENUM", "INPUT_OBJECT") or an empty string if there is no such type
+func (m *SchemaMeta) Kind(typeName string) string {
+	if def := m.h.schema.Types[typeName]; def != nil {
+		return string(def.Kind)
+	}
+	return ""
+}
+
+// Fields returns the fields of an object, interface or input type in the order declared (excluding __typename)
+// or nil if there is no such type
+func (m *SchemaMeta) Fields(typeName string) []SchemaField {
+	def := m.h.schema.Types[typeName]
+	if def == nil {
+		return nil
+	}
+	r := make([]SchemaField, 0, len(def.Fields))
+	for _, fieldDef := range def.Fields {
+		if !strings.HasPrefix(fieldDef.Name, "__") {
+			r = append(r, schemaField(fieldDef))
+		}
+	}
+	return r
+}
+
+// Field returns info about a field of a type, and false if the type does not have the field
+func (m *SchemaMeta) Field(typeName, fieldName string) (SchemaField, bool) {
+	def := m.h.schema.Types[typeName]
+	if def == nil || strings.HasPrefix(fieldName, "__") {
+		return SchemaField{}, false
+	}
+	fieldDef := def.Fields.ForName(fieldName)
+	if fieldDef == nil {
+		return SchemaField{}, false
+	}
+	return schemaField(fieldDef), true
+}
+
+// EnumValues returns the values of an enum in order, so that the index of a value is its (Go) int value, or nil
+// if there is no such enum.  The returned slice must not be modified.
+func (m *SchemaMeta) EnumValues(enumName string) []string {
+	return m.h.enums[enumName]
+}
+
+// schemaField makes the info about a field from its definition in the schema
+func schemaField(fieldDef *ast.FieldDefinition) SchemaField {
+	r := SchemaField{
+		Name:        fieldDef.Name,
+		Type:        fieldDef.Type.String(),
+		Description: fieldDef.Description,
+		Deprecated:  fieldDef.Directives.ForName("deprecated") != nil,
+	}
+	for _, arg := range fieldDef.Arguments {
+		r.Args = append(r.Args, arg.Name)
+	}
+	return r
+}
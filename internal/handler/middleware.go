@@ -0,0 +1,89 @@
+package handler
+
+// middleware.go calls resolver middleware (see ResolverMiddleware option) around the resolving of every field, eg
+// for authorisation checks, logging or metrics, without modifying the resolvers themselves
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type (
+	// ResolverInfo describes the field being resolved when resolver middleware is called
+	ResolverInfo struct {
+		Operation string                 // "query", "mutation" or "subscription"
+		TypeName  string                 // name of the GraphQL type containing the field (eg "Query")
+		FieldName string                 // name of the field (in the schema)
+		Alias     string                 // name of the field in the results (same as FieldName unless aliased)
+		Path      string                 // path of the field in the results, eg "hero.friends[2].name"
+		Args      map[string]interface{} // arguments of the field (including variable values)
+	}
+
+	// Resolver resolves a field returning its value (as it is encoded in the results) or an error
+	Resolver func(ctx context.Context) (interface{}, error)
+
+	// ResolverMiddlewareFunc is called when a field is resolved, and must call next to resolve it (unless it returns
+	// an error or its own value instead).  The context passed to next is seen by the resolver.
+	ResolverMiddlewareFunc func(ctx context.Context, info ResolverInfo, next Resolver) (interface{}, error)
+)
+
+// resolveField calls resolve, via any custom directive functions (see Directives) and resolver middleware.  Note
+// that these are not used for introspection fields, or for fields excluded by a directive (@skip/@include).
+func (op *gqlOperation) resolveField(ctx context.Context, astField *ast.Field, v, vID reflect.Value,
+	fieldInfo *field.Info, cache ResolverCache,
+) *gqlValue {
+	if op.tracer.traced(astField) {
+		defer op.tracer.resolver(ctx, astField, time.Now())
+	}
+	if len(op.resolverMiddleware) == 0 && len(op.directives) == 0 || op.directiveBypass(astField.Directives) ||
+		strings.HasPrefix(astField.Name, "__") ||
+		astField.ObjectDefinition != nil && strings.HasPrefix(astField.ObjectDefinition.Name, "__") {
+		return op.resolve(ctx, astField, v, vID, fieldInfo, cache)
+	}
+	hooks := op.directiveHooks(astField)
+	if len(op.resolverMiddleware) == 0 && len(hooks) == 0 {
+		return op.resolve(ctx, astField, v, vID, fieldInfo, cache)
+	}
+
+	// Build the chain of middleware (the first is called first), then directive functions, ending in resolve
+	next := func(ctx context.Context) (interface{}, error) {
+		value := op.resolve(ctx, astField, v, vID, fieldInfo, cache)
+		if value == nil {
+			return nil, nil
+		}
+		return value.value, value.err
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook, inner := hooks[i], next
+		next = func(ctx context.Context) (interface{}, error) { return hook.f(ctx, hook.args, inner) }
+	}
+	if len(op.resolverMiddleware) > 0 {
+		info := ResolverInfo{
+			Operation: string(ast.Query),
+			FieldName: astField.Name,
+			Alias:     astField.Alias,
+			Path:      getPath(fieldPath(ctx, astField)).String(),
+			Args:      astField.ArgumentMap(op.variables),
+		}
+		switch {
+		case op.isMutation:
+			info.Operation = string(ast.Mutation)
+		case op.isSubscription:
+			info.Operation = string(ast.Subscription)
+		}
+		if astField.ObjectDefinition != nil {
+			info.TypeName = astField.ObjectDefinition.Name
+		}
+		for i := len(op.resolverMiddleware) - 1; i >= 0; i-- {
+			mw, inner := op.resolverMiddleware[i], next
+			next = func(ctx context.Context) (interface{}, error) { return mw(ctx, info, inner) }
+		}
+	}
+	value, err := next(ctx)
+	return &gqlValue{name: astField.Alias, value: value, err: err}
+}
@@ -1,6 +1,7 @@
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -141,3 +142,84 @@ func TestMutation(t *testing.T) {
 		})
 	}
 }
+
+// TestSetHeader checks that resolvers (eg a login mutation) can set response headers and cookies
+func TestSetHeader(t *testing.T) {
+	h := handler.New(
+		[]string{"type Mutation { login(user: String!): Boolean! other: Int! }"},
+		nil,
+		[3][]interface{}{nil, {struct {
+			Login func(context.Context, string) bool `egg:"(user)"`
+			Other func(context.Context) int
+		}{
+			func(ctx context.Context, user string) bool {
+				return handler.SetCookie(ctx, &http.Cookie{Name: "token", Value: user + "-token"}) &&
+					handler.SetHeader(ctx, "X-User", user)
+			},
+			func(ctx context.Context) int {
+				handler.AddHeader(ctx, "Set-Cookie", "other=1")
+				return 1
+			},
+		}}, nil},
+	)
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"mutation { login(user:\"ann\") other }"}`))
+	request.Header.Add("Content-Type", "application/json")
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, request)
+
+	Assertf(t, strings.Contains(writer.Body.String(), `"login":true`), "Expected login to be true, got %s", writer.Body)
+	Assertf(t, writer.Header().Get("X-User") == "ann", "Expected X-User header ann, got %q", writer.Header().Get("X-User"))
+	cookies := writer.Header()["Set-Cookie"]
+	Assertf(t, len(cookies) == 2 && (cookies[0] == "token=ann-token" || cookies[1] == "token=ann-token"),
+		"Expected 2 cookies including token, got %v", cookies)
+
+	// Outside an HTTP request the header can't be set
+	Assertf(t, !handler.SetHeader(context.Background(), "X-User", "bob"), "Expected SetHeader to fail with no request")
+}
+
+// TestArgsProvided checks that a resolver can tell which arguments were supplied (eg for a partial update)
+func TestArgsProvided(t *testing.T) {
+	var provided map[string]bool
+	h := handler.New(
+		[]string{"type Mutation { update(name: String, age: Int = 0): Boolean! }"},
+		nil,
+		[3][]interface{}{nil, {struct {
+			Update func(context.Context, *string, int) bool `egg:"(name,age=0)"`
+		}{
+			func(ctx context.Context, name *string, age int) bool {
+				provided = handler.ArgsProvided(ctx)
+				return true
+			},
+		}}, nil},
+	)
+
+	tests := map[string]struct {
+		query     string
+		variables string
+		expected  map[string]bool
+	}{
+		"None":            {query: `mutation { update }`, expected: map[string]bool{}},
+		"Default":         {query: `mutation { update(age: 0) }`, expected: map[string]bool{"age": true}},
+		"Null":            {query: `mutation { update(name: null) }`, expected: map[string]bool{"name": true}},
+		"Both":            {query: `mutation { update(name: \"x\", age: 1) }`, expected: map[string]bool{"name": true, "age": true}},
+		"Variable":        {query: `mutation($n: String) { update(name: $n) }`, variables: `{"n": "x"}`, expected: map[string]bool{"name": true}},
+		"NullVariable":    {query: `mutation($n: String) { update(name: $n) }`, variables: `{"n": null}`, expected: map[string]bool{"name": true}},
+		"NoVariable":      {query: `mutation($n: String) { update(name: $n) }`, expected: map[string]bool{}},
+		"VariableDefault": {query: `mutation($a: Int = 2) { update(age: $a) }`, expected: map[string]bool{"age": true}},
+	}
+	for name, test := range tests {
+		provided = nil
+		body := `{"query":"` + test.query + `"`
+		if test.variables != "" {
+			body += `,"variables":` + test.variables
+		}
+		body += `}`
+		request := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		request.Header.Add("Content-Type", "application/json")
+		writer := httptest.NewRecorder()
+		h.ServeHTTP(writer, request)
+		Assertf(t, reflect.DeepEqual(provided, test.expected), "%-16s: expected %v, got %v (%s)", name, test.expected, provided, writer.Body)
+	}
+	Assertf(t, handler.ArgsProvided(context.Background()) == nil, "Expected nil outside a resolver")
+}
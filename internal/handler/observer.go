@@ -0,0 +1,28 @@
+package handler
+
+// observer.go passes events that are not part of the response to any request, such as a difference between the
+// results of a resolver and its candidate (see Shadow option), to the observer (see Observer option) so that they
+// can be logged or used to update metrics
+
+import "github.com/vektah/gqlparser/v2/ast"
+
+// ObserverFunc is called with events found while handling requests that are not returned to the client.  The event
+// is a ShadowMismatch (see Shadow option), a RefreshError (see the "cache=swr:..." tag option) or a DeprecatedUse
+// (for each deprecated field or argument used by an operation).  It may be called concurrently from different
+// go-routines.
+type ObserverFunc func(event interface{})
+
+// observe passes an event to the observer (if any)
+func (h *Handler) observe(event interface{}) {
+	if h.observer != nil {
+		h.observer(event)
+	}
+}
+
+// fieldKey returns the type name and field name of a field, eg "Query.search", as used in events
+func fieldKey(astField *ast.Field) string {
+	if astField.ObjectDefinition == nil {
+		return astField.Name
+	}
+	return astField.ObjectDefinition.Name + "." + astField.Name
+}
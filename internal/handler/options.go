@@ -18,7 +18,14 @@ package handler
 // A pitfall is that if the same option function is used more than once then only the last use has any effect.
 
 import (
+	"context"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sync"
 	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
 )
 
 const (
@@ -43,6 +50,37 @@ func (h *Handler) SetOptions(options ...func(*Handler)) {
 	if h.pongTimeout == 0 {
 		h.pongTimeout = defaultPongTimeout
 	}
+	if h.maxBatchSize == 0 {
+		h.maxBatchSize = DefaultMaxBatchSize
+	}
+	if h.dateTimeFormat == "" {
+		h.dateTimeFormat = field.DefaultDateTimeFormat
+	}
+	if h.maxDeprecatedUses <= 0 {
+		h.maxDeprecatedUses = DefaultMaxDeprecatedUses
+	}
+	if len(h.subprotocols) == 0 {
+		h.subprotocols = []string{oldSubprotocol, newSubprotocol}
+	}
+	if h.rateLimitKey == nil {
+		h.rateLimitKey = clientAddress
+	}
+	if h.auditor != nil {
+		h.auditor.stop() // options are being set again so replace the previous go-routine
+		h.auditor = nil
+	}
+	if h.auditSink != nil {
+		h.auditor = newAuditor(h.auditSink, h.auditBatchSize, h.auditFlushInterval)
+	}
+}
+
+// Close stops any go-routines started by the handler's options (currently just the one used by the Audit option,
+// which first passes on any queued records to the sink).  The handler must not be used after it is closed.
+func (h *Handler) Close() {
+	if h.auditor != nil {
+		h.auditor.stop()
+		h.auditor = nil
+	}
 }
 
 // FuncCache turns on caching forever for the results of function resolvers, but not data (non-func) resolver fields
@@ -54,6 +92,34 @@ func FuncCache(on bool) func(*Handler) {
 	}
 }
 
+// CacheTTL sets how long values are kept in the resolver caches (see FuncCache) - a cached value older than this
+// is not used, so the resolver is called again.  The "cache" option of a field's tag (eg `egg:",cache=30s"`)
+// overrides this for the field.  If zero (the default) cached values are kept forever.
+func CacheTTL(ttl time.Duration) func(*Handler) {
+	return func(h *Handler) {
+		h.cacheTTL = ttl
+	}
+}
+
+// CacheMaxEntries limits the number of values kept in the cache of each resolver, by evicting the least recently
+// used values.  (A resolver with arguments caches a value for each combination of argument values.)  If zero (the
+// default) there is no limit.
+func CacheMaxEntries(n int) func(*Handler) {
+	return func(h *Handler) {
+		h.cacheMaxEntries = n
+	}
+}
+
+// SharedCache keeps the cached values of resolvers (see FuncCache) in a cache backend, such as Redis or memcached,
+// rather than in memory, so that they are shared by all instances of a server.  Values are saved with the time to
+// live set by CacheTTL (or the "cache" option of a field) but CacheMaxEntries and stale-while-revalidate caching are
+// not used, as the backend handles eviction.  Subscriptions still have their own (in memory) caches.
+func SharedCache(backend CacheBackend) func(*Handler) {
+	return func(h *Handler) {
+		h.cacheBackend = backend
+	}
+}
+
 // NoIntrospection turns off all introspection queries
 func NoIntrospection(on bool) func(*Handler) {
 	return func(h *Handler) {
@@ -61,6 +127,27 @@ func NoIntrospection(on bool) func(*Handler) {
 	}
 }
 
+// IntrospectionPolicy sets a function that decides whether a type, or a field of a type, is visible in
+// introspection queries.  The function is given the request context (eg to check the role of the user)
+// and the type name, plus the field name or an empty string when deciding whether the type itself is visible.
+// Hiding a type also hides any fields (and arguments) of that type.
+func IntrospectionPolicy(policy func(ctx context.Context, typeName, fieldName string) bool) func(*Handler) {
+	return func(h *Handler) {
+		h.introspectionPolicy = policy
+	}
+}
+
+// LocalizedDescriptions sets descriptions in other languages, which are returned by introspection queries instead
+// of the descriptions in the schema when the client accepts the language (Accept-Language header).  The outer map
+// is keyed by language tag, in lower case (eg "fr" or "fr-ca" where "fr" is also used for "fr-CA"), and the inner
+// map keys are a type name (eg "Episode"), a field or enum value (eg "Query.hero" or "Episode.JEDI") or an argument
+// (eg "Query.hero.episode").
+func LocalizedDescriptions(descriptions map[string]map[string]string) func(*Handler) {
+	return func(h *Handler) {
+		h.descriptions = descriptions
+	}
+}
+
 // NoConcurrency turns off concurrent execution of queries
 func NoConcurrency(on bool) func(*Handler) {
 	return func(h *Handler) {
@@ -68,6 +155,50 @@ func NoConcurrency(on bool) func(*Handler) {
 	}
 }
 
+// MaxResolverGoroutines limits the number of go-routines used to run resolvers concurrently (shared by all
+// requests) - when they are all busy a resolver is run by the go-routine that needs its value.  This stops huge
+// lists or wide queries creating a great many go-routines.  If n <= 0 there is no limit.
+func MaxResolverGoroutines(n int) func(*Handler) {
+	return func(h *Handler) {
+		h.resolverSem = nil
+		if n > 0 {
+			h.resolverSem = make(chan struct{}, n)
+		}
+	}
+}
+
+// RequestWorkers runs the resolvers of each operation on a pool of (at most) n worker go-routines, rather than a
+// go-routine per resolver.  The workers run the resolvers of shallow fields (near the root of the query) before
+// those of deeper fields, so that expanding a large list of nested objects does not hold up the other top-level
+// fields.  Workers also count towards the limit set by MaxResolverGoroutines.  If n <= 0 there is no pool.
+func RequestWorkers(n int) func(*Handler) {
+	return func(h *Handler) {
+		h.requestWorkers = n
+	}
+}
+
+// LazyInit allows the resolvers of the root structs to be assigned after the handler is created, eg by a dependency
+// injection framework once the handler has been registered with the router.  The root structs must be passed as
+// pointers.  All requests are rejected (HTTP status 503) until Handler.Freeze is called.
+func LazyInit(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.lazyInit = on
+	}
+}
+
+// LookupDiagnostics turns on checking for bugs in the resolver lookup tables.  When a field is not found in the
+// lookup table of a struct the struct is scanned for a matching field, and if one is found a report (the type,
+// its known resolvers and the field name) is logged and the field is used.  This slows queries that use fields
+// of more than one struct (eg fragments on interfaces and unions) so is normally only used when debugging.
+func LookupDiagnostics(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.lookupReported = nil
+		if on {
+			h.lookupReported = &sync.Map{}
+		}
+	}
+}
+
 // NilResolverAllowed allows func resolvers to be nil, whence they return a null value (rather than return an error)
 func NilResolverAllowed(on bool) func(*Handler) {
 	return func(h *Handler) {
@@ -75,6 +206,402 @@ func NilResolverAllowed(on bool) func(*Handler) {
 	}
 }
 
+// MissingResolverNull makes a nullable field that has no resolver return null, rather than an error.  This is
+// for schemas supplied as SDL (see eggql.FromSDL) where, unlike a schema generated from the Go types, some fields
+// may not have a resolver.
+func MissingResolverNull(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.missingResolverNull = on
+	}
+}
+
+// OmitNulls leaves out of the response any field (of nullable type) that resolves to null.  This makes
+// for smaller payloads but is not strictly compliant with the GraphQL spec (which says every requested
+// field is present in the result).  A client can also request this for a single request by setting
+// the "omitNulls" extension to true, even when this option is off.
+func OmitNulls(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.omitNulls = on
+	}
+}
+
+// AddTypename adds the __typename field to every object in the response (apart from the root query/mutation
+// object) even if it was not requested, as some clients (such as those with a normalised cache) rely on it.  For
+// an object of an interface or union type it is the name of the concrete type.  A client can also request this
+// for a single request by setting the "addTypename" extension to true, even when this option is off.
+func AddTypename(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.addTypename = on
+	}
+}
+
+// IDPattern restricts the values a client can supply for an ID (as an argument or variable) to those
+// matching the regular expression.  An ID backed by an integer type must always be numeric.
+func IDPattern(re *regexp.Regexp) func(*Handler) {
+	return func(h *Handler) {
+		h.idPattern = re
+	}
+}
+
+// RateLimitKey sets how a client is identified for field rate limits (see "rateLimit" option of the egg: tag).
+// By default, the client's IP address is used, but you can use anything in the request, such as a user ID
+// obtained from an authorization header.
+func RateLimitKey(key func(*http.Request) string) func(*Handler) {
+	return func(h *Handler) {
+		h.rateLimitKey = key
+	}
+}
+
+// RateLimit limits the rate of requests from each client (see RateLimitKey) to rate requests per second, allowing
+// bursts of up to burst requests.  A request over the limit gets HTTP status 429 (Too Many Requests) with a
+// Retry-After header.  Each websocket connection counts as one request.  If rate <= 0 there is no limit.
+func RateLimit(rate float64, burst int) func(*Handler) {
+	return func(h *Handler) {
+		h.requestLimiter = newRequestLimiter(rate, burst)
+	}
+}
+
+// MaxConcurrentRequests limits how many (HTTP) queries and mutations are handled at the same time.  When n are
+// already being handled a request gets HTTP status 429 (Too Many Requests).  Websocket connections do not count,
+// as they may stay open for a long time.  If n <= 0 there is no limit.
+func MaxConcurrentRequests(n int) func(*Handler) {
+	return func(h *Handler) {
+		h.requestSem = nil
+		if n > 0 {
+			h.requestSem = make(chan struct{}, n)
+		}
+	}
+}
+
+// OperationTimeout sets the time limit for processing a query or mutation request.  Resolvers that take a
+// context.Context parameter can find out how much time remains using eggql.RemainingBudget.
+func OperationTimeout(timeout time.Duration) func(*Handler) {
+	return func(h *Handler) {
+		h.opTimeout = timeout
+	}
+}
+
+// MaxRequestSize limits the size (in bytes) of the body of a POST request.  A request with a larger body is rejected
+// without reading any more of the body.  It also limits the size of a message received on a websocket or WebTransport
+// stream - a larger message closes the connection (close code 1009).  Zero (the default) means there is no limit.
+func MaxRequestSize(size int64) func(*Handler) {
+	return func(h *Handler) {
+		h.maxRequestSize = size
+	}
+}
+
+// MaxBatchSize limits the number of requests in a batch, ie a POST request whose body is a JSON array of requests.
+// The requests of a batch are executed concurrently (unless NoConcurrency is on) and the response is an array of
+// the results.  Zero means the default limit (DefaultMaxBatchSize) and a negative value means batches are rejected.
+func MaxBatchSize(n int) func(*Handler) {
+	return func(h *Handler) {
+		h.maxBatchSize = n
+	}
+}
+
+// MaxComplexity rejects (without executing) any operation with an estimated complexity greater than limit.
+// Each field selected in the operation adds one, but a field (and its sub-selections) is multiplied by the
+// factors of its "complexity" option, eg `egg:"posts(first),complexity(first)"`.  A limit of zero means no limit.
+func MaxComplexity(limit int) func(*Handler) {
+	return func(h *Handler) {
+		h.maxComplexity = limit
+	}
+}
+
+// MaxErrors limits the number of errors in a response.  If an operation produces more than n errors only the
+// first n are returned followed by an error like "and 42 more errors" (with the code TOO_MANY_ERRORS).  This
+// protects clients and log pipelines from huge responses, eg when every element of a large list has an error.
+// Zero (the default) means no limit.
+func MaxErrors(n int) func(*Handler) {
+	return func(h *Handler) {
+		h.maxErrors = n
+	}
+}
+
+// SpecVersion selects the version of the GraphQL specification that the schema must conform to - June2018 or
+// October2021 (the default).  With June2018 the schema must not use features added in the October 2021 spec
+// (repeatable directives, interfaces implementing interfaces and @specifiedBy).  See COMPLIANCE.md.
+func SpecVersion(version string) func(*Handler) {
+	return func(h *Handler) {
+		h.specVersion = version
+	}
+}
+
+// PersistedOperations registers queries that clients can execute by name using a GET request, with the values of
+// variables given as URL query parameters (rather than as JSON).  This allows responses to be cached, eg by a CDN.
+// The map key is the name of the operation (given in the "operation" query parameter).  New logs a fatal error if
+// a query is not valid for the schema.  See PersistedOperation.
+func PersistedOperations(ops map[string]PersistedOperation) func(*Handler) {
+	return func(h *Handler) {
+		h.persistedOps = ops
+	}
+}
+
+// AutomaticPersistedQueries turns on automatic persisted queries (Apollo APQ protocol) so that clients can send
+// the SHA-256 hash of a query (in the persistedQuery request extension) instead of the query text.  Queries are
+// saved in store (eg see NewLRUQueryStore) - if store is nil automatic persisted queries are not used.  If
+// allowList is true queries sent by clients are never saved so only queries already in the store can be executed.
+func AutomaticPersistedQueries(store QueryStore, allowList bool) func(*Handler) {
+	return func(h *Handler) {
+		h.queryStore, h.apqAllowList = store, allowList
+	}
+}
+
+// ResolverMiddleware adds middleware that is called around the resolving of every field (except introspection
+// fields), eg for authorisation checks, logging, metrics or rate limiting.  Middleware is called in the order it
+// is added, and each must call next to continue (unless it returns an error or its own value for the field).
+func ResolverMiddleware(mw ...ResolverMiddlewareFunc) func(*Handler) {
+	return func(h *Handler) {
+		h.resolverMiddleware = append(h.resolverMiddleware, mw...)
+	}
+}
+
+// Directives registers functions for custom directives (keyed by directive name without the @), which are called
+// when a field that has the directive, in the schema or the query, is resolved - eg an @auth directive can check
+// that the user has the role given in its argument, or @uppercase can modify the value.  Note that the directives
+// must also be declared in the schema.  The option can be used more than once to register more directives.
+func Directives(funcs map[string]DirectiveFunc) func(*Handler) {
+	return func(h *Handler) {
+		for name, f := range funcs {
+			if h.directives == nil {
+				h.directives = make(map[string]DirectiveFunc)
+			}
+			h.directives[name] = f
+		}
+	}
+}
+
+// VariableHook sets a function that is called with the variables of each operation (that declares variables)
+// before they are validated and coerced, eg to trim strings, normalise email addresses or inject a tenant ID.
+// The hook may modify the map (a copy is passed for each operation) and any changes are seen by resolver
+// arguments that use the variables directly and variables used within literal (list or input object) arguments.
+// If the hook returns an error the operation is not executed and the error is returned to the client.
+func VariableHook(hook func(ctx context.Context, variables map[string]interface{}) error) func(*Handler) {
+	return func(h *Handler) {
+		h.variableHook = hook
+	}
+}
+
+// ResultArena turns on reuse of the maps and slices used to build the results of queries.  They are obtained from
+// pools and returned to the pools once the response has been sent, which can reduce garbage collection (and GC
+// pauses) when a server sends many large responses.  Resolver values that are cached are copied.
+func ResultArena(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.resultArena = on
+	}
+}
+
+// Tracing turns on the "tracing" extension of query and mutation (HTTP) responses, in the Apollo Tracing format,
+// giving the time taken to parse and validate the request and the time taken by each resolver, so that tools
+// like GraphQL Playground can show where the time was spent.  This has a small overhead, so it is off by default.
+func Tracing(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.tracing = on
+	}
+}
+
+// SecretArgs marks arguments (by name) as secret, in addition to those with the {secret} option in the egg: tag.
+// The values of secret arguments (literals or variables) are replaced with [REDACTED] in all error messages,
+// including those passed to the audit sink.  Only whole values of at least 4 characters are replaced.
+func SecretArgs(names ...string) func(*Handler) {
+	return func(h *Handler) {
+		h.addSecretArgs(names)
+	}
+}
+
+// Types registers (object) types that are not reachable from the query, mutation or subscription structs, such as
+// the concrete types returned by resolvers that return an interface, so that their fields can be resolved.  These
+// are typically the same values as given to schema.Types when the schema is built, eg Types(Human{}, Droid{}).
+func Types(values ...interface{}) func(*Handler) {
+	return func(h *Handler) {
+		for _, v := range values {
+			if v != nil {
+				h.types = append(h.types, reflect.TypeOf(v))
+			}
+		}
+	}
+}
+
+// DateTimeFormat sets the layout (see time.Format) used to encode and decode DateTime (time.Time) values.  The
+// default is RFC 3339 (time.RFC3339), and the same layout should be given to schema.DateTimeFormat.
+func DateTimeFormat(layout string) func(*Handler) {
+	return func(h *Handler) {
+		h.dateTimeFormat = layout
+	}
+}
+
+// FloatFormat sets how Float values (including custom scalars with an underlying float type) are formatted in
+// query results, using the format ('f', 'e' or 'g') and precision of strconv.FormatFloat.  For example, 'f' with
+// a precision of 2 gives exactly two decimal places, and 'f' with a precision of -1 gives the fewest digits that
+// represent the value exactly, always in decimal form (never an exponent).  A format of zero (the default) leaves
+// formatting to the encoding/json package.
+func FloatFormat(format byte, precision int) func(*Handler) {
+	return func(h *Handler) {
+		h.floatFormat, h.floatPrecision = format, precision
+	}
+}
+
+// CaseInsensitiveEnums allows enum values (in query arguments or variables) to differ in case from the values
+// declared in the schema, eg "jedi" or "Jedi" for "JEDI".  Such values are converted to the declared value.
+func CaseInsensitiveEnums(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.caseInsensitiveEnums = on
+	}
+}
+
+// UnknownEnumMessage sets a function that makes the error message returned when a query argument or variable
+// uses a value that is not in the enum.  It is given the enum name, the value used and the valid values, eg to
+// make a message that lists the valid values.
+func UnknownEnumMessage(f func(enum, value string, valid []string) string) func(*Handler) {
+	return func(h *Handler) {
+		h.unknownEnumMessage = f
+	}
+}
+
+// IntEnums makes the named enums (or all enums if no names are given) integers, for clients that prefer the Go
+// value (index into the enum's values) to the name.  The values in results are integers, and integers are also
+// accepted (as well as the names) in query arguments and variables.  The schema (and introspection) is unchanged.
+func IntEnums(on bool, enums ...string) func(*Handler) {
+	return func(h *Handler) {
+		h.intEnums = on
+		h.intEnumNames = nil
+		if len(enums) > 0 {
+			h.intEnumNames = make(map[string]bool, len(enums))
+			for _, name := range enums {
+				h.intEnumNames[name] = true
+			}
+		}
+	}
+}
+
+// Audit sends a record of every operation executed by the handler to the sink.  Records are sent in batches
+// (of up to batchSize records) at least every flushInterval.  Zero values for batchSize and flushInterval
+// mean that defaults of 100 records and 1 second are used.  The records are sent from a go-routine that is
+// stopped by Handler.Close.
+func Audit(sink AuditSink, batchSize int, flushInterval time.Duration) func(*Handler) {
+	return func(h *Handler) {
+		h.auditSink = sink
+		h.auditBatchSize = batchSize
+		h.auditFlushInterval = flushInterval
+	}
+}
+
+// DeprecationHeaders adds a Deprecation header to the HTTP response of a request that uses a deprecated field or
+// argument.  The value of the header is "@" followed by the time of since (as a Unix timestamp), or "true" if since
+// is zero.  If sunset is not zero a Sunset header (when the deprecated fields will be removed) is also added.
+func DeprecationHeaders(on bool, since, sunset time.Time) func(*Handler) {
+	return func(h *Handler) {
+		h.deprecationHeaders = on
+		h.deprecatedSince, h.sunset = since, sunset
+	}
+}
+
+// DeprecationUsage counts how many operations of each client (see RateLimitKey) use each deprecated field or
+// argument - see Handler.DeprecatedUsage
+func DeprecationUsage(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.deprecationUsage = nil
+		if on {
+			h.deprecationUsage = &deprecationUsage{uses: make(map[[2]string]*DeprecatedUse)}
+		}
+	}
+}
+
+// DeprecationUsageLimit sets the max. number of uses (deprecated field or argument, and client) counted by the
+// DeprecationUsage option - after that uses by other clients are counted under the client "*".  If not used (or
+// max <= 0) then DefaultMaxDeprecatedUses is used.
+func DeprecationUsageLimit(max int) func(*Handler) {
+	return func(h *Handler) {
+		h.maxDeprecatedUses = max
+	}
+}
+
+// ServeDocs turns on documentation of the schema, which is returned (as HTML) for a GET request where the
+// URL path ends with "/docs" (eg /graphql/docs).  Add the query parameter format=markdown to get Markdown.
+func ServeDocs(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.serveDocs = on
+	}
+}
+
+// ServeSchema turns on returning the schema (as GraphQL SDL text) for a GET request where the URL path ends
+// with "/schema" (eg /graphql/schema).
+func ServeSchema(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.serveSchema = on
+	}
+}
+
+// ServePlan turns on returning the execution plan of a query (as JSON) for a GET request where the URL path ends
+// with "/plan" (eg /graphql/plan?query={hero{name}}).  The plan describes how each field would be resolved (the Go
+// struct and field, whether it is cached, custom directives, etc) without running any resolvers.  Variables
+// (used by @skip/@include) can be given in the variables query parameter.  This is intended for debugging only.
+func ServePlan(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.servePlan = on
+	}
+}
+
+// Shadow registers "candidate" resolver functions to be run alongside the current resolvers of query fields, eg
+// to check a refactored resolver against real traffic.  The map key is the GraphQL type and field name (eg
+// "Query.search") and each candidate must have the same signature as the field's resolver function.
+// The client always gets the result of the current resolver, while the candidate is run (later) in its own
+// go-routine and a ShadowMismatch is passed to the observer (see Observer option) if the results (or errors)
+// differ.  Candidates are not used for mutations, subscriptions or batch resolvers.  At most 8 candidates run at
+// once (if more are needed they are skipped) and each is cancelled after 10 seconds (or the OperationTimeout).
+func Shadow(candidates map[string]interface{}) func(*Handler) {
+	return func(h *Handler) {
+		if len(candidates) == 0 {
+			h.shadowCandidates, h.shadowSem = nil, nil
+			return
+		}
+		h.shadowCandidates = make(map[string]reflect.Value, len(candidates))
+		for name, candidate := range candidates {
+			h.shadowCandidates[name] = reflect.ValueOf(candidate)
+		}
+		h.shadowSem = make(chan struct{}, shadowConcurrency)
+	}
+}
+
+// Observer sets a function that is passed events that are not part of the response to a request, such as the
+// differences found by the candidate resolvers of the Shadow option, eg to log them or update metrics.
+func Observer(f ObserverFunc) func(*Handler) {
+	return func(h *Handler) {
+		h.observer = f
+	}
+}
+
+// ContextFunc sets a function that makes the context for each request, eg to add values obtained from the headers
+// or cookies (such as the user ID from a JWT) that resolvers use for authorisation.  It is called for HTTP requests
+// (GET and POST) and for the upgrade request of a websocket (before any WebSocketContext function).  If it returns
+// an error the request is rejected with an HTTP status of 401 (Unauthorized).
+func ContextFunc(f func(ctx context.Context, r *http.Request) (context.Context, error)) func(*Handler) {
+	return func(h *Handler) {
+		h.contextFunc = f
+	}
+}
+
+// WebSocketContext sets a function that is called when a websocket is opened to make the context used for all
+// operations (eg subscriptions) on the websocket, typically adding values derived from the upgrade request such
+// as cookies or headers.  The context passed to the function has the values of the request's context, but is
+// only cancelled when the websocket is closed, so the values are available for the lifetime of subscriptions.
+// If the function returns an error the upgrade is rejected with HTTP status 401 (Unauthorized).
+func WebSocketContext(f func(ctx context.Context, r *http.Request) (context.Context, error)) func(*Handler) {
+	return func(h *Handler) {
+		h.wsContext = f
+	}
+}
+
+// InitContext sets a function that is called with the payload of the connection_init message, when a client opens
+// a websocket (or WebTransport stream), to add values to the context of all operations on the connection.  This
+// allows clients that can't set headers on the upgrade request (eg browsers) to authenticate, by sending a token
+// in the payload.  If it returns an error the connection is closed (code 4403 Forbidden for graphql-transport-ws).
+func InitContext(f func(ctx context.Context, payload map[string]interface{}) (context.Context, error)) func(*Handler) {
+	return func(h *Handler) {
+		h.initContext = f
+	}
+}
+
 // InitialTimeout sets the length time to wait from when the websocket is opened until the
 // "connection_init" message is received. If the message is not received from the client
 // within the time limit then an error message is returned to the client and the WS is closed.
@@ -101,3 +628,21 @@ func PongTimeout(timeout time.Duration) func(*Handler) {
 		h.pongTimeout = timeout
 	}
 }
+
+// Subprotocols sets the websocket sub-protocols that are accepted, in order of preference, which may be
+// "graphql-transport-ws" (the newer graphql-ws protocol) and/or "graphql-ws" (the legacy subscriptions-transport-ws
+// protocol).  If the client offers none of them the first is assumed (but see RequireSubprotocol).  The default is
+// "graphql-ws" then "graphql-transport-ws", so the legacy protocol is used if the client does not specify one.
+func Subprotocols(protocols ...string) func(*Handler) {
+	return func(h *Handler) {
+		h.subprotocols = protocols
+	}
+}
+
+// RequireSubprotocol rejects websocket upgrade requests (with HTTP status 400) that do not offer one of the accepted
+// sub-protocols (see Subprotocols), rather than assuming the first accepted sub-protocol.
+func RequireSubprotocol(on bool) func(*Handler) {
+	return func(h *Handler) {
+		h.requireSubprotocol = on
+	}
+}
@@ -0,0 +1,1502 @@
+package handler_test
+
+// options_test.go tests handler options that change the shape or content of the results
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/andrewwphillips/eggql/internal/handler"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// TestOmitNulls checks that null fields are omitted when the option is on or the client asks for it
+func TestOmitNulls(t *testing.T) {
+	const schemaString = "type Query { a: Int b: String! c: [Int!] }"
+	queryData := struct {
+		A *int
+		B string
+		C []int `egg:",nullable"`
+	}{B: "bbb"}
+
+	data := map[string]struct {
+		option   bool   // handler.OmitNulls option setting
+		body     string // request body (JSON)
+		expected interface{}
+	}{
+		"Off":       {false, `{"query":"{ a b c }"}`, JsonObject{"a": nil, "b": "bbb", "c": nil}},
+		"On":        {true, `{"query":"{ a b c }"}`, JsonObject{"b": "bbb"}},
+		"Extension": {false, `{"query":"{ a b c }","extensions":{"omitNulls":true}}`, JsonObject{"b": "bbb"}},
+		"Alias":     {true, `{"query":"{ x:a y:b }"}`, JsonObject{"y": "bbb"}},
+	}
+
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+				handler.OmitNulls(testData.option),
+			)
+			result, errs := doRequest(t, h, testData.body)
+			Assertf(t, errs == nil, "Expected no error and got %v", errs)
+			Assertf(t, reflect.DeepEqual(result, testData.expected), "Expected %v, got %v", testData.expected, result)
+		})
+	}
+}
+
+// TestIDPattern checks that ID arguments are validated against the ID pattern and the type of the ID
+func TestIDPattern(t *testing.T) {
+	const schemaString = "type Query { f(id: ID!): String! g(id: ID!): Int! }"
+	queryData := struct {
+		F func(field.ID) string   `egg:"(id)"`
+		G func(field.IntID) int64 `egg:"(id)"`
+	}{
+		F: func(id field.ID) string { return string(id) },
+		G: func(id field.IntID) int64 { return int64(id) },
+	}
+
+	data := map[string]struct {
+		pattern  string // regexp for handler.IDPattern option ("" = no pattern)
+		query    string
+		expected interface{}
+		errorMsg string // expected error message (substring) or "" if no error expected
+	}{
+		"NoPattern":     {"", `{ f(id: \"x-1\") }`, JsonObject{"f": "x-1"}, ""},
+		"IntAsString":   {"", `{ f(id: 7) }`, JsonObject{"f": "7"}, ""},
+		"Match":         {"^[a-z]-[0-9]+$", `{ f(id: \"x-1\") }`, JsonObject{"f": "x-1"}, ""},
+		"NoMatch":       {"^[a-z]-[0-9]+$", `{ f(id: \"1-x\") }`, nil, "does not match the ID pattern"},
+		"IntID":         {"", `{ g(id: \"12\") }`, JsonObject{"g": 12.0}, ""},
+		"IntIDNotDigit": {"", `{ g(id: \"1x\") }`, nil, "must be numeric"},
+	}
+
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			var options []func(*handler.Handler)
+			if testData.pattern != "" {
+				options = append(options, handler.IDPattern(regexp.MustCompile(testData.pattern)))
+			}
+			h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil}, options...)
+			result, errs := doRequest(t, h, `{"query":"`+testData.query+`"}`)
+			if testData.errorMsg != "" {
+				Assertf(t, len(errs) > 0 && strings.Contains(errs[0], testData.errorMsg),
+					"Expected error containing %q and got %v", testData.errorMsg, errs)
+				return
+			}
+			Assertf(t, errs == nil, "Expected no error and got %v", errs)
+			Assertf(t, reflect.DeepEqual(result, testData.expected), "Expected %v, got %v", testData.expected, result)
+		})
+	}
+}
+
+// TestRateLimit checks that field rate limits are applied separately for each client
+func TestRateLimit(t *testing.T) {
+	const schemaString = "type Query { search: Int! other: Int! }"
+	queryData := struct {
+		Search func() int `egg:",rateLimit=2/h"`
+		Other  func() int
+	}{
+		Search: func() int { return 1 },
+		Other:  func() int { return 2 },
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.RateLimitKey(func(r *http.Request) string { return r.Header.Get("X-User") }),
+	)
+
+	data := []struct {
+		user      string // identifies the client (X-User header)
+		query     string
+		remaining float64 // expected remaining count (in rateLimits extension) if no error
+		errorMsg  string  // expected error message (substring) or "" if no error expected
+	}{
+		{"a", "{ search }", 1, ""},
+		{"a", "{ other }", -1, ""}, // not rate limited (no extension)
+		{"a", "{ search }", 0, ""},
+		{"b", "{ search }", 1, ""}, // different client
+		{"a", "{ search }", 0, "rate limit of 2 exceeded"},
+	}
+
+	for i, testData := range data {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+testData.query+`"}`))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("X-User", testData.user)
+		writer := httptest.NewRecorder()
+		h.ServeHTTP(writer, request)
+
+		var result struct {
+			Errors     []struct{ Message string }
+			Extensions struct {
+				RateLimits map[string]handler.RateLimitStatus
+			}
+		}
+		if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+			t.Fatalf("Error decoding JSON: %v", err)
+		}
+		if testData.errorMsg != "" {
+			Assertf(t, len(result.Errors) > 0 && strings.Contains(result.Errors[0].Message, testData.errorMsg),
+				"%d: Expected error containing %q and got %v", i, testData.errorMsg, result.Errors)
+			continue
+		}
+		Assertf(t, len(result.Errors) == 0, "%d: Expected no error and got %v", i, result.Errors)
+		status, ok := result.Extensions.RateLimits["Query.search"]
+		if testData.remaining < 0 {
+			Assertf(t, !ok, "%d: Expected no rate limit status and got %v", i, status)
+			continue
+		}
+		Assertf(t, ok && status.Limit == 2 && float64(status.Remaining) == testData.remaining,
+			"%d: Expected %v remaining and got %v", i, testData.remaining, status)
+	}
+}
+
+// TestRateLimitOnce checks that a client is charged once for a field however many times it is resolved in an
+// operation, and that a field excluded by a directive is not charged
+func TestRateLimitOnce(t *testing.T) {
+	type Item struct {
+		Price func() int `egg:",rateLimit=2/h"`
+	}
+	price := func() int { return 3 }
+	queryData := struct{ Items []Item }{Items: []Item{{price}, {price}, {price}}}
+	h := handler.New([]string{"type Query { items: [Item!]! } type Item { price: Int! }"}, nil,
+		[3][]interface{}{{queryData}, nil, nil})
+
+	for i, testData := range []struct {
+		query     string
+		remaining int
+	}{
+		{"{ items { price } }", 1},
+		{"{ items { price @skip(if: true) } }", -1},
+		{"{ items { price p2: price } }", 0},
+	} {
+		var result struct {
+			Data       map[string]interface{}
+			Errors     []struct{ Message string }
+			Extensions struct {
+				RateLimits map[string]handler.RateLimitStatus
+			}
+		}
+		request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+testData.query+`"}`))
+		request.Header.Add("Content-Type", "application/json")
+		writer := httptest.NewRecorder()
+		h.ServeHTTP(writer, request)
+		if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+			t.Fatalf("Error decoding JSON: %v", err)
+		}
+		Assertf(t, len(result.Errors) == 0, "%d: Expected no error and got %v", i, result.Errors)
+		status, ok := result.Extensions.RateLimits["Item.price"]
+		if testData.remaining < 0 {
+			Assertf(t, !ok, "%d: Expected no rate limit status and got %v", i, status)
+			continue
+		}
+		Assertf(t, ok && status.Remaining == testData.remaining,
+			"%d: Expected %d remaining and got %v", i, testData.remaining, status)
+	}
+}
+
+// TestRequestLimits checks the limits on the rate of requests of each client and on concurrent requests
+func TestRequestLimits(t *testing.T) {
+	started, finish := make(chan struct{}), make(chan struct{})
+	queryData := struct {
+		A    int
+		Slow func() int
+	}{
+		A:    1,
+		Slow: func() int { started <- struct{}{}; <-finish; return 2 },
+	}
+	h := handler.New([]string{"type Query { a: Int! slow: Int! }"}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.RateLimitKey(func(r *http.Request) string { return r.Header.Get("X-User") }),
+		handler.RateLimit(0.5, 2),
+		handler.MaxConcurrentRequests(1),
+	)
+	send := func(user, query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+query+`"}`))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("X-User", user)
+		writer := httptest.NewRecorder()
+		h.ServeHTTP(writer, request)
+		return writer
+	}
+
+	// The 3rd request of a client within the burst is rejected, but other clients are not affected
+	for i, user := range []string{"a", "a", "b", "a"} {
+		writer := send(user, "{ a }")
+		if i < 3 {
+			Assertf(t, writer.Code == http.StatusOK, "%d: Expected status OK got %d (%s)", i, writer.Code, writer.Body)
+			continue
+		}
+		Assertf(t, writer.Code == http.StatusTooManyRequests, "%d: Expected status 429 got %d", i, writer.Code)
+		Assertf(t, writer.Header().Get("Retry-After") == "2", "Expected Retry-After of 2 got %q",
+			writer.Header().Get("Retry-After"))
+		Assertf(t, strings.Contains(writer.Body.String(), "request rate limit exceeded"),
+			"Expected rate limit error got %s", writer.Body)
+	}
+
+	// While one request is being handled another request (of a different client) is rejected
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send("c", "{ slow }") }()
+	<-started
+	writer := send("d", "{ a }")
+	Assertf(t, writer.Code == http.StatusTooManyRequests, "Expected status 429 got %d", writer.Code)
+	Assertf(t, strings.Contains(writer.Body.String(), "too many concurrent requests"),
+		"Expected concurrent requests error got %s", writer.Body)
+	close(finish)
+	writer = <-done
+	Assertf(t, writer.Code == http.StatusOK, "Expected status OK got %d (%s)", writer.Code, writer.Body)
+	writer = send("d", "{ a }")
+	Assertf(t, writer.Code == http.StatusOK, "Expected status OK got %d (%s)", writer.Code, writer.Body)
+}
+
+// TestMaxResolverGoroutines checks that a query is resolved correctly when the resolver go-routines are limited
+// (including nested resolvers when all the go-routines are busy) and that the limit is not exceeded
+func TestMaxResolverGoroutines(t *testing.T) {
+	var running, peak int32
+	slow := func() int {
+		n := atomic.AddInt32(&running, 1)
+		for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return 1
+	}
+	type N struct{ A, B, C func() int }
+	h := handler.New([]string{"type Query { a: Int! b: Int! n: N! } type N { a: Int! b: Int! c: Int! }"}, nil,
+		[3][]interface{}{{struct {
+			A, B func() int
+			N    N
+		}{slow, slow, N{slow, slow, slow}}}, nil, nil},
+		handler.MaxResolverGoroutines(2),
+	)
+	data, errs := doRequest(t, h, `{"query":"{ a b n { a b c x: a } y: b }"}`)
+	Assertf(t, errs == nil, "Expected no errors got %v", errs)
+	expected := JsonObject{"a": 1.0, "b": 1.0, "n": JsonObject{"a": 1.0, "b": 1.0, "c": 1.0, "x": 1.0}, "y": 1.0}
+	Assertf(t, reflect.DeepEqual(data, expected), "Expected %v got %v", expected, data)
+	// The limit is on the go-routines, but a resolver may also be run by the request's go-routine
+	Assertf(t, peak <= 3, "Expected at most 3 resolvers running at once got %d", peak)
+}
+
+// TestRequestWorkers checks that resolvers (including those of the elements of a list) are run by the pool of
+// workers and the request's go-routine, and that all the results are assembled in order
+func TestRequestWorkers(t *testing.T) {
+	var running, peak int32
+	slow := func() int {
+		n := atomic.AddInt32(&running, 1)
+		for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return 1
+	}
+	type N struct{ A, B func() int }
+	list := make([]N, 10)
+	for i := range list {
+		list[i] = N{slow, slow}
+	}
+	h := handler.New([]string{"type Query { a: Int! b: Int! list: [N!]! } type N { a: Int! b: Int! }"}, nil,
+		[3][]interface{}{{struct {
+			A, B func() int
+			List []N
+		}{slow, slow, list}}, nil, nil},
+		handler.RequestWorkers(2),
+	)
+	data, errs := doRequest(t, h, `{"query":"{ list { a b } a b }"}`)
+	Assertf(t, errs == nil, "Expected no errors got %v", errs)
+	elements := make([]interface{}, len(list))
+	for i := range elements {
+		elements[i] = JsonObject{"a": 1.0, "b": 1.0}
+	}
+	expected := JsonObject{"list": elements, "a": 1.0, "b": 1.0}
+	Assertf(t, reflect.DeepEqual(data, expected), "Expected %v got %v", expected, data)
+	// Resolvers are run by the 2 workers, or by the request's go-routine (when it would otherwise wait)
+	Assertf(t, peak <= 3, "Expected at most 3 resolvers running at once got %d", peak)
+}
+
+// TestMaxBatchSize checks that a batch of requests (JSON array) gets an array of results in the same order, and that
+// batches over the limit are rejected
+func TestMaxBatchSize(t *testing.T) {
+	newHandler := func(options ...func(*handler.Handler)) http.Handler {
+		return handler.New([]string{"type Query { dbl(v: Int!): Int! hello: String! }"}, nil,
+			[3][]interface{}{{struct {
+				Dbl   func(int) int `egg:"(v)"`
+				Hello string
+			}{func(v int) int { time.Sleep(time.Millisecond); return 2 * v }, "hi"}}, nil, nil},
+			options...)
+	}
+	batchData := map[string]struct {
+		handler  http.Handler
+		body     string
+		status   int
+		expected string // response body
+	}{
+		"Batch": {
+			newHandler(),
+			` [{"query":"query($v: Int!) { dbl(v: $v) }","variables":{"v":21}}, {"query":"{ hello }"},` +
+				` {"query":"{ dbl(v: 1) }"}]`,
+			http.StatusOK, `[{"data":{"dbl":42}},{"data":{"hello":"hi"}},{"data":{"dbl":2}}]`,
+		},
+		"Errors": {
+			newHandler(handler.NoConcurrency(true)),
+			`[{"query":"{ hello }"}, {"query":"{ bad }"}]`,
+			http.StatusOK, `[{"data":{"hello":"hi"}},{"data":null,"errors":[{"message":` +
+				`"Cannot query field \"bad\" on type \"Query\".","locations":[{"line":1,"column":3}]}]}]`,
+		},
+		"TooMany": {
+			newHandler(handler.MaxBatchSize(2)),
+			`[{"query":"{ hello }"}, {"query":"{ hello }"}, {"query":"{ hello }"}]`,
+			http.StatusBadRequest, `{"data": null,"errors": [{"message": "Error: a batch must have 1 to 2 requests but has 3"}]}`,
+		},
+		"Empty": {
+			newHandler(),
+			`[]`,
+			http.StatusBadRequest, `{"data": null,"errors": [{"message": "Error: a batch must have 1 to 20 requests but has 0"}]}`,
+		},
+		"Off": {
+			newHandler(handler.MaxBatchSize(-1)),
+			`[{"query":"{ hello }"}]`,
+			http.StatusBadRequest, `{"data": null,"errors": [{"message": "Error: batched requests are not accepted"}]}`,
+		},
+	}
+	for name, testData := range batchData {
+		t.Run(name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+			testData.handler.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(testData.body)))
+			got := strings.TrimSpace(writer.Body.String())
+			Assertf(t, writer.Code == testData.status, "Expected status %d got %d", testData.status, writer.Code)
+			Assertf(t, got == testData.expected, "Expected %s got %s", testData.expected, got)
+		})
+	}
+}
+
+// TestSpecVersion checks that features added in the October 2021 spec are rejected when using the June 2018 spec
+func TestSpecVersion(t *testing.T) {
+	specData := map[string]struct {
+		schema            string
+		june2018, oct2021 string // expected error (substring) or empty string if no error expected
+	}{
+		"Basic": {"type Query { a: Int! }", "", ""},
+		"Repeatable": {
+			"directive @tag(name: String!) repeatable on FIELD_DEFINITION type Query { a: Int! @tag(name: \"x\") }",
+			"repeatable directive @tag", "",
+		},
+		"InterfaceImplements": {
+			"interface A { a: Int! } interface B implements A { a: Int! } type Query implements B & A { a: Int! }",
+			"interface B implementing interface A", "",
+		},
+		"SpecifiedBy": {
+			`scalar URL @specifiedBy(url: "https://tools.ietf.org/html/rfc3986") type Query { a: URL! }`,
+			"@specifiedBy directive on URL", "",
+		},
+	}
+
+	for name, testData := range specData {
+		t.Run(name, func(t *testing.T) {
+			schema, err := gqlparser.LoadSchema(&ast.Source{Input: testData.schema})
+			if err != nil {
+				t.Fatalf("Error loading schema: %v", err)
+			}
+			for version, expected := range map[string]string{
+				handler.June2018: testData.june2018, handler.October2021: testData.oct2021,
+			} {
+				err := handler.CheckSpecVersion(schema, version)
+				if expected == "" {
+					Assertf(t, err == nil, "%s: expected no error and got %v", version, err)
+				} else {
+					Assertf(t, err != nil && strings.Contains(err.Error(), expected), "%s: expected error %q and got %v",
+						version, expected, err)
+				}
+			}
+		})
+	}
+	Assertf(t, handler.CheckSpecVersion(nil, "2015") != nil, "Expected error for unknown spec version")
+}
+
+// TestVariableHook checks that changes made by the variable hook are seen by all uses of the variables
+func TestVariableHook(t *testing.T) {
+	const schemaString = "type Query { f(s: String!): String! g(l: [String!]!): String! }"
+	queryData := struct {
+		F func(string) string   `egg:"(s)"`
+		G func([]string) string `egg:"(l)"`
+	}{
+		F: func(s string) string { return "<" + s + ">" },
+		G: func(l []string) string { return "<" + strings.Join(l, "|") + ">" },
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.VariableHook(func(ctx context.Context, variables map[string]interface{}) error {
+			if _, ok := variables["bad"]; ok {
+				return errors.New("bad variable")
+			}
+			for k, v := range variables {
+				if s, ok := v.(string); ok {
+					variables[k] = strings.TrimSpace(s)
+				}
+			}
+			return nil
+		}),
+	)
+	hookData := map[string]struct {
+		query, variables string
+		expected         interface{}
+		errors           []string
+	}{
+		"Direct":  {`query($v: String!) { f(s: $v) }`, `{"v":" a "}`, map[string]interface{}{"f": "<a>"}, nil},
+		"Literal": {`query($v: String!) { g(l: ["x", $v]) }`, `{"v":" b "}`, map[string]interface{}{"g": "<x|b>"}, nil},
+		"Error":   {`query($bad: String!) { f(s: $bad) }`, `{"bad":"c"}`, map[string]interface{}{}, []string{"bad variable"}},
+		"NoVars":  {`{ f(s: " d ") }`, `{}`, map[string]interface{}{"f": "< d >"}, nil},
+	}
+
+	for name, testData := range hookData {
+		t.Run(name, func(t *testing.T) {
+			data, errs := doRequest(t, h, `{"query":`+strconv.Quote(testData.query)+`,"variables":`+testData.variables+`}`)
+			Assertf(t, reflect.DeepEqual(data, testData.expected), "Expected %v and got %v", testData.expected, data)
+			Assertf(t, reflect.DeepEqual(errs, testData.errors), "Expected errors %v and got %v", testData.errors, errs)
+		})
+	}
+}
+
+// TestResolverMiddleware checks that middleware is called for every field and can deny access or change values
+func TestResolverMiddleware(t *testing.T) {
+	const schemaString = "type Query { user(id: Int!): User! secret: String! } type User { name: String! friends: [User!]! }"
+	type User struct {
+		Name    string
+		Friends []User
+	}
+	queryData := struct {
+		User   func(int) User `egg:"(id)"`
+		Secret string
+	}{
+		User: func(id int) User {
+			return User{Name: "u" + strconv.Itoa(id), Friends: []User{{Name: "f1"}, {Name: "f2"}}}
+		},
+		Secret: "password",
+	}
+	var mu sync.Mutex
+	var calls []string
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.ResolverMiddleware(
+			func(ctx context.Context, info handler.ResolverInfo, next handler.Resolver) (interface{}, error) {
+				mu.Lock()
+				calls = append(calls, fmt.Sprintf("%s %s.%s %v", info.Path, info.TypeName, info.FieldName, info.Args))
+				mu.Unlock()
+				return next(ctx)
+			},
+			func(ctx context.Context, info handler.ResolverInfo, next handler.Resolver) (interface{}, error) {
+				if info.FieldName == "secret" {
+					return nil, errors.New("not authorised")
+				}
+				value, err := next(ctx)
+				if s, ok := value.(string); ok {
+					value = strings.ToUpper(s)
+				}
+				return value, err
+			},
+		),
+	)
+	middlewareData := map[string]struct {
+		query    string
+		expected interface{}
+		errors   []string
+		calls    []string
+	}{
+		"Nested": {`{ u: user(id: 1) { name friends { name } } }`,
+			map[string]interface{}{"u": map[string]interface{}{"name": "U1", "friends": []interface{}{
+				map[string]interface{}{"name": "F1"}, map[string]interface{}{"name": "F2"}}}},
+			nil,
+			[]string{"u Query.user map[id:1]", "u.friends User.friends map[]", "u.friends[0].name User.name map[]",
+				"u.friends[1].name User.name map[]", "u.name User.name map[]"},
+		},
+		"Denied":        {`{ secret }`, map[string]interface{}{}, []string{"not authorised"}, []string{"secret Query.secret map[]"}},
+		"Introspection": {`{ __typename }`, map[string]interface{}{"__typename": "Query"}, nil, nil},
+	}
+
+	for name, testData := range middlewareData {
+		t.Run(name, func(t *testing.T) {
+			calls = nil
+			data, errs := doRequest(t, h, `{"query":`+strconv.Quote(testData.query)+`}`)
+			sort.Strings(calls)
+			Assertf(t, reflect.DeepEqual(data, testData.expected), "Expected %v and got %v", testData.expected, data)
+			Assertf(t, reflect.DeepEqual(errs, testData.errors), "Expected errors %v and got %v", testData.errors, errs)
+			Assertf(t, reflect.DeepEqual(calls, testData.calls), "Expected calls %q and got %q", testData.calls, calls)
+		})
+	}
+}
+
+// TestDirectives checks that the functions of custom directives are called for fields that have the directive in
+// the schema or in the query, and that @skip/@include still work
+func TestDirectives(t *testing.T) {
+	const schemaString = `directive @auth(role: String!) on FIELD_DEFINITION directive @uppercase on FIELD
+		type Query { name: String! secret: String! @auth(role: "admin") }`
+	queryData := struct {
+		Name   string
+		Secret string
+	}{Name: "eggql", Secret: "password"}
+
+	type roleKey struct{}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.Directives(map[string]handler.DirectiveFunc{
+			"auth": func(ctx context.Context, args map[string]interface{}, next handler.Resolver) (interface{}, error) {
+				if ctx.Value(roleKey{}) != args["role"] {
+					return nil, fmt.Errorf("requires %v role", args["role"])
+				}
+				return next(ctx)
+			},
+			"uppercase": func(ctx context.Context, args map[string]interface{}, next handler.Resolver) (interface{}, error) {
+				value, err := next(ctx)
+				if s, ok := value.(string); ok {
+					value = strings.ToUpper(s)
+				}
+				return value, err
+			},
+		}),
+		handler.ContextFunc(func(ctx context.Context, r *http.Request) (context.Context, error) {
+			return context.WithValue(ctx, roleKey{}, r.Header.Get("Role")), nil
+		}),
+	)
+
+	directiveData := map[string]struct {
+		role     string // value of Role header (see ContextFunc above)
+		query    string
+		expected interface{}
+		errors   []string
+	}{
+		"None":      {"", `{ name }`, map[string]interface{}{"name": "eggql"}, nil},
+		"Query":     {"", `{ name @uppercase }`, map[string]interface{}{"name": "EGGQL"}, nil},
+		"Denied":    {"user", `{ secret }`, map[string]interface{}{}, []string{"requires admin role"}},
+		"Allowed":   {"admin", `{ s: secret @uppercase }`, map[string]interface{}{"s": "PASSWORD"}, nil},
+		"Skip":      {"", `{ name secret @skip(if: true) }`, map[string]interface{}{"name": "eggql"}, nil},
+		"SkipFalse": {"", `query ($x: Boolean!) { name @include(if: $x) }`, map[string]interface{}{}, nil},
+	}
+
+	for name, testData := range directiveData {
+		t.Run(name, func(t *testing.T) {
+			body := `{"query":` + strconv.Quote(testData.query) + `,"variables":{"x":false}}`
+			request := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			request.Header.Add("Content-Type", "application/json")
+			request.Header.Add("Role", testData.role)
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, request)
+
+			var result struct {
+				Data   interface{}
+				Errors []struct{ Message string }
+			}
+			if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+				t.Fatalf("Error decoding JSON: %v", err)
+			}
+			var errs []string
+			for _, e := range result.Errors {
+				errs = append(errs, e.Message)
+			}
+			Assertf(t, reflect.DeepEqual(result.Data, testData.expected), "Expected %v and got %v", testData.expected, result.Data)
+			Assertf(t, reflect.DeepEqual(errs, testData.errors), "Expected errors %v and got %v", testData.errors, errs)
+		})
+	}
+}
+
+// auditRecorder is an audit sink that passes on the records it receives on a channel
+type auditRecorder chan []handler.OperationRecord
+
+func (a auditRecorder) Audit(records []handler.OperationRecord) { a <- records }
+
+// TestAudit checks that a record of each operation is sent to the audit sink
+func TestAudit(t *testing.T) {
+	const schemaString = "type Query { a: Int! }"
+	queryData := struct{ A int }{A: 42}
+	sink := make(auditRecorder, 1)
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.Audit(sink, 2, time.Millisecond),
+	)
+
+	doRequest(t, h, `{"query":"query Q { a }","variables":{"v":1}}`)
+	doRequest(t, h, `{"query":"query($x: Boolean!) { a @include(if: $x) }"}`) // missing variable
+
+	var records []handler.OperationRecord
+	for len(records) < 2 {
+		select {
+		case batch := <-sink:
+			records = append(records, batch...)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 2 audit records but got %d", len(records))
+		}
+	}
+	Assertf(t, records[0].Name == "Q" && records[0].Operation == "query", "Expected query Q and got %q %q",
+		records[0].Operation, records[0].Name)
+	Assertf(t, records[0].VariablesSize == len(`{"v":1}`), "Expected variables size 7 and got %d", records[0].VariablesSize)
+	Assertf(t, len(records[0].Hash) == 64 && records[0].Hash != records[1].Hash, "Expected different hashes and got %q %q",
+		records[0].Hash, records[1].Hash)
+	Assertf(t, len(records[0].Errors) == 0, "Expected no errors and got %v", records[0].Errors)
+	Assertf(t, len(records[1].Errors) > 0, "Expected an error for the 2nd operation")
+}
+
+// TestAuditClose checks that queued audit records are passed to the sink when the handler is closed
+func TestAuditClose(t *testing.T) {
+	const schemaString = "type Query { a: Int! }"
+	queryData := struct{ A int }{A: 42}
+	sink := make(auditRecorder, 1)
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.Audit(sink, 10, time.Hour),
+	).(*handler.Handler)
+	h.SetOptions() // restarts the audit go-routine
+
+	doRequest(t, h, `{"query":"{ a }"}`)
+	h.Close() // should flush the record even though the batch is not full and the flush interval has not expired
+
+	select {
+	case batch := <-sink:
+		Assertf(t, len(batch) == 1, "Expected 1 audit record but got %d", len(batch))
+	default:
+		t.Fatalf("Expected audit record to be sent when the handler is closed")
+	}
+}
+
+// TestServeDocs checks that documentation of the schema is served (as HTML or Markdown) when the option is on
+func TestServeDocs(t *testing.T) {
+	const schemaString = `"The root query" type Query { "Get a user" user("user ID" id: ID!): User } ` +
+		`type User { name: String! old: Int @deprecated(reason: "use new") role: Role } ` +
+		`enum Role { ADMIN "<b>guest</b>" GUEST }`
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{struct{}{}}, nil, nil},
+		handler.ServeDocs(true),
+		handler.NilResolverAllowed(true),
+	)
+	docsData := map[string]struct {
+		url         string
+		contentType string
+		contains    []string
+	}{
+		"HTML": {"/graphql/docs", "text/html", []string{`<h2 id="Query">Query</h2>`, "The root query", "Get a user",
+			`<a href="#User">User</a>`, "use new", "&lt;b&gt;guest&lt;/b&gt;"}},
+		"Markdown": {"/graphql/docs?format=markdown", "text/markdown", []string{"## Query", "The root query",
+			"`user(id: ID!): User` - Get a user", "`id` - user ID", "**Deprecated:** use new", "- `GUEST`"}},
+	}
+
+	for name, testData := range docsData {
+		t.Run(name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, httptest.NewRequest("GET", testData.url, nil))
+			Assertf(t, writer.Code == http.StatusOK, "Unexpected response code %d", writer.Code)
+			Assertf(t, strings.HasPrefix(writer.Header().Get("Content-Type"), testData.contentType),
+				"Expected content type %q and got %q", testData.contentType, writer.Header().Get("Content-Type"))
+			body := writer.Body.String()
+			for _, s := range testData.contains {
+				Assertf(t, strings.Contains(body, s), "Expected %q in docs:\n%s", s, body)
+			}
+			Assertf(t, !strings.Contains(body, "__schema"), "Expected no introspection fields in docs")
+		})
+	}
+}
+
+// TestServeSchema checks that the schema is returned (as SDL text) when the option is on
+func TestServeSchema(t *testing.T) {
+	const schemaString = "type Query { message: String! }"
+	for _, on := range []bool{true, false} {
+		h := handler.New([]string{schemaString}, nil, [3][]interface{}{{struct{ Message string }{"hi"}}, nil, nil},
+			handler.ServeSchema(on),
+		)
+		writer := httptest.NewRecorder()
+		h.ServeHTTP(writer, httptest.NewRequest("GET", "/graphql/schema", nil))
+		if on {
+			Assertf(t, writer.Code == http.StatusOK && writer.Body.String() == schemaString,
+				"Expected schema %q and got %q (status %d)", schemaString, writer.Body, writer.Code)
+		} else {
+			Assertf(t, writer.Code != http.StatusOK, "Expected no schema when option is off and got %q", writer.Body)
+		}
+		Assertf(t, h.(*handler.Handler).Schema() == schemaString, "Expected Schema() to return %q", schemaString)
+	}
+}
+
+// TestServePlan checks that the execution plan of a query is returned (as JSON) when the option is on
+func TestServePlan(t *testing.T) {
+	type Friend struct{ Name string }
+	h := handler.New([]string{`type Query { hero(id: Int!): Friend! count: Int! } type Friend { name: String! }`},
+		nil, [3][]interface{}{{struct {
+			Hero  func(int) Friend `egg:"(id)"`
+			Count int
+		}{Hero: func(id int) Friend { return Friend{"Luke"} }}}, nil, nil},
+		handler.ServePlan(true), handler.FuncCache(true),
+	)
+	testData := map[string]struct {
+		query, variables string
+		expected         string
+	}{
+		"Fields": {`{ h: hero(id: 1) { name } count }`, "",
+			`[{"operation":"query","concurrent":true,"fields":[` +
+				`{"name":"h","field":"Query.hero","type":"Friend!","goType":"struct","goField":"Hero","resolver":"func",` +
+				`"cached":true,"fields":[{"name":"name","field":"Friend.name","type":"String!",` +
+				`"goType":"handler_test.Friend","goField":"Name","resolver":"value"}]},` +
+				`{"name":"count","field":"Query.count","type":"Int!","goType":"struct","goField":"Count","resolver":"value"}]}]`},
+		"Skipped": {`query Q($s: Boolean!) { count @skip(if: $s) }`, `{"s":true}`,
+			`[{"name":"Q","operation":"query","concurrent":true,"fields":[` +
+				`{"name":"count","field":"Query.count","type":"Int!","skipped":true}]}]`},
+		"Error": {`{ unknown }`, "", `{"data":null,"errors":[{"message":"Cannot query field \"unknown\" on type \"Query\".",` +
+			`"locations":[{"line":1,"column":3}]}]}`},
+	}
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			values := url.Values{"query": {data.query}}
+			if data.variables != "" {
+				values.Set("variables", data.variables)
+			}
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, httptest.NewRequest("GET", "/graphql/plan?"+values.Encode(), nil))
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, writer.Body.Bytes()); err != nil {
+				t.Fatalf("Error compacting JSON %q: %v", writer.Body, err)
+			}
+			Assertf(t, compact.String() == data.expected, "Expected %s and got %s", data.expected, compact.String())
+		})
+	}
+}
+
+// TestPersistedOperations checks that persisted operations can be executed by name with a GET request, using URL
+// query parameters (converted to the declared types) for the variables
+func TestPersistedOperations(t *testing.T) {
+	type Point struct{ X, Y int }
+	h := handler.New([]string{`type Query { add(a: Int!, b: Float! = 0.5): Float! ` +
+		`join(words: [String!]!, upper: Boolean! = false): String! dist(p: Point!): Int! } ` +
+		`input Point { x: Int! y: Int! }`}, nil,
+		[3][]interface{}{{struct {
+			Add  func(int, float64) float64  `egg:"(a,b=0.5)"`
+			Join func([]string, bool) string `egg:"(words,upper=false)"`
+			Dist func(Point) int             `egg:"(p)"`
+		}{
+			Add: func(a int, b float64) float64 { return float64(a) + b },
+			Join: func(words []string, upper bool) string {
+				if upper {
+					return strings.ToUpper(strings.Join(words, " "))
+				}
+				return strings.Join(words, " ")
+			},
+			Dist: func(p Point) int { return p.X + p.Y },
+		}}, nil, nil},
+		handler.PersistedOperations(map[string]handler.PersistedOperation{
+			"add":  {Query: "query($a: Int!, $b: Float! = 0.5) { add(a: $a, b: $b) }"},
+			"join": {Query: "query($w: [String!]!, $u: Boolean!) { join(words: $w, upper: $u) }", Params: map[string]string{"w": "word"}},
+			"dist": {Query: "query($p: Point!) { dist(p: $p) }"},
+		}),
+	)
+	persistedData := map[string]struct {
+		url      string
+		code     int
+		expected string // expected response (substring)
+	}{
+		"Int":         {"/?operation=add&a=1", http.StatusOK, `{"data":{"add":1.5}}`},
+		"Float":       {"/?operation=add&a=1&b=2.25", http.StatusOK, `{"data":{"add":3.25}}`},
+		"ListBoolean": {"/?operation=join&word=a&word=b&u=true", http.StatusOK, `{"data":{"join":"A B"}}`},
+		"InputObject": {"/?operation=dist&p=" + url.QueryEscape(`{"x":3,"y":4}`), http.StatusOK, `{"data":{"dist":7}}`},
+		"BadInt":      {"/?operation=add&a=one", http.StatusBadRequest, `query parameter \"a\" for variable \"a\"`},
+		"Repeated":    {"/?operation=add&a=1&a=2", http.StatusBadRequest, "expected one value but got 2"},
+		"Missing":     {"/?operation=add", http.StatusOK, `must be defined`},
+		"Unknown":     {"/?operation=sub&a=1", http.StatusNotFound, "persisted operation not found"},
+	}
+
+	for name, testData := range persistedData {
+		t.Run(name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, httptest.NewRequest("GET", testData.url, nil))
+			Assertf(t, writer.Code == testData.code, "Expected response code %d got %d", testData.code, writer.Code)
+			Assertf(t, strings.Contains(writer.Body.String(), testData.expected), "Expected %s in response got %s",
+				testData.expected, writer.Body.String())
+		})
+	}
+}
+
+// TestAutomaticPersistedQueries checks that queries can be sent by hash once the server has seen the query text
+// and that only queries in the store can be executed in allow-list mode
+func TestAutomaticPersistedQueries(t *testing.T) {
+	qData := struct{ Message string }{"hello"}
+	const query = "{ message }"
+	hash := handler.QueryHash(query)
+	apq := func(query, hash string) string {
+		q, _ := json.Marshal(query)
+		return `{"query":` + string(q) + `,"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}}`
+	}
+	apqData := []struct {
+		name      string
+		allowList bool
+		body      string
+		expected  string // expected error (empty if the query should succeed)
+	}{
+		{"NotSupported", false, apq("", hash), "PersistedQueryNotSupported"},
+		{"NotFound", false, apq("", hash), "PersistedQueryNotFound"},
+		{"Register", false, apq(query, hash), ""},
+		{"Found", false, apq("", hash), ""},
+		{"Mismatch", false, apq("{ __typename }", hash), "provided sha256Hash does not match query"},
+		{"PlainQuery", false, `{"query":"{ __typename message }"}`, ""},
+		{"AllowedHash", true, apq("", hash), ""},
+		{"AllowedText", true, `{"query":"{ message }"}`, ""},
+		{"NotAllowed", true, `{"query":"{ __typename message }"}`, "query is not in the allow-list"},
+		{"NotRegistered", true, apq("{ __typename }", handler.QueryHash("{ __typename }")), "query is not in the allow-list"},
+	}
+
+	store := handler.NewLRUQueryStore(10)
+	allowStore := handler.NewLRUQueryStore(0, query)
+	for _, testData := range apqData {
+		t.Run(testData.name, func(t *testing.T) {
+			var option func(*handler.Handler)
+			switch {
+			case testData.name == "NotSupported":
+				option = handler.AutomaticPersistedQueries(nil, false)
+			case testData.allowList:
+				option = handler.AutomaticPersistedQueries(allowStore, true)
+			default:
+				option = handler.AutomaticPersistedQueries(store, false)
+			}
+			h := handler.New([]string{"type Query { message: String! }"}, nil,
+				[3][]interface{}{{qData}, nil, nil}, option)
+			data, errs := doRequest(t, h, testData.body)
+			if testData.expected != "" {
+				Assertf(t, len(errs) == 1 && errs[0] == testData.expected, "Expected error %q got %v",
+					testData.expected, errs)
+				return
+			}
+			Assertf(t, len(errs) == 0, "Expected no errors got %v", errs)
+			Assertf(t, data.(map[string]interface{})["message"] == "hello", "Expected message got %v", data)
+		})
+	}
+}
+
+// doRequest POSTs a request (JSON body) to a handler and returns the decoded data and error messages (if any)
+func doRequest(t *testing.T, h http.Handler, body string) (interface{}, []string) {
+	t.Helper()
+	request := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	request.Header.Add("Content-Type", "application/json")
+
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, request)
+	if writer.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected response code %d", writer.Code)
+	}
+
+	var result struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	var messages []string
+	for _, e := range result.Errors {
+		messages = append(messages, e.Message)
+	}
+	return result.Data, messages
+}
+
+// TestResultArena checks that results are correct when the maps and slices used to build them are reused, including
+// cached values (which must not use reused maps/slices) and after an error (when they are not reused)
+func TestResultArena(t *testing.T) {
+	const schemaString = "type Query { list: [E!]! cached: [E!]! e(i: Int!): E! } type E { v: Int! w: String! }"
+	type E struct {
+		V int
+		W string
+	}
+	list := []E{{1, "a"}, {2, "b"}, {3, "c"}}
+	queryData := struct {
+		List   []E
+		Cached func() []E
+		E      func(int) (E, error) `egg:"(i),no_cache"`
+	}{
+		List:   list,
+		Cached: func() []E { return list },
+		E: func(i int) (E, error) {
+			if i < 0 || i >= len(list) {
+				return E{}, fmt.Errorf("index %d out of range", i)
+			}
+			return list[i], nil
+		},
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.ResultArena(true),
+		handler.FuncCache(true),
+		handler.NoIntrospection(true),
+	)
+	expectedList := []interface{}{
+		JsonObject{"v": 1.0, "w": "a"}, JsonObject{"v": 2.0, "w": "b"}, JsonObject{"v": 3.0, "w": "c"},
+	}
+	for i := 0; i < 10; i++ {
+		data, errs := doRequest(t, h, `{"query":"{ list { v w } cached { v w } }"}`)
+		expected := JsonObject{"list": expectedList, "cached": expectedList}
+		Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+		Assertf(t, reflect.DeepEqual(data, expected), "%d: expected %v and got %v", i, expected, data)
+
+		_, errs = doRequest(t, h, `{"query":"{ list { w } e(i: 9) { v } }"}`)
+		Assertf(t, len(errs) == 1, "%d: expected an error and got %v", i, errs)
+
+		data, errs = doRequest(t, h, `{"query":"{ e(i: 1) { w } cached { v w } }"}`)
+		expected = JsonObject{"e": JsonObject{"w": "b"}, "cached": expectedList}
+		Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+		Assertf(t, reflect.DeepEqual(data, expected), "%d: expected %v and got %v", i, expected, data)
+	}
+}
+
+// TestTracing checks that the timing of the request and each resolver is returned in the "tracing" extension
+func TestTracing(t *testing.T) {
+	const schemaString = "type Query { list: [E!]! slow: Int } type E { v: Int! }"
+	type E struct{ V int }
+	queryData := struct {
+		List []E
+		Slow func() int
+	}{
+		List: []E{{1}, {2}},
+		Slow: func() int { time.Sleep(10 * time.Millisecond); return 1 },
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil}, handler.Tracing(true))
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"{ list { v } slow __typename }"}`))
+	request.Header.Add("Content-Type", "application/json")
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, request)
+
+	var result struct {
+		Extensions struct {
+			Tracing struct {
+				Version    int
+				StartTime  time.Time
+				EndTime    time.Time
+				Duration   int64
+				Parsing    struct{ StartOffset, Duration int64 }
+				Validation struct{ StartOffset, Duration int64 }
+				Execution  struct {
+					Resolvers []struct {
+						Path                              []interface{}
+						ParentType, FieldName, ReturnType string
+						StartOffset, Duration             int64
+					}
+				}
+			}
+		}
+	}
+	if err := json.NewDecoder(writer.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	tracing := result.Extensions.Tracing
+	Assertf(t, tracing.Version == 1, "Expected version 1, got %d", tracing.Version)
+	Assertf(t, tracing.Duration >= int64(10*time.Millisecond) && tracing.EndTime.Sub(tracing.StartTime) > 0,
+		"Expected duration of at least 10ms, got %d", tracing.Duration)
+	Assertf(t, tracing.Validation.StartOffset >= tracing.Parsing.StartOffset+tracing.Parsing.Duration,
+		"Expected validation after parsing, got %v %v", tracing.Parsing, tracing.Validation)
+
+	paths := map[string]string{} // path -> "parentType.fieldName: returnType"
+	for _, r := range tracing.Execution.Resolvers {
+		path, _ := json.Marshal(r.Path)
+		paths[string(path)] = r.ParentType + "." + r.FieldName + ": " + r.ReturnType
+		if r.FieldName == "slow" {
+			Assertf(t, r.Duration >= int64(10*time.Millisecond), "Expected slow to take at least 10ms, got %d", r.Duration)
+		}
+	}
+	expected := map[string]string{
+		`["list"]`:       "Query.list: [E!]!",
+		`["list",0,"v"]`: "E.v: Int!",
+		`["list",1,"v"]`: "E.v: Int!",
+		`["slow"]`:       "Query.slow: Int",
+	}
+	Assertf(t, reflect.DeepEqual(paths, expected), "Expected resolvers %v, got %v", expected, paths)
+}
+
+// TestShadow checks that the result of the current resolver is returned and that a different result from the
+// candidate resolver is reported
+func TestShadow(t *testing.T) {
+	const schemaString = "type Query { double(i: Int!): Int! }"
+	queryData := struct {
+		Double func(int) int `egg:"(i)"`
+	}{
+		Double: func(i int) int { return i * 2 },
+	}
+	mismatches := make(chan handler.ShadowMismatch, 10)
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.Shadow(map[string]interface{}{
+			"Query.double": func(i int) int {
+				if i == 3 {
+					return 7 // bug in the candidate
+				}
+				return i + i
+			},
+		}),
+		handler.Observer(func(event interface{}) { mismatches <- event.(handler.ShadowMismatch) }),
+	)
+	for _, i := range []int{1, 2, 3} {
+		data, errs := doRequest(t, h, fmt.Sprintf(`{"query":"{ double(i: %d) }"}`, i))
+		expected := JsonObject{"double": float64(i * 2)}
+		Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+		Assertf(t, reflect.DeepEqual(data, expected), "Expected %v and got %v", expected, data)
+	}
+	select {
+	case m := <-mismatches:
+		Assertf(t, m.Field == "Query.double" && m.Path == "double", "Unexpected field %q path %q", m.Field, m.Path)
+		Assertf(t, fmt.Sprint(m.Primary) == "6" && fmt.Sprint(m.Candidate) == "7",
+			"Expected mismatch 6/7 and got %v/%v", m.Primary, m.Candidate)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a mismatch to be reported")
+	}
+	select {
+	case m := <-mismatches:
+		t.Fatalf("Unexpected mismatch %v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestShadowChecks checks that invalid candidates are rejected and that a slow candidate is cancelled
+func TestShadowChecks(t *testing.T) {
+	const schemaString = "type Query { slow: Int! } type Mutation { set(i: Int!): Int! }"
+	queryData := struct {
+		Slow func(context.Context) (int, error)
+	}{
+		Slow: func(context.Context) (int, error) { return 1, nil },
+	}
+	mutationData := struct {
+		Set func(int) int `egg:"(i)"`
+	}{
+		Set: func(i int) int { return i },
+	}
+	candidate := func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	observer := handler.Observer(func(interface{}) {})
+	for key, expected := range map[string]string{
+		"Query.slow":    "",
+		"Query.fast":    "not a field",
+		"Post.slow":     "not a field",
+		"slow":          "not a field",
+		"Mutation.set":  "not a query field",
+		"Query.slow.no": "not a field",
+	} {
+		_, err := handler.NewE([]string{schemaString}, nil, [3][]interface{}{{queryData}, {mutationData}, nil},
+			handler.Shadow(map[string]interface{}{key: candidate}), observer)
+		Assertf(t, expected == "" && err == nil || expected != "" && err != nil && strings.Contains(err.Error(), expected),
+			"%-14s: expected error %q, got %v", key, expected, err)
+	}
+	_, err := handler.NewE([]string{schemaString}, nil, [3][]interface{}{{queryData}, {mutationData}, nil},
+		handler.Shadow(map[string]interface{}{"Query.slow": candidate}))
+	Assertf(t, err != nil && strings.Contains(err.Error(), "Observer"), "Expected observer error, got %v", err)
+
+	mismatches := make(chan handler.ShadowMismatch, 10)
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, {mutationData}, nil},
+		handler.Shadow(map[string]interface{}{"Query.slow": candidate}),
+		handler.Observer(func(event interface{}) { mismatches <- event.(handler.ShadowMismatch) }),
+		handler.OperationTimeout(50*time.Millisecond),
+	)
+	data, errs := doRequest(t, h, `{"query":"{ slow }"}`)
+	Assertf(t, len(errs) == 0 && reflect.DeepEqual(data, JsonObject{"slow": 1.0}), "Expected 1 and got %v %v", data, errs)
+	select {
+	case m := <-mismatches:
+		Assertf(t, errors.Is(m.CandidateErr, context.DeadlineExceeded), "Expected deadline exceeded and got %v",
+			m.CandidateErr)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the candidate to be cancelled")
+	}
+}
+
+// TestMissingResolverNull checks that a field with no resolver is an error, or null with MissingResolverNull
+func TestMissingResolverNull(t *testing.T) {
+	const schemaString = "type Query { a: Int! b: Int }"
+	queryData := struct{ A int }{A: 42}
+
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil})
+	data, errs := doRequest(t, h, `{"query":"{ a b }"}`)
+	Assertf(t, len(errs) == 1 && errs[0] == `no resolver found for field "b"`, "Expected resolver error and got %v", errs)
+	Assertf(t, reflect.DeepEqual(data, JsonObject{"a": 42.0, "b": nil}), "Expected b to be null and got %v", data)
+
+	h = handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.MissingResolverNull(true),
+	)
+	data, errs = doRequest(t, h, `{"query":"{ a b }"}`)
+	Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+	Assertf(t, reflect.DeepEqual(data, JsonObject{"a": 42.0, "b": nil}), "Expected b to be null and got %v", data)
+}
+
+// TestMaxRequestSize checks that a POST request with a body larger than the limit is rejected
+func TestMaxRequestSize(t *testing.T) {
+	const schemaString = "type Query { a: Int! }"
+	queryData := struct{ A int }{A: 42}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.MaxRequestSize(100),
+	)
+
+	data, errs := doRequest(t, h, `{"query":"{ a }"}`)
+	Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+	Assertf(t, reflect.DeepEqual(data, JsonObject{"a": 42.0}), "Expected a: 42 and got %v", data)
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"{ a`+strings.Repeat(" ", 100)+`}"}`))
+	request.Header.Add("Content-Type", "application/json")
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, request)
+	Assertf(t, writer.Code == http.StatusBadRequest, "Expected status 400 and got %d", writer.Code)
+
+	// By default there is no limit
+	h = handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil})
+	data, errs = doRequest(t, h, `{"query":"{ a`+strings.Repeat(" ", 2<<20)+`}"}`)
+	Assertf(t, len(errs) == 0, "Expected no errors for a large request and got %v", errs)
+	Assertf(t, reflect.DeepEqual(data, JsonObject{"a": 42.0}), "Expected a: 42 and got %v", data)
+}
+
+// TestMaxComplexity checks that operations with an estimated complexity greater than the limit are not executed
+func TestMaxComplexity(t *testing.T) {
+	const schemaString = "type Query { posts(first: Int! = 10): [Post!]! } " +
+		"type Post { title: String! author: Author! } type Author { name: String! }"
+	type Author struct{ Name string }
+	type Post struct {
+		Title  string
+		Author Author
+	}
+	called := 0
+	queryData := struct {
+		Posts func(int) []Post `egg:"(first=10),complexity(first)"`
+	}{
+		Posts: func(first int) []Post {
+			called++
+			return []Post{{"Hello", Author{"Andrew"}}}
+		},
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.MaxComplexity(50),
+		handler.NoIntrospection(true),
+	)
+	testData := map[string]struct {
+		query    string
+		errorMsg string // expected error or "" if the query should be executed
+	}{
+		"Simple":   {`{ posts(first: 2) { title } }`, ""},
+		"Nested":   {`{ posts(first: 5) { title author { name } } }`, ""},
+		"Default":  {`{ posts { title author { name } } }`, ""},
+		"TooMany":  {`{ posts(first: 20) { title author { name } } }`, "operation complexity 80 exceeds the limit of 50"},
+		"Fragment": {`{ posts(first: 13) { ...F } } fragment F on Post { title author { name } }`, "complexity 52"},
+		"Skipped":  {`{ posts(first: 13) { title author @skip(if: true) { name } } }`, ""},
+	}
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			called = 0
+			query, _ := json.Marshal(data.query)
+			_, errs := doRequest(t, h, `{"query":`+string(query)+`}`)
+			if data.errorMsg == "" {
+				Assertf(t, len(errs) == 0 && called == 1, "Expected query to be executed and got %v", errs)
+				return
+			}
+			Assertf(t, len(errs) == 1 && strings.Contains(errs[0], data.errorMsg), "Expected %q and got %v", data.errorMsg, errs)
+			Assertf(t, called == 0, "Expected resolver not to be called")
+		})
+	}
+}
+
+// TestMaxErrors checks that the number of errors in a response is limited
+func TestMaxErrors(t *testing.T) {
+	const schemaString = "type Query { items(n: Int!): [Item] } type Item { v: Int! }"
+	type Item struct {
+		V func() (int, error)
+	}
+	queryData := struct {
+		Items func(int) []Item `egg:"(n)"`
+	}{
+		Items: func(n int) []Item {
+			r := make([]Item, n)
+			for i := range r {
+				r[i].V = func() (int, error) { return 0, errors.New("failed") }
+			}
+			return r
+		},
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+		handler.MaxErrors(3),
+	)
+	testData := map[string]struct {
+		n        int
+		expected []string
+	}{
+		"None":    {0, nil},
+		"Limit":   {3, []string{"failed", "failed", "failed"}},
+		"OneMore": {4, []string{"failed", "failed", "failed", "and 1 more error"}},
+		"TooMany": {100, []string{"failed", "failed", "failed", "and 97 more errors"}},
+	}
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			_, errs := doRequest(t, h, fmt.Sprintf(`{"query":"{ items(n: %d) { v } }"}`, data.n))
+			Assertf(t, reflect.DeepEqual(errs, data.expected), "Expected %v and got %v", data.expected, errs)
+		})
+	}
+}
+
+// TestSecretArgs checks that the values of secret arguments are redacted from error messages
+func TestSecretArgs(t *testing.T) {
+	const schemaString = "type Query { len(token: String!): Int! } " +
+		"type Mutation { login(user: String!, password: String!): String! }"
+	queryData := struct {
+		Len func(string) (int, error) `egg:"(token)"`
+	}{
+		Len: func(token string) (int, error) { return 0, fmt.Errorf("token %q has expired", token) },
+	}
+	mutationData := struct {
+		Login func(string, string) (string, error) `egg:"login(user,password:String!{secret})"`
+	}{
+		Login: func(user, password string) (string, error) {
+			return "", fmt.Errorf("user %s with password %s not found", user, password)
+		},
+	}
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, {mutationData}, nil},
+		handler.SecretArgs("token"),
+	)
+	testData := map[string]struct {
+		body     string
+		expected string
+	}{
+		"Literal": {
+			`{"query":"mutation { login(user: \"bob\", password: \"hunter2\") }"}`,
+			"user bob with password [REDACTED] not found",
+		},
+		"Variable": {
+			`{"query":"mutation($p: String!) { login(user: \"bob\", password: $p) }","variables":{"p":"hunter2"}}`,
+			"user bob with password [REDACTED] not found",
+		},
+		"Invalid": {
+			`{"query":"mutation { login(user: \"bob\", password: 31415) }"}`,
+			"String cannot represent a non string value: [REDACTED]",
+		},
+		"Option": {`{"query":"{ len(token: \"abc123\") }"}`, `token "[REDACTED]" has expired`},
+		"Short": {
+			`{"query":"mutation { login(user: \"bob\", password: \"b\") }"}`,
+			"user bob with password b not found",
+		},
+		"WholeValue": {
+			`{"query":"mutation { login(user: \"bobby\", password: \"bobb\") }"}`,
+			"user bobby with password [REDACTED] not found",
+		},
+	}
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			_, errs := doRequest(t, h, data.body)
+			Assertf(t, len(errs) == 1 && errs[0] == data.expected, "Expected %q and got %q", data.expected, errs)
+		})
+	}
+}
+
+// TestFloatFormat checks that Float values (including lists and custom scalars) are formatted using the option
+func TestFloatFormat(t *testing.T) {
+	type Celsius float64
+	const schemaString = "type Query { sum: Float! small: Float! list: [Float!]! temp: Float! }"
+	a, b := 0.1, 0.2
+	queryData := struct {
+		Sum   float64
+		Small float32
+		List  []float64
+		Temp  Celsius
+	}{a + b, 1e-7, []float64{1, 2.5}, 21.456}
+	testData := map[string]struct {
+		format    byte
+		precision int
+		expected  string
+	}{
+		"Default":  {0, 0, `{"data":{"sum":0.30000000000000004,"small":1e-7,"list":[1,2.5],"temp":21.456}}`},
+		"Fixed2":   {'f', 2, `{"data":{"sum":0.30,"small":0.00,"list":[1.00,2.50],"temp":21.46}}`},
+		"Decimal":  {'f', -1, `{"data":{"sum":0.30000000000000004,"small":0.0000001,"list":[1,2.5],"temp":21.456}}`},
+		"Exponent": {'e', 3, `{"data":{"sum":3.000e-01,"small":1.000e-07,"list":[1.000e+00,2.500e+00],"temp":2.146e+01}}`},
+	}
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+				handler.FloatFormat(data.format, data.precision),
+			)
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"{ sum small list temp }"}`)))
+			Assertf(t, writer.Body.String() == data.expected, "Expected %s and got %s", data.expected, writer.Body)
+		})
+	}
+}
+
+// TestAddTypename checks that __typename is added to objects (with the concrete type for a union) when requested
+func TestAddTypename(t *testing.T) {
+	const schemaString = "type Query { c: [U] o: O } type O { v: Int! } type U1 { v: Int! } type U2 { v: Int! w: String!} union U = U1|U2"
+	queryData := struct {
+		_ [0]U1
+		_ [0]U2
+		C []interface{}
+		O struct{ V int }
+	}{C: []interface{}{U1{V: 1}, U2{V: 2, W: "w"}}, O: struct{ V int }{3}}
+
+	testData := map[string]struct {
+		on       bool
+		body     string
+		expected string
+	}{
+		"Off": {false, `{"query":"{ o { v } }"}`, `{"data":{"o":{"v":3}}}`},
+		"On":  {true, `{"query":"{ o { v } }"}`, `{"data":{"o":{"v":3,"__typename":"O"}}}`},
+		"Requested": {true, `{"query":"{ o { __typename v } }"}`,
+			`{"data":{"o":{"__typename":"O","v":3}}}`},
+		"Alias": {true, `{"query":"{ o { t: __typename } }"}`, `{"data":{"o":{"t":"O","__typename":"O"}}}`},
+		"Union": {true, `{"query":"{ c { ... on U1 { v } ... on U2 { w } } }"}`,
+			`{"data":{"c":[{"v":1,"__typename":"U1"},{"w":"w","__typename":"U2"}]}}`},
+		"Extension": {false, `{"query":"{ o { v } }","extensions":{"addTypename":true}}`,
+			`{"data":{"o":{"v":3,"__typename":"O"}}}`},
+	}
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil},
+				handler.AddTypename(data.on),
+			)
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, httptest.NewRequest("POST", "/", strings.NewReader(data.body)))
+			Assertf(t, writer.Body.String() == data.expected, "Expected %s and got %s", data.expected, writer.Body)
+		})
+	}
+}
+
+// TestChaos checks that faults are injected into matching resolvers, but only if built with the "chaos" build tag
+func TestChaos(t *testing.T) {
+	const schemaString = "type Query { a: Int b: Int slow: Int }"
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{struct{ A, B, Slow int }{1, 2, 3}}, nil, nil},
+		handler.Chaos(
+			handler.ChaosRule{Pattern: "Query.a", ErrorRate: 1},
+			handler.ChaosRule{Pattern: "*.slow", MinLatency: 50 * time.Millisecond},
+		),
+	)
+	start := time.Now()
+	data, errs := doRequest(t, h, `{"query":"{ a b slow }"}`)
+	elapsed := time.Since(start)
+	if !handler.ChaosBuild {
+		Assertf(t, len(errs) == 0 && reflect.DeepEqual(data, map[string]interface{}{"a": 1.0, "b": 2.0, "slow": 3.0}),
+			"Expected no faults injected (not built with chaos tag) got %v %v", data, errs)
+		return
+	}
+	Assertf(t, len(errs) == 1 && strings.HasPrefix(errs[0], "chaos: injected error"), "Expected injected error got %v", errs)
+	Assertf(t, reflect.DeepEqual(data, map[string]interface{}{"a": nil, "b": 2.0, "slow": 3.0}),
+		"Expected partial results got %v", data)
+	Assertf(t, elapsed >= 50*time.Millisecond, "Expected latency of at least 50ms got %v", elapsed)
+
+	// Turn off fault injection for a request using the context
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"{ a }"}`))
+	request = request.WithContext(handler.WithChaos(request.Context(), false))
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, request)
+	Assertf(t, writer.Body.String() == `{"data":{"a":1}}`, "Expected no fault injected got %s", writer.Body)
+}
+
+// TestDeprecation checks the Deprecation and Sunset headers and the counts of uses of deprecated fields (and
+// arguments) by each client, including those passed to the observer
+func TestDeprecation(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	observed := make(map[string]int64)
+	h := handler.New([]string{`type Query {
+			old: Int! @deprecated(reason: "use new")
+			new: Int!
+			f(a: Int, b: Int @deprecated): Int!
+		}`}, nil,
+		[3][]interface{}{{struct {
+			Old, New int
+			F        func(int, int) int `egg:"(a,b)"`
+		}{Old: 1, New: 2, F: func(a, b int) int { return a + b }}}, nil, nil},
+		handler.DeprecationHeaders(true, since, sunset),
+		handler.DeprecationUsage(true),
+		handler.RateLimitKey(func(r *http.Request) string { return r.Header.Get("X-Client") }),
+		handler.Observer(func(event interface{}) {
+			if use, ok := event.(handler.DeprecatedUse); ok {
+				mu.Lock()
+				observed[use.Name+"/"+use.Client] += use.Count
+				mu.Unlock()
+			}
+		}),
+	)
+
+	deprecationData := map[string]struct {
+		client      string
+		query       string
+		deprecation string // expected Deprecation header (empty if none)
+	}{
+		"Old":        {"A", "{ old }", "@1767225600"},
+		"New":        {"A", "{ new }", ""},
+		"Fragment":   {"B", "{ ...frag } fragment frag on Query { old new }", "@1767225600"},
+		"Arg":        {"A", "{ f(b: 1) }", "@1767225600"},
+		"ArgNotUsed": {"A", "{ f(a: 1) }", ""},
+		"Twice":      {"A", "{ old x: old }", "@1767225600"},
+	}
+	for name, testData := range deprecationData {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"`+testData.query+`"}`))
+			request.Header.Add("Content-Type", "application/json")
+			request.Header.Add("X-Client", testData.client)
+			writer := httptest.NewRecorder()
+			h.ServeHTTP(writer, request)
+			Assertf(t, writer.Code == http.StatusOK, "Expected status OK got %d (%s)", writer.Code, writer.Body)
+			deprecation := writer.Header().Get("Deprecation")
+			Assertf(t, deprecation == testData.deprecation, "Expected Deprecation header %q got %q",
+				testData.deprecation, deprecation)
+			expectedSunset := ""
+			if testData.deprecation != "" {
+				expectedSunset = "Wed, 01 Jul 2026 00:00:00 GMT"
+			}
+			Assertf(t, writer.Header().Get("Sunset") == expectedSunset, "Expected Sunset header %q got %q",
+				expectedSunset, writer.Header().Get("Sunset"))
+		})
+	}
+
+	var got []string
+	for _, use := range h.(*handler.Handler).DeprecatedUsage() {
+		Assertf(t, !use.Last.IsZero(), "Expected time of last use of %s", use.Name)
+		got = append(got, fmt.Sprintf("%s/%s/%d", use.Name, use.Client, use.Count))
+	}
+	expected := []string{"Query.f(b)/A/1", "Query.old/A/2", "Query.old/B/1"}
+	Assertf(t, reflect.DeepEqual(got, expected), "Expected usage %v got %v", expected, got)
+	expectedObserved := map[string]int64{"Query.f(b)/A": 1, "Query.old/A": 2, "Query.old/B": 1}
+	Assertf(t, reflect.DeepEqual(observed, expectedObserved), "Expected observed uses %v got %v",
+		expectedObserved, observed)
+}
+
+// TestDeprecationUsageLimit checks that once the limit on the number of uses counted is reached the uses by
+// other clients are counted together
+func TestDeprecationUsageLimit(t *testing.T) {
+	h := handler.New([]string{`type Query { old: Int! @deprecated }`}, nil,
+		[3][]interface{}{{struct{ Old int }{1}}, nil, nil},
+		handler.DeprecationUsage(true),
+		handler.DeprecationUsageLimit(2),
+		handler.RateLimitKey(func(r *http.Request) string { return r.Header.Get("X-Client") }),
+	)
+	for _, client := range []string{"A", "B", "C", "A", "D", "C"} {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":"{ old }"}`))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("X-Client", client)
+		h.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	var got []string
+	for _, use := range h.(*handler.Handler).DeprecatedUsage() {
+		got = append(got, fmt.Sprintf("%s/%s/%d", use.Name, use.Client, use.Count))
+	}
+	expected := []string{"Query.old/*/3", "Query.old/A/2", "Query.old/B/1"}
+	Assertf(t, reflect.DeepEqual(got, expected), "Expected usage %v got %v", expected, got)
+}
+
+// TestLookupDiagnostics checks that fields not found in one of several structs (which is expected) are not
+// reported as lookup bugs
+func TestLookupDiagnostics(t *testing.T) {
+	type Embedded struct{ E int }
+	h := handler.New([]string{"type Query { a: Int! b: Int! e: Int! }"}, nil,
+		[3][]interface{}{{
+			struct{ A int }{1},
+			struct {
+				Embedded
+				B int
+			}{Embedded{3}, 2},
+		}, nil, nil},
+		handler.LookupDiagnostics(true),
+	)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	data, errs := doRequest(t, h, `{"query":"{ a b e }"}`)
+	Assertf(t, errs == nil, "Expected no errors got %v", errs)
+	expected := JsonObject{"a": 1.0, "b": 2.0, "e": 3.0}
+	Assertf(t, reflect.DeepEqual(data, expected), "Expected %v got %v", expected, data)
+	Assertf(t, buf.Len() == 0, "Expected nothing logged got %q", buf.String())
+}
@@ -0,0 +1,33 @@
+package handler
+
+// parent.go lets a function resolver get the object (Go struct) that contains it (see Parent), so that it can use
+// the values of other (eg unexported) fields without a closure being created for every object
+
+import (
+	"context"
+	"reflect"
+)
+
+// parentKey is the context key for the object containing the resolver being called
+type parentKey struct{}
+
+// withParent returns a context (passed to a resolver function) that has the struct (v) containing the resolver
+func withParent(ctx context.Context, v reflect.Value) context.Context {
+	return context.WithValue(ctx, parentKey{}, v)
+}
+
+// Parent returns a pointer to the struct containing the field of the function resolver that was passed the
+// context, or nil if ctx is not the context passed to a resolver.  For a field of an embedded struct it is the
+// embedded struct.  If the struct is not addressable (eg an element of a map) the pointer is to a copy.
+func Parent(ctx context.Context) interface{} {
+	v, ok := ctx.Value(parentKey{}).(reflect.Value)
+	if !ok {
+		return nil
+	}
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.Interface()
+}
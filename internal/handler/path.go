@@ -0,0 +1,118 @@
+package handler
+
+// path.go keeps track of the path (in the results) of the field being resolved, so that an error for a field or an
+// element of a list can be reported with its path while the rest of the results are returned (partial results)
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type (
+	// pathKey is the context key for the path of the object or list element being resolved
+	pathKey struct{}
+
+	// pathNode is one element of a path (a field name/alias or a list index) linked to the path of its parent
+	pathNode struct {
+		parent *pathNode
+		elem   ast.PathElement
+		field  *ast.Field // for a list index - the (list) field that the element belongs to
+		typ    *ast.Type  // for a list index - the type of the element
+	}
+
+	// elementErrors collects the errors for fields and list elements that were resolved as null
+	elementErrors struct {
+		mtx  sync.Mutex
+		list gqlerror.List
+	}
+)
+
+// fieldPath returns a context with the path of a field (unless it already has it as we are resolving a list element)
+func fieldPath(ctx context.Context, astField *ast.Field) context.Context {
+	if p, _ := ctx.Value(pathKey{}).(*pathNode); p != nil && p.field == astField {
+		return ctx
+	}
+	p, _ := ctx.Value(pathKey{}).(*pathNode)
+	return context.WithValue(ctx, pathKey{}, &pathNode{parent: p, elem: ast.PathName(astField.Alias)})
+}
+
+// listType returns the type of the list being resolved for astField, which for nested lists is an element type
+func listType(ctx context.Context, astField *ast.Field) *ast.Type {
+	if p, _ := ctx.Value(pathKey{}).(*pathNode); p != nil && p.field == astField {
+		return p.typ
+	}
+	if astField.Definition == nil {
+		return nil
+	}
+	return astField.Definition.Type
+}
+
+// elementPath returns a context with the path of an element (at index) of a list of type t
+func elementPath(ctx context.Context, astField *ast.Field, t *ast.Type, index int) context.Context {
+	p, _ := ctx.Value(pathKey{}).(*pathNode)
+	var elemType *ast.Type
+	if t != nil {
+		elemType = t.Elem
+	}
+	return context.WithValue(ctx, pathKey{}, &pathNode{
+		parent: p, elem: ast.PathIndex(index), field: astField, typ: elemType,
+	})
+}
+
+// getPath returns the path stored in the context
+func getPath(ctx context.Context) (r ast.Path) {
+	for p, _ := ctx.Value(pathKey{}).(*pathNode); p != nil; p = p.parent {
+		r = append(ast.Path{p.elem}, r...)
+	}
+	return
+}
+
+// resolveElement resolves one element of a list.  If there is an error and elements of the list are nullable
+// the error is saved (with the path of the element) and the element is null, so the rest of the list is returned.
+func (op *gqlOperation) resolveElement(ctx context.Context, astField *ast.Field, t *ast.Type, index int,
+	v, vID reflect.Value, fieldInfo *field.Info,
+) *gqlValue {
+	ctx = elementPath(ctx, astField, t, index)
+	value := op.resolve(ctx, astField, v, vID, fieldInfo, ResolverCache{})
+	if value == nil || value.err == nil || op.elementErrors == nil || t == nil || t.Elem == nil || t.Elem.NonNull {
+		return value
+	}
+	op.elementErrors.add(fieldError(ctx, astField, value.err))
+	return &gqlValue{name: astField.Alias}
+}
+
+// fieldError returns the error of a field (or list element) with the path where the error occurred, ie the path
+// recorded when a resolver returned the error (see withErrorPath), or else the path of the field
+func fieldError(ctx context.Context, astField *ast.Field, err error) *gqlerror.Error {
+	var pe pathError
+	if errors.As(err, &pe) {
+		return gqlerror.WrapPath(pe.path, err)
+	}
+	return gqlerror.WrapPath(getPath(fieldPath(ctx, astField)), err)
+}
+
+// add saves an error for a field or list element
+func (ee *elementErrors) add(err *gqlerror.Error) {
+	ee.mtx.Lock()
+	defer ee.mtx.Unlock()
+	ee.list = append(ee.list, err)
+}
+
+// errors returns the saved errors, adding the operation name (and details of an Error) to each
+func (ee *elementErrors) errors(operation *ast.OperationDefinition) gqlerror.List {
+	ee.mtx.Lock()
+	defer ee.mtx.Unlock()
+	for _, err := range ee.list {
+		var path ast.Path
+		if path, err.Extensions = errorDetails(err.Unwrap(), operation); path != nil {
+			err.Path = path
+		}
+	}
+	return ee.list
+}
@@ -0,0 +1,131 @@
+package handler
+
+// persisted.go handles persisted operations - queries registered with the server that clients execute by name
+// using a GET request, with variables taken from URL query parameters, so that responses can be cached (eg by a CDN)
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// persistedOperationParam is the URL query parameter that gives the name of the persisted operation to execute
+const persistedOperationParam = "operation"
+
+type (
+	// PersistedOperation is a query registered (see PersistedOperations option) so that a client can execute it
+	// with a GET request, giving its name in the "operation" URL query parameter and the values of its variables in
+	// other query parameters, eg: "/graphql?operation=hero&episode=JEDI"
+	PersistedOperation struct {
+		Query string // GraphQL query containing exactly one operation, which must be a query (not a mutation etc)
+		// Params maps variable names to the names of the URL query parameters providing their values.  If a variable
+		// is not in the map (or the map is nil) the query parameter has the same name as the variable.
+		Params map[string]string
+	}
+
+	// persistedQuery is a PersistedOperation that has been checked against the schema
+	persistedQuery struct {
+		query     string
+		variables ast.VariableDefinitionList
+		params    map[string]string // URL query parameter name for each variable
+	}
+)
+
+// loadPersisted checks that the persisted operations are valid for the schema
+func loadPersisted(schema *ast.Schema, ops map[string]PersistedOperation) (map[string]persistedQuery, error) {
+	r := make(map[string]persistedQuery, len(ops))
+	for name, op := range ops {
+		query, errs := gqlparser.LoadQuery(schema, op.Query)
+		if errs != nil {
+			return nil, fmt.Errorf("persisted operation %q: %w", name, errs)
+		}
+		if len(query.Operations) != 1 {
+			return nil, fmt.Errorf("persisted operation %q must contain exactly one operation", name)
+		}
+		operation := query.Operations[0]
+		if operation.Operation != ast.Query {
+			return nil, fmt.Errorf("persisted operation %q must be a query not a %s", name, operation.Operation)
+		}
+		p := persistedQuery{
+			query:     op.Query,
+			variables: operation.VariableDefinitions,
+			params:    make(map[string]string, len(operation.VariableDefinitions)),
+		}
+		for _, v := range operation.VariableDefinitions {
+			p.params[v.Variable] = v.Variable
+		}
+		for variable, param := range op.Params {
+			if _, ok := p.params[variable]; !ok {
+				return nil, fmt.Errorf("persisted operation %q has no variable %q", name, variable)
+			}
+			if param == persistedOperationParam {
+				return nil, fmt.Errorf("persisted operation %q cannot use query parameter %q for a variable", name, param)
+			}
+			p.params[variable] = param
+		}
+		r[name] = p
+	}
+	return r, nil
+}
+
+// getVariables gets the variables of the operation from the URL query parameters, converting them to the types
+// of the variables.  Variables without a query parameter are left out (so they get their default value, if any).
+func (p persistedQuery) getVariables(schema *ast.Schema, values url.Values) (map[string]interface{}, error) {
+	r := make(map[string]interface{}, len(p.variables))
+	for _, v := range p.variables {
+		param := p.params[v.Variable]
+		strs, ok := values[param]
+		if !ok {
+			continue
+		}
+		value, err := paramValue(schema, v.Type, strs)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter %q for variable %q: %w", param, v.Variable, err)
+		}
+		r[v.Variable] = value
+	}
+	return r, nil
+}
+
+// paramValue converts the value(s) of a URL query parameter to a value of the GraphQL type t.  For a list each
+// element is a separate value (ie the parameter is repeated), otherwise the parameter must only have one value.
+func paramValue(schema *ast.Schema, t *ast.Type, strs []string) (interface{}, error) {
+	if t.Elem != nil {
+		r := make([]interface{}, 0, len(strs))
+		for _, s := range strs {
+			value, err := paramValue(schema, t.Elem, []string{s})
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, value)
+		}
+		return r, nil
+	}
+	if len(strs) != 1 {
+		return nil, fmt.Errorf("expected one value but got %d", len(strs))
+	}
+	s := strs[0]
+	switch t.NamedType {
+	case "Int":
+		return strconv.ParseInt(s, 10, 64)
+	case "Float":
+		return strconv.ParseFloat(s, 64)
+	case "Boolean":
+		return strconv.ParseBool(s)
+	}
+	if def := schema.Types[t.NamedType]; def != nil && def.Kind == ast.InputObject {
+		var value interface{}
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		return FixNumbers(value), nil
+	}
+	return s, nil // String, ID, enum or custom scalar
+}
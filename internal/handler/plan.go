@@ -0,0 +1,206 @@
+package handler
+
+// plan.go describes how the fields of a query would be resolved (see ServePlan option), without running any
+// resolvers, to help find out why a field resolves slowly or returns unexpected data
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type (
+	// planOperation is the execution plan of one operation of a query
+	planOperation struct {
+		Name       string      `json:"name,omitempty"`
+		Operation  string      `json:"operation"`  // "query", "mutation" or "subscription"
+		Concurrent bool        `json:"concurrent"` // resolvers of sibling fields are run concurrently
+		Fields     []planField `json:"fields"`
+	}
+
+	// planField describes how a field would be resolved
+	planField struct {
+		Name          string      `json:"name"`                    // name (alias) of the field in the results
+		Field         string      `json:"field"`                   // GraphQL type and field, eg "Query.hero"
+		Type          string      `json:"type,omitempty"`          // GraphQL type of the field
+		TypeCondition string      `json:"typeCondition,omitempty"` // type condition of fragment the field is in
+		Skipped       bool        `json:"skipped,omitempty"`       // excluded by @skip or @include
+		GoType        string      `json:"goType,omitempty"`        // Go struct containing the resolver
+		GoField       string      `json:"goField,omitempty"`       // Go field that is the resolver
+		Resolver      string      `json:"resolver,omitempty"`      // "func", "value" or "wildcard"
+		Cached        bool        `json:"cached,omitempty"`        // resolver has a cache (see FuncCache option)
+		Batch         bool        `json:"batch,omitempty"`         // resolver has the "batch" option
+		RateLimited   bool        `json:"rateLimited,omitempty"`   // resolver has the "rateLimit" option
+		Timeout       string      `json:"timeout,omitempty"`       // resolver's "timeout" option
+		Directives    []string    `json:"directives,omitempty"`    // custom directives called around the resolver
+		Fields        []planField `json:"fields,omitempty"`        // sub-fields of an object (or list of objects)
+	}
+)
+
+// writePlan writes the execution plan (as JSON) of the query in the query parameters of a GET request
+func (h *Handler) writePlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	values := r.URL.Query()
+	var variables map[string]interface{}
+	if vars := values.Get("variables"); vars != "" {
+		decoder := json.NewDecoder(strings.NewReader(vars))
+		decoder.UseNumber()
+		if err := decoder.Decode(&variables); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(gqlResult{Errors: gqlerror.List{gqlerror.Errorf("Error decoding JSON variables: %v", err)}})
+			return
+		}
+		variables = FixNumbers(variables).(map[string]interface{})
+	}
+	plan, errs := h.plan(r.Context(), values.Get("query"), variables)
+	if errs != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(gqlResult{Errors: errs})
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(plan)
+}
+
+// plan returns the execution plan of each operation of a query
+func (h *Handler) plan(ctx context.Context, query string, variables map[string]interface{},
+) ([]planOperation, gqlerror.List) {
+	doc, errs := h.loadQuery(query)
+	if errs != nil {
+		return nil, errs
+	}
+	foldDirectives(doc)
+	r := make([]planOperation, 0, len(doc.Operations))
+	for _, operation := range doc.Operations {
+		op := gqlOperation{Handler: h}
+		if len(operation.VariableDefinitions) > 0 {
+			var err *gqlerror.Error
+			if op.variables, err = h.operationVariables(ctx, operation, variables); err != nil {
+				return nil, gqlerror.List{err}
+			}
+		}
+		var data []interface{}
+		switch operation.Operation {
+		case ast.Query:
+			data = h.qData
+		case ast.Mutation:
+			op.isMutation = true
+			data = h.mData
+		case ast.Subscription:
+			op.isSubscription = true
+			data = h.subscriptionData
+		}
+		var types []reflect.Type
+		for _, v := range data {
+			if t := structType(reflect.TypeOf(v)); t != nil {
+				types = append(types, t)
+			}
+		}
+		r = append(r, planOperation{
+			Name:       operation.Name,
+			Operation:  string(operation.Operation),
+			Concurrent: !op.isMutation && !op.noConcurrency,
+			Fields:     op.planFields(operation.SelectionSet, types, ""),
+		})
+	}
+	return r, nil
+}
+
+// planFields returns the plan of the fields of a selection set, where types are the struct types that may contain
+// the resolvers (or nil if not known, eg for fields returning a Go interface)
+func (op *gqlOperation) planFields(set ast.SelectionSet, types []reflect.Type, typeCondition string) []planField {
+	var r []planField
+	for _, s := range set {
+		switch s := s.(type) {
+		case *ast.Field:
+			r = append(r, op.planField(s, types, typeCondition))
+		case *ast.InlineFragment:
+			if !op.directiveBypass(s.Directives) {
+				r = append(r, op.planFields(s.SelectionSet, types, s.TypeCondition)...)
+			}
+		case *ast.FragmentSpread:
+			if !op.directiveBypass(s.Directives) {
+				r = append(r, op.planFields(s.Definition.SelectionSet, types, s.Definition.TypeCondition)...)
+			}
+		}
+	}
+	return r
+}
+
+// planField returns the plan of one field
+func (op *gqlOperation) planField(astField *ast.Field, types []reflect.Type, typeCondition string) planField {
+	r := planField{Name: astField.Alias, Field: astField.Name, TypeCondition: typeCondition}
+	if astField.ObjectDefinition != nil {
+		r.Field = astField.ObjectDefinition.Name + "." + astField.Name
+	}
+	lists := [2]ast.DirectiveList{nil, astField.Directives} // directives of the field definition and the query
+	if astField.Definition != nil {
+		r.Type = astField.Definition.Type.String()
+		lists[0] = astField.Definition.Directives
+	}
+	if op.directiveBypass(astField.Directives) {
+		r.Skipped = true
+		return r
+	}
+	if strings.HasPrefix(astField.Name, "__") {
+		r.Resolver = "introspection"
+		return r
+	}
+
+	var childTypes []reflect.Type
+	for _, t := range types {
+		data, ok := op.resolverLookup[t][astField.Name]
+		if !ok {
+			if _, ok = op.resolverLookup[t][wildcardName]; ok {
+				r.GoType, r.Resolver = planTypeName(t), "wildcard"
+				break
+			}
+			continue
+		}
+		tField := t.Field(data.Index)
+		if tField.Anonymous {
+			// promoted field of an embedded struct
+			if embedded := structType(tField.Type); embedded != nil {
+				if data2, ok := op.resolverLookup[embedded][astField.Name]; ok {
+					t, tField = embedded, embedded.Field(data2.Index)
+				}
+			}
+		}
+		r.GoType, r.GoField, r.Resolver = planTypeName(t), tField.Name, "value"
+		if tField.Type.Kind() == reflect.Func {
+			r.Resolver = "func"
+		}
+		r.Cached, r.Batch, r.RateLimited = data.Cache.Saved != nil, data.Batch, data.Limiter != nil
+		if fieldInfo, err := field.Get(t, &tField); err == nil && fieldInfo != nil && fieldInfo.Timeout > 0 {
+			r.Timeout = fieldInfo.Timeout.String()
+		}
+		if childType := structType(tField.Type); childType != nil {
+			childTypes = []reflect.Type{childType}
+		}
+		break
+	}
+	for _, list := range lists {
+		for _, d := range list {
+			if _, ok := op.directives[d.Name]; ok {
+				r.Directives = append(r.Directives, "@"+d.Name)
+			}
+		}
+	}
+	r.Fields = op.planFields(astField.SelectionSet, childTypes, "")
+	return r
+}
+
+// planTypeName returns the name of a Go struct type for the plan (the package and name, or "struct" if unnamed)
+func planTypeName(t reflect.Type) string {
+	if t.Name() == "" {
+		return "struct"
+	}
+	return t.String()
+}
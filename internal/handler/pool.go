@@ -0,0 +1,121 @@
+package handler
+
+// pool.go has a per-operation pool of worker go-routines (see RequestWorkers option) which run the resolvers of
+// shallow fields (near the root of the results) before those of deeply nested fields, so that a large list does not
+// hold up the rest of the results
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// workerPool runs tasks (resolvers) on up to n worker go-routines, shallowest (smallest depth) first
+	workerPool struct {
+		mtx     sync.Mutex
+		queue   taskQueue
+		n       int           // max. number of workers
+		running int           // number of workers running
+		seq     int           // number of tasks submitted (so that tasks of the same depth run in order)
+		sem     chan struct{} // if not nil, a worker must also get a slot (see MaxResolverGoroutines)
+	}
+
+	// poolTask is a resolver (f) waiting to be run by a worker, or by the go-routine that waits for its result
+	poolTask struct {
+		f          func()
+		depth, seq int
+		claimed    int32 // set (atomically) by whichever go-routine runs the task
+	}
+
+	// taskQueue is a priority queue (see container/heap) of the tasks waiting for a worker
+	taskQueue []*poolTask
+)
+
+// newWorkerPool returns a pool for the resolvers of an operation, or nil if the RequestWorkers option is not used
+func (h *Handler) newWorkerPool() *workerPool {
+	if h.requestWorkers <= 0 {
+		return nil
+	}
+	return &workerPool{n: h.requestWorkers, sem: h.resolverSem}
+}
+
+// submit adds a task to the queue (starting a worker if there are not already n running) and returns it.  The task
+// may never be run by a worker (eg if they are all busy) so the caller must run it if it has not been claimed.
+func (p *workerPool) submit(depth int, f func()) *poolTask {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.seq++
+	t := &poolTask{f: f, depth: depth, seq: p.seq}
+	heap.Push(&p.queue, t)
+	if p.running < p.n && p.acquire() {
+		p.running++
+		go p.work()
+	}
+	return t
+}
+
+// acquire gets a slot for a worker if the number of resolver go-routines is limited (without waiting)
+func (p *workerPool) acquire() bool {
+	if p.sem == nil {
+		return true
+	}
+	select {
+	case p.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// work runs the tasks from the queue until it is empty
+func (p *workerPool) work() {
+	for {
+		p.mtx.Lock()
+		if len(p.queue) == 0 {
+			p.running--
+			if p.sem != nil {
+				<-p.sem
+			}
+			p.mtx.Unlock()
+			return
+		}
+		t := heap.Pop(&p.queue).(*poolTask)
+		p.mtx.Unlock()
+		t.run()
+	}
+}
+
+// run calls the task's function unless it has already been claimed (by a worker or the waiting go-routine)
+func (t *poolTask) run() {
+	if atomic.CompareAndSwapInt32(&t.claimed, 0, 1) {
+		t.f()
+	}
+}
+
+// pathDepth returns the depth of the field or list element being resolved, ie the length of its path
+func pathDepth(ctx context.Context) int {
+	n := 0
+	for p, _ := ctx.Value(pathKey{}).(*pathNode); p != nil; p = p.parent {
+		n++
+	}
+	return n
+}
+
+func (q taskQueue) Len() int { return len(q) }
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].depth != q[j].depth {
+		return q[i].depth < q[j].depth
+	}
+	return q[i].seq < q[j].seq
+}
+func (q taskQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *taskQueue) Push(x interface{}) { *q = append(*q, x.(*poolTask)) }
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,45 @@
+package handler
+
+// provided.go lets a resolver find which of its arguments were supplied in the query (see ArgsProvided), as
+// opposed to being given their default value, eg so a mutation only updates the fields it was given
+
+import (
+	"context"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// argsProvidedKey is the context key for the field (and variables) of the resolver being called
+type argsProvidedKey struct{}
+
+// providedArgs is the field of a query whose resolver is being called and the variables of the operation
+type providedArgs struct {
+	astField  *ast.Field
+	variables map[string]interface{}
+}
+
+// withArgsProvided returns a context (passed to a resolver function) that records which args were supplied
+func withArgsProvided(ctx context.Context, astField *ast.Field, variables map[string]interface{}) context.Context {
+	return context.WithValue(ctx, argsProvidedKey{}, providedArgs{astField: astField, variables: variables})
+}
+
+// ArgsProvided returns the arguments (by GraphQL name) that were supplied in the query for the resolver that was
+// passed the context.  An argument supplied using a variable is only provided if the variable has a value (possibly
+// null), ie it was in the request's variables or has a default.  It returns nil if ctx is not the context passed
+// to a resolver with arguments.
+func ArgsProvided(ctx context.Context) map[string]bool {
+	p, ok := ctx.Value(argsProvidedKey{}).(providedArgs)
+	if !ok {
+		return nil
+	}
+	r := make(map[string]bool, len(p.astField.Arguments))
+	for _, arg := range p.astField.Arguments {
+		if arg.Value.Kind == ast.Variable {
+			if _, ok := p.variables[arg.Value.Raw]; !ok {
+				continue // variable not supplied so argument is omitted
+			}
+		}
+		r[arg.Name] = true
+	}
+	return r
+}
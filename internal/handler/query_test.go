@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -32,11 +33,14 @@ const (
 	inputArg2FieldSchema = "type Query { q(p: R!): String! } input R{s:String! f:Float!}"
 	listArgSchema        = "type Query { listQuery(list: [Int!]!): Int! }"
 	interfaceSchema      = "type Query { a: D! } interface X { x1: Int! } type D implements X { x1: Int! e: String! }"
+	interfaceListSchema  = "type Query { m: [X!]! s: [X!]! } interface X { x1: Int! } type D implements X { x1: Int! e: String! } type D2 implements X { x1: Int! f: Int! }"
 	union3Schema         = "type Query { c: [U] } type U1 { v: Int! } type U2 { v: Int! w: String!} union U = U1|U2"
 	subscriptSlice       = "schema {query: QuerySubscript} type QuerySubscript { slice(id: Int!): String! }"
 	subscriptMap         = "schema {query: QuerySubscript} type QuerySubscript { map(number: String!): Float! }"
 	sliceFieldSchema     = "schema {query:QuerySliceFieldID} type QuerySliceFieldID{ s:[Element]! } type Element{ id:String! b:Int!}"
 	mapFieldSchema       = "schema {query:QueryMapFieldID} type QueryMapFieldID{ m:[Element]! } type Element{ id:String! b:Int!}"
+	funcContainerSchema  = "schema {query:QueryFuncContainer} type QueryFuncContainer{ product(code:String!):Element! " +
+		"list:[Element]! names(id:Int!):String } type Element{ code:String! id:Int! b:Int!}"
 )
 
 type (
@@ -57,6 +61,14 @@ type (
 		X
 		E string
 	}
+	D2 struct {
+		X
+		F int
+	}
+	DPtr struct {
+		*X // pointer embedding also implements interface X
+		E  string
+	}
 
 	Element           struct{ B byte }
 	QuerySliceFieldID struct {
@@ -90,6 +102,13 @@ type (
 		Slice []string           `egg:",subscript"`
 		Map   map[string]float64 `egg:",subscript=number"`
 	}
+
+	// QueryFuncContainer has function resolvers that return containers (eg lazily loaded) used with subscript/field_id
+	QueryFuncContainer struct {
+		Product func(context.Context) (map[string]Element, error) `egg:",subscript=code"`
+		List    func() ([]Element, error)                         `egg:",field_id,base=1"`
+		Names   func() *[]string                                  `egg:",subscript"`
+	}
 )
 
 var (
@@ -128,10 +147,30 @@ var (
 
 	interfaceData  = struct{ A D }{D{X{4}, "fff"}}
 	interfaceFunc  = struct{ A func() D }{func() D { return D{X{5}, "ggg"} }}
+	interfacePtr   = struct{ A DPtr }{DPtr{&X{6}, "hhh"}}
+	interfaceNil   = struct{ A DPtr }{DPtr{nil, "iii"}}
 	inlineFragFunc = struct {
 		_ [0]D // we need this as A returns a struct D as an interface
 		A func() interface{}
 	}{A: func() interface{} { return D{X{1}, "e in D"} }}
+	interfaceList = struct {
+		_ [0]D // elements of M and S are D or D2 (behind an interface)
+		_ [0]D2
+		M map[string]interface{}
+		S []interface{}
+	}{
+		M: map[string]interface{}{"a": D{X{1}, "e1"}, "b": &D2{X{2}, 22}},
+		S: []interface{}{D2{X{3}, 33}, D{X{4}, "e4"}},
+	}
+	optionalFuncList = struct {
+		List []struct {
+			Name string
+			Age  func() int `egg:",optional_func"` // may be nil (eg not loaded from the DB)
+		}
+	}{List: []struct {
+		Name string
+		Age  func() int `egg:",optional_func"`
+	}{{"a", func() int { return 1 }}, {"b", nil}}}
 
 	contextFunc  = struct{ Value func(context.Context) int }{func(ctx context.Context) int { return 100 }}
 	contextFunc1 = struct {
@@ -147,6 +186,11 @@ var (
 		Slice: []string{"zero", "", "two"},
 		Map:   map[string]float64{"pi": 3.14159265359, "root2": 1.41421356237},
 	}
+	funcContainer = QueryFuncContainer{
+		Product: func(context.Context) (map[string]Element, error) { return map[string]Element{"a": {1}, "b": {2}}, nil },
+		List:    func() ([]Element, error) { return []Element{{11}, {12}}, nil },
+		Names:   func() *[]string { return &[]string{"zero", "one"} },
+	}
 	sliceFieldID  = QuerySliceFieldID{[]Element{{11}, {12}}}
 	mapFieldID    = QueryMapFieldID{map[string]Element{"a": {1}}}
 	sliceOffsetID = QueryOffsetID{[]Element{{21}, {22}}}
@@ -207,6 +251,10 @@ func TestQuery(t *testing.T) {
 			"type Query{id:ID!}", struct{ Id eggql.ID }{"0xFFFF"}, `{ id }`, "",
 			JsonObject{"id": "0xFFFF"},
 		},
+		"IntIDtype": {
+			"type Query{id:ID!}", struct{ Id eggql.IntID }{42}, `{ id }`, "",
+			JsonObject{"id": 42.0},
+		},
 		"Slice": {
 			listSchema, struct{ Values []int }{[]int{1, 8, 3}}, `{ values }`, "",
 			JsonObject{"values": []interface{}{1.0, 8.0, 3.0}},
@@ -265,6 +313,18 @@ func TestQuery(t *testing.T) {
 			}{F: func(s string) bool { return s == "i42" }},
 			`{ f(id:\"i42\") }`, "", JsonObject{"f": true},
 		},
+		"IntIDargString": {
+			"type Query{f(id:ID!):Boolean!}", struct {
+				F func(eggql.IntID) bool `egg:"(id)"`
+			}{F: func(id eggql.IntID) bool { return id == 42 }},
+			`{ f(id:\"42\") }`, "", JsonObject{"f": true},
+		},
+		"IntIDvariable": {
+			"type Query{f(id:ID!):Boolean!}", struct {
+				F func(eggql.IntID) bool `egg:"(id)"`
+			}{F: func(id eggql.IntID) bool { return id == 42 }},
+			`query ($id: ID!) { f(id:$id) }`, `{"id": 42}`, JsonObject{"f": true},
+		},
 		"Default1": {
 			default1Schema, default1Data, `{ f(i:7) }`, "",
 			JsonObject{"f": "xyz14"},
@@ -334,6 +394,34 @@ func TestQuery(t *testing.T) {
 			nestedSchema, nestedData, `{n {...f}} fragment f on N {p q}`, "",
 			JsonObject{"n": JsonObject{"p": true, "q": false}},
 		},
+		"MergedFields": {
+			nestedSchema, nestedData, `{ n { p } n { q } }`, "",
+			JsonObject{"n": JsonObject{"p": true, "q": false}},
+		},
+		"MergedFragment": {
+			nestedSchema, nestedData, `{ n { p ...f } n { q } } fragment f on N { p q }`, "",
+			JsonObject{"n": JsonObject{"p": true, "q": false}},
+		},
+		"SkipLiteral": {
+			nestedSchema, nestedData, `{ n { p @skip(if: true) q @skip(if: false) } }`, "",
+			JsonObject{"n": JsonObject{"q": false}},
+		},
+		"IncludeLiteral": {
+			nestedSchema, nestedData, `{ n { p @include(if: false) q @include(if: true) } }`, "",
+			JsonObject{"n": JsonObject{"q": false}},
+		},
+		"SkipVariable": {
+			nestedSchema, nestedData, `query($s: Boolean!) { n { p @skip(if: $s) q @skip(if: true) } }`, `{"s": false}`,
+			JsonObject{"n": JsonObject{"p": true}},
+		},
+		"SkipFragment": {
+			nestedSchema, nestedData, `{n {...f @skip(if: true) ... on N @include(if: true) {q}}} fragment f on N {p}`, "",
+			JsonObject{"n": JsonObject{"q": false}},
+		},
+		"SkipFragmentVariable": {
+			nestedSchema, nestedData, `query($i: Boolean!) {n {...f @include(if: $i) q}} fragment f on N {p}`, `{"i": false}`,
+			JsonObject{"n": JsonObject{"q": false}},
+		},
 		"Interface": {
 			interfaceSchema, interfaceData, `{ a { x1 e } }`, "",
 			JsonObject{"a": JsonObject{"x1": 4.0, "e": "fff"}},
@@ -342,6 +430,14 @@ func TestQuery(t *testing.T) {
 			interfaceSchema, interfaceFunc, `{ a { x1 e } }`, "",
 			JsonObject{"a": JsonObject{"x1": 5.0, "e": "ggg"}},
 		},
+		"InterfacePtr": {
+			interfaceSchema, interfacePtr, `{ a { x1 e } }`, "",
+			JsonObject{"a": JsonObject{"x1": 6.0, "e": "hhh"}},
+		},
+		"InterfacePtrNil": {
+			interfaceSchema, interfaceNil, `{ a { e } }`, "",
+			JsonObject{"a": JsonObject{"e": "iii"}},
+		},
 		"InlineFrag": {
 			interfaceSchema, inlineFragFunc, `{ a { ... on D { e } } }`, "",
 			JsonObject{"a": JsonObject{"e": "e in D"}},
@@ -350,6 +446,30 @@ func TestQuery(t *testing.T) {
 			interfaceSchema, inlineFragFunc, `{ a { ... on D { x1 e } } }`, "",
 			JsonObject{"a": JsonObject{"x1": 1.0, "e": "e in D"}},
 		},
+		"InterfaceMapTypename": {
+			interfaceListSchema, interfaceList, `{ m { __typename x1 } }`, "",
+			JsonObject{"m": []interface{}{
+				JsonObject{"__typename": "D", "x1": 1.0}, JsonObject{"__typename": "D2", "x1": 2.0},
+			}},
+		},
+		"InterfaceMapFrag": {
+			interfaceListSchema, interfaceList, `{ m { ... on D { e } ... on D2 { f } } }`, "",
+			JsonObject{"m": []interface{}{JsonObject{"e": "e1"}, JsonObject{"f": 22.0}}},
+		},
+		"InterfaceListFrag": {
+			interfaceListSchema, interfaceList, `{ s { __typename ... on X { x1 } ... on D2 { f } } }`, "",
+			JsonObject{"s": []interface{}{
+				JsonObject{"__typename": "D2", "x1": 3.0, "f": 33.0}, JsonObject{"__typename": "D", "x1": 4.0},
+			}},
+		},
+		"InterfaceListSpread": {
+			interfaceListSchema, interfaceList, `{ s { ...f } } fragment f on D { x1 }`, "",
+			JsonObject{"s": []interface{}{JsonObject{}, JsonObject{"x1": 4.0}}},
+		},
+		"OptionalFunc": {
+			"type Query { list: [P!]! } type P { name: String! age: Int }", optionalFuncList, `{ list { name age } }`, "",
+			JsonObject{"list": []interface{}{JsonObject{"name": "a", "age": 1.0}, JsonObject{"name": "b", "age": nil}}},
+		},
 		"Union1": {
 			"type Query { a: U! } type U1 { v: Int! } union U = U1",
 			struct {
@@ -418,6 +538,22 @@ func TestQuery(t *testing.T) {
 			subscriptMap, subscript, `{ map(number:\"pi\") }`, "",
 			JsonObject{"map": 3.14159265359},
 		},
+		"SubscriptFunc": {
+			funcContainerSchema, funcContainer, `{ product(code:\"b\") { code b } }`, "",
+			JsonObject{"product": JsonObject{"code": "b", "b": 2.0}},
+		},
+		"SubscriptFuncVariable": {
+			funcContainerSchema, funcContainer, `query ($c:String!) { product(code:$c) { b } }`, `{"c":"a"}`,
+			JsonObject{"product": JsonObject{"b": 1.0}},
+		},
+		"SubscriptFuncPtr": {
+			funcContainerSchema, funcContainer, `{ names(id:1) }`, "",
+			JsonObject{"names": "one"},
+		},
+		"FieldIDFunc": {
+			funcContainerSchema, funcContainer, `{ list { id b } }`, "",
+			JsonObject{"list": []interface{}{JsonObject{"id": 1.0, "b": 11.0}, JsonObject{"id": 2.0, "b": 12.0}}},
+		},
 		"SliceFieldID": {
 			sliceFieldSchema, sliceFieldID, `{ s { id b } }`, "",
 			JsonObject{"s": []interface{}{JsonObject{"id": 0.0, "b": 11.0}, JsonObject{"id": 1.0, "b": 12.0}}},
@@ -497,6 +633,123 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+type (
+	batchUser struct{ Name string }
+	batchPost struct {
+		Title    string
+		AuthorID int                                               `egg:"-"`
+		Author   func([]int) []batchUser                           `egg:",batch"`
+		Likes    func(context.Context, []batchPost) ([]int, error) `egg:",batch"`
+	}
+)
+
+// TestBatch checks that a resolver with the "batch" option is called once for all the elements of a list
+func TestBatch(t *testing.T) {
+	var calls []int
+	author := func(keys []int) []batchUser {
+		calls = append(calls, len(keys))
+		r := make([]batchUser, len(keys))
+		for i, key := range keys {
+			r[i] = batchUser{Name: "user" + strconv.Itoa(key)}
+		}
+		return r
+	}
+	likes := func(ctx context.Context, posts []batchPost) ([]int, error) {
+		r := make([]int, len(posts))
+		for i, post := range posts {
+			r[i] = 10 * post.AuthorID
+		}
+		return r, nil
+	}
+	q := struct {
+		List   []batchPost
+		ByName map[string]batchPost
+		Post   []batchPost `egg:",subscript"`
+	}{
+		List:   []batchPost{{"a", 1, author, likes}, {"b", 2, author, likes}, {"c", 3, author, likes}},
+		ByName: map[string]batchPost{"x": {"x", 7, author, likes}, "y": {"y", 8, author, likes}},
+		Post:   []batchPost{{"p", 5, author, likes}},
+	}
+	h := eggql.MustRun(q)
+
+	batchData := map[string]struct {
+		query    string
+		expected interface{}
+		calls    []int // number of keys passed on each call of the author function
+	}{
+		"List": {`{ list { title author { name } likes } }`, JsonObject{"list": []interface{}{
+			JsonObject{"title": "a", "author": JsonObject{"name": "user0"}, "likes": 10.0},
+			JsonObject{"title": "b", "author": JsonObject{"name": "user1"}, "likes": 20.0},
+			JsonObject{"title": "c", "author": JsonObject{"name": "user2"}, "likes": 30.0},
+		}}, []int{3}},
+		"Fragment": {`{ list { ...F } } fragment F on batchPost { author { name } }`, JsonObject{"list": []interface{}{
+			JsonObject{"author": JsonObject{"name": "user0"}},
+			JsonObject{"author": JsonObject{"name": "user1"}},
+			JsonObject{"author": JsonObject{"name": "user2"}},
+		}}, []int{3}},
+		"Map": {`{ byName { a: author { name } } }`, JsonObject{"byName": []interface{}{
+			JsonObject{"a": JsonObject{"name": "userx"}},
+			JsonObject{"a": JsonObject{"name": "usery"}},
+		}}, nil},
+		"Subscript": {`{ post(id: 0) { author { name } } }`, JsonObject{"post": JsonObject{
+			"author": JsonObject{"name": "user0"},
+		}}, []int{1}},
+		"NotSelected": {`{ list { title } }`, JsonObject{"list": []interface{}{
+			JsonObject{"title": "a"}, JsonObject{"title": "b"}, JsonObject{"title": "c"},
+		}}, nil},
+	}
+
+	for name, testData := range batchData {
+		t.Run(name, func(t *testing.T) {
+			calls = nil
+			query, _ := json.Marshal(testData.query)
+			data, errs := doRequest(t, h, `{"query":`+string(query)+`}`)
+			if name == "Map" {
+				// map keys (strings) can't be converted to the int keys of the batch function
+				Assertf(t, len(errs) == 1 && strings.Contains(errs[0], "cannot be converted"),
+					"Expected conversion error and got %v", errs)
+				return
+			}
+			Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+			Assertf(t, reflect.DeepEqual(data, testData.expected), "Expected %v, got %v", testData.expected, data)
+			Assertf(t, reflect.DeepEqual(calls, testData.calls), "Expected calls %v, got %v", testData.calls, calls)
+		})
+	}
+}
+
+// TestBatchStringKeys checks that the indexes of a list are passed as decimal strings to a batch function taking strings
+func TestBatchStringKeys(t *testing.T) {
+	type tag struct {
+		Author func([]string) []batchUser `egg:",batch"`
+	}
+	author := func(keys []string) []batchUser {
+		r := make([]batchUser, len(keys))
+		for i, key := range keys {
+			r[i] = batchUser{Name: "user" + key}
+		}
+		return r
+	}
+	q := struct {
+		List  []tag
+		ByKey map[string]tag
+	}{
+		List:  make([]tag, 66),
+		ByKey: map[string]tag{"x": {author}},
+	}
+	for i := range q.List {
+		q.List[i].Author = author
+	}
+	h := eggql.MustRun(q)
+
+	data, errs := doRequest(t, h, `{"query":"{ list { author { name } } byKey { author { name } } }"}`)
+	Assertf(t, len(errs) == 0, "Expected no errors and got %v", errs)
+	list, _ := data.(JsonObject)["list"].([]interface{})
+	Assertf(t, len(list) == 66 && reflect.DeepEqual(list[65], JsonObject{"author": JsonObject{"name": "user65"}}),
+		"Expected user65 for element 65, got %v", list)
+	Assertf(t, reflect.DeepEqual(data.(JsonObject)["byKey"],
+		[]interface{}{JsonObject{"author": JsonObject{"name": "userx"}}}), "Expected userx, got %v", data)
+}
+
 func Assertf(t *testing.T, succeeded bool, format string, args ...interface{}) {
 	const (
 		succeed = "\u2713" // tick
@@ -510,3 +763,120 @@ func Assertf(t *testing.T, succeeded bool, format string, args ...interface{}) {
 		t.Logf("%-6s"+format, append([]interface{}{succeed}, args...)...)
 	}
 }
+
+// TestResultOrder checks that the fields of the results are in the order of the query, including fields of fragments
+// and fields with the same name (merged), for small and large selection sets
+func TestResultOrder(t *testing.T) {
+	h := handler.New([]string{nestedSchema}, nil, [3][]interface{}{{nestedData}, nil, nil})
+
+	// Build a query with many aliases, where the first is repeated (after a fragment) to add another field
+	var query, expected strings.Builder
+	query.WriteString(`{ a0: n { p } ...f `)
+	expected.WriteString(`{"data":{"a0":{"p":true,"q":false},"x":{"q":false}`)
+	for i := 1; i < 40; i++ {
+		query.WriteString(" a" + strconv.Itoa(i) + `: n { q }`)
+		expected.WriteString(`,"a` + strconv.Itoa(i) + `":{"q":false}`)
+	}
+	query.WriteString(` a0: n { q } } fragment f on Query { x: n { q } }`)
+	expected.WriteString(`}}`)
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"query":`+strconv.Quote(query.String())+`}`))
+	request.Header.Add("Content-Type", "application/json")
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, request)
+	got := strings.TrimSpace(writer.Body.String())
+	Assertf(t, got == expected.String(), "Expected %s and got %s", expected.String(), got)
+}
+
+// TestOperationName checks that the operation name selects the operation to execute when the query has more than
+// one, and that an error is returned if it's missing or unknown
+func TestOperationName(t *testing.T) {
+	h := handler.New([]string{"type Query { a: Int! b: Int! }"}, nil,
+		[3][]interface{}{{struct{ A, B int }{1, 2}}, nil, nil})
+	const query = `"query A { a } query B { b }"`
+
+	data := map[string]struct {
+		body     string
+		expected interface{}
+		errors   []string
+	}{
+		"Single":    {`{"query":"{ a }"}`, JsonObject{"a": 1.0}, nil},
+		"SingleOpt": {`{"query":"query Q { a }","operationName":""}`, JsonObject{"a": 1.0}, nil},
+		"NamedA":    {`{"query":` + query + `,"operationName":"A"}`, JsonObject{"a": 1.0}, nil},
+		"NamedB":    {`{"query":` + query + `,"operationName":"B"}`, JsonObject{"b": 2.0}, nil},
+		"Missing": {`{"query":` + query + `}`, nil,
+			[]string{"Must provide operation name if query contains multiple operations."}},
+		"Unknown": {`{"query":` + query + `,"operationName":"C"}`, nil,
+			[]string{`Unknown operation named "C".`}},
+	}
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			result, errs := doRequest(t, h, testData.body)
+			Assertf(t, reflect.DeepEqual(errs, testData.errors), "Expected errors %v, got %v", testData.errors, errs)
+			Assertf(t, reflect.DeepEqual(result, testData.expected), "Expected %v, got %v", testData.expected, result)
+		})
+	}
+
+	// The operation name can also be a query parameter of a GET request
+	writer := httptest.NewRecorder()
+	h.ServeHTTP(writer, httptest.NewRequest("GET", "/?query="+url.QueryEscape("query A { a } query B { b }")+
+		"&operationName=B", nil))
+	got := strings.TrimSpace(writer.Body.String())
+	Assertf(t, got == `{"data":{"b":2}}`, "Expected b from GET and got %s", got)
+}
+
+// TestMeta checks that a resolver can get info about the types, fields and enums of the schema
+func TestMeta(t *testing.T) {
+	var meta *handler.SchemaMeta
+	h := handler.New([]string{`enum Colour { RED GREEN }
+		type Query { sortable(field: String!): String! item: Item }
+		type Item { "the name" name: String! colour: Colour! age(unit: String): Int @deprecated }`},
+		map[string][]string{"Colour": {"RED", "GREEN"}},
+		[3][]interface{}{{struct {
+			Sortable func(context.Context, string) string `egg:"(field)"`
+			Item     *struct{}
+		}{
+			Sortable: func(ctx context.Context, field string) string {
+				meta = handler.Meta(ctx)
+				if f, ok := meta.Field("Item", field); ok {
+					return f.Type
+				}
+				return "unknown"
+			},
+		}}, nil, nil})
+
+	data := map[string]struct {
+		field    string
+		expected string
+	}{
+		"Name":     {"name", "String!"},
+		"Enum":     {"colour", "Colour!"},
+		"Nullable": {"age", "Int"},
+		"Unknown":  {"size", "unknown"},
+		"Typename": {"__typename", "unknown"},
+	}
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			result, errs := doRequest(t, h, `{"query":"{ sortable(field: \"`+testData.field+`\") }"}`)
+			Assertf(t, errs == nil, "Expected no errors, got %v", errs)
+			expected := JsonObject{"sortable": testData.expected}
+			Assertf(t, reflect.DeepEqual(result, expected), "Expected %v, got %v", expected, result)
+		})
+	}
+
+	Assertf(t, meta != nil, "Expected Meta in a resolver")
+	Assertf(t, reflect.DeepEqual(meta.Types(), []string{"Colour", "Item", "Query"}), "Types: got %v", meta.Types())
+	Assertf(t, meta.Kind("Colour") == "ENUM" && meta.Kind("Item") == "OBJECT" && meta.Kind("X") == "",
+		"Kind: got %q %q %q", meta.Kind("Colour"), meta.Kind("Item"), meta.Kind("X"))
+	expectedFields := []handler.SchemaField{
+		{Name: "name", Type: "String!", Description: "the name"},
+		{Name: "colour", Type: "Colour!"},
+		{Name: "age", Type: "Int", Args: []string{"unit"}, Deprecated: true},
+	}
+	Assertf(t, reflect.DeepEqual(meta.Fields("Item"), expectedFields), "Fields: expected %v, got %v",
+		expectedFields, meta.Fields("Item"))
+	Assertf(t, meta.Fields("X") == nil, "Fields: expected nil for unknown type")
+	Assertf(t, reflect.DeepEqual(meta.EnumValues("Colour"), []string{"RED", "GREEN"}), "EnumValues: got %v",
+		meta.EnumValues("Colour"))
+	Assertf(t, handler.Meta(context.Background()) == nil, "Expected nil outside a resolver")
+}
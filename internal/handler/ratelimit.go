@@ -0,0 +1,164 @@
+package handler
+
+// ratelimit.go implements per-client rate limits on individual fields (see "rateLimit" option of egg: tag)
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimitExtension is the name of the response extension used to return the status of rate limited fields
+const rateLimitExtension = "rateLimits"
+
+type (
+	// rateLimiter limits how often each client can resolve a field, using a fixed window per client.
+	// Clients are identified by a key which is (by default) the client's IP address - see RateLimitKey option.
+	rateLimiter struct {
+		limit  int           // max. number of times the field can be resolved in a window
+		period time.Duration // length of each window
+
+		mtx     sync.Mutex             // protects concurrent access of the following fields
+		windows map[string]*rateWindow // current window of each client (map key is client key)
+		swept   time.Time              // when expired windows were last removed from the map
+	}
+
+	// rateWindow tracks how many times a client has resolved a field in the current window
+	rateWindow struct {
+		start time.Time
+		count int
+	}
+
+	// RateLimitStatus is returned (in the "rateLimits" extension of the response) for each rate limited field
+	RateLimitStatus struct {
+		Limit     int     `json:"limit"`     // max. number of times the field can be resolved in the period
+		Remaining int     `json:"remaining"` // how many more times the client can resolve the field in this period
+		Reset     float64 `json:"reset"`     // seconds until the limit is reset
+	}
+
+	// rateLimitReport collects the status of all rate limited fields resolved in a request
+	rateLimitReport struct {
+		mtx     sync.Mutex
+		status  map[string]RateLimitStatus // map key is field name (or Type.field for nested fields)
+		charges map[string]*rateCharge     // so that a client is only charged once per field (same map key)
+	}
+
+	// rateCharge is the result of charging a client for a field (the error if the limit was exceeded)
+	rateCharge struct {
+		once sync.Once
+		err  error
+	}
+)
+
+// newRateLimiter creates a rate limiter or returns nil if no limit is required
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	if limit <= 0 || period <= 0 {
+		return nil
+	}
+	return &rateLimiter{limit: limit, period: period, windows: make(map[string]*rateWindow)}
+}
+
+// allow checks if the client (identified by key) may resolve the field now, and returns the limit status
+func (rl *rateLimiter) allow(key string, now time.Time) (bool, RateLimitStatus) {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	// Occasionally remove windows of clients that have not been seen for a while so the map does not keep growing
+	if now.Sub(rl.swept) > rl.period {
+		for k, w := range rl.windows {
+			if now.Sub(w.start) >= rl.period {
+				delete(rl.windows, k)
+			}
+		}
+		rl.swept = now
+	}
+
+	w, ok := rl.windows[key]
+	if !ok || now.Sub(w.start) >= rl.period {
+		w = &rateWindow{start: now}
+		rl.windows[key] = w
+	}
+	allowed := w.count < rl.limit
+	if allowed {
+		w.count++
+	}
+	return allowed, RateLimitStatus{
+		Limit:     rl.limit,
+		Remaining: rl.limit - w.count,
+		Reset:     w.start.Add(rl.period).Sub(now).Seconds(),
+	}
+}
+
+// add records the status of a rate limited field (this is called concurrently for different fields)
+func (r *rateLimitReport) add(name string, status RateLimitStatus) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.status == nil {
+		r.status = make(map[string]RateLimitStatus)
+	}
+	r.status[name] = status
+}
+
+// extensions returns the response extensions (if any) for rate limited fields
+func (r *rateLimitReport) extensions() map[string]interface{} {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if len(r.status) == 0 {
+		return nil
+	}
+	return map[string]interface{}{rateLimitExtension: r.status}
+}
+
+// charge returns the charge for a field, which is shared by all uses of the field in the operation (eg for each
+// element of a list)
+func (r *rateLimitReport) charge(name string) *rateCharge {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.charges == nil {
+		r.charges = make(map[string]*rateCharge)
+	}
+	c, ok := r.charges[name]
+	if !ok {
+		c = &rateCharge{}
+		r.charges[name] = c
+	}
+	return c
+}
+
+// checkRateLimit returns an error if the client has exceeded the rate limit for the field.  The client is charged
+// once per field for the operation, however many times the field is resolved (eg for the elements of a list).
+func (op *gqlOperation) checkRateLimit(limiter *rateLimiter, typeName, fieldName string) error {
+	name := fieldName
+	if typeName != "" {
+		name = typeName + "." + fieldName
+	}
+	if op.rateLimits == nil {
+		return op.chargeRateLimit(limiter, name)
+	}
+	c := op.rateLimits.charge(name)
+	c.once.Do(func() { c.err = op.chargeRateLimit(limiter, name) })
+	return c.err
+}
+
+// chargeRateLimit counts a use of a rate limited field by the client, returning an error if the limit is exceeded
+func (op *gqlOperation) chargeRateLimit(limiter *rateLimiter, name string) error {
+	allowed, status := limiter.allow(op.clientKey, time.Now())
+	if op.rateLimits != nil {
+		op.rateLimits.add(name, status)
+	}
+	if !allowed {
+		return fmt.Errorf("rate limit of %d exceeded for field %q - try again in %.0f seconds", status.Limit, name, status.Reset)
+	}
+	return nil
+}
+
+// clientAddress is the default way to get a client key (for rate limits) from the request - ie the client IP address
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,101 @@
+package handler
+
+// requestbatch.go handles a POST request whose body is a JSON array of GraphQL requests (as sent by clients, such
+// as Apollo Client, that batch requests to reduce round trips).  The response is a JSON array of the results.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// DefaultMaxBatchSize is the max. number of requests in a batch if MaxBatchSize is not used
+const DefaultMaxBatchSize = 20
+
+// isBatch returns true if the (JSON) body of a request is an array, skipping any leading white space
+func isBatch(r *bufio.Reader) bool {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return false // let the decoder report the error
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = r.ReadByte()
+			continue
+		}
+		return b[0] == '['
+	}
+}
+
+// decodeRequest decodes the (JSON) body of a GraphQL request into g
+func decodeRequest(r io.Reader, g *gqlRequest) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields() // quickly find if a field name has been misspelt
+	decoder.UseNumber()             // allows us to distinguish ints from floats (see FixNumbers)
+	return decoder.Decode(g)
+}
+
+// serveBatch executes a batch of requests (JSON array) and writes the results (JSON array in the same order).
+// The requests are executed concurrently (unless NoConcurrency is on) using at most MaxResolverGoroutines
+// go-routines.  The batch counts as one request for the RateLimit and MaxConcurrentRequests options.
+func (h *Handler) serveBatch(w http.ResponseWriter, r *http.Request, body io.Reader, clientKey string) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"data": null,"errors": [{"message": "Error decoding JSON request:` + err.Error() + `"}]}`))
+		return
+	}
+	h.drain(body) // see ServeHTTP
+	if h.maxBatchSize < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"data": null,"errors": [{"message": "Error: batched requests are not accepted"}]}`))
+		return
+	}
+	if len(raw) == 0 || len(raw) > h.maxBatchSize {
+		w.WriteHeader(http.StatusBadRequest)
+		msg := fmt.Sprintf("Error: a batch must have 1 to %d requests but has %d", h.maxBatchSize, len(raw))
+		w.Write([]byte(`{"data": null,"errors": [{"message": "` + msg + `"}]}`))
+		return
+	}
+
+	requests := make([]gqlRequest, len(raw))
+	for i, b := range raw {
+		requests[i] = gqlRequest{Handler: h, clientKey: clientKey}
+		if err := decodeRequest(bytes.NewReader(b), &requests[i]); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			msg, _ := json.Marshal(fmt.Sprintf("Error decoding JSON request %d: %v", i, err))
+			w.Write([]byte(`{"data": null,"errors": [{"message": ` + string(msg) + `}]}`))
+			return
+		}
+		requests[i].Variables = FixNumbers(requests[i].Variables).(map[string]interface{})
+		if h.resultArena {
+			requests[i].arena = &resultArena{}
+			defer requests[i].arena.release() // after the results have been encoded
+		}
+	}
+
+	// Resolvers of all the requests share the response headers (see SetHeader)
+	ctx, headers := withResponseHeaders(r.Context())
+	results := make([]gqlResult, len(requests))
+	var wg sync.WaitGroup
+	for i := range requests {
+		i := i
+		runLimited(&wg, h.noConcurrency, h.resolverSem, func() {
+			results[i] = requests[i].ExecuteHTTP(ctx)
+		})
+	}
+	wg.Wait()
+
+	headers.write(w)
+	if buf, err := json.Marshal(results); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"data": null,"errors": [{"message": "Error encoding JSON response:` + err.Error() + `"}]}`))
+	} else {
+		w.Write(buf)
+	}
+}
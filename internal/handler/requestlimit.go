@@ -0,0 +1,127 @@
+package handler
+
+// requestlimit.go limits the rate of requests from each client (see RateLimit option) and the number of requests
+// handled at the same time (see MaxConcurrentRequests option).  Requests over the limits get HTTP status 429.
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// requestLimiter limits the rate of requests of each client using a "token bucket" per client.  A client can
+	// make burst requests at once, then the bucket is refilled at rate requests per second.  Clients are identified
+	// by a key which is (by default) the client's IP address - see RateLimitKey option.
+	requestLimiter struct {
+		rate   float64       // tokens added to a bucket per second
+		burst  int           // max. number of tokens in a bucket
+		refill time.Duration // time to refill an empty bucket
+
+		mtx     sync.Mutex              // protects concurrent access of the following fields
+		buckets map[string]*tokenBucket // map key is client key
+		swept   time.Time               // when full buckets were last removed from the map
+	}
+
+	// tokenBucket is how many requests a client can make now (tokens) as of the time of its last request
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+// newRequestLimiter creates a request rate limiter or returns nil if no limit is required
+func newRequestLimiter(rate float64, burst int) *requestLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &requestLimiter{
+		rate:    rate,
+		burst:   burst,
+		refill:  time.Duration(float64(burst) / rate * float64(time.Second)),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow checks if the client (identified by key) may make a request now, or returns how long until it can
+func (rl *requestLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	// Occasionally remove buckets that have been refilled (same as a new bucket) so the map does not keep growing
+	if now.Sub(rl.swept) > rl.refill {
+		for k, b := range rl.buckets {
+			if now.Sub(b.last) >= rl.refill {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.swept = now
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(rl.burst), last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(rl.burst), b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// checkRequestRate returns false (after sending a response with HTTP status 429) if the client has exceeded the
+// request rate limit (see RateLimit option)
+func (h *Handler) checkRequestRate(w http.ResponseWriter, r *http.Request) bool {
+	if h.requestLimiter == nil {
+		return true
+	}
+	allowed, retry := h.requestLimiter.allow(h.rateLimitKey(r), time.Now())
+	if !allowed {
+		tooManyRequests(w, "Error: request rate limit exceeded", retry)
+	}
+	return allowed
+}
+
+// acquireRequest returns false (after sending a response with HTTP status 429) if the max. number of requests are
+// already being handled (see MaxConcurrentRequests option), otherwise it returns true and the caller must call
+// releaseRequest when the request is finished
+func (h *Handler) acquireRequest(w http.ResponseWriter) bool {
+	if h.requestSem == nil {
+		return true
+	}
+	select {
+	case h.requestSem <- struct{}{}:
+		return true
+	default:
+		tooManyRequests(w, "Error: too many concurrent requests", 0)
+		return false
+	}
+}
+
+// releaseRequest is called when a request (that acquireRequest allowed) is finished
+func (h *Handler) releaseRequest() {
+	if h.requestSem != nil {
+		<-h.requestSem
+	}
+}
+
+// tooManyRequests sends a response with HTTP status 429 and a GraphQL error, plus a Retry-After header (in whole
+// seconds) if retry is not zero
+func tooManyRequests(w http.ResponseWriter, message string, retry time.Duration) {
+	if retry > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/graphql+json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	msg, _ := json.Marshal(message)
+	w.Write([]byte(`{"data": null,"errors": [{"message": ` + string(msg) + `}]}`))
+}
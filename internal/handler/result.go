@@ -4,13 +4,17 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/andrewwphillips/eggql/internal/field"
 	"github.com/dolmen-go/jsonmap"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 type (
@@ -20,6 +24,33 @@ type (
 
 		isMutation, isSubscription bool
 		variables                  map[string]interface{} // valid variables for this op (extracted from the request)
+
+		// omitNulls is set if the handler option is on or the request asked for it (using an extension)
+		// Note that this shadows the Handler field of the same name, which is just the default for the op.
+		omitNulls bool
+		// addTypename is set if __typename is added to every object (see AddTypename) - shadows the Handler field
+		addTypename bool
+
+		clientKey  string           // identifies the client for field rate limits
+		rateLimits *rateLimitReport // where to record the status of rate limited fields (may be nil)
+
+		// caches (subscriptions only) are the resolver caches used by this operation instead of the shared ones
+		caches *scopedCaches
+		// elementCaches (if not nil) keep the values of resolvers of list elements (see elementcache.go)
+		elementCaches *scopedCaches
+		// cacheCounts (if not nil) counts the cache hits and misses of the operation (see OperationRecord)
+		cacheCounts *cacheCounts
+		// arena (if not nil) provides the maps and slices used to build the result (see ResultArena option)
+		arena *resultArena
+
+		// elementErrors (if not nil) collects errors of list elements that are returned as null (see resolveElement)
+		elementErrors *elementErrors
+		// operation is used to add details to the errors sent with subscription events (see resolveEvent)
+		operation *ast.OperationDefinition
+		// tracer (if not nil) records how long each field took to resolve (see Tracing option)
+		tracer *tracer
+		// pool (if not nil) runs the resolvers of the operation, shallowest fields first (see RequestWorkers option)
+		pool *workerPool
 	}
 
 	// gqlValue contains the result of a query or queries, or an error, plus the name
@@ -29,6 +60,12 @@ type (
 		err   error       // non-nil if something went wrong whence the contents of value should be ignored
 	}
 
+	// gqlEvent is the resolved value of a value (event) received from a subscription channel plus any errors
+	gqlEvent struct {
+		value  interface{}
+		errors gqlerror.List
+	}
+
 	// idField stores name and type of fabricated id field (if required) for maps/slices/arrays
 	idField struct {
 		name  string
@@ -52,186 +89,339 @@ type (
 //	idField = name/type of fabricated "id" field (see "field_id" option for lists of objects)
 func (op *gqlOperation) GetSelections(ctx context.Context, set ast.SelectionSet, data []interface{}, id *idField,
 ) (jsonmap.Ordered, error) {
-	resultChans := make([]<-chan gqlValue, 0, len(set))
-	for _, s := range set {
-		// For each query we check all the data structs
-	dataLoop:
-		for _, d := range data {
-			// Get the struct that contains the resolvers that we can use
-			v := reflect.ValueOf(d)
-			for v.Type().Kind() == reflect.Ptr {
-				v = v.Elem() // follow indirection
-			}
-
-			switch astType := s.(type) {
-			case *ast.Field:
-				if id != nil && astType.Name == id.name {
-					// Requesting generated ID field - return chan with the fabricated ID
-					ch := make(chan gqlValue, 1)
-					ch <- gqlValue{
-						name: id.name, value: id.value.Interface(),
-					}
-					close(ch)
-					resultChans = append(resultChans, ch)
-					break dataLoop
-				} else {
-					// Find and execute the "resolver" in the struct (or recursively in embedded structs)
-					if ch := op.FindSelection(ctx, astType, v); ch != nil {
-						resultChans = append(resultChans, ch)
-						break dataLoop // we got a result so stop looking
-					}
-				}
-
-			case *ast.InlineFragment:
-				if v.Type().Name() != astType.TypeCondition {
-					continue dataLoop // TODO: decide whether to continue or break
-				}
-				resultChans = append(resultChans, op.FindFragments(ctx, astType.SelectionSet, v))
+	if err := ctx.Err(); err != nil {
+		return jsonmap.Ordered{}, err // don't start any more resolvers if the client has gone away (or timed out)
+	}
+	// Get the structs that contain the resolvers that we can use
+	values := make([]reflect.Value, 0, len(data))
+	for _, d := range data {
+		if d == nil {
+			continue
+		}
+		v := reflect.ValueOf(d)
+		for v.Type().Kind() == reflect.Ptr {
+			v = v.Elem() // follow indirection
+		}
+		values = append(values, v)
+	}
 
-			case *ast.FragmentSpread:
-				resultChans = append(resultChans, op.FindFragments(ctx, astType.Definition.SelectionSet, v))
+	// Each field (including those of fragments) has a slot, in the order of the results, which receives its value,
+	// plus a slot at the end for the __typename (if added)
+	fields := op.collectFields(set, values)
+	rs := newResultSlots(len(fields) + 1)
+	if op.pool != nil {
+		rs.pool, rs.depth = op.pool, pathDepth(ctx)
+	}
+	for i, astField := range fields {
+		if id != nil && astField.Name == id.name {
+			// Requesting generated ID field - return the fabricated ID
+			rs.set(i, gqlValue{name: astField.Alias, value: id.value.Interface()})
+			continue
+		}
+		// For each field we check all the data structs
+		found := false
+		for _, v := range values {
+			// Find and execute the "resolver" in the struct (or recursively in embedded structs)
+			if found = op.FindSelection(ctx, astField, v, rs, i); found {
+				break // we got a result so stop looking
 			}
 		}
+		// No Go field was found, so use a wildcard resolver (if any)
+		if !found && !op.findWildcard(ctx, astField, data, rs, i) {
+			// No resolver - with a schema supplied as SDL (see MissingResolverNull) a nullable field is null,
+			// otherwise it's an error (probably a bug in building the resolver lookup tables)
+			if op.missingResolverNull && !astField.Definition.Type.NonNull {
+				rs.set(i, gqlValue{name: astField.Alias})
+			} else {
+				rs.set(i, gqlValue{err: fmt.Errorf("no resolver found for field %q", astField.Name)})
+			}
+		}
+	}
 
+	if op.addTypename {
+		if value, ok := op.typenameValue(ctx, set, fields, values); ok {
+			rs.set(len(fields), value)
+		}
 	}
 
-	// Now extract the values (will block until all channels have closed)
-	r := jsonmap.Ordered{
-		Data:  make(map[string]interface{}),
-		Order: make([]string, 0, len(set)),
+	// The error of a nullable field is returned (with its path) and the field is null - other errors are fatal
+	nullable := func(i int) bool {
+		return i < len(fields) && op.elementErrors != nil && ctx.Err() == nil &&
+			fields[i].Definition != nil && !fields[i].Definition.Type.NonNull
 	}
-	for _, ch := range resultChans {
-	inner:
-		for {
-			select {
-			case v, ok := <-ch:
-				if !ok {
-					break inner
-				}
-				if v.err != nil {
-					return jsonmap.Ordered{}, v.err
-				}
-				if _, ok := r.Data[v.name]; !ok {
-					r.Order = append(r.Order, v.name) // only append to order if not already in the map
-				}
-				r.Data[v.name] = v.value
-				if len(r.Order) != len(r.Data) {
-					panic("map and slice in the jsonmap.Ordered should be the same size (map element replaced?)")
-				}
-			case <-ctx.Done():
-				return jsonmap.Ordered{}, ctx.Err()
+	if err := rs.wait(ctx, func(i int) bool { return !nullable(i) }); err != nil {
+		op.arena.abandon()
+		return jsonmap.Ordered{}, err
+	}
+
+	// All resolvers have finished so extract the values in order
+	r := op.arena.ordered(len(rs.slots))
+	for i, slot := range rs.slots {
+		if !slot.ok {
+			continue // no value (eg null omitted from the results)
+		}
+		if slot.value.err != nil {
+			if !nullable(i) {
+				op.arena.abandon()
+				return jsonmap.Ordered{}, slot.value.err
 			}
+			op.elementErrors.add(fieldError(ctx, fields[i], slot.value.err))
+			r.Order = append(r.Order, fields[i].Alias)
+			r.Data[fields[i].Alias] = nil
+			continue
 		}
+		r.Order = append(r.Order, slot.value.name) // the names are unique (see collectFields)
+		r.Data[slot.value.name] = slot.value.value
 	}
 	return r, nil
 }
 
-// FindSelection returns resolved value in a chan (if found), or empty chan (if excluded), or nil (not found)
+// FindSelection finds the resolver for a field in a struct and writes its value (or error) to a slot
 // Parameters:
 //   - ctx: context that indicates if the request has been cancelled
 //   - astField: contains the query name, arguments etc. to be resolved
 //   - v: struct which may contain the field required to resolve astField
+//   - rs, i: the slots and the index of the slot that receives the value
 //
 // Returns:
-//   - if found: closed chan containing a single value or error
-//   - if found but excluded by directive: closed chan with no values
-//   - if not found: nil
-func (op *gqlOperation) FindSelection(ctx context.Context, astField *ast.Field, v reflect.Value) <-chan gqlValue {
+//   - if found: true (the slot receives a single value or error, or nothing if excluded by directive)
+//   - if not found: false
+func (op *gqlOperation) FindSelection(ctx context.Context, astField *ast.Field, v reflect.Value, rs *resultSlots, i int,
+) bool {
 	if v.Type().Kind() != reflect.Struct { // struct = 25
 		// param. 'v' validation - note that this is a bug that should have been caught during schema building
 		panic("FindSelection: search of query field in non-struct")
 	}
 
 	if !op.noIntrospection && astField.Name == "__typename" { // __typename is a special introspection field (see GraphQL spec)
-		r := make(chan gqlValue, 1)
-		r <- gqlValue{name: astField.Alias, value: astField.ObjectDefinition.Name}
-		close(r)
-		return r
+		rs.set(i, gqlValue{name: astField.Alias, value: concreteTypeName(astField.ObjectDefinition, v)})
+		return true
 	}
 
 	// get the index of the resolver field then the type and value of that field
 	resolverInfo, ok := op.resolverLookup[v.Type()][astField.Name]
 	if !ok {
-		// TODO: scan to double-check that we don't have a field with the correct name (= bug)
-		// No matching field so close chan without writing
-		return nil
+		// No matching field, but if diagnostics are on double-check that the struct doesn't have one (= bug)
+		if resolverInfo, ok = op.lookupMiss(v.Type(), astField.Name); !ok {
+			return false
+		}
 	}
 	tField := v.Type().Field(resolverInfo.Index)
 	vField := v.Field(resolverInfo.Index)
 
-	fieldInfo, _ := field.Get(&tField)
+	fieldInfo, _ := field.Get(v.Type(), &tField)
 	// Recursively check fields of embedded struct
 	if fieldInfo.Embedded {
-		// if a field in the embedded struct matches a value is sent on the chan returned from FindSelection
-		if ch := op.FindSelection(ctx, astField, vField); ch != nil {
-			for v := range ch {
-				// just send the 1st value from chan
-				r := make(chan gqlValue, 1)
-				// TODO: check if we should run this in a separate Go routine
-				select {
-				case r <- v:
-					// nothing else needed here
-				case <-ctx.Done():
-					r <- gqlValue{err: ctx.Err()}
-				}
-				close(r)
-				return r
+		if vField.Kind() == reflect.Ptr {
+			if vField.IsNil() {
+				rs.set(i, gqlValue{err: fmt.Errorf("embedded struct %q is nil resolving %q", tField.Name, astField.Name)})
+				return true
 			}
-			// end of chan (no match found) so continue below
+			vField = vField.Elem()
+		}
+		// if a field in the embedded struct matches then its value is written to the slot
+		if op.FindSelection(ctx, astField, vField, rs, i) {
+			return true
+		}
+	}
+
+	// Fields excluded by a directive (@skip or @include) are not counted against the rate limit
+	if resolverInfo.Limiter != nil && !op.directiveBypass(astField.Directives) {
+		if err := op.checkRateLimit(resolverInfo.Limiter, astField.ObjectDefinition.Name, astField.Name); err != nil {
+			rs.set(i, gqlValue{err: err})
+			return true
 		}
 	}
 
+	if fieldInfo.HasContext && vField.Kind() == reflect.Func {
+		ctx = withParent(ctx, v) // see Parent
+	}
+
 	var cache ResolverCache
 	if resolverInfo.Cache.Saved != nil {
 		cache = resolverInfo.Cache
 	}
-	if op.isMutation || op.noConcurrency { // Mutations are run sequentially
-		ch := make(chan gqlValue, 1)
-		op.wrapResolve(ctx, astField, vField, reflect.Value{}, fieldInfo, cache, ch)
-		return ch
-	} else {
-		ch := make(chan gqlValue)
-		// Calling wrapResolve as a go routine allows resolvers to run in parallel
-		go op.wrapResolve(ctx, astField, vField, reflect.Value{}, fieldInfo, cache, ch)
-		return ch
+	// For a subscription with the "initial" option get the (sibling) field that provides the first value to send
+	var initial reflect.Value
+	if op.isSubscription && fieldInfo.Initial != "" {
+		initial = v.FieldByName(fieldInfo.Initial)
 	}
+	// Mutations are run sequentially, otherwise resolvers run in parallel (each writing to its own slot), except
+	// for trivial fields where starting a go-routine would take longer than resolving the field
+	rs.run(op.isMutation || op.noConcurrency || op.trivial(astField, vField, fieldInfo), op.resolverSem, func() {
+		op.wrapResolve(ctx, astField, vField, reflect.Value{}, fieldInfo, cache, initial, func(value gqlValue) {
+			rs.set(i, value)
+		})
+	})
+	return true
 }
 
-// wrapResolve calls resolve putting the return value on a chan and converting any panic to an error
+// trivial returns true if a field is resolved by just reading a (scalar) struct field, so it can't block and is
+// quicker to resolve directly than in a separate go-routine
+func (op *gqlOperation) trivial(astField *ast.Field, v reflect.Value, fieldInfo *field.Info) bool {
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface:
+		return false // resolver function or a value we can't be sure about
+	}
+	return len(astField.SelectionSet) == 0 && fieldInfo.Subscript == "" && fieldInfo.Timeout == 0 &&
+		len(op.resolverMiddleware) == 0 && len(op.directives) == 0
+}
+
+// wrapResolve calls resolve passing the return value to set (unless omitted) and converting any panic to an error
+// If initial is valid (subscriptions only) it provides a value to be sent on the subscription channel first.
 func (op *gqlOperation) wrapResolve(
 	ctx context.Context, astField *ast.Field, v, vID reflect.Value, fieldInfo *field.Info, cache ResolverCache,
-	ch chan<- gqlValue,
+	initial reflect.Value, set func(gqlValue),
 ) {
 	defer func() {
 		// Convert any panics in resolvers into an (internal) error
 		if recoverValue := recover(); recoverValue != nil {
-			ch <- gqlValue{err: fmt.Errorf("Internal error: panic %v", recoverValue)}
+			set(gqlValue{err: fmt.Errorf("Internal error: panic %v", recoverValue)})
 		}
-		close(ch)
 	}()
-	if value := op.resolve(ctx, astField, v, vID, fieldInfo, cache); value != nil {
-		ch <- *value
+	if err := ctx.Err(); err != nil {
+		set(gqlValue{err: err}) // don't call the resolver if the request has been cancelled (eg client disconnected)
+		return
+	}
+	if value := op.resolveField(ctx, astField, v, vID, fieldInfo, cache); value != nil {
+		if op.shadowCandidates != nil {
+			op.shadow(ctx, astField, v, vID, fieldInfo, value)
+		}
+		if op.omitNulls && value.err == nil && !astField.Definition.Type.NonNull && isNull(value.value) {
+			return // leave the field out of the results
+		}
+		if initial.IsValid() && value.err == nil && value.value != nil {
+			value.value = op.withInitial(ctx, initial, value.value)
+		}
+		if value.err == nil && value.value != nil && reflect.TypeOf(value.value).Kind() == reflect.Chan {
+			value.value = op.resolveEvents(ctx, astField, fieldInfo, value.value)
+		}
+		if value.err != nil {
+			value.err = withErrorPath(ctx, astField, value.err)
+		}
+		set(*value)
 	}
 }
 
-func (op *gqlOperation) FindFragments(ctx context.Context, set ast.SelectionSet, v reflect.Value) <-chan gqlValue {
-	result, err := op.GetSelections(ctx, set, []interface{}{v.Interface()}, nil)
+// withInitial returns a channel that first sends the initial value then everything received from the subscription
+// channel (in).  The initial value is obtained from a field or a func (optionally taking a context) returning it.
+func (op *gqlOperation) withInitial(ctx context.Context, initial reflect.Value, in interface{}) interface{} {
+	if initial.Kind() == reflect.Func {
+		var args []reflect.Value
+		if initial.Type().NumIn() > 0 {
+			args = append(args, reflect.ValueOf(ctx))
+		}
+		initial = initial.Call(args)[0]
+	}
 
-	var ch chan gqlValue
-	if err != nil {
-		ch = make(chan gqlValue, 1)
-		ch <- gqlValue{err: err}
-	} else {
-		if len(result.Order) != len(result.Data) {
-			panic("slice and map must have the same number of elts")
+	src := reflect.ValueOf(in)
+	out := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, src.Type().Elem()), 0)
+	done := reflect.ValueOf(ctx.Done())
+	go func() {
+		defer func() {
+			out.Close()
+			// drain the source so the resolver writing to it is not blocked forever
+			for _, ok := src.Recv(); ok; _, ok = src.Recv() {
+			}
+		}()
+		// Send the initial value, then forward values from the source until it's closed or the context is done
+		value := initial.Convert(src.Type().Elem())
+		for {
+			chosen, _, _ := reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: out, Send: value},
+				{Dir: reflect.SelectRecv, Chan: done},
+			})
+			if chosen == 1 {
+				return
+			}
+			chosen, v, ok := reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectRecv, Chan: src},
+				{Dir: reflect.SelectRecv, Chan: done},
+			})
+			if chosen == 1 || !ok {
+				return
+			}
+			value = v
+		}
+	}()
+	return out.Interface()
+}
+
+// resolveEvents returns a channel that sends the resolved value of each value (event) received from a subscription
+// channel (in), so that the selection set of the subscription (aliases, nested fields, directives) is applied to it
+func (op *gqlOperation) resolveEvents(ctx context.Context, astField *ast.Field, fieldInfo *field.Info, in interface{},
+) <-chan gqlEvent {
+	src := reflect.ValueOf(in)
+	out := make(chan gqlEvent)
+	go func() {
+		defer func() {
+			close(out)
+			// drain the source so the resolver writing to it is not blocked forever
+			for _, ok := src.Recv(); ok; _, ok = src.Recv() {
+			}
+		}()
+		for {
+			chosen, v, ok := reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectRecv, Chan: src},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			})
+			if chosen == 1 || !ok {
+				return
+			}
+			event := op.resolveEvent(ctx, astField, fieldInfo, v)
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// resolveEvent resolves one value received from a subscription channel.  An error (or panic) means that the
+// event's value is null, but (unlike queries) it does not end the subscription.  Errors are returned with the
+// event (with the path of the error) including errors for list elements that were resolved as null.
+func (op *gqlOperation) resolveEvent(ctx context.Context, astField *ast.Field, fieldInfo *field.Info, v reflect.Value,
+) (r gqlEvent) {
+	eventOp := *op
+	eventOp.elementErrors = &elementErrors{} // errors are sent with each event (not added to the operation's errors)
+	eventOp.elementCaches = &scopedCaches{}
+	defer func() {
+		if recoverValue := recover(); recoverValue != nil {
+			r.value = nil
+			eventOp.elementErrors.add(fieldError(ctx, astField, fmt.Errorf("Internal error: panic %v", recoverValue)))
 		}
-		ch = make(chan gqlValue, len(result.Order))
-		for _, v := range result.Order {
-			ch <- gqlValue{name: v, value: result.Data[v]}
+		// Add details (error code, extensions etc) in the same way as for errors of queries
+		if len(eventOp.elementErrors.list) > 0 && op.operation != nil {
+			r.errors = eventOp.elementErrors.errors(op.operation)
+		} else {
+			r.errors = eventOp.elementErrors.list
 		}
+	}()
+	value := eventOp.resolve(ctx, astField, v, reflect.Value{}, fieldInfo, ResolverCache{})
+	if value == nil {
+		return
+	}
+	if value.err != nil {
+		eventOp.elementErrors.add(fieldError(ctx, astField, value.err))
+		return
+	}
+	r.value = value.value
+	return
+}
+
+// isNull returns true if a resolved value will be encoded as a JSON null - eg a nil pointer or a nil slice
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
 	}
-	close(ch)
-	return ch
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	}
+	return false
 }
 
 // valueSlice attaches the methods of Interface to []reflect.Value, where the slice values (reflect.Value) must all
@@ -276,6 +466,28 @@ func (x valueSlice) Less(i, j int) bool {
 }
 func (x valueSlice) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
 
+// mapElements returns the keys and values of a map, in order of the keys, or of an ordered map in its own order
+func mapElements(v reflect.Value) (keys, elements []reflect.Value) {
+	if v.Kind() != reflect.Map {
+		// ordered map (see field.OrderedMapTypes)
+		n := int(v.MethodByName("Len").Call(nil)[0].Int())
+		keys, elements = make([]reflect.Value, n), make([]reflect.Value, n)
+		for i := range keys {
+			keys[i], elements[i] = field.OrderedMapAt(v, i)
+		}
+		return
+	}
+	keys = v.MapKeys()
+	sort.Sort(valueSlice(keys))
+	elements = make([]reflect.Value, len(keys))
+	for i, key := range keys {
+		if elements[i] = v.MapIndex(key); !elements[i].IsValid() {
+			panic("keys returned from MapKeys() should always be found/valid")
+		}
+	}
+	return
+}
+
 // resolve calls a resolver given a query to obtain the results of the query (incl. listed and nested queries)
 // Resolvers are often dynamic (where the resolver is a Go function) in which case the function is called to get the value.
 // Returns a pointer to a value (or error) or nil if nothing results (e.g. if excluded by directive)
@@ -290,39 +502,78 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 	cache ResolverCache,
 ) (retval *gqlValue) {
 	var key CacheKey
-	if op.directiveBypass(astField) {
+	if op.directiveBypass(astField.Directives) {
 		return nil
 	}
 
+	if cache.Saved != nil {
+		cache = op.cacheOf(ctx, cache)
+	}
+	// If this resolver's values are kept in a cache backend (see SharedCache option)...
+	if cache.shared != nil {
+		return op.resolveShared(ctx, astField, v, vID, fieldInfo, cache)
+	}
 	// If this resolver has an active cache...
 	if cache.Saved != nil {
 		// Check if we have a cached value that we can return
-		key = CacheKey{
-			fieldValue: v,
-			args:       argsKey(astField.Arguments),
-		}
+		key = cacheKey(ctx, astField, v, op.variables)
 		cache.Mtx.Lock()
 		result, ok := cache.Saved[key]
+		var refresh bool
+		var wait <-chan struct{}
+		if ok {
+			ok = cache.check(key)
+		}
+		if ok && cache.swr != nil {
+			ok, refresh, wait = cache.swr.check(key)
+		}
 		cache.Mtx.Unlock()
+		if refresh {
+			op.refresh(ctx, astField, v, vID, fieldInfo, cache, key)
+		}
+		if wait != nil {
+			// The value is too old but is being refreshed, so use the refreshed value rather than calling the resolver
+			result, ok = cache.waitRefresh(ctx, key, wait)
+		}
 		if ok {
+			cache.stats.hit()
+			op.cacheCounts.hit()
 			retval = &gqlValue{name: astField.Alias, value: result.Interface()}
 			return
 		}
+		cache.stats.miss()
+		op.cacheCounts.miss()
 
 		// If not in cache save any valid return in the cache
 		defer func() {
 			if retval.err == nil && retval.value != nil {
+				value := retval.value
+				if op.arena != nil {
+					value = copyResult(value) // the arena's maps and slices are reused after the request
+				}
 				cache.Mtx.Lock()
-				cache.Saved[key] = reflect.ValueOf(retval.value)
+				cache.save(key, reflect.ValueOf(value))
 				cache.Mtx.Unlock()
 			}
 		}()
 	}
 
+	// A field timeout tightens the deadline seen by the resolver (and nested resolvers) - see eggql.RemainingBudget
+	if fieldInfo.Timeout > 0 && !op.isSubscription {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fieldInfo.Timeout)
+		defer cancel()
+	}
+
 	if v.Type().Kind() == reflect.Func {
 		var err error
 		// For function fields, we have to call it to get the resolver value to use
-		if v, err = op.fromFunc(ctx, astField, v, fieldInfo); err != nil {
+		if fieldInfo.Batch {
+			v, err = batchValue(ctx, astField) // the function has already been called for all elements of the list
+		} else {
+			v, err = op.fromFunc(ctx, astField, v, fieldInfo)
+		}
+		if err != nil {
 			return &gqlValue{err: err}
 		}
 	}
@@ -336,6 +587,23 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 		v = v.Elem() // follow indirection
 	}
 
+	// A field with the "json" option is a JSON scalar, so the value is encoded as JSON (whatever its type)
+	if fieldInfo.JSON {
+		return jsonValue(astField, v)
+	}
+	// A dynamic object (see field.Dynamic) is resolved using the type of the field (or list element) in the schema
+	if v.Type() == field.DynamicType {
+		t := astField.Definition.Type
+		for t.Elem != nil {
+			t = t.Elem
+		}
+		value, err := op.dynamicValue(ctx, astField, t, v.Interface())
+		if err != nil {
+			return &gqlValue{err: err}
+		}
+		return &gqlValue{name: astField.Alias, value: value}
+	}
+
 	// For "subscript" option if v is a map/slice/array convert it to an element using the "subscript" to index into the container
 	if fieldInfo.Subscript != "" {
 		if len(astField.Arguments) != 1 || astField.Arguments[0].Name != fieldInfo.Subscript {
@@ -353,6 +621,13 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 			return &gqlValue{err: err}
 		}
 		switch v.Type().Kind() {
+		case reflect.Struct: // ordered map
+			v = field.OrderedMapGet(v, arg)
+			if !v.IsValid() {
+				return &gqlValue{err: fmt.Errorf("index '%s' (value %q) is not valid for field %s", fieldInfo.Subscript, arg.Interface(), fieldInfo.Name)}
+			}
+			vID = arg // remember the value of the "subscript" (map key)
+
 		case reflect.Map:
 			v = v.MapIndex(arg)
 			if !v.IsValid() {
@@ -379,6 +654,10 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 	// It's a custom scalar if there exists a method (on ptr to type) with signature: func (*T) UnmarshalEGGQL(string) error
 	// Note: we check for ptr (not value) receiver as "unmarshaling" modifies though we are marshaling here
 	t := v.Type()
+	if t == field.TimeType {
+		// A time.Time is a DateTime scalar which is encoded as a string (RFC 3339 unless DateTimeFormat is used)
+		return &gqlValue{name: astField.Alias, value: v.Interface().(time.Time).Format(op.dateTimeFormat)}
+	}
 	pt := reflect.TypeOf(reflect.New(t).Interface())
 	if pt.Implements(field.UnmarshalerType) {
 		var valueString string
@@ -406,6 +685,8 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 			tmp := reflect.New(t) // we have to make an addressable copy of v so we can call with ptr receiver
 			tmp.Elem().Set(v)
 			valueString = tmp.Interface().(fmt.Stringer).String()
+		} else if number, ok := op.formatFloat(v); ok {
+			valueString = number.String() // custom scalar with an underlying float type
 		} else {
 			valueString = fmt.Sprintf("%v", v.Interface())
 		}
@@ -417,7 +698,11 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 		t = t.Elem()
 	}
 
-	switch t.Kind() {
+	kind := t.Kind()
+	if field.IsOrderedMap(t) {
+		kind = reflect.Map // ordered map is a list like a map
+	}
+	switch kind {
 	case reflect.Struct:
 		// Check if we have to fabricate an "id" field
 		var id *idField
@@ -431,9 +716,13 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 		} else if fieldInfo.Subscript != "" {
 			id = &idField{name: fieldInfo.Subscript, value: vID}
 			// Note that for subscripts (of slice/array) the id passed from the client includes the BaseIndex
+			if op.hasBatch(t) {
+				// batch resolvers of a single element are called with just its key
+				ctx = op.batchList(ctx, astField.SelectionSet, []reflect.Value{v}, []reflect.Value{vID}).element(ctx, 0)
+			}
 		}
 		// Look up all sub-queries in this object
-		if result, err := op.GetSelections(ctx, astField.SelectionSet, []interface{}{v.Interface()}, id); err != nil {
+		if result, err := op.GetSelections(objectContext(ctx, astField), astField.SelectionSet, []interface{}{v.Interface()}, id); err != nil {
 			return &gqlValue{err: err}
 		} else {
 			return &gqlValue{name: astField.Alias, value: result}
@@ -441,23 +730,26 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 
 	case reflect.Map:
 		var results []interface{}
-		if v.IsNil() {
+		if t.Kind() == reflect.Map && v.IsNil() {
 			if !fieldInfo.Nullable {
 				return &gqlValue{err: fmt.Errorf("returning null when list %q is not nullable", astField.Alias)}
 			}
 			// else return nil (for null list)
 		} else {
 			// resolve for all values in the map
-			results = make([]interface{}, 0, v.Len()) // to distinguish empty slice from nil slice
-			keys := valueSlice(v.MapKeys())
-			sort.Sort(keys)
-			for _, eKey := range keys {
-				eVal := v.MapIndex(eKey) // eVal is the map value for the element at eKey
-				if !eVal.IsValid() {
-					panic("keys returned from MapKeys() should always be found/valid")
-				}
-				// TODO: allow list elements to be cached
-				if value := op.resolve(ctx, astField, eVal, eKey, fieldInfo, ResolverCache{}); value != nil {
+			keys, elements := mapElements(v)
+			results = op.arena.list(len(keys)) // to distinguish empty slice from nil slice
+			listCtx, listType := fieldPath(ctx, astField), listType(ctx, astField)
+			var batch *listBatch
+			if op.mayBatch(field.ElemType(t)) {
+				batch = op.batchList(listCtx, astField.SelectionSet, elements, keys)
+			}
+			for i, eKey := range keys {
+				elemCtx := withElement(batch.element(listCtx, i), v, eKey)
+				if value := op.resolveElement(elemCtx, astField, listType, i, elements[i], eKey, fieldInfo); value != nil {
+					if value.err != nil {
+						return value
+					}
 					results = append(results, value.value)
 				}
 			}
@@ -473,10 +765,19 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 			// else return nil (for null list)
 		} else {
 			// resolve for all values in the list
-			results = make([]interface{}, 0, v.Len()) // to distinguish empty slice from nil slice
+			results = op.arena.list(v.Len()) // to distinguish empty slice from nil slice
+			listCtx, listType := fieldPath(ctx, astField), listType(ctx, astField)
+			var batch *listBatch
+			if op.mayBatch(t.Elem()) {
+				elements, keys := make([]reflect.Value, v.Len()), make([]reflect.Value, v.Len())
+				for i := range elements {
+					elements[i], keys[i] = v.Index(i), reflect.ValueOf(i+fieldInfo.BaseIndex)
+				}
+				batch = op.batchList(listCtx, astField.SelectionSet, elements, keys)
+			}
 			for i := 0; i < v.Len(); i++ {
-				// TODO: allow list elements to be cached
-				if value := op.resolve(ctx, astField, v.Index(i), reflect.ValueOf(i), fieldInfo, ResolverCache{}); value != nil {
+				elemCtx := withElement(batch.element(listCtx, i), v, reflect.ValueOf(i))
+				if value := op.resolveElement(elemCtx, astField, listType, i, v.Index(i), reflect.ValueOf(i), fieldInfo); value != nil {
 					if value.err != nil {
 						return value
 					}
@@ -489,73 +790,130 @@ func (op *gqlOperation) resolve(ctx context.Context, astField *ast.Field, v, vID
 	case reflect.Chan:
 		return &gqlValue{name: astField.Alias, value: v.Interface()}
 	}
-	if fieldInfo.GQLTypeName == "ID" {
-		return &gqlValue{name: astField.Alias, value: v.Interface()}
-	}
 	// If enum or enum list get the integer index and look up the enum value
-	if enumName := fieldInfo.GQLTypeName; enumName != "" {
-		if enumName[len(enumName)-1] == '!' {
-			enumName = enumName[:len(enumName)-1]
-		}
-		if len(enumName) > 2 && enumName[0] == '[' && enumName[len(enumName)-1] == ']' {
-			enumName = enumName[1 : len(enumName)-1]
-			if enumName[len(enumName)-1] == '!' {
-				enumName = enumName[:len(enumName)-1]
-			}
+	enumName := baseTypeName(fieldInfo.GQLTypeName)
+	if enumName == "" {
+		enumName, _ = field.EnumName(v.Type()) // Go enum type
+	}
+	if enumName != "" {
+		if enumName == "ID" {
+			// ID is output as a string unless it's backed by an integer type
+			return &gqlValue{name: astField.Alias, value: v.Interface()}
 		}
 		// Check that the enum exists
 		if _, ok := op.enums[enumName]; !ok {
 			return &gqlValue{err: fmt.Errorf("enum %q not found for field %q", enumName, fieldInfo.Name)}
 		}
 		idx := -1
-		switch value := v.Interface().(type) {
-		case int:
-			idx = value
-		case int8:
-			idx = int(value)
-		case int16:
-			idx = int(value)
-		case int32:
-			idx = int(value)
-		case int64:
-			idx = int(value)
-		case uint:
-			idx = int(value)
-		case uint8:
-			idx = int(value)
-		case uint16:
-			idx = int(value)
-		case uint32:
-			idx = int(value)
-		case uint64:
-			idx = int(value)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			idx = int(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			idx = int(v.Uint())
 		default:
 			return &gqlValue{err: fmt.Errorf("invalid return type %d for enum (should be an integer type)", v.Kind())}
 		}
+		if idx < 0 || idx >= len(op.enums[enumName]) {
+			return &gqlValue{err: fmt.Errorf("value %d is out of range for enum %q (field %q)", idx, enumName, fieldInfo.Name)}
+		}
+		if op.intEnum(enumName) {
+			return &gqlValue{name: astField.Alias, value: idx}
+		}
 		return &gqlValue{name: astField.Alias, value: op.enums[enumName][idx]}
 	}
 
+	if number, ok := op.formatFloat(v); ok {
+		return &gqlValue{name: astField.Alias, value: number}
+	}
 	// Just return the scalar value (Int, String, Boolean, or Float)
 	return &gqlValue{name: astField.Alias, value: v.Interface()}
 }
 
-// directiveBypass handles field directives - just standard "skip" and "include" for now
-// Returns: true if a directive indicates the field is not to be processed
-func (op *gqlOperation) directiveBypass(astField *ast.Field) bool {
-	for _, d := range astField.Directives {
-		if d.Name != "skip" && d.Name != "include" {
-			continue // panic("Unexpected directive")
-		}
-		reverse := d.Name == "skip"
-		for _, arg := range d.Arguments {
-			if arg.Name == "if" {
-				if rawValue, err := arg.Value.Value(op.variables); err != nil {
-					panic(err)
-				} else if b, ok := rawValue.(bool); ok {
-					return b == reverse
-				}
-			}
+// concreteTypeName returns the name of the GraphQL type of an object (for the __typename field).  If the
+// object was selected via an interface or union (eg an element of a list of interface{}) the concrete type
+// is the Go struct (eg Human) behind the interface, rather than the type in the query (eg Character).
+func concreteTypeName(definition *ast.Definition, v reflect.Value) string {
+	if definition.Kind == ast.Interface || definition.Kind == ast.Union {
+		if name := field.TypeName(v.Type()); name != "" {
+			return name
+		}
+	}
+	return definition.Name
+}
+
+// hasTypeCondition checks if a fragment applies to an object of a Go struct type, ie the type condition is
+// the GraphQL type (struct name) or an interface/union that includes the type (eg by embedding a struct).
+// Anonymous structs (eg the root query) are assumed to match as their GraphQL name is not known.
+func (op *gqlOperation) hasTypeCondition(t reflect.Type, typeCondition string) bool {
+	name := field.TypeName(t)
+	if typeCondition == "" || name == "" || name == typeCondition {
+		return true
+	}
+	for _, definition := range op.schema.PossibleTypes[typeCondition] {
+		if definition.Name == name {
+			return true
 		}
 	}
 	return false
 }
+
+// baseTypeName strips the non-null (!) and list ([]) modifiers from a GraphQL type name, eg "[ID!]!" => "ID"
+func baseTypeName(typeName string) string {
+	if len(typeName) > 0 && typeName[len(typeName)-1] == '!' {
+		typeName = typeName[:len(typeName)-1]
+	}
+	if len(typeName) > 2 && typeName[0] == '[' && typeName[len(typeName)-1] == ']' {
+		typeName = typeName[1 : len(typeName)-1]
+		if typeName[len(typeName)-1] == '!' {
+			typeName = typeName[:len(typeName)-1]
+		}
+	}
+	return typeName
+}
+
+// get returns the cache to use in place of the shared resolver cache, which is the shared cache itself
+// unless the operation has its own (scoped) caches
+func (sc *scopedCaches) get(shared ResolverCache) ResolverCache {
+	if sc == nil {
+		return shared
+	}
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	if sc.m == nil {
+		sc.m = make(map[*sync.Mutex]ResolverCache)
+	}
+	cache, ok := sc.m[shared.Mtx]
+	if !ok {
+		cache = ResolverCache{Mtx: &sync.Mutex{}, Saved: make(map[CacheKey]reflect.Value), stats: shared.stats,
+			swr: shared.swr.scoped(), limits: shared.limits.scoped()}
+		sc.m[shared.Mtx] = cache
+	}
+	return cache
+}
+
+// hold registers a user of the caches, returning a function to be called when the user is finished with them
+func (sc *scopedCaches) hold() (release func()) {
+	sc.mtx.Lock()
+	sc.users++
+	sc.mtx.Unlock()
+	return func() {
+		sc.mtx.Lock()
+		defer sc.mtx.Unlock()
+		if sc.users--; sc.users == 0 {
+			sc.m = nil // release the cached values
+		}
+	}
+}
+
+// jsonValue returns the value of a JSON scalar field (see "json" option), eg a map[string]interface{} becomes a
+// JSON object.  The value is encoded here so that its maps and slices are not treated as lists of the results.
+func jsonValue(astField *ast.Field, v reflect.Value) *gqlValue {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return &gqlValue{err: fmt.Errorf("%w encoding JSON value of %q", err, astField.Name)}
+	}
+	if string(b) == "null" {
+		return &gqlValue{name: astField.Alias} // eg a nil map
+	}
+	return &gqlValue{name: astField.Alias, value: json.RawMessage(b)}
+}
@@ -211,3 +211,63 @@ func TestCustomScalar(t *testing.T) {
 		})
 	}
 }
+
+// TestNestedCustomScalar checks that custom scalars are decoded the same way from variables whether they are
+// used directly or nested in lists and input objects (including pointers to the scalar)
+func TestNestedCustomScalar(t *testing.T) {
+	type Event struct {
+		Name  string
+		Start TimeScalar
+		End   *TimeScalar
+	}
+	const schemaString = "type Query { " +
+		"one(t:TimeScalar!): String! list(t:[TimeScalar!]!): String! event(e:EventInput!): String! " +
+		"events(e:[EventInput!]!): String! } " +
+		"input EventInput { name: String! start: TimeScalar! end: TimeScalar } scalar TimeScalar"
+	queryData := struct {
+		One    func(TimeScalar) string   `egg:"(t)"`
+		List   func([]TimeScalar) string `egg:"(t)"`
+		Event  func(Event) string        `egg:"(e)"`
+		Events func([]Event) string      `egg:"(e)"`
+	}{
+		One: func(t TimeScalar) string { return t.Format("15:04") },
+		List: func(list []TimeScalar) (r string) {
+			for _, t := range list {
+				r += t.Format("15:04 ")
+			}
+			return
+		},
+		Event: func(e Event) string { return e.Name + e.Start.Format(" 15:04") + e.End.Format(" 15:04") },
+		Events: func(list []Event) (r string) {
+			for _, e := range list {
+				r += e.Name + e.Start.Format(" 15:04 ")
+			}
+			return
+		},
+	}
+	const t1, t2 = `"2006-01-02 15:04:05 +0000 UTC"`, `"2006-01-02 16:05:05 +0000 UTC"`
+
+	data := map[string]struct {
+		query     string
+		variables string
+		expected  interface{}
+	}{
+		"Arg":    {"query ($t: TimeScalar!) { one(t: $t) }", `{"t": ` + t1 + `}`, JsonObject{"one": "15:04"}},
+		"List":   {"query ($t: [TimeScalar!]!) { list(t: $t) }", `{"t": [` + t1 + `,` + t2 + `]}`, JsonObject{"list": "15:04 16:05 "}},
+		"Object": {"query ($e: EventInput!) { event(e: $e) }", `{"e": {"name":"a","start":` + t1 + `,"end":` + t2 + `}}`, JsonObject{"event": "a 15:04 16:05"}},
+		"ObjectList": {
+			"query ($e: [EventInput!]!) { events(e: $e) }", `{"e": [{"name":"a","start":` + t1 + `},{"name":"b","start":` + t2 + `}]}`,
+			JsonObject{"events": "a 15:04 b 16:05 "},
+		},
+	}
+
+	h := handler.New([]string{schemaString}, nil, [3][]interface{}{{queryData}, nil, nil})
+	for name, testData := range data {
+		t.Run(name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{"query": testData.query, "variables": json.RawMessage(testData.variables)})
+			result, errs := doRequest(t, h, string(body))
+			Assertf(t, errs == nil, "Expected no error and got %v", errs)
+			Assertf(t, reflect.DeepEqual(result, testData.expected), "Expected %v, got %v", testData.expected, result)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+// secrets.go redacts the values of secret arguments (eg passwords) from error messages, which are returned to the
+// client and passed to the audit sink (if any).  An argument is secret if it has the {secret} option in the egg:
+// tag, eg `egg:"login(user,password{secret})"`, or its name is registered using the SecretArgs option.  Note that
+// secret arguments are identified by name, so an argument with the same name in a different resolver is also secret.
+// Only whole values are redacted (not where the value is part of a longer word or number) and values shorter than
+// minSecretLength are not redacted at all, so that (eg) a secret "1" does not mangle every 1 in a message.
+// Tracing does not include argument values, and values are not logged (see cachebackend.go).
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+const (
+	redacted        = "[REDACTED]" // replaces the values of secret arguments in error messages
+	minSecretLength = 4            // values of secret arguments shorter than this are not redacted
+)
+
+// addSecretArgs records the names of secret arguments
+func (h *Handler) addSecretArgs(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	if h.secretArgs == nil {
+		h.secretArgs = make(map[string]bool)
+	}
+	for _, name := range names {
+		h.secretArgs[name] = true
+	}
+}
+
+// secretValues returns the values (as strings) of the secret arguments used in a request, whether literals in
+// the query text or variables.  The values of variables with the same name as a secret argument are included.
+func (h *Handler) secretValues(query string, variables map[string]interface{}) []string {
+	if len(h.secretArgs) == 0 {
+		return nil
+	}
+	var r []string
+	for name, v := range variables {
+		if h.secretArgs[name] {
+			r = appendSecret(r, v)
+		}
+	}
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return r // we can't find any literal values
+	}
+	for _, operation := range doc.Operations {
+		r = h.appendSecretArgs(r, operation.SelectionSet, variables)
+	}
+	for _, fragment := range doc.Fragments {
+		r = h.appendSecretArgs(r, fragment.SelectionSet, variables)
+	}
+	return r
+}
+
+// appendSecretArgs appends the values of secret arguments of the fields in a selection set (recursively)
+func (h *Handler) appendSecretArgs(r []string, set ast.SelectionSet, variables map[string]interface{}) []string {
+	for _, s := range set {
+		switch s := s.(type) {
+		case *ast.Field:
+			for _, arg := range s.Arguments {
+				if h.secretArgs[arg.Name] {
+					r = appendSecretValue(r, arg.Value, variables)
+				}
+			}
+			r = h.appendSecretArgs(r, s.SelectionSet, variables)
+		case *ast.InlineFragment:
+			r = h.appendSecretArgs(r, s.SelectionSet, variables)
+		}
+	}
+	return r
+}
+
+// appendSecretValue appends the string(s) of a value from the query text, including the elements of lists and
+// fields of input objects, and the values of variables
+func appendSecretValue(r []string, value *ast.Value, variables map[string]interface{}) []string {
+	if value == nil {
+		return r
+	}
+	switch value.Kind {
+	case ast.Variable:
+		return appendSecret(r, variables[value.Raw])
+	case ast.NullValue:
+		return r
+	case ast.ListValue, ast.ObjectValue:
+		for _, child := range value.Children {
+			r = appendSecretValue(r, child.Value, variables)
+		}
+		return r
+	}
+	if len(value.Raw) < minSecretLength {
+		return r
+	}
+	return append(r, value.Raw)
+}
+
+// appendSecret appends the string(s) of a value decoded from JSON (variables)
+func appendSecret(r []string, v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return r
+	case map[string]interface{}:
+		for _, elt := range v {
+			r = appendSecret(r, elt)
+		}
+		return r
+	case []interface{}:
+		for _, elt := range v {
+			r = appendSecret(r, elt)
+		}
+		return r
+	}
+	if s := fmt.Sprint(v); len(s) >= minSecretLength {
+		r = append(r, s)
+	}
+	return r
+}
+
+// redactErrors replaces any secret values in the messages of errors
+func redactErrors(errs gqlerror.List, secrets []string) {
+	if len(secrets) == 0 {
+		return
+	}
+	for _, e := range errs {
+		for _, secret := range secrets {
+			e.Message = redact(e.Message, secret)
+		}
+	}
+}
+
+// redact replaces each occurrence of secret in s that is a whole value, ie not part of a longer word or number
+func redact(s, secret string) string {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, secret)
+		if i < 0 {
+			break
+		}
+		end := i + len(secret)
+		if (i == 0 || !isWordByte(s[i-1]) || !isWordByte(secret[0])) &&
+			(end == len(s) || !isWordByte(s[end]) || !isWordByte(secret[len(secret)-1])) {
+			sb.WriteString(s[:i])
+			sb.WriteString(redacted)
+		} else {
+			sb.WriteString(s[:end])
+		}
+		s = s[end:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
+
+// isWordByte returns true if a byte can be part of a word or number (including all bytes of non-ASCII characters)
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= 0x80
+}
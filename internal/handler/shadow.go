@@ -0,0 +1,103 @@
+package handler
+
+// shadow.go runs "candidate" resolvers alongside the current resolvers of selected fields (see Shadow option) so
+// that a new implementation of a resolver can be checked against real traffic before it replaces the current one.
+// The client always gets the result of the current resolver - the candidate is run in the background and any
+// difference in the (resolved) results is reported.
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	shadowConcurrency = 8                // max. number of candidates running at once (see Handler.shadowSem)
+	shadowTimeout     = 10 * time.Second // how long a candidate can run if there is no OperationTimeout
+)
+
+// ShadowMismatch describes a difference between the results of the current and candidate resolvers of a field
+type ShadowMismatch struct {
+	Field        string      // GraphQL type and field name, eg "Query.search"
+	Path         string      // path of the field in the query result, eg "posts[2].author"
+	Primary      interface{} // resolved value of the current resolver (as in the query result)
+	PrimaryErr   error       // error from the current resolver (if any)
+	Candidate    interface{} // resolved value of the candidate resolver
+	CandidateErr error       // error from the candidate resolver (if any)
+}
+
+// shadow runs the candidate resolver (if any) for a field of a query and reports any difference between its
+// result and the result of the current resolver (primary) to the observer.  The candidate is run in a separate
+// go-routine with a context that is not cancelled when the request completes, but has its own deadline.  If too
+// many candidates are already running the candidate is not run.
+func (op *gqlOperation) shadow(ctx context.Context, astField *ast.Field, v, vID reflect.Value, fieldInfo *field.Info,
+	primary *gqlValue,
+) {
+	if op.isMutation || op.isSubscription || fieldInfo.Batch || astField.ObjectDefinition == nil {
+		return // never run a mutation twice
+	}
+	candidate, ok := op.shadowCandidates[fieldKey(astField)]
+	if !ok {
+		return
+	}
+	select {
+	case op.shadowSem <- struct{}{}:
+	default:
+		return // don't slow down the request (or use too many resources) if many candidates are running
+	}
+	p := *primary
+	if op.arena != nil {
+		p.value = copyResult(p.value) // the arena's maps and slices are reused after the request
+	}
+	path := getPath(fieldPath(ctx, astField)).String()
+
+	shadowOp := *op
+	shadowOp.arena = nil
+	shadowOp.caches = &scopedCaches{} // don't share cached values with the current resolvers
+	shadowOp.elementCaches = &scopedCaches{}
+	shadowOp.cacheCounts = nil
+	shadowOp.rateLimits = nil
+	shadowOp.elementErrors = &elementErrors{}
+	timeout := shadowTimeout
+	if op.opTimeout > 0 {
+		timeout = op.opTimeout
+	}
+	ctx, cancel := context.WithTimeout(connectionContext{values: ctx}, timeout)
+
+	go func() {
+		defer func() { <-op.shadowSem }()
+		defer cancel()
+		var c gqlValue
+		func() {
+			defer func() {
+				if recoverValue := recover(); recoverValue != nil {
+					c = gqlValue{err: fmt.Errorf("Internal error: panic %v", recoverValue)}
+				}
+			}()
+			if candidate.Type() != v.Type() {
+				c.err = fmt.Errorf("candidate type %s does not match resolver type %s", candidate.Type(), v.Type())
+				return
+			}
+			if value := shadowOp.resolve(ctx, astField, candidate, vID, fieldInfo, ResolverCache{}); value != nil {
+				c = *value
+			}
+		}()
+		if reflect.DeepEqual(p.value, c.value) && errorText(p.err) == errorText(c.err) {
+			return
+		}
+		op.observe(ShadowMismatch{Field: fieldKey(astField), Path: path, Primary: p.value, PrimaryErr: p.err,
+			Candidate: c.value, CandidateErr: c.err})
+	}()
+}
+
+// errorText returns the message of an error or an empty string if there is no error
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
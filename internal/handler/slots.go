@@ -0,0 +1,117 @@
+package handler
+
+// slots.go has the positional slots that receive the values of the fields of an object.  Each field (in the order of
+// the results) has its own slot, so the resolvers running in parallel write their values without any locking, and the
+// values are assembled (in order) once they have all finished.
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	// resultSlot receives the value of one field - ok is false if the field has no value (eg null omitted)
+	resultSlot struct {
+		value gqlValue
+		ok    bool
+	}
+
+	// resultSlots has the slots for the fields of an object and what's needed to wait for them to be written
+	resultSlots struct {
+		slots  []resultSlot
+		wg     sync.WaitGroup
+		errors chan int // index of each slot whose value is an error (buffered for all slots so never blocks)
+		async  bool     // set if any slot is written by another go-routine (else there is no need to wait)
+
+		// pool (if not nil) runs the resolvers (see RequestWorkers option) giving priority to those of lesser depth
+		pool  *workerPool
+		depth int         // depth of the object whose fields are resolved (see pathDepth)
+		tasks []*poolTask // resolvers submitted to the pool, which are run by wait if no worker has claimed them
+	}
+)
+
+func newResultSlots(n int) *resultSlots {
+	return &resultSlots{slots: make([]resultSlot, n), errors: make(chan int, n)}
+}
+
+// set writes the value of the field with index i - each slot is only ever written by one go-routine
+func (rs *resultSlots) set(i int, value gqlValue) {
+	rs.slots[i] = resultSlot{value: value, ok: true}
+	if value.err != nil {
+		rs.errors <- i
+	}
+}
+
+// run calls f (which writes to a slot) in a separate go-routine (or a worker of the pool), or directly if resolvers
+// are run sequentially (see runLimited)
+func (rs *resultSlots) run(sequential bool, sem chan struct{}, f func()) {
+	if rs.pool != nil && !sequential {
+		rs.wg.Add(1)
+		rs.tasks = append(rs.tasks, rs.pool.submit(rs.depth, func() {
+			defer rs.wg.Done()
+			f()
+		}))
+		rs.async = true
+		return
+	}
+	if runLimited(&rs.wg, sequential, sem, f) {
+		rs.async = true
+	}
+}
+
+// runLimited calls f in a separate go-routine (added to wg), or directly if sequential is true.  If sem is not nil
+// it limits the number of go-routines (see MaxResolverGoroutines) - when they are all in use f is called directly,
+// rather than waiting, as the go-routines may themselves be waiting for nested resolvers.  It returns true if a
+// go-routine was started.
+func runLimited(wg *sync.WaitGroup, sequential bool, sem chan struct{}, f func()) bool {
+	if !sequential && sem != nil {
+		select {
+		case sem <- struct{}{}:
+		default:
+			sequential = true
+		}
+	}
+	if sequential {
+		f()
+		return false
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if sem != nil {
+			defer func() { <-sem }()
+		}
+		f()
+	}()
+	return true
+}
+
+// wait blocks until all the slots have been written, returning early with an error if the context is done or a
+// slot receives an error for which fatal returns true.  After an error the slots must not be read as resolvers
+// may still be writing to them.
+func (rs *resultSlots) wait(ctx context.Context, fatal func(i int) bool) error {
+	if !rs.async {
+		return nil // all the slots were written by this go-routine (and errors are found when the slots are read)
+	}
+	// Rather than waiting for a worker, run any resolvers (in order) that are still in the pool's queue
+	for _, t := range rs.tasks {
+		t.run()
+	}
+	done := make(chan struct{})
+	go func() {
+		rs.wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return nil
+		case i := <-rs.errors:
+			if fatal(i) {
+				return rs.slots[i].value.err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
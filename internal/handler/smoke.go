@@ -0,0 +1,129 @@
+package handler
+
+// smoke.go generates and runs a simple query for each field of the root query (see SmokeTest), eg so that a test can
+// check that no resolver is nil or broken after a refactor, without writing a query for every field
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// maxSmokeDepth is how deeply nested objects are selected in the queries generated by SmokeTest
+const maxSmokeDepth = 3
+
+// SmokeResult is the result of the query generated (see SmokeTest) for a field of the root query
+type SmokeResult struct {
+	Field  string   // name of the field of the root query type, eg "Query.hero"
+	Query  string   // the generated query
+	Errors []string // error messages returned by the query (empty if the query succeeded)
+}
+
+// SmokeTest generates a query for each field of the root query (in alphabetical order), runs it and returns the
+// results.  The query selects the fields (of nested objects up to a few levels deep) that do not need arguments, and
+// the root field is given a sample value (eg 0, "" or the first enum value) for each required argument without a
+// default.  Mutations and subscriptions are not run, as they may have side effects.
+func (h *Handler) SmokeTest(ctx context.Context) []SmokeResult {
+	if h.schema.Query == nil {
+		return nil
+	}
+	var r []SmokeResult
+	for _, fieldDef := range h.schema.Query.Fields {
+		if strings.HasPrefix(fieldDef.Name, "__") {
+			continue // introspection
+		}
+		query := "{ " + fieldDef.Name + h.sampleArgs(fieldDef) + h.sampleSelection(fieldDef.Type, 1) + " }"
+		g := gqlRequest{Handler: h, Query: query}
+		result := g.ExecuteHTTP(ctx)
+		res := SmokeResult{Field: h.schema.Query.Name + "." + fieldDef.Name, Query: query}
+		for _, err := range result.Errors {
+			res.Errors = append(res.Errors, err.Message)
+		}
+		r = append(r, res)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Field < r[j].Field })
+	return r
+}
+
+// sampleArgs returns the arguments (in brackets) of a field for the arguments that are required, or an empty
+// string if none are required
+func (h *Handler) sampleArgs(fieldDef *ast.FieldDefinition) string {
+	var args []string
+	for _, arg := range fieldDef.Arguments {
+		if arg.Type.NonNull && arg.DefaultValue == nil {
+			args = append(args, arg.Name+": "+h.sampleValue(arg.Type))
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+// sampleValue returns a literal of a (non-null) type, eg for a required argument
+func (h *Handler) sampleValue(t *ast.Type) string {
+	if t.Elem != nil {
+		return "[]"
+	}
+	switch t.NamedType {
+	case "Int":
+		return "0"
+	case "Float":
+		return "0.0"
+	case "Boolean":
+		return "false"
+	case "String", "ID":
+		return `""`
+	case field.DateTimeName:
+		return strconv.Quote(time.Time{}.Format(h.dateTimeFormat))
+	}
+	def := h.schema.Types[t.NamedType]
+	if def == nil {
+		return `""`
+	}
+	switch def.Kind {
+	case ast.Enum:
+		return def.EnumValues[0].Name
+	case ast.InputObject:
+		var fields []string
+		for _, fieldDef := range def.Fields {
+			if fieldDef.Type.NonNull && fieldDef.DefaultValue == nil {
+				fields = append(fields, fieldDef.Name+": "+h.sampleValue(fieldDef.Type))
+			}
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return `""` // custom scalar
+}
+
+// sampleSelection returns the selection set (in braces) for a field of an object, interface or union type, or an
+// empty string for a scalar (or enum).  It selects the fields that do not require arguments (up to maxSmokeDepth).
+func (h *Handler) sampleSelection(t *ast.Type, depth int) string {
+	def := h.schema.Types[t.Name()]
+	if def == nil || def.Kind != ast.Object && def.Kind != ast.Interface && def.Kind != ast.Union {
+		return ""
+	}
+	var fields []string
+	for _, fieldDef := range def.Fields {
+		if strings.HasPrefix(fieldDef.Name, "__") || h.sampleArgs(fieldDef) != "" {
+			continue
+		}
+		var selection string
+		if child := h.schema.Types[fieldDef.Type.Name()]; child != nil && child.Kind != ast.Scalar && child.Kind != ast.Enum {
+			if depth >= maxSmokeDepth {
+				continue // don't go any deeper
+			}
+			selection = h.sampleSelection(fieldDef.Type, depth+1)
+		}
+		fields = append(fields, fieldDef.Name+selection)
+	}
+	if len(fields) == 0 {
+		fields = append(fields, "__typename")
+	}
+	return " { " + strings.Join(fields, " ") + " }"
+}
@@ -0,0 +1,45 @@
+package handler
+
+// spec.go checks that a schema only uses features of the selected version of the GraphQL specification
+
+import (
+	"fmt"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// The versions of the GraphQL specification that can be selected with the SpecVersion option
+const (
+	June2018    = "June2018"
+	October2021 = "October2021" // default - the latest version supported by gqlparser
+)
+
+// CheckSpecVersion returns an error if the schema uses features not in the version of the GraphQL spec.
+// For the June 2018 spec these are repeatable directives, interfaces that implement interfaces and the
+// @specifiedBy directive, which were all added in the October 2021 spec.
+func CheckSpecVersion(schema *ast.Schema, version string) error {
+	switch version {
+	case "", October2021:
+		return nil // all features supported by gqlparser are allowed
+	case June2018:
+		// checked below
+	default:
+		return fmt.Errorf("unknown GraphQL spec version %q (use %q or %q)", version, June2018, October2021)
+	}
+
+	for _, directive := range schema.Directives {
+		if directive.IsRepeatable {
+			return fmt.Errorf("repeatable directive @%s is not supported by the %s spec", directive.Name, version)
+		}
+	}
+	for _, definition := range schema.Types {
+		if definition.Kind == ast.Interface && len(definition.Interfaces) > 0 {
+			return fmt.Errorf("interface %s implementing interface %s is not supported by the %s spec",
+				definition.Name, definition.Interfaces[0], version)
+		}
+		if definition.Directives.ForName("specifiedBy") != nil {
+			return fmt.Errorf("@specifiedBy directive on %s is not supported by the %s spec", definition.Name, version)
+		}
+	}
+	return nil
+}
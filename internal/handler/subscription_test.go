@@ -1,10 +1,15 @@
 package handler_test
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -105,20 +110,16 @@ func TestSubscriptions(t *testing.T) {
 				{actionPause, 20},
 			},
 		},
-		/*	TODO: queries on websocket are not yet implemented
-			"query_old": {
-				delay: time.Second,
-				actions: []wsAction{
-					{actionSend, `{"type": "connection_init"}`},
-					{actionRecv, `"connection_ack"`},
-					{actionRecv, `"ka"`},
-					{actionSend, `{"type":"start","id":"ID-1","payload":{"query":"query {message}"}}`},
-					{actionRecv, `{"type":"data","id":"ID-1","payload":{"data":{"message":"hello"}}}`},
-					{actionSend, `{"type":"stop","id":"ID-1"}`},
-					{actionRecv, `"type":"complete","id":"ID-1"`},
-				},
+		"query_old": {
+			actions: []wsAction{
+				{actionSend, `{"type": "connection_init"}`},
+				{actionRecv, `"connection_ack"`},
+				{actionRecv, `"ka"`},
+				{actionSend, `{"type":"start","id":"ID-1","payload":{"query":"query {message}"}}`},
+				{actionRecv, `{"type":"data","id":"ID-1","payload":{"data":{"message":"hello"}}}`},
+				{actionRecv, `{"type":"complete","id":"ID-1"}`},
 			},
-		*/
+		},
 		// Using new sub-protocol -----------------
 		"basic_new": {
 			delay: time.Second, protocol: "graphql-transport-ws",
@@ -167,8 +168,8 @@ func TestSubscriptions(t *testing.T) {
 				{actionRecv, `"connection_ack"`},
 				{actionSend, `{"type":"subscribe","id":"ID-6","payload":{"query":"bad"}}`},
 				{actionRecv, `"error"`}, // Unexpected name "bad"
-				{actionError, websocket.CloseAbnormalClosure},
-				{actionPause, 20},
+				{actionSend, `{"type":"ping"}`},
+				{actionRecv, `"type":"pong"`}, // the connection is still open
 			},
 		},
 		"bad_vars": {
@@ -196,6 +197,18 @@ func TestSubscriptions(t *testing.T) {
 				{actionPause, 20},
 			},
 		},
+		"initial_value": {
+			delay: time.Second, protocol: "graphql-transport-ws",
+			actions: []wsAction{
+				{actionSend, `{"type": "connection_init"}`},
+				{actionRecv, `"connection_ack"`},
+				{actionSend, `{"type":"subscribe","id":"ID-9","payload":{"query":"subscription {status}"}}`},
+				{actionRecv, `{"type":"next","id":"ID-9","payload":{"data":{"status":"current"}}}`},
+				{actionRecv, `{"type":"next","id":"ID-9","payload":{"data":{"status":"hello"}}}`},
+				{actionSend, `{"type":"complete","id":"ID-9"}`},
+				{actionRecv, `"type":"complete","id":"ID-9"`},
+			},
+		},
 		"send_ping": {
 			protocol: "graphql-transport-ws",
 			actions: []wsAction{
@@ -284,34 +297,36 @@ func TestSubscriptions(t *testing.T) {
 }
 
 // getServer creates a simples GraphQL server that keeps sending "hello" messages for a "message" subscription
+// It also has a "status" subscription that sends the "current" value then keeps sending "hello" messages
 func getServer(delay, initialTimeout, pingFrequency, pongTimeout time.Duration) *httptest.Server {
-	// Create handler that has a single subscription that keeps sending "hello"
+	hello := func(ctx context.Context) <-chan string {
+		ch := make(chan string)
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					close(ch)
+					return
+				case ch <- "hello":
+					if delay > 0 {
+						time.Sleep(delay)
+					}
+				}
+			}
+		}()
+		return ch
+	}
+	// Create handler that has subscriptions that keep sending "hello"
 	h := handler.New(
-		[]string{"type Subscription{ message: String! }"},
+		[]string{"type Query{ message: String! } type Subscription{ message: String! status: String! }"},
 		nil,
 		[3][]interface{}{
-			nil, nil, {
+			{struct{ Message string }{"hello"}}, nil, {
 				struct {
 					Message func(context.Context) <-chan string
-				}{
-					func(ctx context.Context) <-chan string {
-						ch := make(chan string)
-						go func() {
-							for {
-								select {
-								case <-ctx.Done():
-									close(ch)
-									return
-								case ch <- "hello":
-									if delay > 0 {
-										time.Sleep(delay)
-									}
-								}
-							}
-						}()
-						return ch
-					},
-				},
+					Status  func(context.Context) <-chan string `egg:",initial=Current"`
+					Current string                              `egg:"-"`
+				}{hello, hello, "current"},
 			},
 		},
 		handler.InitialTimeout(initialTimeout),
@@ -321,3 +336,630 @@ func getServer(delay, initialTimeout, pingFrequency, pongTimeout time.Duration)
 
 	return httptest.NewServer(h)
 }
+
+// userKey is the context key for the user name added to the websocket context in TestWebSocketContext
+type userKey struct{}
+
+// TestWebSocketContext checks that values added to the websocket context are available to subscriptions
+// (after the upgrade request has completed) and that the upgrade is rejected if the context func fails
+func TestWebSocketContext(t *testing.T) {
+	user := func(ctx context.Context) <-chan string {
+		ch := make(chan string)
+		go func() {
+			defer close(ch)
+			for i := 0; i < 2; i++ {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- ctx.Value(userKey{}).(string):
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+		}()
+		return ch
+	}
+	h := handler.New(
+		[]string{"type Subscription{ user: String! }"},
+		nil,
+		[3][]interface{}{nil, nil, {struct {
+			User func(context.Context) <-chan string
+		}{user}}},
+		handler.WebSocketContext(func(ctx context.Context, r *http.Request) (context.Context, error) {
+			name := r.Header.Get("X-User")
+			if name == "" {
+				return nil, errors.New("no user")
+			}
+			return context.WithValue(ctx, userKey{}, name), nil
+		}),
+	)
+	server := httptest.NewServer(h)
+	defer server.Close()
+	url := strings.Replace(server.URL, "http://", "ws://", -1)
+
+	// No user header so the upgrade should be rejected
+	header := http.Header{"Sec-WebSocket-Protocol": {"graphql-transport-ws"}}
+	_, resp, err := websocket.DefaultDialer.Dial(url, header)
+	Assertf(t, err != nil && resp != nil && resp.StatusCode == http.StatusUnauthorized,
+		"Expected status 401 and got %v (error %v)", resp, err)
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	header.Set("X-User", "bob")
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Expected no Dial error, got %v", err)
+	}
+	defer conn.Close()
+	for _, message := range []string{
+		`{"type": "connection_init"}`,
+		`{"type":"subscribe","id":"ID-1","payload":{"query":"subscription {user}"}}`,
+	} {
+		Assertf(t, conn.WriteMessage(websocket.TextMessage, []byte(message)) == nil, "Error writing %s", message)
+	}
+	for _, expected := range []string{`"connection_ack"`, `{"user":"bob"}`, `{"user":"bob"}`} {
+		_, p, err := conn.ReadMessage()
+		Assertf(t, err == nil && strings.Contains(string(p), expected), "Expected %s and got %s (error %v)",
+			expected, p, err)
+	}
+}
+
+// TestSubprotocols checks which websocket sub-protocol is used depending on what the client offers and the
+// Subprotocols and RequireSubprotocol options
+func TestSubprotocols(t *testing.T) {
+	subprotocolsData := map[string]struct {
+		options  []func(*handler.Handler)
+		offered  []string // sub-protocols offered by the client
+		status   int      // expected HTTP status if the upgrade is rejected
+		expected string   // second message received (after connection_ack) which depends on the protocol used
+	}{
+		"DefaultNone":    {expected: `"ka"`},
+		"DefaultOld":     {offered: []string{"graphql-ws"}, expected: `"ka"`},
+		"DefaultNew":     {offered: []string{"graphql-transport-ws"}, expected: `"pong"`},
+		"DefaultBoth":    {offered: []string{"graphql-transport-ws", "graphql-ws"}, expected: `"ka"`},
+		"DefaultUnknown": {offered: []string{"unknown"}, expected: `"ka"`},
+		"NewOnlyNone": {
+			options:  []func(*handler.Handler){handler.Subprotocols("graphql-transport-ws")},
+			expected: `"pong"`,
+		},
+		"NewOnlyOld": {
+			options:  []func(*handler.Handler){handler.Subprotocols("graphql-transport-ws")},
+			offered:  []string{"graphql-ws"},
+			expected: `"pong"`,
+		},
+		"NewFirstBoth": {
+			options:  []func(*handler.Handler){handler.Subprotocols("graphql-transport-ws", "graphql-ws")},
+			offered:  []string{"graphql-ws", "graphql-transport-ws"},
+			expected: `"pong"`,
+		},
+		"NewFirstOld": {
+			options:  []func(*handler.Handler){handler.Subprotocols("graphql-transport-ws", "graphql-ws")},
+			offered:  []string{"graphql-ws"},
+			expected: `"ka"`,
+		},
+		"OldOnlyRequired": {
+			options: []func(*handler.Handler){handler.Subprotocols("graphql-ws"), handler.RequireSubprotocol(true)},
+			offered: []string{"graphql-transport-ws"},
+			status:  http.StatusBadRequest,
+		},
+		"RequiredNone": {
+			options: []func(*handler.Handler){handler.RequireSubprotocol(true)},
+			status:  http.StatusBadRequest,
+		},
+		"RequiredNew": {
+			options:  []func(*handler.Handler){handler.RequireSubprotocol(true)},
+			offered:  []string{"graphql-transport-ws"},
+			expected: `"pong"`,
+		},
+	}
+
+	for name, testData := range subprotocolsData {
+		t.Run(name, func(t *testing.T) {
+			h := handler.New(
+				[]string{"type Subscription{ v: Int! }"},
+				nil,
+				[3][]interface{}{nil, nil, {struct{ V <-chan int }{}}},
+				testData.options...,
+			)
+			server := httptest.NewServer(h)
+			defer server.Close()
+			url := strings.Replace(server.URL, "http://", "ws://", -1)
+
+			dialer := *websocket.DefaultDialer
+			dialer.Subprotocols = testData.offered
+			conn, resp, err := dialer.Dial(url, nil)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if testData.status != 0 {
+				Assertf(t, err != nil && resp != nil && resp.StatusCode == testData.status,
+					"Expected status %d and got %v (error %v)", testData.status, resp, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no Dial error, got %v", err)
+			}
+			defer conn.Close()
+			for _, message := range []string{`{"type": "connection_init"}`, `{"type": "ping"}`} {
+				Assertf(t, conn.WriteMessage(websocket.TextMessage, []byte(message)) == nil, "Error writing %s", message)
+			}
+			for _, expected := range []string{`"connection_ack"`, testData.expected} {
+				_, p, err := conn.ReadMessage()
+				Assertf(t, err == nil && strings.Contains(string(p), expected), "Expected %s and got %s (error %v)",
+					expected, p, err)
+			}
+		})
+	}
+}
+
+// TestContextFunc checks that values can be added to the context from the HTTP request, for queries and
+// websockets, and from the payload of the connection_init message of a websocket
+func TestContextFunc(t *testing.T) {
+	userName := func(ctx context.Context) string {
+		name, _ := ctx.Value(userKey{}).(string)
+		return name
+	}
+	h := handler.New(
+		[]string{"type Query{ user: String! } type Subscription{ user: String! }"},
+		nil,
+		[3][]interface{}{{struct {
+			User func(context.Context) string
+		}{userName}}, nil, {struct {
+			User func(context.Context) <-chan string
+		}{func(ctx context.Context) <-chan string {
+			ch := make(chan string, 1)
+			ch <- userName(ctx)
+			close(ch)
+			return ch
+		}}}},
+		handler.ContextFunc(func(ctx context.Context, r *http.Request) (context.Context, error) {
+			switch name := r.Header.Get("X-User"); name {
+			case "":
+				return ctx, nil
+			case "nobody":
+				return nil, errors.New("unknown user")
+			default:
+				return context.WithValue(ctx, userKey{}, name), nil
+			}
+		}),
+		handler.InitContext(func(ctx context.Context, payload map[string]interface{}) (context.Context, error) {
+			token, ok := payload["token"].(string)
+			if !ok {
+				return ctx, nil
+			}
+			if token == "bad" {
+				return nil, errors.New("invalid token")
+			}
+			return context.WithValue(ctx, userKey{}, token), nil
+		}),
+	)
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	// HTTP requests
+	for user, expected := range map[string]string{"bob": `{"data":{"user":"bob"}}`, "nobody": `unknown user`} {
+		request, _ := http.NewRequest("POST", server.URL, strings.NewReader(`{"query":"{ user }"}`))
+		request.Header.Set("X-User", user)
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		Assertf(t, strings.Contains(string(body), expected), "Expected %s and got %s", expected, body)
+	}
+
+	// Websockets
+	url := strings.Replace(server.URL, "http://", "ws://", -1)
+	wsData := map[string]struct {
+		user, init string
+		expected   []string
+	}{
+		"Header":     {"alice", `{"type":"connection_init"}`, []string{`"connection_ack"`, `{"user":"alice"}`}},
+		"Payload":    {"alice", `{"type":"connection_init","payload":{"token":"carol"}}`, []string{`"connection_ack"`, `{"user":"carol"}`}},
+		"BadPayload": {"", `{"type":"connection_init","payload":{"token":"bad"}}`, []string{`Forbidden: invalid token`}},
+	}
+	for name, testData := range wsData {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{"Sec-WebSocket-Protocol": {"graphql-transport-ws"}, "X-User": {testData.user}}
+			conn, _, err := websocket.DefaultDialer.Dial(url, header)
+			if err != nil {
+				t.Fatalf("Expected no Dial error, got %v", err)
+			}
+			defer conn.Close()
+			for _, message := range []string{
+				testData.init,
+				`{"type":"subscribe","id":"ID-1","payload":{"query":"subscription {user}"}}`,
+			} {
+				Assertf(t, conn.WriteMessage(websocket.TextMessage, []byte(message)) == nil, "Error writing %s", message)
+			}
+			for _, expected := range testData.expected {
+				_, p, err := conn.ReadMessage()
+				if err != nil {
+					p = []byte(err.Error()) // close message
+				}
+				Assertf(t, strings.Contains(string(p), expected), "Expected %s and got %s", expected, p)
+			}
+		})
+	}
+}
+
+// TestWebTransport checks that the protocol messages can be sent as lines of JSON on a (WebTransport) stream
+func TestWebTransport(t *testing.T) {
+	count := func(ctx context.Context) <-chan int {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 1; i <= 2; i++ {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- i:
+				}
+			}
+		}()
+		return ch
+	}
+	h := handler.New(
+		[]string{"type Subscription{ count: Int! }"},
+		nil,
+		[3][]interface{}{nil, nil, {struct {
+			Count func(context.Context) <-chan int
+		}{count}}},
+	).(*handler.Handler)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan error)
+	go func() { done <- h.ServeWebTransport(httptest.NewRequest("CONNECT", "/", nil), server) }()
+
+	reader := bufio.NewReader(client)
+	_ = client.SetDeadline(time.Now().Add(time.Second))
+	for _, message := range []string{
+		`{"type": "connection_init"}`,
+		`{"type":"subscribe","id":"ID-1","payload":{"query":"subscription {count}"}}`,
+	} {
+		_, err := client.Write([]byte(message + "\n"))
+		Assertf(t, err == nil, "Error writing %s: %v", message, err)
+		if strings.Contains(message, "connection_init") {
+			line, err := reader.ReadString('\n')
+			Assertf(t, err == nil && strings.Contains(line, `"connection_ack"`), "Expected ack and got %s (error %v)",
+				line, err)
+		}
+	}
+	for _, expected := range []string{`{"count":1}`, `{"count":2}`, `"type":"complete","id":"ID-1"`} {
+		line, err := reader.ReadString('\n')
+		Assertf(t, err == nil && strings.Contains(line, expected), "Expected %s and got %s (error %v)",
+			expected, line, err)
+	}
+
+	// An unexpected message type closes the connection (with a "close" message instead of a WS close message)
+	_, _ = client.Write([]byte(`{"type":"start","id":"ID-2"}` + "\n"))
+	var line string
+	var err error
+	for err == nil && !strings.Contains(line, `"type":"close"`) {
+		line, err = reader.ReadString('\n')
+	}
+	Assertf(t, err == nil && strings.Contains(line, `"code":4400`), "Expected close 4400 and got %s (error %v)",
+		line, err)
+	select {
+	case err = <-done:
+		Assertf(t, err == nil, "Expected no error from ServeWebTransport, got %v", err)
+	case <-time.After(time.Second):
+		Assertf(t, false, "Expected ServeWebTransport to return after the stream was closed")
+	}
+}
+
+// TestMessageSize checks that a websocket or WebTransport message larger than the limit closes the connection
+func TestMessageSize(t *testing.T) {
+	h := handler.New(
+		[]string{"type Query{ a: Int! }"},
+		nil,
+		[3][]interface{}{{struct{ A int }{42}}, nil, nil},
+		handler.MaxRequestSize(100),
+	).(*handler.Handler)
+	big := `{"type":"subscribe","id":"ID-1","payload":{"query":"{ a` + strings.Repeat(" ", 100) + `}"}}`
+
+	// Websocket
+	server := httptest.NewServer(h)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http://", "ws://", -1),
+		http.Header{"Sec-WebSocket-Protocol": {"graphql-transport-ws"}})
+	if err != nil {
+		t.Fatalf("Expected no Dial error, got %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "connection_init"}`))
+	_, p, err := conn.ReadMessage()
+	Assertf(t, err == nil && strings.Contains(string(p), "connection_ack"), "Expected ack and got %s (error %v)", p, err)
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(big))
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	Assertf(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "Expected close 1009 and got error %v", err)
+
+	// WebTransport stream
+	client, stream := net.Pipe()
+	defer client.Close()
+	go func() { _ = h.ServeWebTransport(httptest.NewRequest("CONNECT", "/", nil), stream) }()
+	reader := bufio.NewReader(client)
+	_ = client.SetDeadline(time.Now().Add(time.Second))
+	_, _ = client.Write([]byte(`{"type": "connection_init"}` + "\n"))
+	line, err := reader.ReadString('\n')
+	Assertf(t, err == nil && strings.Contains(line, `"connection_ack"`), "Expected ack and got %s (error %v)", line, err)
+	_, _ = client.Write([]byte(big + "\n"))
+	for err == nil && !strings.Contains(line, `"type":"close"`) {
+		line, err = reader.ReadString('\n')
+	}
+	Assertf(t, err == nil && strings.Contains(line, `"code":1009`), "Expected close 1009 and got %s (error %v)",
+		line, err)
+}
+
+// TestSubscriptionCache checks that a subscription does not use resolver values cached by an earlier subscription
+func TestSubscriptionCache(t *testing.T) {
+	var calls int32
+	count := func(ctx context.Context) <-chan int32 {
+		ch := make(chan int32, 1)
+		ch <- atomic.AddInt32(&calls, 1)
+		close(ch)
+		return ch
+	}
+	h := handler.New(
+		[]string{"type Subscription{ count: Int! }"},
+		nil,
+		[3][]interface{}{nil, nil, {struct {
+			Count func(context.Context) <-chan int32
+		}{count}}},
+		handler.FuncCache(true),
+	)
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"ID-1","payload":{"query":"subscription {count}"}}`},
+		{actionRecv, `{"count":1}`},
+		{actionRecv, `"type":"complete","id":"ID-1"`},
+		{actionSend, `{"type":"subscribe","id":"ID-2","payload":{"query":"subscription {count}"}}`},
+		{actionRecv, `{"count":2}`},
+	})
+}
+
+type (
+	eventPost struct {
+		ID     int `egg:"id"`
+		Title  string
+		Tag    int `egg:":Tag"`
+		Author func(context.Context) eventAuthor
+	}
+	eventAuthor struct{ Name string }
+)
+
+// TestSubscriptionEvents checks that the selection set of a subscription (including aliases, nested fields and
+// directives) is applied to each value received from the subscription channel
+func TestSubscriptionEvents(t *testing.T) {
+	posts := func(ctx context.Context) <-chan eventPost {
+		ch := make(chan eventPost)
+		go func() {
+			defer close(ch)
+			for i, title := range []string{"first", "second"} {
+				title := title // used in the Author closure, which is called after the loop has moved on
+				post := eventPost{ID: i + 1, Title: title, Tag: i, Author: func(context.Context) eventAuthor {
+					return eventAuthor{Name: "author of " + title}
+				}}
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- post:
+				}
+			}
+		}()
+		return ch
+	}
+	h := handler.New(
+		[]string{`type Subscription{ postAdded: Post! }
+			type Post{ id: Int! title: String! tag: Tag! author: Author! }
+			type Author{ name: String! }
+			enum Tag{ NEWS SPORT }`},
+		map[string][]string{"Tag": {"NEWS", "SPORT"}},
+		[3][]interface{}{nil, nil, {struct {
+			PostAdded func(context.Context) <-chan eventPost
+		}{posts}}},
+	)
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"ID-1","payload":{"query":` +
+			`"subscription { p: postAdded { title id @skip(if: true) tag author { name } } }"}}`},
+		{actionRecv, `{"data":{"p":{"title":"first","tag":"NEWS","author":{"name":"author of first"}}}}`},
+		{actionRecv, `{"data":{"p":{"title":"second","tag":"SPORT","author":{"name":"author of second"}}}}`},
+		{actionRecv, `"type":"complete","id":"ID-1"`},
+	})
+}
+
+type (
+	errorPost struct {
+		ID       int                                             `egg:"id"`
+		Author   func(context.Context, int) (eventAuthor, error) `egg:"(maxLen)"`
+		Comments []errorComment                                  `egg:",nullable"`
+	}
+	errorComment struct{ Text func() (string, error) }
+)
+
+// TestSubscriptionEventErrors checks that errors resolving an event (including in nested resolvers that take
+// arguments and in list elements) are sent with the event, with the same details as errors of a query, and that the subscription continues with the next event
+func TestSubscriptionEventErrors(t *testing.T) {
+	text := func(s string) func() (string, error) { return func() (string, error) { return s, nil } }
+	fail := func() (string, error) { return "", &handler.Error{Message: "no comment", Code: "MISSING"} }
+	author := func(name string) func(context.Context, int) (eventAuthor, error) {
+		return func(ctx context.Context, maxLen int) (eventAuthor, error) {
+			if len(name) > maxLen {
+				return eventAuthor{}, errors.New("name too long")
+			}
+			return eventAuthor{Name: name}, ctx.Err()
+		}
+	}
+	posts := func(ctx context.Context) <-chan errorPost {
+		ch := make(chan errorPost)
+		go func() {
+			defer close(ch)
+			for _, post := range []errorPost{
+				{ID: 1, Author: author("bob"), Comments: []errorComment{{text("a")}, {fail}, {text("c")}}},
+				{ID: 2, Author: author("a very long name")},
+				{ID: 3, Author: author("ann")},
+			} {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- post:
+				}
+			}
+		}()
+		return ch
+	}
+	h := handler.New(
+		[]string{`type Subscription{ postAdded: Post }
+			type Post{ id: Int! author(maxLen: Int!): Author! comments: [Comment] }
+			type Author{ name: String! }
+			type Comment{ text: String! }`},
+		nil,
+		[3][]interface{}{nil, nil, {struct {
+			PostAdded func(context.Context) <-chan errorPost
+		}{posts}}},
+	)
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"ID-1","payload":{"query":` +
+			`"subscription { p: postAdded { id author(maxLen: 5) { name } comments { text } } }"}}`},
+		{actionRecv, `{"data":{"p":{"id":1,"author":{"name":"bob"},"comments":[{"text":"a"},null,{"text":"c"}]}},` +
+			`"errors":[{"message":"no comment","path":["p","comments",1,"text"],` +
+			`"extensions":{"code":"MISSING","operation":""}}]}`},
+		{actionRecv, `{"data":{"p":null},"errors":[{"message":"name too long","path":["p","author"],` +
+			`"extensions":{"operation":""}}]}`},
+		{actionRecv, `{"data":{"p":{"id":3,"author":{"name":"ann"},"comments":null}}}`},
+		{actionRecv, `"type":"complete","id":"ID-1"`},
+	})
+}
+
+// TestWebSocketQuery checks that queries and mutations sent on a websocket (graphql-transport-ws) get a single
+// result then "complete", including the use of variables and operationName to select the operation
+func TestWebSocketQuery(t *testing.T) {
+	counter := 0
+	h := handler.New(
+		[]string{`type Query{ double(n: Int!): Int! counter: Int! } type Mutation{ increment(by: Int! = 1): Int! }`},
+		nil,
+		[3][]interface{}{
+			{struct {
+				Double  func(int) int `egg:"(n)"`
+				Counter func() int
+			}{func(n int) int { return 2 * n }, func() int { return counter }}},
+			{struct {
+				Increment func(int) int `egg:"(by=1)"`
+			}{func(by int) int { counter += by; return counter }}},
+		},
+	)
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"Q1","payload":{"query":"{ d: double(n: 21) }"}}`},
+		{actionRecv, `{"type":"next","id":"Q1","payload":{"data":{"d":42}}}`},
+		{actionRecv, `{"type":"complete","id":"Q1"}`},
+		{actionSend, `{"type":"subscribe","id":"Q1","payload":{"query":` + // ID can be reused once complete
+			`"query Double($n: Int!) { double(n: $n) }","variables":{"n":5}}}`},
+		{actionRecv, `{"type":"next","id":"Q1","payload":{"data":{"double":10}}}`},
+		{actionRecv, `{"type":"complete","id":"Q1"}`},
+		{actionSend, `{"type":"subscribe","id":"M1","payload":{"operationName":"Inc","query":` +
+			`"query Count { counter } mutation Inc($by: Int!) { increment(by: $by) }","variables":{"by":3}}}`},
+		{actionRecv, `{"type":"next","id":"M1","payload":{"data":{"increment":3}}}`},
+		{actionRecv, `{"type":"complete","id":"M1"}`},
+		{actionSend, `{"type":"subscribe","id":"Q2","payload":{"operationName":"Count","query":` +
+			`"query Count { counter } mutation Inc($by: Int!) { increment(by: $by) }"}}`},
+		{actionRecv, `{"type":"next","id":"Q2","payload":{"data":{"counter":3}}}`},
+		{actionRecv, `{"type":"complete","id":"Q2"}`},
+		{actionSend, `{"type":"subscribe","id":"Q3","payload":{"query":"query { double(n: $n) }"}}`},
+		{actionRecv, `{"type":"error","id":"Q3"`},
+	})
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"Q1","payload":{"query":"query A { counter } query B { counter }"}}`},
+		{actionRecv, `"message":"Must provide operation name if query contains multiple operations."`},
+	})
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"Q1","payload":{"operationName":"C","query":"query A { counter }"}}`},
+		{actionRecv, `"message":"Unknown operation named \"C\"."`},
+	})
+}
+
+// TestWebSocketConcurrent checks that operations on the same websocket run concurrently, so that a slow query does
+// not hold up other operations, and that a query can be stopped (with "complete") while it runs
+func TestWebSocketConcurrent(t *testing.T) {
+	h := handler.New([]string{`type Query{ slow: String! fast: String! }`}, nil,
+		[3][]interface{}{{struct {
+			Slow func(context.Context) string
+			Fast string
+		}{func(ctx context.Context) string { <-ctx.Done(); return "slow" }, "fast"}}, nil, nil},
+	)
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"S1","payload":{"query":"{ slow }"}}`},
+		{actionSend, `{"type":"subscribe","id":"F1","payload":{"query":"{ fast }"}}`},
+		{actionRecv, `{"type":"next","id":"F1","payload":{"data":{"fast":"fast"}}}`},
+		{actionRecv, `{"type":"complete","id":"F1"}`},
+		{actionSend, `{"type":"complete","id":"S1"}`}, // stops the slow query
+		{actionSend, `{"type":"ping"}`},
+		{actionRecv, `"type":"pong"`},
+	})
+}
+
+// TestSubscriptionAlias checks that the data of a subscription message uses the alias (if any) of the field
+func TestSubscriptionAlias(t *testing.T) {
+	h := handler.New([]string{"type Subscription{ count: Int! }"}, nil,
+		[3][]interface{}{nil, nil, {struct {
+			Count func() <-chan int
+		}{func() <-chan int {
+			ch := make(chan int, 1)
+			ch <- 42
+			close(ch)
+			return ch
+		}}}},
+	)
+	runActions(t, h, []wsAction{
+		{actionSend, `{"type": "connection_init"}`},
+		{actionRecv, `"connection_ack"`},
+		{actionSend, `{"type":"subscribe","id":"ID-1","payload":{"query":"subscription { n: count }"}}`},
+		{actionRecv, `{"data":{"n":42}}`},
+		{actionRecv, `"type":"complete","id":"ID-1"`},
+	})
+}
+
+// runActions connects to a websocket server using handler h then sends/receives the messages of the actions
+// Note that received messages that do not match (eg a repeated "complete") are skipped.
+func runActions(t *testing.T, h http.Handler, actions []wsAction) {
+	t.Helper()
+	server := httptest.NewServer(h)
+	defer server.Close()
+	url := strings.Replace(server.URL, "http://", "ws://", -1)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Sec-WebSocket-Protocol": {"graphql-transport-ws"}})
+	if err != nil {
+		t.Fatalf("Expected no Dial error, got %v", err)
+	}
+	defer conn.Close()
+	for _, action := range actions {
+		if action.action == actionSend {
+			Assertf(t, conn.WriteMessage(websocket.TextMessage, []byte(action.data.(string))) == nil,
+				"Error writing %s", action.data)
+			continue
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		var p []byte
+		for err == nil && !strings.Contains(string(p), action.data.(string)) {
+			_, p, err = conn.ReadMessage()
+		}
+		Assertf(t, err == nil, "Expected %s and got error %v", action.data, err)
+	}
+}
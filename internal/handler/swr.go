@@ -0,0 +1,133 @@
+package handler
+
+// swr.go implements stale-while-revalidate caching of resolver values (see the "cache" tag option, eg
+// `egg:",cache=swr:30s,max:5m"`).  A cached value is used as normal until it is older than the stale time, after
+// which it is still used but a refreshed value is obtained in the background (by calling the resolver again).
+// A value older than the max age (if any) is not used, so the resolver is called while the client waits (unless the
+// value is already being refreshed in which case the client waits for that).  Only one refresh of a value is done at
+// a time.  If a refresh fails (returns an error or panics) the stale value is kept and a RefreshError is passed to
+// the observer (see Observer option).
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// swrCache records when the values of a resolver cache were saved, for stale-while-revalidate caching.
+// Note that the maps are protected by the mutex of the ResolverCache.
+type swrCache struct {
+	stale, maxAge time.Duration
+	saved         map[CacheKey]time.Time     // when each value was saved
+	refreshing    map[CacheKey]chan struct{} // values being refreshed in the background (closed when done)
+}
+
+// newSWRCache returns a stale-while-revalidate cache for a resolver or nil if it does not have the "cache" option
+func newSWRCache(fieldInfo *field.Info) *swrCache {
+	if fieldInfo.CacheStale <= 0 {
+		return nil
+	}
+	return &swrCache{
+		stale:      fieldInfo.CacheStale,
+		maxAge:     fieldInfo.CacheMaxAge,
+		saved:      make(map[CacheKey]time.Time),
+		refreshing: make(map[CacheKey]chan struct{}),
+	}
+}
+
+// scoped returns an empty cache with the same settings, for an operation's own (scoped) caches
+func (sc *swrCache) scoped() *swrCache {
+	if sc == nil {
+		return nil
+	}
+	return &swrCache{stale: sc.stale, maxAge: sc.maxAge, saved: make(map[CacheKey]time.Time),
+		refreshing: make(map[CacheKey]chan struct{})}
+}
+
+// save records (with the cache's mutex locked) that a value has been saved in the cache - it does nothing if sc
+// is nil (ie the resolver does not use stale-while-revalidate)
+func (sc *swrCache) save(key CacheKey) {
+	if sc != nil {
+		sc.saved[key] = time.Now()
+	}
+}
+
+// check is called (with the cache's mutex locked) when a value is found in the cache.  It returns false if the
+// value is too old to use, and refresh is true if the value is stale so should be refreshed in the background
+// (unless it is already being refreshed).  If the value is too old to use but is being refreshed then wait is
+// closed when the refresh is done.
+func (sc *swrCache) check(key CacheKey) (ok, refresh bool, wait <-chan struct{}) {
+	age := time.Since(sc.saved[key])
+	if sc.maxAge > 0 && age > sc.maxAge {
+		return false, false, sc.refreshing[key]
+	}
+	if age <= sc.stale || sc.refreshing[key] != nil {
+		return true, false, nil
+	}
+	sc.refreshing[key] = make(chan struct{})
+	return true, true, nil
+}
+
+// waitRefresh waits for the background refresh of a value, that is too old to use, to finish.  It returns the
+// refreshed value or false if the refresh failed (or the context is done).
+func (cache ResolverCache) waitRefresh(ctx context.Context, key CacheKey, wait <-chan struct{}) (reflect.Value, bool) {
+	select {
+	case <-wait:
+	case <-ctx.Done():
+		return reflect.Value{}, false
+	}
+	cache.Mtx.Lock()
+	defer cache.Mtx.Unlock()
+	result, ok := cache.Saved[key]
+	if ok {
+		ok = cache.check(key)
+	}
+	if ok {
+		ok, _, _ = cache.swr.check(key)
+	}
+	return result, ok
+}
+
+// RefreshError is passed to the observer (see Observer option) when the resolver called to refresh a stale
+// cached value (see the "cache=swr:..." tag option) returns an error or panics.  The stale value is kept.
+type RefreshError struct {
+	Field string // GraphQL type and field name, eg "Query.search"
+	Err   error
+}
+
+// refresh calls a resolver in the background to replace a stale value in the cache.  The resolver is called
+// with a context that is not cancelled when the current request ends (but has the same values).
+func (op *gqlOperation) refresh(ctx context.Context, astField *ast.Field, v, vID reflect.Value,
+	fieldInfo *field.Info, cache ResolverCache, key CacheKey,
+) {
+	refreshOp := *op
+	refreshOp.arena = nil // the refreshed value is saved in the cache so must not use the arena
+	refreshOp.cacheCounts = nil
+	refreshOp.rateLimits = nil
+	refreshOp.elementErrors = &elementErrors{}
+	ctx = connectionContext{values: ctx}
+
+	go func() {
+		var value *gqlValue
+		defer func() {
+			if recoverValue := recover(); recoverValue != nil {
+				value = &gqlValue{err: fmt.Errorf("Internal error: panic %v", recoverValue)}
+			}
+			cache.Mtx.Lock()
+			if value != nil && value.err == nil && value.value != nil {
+				cache.save(key, reflect.ValueOf(value.value))
+			}
+			close(cache.swr.refreshing[key])
+			delete(cache.swr.refreshing, key)
+			cache.Mtx.Unlock()
+			if value != nil && value.err != nil {
+				op.observe(RefreshError{Field: fieldKey(astField), Err: value.err}) // the stale value is kept
+			}
+		}()
+		value = refreshOp.resolve(ctx, astField, v, vID, fieldInfo, ResolverCache{})
+	}()
+}
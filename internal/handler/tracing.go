@@ -0,0 +1,114 @@
+package handler
+
+// tracing.go records the timing of the parsing, validation and resolvers of a request which is returned in the
+// "tracing" extension of the response in the Apollo Tracing format (see Tracing option), so that tools such as
+// GraphQL Playground can show how long each part of the query took.
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// tracingExtension is the name of the response extension with the timings (Apollo Tracing format)
+const tracingExtension = "tracing"
+
+type (
+	// tracer records the timing of a request (see Tracing option)
+	tracer struct {
+		start      time.Time
+		parsing    tracingSpan
+		validation tracingSpan
+
+		mtx       sync.Mutex // protects resolvers (resolvers run concurrently)
+		resolvers []tracingResolver
+	}
+
+	// tracingSpan is when something started (nanoseconds since the start of the request) and how long it took
+	tracingSpan struct {
+		StartOffset int64 `json:"startOffset"`
+		Duration    int64 `json:"duration"`
+	}
+
+	// tracingResolver is the timing of the resolving of a field
+	tracingResolver struct {
+		Path       ast.Path `json:"path"`
+		ParentType string   `json:"parentType"`
+		FieldName  string   `json:"fieldName"`
+		ReturnType string   `json:"returnType"`
+		tracingSpan
+	}
+)
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now(), resolvers: []tracingResolver{}}
+}
+
+// span returns the span from start until now
+func (t *tracer) span(start time.Time) tracingSpan {
+	return tracingSpan{StartOffset: start.Sub(t.start).Nanoseconds(), Duration: time.Since(start).Nanoseconds()}
+}
+
+// loadQuery parses and validates a query (like Handler.loadQuery) recording how long each took
+func (t *tracer) loadQuery(h *Handler, query string) (*ast.QueryDocument, gqlerror.List) {
+	if t == nil {
+		return h.loadQuery(query)
+	}
+	start := time.Now()
+	doc, errs := h.parseQuery(query)
+	t.parsing = t.span(start)
+	if errs != nil {
+		return nil, errs
+	}
+	start = time.Now()
+	errs = h.validateQuery(doc)
+	t.validation = t.span(start)
+	if errs != nil {
+		return nil, errs
+	}
+	return doc, nil
+}
+
+// resolver records how long a field took to resolve (including its sub-fields) since start
+func (t *tracer) resolver(ctx context.Context, astField *ast.Field, start time.Time) {
+	r := tracingResolver{
+		Path:        getPath(fieldPath(ctx, astField)),
+		FieldName:   astField.Name,
+		tracingSpan: t.span(start),
+	}
+	if astField.ObjectDefinition != nil {
+		r.ParentType = astField.ObjectDefinition.Name
+	}
+	if astField.Definition != nil {
+		r.ReturnType = astField.Definition.Type.String()
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.resolvers = append(t.resolvers, r)
+}
+
+// traced returns true if the resolving of a field is to be traced (introspection fields are not)
+func (t *tracer) traced(astField *ast.Field) bool {
+	return t != nil && !strings.HasPrefix(astField.Name, "__") &&
+		(astField.ObjectDefinition == nil || !strings.HasPrefix(astField.ObjectDefinition.Name, "__"))
+}
+
+// extension returns the tracing response extension (Apollo Tracing format)
+func (t *tracer) extension() map[string]interface{} {
+	end := time.Now()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return map[string]interface{}{
+		"version":    1,
+		"startTime":  t.start.UTC().Format(time.RFC3339Nano),
+		"endTime":    end.UTC().Format(time.RFC3339Nano),
+		"duration":   end.Sub(t.start).Nanoseconds(),
+		"parsing":    t.parsing,
+		"validation": t.validation,
+		"execution":  map[string]interface{}{"resolvers": t.resolvers},
+	}
+}
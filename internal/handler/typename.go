@@ -0,0 +1,46 @@
+package handler
+
+// typename.go adds the __typename field to objects in the response when it was not requested (see AddTypename)
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// typenameValue returns the __typename of an object, or false if it is not to be added because it was
+// already requested, or the object is the root query/mutation or an introspection type
+func (op *gqlOperation) typenameValue(ctx context.Context, set ast.SelectionSet, fields []*ast.Field,
+	values []reflect.Value,
+) (gqlValue, bool) {
+	if len(values) == 0 || ctx.Value(pathKey{}) == nil {
+		return gqlValue{}, false // no object or root object
+	}
+	for _, f := range fields {
+		if f.Alias == "__typename" {
+			return gqlValue{}, false
+		}
+	}
+	definition := selectionDefinition(set)
+	if definition == nil || strings.HasPrefix(definition.Name, "__") {
+		return gqlValue{}, false
+	}
+	return gqlValue{name: "__typename", value: concreteTypeName(definition, values[0])}, true
+}
+
+// selectionDefinition returns the definition of the type (in the schema) that a selection set is selected from
+func selectionDefinition(set ast.SelectionSet) *ast.Definition {
+	for _, s := range set {
+		switch s := s.(type) {
+		case *ast.Field:
+			return s.ObjectDefinition
+		case *ast.InlineFragment:
+			return s.ObjectDefinition
+		case *ast.FragmentSpread:
+			return s.ObjectDefinition
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package handler
+
+// webtransport.go allows the protocol messages normally sent on a websocket to be sent on a WebTransport (HTTP/3)
+// stream instead, for clients in environments where websockets are blocked.  This is experimental, and only adapts
+// a stream - the WebTransport session (and HTTP/3 server) must be provided by another package.  The messages
+// are the same as for the graphql-transport-ws sub-protocol, but as there is no framing in a stream each message
+// is a line of JSON (ie ends with a newline).  When the server closes the connection, instead of a websocket close
+// message it sends a message like {"type":"close","code":4400,"reason":"..."} and then closes the stream.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type (
+	// TransportStream is a bidirectional stream of a WebTransport session, such as a *webtransport.Stream
+	// (see github.com/quic-go/webtransport-go) returned from the session's AcceptStream method
+	TransportStream interface {
+		io.ReadWriteCloser
+		SetReadDeadline(t time.Time) error
+	}
+
+	// streamConn implements msgConn by sending protocol messages as lines of JSON on a TransportStream
+	streamConn struct {
+		stream    TransportStream
+		reader    *bufio.Reader
+		limit     int64 // max. length of a message (see MaxRequestSize)
+		closeOnce sync.Once
+	}
+
+	// closeMessage is sent instead of a websocket close control message
+	closeMessage struct {
+		Type   string `json:"type"`
+		Code   int    `json:"code"`
+		Reason string `json:"reason,omitempty"`
+	}
+)
+
+// ServeWebTransport handles the GraphQL protocol messages received on a WebTransport stream, returning when the
+// client closes the stream or the server closes it (eg due to a protocol error).  The request r is the one used
+// to establish the WebTransport session - it is passed to the ContextFunc and WebSocketContext functions (if any)
+// and used to identify the client for rate limits.  Only the graphql-transport-ws sub-protocol is supported.
+func (h *Handler) ServeWebTransport(r *http.Request, stream TransportStream) error {
+	if h.contextFunc != nil {
+		ctx, err := h.contextFunc(r.Context(), r)
+		if err != nil {
+			_ = stream.Close()
+			return err
+		}
+		r = r.WithContext(ctx)
+	}
+	ctx := context.Context(connectionContext{values: r.Context()})
+	if h.wsContext != nil {
+		var err error
+		if ctx, err = h.wsContext(ctx, r); err != nil {
+			_ = stream.Close()
+			return err
+		}
+	}
+	conn := &streamConn{stream: stream, reader: bufio.NewReader(stream), limit: h.maxRequestSize}
+	h.serveConn(ctx, conn, true, h.rateLimitKey(r))
+	return nil
+}
+
+// NextReader returns a reader for the next message (line) received on the stream.  Like a websocket, it returns
+// websocket.ErrReadLimit if the message is longer than the limit (without reading the rest of the message).
+func (s *streamConn) NextReader() (int, io.Reader, error) {
+	var line []byte
+	for {
+		chunk, err := s.reader.ReadSlice('\n')
+		if s.limit > 0 && int64(len(line)+len(chunk)) > s.limit {
+			return 0, nil, websocket.ErrReadLimit
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			if err != nil {
+				return 0, nil, err // includes io.EOF for an incomplete last line
+			}
+			return websocket.TextMessage, bytes.NewReader(line), nil
+		}
+	}
+}
+
+// WriteJSON sends a message on the stream - json.Marshal never generates a newline so it terminates the message
+func (s *streamConn) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.stream.Write(append(b, '\n'))
+	return err
+}
+
+// WriteMessage is only used to send a websocket close message, which is converted to a "close" message
+func (s *streamConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.CloseMessage {
+		_, err := s.stream.Write(append(data, '\n'))
+		return err
+	}
+	msg := closeMessage{Type: "close", Code: websocket.CloseNoStatusReceived}
+	if len(data) >= 2 {
+		msg.Code, msg.Reason = int(binary.BigEndian.Uint16(data)), string(data[2:])
+	}
+	return s.WriteJSON(msg)
+}
+
+// SetReadDeadline sets the deadline for receiving the next message (zero time for no deadline)
+func (s *streamConn) SetReadDeadline(t time.Time) error {
+	return s.stream.SetReadDeadline(t)
+}
+
+// Close closes the stream - it can be called more than once
+func (s *streamConn) Close() (err error) {
+	s.closeOnce.Do(func() { err = s.stream.Close() })
+	return err
+}
@@ -0,0 +1,90 @@
+package handler
+
+// wildcard.go handles resolvers with the "wildcard" option, which resolve fields that are declared in the schema
+// (eg added in SDL using the ExtendSchema option) but that have no corresponding Go field.  This allows code-first
+// (Go) and schema-first (SDL) resolvers to be combined.
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// wildcardName is the key of a wildcard resolver in the resolver lookup table of a struct - it is not a valid
+// GraphQL name, so cannot be confused with the name of a field
+const wildcardName = "*"
+
+// findWildcard writes the resolved value of a field to slot i using the wildcard resolver of the first struct (in
+// data) that has one, or returns false if none of them has a wildcard resolver
+func (op *gqlOperation) findWildcard(ctx context.Context, astField *ast.Field, data []interface{}, rs *resultSlots,
+	i int,
+) bool {
+	if strings.HasPrefix(astField.Name, "__") {
+		return false // introspection fields are never handled by a wildcard
+	}
+	for _, d := range data {
+		v := reflect.ValueOf(d)
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		resolverInfo, ok := op.resolverLookup[v.Type()][wildcardName]
+		if !ok {
+			continue
+		}
+		fn := v.Field(resolverInfo.Index)
+		fieldInfo := &field.Info{Name: astField.Name, Nullable: !astField.Definition.Type.NonNull}
+		rs.run(op.isMutation || op.noConcurrency, op.resolverSem, func() {
+			op.wrapWildcard(ctx, astField, fn, fieldInfo, func(value gqlValue) { rs.set(i, value) })
+		})
+		return true
+	}
+	return false
+}
+
+// wrapWildcard calls a wildcard resolver function then resolves the value it returns (see wrapResolve)
+func (op *gqlOperation) wrapWildcard(ctx context.Context, astField *ast.Field, fn reflect.Value,
+	fieldInfo *field.Info, set func(gqlValue),
+) {
+	value, err := op.callWildcard(ctx, astField, fn)
+	if err != nil {
+		set(gqlValue{err: err})
+		return
+	}
+	if t := structType(reflect.TypeOf(value)); t != nil {
+		if _, ok := op.resolverLookup[t]; !ok {
+			set(gqlValue{err: fmt.Errorf("type %s returned by the wildcard resolver of %q is not known "+
+				"(register the type or add a field like \"_ %s\" to a struct)", t, astField.Name, t.Name())})
+			return
+		}
+	}
+	op.wrapResolve(ctx, astField, reflect.ValueOf(&value).Elem(), reflect.Value{}, fieldInfo, ResolverCache{},
+		reflect.Value{}, set)
+}
+
+// callWildcard calls a wildcard resolver function with the name and arguments of a field
+func (op *gqlOperation) callWildcard(ctx context.Context, astField *ast.Field, fn reflect.Value,
+) (value interface{}, err error) {
+	defer func() {
+		if recoverValue := recover(); recoverValue != nil {
+			err = fmt.Errorf("Internal error: panic %v", recoverValue)
+		}
+	}()
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if op.directiveBypass(astField.Directives) {
+		return nil, nil // wrapResolve (resolve) sends no value for the field
+	}
+	if fn.IsNil() {
+		return nil, fmt.Errorf("wildcard function for %q is not implemented (nil)", astField.Name)
+	}
+	return fn.Interface().(func(context.Context, string, map[string]interface{}) (interface{}, error))(
+		ctx, astField.Name, astField.ArgumentMap(op.variables))
+}
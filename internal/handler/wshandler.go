@@ -1,6 +1,6 @@
 package handler
 
-// wshandler is code for handling websockets for subscriptions (maybe also queries/mutations in the future).
+// wshandler is code for handling websockets for subscriptions (and queries/mutations).
 // It supports both commonly used WS protocols
 // * subscriptions-transport-ws: early protocol from Apollo for subscriptions (sub-protocol name:graphql-ws)
 // * graphql-ws is newer (official?) ws transport which can handle query/mutation/subscription (sub-protocol name:graphql-transport-ws).
@@ -11,20 +11,22 @@ package handler
 // duplicate/similar code.
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
-	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dolmen-go/jsonmap"
 	"github.com/gorilla/websocket"
-	"github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
 	"github.com/vektah/gqlparser/v2/gqlerror"
-	"github.com/vektah/gqlparser/v2/validator"
 )
 
 type (
@@ -33,8 +35,8 @@ type (
 		*Handler // we need this for the schema etc
 
 		// writeMu is required to protect writes to the WS (*webscoket.Conn) which may come from different go-routines
-		writeMu         *sync.Mutex // protect concurrent writes to the websocket
-		*websocket.Conn             // handle for WS communications
+		writeMu *sync.Mutex // protect concurrent writes to the websocket
+		msgConn             // handle for WS communications (or a WebTransport stream - see ServeWebTransport)
 
 		// cancelSubscription keeps track of the cancel function(s) associated with each operation.
 		// In theory, a client can open multiple subscriptions (and queries/mutations) on a single WS, differentiated
@@ -44,9 +46,23 @@ type (
 		//  map key = ID that identifies the operation (subscription)
 		//  map value = context.CancelFunc that will terminate the operation (ie kill all subscription processing)
 		cancelSubscription map[string]context.CancelFunc
+		// opMu protects cancelSubscription as each operation runs (and finishes) in its own go-routine
+		opMu *sync.Mutex
 
 		// newProtocol is set to true if we are using the new WS sub-protocol (graphql-transport-ws)
 		newProtocol bool // defaults to old protocol
+
+		clientKey string // identifies the client for field rate limits (obtained from the upgrade request)
+	}
+
+	// msgConn is the connection used to send and receive the protocol messages - it is implemented by *websocket.Conn
+	// and by streamConn which sends the same messages on a WebTransport stream
+	msgConn interface {
+		NextReader() (messageType int, r io.Reader, err error)
+		WriteJSON(v interface{}) error
+		WriteMessage(messageType int, data []byte) error
+		SetReadDeadline(t time.Time) error
+		Close() error
 	}
 
 	// wsMessage is used to encode (or decode) the messages sent to (received from) the websocket as JSON
@@ -61,47 +77,121 @@ type (
 		OperationName string                 `json:"operationName,omitempty"`
 		Query         string                 `json:"query,omitempty"` // required for request
 		Variables     map[string]interface{} `json:"variables,omitempty"`
-		Extensions    map[string]interface{} `json:"extensions,omitempty"`
+		Extensions    map[string]interface{} `json:"extensions,omitempty"` // also used for the extensions of a reply
 		// Used for encoding replies (next/data message) or errors
 		Data   interface{}       `json:"data,omitempty"`
 		Errors []*gqlerror.Error `json:"errors,omitempty"`
+
+		raw json.RawMessage // the payload as received (see InitContext option)
+	}
+
+	// connectionContext is the context for all operations on a websocket, which has the values of the upgrade
+	// request's context but is not cancelled (or given a deadline) when the request's context is.  This keeps
+	// the values available for the lifetime of the websocket (which is cancelled separately when it is closed).
+	connectionContext struct {
+		values context.Context
 	}
 )
 
+// UnmarshalJSON decodes a received payload, keeping a copy of the JSON (eg for the payload of connection_init)
+func (p *payload) UnmarshalJSON(b []byte) error {
+	type plainPayload payload // without the UnmarshalJSON method
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode((*plainPayload)(p)); err != nil {
+		return err
+	}
+	p.raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+func (connectionContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (connectionContext) Done() <-chan struct{}               { return nil }
+func (connectionContext) Err() error                          { return nil }
+func (c connectionContext) Value(key interface{}) interface{} { return c.values.Value(key) }
+
 var upgrader = websocket.Upgrader{
 	//ReadBufferSize:    4096,
 	//WriteBufferSize:   4096,
 	//EnableCompression: true,
-	CheckOrigin:  func(r *http.Request) bool { return true },
-	Subprotocols: []string{"graphql-ws", "graphql-transport-ws"},
+	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+const (
+	oldSubprotocol = "graphql-ws"           // subscriptions-transport-ws (legacy) sub-protocol
+	newSubprotocol = "graphql-transport-ws" // graphql-ws sub-protocol
+)
+
 // serverWS is called in response to a GraphQL HTTP request wanting to upgrade to a WS.
 func (h *Handler) serveWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if h.requireSubprotocol && !offersSubprotocol(r, h.subprotocols) {
+		http.Error(w, "websocket sub-protocol must be one of: "+strings.Join(h.subprotocols, ", "), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Context(connectionContext{values: r.Context()})
+	if h.wsContext != nil {
+		// Add values (eg from cookies or headers of the upgrade request) for all operations on the websocket
+		var err error
+		if ctx, err = h.wsContext(ctx, r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	u := upgrader
+	u.Subprotocols = h.subprotocols // in order of preference
+	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("wsConnection upgrade error:", err)
 		// nothing else required here as w's HTTP status has already been set
 		return
 	}
+	conn.SetReadLimit(h.maxRequestSize)
+	// if the client did not offer an accepted sub-protocol assume the first (most preferred) one
+	protocol := conn.Subprotocol()
+	if protocol == "" {
+		protocol = h.subprotocols[0]
+	}
+	h.serveConn(ctx, conn, protocol == newSubprotocol, h.rateLimitKey(r))
+}
+
+// offersSubprotocol checks if the client's upgrade request includes any of the accepted sub-protocols
+func offersSubprotocol(r *http.Request, accepted []string) bool {
+	for _, protocol := range websocket.Subprotocols(r) {
+		for _, a := range accepted {
+			if protocol == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveConn handles the protocol messages of a connection (websocket or WebTransport stream) until it is closed
+func (h *Handler) serveConn(ctx context.Context, conn msgConn, newProtocol bool, clientKey string) {
 	c := wsConnection{
 		Handler:            h,
 		writeMu:            &sync.Mutex{},
-		Conn:               conn,
+		msgConn:            conn,
 		cancelSubscription: make(map[string]context.CancelFunc, 1),
-		newProtocol:        conn.Subprotocol() == "graphql-transport-ws", // assume it's "old" (graphql-ws) sub-protocol unless explicitly set to new
+		opMu:               &sync.Mutex{},
+		newProtocol:        newProtocol,
+		clientKey:          clientKey,
 	}
 
-	if !c.init() {
-		c.Close()
+	ctx, ok := c.init(ctx)
+	if !ok {
+		c.msgConn.Close()
 		return
 	}
 
-	c.run(r.Context())
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.run(ctx)
 }
 
 // init performs the high-level (sub-protocol) handshake by receiving an "init" message and sending an "ack"
-func (c wsConnection) init() bool {
+// It returns the context for the connection, which may have values added using the payload of the init message.
+func (c wsConnection) init(ctx context.Context) (context.Context, bool) {
 	// Get connection_init and send connection_ack or error
 	c.setTimeout(c.initialTimeout)
 	var message *wsMessage
@@ -110,38 +200,64 @@ func (c wsConnection) init() bool {
 		message = c.read("connection_init", "connection_terminate", "start")
 		if message == nil {
 			// At this point an error/ close message has been sent in c.read
-			return false
+			return nil, false
 		}
 		if message.Type == "start" {
 			// Old protocol: ERROR - start received before connection_init
 			c.write(wsMessage{Type: "connection_error"})
 			c.closeMessage(websocket.CloseProtocolError, "start received before connection_init")
-			return false
+			return nil, false
 		}
 		if message.Type == "connection_terminate" {
 			// Old protocol: OK - client is allowed tor terminate immediately
 			c.closeMessage(websocket.CloseNormalClosure, "")
-			return false
+			return nil, false
 		}
 	} else {
 		message = c.read("connection_init", "subscribe")
 		if message == nil {
 			// At this point an error/ close message has been sent in c.read
-			return false
+			return nil, false
 		}
 		if message.Type == "subscribe" {
 			// New protocol: ERROR - subscribe received before connection_init
 			c.closeMessage(4409, "Unauthorized")
-			return false
+			return nil, false
 		}
 	}
 	// at this point we're OK to continue (got a "connection_init")
 	c.setTimeout(0) // clear timeout since we got the response before the deadline
+	if c.initContext != nil {
+		var err error
+		if ctx, err = c.initContext(ctx, initPayload(message.Payload)); err != nil {
+			if !c.newProtocol {
+				c.write(wsMessage{Type: "connection_error", Payload: &payload{Errors: gqlerror.List{{Message: err.Error()}}}})
+				c.closeMessage(websocket.ClosePolicyViolation, err.Error())
+			} else {
+				c.closeMessage(4403, "Forbidden: "+err.Error())
+			}
+			return nil, false
+		}
+	}
 	c.write(wsMessage{Type: "connection_ack"})
 	if !c.newProtocol {
 		c.write(wsMessage{Type: "ka"}) // initial keep alive message required for graphql-ws sub-protocol
 	}
-	return true
+	return ctx, true
+}
+
+// initPayload returns the payload of a connection_init message as a map (empty if there is no payload)
+func initPayload(p *payload) map[string]interface{} {
+	r := make(map[string]interface{})
+	if p == nil || len(p.raw) == 0 {
+		return r
+	}
+	decoder := json.NewDecoder(bytes.NewReader(p.raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&r); err != nil || r == nil {
+		return make(map[string]interface{}) // payload is not an object
+	}
+	return FixNumbers(r).(map[string]interface{})
 }
 
 // run handles sending and receiving WS messages according to the sub-protocol
@@ -157,7 +273,7 @@ func (c wsConnection) run(ctx context.Context) {
 
 	defer func() {
 		c.stopAll()
-		err := c.Close()
+		err := c.msgConn.Close()
 		if err != nil {
 			log.Println("wsConnection close error:", err)
 		}
@@ -241,16 +357,20 @@ func (c wsConnection) GetWebsocketInputChannel(expected ...string) <-chan *wsMes
 	return ch
 }
 
-// start extract subscription from WS message payload (Query field) and starts its processing
-// It returns false on error
+// start extract subscription from WS message payload (Query field) and starts its processing in a separate go-routine
+// (see operation).  If the query is invalid an "error" message is sent for the operation.
+// It returns false (and the websocket should be closed) on a protocol error
 //  - if the operation ID in the subscribe/start message is already in use
-//  - if the query is invalid
+//  - if there is no payload
 func (c wsConnection) start(ctx context.Context, message *wsMessage) bool {
 	if message.ID == "" {
 		c.closeMessage(websocket.CloseProtocolError, "no ID provided for subscribe")
 	}
-	// Add to our map of operations active in this ws (first checking that the ID is not in use)
-	if _, ok := c.cancelSubscription[message.ID]; ok {
+	// Check that the ID is not in use
+	c.opMu.Lock()
+	_, inUse := c.cancelSubscription[message.ID]
+	c.opMu.Unlock()
+	if inUse {
 		c.closeMessage(4409, "Subscriber for "+message.ID+" already exists")
 		return false
 	}
@@ -265,8 +385,15 @@ func (c wsConnection) start(ctx context.Context, message *wsMessage) bool {
 	// will get back the same type we passed in (Variables is of type map[stringinterface{})
 	message.Payload.Variables =	FixNumbers(message.Payload.Variables).(map[string]interface{})
 
-	query, errors := gqlparser.LoadQuery(c.schema, message.Payload.Query)
+	var apqErr *gqlerror.Error
+	if message.Payload.Query, apqErr = c.persistedQuery(message.Payload.Query, message.Payload.Extensions); apqErr != nil {
+		c.write(wsMessage{Type: "error", ID: message.ID, Payload: &payload{Errors: gqlerror.List{apqErr}}})
+		return true
+	}
+	secrets := c.secretValues(message.Payload.Query, message.Payload.Variables)
+	query, errors := c.loadQuery(message.Payload.Query)
 	if errors != nil {
+		redactErrors(errors, secrets)
 		out := wsMessage{
 			Type: "error", ID: message.ID,
 			Payload: &payload{
@@ -274,102 +401,184 @@ func (c wsConnection) start(ctx context.Context, message *wsMessage) bool {
 			},
 		}
 		c.write(out)
-		return false
+		return true
 	}
-	subscriptionCount := 0
-
-	// TODO: qqq check that map entry is set to nil on all error returns
-	ctx, c.cancelSubscription[message.ID] = context.WithCancel(ctx)
-	var r gqlResult // used to return query/mutation result(s), not used for subscriptions (results from chan written directly to ws)
+	foldDirectives(query)
 
-	for _, operation := range query.Operations {
-		op := gqlOperation{
-			Handler: c.Handler,
-		}
+	// The operation name (if any) selects the operation to execute when the document has more than one
+	operation, pgqlError := selectOperation(query, message.Payload.OperationName)
+	if pgqlError != nil {
+		c.write(wsMessage{Type: "error", ID: message.ID, Payload: &payload{Errors: gqlerror.List{pgqlError}}})
+		return true
+	}
 
-		if len(operation.VariableDefinitions) > 0 {
-			var pgqlError *gqlerror.Error
-			if op.variables, pgqlError = validator.VariableValues(c.schema, operation, message.Payload.Variables); pgqlError != nil {
-				r.Errors = append(r.Errors, pgqlError)
-				continue // skip this op if we can't get the vars
-			}
-		}
+	// Add to our map of operations active in this ws, then run it so that other messages (eg "complete" or other
+	// operations) are handled while it runs
+	ctx, cancel := context.WithCancel(ctx)
+	c.opMu.Lock()
+	c.cancelSubscription[message.ID] = cancel
+	c.opMu.Unlock()
+	go c.operation(ctx, cancel, message, operation, secrets)
+	return true
+}
 
-		var data []interface{} // one (or more) structs containing resolver(s)
-		switch operation.Operation {
-		case ast.Query:
-			data = c.qData // TODO: test this once we can send query on WS - no tools support it AFAIK! (GraphIQL, Postman etc)
-		case ast.Mutation:
-			op.isMutation = true
-			data = c.mData
-		case ast.Subscription:
-			op.isSubscription = true
-			data = c.subscriptionData
-		default:
-			panic("unknown operation: " + string(operation.Operation))
-		}
+// operation is called as a go routine to run an operation started by start.  The result of a query/mutation is sent
+// followed by "complete", unless the operation was stopped, whereas the results of a subscription are sent by process.
+func (c wsConnection) operation(ctx context.Context, cancel context.CancelFunc, message *wsMessage,
+	operation *ast.OperationDefinition, secrets []string,
+) {
+	var r gqlResult // used to return query/mutation result, not used for subscriptions (results from chan written directly to ws)
+	r.Data.Data = make(map[string]interface{})
+	var rateLimits rateLimitReport
+	subscriptionCount, ok := c.execute(ctx, cancel, message, operation, secrets, &r, &rateLimits)
+	if ok && subscriptionCount > 0 {
+		return // the subscription results are sent (then "complete") by process
+	}
 
-		result, err := op.GetSelections(ctx, operation.SelectionSet, data, nil)
-		if err != nil {
-			r.Errors = append(r.Errors, &gqlerror.Error{
-				Message:    err.Error(),
-				Extensions: map[string]interface{}{"operation": operation.Name},
-			})
-			continue
-		}
-		if len(result.Order) > 0 {
-			// start processing for each subscription
-			for _, k := range result.Order {
-				if reflect.TypeOf(result.Data[k]).Kind() == reflect.Chan {
-					go c.process(ctx, message.ID, k, result.Data[k], !op.isSubscription)
-					subscriptionCount++
-					continue
-				}
-				if op.isSubscription {
-					out := wsMessage{
-						Type: "error", ID: message.ID,
-						Payload: &payload{
-							Errors: []*gqlerror.Error{
-								&gqlerror.Error{
-									Message: "internal error: subscription resolver \"" + k + "\"did not return a channel",
-								},
-							},
-						},
-					}
-					c.write(out)
-					return false
-				}
-				if _, ok := r.Data.Data[k]; !ok {
-					r.Data.Order = append(r.Data.Order, k) // only append to order if not already in the map
-				}
-				r.Data.Data[k] = result.Data[k]
-			}
-			break // don't look for the same selection(s) in the next data
-		}
+	// The operation has finished so the client may reuse its ID (once it receives "complete")
+	c.opMu.Lock()
+	stopped := c.cancelSubscription[message.ID] == nil // "complete" received or the websocket is closing
+	delete(c.cancelSubscription, message.ID)
+	c.opMu.Unlock()
+	cancel()
+	if ok && !stopped {
+		c.sendResult(message, &r, &rateLimits)
 	}
+}
+
+// sendResult sends the result of a query/mutation followed by "complete"
+func (c wsConnection) sendResult(message *wsMessage, r *gqlResult, rateLimits *rateLimitReport) {
 
-	// Check that we either started a subscription or got a result/error (query/mutation)
-	if subscriptionCount == 0 {
+	// Check that we got a result/error (query/mutation)
+	if len(r.Data.Order) == 0 && len(r.Errors) == 0 {
 		r.Errors = append(r.Errors, &gqlerror.Error{
 			Message: "Internal error: no result generated for " + message.Payload.Query,
 		})
 	}
 
-	// If we got result or error send it now
-	if len(r.Data.Order) > 0 || len(r.Errors) > 0 {
-		messageType := "next"
-		if !c.newProtocol {
-			messageType = "data"
+	// A query/mutation has a single result (with any errors) followed by "complete"
+	messageType := "next"
+	if !c.newProtocol {
+		messageType = "data"
+	}
+	out := wsMessage{
+		Type: messageType, ID: message.ID,
+		Payload: &payload{
+			Errors:     c.limitErrors(r.Errors),
+			Extensions: rateLimits.extensions(),
+		},
+	}
+	if len(r.Data.Order) > 0 {
+		out.Payload.Data = r.Data
+	}
+	c.write(out)
+	c.write(wsMessage{Type: "complete", ID: message.ID})
+}
+
+// execute runs an operation received on the websocket, adding the results (or errors) of a query/mutation to r, or
+// starting processing (see process) of the channel(s) of a subscription.  It returns the number of subscriptions
+// started and false if an "error" message has been sent for the operation.
+func (c wsConnection) execute(ctx context.Context, cancel context.CancelFunc, message *wsMessage,
+	operation *ast.OperationDefinition, secrets []string, r *gqlResult, rateLimits *rateLimitReport,
+) (int, bool) {
+	start := time.Now()
+	op := gqlOperation{
+		Handler:       c.Handler,
+		omitNulls:     c.Handler.omitNulls || extensionFlag(message.Payload.Extensions, omitNullsExtension),
+		addTypename:   c.Handler.addTypename || extensionFlag(message.Payload.Extensions, addTypenameExtension),
+		clientKey:     c.clientKey,
+		rateLimits:    rateLimits,
+		cacheCounts:   &cacheCounts{},
+		elementErrors: &elementErrors{},
+		elementCaches: &scopedCaches{},
+		operation:     operation,
+		pool:          c.newWorkerPool(),
+	}
+	c.checkDeprecated(ctx, operation, c.clientKey)
+
+	if len(operation.VariableDefinitions) > 0 {
+		var pgqlError *gqlerror.Error
+		if op.variables, pgqlError = c.operationVariables(ctx, operation, message.Payload.Variables); pgqlError != nil {
+			r.Errors = append(r.Errors, pgqlError)
+			c.audit(message, operation, start, r.Errors, op.cacheCounts, secrets)
+			return 0, true
 		}
-		out := wsMessage{
-			Type: messageType, ID: message.ID,
-			Payload: &payload{
-				Data: r,
-			},
+	}
+
+	var data []interface{} // one (or more) structs containing resolver(s)
+	switch operation.Operation {
+	case ast.Query:
+		data = c.qData
+	case ast.Mutation:
+		op.isMutation = true
+		data = c.mData
+	case ast.Subscription:
+		op.isSubscription = true
+		op.caches = &scopedCaches{} // don't share cached values with other ops as subscriptions may run for a long time
+		data = c.subscriptionData
+	default:
+		panic("unknown operation: " + string(operation.Operation))
+	}
+	if pgqlError := op.checkComplexity(operation, data); pgqlError != nil {
+		r.Errors = append(r.Errors, pgqlError)
+		c.audit(message, operation, start, r.Errors, op.cacheCounts, secrets)
+		return 0, true
+	}
+
+	ctx = withMeta(ctx, c.Handler) // see Meta
+	result, err := op.GetSelections(ctx, operation.SelectionSet, data, nil)
+	if err != nil {
+		r.Errors = append(r.Errors, gqlError(err, operation))
+		c.audit(message, operation, start, r.Errors, op.cacheCounts, secrets)
+		return 0, true
+	}
+	r.Errors = append(r.Errors, op.elementErrors.errors(operation)...)
+	c.audit(message, operation, start, r.Errors, op.cacheCounts, secrets)
+
+	// Start processing for each subscription, or add the value of each query/mutation field to the result
+	subscriptionCount := 0
+	for _, k := range result.Order {
+		if events, ok := result.Data[k].(<-chan gqlEvent); ok {
+			release := func() {}
+			if op.caches != nil {
+				release = op.caches.hold()
+			}
+			go c.process(ctx, message.ID, k, events, !op.isSubscription, cancel, release, secrets)
+			subscriptionCount++
+			continue
 		}
-		c.write(out)
+		if op.isSubscription {
+			out := wsMessage{
+				Type: "error", ID: message.ID,
+				Payload: &payload{
+					Errors: []*gqlerror.Error{
+						&gqlerror.Error{
+							Message: "internal error: subscription resolver \"" + k + "\" did not return a channel",
+						},
+					},
+				},
+			}
+			c.write(out)
+			return subscriptionCount, false
+		}
+		r.Data.Order = append(r.Data.Order, k)
+		r.Data.Data[k] = result.Data[k]
 	}
-	return true
+	return subscriptionCount, true
+}
+
+// audit redacts secret values from the errors of an operation then sends a record of the operation to the audit
+// sink (if any)
+func (c wsConnection) audit(message *wsMessage, operation *ast.OperationDefinition, start time.Time, errs gqlerror.List,
+	counts *cacheCounts, secrets []string,
+) {
+	redactErrors(errs, secrets)
+	if c.auditor == nil {
+		return
+	}
+	g := gqlRequest{Query: message.Payload.Query, Variables: message.Payload.Variables, clientKey: c.clientKey,
+		cacheCounts: counts}
+	c.auditor.record(g.operationRecord(operation, start, errs))
 }
 
 // process is called as a go routine to send the operation data to the websocket
@@ -377,49 +586,46 @@ func (c wsConnection) start(ctx context.Context, message *wsMessage) bool {
 //  ctx = context that can be used to terminate the processing
 //  ID = client identifier for the operation from the "subscribe" (or start in old sub-protocol) message
 //  k = name or alias of the subscription query
-//  in = channel which outputs the data for the subscription
+//  in = channel which outputs the (resolved) data for the subscription
 //  onceOnly = true if the channel will only send one value (eg query not subscription)
-func (c wsConnection) process(ctx context.Context, ID string, k string, in interface{}, onceOnly bool) {
+//  cancel = cancels ctx (used to stop the operation if the result can't be written)
+//  release = called when finished to release resources such as the operation's cached values
+//  secrets = values of secret arguments to be redacted from errors
+func (c wsConnection) process(ctx context.Context, ID string, k string, in <-chan gqlEvent, onceOnly bool,
+	cancel context.CancelFunc, release func(), secrets []string,
+) {
 	messageType := "next"
 	if !c.newProtocol {
 		messageType = "data"
 	}
 
 	defer func() {
+		defer release()
 		c.write(wsMessage{Type: "complete", ID: ID})
 		// drain the channel in case it was written to just before the cancel was received
-		ch := reflect.ValueOf(in)
-		for {
-			_, ok := ch.Recv()
-			if !ok {
-				break
-			}
+		for range in {
 		}
 	}()
 
 	for {
-		// We use reflect.Select instead of a select statement because we don't know the type returned by the 'in' chan
-		chosen, v, ok := reflect.Select([]reflect.SelectCase{
-			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(in)},
-			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
-		})
-		switch chosen {
-		case 0:
+		select {
+		case event, ok := <-in:
 			if !ok {
 				c.write(wsMessage{Type: "complete", ID: ID})
 				return
 			}
-			out := wsMessage{
-				Type: messageType, ID: ID,
-				Payload: &payload{
-					Data: map[string]interface{}{k: v.Interface()},
-				},
+			redactErrors(event.errors, secrets)
+			// Use the same (ordered) structure as query results
+			data := jsonmap.Ordered{Data: map[string]interface{}{k: event.value}, Order: []string{k}}
+			out := wsMessage{Type: messageType, ID: ID, Payload: &payload{Data: data, Errors: event.errors}}
+			if !c.write(out) {
+				cancel() // client has gone away so stop the operation (which closes in, drained below)
+				return
 			}
-			c.write(out)
 			if onceOnly {
 				return // only one result sent
 			}
-		case 1:
+		case <-ctx.Done():
 			return // context canceled
 		}
 	}
@@ -427,6 +633,8 @@ func (c wsConnection) process(ctx context.Context, ID string, k string, in inter
 
 // stop kills processing of one operation (eg subscription) by calling the cancel function of the operation's context
 func (c wsConnection) stop(ID string) {
+	c.opMu.Lock()
+	defer c.opMu.Unlock()
 	if c.cancelSubscription[ID] == nil {
 		// Not an error - may occur if client and server send "complete" messages at the same time
 		return
@@ -437,6 +645,8 @@ func (c wsConnection) stop(ID string) {
 
 // stopAll kills processing of all operations (eg before closing the websocket)
 func (c wsConnection) stopAll() {
+	c.opMu.Lock()
+	defer c.opMu.Unlock()
 	for ID, cancel := range c.cancelSubscription {
 		if cancel != nil {
 			cancel()
@@ -445,13 +655,15 @@ func (c wsConnection) stopAll() {
 	}
 }
 
-// write wraps the Gorilla WriteJSON method to allow concurrent writes
-func (c wsConnection) write(v interface{}) {
+// write wraps the Gorilla WriteJSON method to allow concurrent writes - returns false if the write failed
+func (c wsConnection) write(v interface{}) bool {
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
 	if err := c.WriteJSON(v); err != nil {
 		log.Println("wsConnection: write error:", err)
+		return false
 	}
+	return true
 }
 
 // closeMessage writes a WS close control message (presumably just before closing the websocket)
@@ -463,6 +675,14 @@ func (c wsConnection) closeMessage(closeCode int, text string) {
 	}
 }
 
+// messageTooBig closes the connection when a message is larger than the limit (see MaxRequestSize).  A websocket
+// has already sent a close message (1009) when it returned websocket.ErrReadLimit, but a stream has not.
+func (c wsConnection) messageTooBig() {
+	if _, ok := c.msgConn.(*websocket.Conn); !ok {
+		c.closeMessage(websocket.CloseMessageTooBig, "message too big")
+	}
+}
+
 // read gets a message from the websocket, decodes the JSON, and returns a pointer to the message
 // If there is any sort of error it sends an appropriate response on the websocket and returns nil
 // Note that concurrent reads are not supported or needed so there is no mutex reads (unlike writes).
@@ -470,6 +690,10 @@ func (c wsConnection) closeMessage(closeCode int, text string) {
 func (c wsConnection) read(expected ...string) *wsMessage {
 	// Get the message from the websocket
 	messageType, reader, err := c.NextReader()
+	if errors.Is(err, websocket.ErrReadLimit) {
+		c.messageTooBig()
+		return nil
+	}
 	if err != nil {
 		// if we are dealing with initialisation then respond as per doc
 		if len(expected) > 0 && expected[0] == "connection_init" {
@@ -495,6 +719,10 @@ func (c wsConnection) read(expected ...string) *wsMessage {
 	decoder := json.NewDecoder(reader)
 	decoder.UseNumber() // allows us to distinguish ints from floats in Variables map (see also FixNumberVariables())
 	err = decoder.Decode(r)
+	if errors.Is(err, websocket.ErrReadLimit) {
+		c.messageTooBig()
+		return nil
+	}
 	if err != nil {
 		if !c.newProtocol {
 			c.closeMessage(websocket.CloseUnsupportedData, "JSON error:"+err.Error())
@@ -0,0 +1,162 @@
+package schema
+
+// bind.go checks that Go structs can be used as the resolvers of a schema provided by the user (in GraphQL SDL)
+// rather than a schema generated from the structs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Bind parses a schema (SDL) and checks that the root query, mutation and subscription structs (any of which
+// may be nil) can resolve it.  Every non-null field of an object type must have a matching Go field (by name,
+// using the egg: tag as usual) unless the struct has a wildcard resolver, and the arguments of a resolver function
+// must be declared in the schema.  Every field of the subscription struct must be (or return) a channel.
+// It returns the enums declared in the schema, for use by the handler.
+func Bind(sdl string, roots [3]interface{}) (map[string][]string, error) {
+	s, pgqlError := gqlparser.LoadSchema(&ast.Source{Name: "schema", Input: sdl})
+	if pgqlError != nil {
+		return nil, pgqlError
+	}
+	b := binder{schema: s, done: make(map[string]reflect.Type)}
+	for i, def := range []*ast.Definition{s.Query, s.Mutation, s.Subscription} {
+		if roots[i] == nil {
+			continue
+		}
+		if def == nil {
+			return nil, fmt.Errorf("%s struct provided but the schema has no %s type", EntryPoint(i), EntryPoint(i))
+		}
+		if EntryPoint(i) == Subscription {
+			if err := checkSubscription(reflect.TypeOf(roots[i])); err != nil {
+				return nil, err
+			}
+		}
+		if err := b.bind(def, reflect.TypeOf(roots[i]), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	enums := make(map[string][]string)
+	for name, def := range s.Types {
+		if def.Kind != ast.Enum || def.BuiltIn {
+			continue
+		}
+		for _, value := range def.EnumValues {
+			enums[name] = append(enums[name], value.Name)
+		}
+	}
+	return enums, nil
+}
+
+// String returns the name of the GraphQL root type
+func (e EntryPoint) String() string {
+	return [...]string{"query", "mutation", "subscription"}[e]
+}
+
+// binder remembers the Go type bound to each object type (so a type is only checked once)
+type binder struct {
+	schema *ast.Schema
+	done   map[string]reflect.Type
+}
+
+// bind checks that the fields of an object (or interface) type can be resolved using the struct type t
+// If id is not empty it's the name of the fabricated field of the elements of a list (see "field_id" and
+// "subscript" options) which is resolved without a Go field.
+func (b binder) bind(def *ast.Definition, t reflect.Type, id string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil // we can't check (eg a Go interface) - any errors are found when the query is run
+	}
+	if _, ok := b.done[def.Name]; ok {
+		return nil
+	}
+	b.done[def.Name] = t
+
+	goFields := make(map[string]goField)
+	var wildcard bool
+	if err := addGoFields(t, goFields, &wildcard); err != nil {
+		return err
+	}
+	for _, fieldDef := range def.Fields {
+		if strings.HasPrefix(fieldDef.Name, "__") {
+			continue
+		}
+		gf, ok := goFields[fieldDef.Name]
+		if !ok && fieldDef.Name == id {
+			continue
+		}
+		if !ok {
+			if fieldDef.Type.NonNull && !wildcard {
+				return fmt.Errorf("field %s.%s (%s) is not bound to a Go field of %s", def.Name, fieldDef.Name,
+					fieldDef.Type, t)
+			}
+			continue
+		}
+		tf := gf.f
+		fieldInfo, err := field.Get(gf.t, &tf)
+		if err != nil {
+			return fmt.Errorf("%w getting field %q", err, tf.Name)
+		}
+		for _, arg := range fieldInfo.Args {
+			if fieldDef.Arguments.ForName(arg) == nil {
+				return fmt.Errorf("argument %q of %s is not declared for field %s.%s", arg, tf.Name, def.Name,
+					fieldDef.Name)
+			}
+		}
+		if fieldInfo.Subscript != "" && fieldDef.Arguments.ForName(fieldInfo.Subscript) == nil {
+			return fmt.Errorf("subscript %q of %s is not declared for field %s.%s", fieldInfo.Subscript, tf.Name,
+				def.Name, fieldDef.Name)
+		}
+		if child := b.schema.Types[fieldDef.Type.Name()]; child != nil &&
+			(child.Kind == ast.Object || child.Kind == ast.Interface) {
+			id := fieldInfo.FieldID
+			if fieldInfo.Subscript != "" {
+				id = fieldInfo.Subscript
+			}
+			if err := b.bind(child, fieldInfo.ResultType, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// goField is a struct field and the struct type that contains it (which may be an embedded struct)
+type goField struct {
+	t reflect.Type
+	f reflect.StructField
+}
+
+// addGoFields adds the exported fields of a struct (including fields promoted from embedded structs) to fields,
+// keyed by GraphQL name, and sets wildcard if there is a resolver with the "wildcard" option
+func addGoFields(t reflect.Type, fields map[string]goField, wildcard *bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		tf := t.Field(i)
+		fieldInfo, err := field.Get(t, &tf)
+		if err != nil {
+			return fmt.Errorf("%w getting field %q", err, tf.Name)
+		}
+		if fieldInfo == nil || tf.Name == "_" {
+			continue
+		}
+		if fieldInfo.Wildcard {
+			*wildcard = true
+			continue
+		}
+		if fieldInfo.Embedded {
+			if err := addGoFields(fieldInfo.ResultType, fields, wildcard); err != nil {
+				return err
+			}
+			continue
+		}
+		fields[fieldInfo.Name] = goField{t: t, f: tf}
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package schema
+
+// codegen.go generates Go structs (with egg: tags) from a schema provided in GraphQL SDL, so that a schema-first
+// project can start with skeleton resolvers rather than translating each type by hand
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// generator writes the Go declarations for the types of a schema
+type generator struct {
+	schema  *ast.Schema
+	buf     *bytes.Buffer
+	roots   map[string]EntryPoint // names of the root types
+	unions  map[string][]string   // names of the unions that each object type is a member of
+	imports map[string]bool       // packages used by the generated code
+}
+
+// GenerateGo parses a schema (SDL) and returns Go source code (package pkg) declaring types that can be used with
+// eggql to generate the same schema:
+//   - an object, interface or input type is a struct, where an object implementing an interface embeds the
+//     interface's struct, and a union is an empty struct embedded in its members
+//   - an enum is a named int type with an EnumValues method (see field.EnumValuer) and a constant for each value
+//   - a custom scalar is a named string type with MarshalEGGQL and UnmarshalEGGQL methods (DateTime is time.Time)
+//   - fields of the root query, mutation and subscription, and fields with arguments, are resolver funcs
+//
+// Descriptions, default values and deprecations are added to the egg: tags.  The code is a skeleton - the
+// resolver funcs need to be implemented and the field types may need adjusting (eg to use pointers).
+func GenerateGo(sdl, pkg string) ([]byte, error) {
+	s, pgqlError := gqlparser.LoadSchema(&ast.Source{Name: "schema", Input: sdl})
+	if pgqlError != nil {
+		return nil, pgqlError
+	}
+	g := generator{
+		schema:  s,
+		buf:     &bytes.Buffer{},
+		roots:   make(map[string]EntryPoint),
+		unions:  make(map[string][]string),
+		imports: make(map[string]bool),
+	}
+	for i, def := range []*ast.Definition{s.Query, s.Mutation, s.Subscription} {
+		if def != nil {
+			g.roots[def.Name] = EntryPoint(i)
+		}
+	}
+
+	names := make([]string, 0, len(s.Types))
+	for name, def := range s.Types {
+		if !def.BuiltIn && !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if def := s.Types[name]; def.Kind == ast.Union {
+			for _, member := range def.Types {
+				g.unions[member] = append(g.unions[member], name)
+			}
+		}
+	}
+
+	for _, name := range names {
+		def := s.Types[name]
+		switch def.Kind {
+		case ast.Object, ast.Interface, ast.InputObject:
+			g.writeStruct(def)
+		case ast.Union:
+			if def.Description == "" {
+				g.printf("type %s struct{}\n\n", def.Name)
+			} else {
+				g.printf("type %s struct {\n", def.Name)
+				g.writeTagHolder(def.Description)
+				g.printf("}\n\n")
+			}
+		case ast.Enum:
+			g.comment(def.Name, def.Description)
+			g.writeEnum(def)
+		case ast.Scalar:
+			g.comment(def.Name, def.Description)
+			g.writeScalar(def)
+		}
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated from a GraphQL schema by egggen - complete the resolvers then edit as required\n\n")
+	fmt.Fprintf(src, "package %s\n\n", pkg)
+	if len(g.imports) > 0 {
+		var std, other []string // standard library packages are listed first
+		for path := range g.imports {
+			if strings.Contains(path, ".") {
+				other = append(other, strconv.Quote(path))
+			} else {
+				std = append(std, strconv.Quote(path))
+			}
+		}
+		sort.Strings(std)
+		sort.Strings(other)
+		fmt.Fprintf(src, "import (\n%s\n)\n\n", strings.TrimSpace(strings.Join(std, "\n")+"\n\n"+strings.Join(other, "\n")))
+	}
+	src.Write(g.buf.Bytes())
+	return format.Source(src.Bytes())
+}
+
+func (g generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format, args...)
+}
+
+// comment writes a doc comment for a type using its description (if any) - used for types (enums and scalars) that
+// can't have a description in a tag
+func (g generator) comment(name, desc string) {
+	if desc == "" {
+		return
+	}
+	for i, line := range strings.Split(desc, "\n") {
+		if i == 0 {
+			line = name + " -" + strings.TrimRight(" "+strings.TrimLeft(line, " "), " ")
+		}
+		g.printf("// %s\n", strings.TrimRight(line, " "))
+	}
+}
+
+// writeTagHolder writes the dummy field whose tag holds the description of a type
+func (g generator) writeTagHolder(desc string) {
+	if desc != "" {
+		g.imports["github.com/andrewwphillips/eggql"] = true
+		g.printf("_ eggql.TagHolder %s\n", structTag("#"+desc))
+	}
+}
+
+// writeStruct writes the struct for an object, interface or input type
+func (g generator) writeStruct(def *ast.Definition) {
+	g.printf("type %s struct {\n", def.Name)
+	g.writeTagHolder(def.Description)
+
+	// Fields of interfaces are provided by embedding the interface's struct
+	inherited := make(map[string]bool)
+	for _, iface := range def.Interfaces {
+		g.printf("%s\n", iface)
+		for _, f := range g.schema.Types[iface].Fields {
+			inherited[f.Name] = true
+		}
+	}
+	for _, union := range g.unions[def.Name] {
+		g.printf("%s\n", union)
+	}
+	if len(def.Interfaces)+len(g.unions[def.Name]) > 0 && len(def.Fields) > len(inherited) {
+		g.printf("\n")
+	}
+
+	entryPoint, isRoot := g.roots[def.Name]
+	if isRoot && entryPoint == Query {
+		// Reference the types that can only be returned as an interface or union so that they are in the schema
+		for _, name := range g.abstractMembers() {
+			g.printf("_ [0]%s\n", name)
+		}
+	}
+	for _, f := range def.Fields {
+		if inherited[f.Name] || strings.HasPrefix(f.Name, "__") {
+			continue
+		}
+		g.writeField(def, f, isRoot, entryPoint)
+	}
+	g.printf("}\n\n")
+}
+
+// abstractMembers returns the names of the object types that implement an interface or are members of a union
+func (g generator) abstractMembers() []string {
+	var r []string
+	for name, def := range g.schema.Types {
+		if def.Kind == ast.Object && !def.BuiltIn && (len(def.Interfaces) > 0 || len(g.unions[name]) > 0) {
+			r = append(r, name)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// writeField writes a field of a struct, using a resolver func if it's a root field, has arguments or if a value of
+// the field's type would make the struct recursive
+func (g generator) writeField(parent *ast.Definition, f *ast.FieldDefinition, isRoot bool, entryPoint EntryPoint) {
+	var main strings.Builder // the name, arguments and type (first part of the tag)
+	name := goName(f.Name)
+	if lowerFirst(name) != f.Name {
+		main.WriteString(f.Name)
+	}
+	typ, typeName := g.goType(f.Type, true, isRoot)
+	if typeName != "" {
+		// The GraphQL type can't be deduced from the Go type (eg an interface)
+		typeName = ":" + typeName
+	}
+	if f.Type.Elem != nil && !f.Type.NonNull {
+		typeName += ",nullable"
+	}
+
+	isFunc := isRoot || len(f.Arguments) > 0 || g.recursive(f.Type, parent.Name)
+	if isFunc {
+		params := make([]string, 0, len(f.Arguments))
+		args := make([]string, 0, len(f.Arguments))
+		for _, arg := range f.Arguments {
+			argType, _ := g.goType(arg.Type, false, false)
+			params = append(params, argType)
+			args = append(args, g.argument(arg))
+		}
+		if len(args) > 0 {
+			main.WriteString("(" + strings.Join(args, ",") + ")")
+		}
+		if isRoot && entryPoint == Subscription {
+			typ = "<-chan " + typ
+		}
+		typ = "func(" + strings.Join(params, ", ") + ") " + typ
+	} else if f.DefaultValue != nil {
+		main.WriteString("=" + f.DefaultValue.String()) // default value of an input field
+	}
+
+	tag := main.String() + typeName
+	if reason, ok := deprecation(f.Directives); ok {
+		tag += ",deprecated" + reason
+	}
+	if f.Description != "" {
+		tag += "#" + f.Description
+	}
+	g.printf("%s %s", name, typ)
+	if tag != "" {
+		g.printf(" %s", structTag(tag))
+	}
+	g.printf("\n")
+}
+
+// argument returns an argument of a resolver as used in the tag, eg "episode=JEDI#the movie"
+func (g generator) argument(arg *ast.ArgumentDefinition) string {
+	r := arg.Name
+	if reason, ok := deprecation(arg.Directives); ok {
+		r += "{deprecated" + reason + "}"
+	}
+	if arg.DefaultValue != nil {
+		r += "=" + arg.DefaultValue.String()
+	}
+	if arg.Description != "" {
+		// A comma, closing bracket or backslash in an argument description must be escaped (see field.ArgDescription)
+		r += "#" + strings.NewReplacer(`\`, `\\`, ",", `\,`, ")", `\)`).Replace(arg.Description)
+	}
+	return r
+}
+
+// goType returns the Go type for a GraphQL type, plus the GraphQL type name if it must be given in the tag since
+// it can't be deduced from the Go type.  For a field (top is true) a nullable list is not a pointer as the
+// "nullable" option is used instead.  An interface is interface{} for a root field but otherwise a pointer to the
+// interface's struct, since the interface type is not known (see validateTypeName) until its struct is complete.
+func (g generator) goType(t *ast.Type, top, root bool) (string, string) {
+	var r string
+	if t.Elem != nil {
+		elem, typeName := g.goType(t.Elem, false, root)
+		if typeName != "" {
+			return "[]interface{}", t.String()
+		}
+		r = "[]" + elem
+	} else {
+		def := g.schema.Types[t.NamedType]
+		switch {
+		case def.Kind == ast.Interface && !root:
+			return "*" + t.NamedType, ""
+		case def.Kind == ast.Interface || def.Kind == ast.Union:
+			return "interface{}", t.String()
+		case t.NamedType == "Int":
+			r = "int"
+		case t.NamedType == "Float":
+			r = "float64"
+		case t.NamedType == "String":
+			r = "string"
+		case t.NamedType == "Boolean":
+			r = "bool"
+		case t.NamedType == "ID":
+			g.imports["github.com/andrewwphillips/eggql"] = true
+			r = "eggql.ID"
+		case t.NamedType == field.DateTimeName:
+			g.imports["time"] = true
+			r = "time.Time"
+		default:
+			r = t.NamedType
+		}
+	}
+	if !t.NonNull && (t.Elem == nil || !top) {
+		r = "*" + r
+	}
+	return r, ""
+}
+
+// recursive returns true if a value (not a pointer or list) of the type of a field would contain the struct of the
+// type that contains the field (directly or indirectly), which Go does not allow
+func (g generator) recursive(t *ast.Type, parent string) bool {
+	seen := make(map[string]bool)
+	var contains func(t *ast.Type) bool
+	contains = func(t *ast.Type) bool {
+		if t.Elem != nil || !t.NonNull {
+			return false
+		}
+		def := g.schema.Types[t.NamedType]
+		if def.Kind != ast.Object && def.Kind != ast.InputObject {
+			return false
+		}
+		if def.Name == parent {
+			return true
+		}
+		if seen[def.Name] {
+			return false
+		}
+		seen[def.Name] = true
+		for _, f := range def.Fields {
+			if len(f.Arguments) == 0 && contains(f.Type) {
+				return true
+			}
+		}
+		return false
+	}
+	return contains(t)
+}
+
+// writeEnum writes a named int type with an EnumValues method and a constant for each value
+func (g generator) writeEnum(def *ast.Definition) {
+	g.printf("type %s int\n\n", def.Name)
+	g.printf("const (\n")
+	for i, value := range def.EnumValues {
+		if i == 0 {
+			g.printf("%s%s %s = iota\n", def.Name, value.Name, def.Name)
+		} else {
+			g.printf("%s%s\n", def.Name, value.Name)
+		}
+	}
+	g.printf(")\n\n")
+
+	g.printf("// EnumValues returns the names (and descriptions) of the values of %s\n", def.Name)
+	g.printf("func (%s) EnumValues() []string {\n\treturn []string{\n", def.Name)
+	for _, value := range def.EnumValues {
+		s := value.Name
+		if reason, ok := deprecation(value.Directives); ok {
+			s += " @deprecated"
+			if reason != "" {
+				s += "(reason: " + strings.TrimPrefix(reason, "=") + ")"
+			}
+		}
+		if value.Description != "" {
+			s += "#" + value.Description
+		}
+		g.printf("%s,\n", strconv.Quote(s))
+	}
+	g.printf("}\n}\n\n")
+}
+
+// writeScalar writes a named string type for a custom scalar (except DateTime which is time.Time)
+func (g generator) writeScalar(def *ast.Definition) {
+	if def.Name == field.DateTimeName {
+		return
+	}
+	g.printf("type %s string\n\n", def.Name)
+	g.printf("// UnmarshalEGGQL converts a value of the scalar (from a query) to %s\n", def.Name)
+	g.printf("func (v *%s) UnmarshalEGGQL(s string) error {\n\t*v = %s(s)\n\treturn nil\n}\n\n", def.Name, def.Name)
+	g.printf("// MarshalEGGQL converts %s to a value of the scalar (for the results)\n", def.Name)
+	g.printf("func (v %s) MarshalEGGQL() (string, error) {\n\treturn string(v), nil\n}\n\n", def.Name)
+}
+
+// deprecation returns the deprecated option (if deprecated), eg `="no longer used"`, or an empty string if there is
+// no reason, and true if there is a @deprecated directive
+func deprecation(directives ast.DirectiveList) (string, bool) {
+	d := directives.ForName("deprecated")
+	if d == nil {
+		return "", false
+	}
+	if arg := d.Arguments.ForName("reason"); arg != nil && arg.Value != nil {
+		return "=" + strconv.Quote(arg.Value.Raw), true
+	}
+	return "", true
+}
+
+// goName returns the (exported) name of the Go field for a GraphQL field
+func goName(name string) string {
+	if name[0] == '_' {
+		return "X" + name
+	}
+	return string(unicode.ToUpper(rune(name[0]))) + name[1:]
+}
+
+// lowerFirst returns a Go field name with the first letter in lower case (the default GraphQL name)
+func lowerFirst(name string) string {
+	return string(unicode.ToLower(rune(name[0]))) + name[1:]
+}
+
+// structTag returns the Go struct tag (including the backquotes) with the egg: key
+func structTag(value string) string {
+	tag := field.TagKey + ":" + strconv.Quote(value)
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
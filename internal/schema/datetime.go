@@ -0,0 +1,34 @@
+package schema
+
+// datetime.go implements the DateTime and DateTimeFormat build options - by default every time.Time field and
+// resolver argument is a DateTime scalar
+
+// DateTime returns a build option that turns on (the default) or off the use of the DateTime scalar for time.Time
+// fields and resolver arguments.  When on, the value is encoded as a string, by default in RFC 3339 format
+// (eg "2006-01-02T15:04:05Z").  When off a field can still be a DateTime by giving the type in its egg: tag,
+// eg `egg:":DateTime!"`.
+func DateTime(on bool) BuildOption {
+	return func(s *schema) {
+		s.noDateTime = !on
+	}
+}
+
+// DateTimeFormat returns a build option that sets the layout (see time.Format) of DateTime values, which is used
+// to check default values given in egg: tags.  The default is RFC 3339 (time.RFC3339).
+func DateTimeFormat(layout string) BuildOption {
+	return func(s *schema) {
+		if layout != "" {
+			s.dateTimeFormat = layout
+		}
+	}
+}
+
+// addScalar adds the name of a custom scalar type (if not already added) to be declared in the schema
+func (s schema) addScalar(name string) {
+	for _, scalar := range *s.scalars {
+		if scalar == name {
+			return
+		}
+	}
+	*s.scalars = append(*s.scalars, name)
+}
@@ -0,0 +1,72 @@
+package schema
+
+// description.go writes descriptions into the schema.  By convention a description is a one-line summary optionally
+// followed by a newline and the details, eg `egg:"price#Price in cents\nExcludes tax"` (Go turns the \n of the tag
+// into a newline) - tools that only show the first line of a description then show the summary.
+
+import "strings"
+
+// blockString returns a description as a GraphQL block string - on one line (eg """Summary""") if it is just a
+// summary, otherwise see multiLine.  Triple quotes in the description are escaped (\""") but if it ends with a quote
+// or backslash (which would run into the closing quotes) a string value is returned instead (see escapedString).
+func blockString(desc, indent string) string {
+	if strings.Contains(desc, "\n") {
+		return multiLine(desc, indent)
+	}
+	if strings.HasSuffix(desc, `"`) || strings.HasSuffix(desc, `\`) {
+		return escapedString(desc)
+	}
+	return `"""` + strings.ReplaceAll(desc, `"""`, `\"""`) + `"""`
+}
+
+// quotedString is like blockString but returns a one-line description as a string value (eg "Summary"), as used
+// for the descriptions of enums and their values
+func quotedString(desc, indent string) string {
+	if strings.Contains(desc, "\n") {
+		return multiLine(desc, indent)
+	}
+	return escapedString(desc)
+}
+
+// multiLine returns a description of more than one line as a block string, with the quotes and each line on
+// separate lines indented by indent (which is removed when the block string is parsed).  Since parsing a block
+// string also removes blank lines at the start and end and the common indentation of the lines (eg if every line
+// starts with a space) in those cases a string value is returned instead, with the newlines escaped.
+func multiLine(desc, indent string) string {
+	lines := strings.Split(desc, "\n")
+	if strings.TrimSpace(lines[0]) == "" || strings.TrimSpace(lines[len(lines)-1]) == "" || commonIndent(lines) > 0 {
+		return escapedString(desc)
+	}
+	builder := &strings.Builder{}
+	builder.WriteString(`"""` + "\n")
+	for _, line := range lines {
+		if line != "" {
+			builder.WriteString(indent)
+			builder.WriteString(strings.ReplaceAll(line, `"""`, `\"""`))
+		}
+		builder.WriteRune('\n')
+	}
+	builder.WriteString(indent)
+	builder.WriteString(`"""`)
+	return builder.String()
+}
+
+// commonIndent returns the smallest number of spaces/tabs at the start of the lines (ignoring blank lines)
+func commonIndent(lines []string) int {
+	r := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); r == -1 || n < r {
+			r = n
+		}
+	}
+	return r
+}
+
+// escapedString returns a description as a GraphQL string value (in double quotes) with special characters escaped
+func escapedString(desc string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(desc) + `"`
+}
@@ -0,0 +1,31 @@
+package schema
+
+// directive.go implements the Directives build option which declares custom directives in the generated schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Directives returns a build option that declares custom directives (eg @auth) in the schema, so that they can be
+// used in the egg: tag of fields (eg `egg:",@auth(role: \"admin\")"`).  Each definition is the text that follows
+// the directive keyword in the SDL, eg `@auth(role: String!) on FIELD_DEFINITION`.
+func Directives(definitions ...string) BuildOption {
+	return func(s *schema) {
+		s.directives = append(s.directives, definitions...)
+	}
+}
+
+// writeDirectives adds the declarations of the custom directives to the schema text
+func (s schema) writeDirectives(builder *strings.Builder) error {
+	for _, definition := range s.directives {
+		definition = strings.TrimSpace(definition)
+		if !strings.HasPrefix(definition, "@") || !strings.Contains(definition, " on ") {
+			return fmt.Errorf("directive definition %q must be of the form @name(args) on LOCATION", definition)
+		}
+		builder.WriteString("directive ")
+		builder.WriteString(definition)
+		builder.WriteRune('\n')
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package schema_test
 // errors_test.go has table-driven tests for error conditions in calls to schema.Build
 
 import (
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -24,6 +25,9 @@ type (
 		En int    `egg:"e:Unit"`
 		Sc CustScalarInt
 	}
+	InputLists struct {
+		Es []int `egg:"es:[Unit]"`
+	}
 )
 
 var (
@@ -102,7 +106,8 @@ func TestSchemaErrors(t *testing.T) {
 				Query `egg:":SingleInt"`
 			}{}, nil, "same name",
 		},
-		"InvalidTypeName": {struct{ QueryBadName }{}, nil, "not a valid name"},
+		"InvalidTypeName":   {struct{ QueryBadName }{}, nil, "not a valid name"},
+		"GoInterfaceNoImpl": {struct{ V Vehicle }{}, nil, "no object type implements Go interface"},
 		"BadReserved": {
 			struct {
 				Message string `egg:"__message"`
@@ -113,6 +118,43 @@ func TestSchemaErrors(t *testing.T) {
 				Fa func(int8) string `egg:",params(i)"` // params should be args
 			}{}, nil, "unknown option",
 		},
+		"RateLimitPeriod": {
+			struct {
+				Fa func() int `egg:",rateLimit=10/w"` // weeks not supported
+			}{}, nil, "period must be",
+		},
+		"RateLimitCount": {
+			struct {
+				Fa func() int `egg:",rateLimit=/m"`
+			}{}, nil, "positive count",
+		},
+		"UnregisteredDefault": {
+			struct {
+				Fa func([]int) int `egg:"(list=$no_such_list)"`
+			}{}, nil, "has not been registered",
+		},
+		"InitialNotFound": {
+			struct {
+				S <-chan int `egg:",initial=Current"`
+			}{}, nil, "not found",
+		},
+		"InitialType": {
+			struct {
+				S       <-chan int `egg:",initial=Current"`
+				Current string     `egg:"-"`
+			}{}, nil, "channel type is int",
+		},
+		"InitialNotChan": {
+			struct {
+				S       int `egg:",initial=Current"`
+				Current int `egg:"-"`
+			}{}, nil, "not a subscription",
+		},
+		"OptionalNotFunc": {
+			struct {
+				S string `egg:",optional_func"`
+			}{}, nil, "is not a function",
+		},
 		"NoReturn": {struct{ Fa func() }{}, nil, "must return a value"},
 		"BadParam1": {
 			struct {
@@ -318,6 +360,16 @@ func TestSchemaErrors(t *testing.T) {
 				V map[bool]int `egg:",subscript"`
 			}{}, nil, "map key for subscript option",
 		},
+		"SubscriptFuncScalar": {
+			struct {
+				V func() (int, error) `egg:",subscript"`
+			}{}, nil, "cannot use subscript option",
+		},
+		"SubscriptFuncArgs": {
+			struct {
+				V func(int) []int `egg:"(i),subscript"`
+			}{}, nil, `cannot use "subscript" option if args`,
+		},
 
 		"ArgDefaultBool": {
 			struct {
@@ -389,6 +441,11 @@ func TestSchemaErrors(t *testing.T) {
 				F func([]int) string `egg:"(ii=[s])"`
 			}{}, nil, "not of the correct type ([Int",
 		},
+		"ArgDefaultIntID": {
+			struct {
+				F func(int) bool `egg:"(id:ID=\"abc\")"` // integer ID must be numeric
+			}{}, nil, "not of the correct type (ID)",
+		},
 		"ArgDefaultListID": {
 			struct {
 				F func([]string) string `egg:"(ids:[ID]=[\"1\", 2, 3.14])"` // float (3.14) is not an ID literal
@@ -439,6 +496,16 @@ func TestSchemaErrors(t *testing.T) {
 				F func(defaults InputDefaults) int `egg:"(in={id:\"4-7\",e:FOOT,sc:abc})"`
 			}{}, enums, "not valid for custom scalar",
 		},
+		"ArgDefaultInputList": {
+			struct {
+				F func(InputLists) int `egg:"(in={es:[FOOT, \"x,y\"]})"` // string in list of enums
+			}{}, enums, "not a valid enum value",
+		},
+		"ArgDefaultInputNull": {
+			struct {
+				F func(SingleInt) int `egg:"(si={i:null})"` // i is not nullable
+			}{}, nil, "not valid for non-nullable",
+		},
 		"IDSameAsFieldName": {
 			struct {
 				Slice []SingleInt `egg:",field_id=i"`
@@ -468,3 +535,88 @@ func TestSchemaErrors(t *testing.T) {
 		})
 	}
 }
+
+// TestStrict tests that the Strict option reports problems that are otherwise ignored
+func TestStrict(t *testing.T) {
+	type nested struct{ F func() int }
+	tests := map[string]struct {
+		data    interface{}
+		problem string // expected error in strict mode (empty if no error is expected)
+	}{
+		"OK": {struct{ F func() int }{func() int { return 1 }}, ""},
+		"UnexportedTag": {struct {
+			A, b int `egg:"b"`
+		}{}, "unexported field \"b\""},
+		"UnexportedFunc": {struct{ f func() int }{}, "is a func"},
+		"UnexportedData": {struct{ A, b int }{}, ""},
+		"Omitted": {struct {
+			F func() int `egg:"-"`
+		}{}, ""},
+		"NilFunc": {struct{ F func() int }{}, "resolver func F is nil"},
+		"OptionalFunc": {struct {
+			F func() int `egg:",optional_func"`
+		}{}, ""},
+		"NilNested": {struct{ N *nested }{&nested{}}, "resolver func N.F is nil"},
+		"NilPtr":    {struct{ N *nested }{}, ""},
+		"NilInList": {struct{ L []nested }{[]nested{{}}}, ""}, // lists are not checked
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := schema.Build(nil, test.data)
+			Assertf(t, err == nil, "%-14s: expected no error without Strict, got %v", name, err)
+
+			_, err = schema.Build(nil, test.data, schema.Strict())
+			if test.problem == "" {
+				Assertf(t, err == nil, "%-14s: expected no error, got %v", name, err)
+			} else {
+				Assertf(t, err != nil && strings.Contains(err.Error(), test.problem),
+					"%-14s: expected error %q, got %v", name, test.problem, err)
+			}
+		})
+	}
+}
+
+// TestLiteralLimits tests the limits on the size of default values and enums, and named defaults
+func TestLiteralLimits(t *testing.T) {
+	type input struct{ L []int }
+	var (
+		list   = func([]int) int { return 0 }
+		nested = func([][]int) int { return 0 }
+		str    = func(string) int { return 0 }
+		strs   = func([]string) int { return 0 }
+		obj    = func(input) int { return 0 }
+	)
+	tests := map[string]struct {
+		resolver interface{}
+		tag      string
+		enums    map[string][]string
+		problem  string // expected error (empty if no error is expected)
+	}{
+		"Small":        {resolver: list, tag: `(a=[1,2,3,4])`},
+		"Elements":     {resolver: list, tag: `(a=[1,2,3,4,5])`, problem: "5 elements exceeds the limit of 4"},
+		"Nested":       {resolver: nested, tag: `(a=[[1,2],[3,4,5]])`, problem: "7 elements exceeds the limit of 4"},
+		"ObjectList":   {resolver: obj, tag: `(a={l:[1,2,3,4,5]})`, problem: "5 elements exceeds the limit of 4"},
+		"StringCommas": {resolver: strs, tag: `(a=[\"a,b,c,d,e\"])`},
+		"Length":       {resolver: str, tag: `(a=\"abcdefghijklmnopqrstuvwxyz\")`, problem: "length 28 exceeds the limit of 20"},
+		"Named":        {resolver: list, tag: `(a=$long)`},
+		"Unregistered": {resolver: list, tag: `(a=$no_such_default)`, problem: "has not been registered"},
+		"Enum": {resolver: list, tag: `(a)`, enums: map[string][]string{"E": {"A", "B", "C"}},
+			problem: "3 values exceeds the limit of 2"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			q := reflect.New(reflect.StructOf([]reflect.StructField{{
+				Name: "F", Type: reflect.TypeOf(test.resolver), Tag: reflect.StructTag(`egg:"` + test.tag + `"`),
+			}})).Elem().Interface()
+
+			_, err := schema.Build(test.enums, q, schema.LiteralLimits(20, 4, 2),
+				schema.NamedDefault("long", "[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12]"))
+			if test.problem == "" {
+				Assertf(t, err == nil, "%-14s: expected no error, got %v", name, err)
+			} else {
+				Assertf(t, err != nil && strings.Contains(err.Error(), test.problem),
+					"%-14s: expected error %q, got %v", name, test.problem, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package schema
+
+// goenum.go finds the enums declared using Go types (see field.EnumValuer) so that they can be added to the schema
+// along with the enums passed in the map of enums
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+)
+
+// addGoEnums returns the map of enums with the enums (Go types with an EnumValues method) added that are used by
+// the query, mutation and subscription structs (or registered types).  The map passed in is not modified.
+func (s schema) addGoEnums(rawEnums map[string][]string, qms ...interface{}) (map[string][]string, error) {
+	found := make(map[string]reflect.Type)
+	seen := make(map[reflect.Type]bool)
+	for _, q := range qms {
+		if q == nil {
+			continue
+		}
+		if err := findGoEnums(reflect.TypeOf(q), found, seen); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range s.types {
+		if t == nil {
+			continue // reported by addTypes
+		}
+		if err := findGoEnums(t, found, seen); err != nil {
+			return nil, err
+		}
+	}
+	if len(found) == 0 {
+		return rawEnums, nil
+	}
+
+	r := make(map[string][]string, len(rawEnums)+len(found))
+	for name, values := range rawEnums {
+		r[name] = values
+		name = strings.TrimRight(strings.Split(name, "#")[0], " ")
+		if t, ok := found[name]; ok {
+			return nil, fmt.Errorf("enum %q is declared by the Go type %v and in the map of enums", name, t)
+		}
+	}
+	for name, t := range found {
+		r[name] = field.EnumValues(t)
+	}
+	return r, nil
+}
+
+// findGoEnums adds to found the enum types used (directly or indirectly) by the type t
+func findGoEnums(t reflect.Type, found map[string]reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	if name, ok := field.EnumName(t); ok {
+		if previous, ok := found[name]; ok && previous != t {
+			return fmt.Errorf("different Go types (%v and %v) have the same enum name %q", previous, t, name)
+		}
+		found[name] = t
+		return nil
+	}
+	if field.IsOrderedMap(t) {
+		return findGoEnums(field.ElemType(t), found, seen)
+	}
+
+	var types []reflect.Type // types used by t
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Chan:
+		types = append(types, t.Elem())
+	case reflect.Map:
+		types = append(types, t.Key(), t.Elem())
+	case reflect.Func:
+		for i := 0; i < t.NumIn(); i++ {
+			types = append(types, t.In(i))
+		}
+		for i := 0; i < t.NumOut(); i++ {
+			types = append(types, t.Out(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			// Only exported fields, embedded structs and dummy fields (eg _ [0]Human) are used in the schema
+			if f.IsExported() || f.Anonymous || f.Name == "_" {
+				types = append(types, f.Type)
+			}
+		}
+	}
+	for _, used := range types {
+		if err := findGoEnums(used, found, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
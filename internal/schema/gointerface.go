@@ -0,0 +1,135 @@
+package schema
+
+// gointerface.go generates a GraphQL interface (or union) for a Go interface type used as the type of a field,
+// eg Hero func(episode int) Character, where Human and Droid (structs) implement the Go interface Character
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+)
+
+// isGoInterface returns true for a named Go interface type that has methods (ie not interface{})
+func isGoInterface(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.NumMethod() > 0 && t.Name() != ""
+}
+
+// addGoInterface remembers a Go interface type used for a field, so that the GraphQL type can be declared once
+// all the object types are known (see declareGoInterfaces)
+func (s schema) addGoInterface(t reflect.Type) (string, error) {
+	name := field.TypeName(t)
+	if previous, ok := s.goInterfaces[name]; ok && previous != t {
+		return "", fmt.Errorf("different Go interfaces (%v and %v) have the same name %q", previous, t, name)
+	}
+	s.goInterfaces[name] = t
+	return name, nil
+}
+
+// declareGoInterfaces adds a GraphQL type for each Go interface used for a field.  The implementations are the
+// object types (structs) of the schema that implement the Go interface (using a value or pointer receiver).
+// The GraphQL type is an interface, with the fields that all the implementations have in common, or a union if
+// they have no fields in common.
+func (s schema) declareGoInterfaces() error {
+	names := make([]string, 0, len(s.goInterfaces))
+	for name := range s.goInterfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := s.declaration[name]; ok {
+			return fmt.Errorf("Go interface %q has the same name as an object type", name)
+		}
+		if _, ok := s.unions[name]; ok {
+			return fmt.Errorf("Go interface %q has the same name as a union", name)
+		}
+
+		implementations := s.implementations(s.goInterfaces[name])
+		if len(implementations) == 0 {
+			return fmt.Errorf("no object type implements Go interface %q (register the types or add a field of each type, eg _ [0]T)", name)
+		}
+		common := s.commonFields(implementations)
+		if len(common) == 0 {
+			u := union{objects: make(map[string]struct{}, len(implementations))}
+			for _, implName := range implementations {
+				u.objects[implName] = struct{}{}
+			}
+			s.unions[name] = u
+			continue
+		}
+
+		builder := &strings.Builder{}
+		builder.WriteString(gqlInterfaceKeyword + " " + name + openString)
+		for _, k := range common {
+			builder.WriteString(s.fields[implementations[0]][k])
+		}
+		builder.WriteString(closeString)
+		s.declaration[name] = builder.String()
+		for _, implName := range implementations {
+			decl := s.declaration[implName]
+			i := strings.Index(decl, openString)
+			sep := implementsString + " "
+			if strings.Contains(decl[:i], implementsString) {
+				sep = " & "
+			}
+			s.declaration[implName] = decl[:i] + sep + name + decl[i:]
+		}
+	}
+	return nil
+}
+
+// implementations returns the (sorted) names of the object types whose structs implement a Go interface
+func (s schema) implementations(iface reflect.Type) []string {
+	var r []string
+	for t, gqlType := range s.usedAs {
+		if gqlType != gqlObjectTypeKeyword || s.roots[t] {
+			continue
+		}
+		name := field.TypeName(t)
+		if _, ok := s.declaration[name]; !ok || name == "" {
+			continue
+		}
+		if t.Implements(iface) || reflect.PtrTo(t).Implements(iface) {
+			r = append(r, name)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// commonFields returns the (sorted) names of the fields that all the object types have, with the same type and
+// arguments (descriptions may differ)
+func (s schema) commonFields(names []string) []string {
+	var r []string
+	for k, decl := range s.fields[names[0]] {
+		common := true
+		for _, name := range names[1:] {
+			if other, ok := s.fields[name][k]; !ok || withoutDescription(other) != withoutDescription(decl) {
+				common = false
+				break
+			}
+		}
+		if common {
+			r = append(r, k)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// withoutDescription removes the description (if any) from the start of the declaration of a field
+func withoutDescription(decl string) string {
+	if strings.HasPrefix(decl, `  """`) {
+		if i := strings.Index(decl[5:], `"""`+"\n"); i >= 0 {
+			return decl[5+i+4:]
+		}
+	} else if strings.HasPrefix(decl, `  "`) {
+		// a string value (see multiLine) has no newlines (they are escaped)
+		if i := strings.Index(decl, "\n"); i >= 0 {
+			return decl[i+1:]
+		}
+	}
+	return decl
+}
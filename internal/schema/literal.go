@@ -0,0 +1,99 @@
+package schema
+
+// literal.go limits the size of default values given in the egg: tag (and of enums) and handles named default values
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultMaxLiteralLength etc are the default limits used if the LiteralLimits build option is not given
+	DefaultMaxLiteralLength   = 1024 // max. length (in bytes) of a default value given in a tag
+	DefaultMaxLiteralElements = 100  // max. number of list elements (total of all lists for nested lists)
+	DefaultMaxEnumValues      = 1000 // max. number of values of an enum
+
+	// namedDefaultPrefix marks a default value that is a reference to a named default value (see NamedDefault)
+	namedDefaultPrefix = "$"
+)
+
+// LiteralLimits returns a build option that sets the maximum length (in bytes) of a default value given in a tag,
+// the maximum number of list elements in such a default (including the elements of nested lists) and the maximum
+// number of values of an enum.  A limit <= 0 means no limit.  The limits do not apply to named default values.
+func LiteralLimits(maxLength, maxElements, maxEnumValues int) BuildOption {
+	return func(s *schema) {
+		s.maxLiteralLength, s.maxLiteralElements, s.maxEnumValues = maxLength, maxElements, maxEnumValues
+	}
+}
+
+// NamedDefault returns a build option that saves a (possibly very long) default value so that it can be used in a
+// tag by name, with a dollar sign ($) prefix.  Eg after NamedDefault("ids", "[1,2,3]") a tag can use "(list=$ids)".
+func NamedDefault(name, literal string) BuildOption {
+	return func(s *schema) {
+		if s.namedDefaults == nil {
+			s.namedDefaults = make(map[string]string)
+		}
+		s.namedDefaults[name] = literal
+	}
+}
+
+// getDefault returns the default value given in a tag - either the literal text, which is checked against
+// the size limits, or the named value if a named default ($name) is used.
+func (s schema) getDefault(literal string) (string, error) {
+	if strings.HasPrefix(literal, namedDefaultPrefix) {
+		name := strings.TrimPrefix(literal, namedDefaultPrefix)
+		value, ok := s.namedDefaults[name]
+		if !ok {
+			return "", fmt.Errorf("default value %q has not been registered", name)
+		}
+		return value, nil
+	}
+	if s.maxLiteralLength > 0 && len(literal) > s.maxLiteralLength {
+		return "", fmt.Errorf("default value of length %d exceeds the limit of %d - use a named default instead",
+			len(literal), s.maxLiteralLength)
+	}
+	if s.maxLiteralElements > 0 {
+		if n := countListElements(literal); n > s.maxLiteralElements {
+			return "", fmt.Errorf("default value list with %d elements exceeds the limit of %d - use a named default instead",
+				n, s.maxLiteralElements)
+		}
+	}
+	return literal, nil
+}
+
+// checkEnumSizes returns an error if an enum has more values than the limit
+func (s schema) checkEnumSizes(enums map[string][]string) error {
+	if s.maxEnumValues <= 0 {
+		return nil
+	}
+	for name, values := range enums {
+		if len(values) > s.maxEnumValues {
+			return fmt.Errorf("enum %q with %d values exceeds the limit of %d", name, len(values), s.maxEnumValues)
+		}
+	}
+	return nil
+}
+
+// countListElements returns the total number of elements in the list literal(s) in literal, including the
+// elements of nested lists and of lists within objects (commas within strings and objects are not counted)
+func countListElements(literal string) (count int) {
+	literal = strings.TrimSpace(literal)
+	if len(literal) < 2 {
+		return 0
+	}
+	switch literal[0] {
+	case '[':
+		elements := splitLiteral(literal[1:len(literal)-1], ',')
+		count = len(elements)
+		for _, element := range elements {
+			count += countListElements(element)
+		}
+	case '{':
+		for _, f := range splitLiteral(literal[1:len(literal)-1], ',') {
+			if parts := splitLiteral(f, ':'); len(parts) == 2 {
+				count += countListElements(parts[1])
+			}
+		}
+	}
+	return
+}
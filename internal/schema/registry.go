@@ -0,0 +1,39 @@
+package schema
+
+// registry.go implements the Types build option, so that object types that are only returned (at run-time) by
+// resolvers of interface type can be added to the schema without a dummy field like _ [0]Human
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Types returns a build option that adds the object types of the given values (structs or pointers to structs)
+// to the schema, even if they are not reachable from the query, mutation or subscription structs.  This is
+// typically used for the implementations of a GraphQL interface or the members of a union, eg Types(Human{}, Droid{}).
+func Types(values ...interface{}) BuildOption {
+	return func(s *schema) {
+		for _, v := range values {
+			s.types = append(s.types, reflect.TypeOf(v))
+		}
+	}
+}
+
+// addTypes adds the object types given with the Types option to the schema
+func (s schema) addTypes(enums map[string][]string) error {
+	for _, t := range s.types {
+		if t == nil {
+			return fmt.Errorf("registered type cannot be nil")
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || t.Name() == "" {
+			return fmt.Errorf("registered type %v must be a named struct", t)
+		}
+		if err := s.add("", t, enums, gqlObjectTypeKeyword, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
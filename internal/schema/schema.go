@@ -12,6 +12,8 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+
+	"github.com/andrewwphillips/eggql/internal/field"
 )
 
 // EntryPoint is an "enumeration" for the 3 different types of GraphQL entry point (query, mutation, subscription)
@@ -38,6 +40,7 @@ const (
 
 // MustBuild calls Build but panics on error
 // It takes an (optional) map of enums followed by (up to) 3 root objects (query, mutation, subscription)
+// and any build options (eg Strict())
 func MustBuild(qms ...interface{}) string {
 	enums, ok := qms[0].(map[string][]string) // check if enums given
 	if ok {
@@ -58,15 +61,92 @@ func MustBuild(qms ...interface{}) string {
 //     *must* be structs (or nil). Each struct is scanned for exported fields to be used to
 //     generate the query fields.
 //     Any of the 3 can be nil if not implemented, but you must supply at least one.
+//   - any build options (eg Strict()) follow the structs
+//
+// Enums can also be declared using a named Go integer type with an EnumValues method (see field.EnumValuer) -
+// these are found automatically if used by the structs (or registered types).
 func Build(rawEnums map[string][]string, qms ...interface{}) (string, error) {
+	var entry [3]string             // the names of the 3 root entry points
+	schemaTypes := newSchemaTypes() // all generated GraphQL types
+	for len(qms) > 0 {
+		option, ok := qms[len(qms)-1].(BuildOption)
+		if !ok {
+			break
+		}
+		option(&schemaTypes)
+		qms = qms[:len(qms)-1]
+	}
+	rawEnums, err := schemaTypes.addGoEnums(rawEnums, qms...)
+	if err != nil {
+		return "", err
+	}
 	enums, err := validateEnums(rawEnums)
 	if err != nil {
 		return "", err
 	}
+	if err := schemaTypes.checkEnumSizes(enums); err != nil {
+		return "", err
+	}
+	if err := schemaTypes.addTypes(enums); err != nil {
+		return "", err
+	}
+	if err := schemaTypes.addRoots(&entry, enums, qms); err != nil {
+		return "", err
+	}
+	if err := schemaTypes.declareGoInterfaces(); err != nil {
+		return "", err
+	}
 
-	var entry [3]string             // the names of the 3 root entry points
-	schemaTypes := newSchemaTypes() // all generated GraphQL types
+	// Build the schema from the found types (and supplied enums) and return it as text
+	return schemaTypes.build(rawEnums, entry)
+}
+
+// BuildAll is like Build but takes more than one set of query, mutation and subscription structs (eg provided by
+// different modules), generating a single schema.  The first struct for each of query, mutation and subscription
+// declares the type, and the fields of later structs are added using "extend type" (fields declared in more than
+// one struct must be the same).  Similarly, an object type declared by an earlier set is extended by a different
+// struct (with the same GraphQL type name) in a later set, eg so a plugin can add fields to a core type.  Within a
+// set it is an error if different structs (types) generate different declarations with the same name.  (Use the
+// Stitched option to make it an error for later sets to extend types declared by earlier ones.)
+func BuildAll(rawEnums map[string][]string, sets [][3]interface{}, options ...BuildOption) (string, error) {
+	var entry [3]string // the names of the 3 root entry points (from the first set that has them)
+	schemaTypes := newSchemaTypes()
+	for _, option := range options {
+		option(&schemaTypes)
+	}
+	var all []interface{}
+	for _, qms := range sets {
+		all = append(all, qms[:]...)
+	}
+	rawEnums, err := schemaTypes.addGoEnums(rawEnums, all...)
+	if err != nil {
+		return "", err
+	}
+	enums, err := validateEnums(rawEnums)
+	if err != nil {
+		return "", err
+	}
+	if err := schemaTypes.checkEnumSizes(enums); err != nil {
+		return "", err
+	}
+	if err := schemaTypes.addTypes(enums); err != nil {
+		return "", err
+	}
+	for i, qms := range sets {
+		*schemaTypes.set = i
+		if err := schemaTypes.addRoots(&entry, enums, qms[:]); err != nil {
+			return "", err
+		}
+	}
+	if err := schemaTypes.declareGoInterfaces(); err != nil {
+		return "", err
+	}
+	return schemaTypes.build(rawEnums, entry)
+}
 
+// addRoots adds the root query, mutation and subscription types (and recursively the types they use) to the schema.
+// If a root type has already been added (entry[i] is not empty) the new struct extends it.
+func (s schema) addRoots(entry *[3]string, enums map[string][]string, qms []interface{}) error {
 	for i, v := range qms {
 		if v == nil {
 			continue // skip it
@@ -77,38 +157,83 @@ func Build(rawEnums map[string][]string, qms ...interface{}) (string, error) {
 			t = t.Elem()
 		}
 		if t.Kind() != reflect.Struct {
-			return "", errors.New("parameters to schema.Build must be structs")
+			return errors.New("parameters to schema.Build must be structs")
+		}
+		if i >= len(entry) {
+			return errors.New("More than 3 structs provided (at most should have: query, mutation, subscription)")
 		}
 
-		// Note: we call getTypeName just for the root type name.  We don't care about the other return
-		// values since we know it's a struct (2nd return value will always be false, 3rd will be nil).
-		// We pass nullable = true as we don't want the trailing exclamation mark (!)
-		entry[i], _, err = schemaTypes.getTypeName(t, true)
-		if err != nil {
-			panic("type of root object (struct) should always be valid")
+		if entry[i] != "" {
+			s.roots[t] = true // root type already declared (by an earlier set) so this struct extends it
+		} else {
+			// Note: we call getTypeName just for the root type name.  We don't care about the other return
+			// values since we know it's a struct (2nd return value will always be false, 3rd will be nil).
+			// We pass nullable = true as we don't want the trailing exclamation mark (!)
+			var err error
+			entry[i], _, err = s.getTypeName(t, true)
+			if err != nil {
+				panic("type of root object (struct) should always be valid")
+			}
+
+			if entry[i] == "" { // if given an unnamed struct we use the default name
+				switch EntryPoint(i) {
+				case Query:
+					entry[i] = "Query"
+				case Mutation:
+					entry[i] = "Mutation"
+				case Subscription:
+					entry[i] = "Subscription"
+				}
+			}
 		}
 
-		if entry[i] == "" { // if given an unnamed struct we use the default name
-			switch EntryPoint(i) {
-			case Query:
-				entry[i] = "Query"
-			case Mutation:
-				entry[i] = "Mutation"
-			case Subscription:
-				entry[i] = "Subscription"
-			default:
-				return "", errors.New("More than 3 structs provided (at most should have: query, mutation, subscription)")
+		if EntryPoint(i) == Subscription {
+			if err := checkSubscription(t); err != nil {
+				return fmt.Errorf("%w in entry point %d %q", err, i, entry[i])
 			}
 		}
 
 		// *** Add root type and (recursively) any contained types ***
-		if err := schemaTypes.add(entry[i], t, enums, gqlObjectTypeKeyword, nil); err != nil {
-			return "", fmt.Errorf("%w adding entry point %d %q", err, i, entry[i])
+		if err := s.add(entry[i], t, enums, gqlObjectTypeKeyword, nil); err != nil {
+			return fmt.Errorf("%w adding entry point %d %q", err, i, entry[i])
+		}
+		if err := s.checkNilFuncs(reflect.ValueOf(v)); err != nil {
+			return fmt.Errorf("%w in entry point %d %q", err, i, entry[i])
 		}
 	}
+	return nil
+}
 
-	// Build the schema from the found types (and supplied enums) and return it as text
-	return schemaTypes.build(rawEnums, entry)
+// checkSubscription returns an error listing the fields of the root subscription struct (t) that are not (and do
+// not return) a channel, since a subscription's events are the values received from the channel
+func checkSubscription(t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := make(map[string]goField)
+	var wildcard bool
+	if err := addGoFields(t, fields, &wildcard); err != nil {
+		return err
+	}
+	var bad []string
+	for name, gf := range fields {
+		tf := gf.f
+		fieldInfo, err := field.Get(gf.t, &tf)
+		if err != nil {
+			return fmt.Errorf("%w getting field %q", err, tf.Name)
+		}
+		if !fieldInfo.IsChan {
+			bad = append(bad, fmt.Sprintf("%s (%s)", name, tf.Type))
+		}
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("subscription fields must be (or return) a receive channel: %s", strings.Join(bad, ", "))
+	}
+	return nil
 }
 
 // build creates the full schema text from the type declarations and unions members + enum param
@@ -162,14 +287,22 @@ func (s schema) build(rawEnums map[string][]string, entry [3]string) (string, er
 	sort.Strings(names)
 	for _, name := range names { // append each "type" to the schema
 		if s.description[name] != "" {
-			builder.WriteString(`"""`)
-			builder.WriteString(s.description[name])
-			builder.WriteString(`"""`)
+			builder.WriteString(blockString(s.description[name], ""))
 			builder.WriteRune('\n')
 		}
 		builder.WriteString(s.declaration[name])
 	}
 
+	// *** Extensions of types declared by an earlier set of structs (see BuildAll)
+	names = names[:0]
+	for name := range s.extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		builder.WriteString(s.extensions[name])
+	}
+
 	// *** Unions - work out order of unions and length
 	names = make([]string, 0, len(s.unions))
 	objectsLength = 0
@@ -189,9 +322,7 @@ func (s schema) build(rawEnums map[string][]string, entry [3]string) (string, er
 	sort.Strings(names)
 	for _, unionName := range names { // append all the unions to the schema
 		if s.unions[unionName].desc != "" {
-			builder.WriteString(`"""`)
-			builder.WriteString(s.unions[unionName].desc)
-			builder.WriteString(`"""`)
+			builder.WriteString(blockString(s.unions[unionName].desc, ""))
 			builder.WriteRune('\n')
 
 		}
@@ -237,9 +368,8 @@ func (s schema) build(rawEnums map[string][]string, entry [3]string) (string, er
 	for _, enumName := range names { // add all the enums
 		parts = strings.SplitN(enumName, "#", 2)
 		if len(parts) > 1 && parts[1] != "" {
-			builder.WriteRune('"')
-			builder.WriteString(parts[1])
-			builder.WriteString("\"\n")
+			builder.WriteString(quotedString(parts[1], ""))
+			builder.WriteRune('\n')
 		}
 		builder.WriteString(gqlEnumKeyword)
 		builder.WriteRune(' ')
@@ -248,9 +378,9 @@ func (s schema) build(rawEnums map[string][]string, entry [3]string) (string, er
 		for _, v := range rawEnums[enumName] {
 			parts = strings.SplitN(v, "#", 2)
 			if len(parts) > 1 && parts[1] != "" {
-				builder.WriteString(" \"")
-				builder.WriteString(parts[1])
-				builder.WriteString("\"\n")
+				builder.WriteRune(' ')
+				builder.WriteString(quotedString(parts[1], " "))
+				builder.WriteRune('\n')
 			}
 			builder.WriteRune(' ')
 			builder.WriteString(parts[0])
@@ -273,5 +403,10 @@ func (s schema) build(rawEnums map[string][]string, entry [3]string) (string, er
 		builder.WriteRune('\n')
 	}
 
+	// *** Custom directives
+	if err := s.writeDirectives(builder); err != nil {
+		return "", err
+	}
+
 	return builder.String(), nil
 }
@@ -3,9 +3,9 @@ package schema
 // schemaTypes.go contains the schema Type which accumulates all the GraphQL type to be added to the schema
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"reflect"
 	"sort"
 	"strings"
@@ -24,12 +24,40 @@ type (
 		usedAs      map[reflect.Type]string // tracks which types (structs) we have seen and their GraphQL "type" (type/input/interface) - this is mainly to handle recursive data structures
 		unions      map[string]union        // key is union name
 		scalars     *[]string               // names of custom scalar types (implement MarshalEGGQL/UnmarshalEGGQL)
+
+		// roots are the (Go) types of root query, mutation and subscription structs that extend a root type already
+		// declared by an earlier struct (see BuildAll) - their fields are added using "extend type".
+		roots      map[reflect.Type]bool
+		fields     map[string]map[string]string // field declarations of each type (outer map key is the type name)
+		extensions map[string]string            // text of "extend" declarations for each type
+		// set is the number of the set of structs being added (see BuildAll) and declaredIn is the set that
+		// declared each (object) type, so that an object type declared by an earlier set can be extended
+		set        *int
+		declaredIn map[string]int
+		declaredBy map[string]reflect.Type // Go type of each (object) type, for reporting conflicts (see Stitched)
+
+		// goInterfaces are the Go interface types used for fields, for which a GraphQL interface (or union) is
+		// declared after all the object types have been added (see declareGoInterfaces)
+		goInterfaces map[string]reflect.Type
+		types        []reflect.Type // object types added with the Types option
+
+		strict     bool     // see Strict
+		stitched   bool     // see Stitched
+		noDateTime bool     // see DateTime
+		directives []string // declarations of custom directives (see Directives)
+
+		dateTimeFormat string // layout of DateTime values (see DateTimeFormat)
+
+		// limits on the size of default values in tags and enums (see LiteralLimits) and named defaults (see NamedDefault)
+		maxLiteralLength, maxLiteralElements, maxEnumValues int
+		namedDefaults                                       map[string]string
 	}
 
 	// objectField stores info on one field to be added to a GraphQL object
 	objectField struct {
 		name string
 		typ  reflect.Type
+		desc string // description of the field (may be empty)
 	}
 
 	// union contains details used to generate one GraphQL union
@@ -48,6 +76,20 @@ func newSchemaTypes() schema {
 		usedAs:      make(map[reflect.Type]string),
 		unions:      make(map[string]union),
 		scalars:     &[]string{},
+		roots:       make(map[reflect.Type]bool),
+		fields:      make(map[string]map[string]string),
+		extensions:  make(map[string]string),
+		set:         new(int),
+		declaredIn:  make(map[string]int),
+		declaredBy:  make(map[string]reflect.Type),
+
+		goInterfaces: make(map[string]reflect.Type),
+
+		dateTimeFormat: field.DefaultDateTimeFormat,
+
+		maxLiteralLength:   DefaultMaxLiteralLength,
+		maxLiteralElements: DefaultMaxLiteralElements,
+		maxEnumValues:      DefaultMaxEnumValues,
 	}
 }
 
@@ -67,17 +109,18 @@ func (s schema) add(name string, t reflect.Type, enums map[string][]string, gqlT
 ) error {
 	needName := name == ""
 	if needName {
-		name = t.Name()
+		name = field.TypeName(t)
 	} else if name[len(name)-1] == '!' {
 		name = name[:len(name)-1]
 	}
 	// TODO check if (effective type) of t can ever be func at this point - remove reflect.Func from loop/switch below?
 	// follow indirection(s) and function return(s)
-	for k := t.Kind(); k == reflect.Ptr || k == reflect.Func || k == reflect.Map || k == reflect.Slice || k == reflect.Array; k = t.Kind() {
+	for k := t.Kind(); k == reflect.Ptr || k == reflect.Func || k == reflect.Map || k == reflect.Slice || k == reflect.Array ||
+		field.IsOrderedMap(t); k = t.Kind() {
 		switch k {
 		case reflect.Ptr:
 			t = t.Elem() // follow indirection
-		case reflect.Map, reflect.Slice, reflect.Array:
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct: // struct = ordered map
 			if !needName {
 				// Get the element type name from within the square brackets
 				if len(name) < 2 || name[0] != '[' && name[len(name)-1] != ']' {
@@ -89,7 +132,7 @@ func (s schema) add(name string, t reflect.Type, enums map[string][]string, gqlT
 				}
 			}
 
-			t = t.Elem() // element type
+			t = field.ElemType(t) // element type
 		case reflect.Func:
 			if t.NumOut() == 0 {
 				panic("Resolver func must have at least one return value")
@@ -97,7 +140,7 @@ func (s schema) add(name string, t reflect.Type, enums map[string][]string, gqlT
 			t = t.Out(0) // get 1st return value (panics if nothing is returned)
 		}
 		if needName {
-			name = t.Name()
+			name = field.TypeName(t)
 		}
 	}
 	if t.Kind() != reflect.Struct {
@@ -168,6 +211,9 @@ func (s schema) add(name string, t reflect.Type, enums map[string][]string, gqlT
 			return fmt.Errorf("%w getting type for ID field %q in %q", err, idField.name, name)
 		}
 		required += 4 + len(idField.name) + len(idTypeName)
+		if idField.desc != "" {
+			required += 2 + 2*len(`"""`) + len(idField.desc) + 1
+		}
 	}
 	// Get space for resolvers AND get a sorted list of resolver keys so resolvers are always written in the same order
 	keys := make([]string, 0, len(resolvers))
@@ -197,6 +243,12 @@ func (s schema) add(name string, t reflect.Type, enums map[string][]string, gqlT
 	builder.WriteString(openString)
 	if idField != nil {
 		// Add fabricated ID field
+		if idField.desc != "" {
+			builder.WriteString(`  """`)
+			builder.WriteString(idField.desc)
+			builder.WriteString(`"""`)
+			builder.WriteRune('\n')
+		}
 		builder.WriteString("  ")
 		builder.WriteString(idField.name)
 		builder.WriteRune(':')
@@ -212,15 +264,51 @@ func (s schema) add(name string, t reflect.Type, enums map[string][]string, gqlT
 	// Check for use of the same name for different objects
 	if existing, ok := s.declaration[name]; ok {
 		if builder.String() != existing {
+			if s.roots[t] || gqlType == gqlObjectTypeKeyword && s.declaredIn[name] < *s.set {
+				// a root type, or an object type of an earlier set of structs (eg a core type extended by a plugin)
+				if s.stitched && !s.roots[t] {
+					return fmt.Errorf("different Go types (%v and %v) have the same name %q (stitched schema)",
+						s.declaredBy[name], t, name)
+				}
+				return s.extend(name, gqlType, resolvers, keys)
+			}
 			// Somehow we have the different objects with the same name
 			return fmt.Errorf("same name (%s) used for multiple objects", name)
 		}
 	}
 	s.declaration[name] = builder.String()
+	s.fields[name] = resolvers
+	s.declaredIn[name] = *s.set
+	s.declaredBy[name] = t
 	s.description[name] = desc
 	actual := len(s.declaration[name])
 	if required != actual {
-		log.Fatalln("string buffer size was incorrect", required, actual)
+		return fmt.Errorf("internal error: declaration of %s is %d bytes but %d were expected", name, actual, required)
+	}
+	return nil
+}
+
+// extend adds an "extend" declaration with the fields of a type that have not already been declared, so that
+// more than one struct (eg from different modules) can provide fields of the query, mutation or subscription, or of
+// an object type declared by an earlier set of structs.
+// It returns an error if a field is declared differently by different structs.
+func (s schema) extend(name, gqlType string, resolvers map[string]string, keys []string) error {
+	builder := &strings.Builder{}
+	for _, k := range keys {
+		if existing, ok := s.fields[name][k]; ok {
+			if existing != resolvers[k] {
+				return fmt.Errorf("field %q of %q is declared differently by more than one struct", k, name)
+			}
+			if s.stitched {
+				return fmt.Errorf("field %q of %q is provided by more than one struct (stitched schema)", k, name)
+			}
+			continue // already declared (the first struct with the field will be used to resolve it)
+		}
+		s.fields[name][k] = resolvers[k]
+		builder.WriteString(resolvers[k])
+	}
+	if builder.Len() > 0 {
+		s.extensions[name] += "extend " + gqlType + " " + name + openString + builder.String() + closeString
 	}
 	return nil
 }
@@ -251,7 +339,7 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 		if tf.Name == "_" {
 			if tf.Type.Name() == "TagHolder" { // name must match the type declared in run.go
 				// the field (otherwise not used) is just included to allow us to get the description from the field tag
-				fieldInfo, err2 := field.Get(&tf)
+				fieldInfo, err2 := field.Get(t, &tf)
 				if err2 != nil {
 					err = fmt.Errorf("%w getting decription from TagHolder", err2)
 					return
@@ -266,9 +354,16 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 			}
 		}
 	}
+	// A description registered in code (see field.Describe) takes precedence over one from a TagHolder
+	if meta, ok := field.GetMeta(t, "_"); ok && meta.Description != "" {
+		desc = meta.Description
+	}
 	for i := 0; i < t.NumField(); i++ {
 		tf := t.Field(i)
-		fieldInfo, err2 := field.Get(&tf)
+		if err = s.checkUnexported(t, tf); err != nil {
+			return
+		}
+		fieldInfo, err2 := field.Get(t, &tf)
 		if err2 != nil {
 			err = fmt.Errorf("%w getting field %q", err2, tf.Name)
 			return
@@ -276,6 +371,9 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 		if tf.Name == "_" || fieldInfo == nil {
 			continue // ignore unexported field
 		}
+		if fieldInfo.Wildcard {
+			continue // resolves fields declared in SDL (not in Go)
+		}
 		if fieldInfo.Name != "" && !validGraphQLName(fieldInfo.Name) {
 			err = fmt.Errorf("%q is not a valid name", fieldInfo.Name)
 			return
@@ -289,26 +387,30 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 			u.objects[parentType] = struct{}{} // add to the set of objects in the union
 
 			// Check for any "description" tag field in the union
-			for j := 0; j < tf.Type.NumField(); j++ {
-				tf2 := tf.Type.Field(j)
-				fieldInfo2, err3 := field.Get(&tf2) // just call this to get description for union
+			ut := fieldInfo.ResultType // the embedded struct (tf.Type may be a pointer to it)
+			for j := 0; j < ut.NumField(); j++ {
+				tf2 := ut.Field(j)
+				fieldInfo2, err3 := field.Get(ut, &tf2) // just call this to get description for union
 				if (u.desc != "" && u.desc != fieldInfo2.Description) || err3 != nil {
 					// we should not get here - panic?
 					return nil, nil, "", errors.New("Error in union description for " + tf2.Name)
 				}
 				u.desc = fieldInfo2.Description
 			}
+			if meta, ok := field.GetMeta(ut, "_"); ok && meta.Description != "" {
+				u.desc = meta.Description
+			}
 			s.unions[tf.Name] = u
 			continue // embedding empty struct just signals a "union" so don't add a resolver for this
 		} else if fieldInfo.Embedded {
 			// Add struct to our collection as an "interface"
-			if err2 = s.add(fieldInfo.GQLTypeName, tf.Type, enums, gqlInterfaceKeyword, nil); err2 != nil {
+			if err2 = s.add(fieldInfo.GQLTypeName, fieldInfo.ResultType, enums, gqlInterfaceKeyword, nil); err2 != nil {
 				err = fmt.Errorf("%w adding embedded (interface) type %q", err2, tf.Name)
 				return
 			}
 
 			// Get the resolvers from the embedded struct (GraphQL "interface")
-			resolvers, interfaces, _, err2 := s.getResolvers(parentType, tf.Type, enums, gqlType)
+			resolvers, interfaces, _, err2 := s.getResolvers(parentType, fieldInfo.ResultType, enums, gqlType)
 			if err2 != nil {
 				// We shouldn't ever get to here - getResolvers for this struct has already been called w/o error in above s.add() method call
 				//err = fmt.Errorf("%w adding embedded resolvers for %q", err2, f.Name); return
@@ -330,7 +432,7 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 		// Get any description text to add to the schema
 		var resolverDesc string
 		if fieldInfo.Description != "" {
-			resolverDesc = `  """` + fieldInfo.Description + `"""` + "\n"
+			resolverDesc = "  " + blockString(fieldInfo.Description, "  ") + "\n"
 		}
 
 		var idField *objectField
@@ -344,7 +446,9 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 				return
 			}
 			effectiveType = fieldInfo.ResultType
-			idField = &objectField{name: fieldInfo.Subscript, typ: fieldInfo.IndexType}
+			idField = &objectField{name: fieldInfo.Subscript, typ: fieldInfo.IndexType, desc: idDescription(fieldInfo)}
+		} else if fieldInfo.Batch {
+			effectiveType = tf.Type.Out(0).Elem() // a batch resolver has no arguments and returns a slice of results
 		} else if tf.Type.Kind() == reflect.Func {
 			// Get resolver arguments (if any) from the "args" option - eg "(p1:String!, p2:Int!=42)"
 			params, err2 = s.getParams(tf.Type, enums, fieldInfo)
@@ -367,16 +471,38 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 			effectiveType = tf.Type
 		}
 
+		if fieldInfo.Initial != "" {
+			if err2 = checkInitial(t, fieldInfo.Initial, effectiveType); err2 != nil {
+				err = fmt.Errorf("%w for subscription %q", err2, fieldInfo.Name)
+				return
+			}
+		}
+
 		if fieldInfo.FieldID != "" {
 			if idField != nil {
 				panic("can't use both subscript and field_id on the same map/slice field")
 			}
-			idField = &objectField{name: fieldInfo.FieldID, typ: fieldInfo.IndexType}
+			idField = &objectField{name: fieldInfo.FieldID, typ: fieldInfo.IndexType, desc: idDescription(fieldInfo)}
 		}
 
 		// Use resolver return type from the tag (if any) and assume it's not a scalar
 		typeName, isScalar := fieldInfo.GQLTypeName, false
-		if typeName != "" {
+		if fieldInfo.JSON {
+			// A field with the "json" option is a JSON scalar whatever its Go type
+			if typeName != "" {
+				err = fmt.Errorf("cannot give a resolver type (%s) with the json option for field %q", typeName, fieldInfo.Name)
+				return
+			}
+			if gqlType == gqlInputKeyword {
+				err = fmt.Errorf("cannot use the json option for input field %q", fieldInfo.Name)
+				return
+			}
+			typeName, isScalar = field.JSONName, true
+			if !fieldInfo.Nullable {
+				typeName += "!"
+			}
+			s.addScalar(field.JSONName)
+		} else if typeName != "" {
 			// Ensure the name given is valid
 			if isScalar, err2 = s.validateTypeName(typeName, enums, effectiveType); err2 != nil {
 				var help string
@@ -404,13 +530,33 @@ func (s schema) getResolvers(parentType string, t reflect.Type, enums map[string
 			}
 		}
 
+		// A field of an input type can have a default value
+		var defaultValue string
+		if fieldInfo.Default != "" {
+			if gqlType != gqlInputKeyword {
+				err = fmt.Errorf("field %q has a default value (%s) but is not a field of an input type", fieldInfo.Name, fieldInfo.Default)
+				return
+			}
+			var value string
+			if value, err2 = s.getDefault(fieldInfo.Default); err2 != nil {
+				err = fmt.Errorf("%w for input field %q", err2, fieldInfo.Name)
+				return
+			}
+			if err2 = s.validLiteral(typeName, enums, effectiveType, value); err2 != nil {
+				err = fmt.Errorf("%w: default value %q of input field %q is not of the correct type (%s)",
+					err2, value, fieldInfo.Name, typeName)
+				return
+			}
+			defaultValue = " = " + value
+		}
+
 		if _, ok := r[fieldInfo.Name]; ok {
 			// We already have a field with this name - probably due to metadata (field tag) name
 			// Note that this will be caught gqlparser.LoadSchema but we may as well signal it earlier
 			err = fmt.Errorf("two fields with the same name %q", fieldInfo.Name)
 			return
 		}
-		r[fieldInfo.Name] = resolverDesc + "  " + fieldInfo.Name + " " + params + ":" + typeName +
+		r[fieldInfo.Name] = resolverDesc + "  " + fieldInfo.Name + " " + params + ":" + typeName + defaultValue +
 			" " + strings.Join(fieldInfo.Directives, " ") + "\n"
 
 		if !isScalar {
@@ -441,7 +587,21 @@ func (s schema) getSubscript(fieldInfo *field.Info) (string, error) {
 		// TODO check if this restriction is necessary
 		return "", fmt.Errorf("you can't use an object type (%s) as a subscript", fieldInfo.Name)
 	}
-	return fmt.Sprintf("(%s: %s)", fieldInfo.Subscript, typeName), nil
+	desc := "key of the element in the map"
+	if !fieldInfo.MapIndex {
+		desc = fmt.Sprintf("position of the element in the list (the first element is %d)", fieldInfo.BaseIndex)
+	}
+	return fmt.Sprintf(`(%s%s%s%s: %s)`, `"""`, desc, `"""`, fieldInfo.Subscript, typeName), nil
+}
+
+// idDescription returns the description of the fabricated "id" field of the elements of a slice/array/map (see
+// "field_id" and "subscript" options).  It doesn't mention the base index, as the element type may be used in
+// more than one list, so that the declarations of the type are the same.
+func idDescription(fieldInfo *field.Info) string {
+	if fieldInfo.MapIndex {
+		return "key of the element in its map"
+	}
+	return "position of the element in its list"
 }
 
 // getParams creates the list of GraphQL arguments for a resolver function
@@ -472,9 +632,7 @@ func (s schema) getParams(t reflect.Type, enums map[string][]string, fieldInfo *
 		}
 		builder.WriteString(sep)
 		if fieldInfo.ArgDescriptions[paramNum] != "" {
-			builder.WriteString(`"""`)
-			builder.WriteString(fieldInfo.ArgDescriptions[paramNum])
-			builder.WriteString(`"""`)
+			builder.WriteString(blockString(fieldInfo.ArgDescriptions[paramNum], "    "))
 		}
 		builder.WriteString(fieldInfo.Args[paramNum])
 		builder.WriteString(": ")
@@ -506,21 +664,32 @@ func (s schema) getParams(t reflect.Type, enums map[string][]string, fieldInfo *
 		}
 
 		// Now check that the default for the arg is OK
-		if fieldInfo.ArgDefaults[paramNum] != "" {
-			// Check that the default value is a valid literal for the type
-			if err = s.validLiteral(typeName, enums, effectiveType, fieldInfo.ArgDefaults[paramNum]); err != nil {
+		value := fieldInfo.ArgDefaults[paramNum]
+		if value != "" {
+			// Get the literal text (from the tag or a named default) and check it's a valid literal for the type
+			if value, err = s.getDefault(value); err != nil {
+				return "", fmt.Errorf("%w for argument %q", err, fieldInfo.Args[paramNum])
+			}
+			if err = s.validLiteral(typeName, enums, effectiveType, value); err != nil {
 				return "", fmt.Errorf("%w: parameter %d (%s) of arg %q default value %q is not of the correct type (%s)",
-					err, i, effectiveType.Name(), fieldInfo.Args[paramNum], fieldInfo.ArgDefaults[paramNum], typeName)
+					err, i, effectiveType.Name(), fieldInfo.Args[paramNum], value, typeName)
 			}
 		}
 		builder.WriteString(typeName)
 
 		// Do we also need to add = followed by the argument default value?
-		if fieldInfo.ArgDefaults[paramNum] != "" {
+		if value != "" {
 			builder.WriteString(" = ")
-			value := fieldInfo.ArgDefaults[paramNum]
 			builder.WriteString(value)
 		}
+		if paramNum < len(fieldInfo.ArgDirectives) && fieldInfo.ArgDirectives[paramNum] != "" {
+			// A deprecated argument must be optional (see GraphQL spec)
+			if strings.HasSuffix(typeName, "!") && fieldInfo.ArgDefaults[paramNum] == "" {
+				return "", fmt.Errorf("deprecated arg %q must be nullable or have a default value", fieldInfo.Args[paramNum])
+			}
+			builder.WriteString(" ")
+			builder.WriteString(fieldInfo.ArgDirectives[paramNum])
+		}
 		if !isScalar {
 			// If it's a struct we also need to add the "input" type to our collection
 			if err := s.add(typeName, effectiveType, enums, gqlInputKeyword, nil); err != nil {
@@ -539,3 +708,27 @@ func (s schema) getParams(t reflect.Type, enums map[string][]string, fieldInfo *
 	}
 	return builder.String(), nil
 }
+
+// checkInitial checks that the field given in a subscription's "initial" option exists in the struct (t) and
+// that it provides a value of the type sent on the subscription's channel (either directly or as a func returning it)
+func checkInitial(t reflect.Type, name string, elemType reflect.Type) error {
+	tf, ok := t.FieldByName(name)
+	if !ok {
+		return fmt.Errorf("initial value field %q not found", name)
+	}
+	if tf.PkgPath != "" {
+		return fmt.Errorf("initial value field %q must be exported (use egg:\"-\" tag to omit it from the schema)", name)
+	}
+	valueType := tf.Type
+	if valueType.Kind() == reflect.Func {
+		if valueType.NumIn() > 1 || valueType.NumIn() == 1 && valueType.In(0) != reflect.TypeOf((*context.Context)(nil)).Elem() ||
+			valueType.NumOut() != 1 {
+			return fmt.Errorf("initial value func %q must return a single value and can only take a context.Context", name)
+		}
+		valueType = valueType.Out(0)
+	}
+	if !valueType.AssignableTo(elemType) {
+		return fmt.Errorf("initial value field %q has type %v but the channel type is %v", name, valueType, elemType)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package schema_test
 
 import (
 	"context"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -69,6 +70,15 @@ type (
 		M2 string `egg:"message"`
 	}
 
+	Connection[T any] struct {
+		Edges []T
+		Count int
+	}
+	Pair[K comparable, V any] struct {
+		Key   K
+		Value V
+	}
+
 	InputInt        struct{ I int }
 	QueryInputParam struct {
 		F func(InputInt) int `egg:"(in)"`
@@ -93,8 +103,13 @@ type (
 		A M1
 		B M2
 	}
-	I2Int struct{ IInt } // for interface implements interface
-	M3    struct {
+	MPtr struct {
+		*IInt // embedded pointer also makes an interface
+		S     string
+	}
+	QueryInterfacePtr struct{ A MPtr }
+	I2Int             struct{ IInt } // for interface implements interface
+	M3                struct {
 		I2Int
 		X, Y float64
 	}
@@ -133,6 +148,13 @@ type (
 		_    *Person // this is the only way for the schema builder to know about the Person type
 		Hero Character
 	}
+	// CharacterValue is a Go interface that holds a Person or a Droid
+	CharacterValue    interface{}
+	QueryInterfaceMap struct {
+		_          *Person
+		_          *Droid
+		Characters map[string]CharacterValue `egg:":[Character!]!"`
+	}
 	QuerySubscriptSlice struct {
 		Slice []string `egg:",subscript"`
 	}
@@ -198,15 +220,57 @@ type (
 		S func() string   `egg:"#s (#1)"`
 		T []int           `egg:"#t (#2) "`
 	}
+	// QueryDescribed has no tags as its metadata is registered using eggql.Describe (see TestBuildQuery)
+	QueryDescribed struct {
+		F func(int) string
+		S string `egg:"# from tag"`
+	}
 	Cust1 int8 // custom scalar type (see UnmarshalEGGQL method below)
+
+	// Vehicle is a Go interface implemented by Car and (*)Bike so the schema has a GraphQL interface of their
+	// common fields.  Searchable has no fields in common so is a union.
+	Vehicle interface{ Wheels() int }
+	Car     struct {
+		Make       string
+		WheelCount int `egg:"wheels"`
+		Seats      int
+	}
+	Bike struct {
+		Make       string `egg:"# who made it"`
+		WheelCount int    `egg:"wheels"`
+		Gears      int
+	}
+	QueryGoInterface struct {
+		_       Car
+		_       *Bike
+		Vehicle func() Vehicle
+		Fleet   []Vehicle
+	}
+	Searchable        interface{ searchable() }
+	QueryGoInterface2 struct {
+		_      Car
+		_      QueryString
+		Search func(string) []Searchable `egg:"(text)"`
+	}
 )
 
+func (Car) Wheels() int         { return 4 }
+func (Car) searchable()         {}
+func (*Bike) Wheels() int       { return 2 }
+func (QueryString) searchable() {}
+
 // UnmarshalEGGQL is just added as a method on Cust1 to indicate that it is a custom scalar
 func (pi *Cust1) UnmarshalEGGQL(s string) error {
 	return nil // nothing needed here as we are just testing schema generation
 }
 
 func TestBuildQuery(t *testing.T) {
+	eggql.Describe(reflect.TypeOf(QueryDescribed{}), map[string]eggql.FieldMeta{
+		"_": {Description: "described type"},
+		"F": {Description: "f desc", Args: []string{"n=3#count"}},
+		"S": {Description: "s desc", Directives: []string{"@deprecated"}},
+	})
+
 	testData := map[string]struct {
 		data     interface{}
 		expected string
@@ -248,15 +312,18 @@ func TestBuildQuery(t *testing.T) {
 		"Map":   {QueryMap{}, "schema{ query:QueryMap } type QueryMap{ map:[Int!]! }"},
 		"SliceFieldID": {
 			QueryFieldID{}, "schema{ query:QueryFieldID }" +
-				"type QueryFieldID{ slice:[QueryString!]! } type QueryString{ id:Int! m:String! }",
+				"type QueryFieldID{ slice:[QueryString!]! } " +
+				`type QueryString{ """position of the element in its list""" id:Int! m:String! }`,
 		},
 		"SliceFieldID2": {
 			QueryFieldID2{}, "schema{ query:QueryFieldID2 }" +
-				"type QueryFieldID2{ s1:[QueryString!]! s2:[QueryString!]! } type QueryString{ id:Int! m:String! }",
+				"type QueryFieldID2{ s1:[QueryString!]! s2:[QueryString!]! } " +
+				`type QueryString{ """position of the element in its list""" id:Int! m:String! }`,
 		},
 		"MapFieldID": {
 			QueryMapFieldID{}, "schema{ query:QueryMapFieldID }" +
-				"type QueryMapFieldID{ map:[QueryString!]! } type QueryString{ id:Int! m:String! }",
+				"type QueryMapFieldID{ map:[QueryString!]! } " +
+				`type QueryString{ """key of the element in its map""" id:Int! m:String! }`,
 		},
 		"Int Func":  {QueryIntFunc{}, "schema{ query:QueryIntFunc } type QueryIntFunc{ f:Int! }"},
 		"BoolFunc":  {QueryBoolFunc{}, "schema{ query:QueryBoolFunc } type QueryBoolFunc{ f:Boolean! }"},
@@ -291,6 +358,11 @@ func TestBuildQuery(t *testing.T) {
 			"schema{query:QueryInterface} interface IInt{i:Int!}" +
 				"type M1 implements IInt{i:Int! s:String!} type M2 implements IInt{b:Boolean! i:Int!} type QueryInterface{a:M1! b:M2!}",
 		},
+		"InterfacePtr": {
+			QueryInterfacePtr{},
+			"schema{query:QueryInterfacePtr} interface IInt{i:Int!}" +
+				"type MPtr implements IInt{i:Int! s:String!} type QueryInterfacePtr{a:MPtr!}",
+		},
 		// Note allowing an interface to implement a (different) interface is a new feature of GraphQL (2020) but seems to work with eggql as is
 		"IfaceOfIface": {
 			QueryIfaceOfIface{},
@@ -311,17 +383,39 @@ func TestBuildQuery(t *testing.T) {
 			"schema{query:QueryInterface2} interface Character {friends:[Character]! name:String!} type Person " +
 				" implements Character{friends:[Character]! name:String! personality:String!} type QueryInterface2{hero:Character!}",
 		},
+		"InterfaceMap": {
+			QueryInterfaceMap{},
+			"schema{query:QueryInterfaceMap} interface Character {friends:[Character]! name:String!} type Droid " +
+				" implements Character{friends:[Character]! name:String! primaryFunction:String!} type Person " +
+				" implements Character{friends:[Character]! name:String! personality:String!} " +
+				"type QueryInterfaceMap{characters:[Character!]!}",
+		},
+		"GoInterface": {
+			QueryGoInterface{},
+			`schema{query:QueryGoInterface} type Bike implements Vehicle{gears:Int! """ who made it""" make:String! wheels:Int!} ` +
+				"type Car implements Vehicle{make:String! seats:Int! wheels:Int!} " +
+				`type QueryGoInterface{fleet:[Vehicle]! vehicle:Vehicle} interface Vehicle{""" who made it""" make:String! wheels:Int!}`,
+		},
+		"GoInterfaceUnion": {
+			QueryGoInterface2{},
+			"schema{query:QueryGoInterface2} type Car{make:String! seats:Int! wheels:Int!} " +
+				"type QueryGoInterface2{search(text:String!):[Searchable]!} type QueryString{m:String!} " +
+				"union Searchable = Car | QueryString",
+		},
 		"SubscriptSlice": {
 			QuerySubscriptSlice{},
-			"schema{ query:QuerySubscriptSlice } type QuerySubscriptSlice{slice(id:Int!):String! }",
+			"schema{ query:QuerySubscriptSlice } " +
+				`type QuerySubscriptSlice{slice("""position of the element in the list (the first element is 0)""" id:Int!):String! }`,
 		},
 		"SubscriptArray": {
 			QuerySubscriptArray{},
-			"schema{ query:QuerySubscriptArray } type QuerySubscriptArray{a(id:Int!):Boolean! }",
+			"schema{ query:QuerySubscriptArray } " +
+				`type QuerySubscriptArray{a("""position of the element in the list (the first element is 0)""" id:Int!):Boolean! }`,
 		},
 		"SubscriptMap": {
 			QuerySubscriptMap{},
-			"schema{ query:QuerySubscriptMap } type QuerySubscriptMap{m(s:String!):Float! }",
+			"schema{ query:QuerySubscriptMap } " +
+				`type QuerySubscriptMap{m("""key of the element in the map""" s:String!):Float! }`,
 		},
 		"Union": {
 			QueryUnion{},
@@ -348,6 +442,10 @@ func TestBuildQuery(t *testing.T) {
 			QueryDescField{},
 			`schema{query:QueryDescField}type QueryDescField{""" Test of # for description""" i:Int!}`,
 		},
+		"Described": {
+			QueryDescribed{},
+			`schema{query:QueryDescribed} """described type""" type QueryDescribed{ """f desc""" f(""" count""" n:Int!=3):String! """s desc""" s:String! @deprecated }`,
+		},
 		"DescOjectAndFields": {
 			QueryDescAll{}, // TODO NULL prob? - last field's Ints should not be nullable t:[Int!] not t:[Int]!
 			`schema{query:QueryDescAll} """q (type)""" type QueryDescAll{"""s (#1)""" s:String! """t (#2)""" t:[Int!]!}`,
@@ -386,8 +484,15 @@ func TestBuildQuery(t *testing.T) {
 				Id []string `egg:":[ID!]!"`
 			}{}, expected: "type Query{ id: [ID!]! }",
 		},
-		"IDList2": {data: struct{ Id []eggql.ID }{}, expected: "type Query{ id: [ID!]! }"},
-		"IDList3": {data: struct{ Id []*eggql.ID }{}, expected: "type Query{ id: [ID]! }"},
+		"IDList2":   {data: struct{ Id []eggql.ID }{}, expected: "type Query{ id: [ID!]! }"},
+		"IDList3":   {data: struct{ Id []*eggql.ID }{}, expected: "type Query{ id: [ID]! }"},
+		"IntID":     {data: struct{ Id eggql.IntID }{}, expected: "type Query{ id: ID! }"},
+		"IntIDList": {data: struct{ Id []*eggql.IntID }{}, expected: "type Query{ id: [ID]! }"},
+		"IntIDReturn": {
+			data: struct {
+				Id int `egg:":ID!"`
+			}{}, expected: "type Query{ id: ID! }",
+		},
 		"IDPtrList": {
 			data: struct {
 				Id *[]string `egg:":[ID]"`
@@ -413,11 +518,36 @@ func TestBuildQuery(t *testing.T) {
 				F func(*eggql.ID) int `egg:"(a)"`
 			}{}, expected: "type Query{ f(a:ID): Int! }",
 		},
+		"IntIDArgDefault": {
+			data: struct {
+				F func(eggql.IntID) int `egg:"(a=\"42\")"`
+			}{}, expected: `type Query{ f(a:ID! = "42"): Int! }`,
+		},
 		"Directive1": {
 			data: struct {
 				V int `egg:",@deprecated"`
 			}{}, expected: "type Query{ v: Int! @deprecated }",
 		},
+		"SubscriptFunc": {
+			data: struct {
+				V func(context.Context) (map[string]int, error) `egg:",subscript=code"`
+				W func() *[]bool                                `egg:",subscript"`
+			}{}, expected: `type Query{ v("""key of the element in the map""" code:String!): Int! ` +
+				`w("""position of the element in the list (the first element is 0)""" id:Int!): Boolean }`,
+		},
+		"Generic": {
+			data: struct {
+				C Connection[InputInt]
+				P *Pair[string, []*InputInt]
+			}{}, expected: "type InputInt{ i:Int! } type InputIntConnection{ count:Int! edges:[InputInt!]! } " +
+				"type Query{ c:InputIntConnection! p:StringInputIntListPair } type StringInputIntListPair{ key:String! value:[InputInt]! }",
+		},
+		"DeprecatedOption": {
+			data: struct {
+				Old int                `egg:"oldField,deprecated=\"use newField\""`
+				F   func(int, int) int `egg:"(a{deprecated=\"use b\"}=0,b=1)"`
+			}{}, expected: `type Query{ f(a:Int! = 0 @deprecated(reason: "use b"), b:Int! = 1): Int! oldField: Int! @deprecated(reason: "use newField") }`,
+		},
 	}
 
 	for name, data := range testData {
@@ -495,3 +625,334 @@ func RemoveWhiteSpace(t *testing.T, s string) string {
 	}
 	return b.String()
 }
+
+// TestBuildAll tests that root types provided by more than one set of structs are combined using "extend type"
+func TestBuildAll(t *testing.T) {
+	// core and plugin have different Go types with the same name (User) - the plugin extends the core type
+	var core, plugin interface{}
+	{
+		type User struct{ Name string }
+		core = struct{ Me User }{}
+	}
+	{
+		type User struct{ Name, Avatar string }
+		plugin = struct{ Friend User }{}
+	}
+	// same has both User types in one struct
+	same := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "Me", Type: reflect.TypeOf(core).Field(0).Type},
+		{Name: "Friend", Type: reflect.TypeOf(plugin).Field(0).Type},
+	})).Elem().Interface()
+
+	testData := map[string]struct {
+		sets     [][3]interface{}
+		options  []schema.BuildOption
+		expected string
+		errorStr string // expected error (if not empty)
+	}{
+		"Single": {
+			sets:     [][3]interface{}{{QueryString{}}},
+			expected: "schema{ query: QueryString } type QueryString{ m: String! }",
+		},
+		"Extend": {
+			sets: [][3]interface{}{
+				{struct{ A QueryInt }{}},
+				{struct{ B QueryInt }{}},
+			},
+			expected: "type Query{ a: QueryInt! } type QueryInt{ i: Int! } extend type Query{ b: QueryInt! }",
+		},
+		"SameField": {
+			sets: [][3]interface{}{
+				{struct{ A, B int }{}},
+				{struct{ B, C int }{}},
+			},
+			expected: "type Query{ a: Int! b: Int! } extend type Query{ c: Int! }",
+		},
+		"Mutation": {
+			sets: [][3]interface{}{
+				{struct{ A int }{}, struct{ M int }{}},
+				{nil, struct{ N int }{}},
+			},
+			expected: "type Mutation{ m: Int! } type Query{ a: Int! } extend type Mutation{ n: Int! }",
+		},
+		"Conflict": {
+			sets: [][3]interface{}{
+				{struct{ A int }{}},
+				{struct{ A string }{}},
+			},
+			errorStr: `field "a" of "Query" is declared differently`,
+		},
+		"ExtendObject": {
+			sets: [][3]interface{}{{core}, {plugin}},
+			expected: "type Query{ me: User! } type User{ name: String! } " +
+				"extend type Query{ friend: User! } extend type User{ avatar: String! }",
+		},
+		"SameSetObject": {
+			sets:     [][3]interface{}{{same}},
+			errorStr: "same name (User) used for multiple objects",
+		},
+		"Stitched": {
+			sets: [][3]interface{}{
+				{struct{ A QueryInt }{}},
+				{struct{ B QueryInt }{}},
+			},
+			options:  []schema.BuildOption{schema.Stitched()},
+			expected: "type Query{ a: QueryInt! } type QueryInt{ i: Int! } extend type Query{ b: QueryInt! }",
+		},
+		"StitchedObject": {
+			sets:     [][3]interface{}{{core}, {plugin}},
+			options:  []schema.BuildOption{schema.Stitched()},
+			errorStr: `have the same name "User" (stitched schema)`,
+		},
+		"StitchedField": {
+			sets: [][3]interface{}{
+				{struct{ A, B int }{}},
+				{struct{ B, C int }{}},
+			},
+			options:  []schema.BuildOption{schema.Stitched()},
+			errorStr: `field "b" of "Query" is provided by more than one struct`,
+		},
+	}
+
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			out, err := schema.BuildAll(nil, data.sets, data.options...)
+			if data.errorStr != "" {
+				Assertf(t, err != nil && strings.Contains(err.Error(), data.errorStr),
+					"TestBuildAll: %12s: expected error %q got %v", name, data.errorStr, err)
+				return
+			}
+			Assertf(t, err == nil, "TestBuildAll: %12s: expected no error got %v", name, err)
+			exp := RemoveWhiteSpace(t, data.expected)
+			out = RemoveWhiteSpace(t, out)
+			Assertf(t, out == exp, "TestBuildAll: %12s: expected %q got %q", name, exp, out)
+		})
+	}
+}
+
+// TestDirectives tests that custom directives are declared in the schema (see Directives option)
+func TestDirectives(t *testing.T) {
+	testData := map[string]struct {
+		data        interface{}
+		definitions []string
+		expected    string
+		errorStr    string // expected error (if not empty)
+	}{
+		"Auth": {
+			data: struct {
+				Secret string `egg:",@auth(role: \"admin\")"`
+			}{},
+			definitions: []string{"@auth(role: String!) on FIELD_DEFINITION"},
+			expected:    `type Query{ secret: String! @auth(role: "admin") } directive @auth(role: String!) on FIELD_DEFINITION`,
+		},
+		"Two": {
+			data:        struct{ Name string }{},
+			definitions: []string{"@upper on FIELD", " @lower on FIELD | FIELD_DEFINITION "},
+			expected:    "type Query{ name: String! } directive @upper on FIELD directive @lower on FIELD | FIELD_DEFINITION",
+		},
+		"NoLocation": {
+			data:        struct{ Name string }{},
+			definitions: []string{"@upper"},
+			errorStr:    "must be of the form",
+		},
+	}
+
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			out, err := schema.Build(nil, data.data, schema.Directives(data.definitions...))
+			if data.errorStr != "" {
+				Assertf(t, err != nil && strings.Contains(err.Error(), data.errorStr),
+					"TestDirectives: %12s: expected error %q got %v", name, data.errorStr, err)
+				return
+			}
+			Assertf(t, err == nil, "TestDirectives: %12s: expected no error got %v", name, err)
+			exp := RemoveWhiteSpace(t, data.expected)
+			out = RemoveWhiteSpace(t, out)
+			Assertf(t, out == exp, "TestDirectives: %12s: expected %q got %q", name, exp, out)
+		})
+	}
+}
+
+// TestTypes tests that types added with the Types option are in the schema
+func TestTypes(t *testing.T) {
+	testData := map[string]struct {
+		data     interface{}
+		types    []interface{}
+		expected string
+		errorStr string // expected error (if not empty)
+	}{
+		"GoInterface": {
+			data:  struct{ Vehicle func() Vehicle }{},
+			types: []interface{}{Car{}, &Bike{}},
+			expected: `type Bike implements Vehicle{gears:Int! """ who made it""" make:String! wheels:Int!} ` +
+				"type Car implements Vehicle{make:String! seats:Int! wheels:Int!} " +
+				`type Query{vehicle:Vehicle} interface Vehicle{""" who made it""" make:String! wheels:Int!}`,
+		},
+		"TypeName": {
+			data: struct {
+				Car func() interface{} `egg:":Car"`
+			}{},
+			types:    []interface{}{Car{}},
+			expected: "type Car{make:String! seats:Int! wheels:Int!} type Query{car:Car}",
+		},
+		"NotStruct": {
+			data:     struct{ Name string }{},
+			types:    []interface{}{42},
+			errorStr: "must be a named struct",
+		},
+	}
+
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			out, err := schema.Build(nil, data.data, schema.Types(data.types...))
+			if data.errorStr != "" {
+				Assertf(t, err != nil && strings.Contains(err.Error(), data.errorStr),
+					"TestTypes: %12s: expected error %q got %v", name, data.errorStr, err)
+				return
+			}
+			Assertf(t, err == nil, "TestTypes: %12s: expected no error got %v", name, err)
+			exp := RemoveWhiteSpace(t, data.expected)
+			out = RemoveWhiteSpace(t, out)
+			Assertf(t, out == exp, "TestTypes: %12s: expected %q got %q", name, exp, out)
+		})
+	}
+}
+
+func TestGenerateGo(t *testing.T) {
+	testData := map[string]struct {
+		sdl      string
+		expected []string // parts of the generated code (with white space collapsed)
+		errorStr string
+	}{
+		"Object": {
+			sdl: `"Q desc" type Query { message: String! count(n: Int = 3): Int }`,
+			expected: []string{"package gen",
+				"type Query struct { _ eggql.TagHolder `egg:\"#Q desc\"` Message func() string Count func(*int) *int `egg:\"(n=3)\"` }"},
+		},
+		"Nested": {
+			sdl: `type Query { p: Person } type Person { name: String, friends: [Person!], best: Person! @deprecated(reason: "gone") }`,
+			expected: []string{
+				"type Person struct { Name *string Friends []Person `egg:\",nullable\"` Best func() Person `egg:\",deprecated=\\\"gone\\\"\"` }"},
+		},
+		"Input": {
+			sdl: `type Query { add(r: ReviewInput!): Int! } input ReviewInput { stars: Int! = 5 "any text, eg (a, b)" text: String }`,
+			expected: []string{"Add func(ReviewInput) int `egg:\"(r)\"`",
+				"type ReviewInput struct { Stars int `egg:\"=5\"` Text *string `egg:\"#any text, eg (a, b)\"` }"},
+		},
+		"Interface": {
+			sdl: `type Query { hero: Character } interface Character { name: String!, friends: [Character] }
+				type Droid implements Character { name: String!, friends: [Character], function: String! }`,
+			expected: []string{"type Character struct { Name string Friends []*Character `egg:\",nullable\"` }",
+				"type Droid struct { Character Function string }",
+				"type Query struct { _ [0]Droid Hero func() interface{} `egg:\":Character\"` }"},
+		},
+		"Union": {
+			sdl: `type Query { search(text: String!): [Result!]! } union Result = A | B type A { a: Int! } type B { b: Int! }`,
+			expected: []string{"type A struct { Result A int }", "type Result struct{}",
+				"Search func(string) []interface{} `egg:\"(text):[Result!]!\"`"},
+		},
+		"Enum": {
+			sdl: `type Query { e("the movie, or (eg) trilogy" e: Episode = JEDI): Episode! } "Movies" enum Episode { "first" NEWHOPE EMPIRE JEDI @deprecated }`,
+			expected: []string{"// Episode - Movies type Episode int",
+				"const ( EpisodeNEWHOPE Episode = iota EpisodeEMPIRE EpisodeJEDI )",
+				`return []string{ "NEWHOPE#first", "EMPIRE", "JEDI @deprecated", }`,
+				"E func(*Episode) Episode `egg:\"(e=JEDI#the movie\\\\, or (eg\\\\) trilogy)\"`"},
+		},
+		"Scalars": {
+			sdl:      `type Query { id: ID!, when: DateTime, c: Colour! } scalar DateTime scalar Colour`,
+			expected: []string{`import ( "time" "github.com/andrewwphillips/eggql" )`, "Id func() eggql.ID When func() *time.Time", "type Colour string", "func (v *Colour) UnmarshalEGGQL(s string) error"},
+		},
+		"Subscription": {
+			sdl:      `type Query { a: Int } type Subscription { ticks: Int! }`,
+			expected: []string{"Ticks func() <-chan int"},
+		},
+		"Invalid": {
+			sdl:      `type Query { a: Unknown }`,
+			errorStr: "Undefined type Unknown",
+		},
+	}
+
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			out, err := schema.GenerateGo(data.sdl, "gen")
+			if data.errorStr != "" {
+				Assertf(t, err != nil && strings.Contains(err.Error(), data.errorStr),
+					"TestGenerateGo: %12s: expected error %q got %v", name, data.errorStr, err)
+				return
+			}
+			Assertf(t, err == nil, "TestGenerateGo: %12s: expected no error got %v", name, err)
+			code := strings.Join(strings.Fields(string(out)), " ")
+			for _, exp := range data.expected {
+				Assertf(t, strings.Contains(code, exp), "TestGenerateGo: %12s: expected %q in %q", name, exp, code)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	type Droid struct {
+		Name    string
+		Friends []string
+	}
+	testData := map[string]struct {
+		data     interface{}
+		sdl      string
+		expected []string // differences
+		errorStr string
+	}{
+		"Same": {
+			data: struct {
+				Message string                `egg:"#not compared"`
+				Len     func(string, int) int `egg:"(s,n=2)"`
+			}{},
+			sdl: `type Query { message: String! len(s: String!, n: Int! = 2): Int! }`,
+		},
+		"Fields": {
+			data: struct {
+				Message *string
+				Extra   int
+			}{},
+			sdl: `type Query { message: String!, missing: Int }`,
+			expected: []string{`field "Query.message" has type String, expected String!`,
+				`field "Query.missing" is missing`, `field "Query.extra" is not in the schema`},
+		},
+		"Args": {
+			data: struct {
+				F func(int, string) int `egg:"(a=1,b)"`
+			}{},
+			sdl: `type Query { f(a: Int! = 2, c: String): Int! }`,
+			expected: []string{`argument "Query.f(a)" has default value 1, expected 2`,
+				`argument "Query.f(c)" is missing`, `argument "Query.f(b)" is not in the schema`},
+		},
+		"Types": {
+			data:     struct{ D Droid }{},
+			sdl:      `type Query { d: Droid! } interface Droid { name: String! } type Human { name: String! }`,
+			expected: []string{`type "Droid" is OBJECT, expected INTERFACE`, `type "Human" is missing`},
+		},
+		"Enum": {
+			data: struct {
+				E int `egg:":Episode!"`
+			}{},
+			sdl: `type Query { e: Episode! } enum Episode { NEWHOPE EMPIRE }`,
+		},
+		"InvalidSDL": {
+			data:     struct{ M string }{},
+			sdl:      `type Query { m: Unknown }`,
+			errorStr: "Undefined type Unknown",
+		},
+	}
+
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			diffs, err := schema.Verify(data.sdl, [3]interface{}{data.data})
+			if data.errorStr != "" {
+				Assertf(t, err != nil && strings.Contains(err.Error(), data.errorStr),
+					"TestVerify: %12s: expected error %q got %v", name, data.errorStr, err)
+				return
+			}
+			Assertf(t, err == nil, "TestVerify: %12s: expected no error got %v", name, err)
+			Assertf(t, reflect.DeepEqual(diffs, data.expected) || len(diffs)+len(data.expected) == 0,
+				"TestVerify: %12s: expected %q got %q", name, data.expected, diffs)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package schema
+
+// stitch.go implements the Stitched build option, for combining the structs of independent modules (see BuildAll)
+// where a type (or root field) declared by more than one module is a conflict rather than an extension
+
+// Stitched returns a build option (used with BuildAll) that makes it an error for a later set of structs to:
+//   - declare an object type that has the same name as a different type declared by an earlier set
+//   - provide a root query, mutation or subscription field that is already provided by an earlier set
+//
+// Without this option the later set extends the type (see BuildAll) and the first struct with the field resolves it.
+// Note that an object type is not a conflict if it is generated identically (eg from the same Go type) by each set.
+func Stitched() BuildOption {
+	return func(s *schema) {
+		s.stitched = true
+	}
+}
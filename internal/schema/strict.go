@@ -0,0 +1,93 @@
+package schema
+
+// strict.go implements the Strict build option which reports, as errors, things that are otherwise silently
+// ignored when building a schema - eg a field that looks like it is meant to be a resolver but is not exported
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/andrewwphillips/eggql/internal/field"
+)
+
+// BuildOption is an option that can be passed to Build or MustBuild (after the structs) or to BuildAll
+type BuildOption func(*schema)
+
+// Strict returns a build option that makes it an error for a struct to have:
+//   - an unexported field with an egg: tag or of func type (as it looks like it was intended to be a resolver)
+//   - a func field of the root query, mutation or subscription (or a struct nested in it) that is nil, unless
+//     it has the "optional_func" option in its tag
+//
+// Note that (with or without this option) it is always an error if the arguments in the tag of a func field do
+// not match the func parameters.
+func Strict() BuildOption {
+	return func(s *schema) {
+		s.strict = true
+	}
+}
+
+// checkUnexported returns an error (in strict mode) if an unexported field looks like it was meant to be a resolver
+func (s schema) checkUnexported(t reflect.Type, tf reflect.StructField) error {
+	if !s.strict || tf.Name == "_" || tf.PkgPath == "" {
+		return nil
+	}
+	for _, key := range []string{field.TagKey, "graphql"} {
+		if _, ok := tf.Tag.Lookup(key); ok {
+			return fmt.Errorf("unexported field %q of %v has a %q tag (strict mode)", tf.Name, t, key)
+		}
+	}
+	if tf.Type.Kind() == reflect.Func {
+		return fmt.Errorf("unexported field %q of %v is a func (strict mode)", tf.Name, t)
+	}
+	return nil
+}
+
+// checkNilFuncs returns an error (in strict mode) if a func field of a struct value (v), or a struct nested in it,
+// is nil, unless it is "optional_func".  Structs are followed through pointers, but not slices or maps.
+func (s schema) checkNilFuncs(v reflect.Value) error {
+	if !s.strict {
+		return nil
+	}
+	seen := make(map[uintptr]bool) // pointers already followed (in case of cycles)
+	var check func(v reflect.Value, path string) error
+	check = func(v reflect.Value, path string) error {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil
+			}
+			if v.Kind() == reflect.Ptr {
+				if seen[v.Pointer()] {
+					return nil
+				}
+				seen[v.Pointer()] = true
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tf := t.Field(i)
+			if tf.Name == "_" || tf.PkgPath != "" {
+				continue
+			}
+			fieldInfo, err := field.Get(t, &tf)
+			if err != nil || fieldInfo == nil {
+				continue // errors are reported when the type is added
+			}
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Func {
+				if fv.IsNil() && !fieldInfo.OptionalFunc {
+					return fmt.Errorf("resolver func %s%s is nil (strict mode)", path, tf.Name)
+				}
+				continue
+			}
+			if err := check(fv, path+tf.Name+"."); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(v, "")
+}
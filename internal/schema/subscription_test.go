@@ -2,6 +2,7 @@ package schema_test
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/andrewwphillips/eggql/internal/schema"
@@ -47,3 +48,48 @@ func TestBuildSubscription(t *testing.T) {
 		})
 	}
 }
+
+// TestSubscriptionNotChannel checks that fields of the subscription struct that are not channels are reported
+func TestSubscriptionNotChannel(t *testing.T) {
+	testData := map[string]struct {
+		subscription interface{}
+		problem      string // expected error text or empty string if no error
+	}{
+		"chan": {struct{ I <-chan int }{}, ""},
+		"omitted": {struct {
+			I <-chan int
+			J int `egg:"-"`
+		}{}, ""},
+		"int":  {struct{ I int }{}, "must be (or return) a receive channel: i (int)"},
+		"func": {struct{ F func() string }{}, "channel: f (func() string)"},
+		"several": {struct {
+			I <-chan int
+			B bool
+			A func() int
+		}{}, "channel: a (func() int), b (bool)"},
+		"embedded": {
+			struct {
+				I <-chan int
+				Embedded
+			}{}, "channel: m (string)",
+		},
+	}
+
+	for name, data := range testData {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			sdl := "type Subscription { i: Int! }"
+			_, err := schema.Build(nil, nil, nil, data.subscription)
+			_, err2 := schema.Bind(sdl, [3]interface{}{nil, nil, data.subscription})
+			if data.problem == "" {
+				Assertf(t, err == nil, "%-10s: expected no error, got %v", name, err)
+				Assertf(t, err2 == nil, "%-10s: expected no error from Bind, got %v", name, err2)
+			} else {
+				Assertf(t, err != nil && strings.Contains(err.Error(), data.problem),
+					"%-10s: expected error %q, got %v", name, data.problem, err)
+				Assertf(t, err2 != nil && strings.Contains(err2.Error(), data.problem),
+					"%-10s: expected error %q from Bind, got %v", name, data.problem, err2)
+			}
+		})
+	}
+}
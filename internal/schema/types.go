@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 
 	"github.com/andrewwphillips/eggql/internal/field"
 )
@@ -28,10 +27,10 @@ func (s schema) validateTypeName(typeName string, enums map[string][]string, t r
 	// if it's a list get the element type
 	if len(typeName) > 2 && typeName[0] == '[' && typeName[len(typeName)-1] == ']' {
 		typeName = typeName[1 : len(typeName)-1]
-		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array && t.Kind() != reflect.Map {
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array && t.Kind() != reflect.Map && !field.IsOrderedMap(t) {
 			return false, fmt.Errorf("A field with list resolver must have a slice/array/map type (not %v)", t.Kind())
 		}
-		t = t.Elem()
+		t = field.ElemType(t)
 
 		if len(typeName) > 1 && typeName[len(typeName)-1] == '!' {
 			typeName = typeName[:len(typeName)-1] // remove non-nullability
@@ -40,6 +39,18 @@ func (s schema) validateTypeName(typeName string, enums map[string][]string, t r
 		}
 	}
 
+	// A dynamic object can be of any object type, which is declared in SDL so is not known here.  (It is treated
+	// like a scalar so that a type is not generated from the Go type.)
+	if t == field.DynamicType {
+		return true, nil
+	}
+
+	// A time.Time can be a DateTime (even if the DateTime option is off)
+	if t == field.TimeType && typeName == field.DateTimeName {
+		s.addScalar(field.DateTimeName)
+		return true, nil
+	}
+
 	// Check if the type is a custom scalar
 	if reflect.TypeOf(reflect.New(t).Interface()).Implements(field.UnmarshalerType) {
 		if typeName != t.Name() {
@@ -65,11 +76,17 @@ func (s schema) validateTypeName(typeName string, enums map[string][]string, t r
 			return false, fmt.Errorf("A Float GraphQL field must have a floating point resolver (not %v)", t.Kind())
 		}
 		return true, nil
-	case "String", "ID":
+	case "String":
 		if t.Kind() != reflect.String {
 			return false, fmt.Errorf("A %q GraphQL field must have a string resolver (not %v)", typeName, t.Kind())
 		}
 		return true, nil
+	case "ID":
+		// An ID can be backed by a string or an integer type (in which case it is always numeric)
+		if t.Kind() != reflect.String && (t.Kind() < reflect.Int || t.Kind() > reflect.Uint64) {
+			return false, fmt.Errorf("A %q GraphQL field must have an integer or string resolver (not %v)", typeName, t.Kind())
+		}
+		return true, nil
 	}
 
 	// Check if it's a known enum type
@@ -95,12 +112,19 @@ func (s schema) validateTypeName(typeName string, enums map[string][]string, t r
 		if t.Kind() != reflect.Struct && t.Kind() != reflect.Interface {
 			return false, fmt.Errorf("expecting resolver type %q but got %v", typeName, t.Kind())
 		}
-		if typeName != t.Name() && t.Name() != "" {
-			return false, fmt.Errorf("Object field (%s) cannot have a resolver of type %q", t.Name(), typeName)
+		// Note that a Go interface (any name) may hold any struct, eg a Human or Droid for a Character field
+		if t.Kind() == reflect.Struct && typeName != field.TypeName(t) && t.Name() != "" {
+			return false, fmt.Errorf("Object field (%s) cannot have a resolver of type %q", field.TypeName(t), typeName)
 		}
 		return false, nil
 	}
 
+	// Check if it's the name of a Go interface (see declareGoInterfaces)
+	if isGoInterface(t) && field.TypeName(t) == typeName {
+		_, err := s.addGoInterface(t)
+		return false, err
+	}
+
 	return false, fmt.Errorf("type %q is not known", typeName)
 }
 
@@ -124,34 +148,45 @@ func (s schema) getTypeName(t reflect.Type, nullable bool) (name string, isScala
 	// Note that reflect.TypeOf(reflect.New(t).Interface()) is used to get the type of ptr to t.
 	// (UnmarshalEGGQL must have a pointer (not value) receiver since the new value is saved.)
 	if reflect.TypeOf(reflect.New(t).Interface()).Implements(field.UnmarshalerType) {
-		found := false
-		for _, name := range *s.scalars {
-			if name == t.Name() {
-				found = true
-				break
-			}
-		}
-		if !found {
-			*s.scalars = append(*s.scalars, t.Name())
-		}
+		s.addScalar(t.Name())
 		name = t.Name()
 		isScalar = true
 		return
 	}
+	if t == field.DynamicType {
+		err = errors.New("the type of a Dynamic field must be given in the egg: tag (eg \":Movie\")")
+		return
+	}
+	if t == field.TimeType && !s.noDateTime {
+		s.addScalar(field.DateTimeName)
+		name = field.DateTimeName
+		isScalar = true
+		return
+	}
 
-	switch t.Kind() {
+	kind := t.Kind()
+	if field.IsOrderedMap(t) {
+		kind = reflect.Map // ordered map is a list like a map
+	}
+	switch kind {
 	case reflect.Bool:
 		name = "Boolean"
 		isScalar = true
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		name = "Int"
+		if enumName, ok := field.EnumName(t); ok {
+			name = enumName // Go enum type (see addGoEnums)
+		} else if field.IsID(t) {
+			name = "ID" // eggql.IntID
+		} else {
+			name = "Int"
+		}
 		isScalar = true
 	case reflect.Float32, reflect.Float64:
 		name = "Float"
 		isScalar = true
 	case reflect.String:
-		if t.Name() == "ID" && strings.Contains(t.PkgPath(), "eggql") {
+		if field.IsID(t) {
 			name = "ID"
 		} else {
 			name = "String"
@@ -159,7 +194,7 @@ func (s schema) getTypeName(t reflect.Type, nullable bool) (name string, isScala
 		isScalar = true
 
 	case reflect.Struct:
-		name = t.Name() // may be "" for anon struct
+		name = field.TypeName(t) // may be "" for anon struct
 
 	case reflect.Ptr:
 		name, isScalar, err = s.getTypeName(t.Elem(), false)
@@ -168,7 +203,7 @@ func (s schema) getTypeName(t reflect.Type, nullable bool) (name string, isScala
 			name = name[:len(name)-1] // remove non-nullability
 		}
 	case reflect.Map, reflect.Array, reflect.Slice:
-		name, isScalar, err = s.getTypeName(t.Elem(), false)
+		name, isScalar, err = s.getTypeName(field.ElemType(t), false)
 		if err != nil {
 			return
 		}
@@ -178,6 +213,13 @@ func (s schema) getTypeName(t reflect.Type, nullable bool) (name string, isScala
 		}
 		name = "[" + name + "]"
 	case reflect.Interface:
+		if isGoInterface(t) {
+			// A Go interface (with methods) is a GraphQL interface (or union) of the structs that implement it.
+			// It is nullable since an interface value can be nil.
+			name, err = s.addGoInterface(t)
+			nullable = true
+			return
+		}
 		// Nothing needed here - return empty name and no error.  This is for GraphQL "interface" fields where
 		// the Go func returns an interface{} but we don't know the type name, or whether it is a scalar or not
 	default:
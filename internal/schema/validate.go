@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andrewwphillips/eggql/internal/field"
 )
@@ -27,18 +28,30 @@ func validGraphQLName(s string) bool {
 //   This is important to check for errors when building the schema rather than panic/client error when a query is run.
 // Returns: nil if valid or an error explaining why it is invalid
 func (s schema) validLiteral(typeName string, enums map[string][]string, t reflect.Type, literal string) error {
+	literal = strings.TrimSpace(literal)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem() // a pointer is only used to make the value nullable
+	}
+
 	// Get "unmodified" type name - without non-nullable (!) and list ([]) modifiers
-	if len(typeName) > 1 && typeName[len(typeName)-1] == '!' {
+	nonNull := len(typeName) > 1 && typeName[len(typeName)-1] == '!'
+	if nonNull {
 		typeName = typeName[:len(typeName)-1] // remove non-nullability
 	}
+	if literal == "null" {
+		if nonNull {
+			return fmt.Errorf("default value null is not valid for non-nullable %q", typeName)
+		}
+		return nil
+	}
 
 	// if it's a list check the elements
 	if len(typeName) > 2 && typeName[0] == '[' && typeName[len(typeName)-1] == ']' {
 		typeName = typeName[1 : len(typeName)-1]
-		t = t.Elem() // TODO check that t is slice/array/map
-		if len(typeName) > 1 && typeName[len(typeName)-1] == '!' {
-			typeName = typeName[:len(typeName)-1] // remove non-nullability
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return fmt.Errorf("default value %q for a list %q must be for a Go slice or array (not %v)", literal, typeName, t)
 		}
+		t = t.Elem()
 
 		// Get the list without square brackets
 		if len(literal) < 2 || literal[0] != '[' || literal[len(literal)-1] != ']' {
@@ -46,24 +59,34 @@ func (s schema) validLiteral(typeName string, enums map[string][]string, t refle
 		}
 		literal = literal[1 : len(literal)-1]
 
-		if literal == "" {
-			return nil // empty list is valid (we need this because strings.Split given an empty list still returns 1 string)
-		}
 		// Check that all the values in the list are valid
-		for _, dv := range strings.Split(literal, ",") {
-			if err := s.validLiteral(typeName, enums, t, strings.Trim(dv, " ")); err != nil {
+		for _, dv := range splitLiteral(literal, ',') {
+			if err := s.validLiteral(typeName, enums, t, dv); err != nil {
 				return fmt.Errorf("%w: value in %q for list %q is not of correct type", err, literal, typeName)
 			}
 		}
 		return nil
 	}
 
+	// A DateTime must be a string (in RFC 3339 format unless the DateTimeFormat option is used)
+	if t == field.TimeType {
+		text, err := strconv.Unquote(literal)
+		if err == nil {
+			_, err = time.Parse(s.dateTimeFormat, text)
+		}
+		if err != nil {
+			return fmt.Errorf("default value %q is not a valid %s (format %q)", literal, typeName, s.dateTimeFormat)
+		}
+		return nil
+	}
+
 	// Check for custom scalar
 	if reflect.TypeOf(reflect.New(t).Interface()).Implements(reflect.TypeOf((*field.Unmarshaler)(nil)).Elem()) {
-		if typeName != t.Name() {
-			panic("Wrong type")
+		text := literal
+		if unquoted, err := strconv.Unquote(literal); err == nil {
+			text = unquoted // the scalar is decoded from the contents of a string literal (else number etc)
 		}
-		if reflect.New(t).Interface().(field.Unmarshaler).UnmarshalEGGQL(literal) != nil {
+		if reflect.New(t).Interface().(field.Unmarshaler).UnmarshalEGGQL(text) != nil {
 			return fmt.Errorf("default value %q is not valid for custom scalar %q", literal, typeName)
 		}
 		return nil
@@ -71,45 +94,42 @@ func (s schema) validLiteral(typeName string, enums map[string][]string, t refle
 
 	// if it's an object check each of the fields
 	if t.Kind() == reflect.Struct {
-		if typeName != t.Name() {
-			panic("Wrong type")
-		}
 		if len(literal) < 2 || literal[0] != '{' || literal[len(literal)-1] != '}' {
 			return fmt.Errorf("default value %q for object %q be enclosed in braces {}", literal, typeName)
 		}
 		literal = literal[1 : len(literal)-1]
 
-		// Split the into fields on comma TODO: handle commas inside strings
-		for _, f := range strings.Split(literal, ",") {
-			// split name:value on colon
-			parts := strings.Split(f, ":")
-			if len(parts) != 2 || !validGraphQLName(parts[0]) {
+		for _, f := range splitLiteral(literal, ',') {
+			// split name:value on the (first) colon
+			colon := strings.IndexByte(f, ':')
+			if colon == -1 || !validGraphQLName(strings.TrimSpace(f[:colon])) {
 				return fmt.Errorf("default value %q for object %q is malformed", literal, typeName)
 			}
+			name, value := strings.TrimSpace(f[:colon]), f[colon+1:]
 
 			// Find the matching field in the struct (t)
 			var fieldType reflect.Type
 			var fieldTypeName string
 			for i := 0; i < t.NumField(); i++ {
 				tf := t.Field(i)
-				fieldInfo, err := field.Get(&tf)
+				fieldInfo, err := field.Get(t, &tf)
 				if err != nil {
-					return fmt.Errorf("%w getting default value of field %q in object %q", err, parts[0], typeName)
+					return fmt.Errorf("%w getting default value of field %q in object %q", err, name, typeName)
 				}
-				if tf.Name != "_" && tf.PkgPath != "" {
+				if fieldInfo == nil || tf.Name == "_" {
 					continue // ignore unexported fields
 				}
 				if fieldInfo.Name != "" && !validGraphQLName(fieldInfo.Name) {
 					return fmt.Errorf("%q is not a valid field name in object %q", fieldInfo.Name, typeName)
 				}
-				if parts[0] == fieldInfo.Name {
+				if name == fieldInfo.Name {
 					fieldTypeName = fieldInfo.GQLTypeName
 					fieldType = tf.Type
 					break
 				}
 			}
 			if fieldType == nil {
-				return fmt.Errorf("%q (in default value %q) is not a field of %q", parts[0], literal, typeName)
+				return fmt.Errorf("%q (in default value %q) is not a field of %q", name, literal, typeName)
 			}
 			if fieldTypeName == "" {
 				var err error
@@ -118,7 +138,7 @@ func (s schema) validLiteral(typeName string, enums map[string][]string, t refle
 					return fmt.Errorf("%w: value in %q for object %q has bad type", err, literal, typeName)
 				}
 			}
-			if err := s.validLiteral(fieldTypeName, enums, fieldType, parts[1]); err != nil {
+			if err := s.validLiteral(fieldTypeName, enums, fieldType, value); err != nil {
 				return fmt.Errorf("%w: value in %q in object %q is not of correct type", err, literal, typeName)
 			}
 		}
@@ -150,9 +170,13 @@ func (s schema) validLiteral(typeName string, enums map[string][]string, t refle
 		}
 		return nil
 	case "ID":
-		// ID literal can be a string or an integer
+		// ID literal can be a string or an integer (but must be an integer if the Go type is an integer)
 		if len(literal) > 1 && literal[0] == '"' && literal[len(literal)-1] == '"' {
-			return nil // string
+			if t.Kind() != reflect.String {
+				literal = literal[1 : len(literal)-1] // integer ID can be given as a string of digits
+			} else {
+				return nil // string
+			}
 		}
 		if _, err := strconv.Atoi(literal); err != nil {
 			return fmt.Errorf("%w: %q is not a valid ID (must be integer or string) for %q", err, literal, typeName)
@@ -179,6 +203,40 @@ func (s schema) validLiteral(typeName string, enums map[string][]string, t refle
 	return nil // assume it's OK if we get here (TODO: check if we need to check more types)
 }
 
+// splitLiteral splits a list or object literal (without the enclosing brackets or braces) at each separator
+// (sep) that is not inside a string or a nested list or object.  Each part is returned with spaces trimmed.
+func splitLiteral(literal string, sep byte) (r []string) {
+	if strings.TrimSpace(literal) == "" {
+		return nil
+	}
+	depth, inString, start := 0, false, 0
+	for i := 0; i < len(literal); i++ {
+		c := literal[i]
+		if inString {
+			if c == '\\' {
+				i++ // skip escaped char
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case sep:
+			if depth == 0 {
+				r = append(r, strings.TrimSpace(literal[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(r, strings.TrimSpace(literal[start:]))
+}
+
 // validateEnums checks that the enum names are OK and returns the enums without trailing descriptions
 // If there is a problem then the 2nd return value (of type error) it not nil.
 // If 2nd return value is nil, the 1st return value is the enums map names fixed - ie, anything from the
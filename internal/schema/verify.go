@@ -0,0 +1,186 @@
+package schema
+
+// verify.go compares the schema generated from Go structs with a schema provided in GraphQL SDL (eg a file that is
+// the "source of truth" of a project) for contract testing
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Verify generates the schema from the root query, mutation and subscription structs (any of which may be nil) and
+// compares it with a schema (SDL).  It returns the differences, which is empty if the schemas have the same types,
+// fields, arguments (including default values), enum values, union members and interfaces (descriptions and
+// directives are ignored).  The enums of the SDL are used for the structs (eg a field tagged :Episode) except for
+// enums declared by Go types (see field.EnumValuer), which are compared.  It returns an error if the SDL is invalid
+// or the schema can't be generated from the structs.
+func Verify(sdl string, roots [3]interface{}) ([]string, error) {
+	expected, pgqlError := gqlparser.LoadSchema(&ast.Source{Name: "schema", Input: sdl})
+	if pgqlError != nil {
+		return nil, pgqlError
+	}
+
+	found := make(map[string]reflect.Type)
+	seen := make(map[reflect.Type]bool)
+	for _, root := range roots {
+		if root == nil {
+			continue
+		}
+		if err := findGoEnums(reflect.TypeOf(root), found, seen); err != nil {
+			return nil, err
+		}
+	}
+	enums := make(map[string][]string)
+	for name, def := range expected.Types {
+		if def.Kind != ast.Enum || def.BuiltIn || found[name] != nil {
+			continue
+		}
+		for _, value := range def.EnumValues {
+			enums[name] = append(enums[name], value.Name)
+		}
+	}
+
+	generated, err := Build(enums, roots[:]...)
+	if err != nil {
+		return nil, err
+	}
+	actual, pgqlError := gqlparser.LoadSchema(&ast.Source{Name: "generated", Input: generated})
+	if pgqlError != nil {
+		return nil, pgqlError
+	}
+
+	var d differences
+	d.types(expected, actual)
+	return d, nil
+}
+
+// differences is a list of the ways the generated schema differs from the expected one
+type differences []string
+
+func (d *differences) add(format string, args ...interface{}) {
+	*d = append(*d, fmt.Sprintf(format, args...))
+}
+
+// types compares all the (non-builtin) types of two schemas
+func (d *differences) types(expected, actual *ast.Schema) {
+	for _, name := range typeNames(expected, actual) {
+		exp, act := expected.Types[name], actual.Types[name]
+		switch {
+		case act == nil:
+			d.add("type %q is missing", name)
+		case exp == nil:
+			d.add("type %q is not in the schema", name)
+		case act.Kind != exp.Kind:
+			d.add("type %q is %s, expected %s", name, act.Kind, exp.Kind)
+		default:
+			d.fields(name, exp.Fields, act.Fields)
+			d.names("interface", name, exp.Interfaces, act.Interfaces)
+			d.names("member", name, exp.Types, act.Types)
+			var expValues, actValues []string
+			for _, value := range exp.EnumValues {
+				expValues = append(expValues, value.Name)
+			}
+			for _, value := range act.EnumValues {
+				actValues = append(actValues, value.Name)
+			}
+			d.names("enum value", name, expValues, actValues)
+		}
+	}
+}
+
+// fields compares the fields (or input fields) of a type
+func (d *differences) fields(typeName string, expected, actual ast.FieldList) {
+	for _, exp := range expected {
+		name := typeName + "." + exp.Name
+		act := actual.ForName(exp.Name)
+		if act == nil {
+			if !strings.HasPrefix(exp.Name, "__") {
+				d.add("field %q is missing", name)
+			}
+			continue
+		}
+		if act.Type.String() != exp.Type.String() {
+			d.add("field %q has type %s, expected %s", name, act.Type, exp.Type)
+		}
+		d.defaultValue("field", name, exp.DefaultValue, act.DefaultValue)
+		for _, expArg := range exp.Arguments {
+			argName := name + "(" + expArg.Name + ")"
+			actArg := act.Arguments.ForName(expArg.Name)
+			if actArg == nil {
+				d.add("argument %q is missing", argName)
+				continue
+			}
+			if actArg.Type.String() != expArg.Type.String() {
+				d.add("argument %q has type %s, expected %s", argName, actArg.Type, expArg.Type)
+			}
+			d.defaultValue("argument", argName, expArg.DefaultValue, actArg.DefaultValue)
+		}
+		for _, actArg := range act.Arguments {
+			if exp.Arguments.ForName(actArg.Name) == nil {
+				d.add("argument %q is not in the schema", name+"("+actArg.Name+")")
+			}
+		}
+	}
+	for _, act := range actual {
+		if expected.ForName(act.Name) == nil && !strings.HasPrefix(act.Name, "__") {
+			d.add("field %q is not in the schema", typeName+"."+act.Name)
+		}
+	}
+}
+
+// defaultValue compares the default values of a field (of an input type) or argument
+func (d *differences) defaultValue(what, name string, expected, actual *ast.Value) {
+	switch {
+	case expected == nil && actual != nil:
+		d.add("%s %q has default value %s, expected none", what, name, actual)
+	case expected != nil && actual == nil:
+		d.add("%s %q has no default value, expected %s", what, name, expected)
+	case expected != nil && actual.String() != expected.String():
+		d.add("%s %q has default value %s, expected %s", what, name, actual, expected)
+	}
+}
+
+// names compares lists of names (the interfaces of an object type, members of a union or values of an enum)
+func (d *differences) names(what, typeName string, expected, actual []string) {
+	in := func(name string, list []string) bool {
+		for _, s := range list {
+			if s == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range expected {
+		if !in(name, actual) {
+			d.add("%s %q of %q is missing", what, name, typeName)
+		}
+	}
+	for _, name := range actual {
+		if !in(name, expected) {
+			d.add("%s %q of %q is not in the schema", what, name, typeName)
+		}
+	}
+}
+
+// typeNames returns the (sorted) names of the types of either schema, apart from built-in types
+func typeNames(schemas ...*ast.Schema) []string {
+	set := make(map[string]bool)
+	for _, s := range schemas {
+		for name, def := range s.Types {
+			if !def.BuiltIn && !strings.HasPrefix(name, "__") {
+				set[name] = true
+			}
+		}
+	}
+	r := make([]string, 0, len(set))
+	for name := range set {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
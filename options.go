@@ -5,13 +5,113 @@ package eggql
 // for details on how closures are used to handle options.)
 
 import (
+	"context"
+	"net/http"
+	"strings"
 	"time"
+
+	"github.com/andrewwphillips/eggql/internal/handler"
+)
+
+// June2018 and October2021 are the versions of the GraphQL specification that can be used with SpecVersion
+const (
+	June2018    = handler.June2018
+	October2021 = handler.October2021
 )
 
 type options struct {
 	// handler options
-	funcCache, noIntrospection, noConcurrency, nilResolver bool
-	initialTimeout, pingFrequency, pongTimeout             time.Duration
+	funcCache, noIntrospection, noConcurrency, nilResolver, omitNulls bool
+	serveDocs, serveSchema, servePlan                                 bool
+	initialTimeout, pingFrequency, pongTimeout, operationTimeout      time.Duration
+	subprotocols                                                      []string
+	requireSubprotocol                                                bool
+	idPattern                                                         string
+	rateLimitKey                                                      func(*http.Request) string
+	requestRate                                                       float64
+	requestBurst, maxConcurrentRequests, maxResolverGoroutines        int
+	requestWorkers                                                    int
+	lazyInit                                                          bool
+	specVersion                                                       string
+	maxComplexity, maxErrors                                          int
+	maxRequestSize                                                    int64
+	maxBatchSize                                                      int
+	introspectionPolicy                                               func(ctx context.Context, typeName, fieldName string) bool
+	descriptions                                                      map[string]map[string]string
+	variableHook                                                      func(ctx context.Context, variables map[string]interface{}) error
+	resolverMiddleware                                                []ResolverMiddlewareFunc
+	directiveFuncs                                                    map[string]DirectiveFunc
+	resultArena, caseInsensitiveEnums, tracing, addTypename           bool
+	lookupDiagnostics                                                 bool
+	secretArgs                                                        []string
+	floatFormat                                                       byte
+	floatPrecision                                                    int
+	unknownEnumMessage                                                func(enum, value string, valid []string) string
+	intEnums                                                          bool
+	intEnumNames                                                      []string
+	persistedOps                                                      map[string]PersistedOperation
+	queryStore                                                        QueryStore
+	apqAllowList                                                      bool
+	contextFunc, wsContext                                            func(ctx context.Context, r *http.Request) (context.Context, error)
+	initContext                                                       func(ctx context.Context, payload map[string]interface{}) (context.Context, error)
+	auditSink                                                         AuditSink
+	auditBatchSize                                                    int
+	auditFlushInterval                                                time.Duration
+	deprecationHeaders, deprecationUsage                              bool
+	deprecatedSince, sunset                                           time.Time
+	maxDeprecatedUses                                                 int
+	shadowCandidates                                                  map[string]interface{}
+	chaosRules                                                        []ChaosRule
+	cacheTTL                                                          time.Duration
+	cacheMaxEntries                                                   int
+	cacheBackend                                                      CacheBackend
+	observer                                                          ObserverFunc
+
+	// schema options
+	strict           bool
+	noDateTime       bool
+	dateTimeFormat   string
+	schemaExtensions []string
+	directives       []string          // declarations of custom directives (see Directive)
+	literalLimits    *[3]int           // max. default length, list elements and enum values (see LiteralLimits)
+	namedDefaults    map[string]string // see NamedDefault
+	types            []interface{}     // see RegisterTypes
+}
+
+// ExtendSchema adds GraphQL schema (SDL) text to the schema generated from the Go types, typically to add fields to
+// types using "extend type" (eg `extend type Query { weather(city: String!): Float }`).  Fields added this way that
+// have no Go field are resolved by the type's resolver with the "wildcard" option.
+func ExtendSchema(sdl ...string) func(*options) {
+	return func(opt *options) {
+		opt.schemaExtensions = append(opt.schemaExtensions, sdl...)
+	}
+}
+
+// Directive declares a custom directive in the generated schema and registers a function that is called when a
+// field with the directive (in its egg: tag or in the query) is resolved.  The definition is as it appears after
+// the directive keyword in the schema, eg `@auth(role: String!) on FIELD_DEFINITION`.  The function is passed the
+// directive's arguments and must call next to resolve the field (unless it returns an error or its own value).
+// If f is nil the directive is declared but has no effect when fields are resolved.
+func Directive(definition string, f DirectiveFunc) func(*options) {
+	return func(opt *options) {
+		opt.directives = append(opt.directives, definition)
+		if f == nil {
+			return
+		}
+		if opt.directiveFuncs == nil {
+			opt.directiveFuncs = make(map[string]DirectiveFunc)
+		}
+		opt.directiveFuncs[directiveName(definition)] = f
+	}
+}
+
+// directiveName returns the name (without the @) of a directive from its definition
+func directiveName(definition string) string {
+	name := strings.TrimPrefix(strings.TrimSpace(definition), "@")
+	if i := strings.IndexAny(name, "( \t\n"); i > -1 {
+		name = name[:i]
+	}
+	return name
 }
 
 // FuncCache setting the parameter to true means all *function* resolver results are cached, whereas false
@@ -26,6 +126,31 @@ func FuncCache(on bool) func(*options) {
 	}
 }
 
+// CacheTTL sets how long cached resolver values are used, after which the resolver is called again.  The "cache"
+// option of a field's egg: tag string (eg `egg:",cache=30s"`) overrides this for the field.  The default (zero)
+// means that cached values are kept forever.
+func CacheTTL(ttl time.Duration) func(*options) {
+	return func(opt *options) {
+		opt.cacheTTL = ttl
+	}
+}
+
+// CacheMaxEntries limits how many values are kept in the cache of each resolver (a value is cached for every
+// combination of argument values) by evicting the least recently used values.  The default (zero) is no limit.
+func CacheMaxEntries(n int) func(*options) {
+	return func(opt *options) {
+		opt.cacheMaxEntries = n
+	}
+}
+
+// SharedCache keeps cached resolver values in a cache backend (eg Redis or memcached) rather than in memory, so
+// that they are shared by all instances of a server
+func SharedCache(backend CacheBackend) func(*options) {
+	return func(opt *options) {
+		opt.cacheBackend = backend
+	}
+}
+
 // NoIntrospection controls whether introspection queries are permitted
 func NoIntrospection(on bool) func(*options) {
 	return func(opt *options) {
@@ -33,6 +158,35 @@ func NoIntrospection(on bool) func(*options) {
 	}
 }
 
+// IntrospectionPolicy allows some types and fields to be hidden from introspection, depending on the request.
+// For each type (with fieldName empty) and field the function is called with the request's context (eg to
+// find the role of the authenticated user) and returns false if it should not be visible to the client.
+func IntrospectionPolicy(policy func(ctx context.Context, typeName, fieldName string) bool) func(*options) {
+	return func(opt *options) {
+		opt.introspectionPolicy = policy
+	}
+}
+
+// LocalizedDescriptions registers descriptions in another language, which are used (instead of the descriptions
+// in the schema) in the results of introspection queries from clients that accept the language, according to the
+// Accept-Language header of the request.  The language is a tag like "fr" or "fr-CA" (where "fr" is also used for
+// "fr-CA").  The map keys are a type name (eg "Episode"), a field or enum value (eg "Query.hero" or "Episode.JEDI")
+// or an argument (eg "Query.hero.episode").  The option can be used more than once, eg for different languages.
+func LocalizedDescriptions(language string, descriptions map[string]string) func(*options) {
+	return func(opt *options) {
+		if opt.descriptions == nil {
+			opt.descriptions = make(map[string]map[string]string)
+		}
+		language = strings.ToLower(language)
+		if opt.descriptions[language] == nil {
+			opt.descriptions[language] = make(map[string]string, len(descriptions))
+		}
+		for key, description := range descriptions {
+			opt.descriptions[language][key] = description
+		}
+	}
+}
+
 // NoConcurrency controls whether concurrent excution of queries (but not mutations) is permitted
 func NoConcurrency(on bool) func(*options) {
 	return func(opt *options) {
@@ -40,6 +194,30 @@ func NoConcurrency(on bool) func(*options) {
 	}
 }
 
+// MaxResolverGoroutines limits how many go-routines (across all requests) are used to run resolvers concurrently.
+// Once the limit is reached further resolvers are run sequentially.  Zero (the default) means no limit.
+func MaxResolverGoroutines(n int) func(*options) {
+	return func(opt *options) {
+		opt.maxResolverGoroutines = n
+	}
+}
+
+// RequestWorkers runs the resolvers of each request on a pool of (at most) n go-routines, which run the resolvers
+// of shallow fields before those of deeply nested fields.  Zero (the default) means a go-routine per resolver.
+func RequestWorkers(n int) func(*options) {
+	return func(opt *options) {
+		opt.requestWorkers = n
+	}
+}
+
+// LazyInit allows the resolvers of root structs (passed to MustRun as pointers) to be assigned after the handler
+// is created, eg by a dependency injection framework.  Requests are rejected until Freeze is called.
+func LazyInit(on bool) func(*options) {
+	return func(opt *options) {
+		opt.lazyInit = on
+	}
+}
+
 // NilResolver controls whether nil resolvers are allowed - if not a nil resolver function results in an error
 func NilResolver(on bool) func(*options) {
 	return func(opt *options) {
@@ -47,6 +225,405 @@ func NilResolver(on bool) func(*options) {
 	}
 }
 
+// LookupDiagnostics checks for (and logs) bugs in finding the resolvers of fields, when debugging
+func LookupDiagnostics(on bool) func(*options) {
+	return func(opt *options) {
+		opt.lookupDiagnostics = on
+	}
+}
+
+// OmitNulls leaves nullable fields that resolve to null out of the query results, for more compact responses.
+// This is not strictly compliant with the GraphQL spec, so is off by default.  Even when off, a client can
+// ask for null fields to be omitted from the results of a request by setting the "omitNulls" extension to true.
+func OmitNulls(on bool) func(*options) {
+	return func(opt *options) {
+		opt.omitNulls = on
+	}
+}
+
+// AddTypename adds the __typename field to every object in the query results, even if it was not requested, for
+// clients (such as those with a normalised cache) that rely on it.  For an interface or union it is the name of
+// the concrete type.  Even when off, a client can ask for it by setting the "addTypename" extension to true.
+func AddTypename(on bool) func(*options) {
+	return func(opt *options) {
+		opt.addTypename = on
+	}
+}
+
+// IDPattern restricts the values that clients may supply for an ID (argument or variable) to those that
+// match the regular expression.  It is an error (MustRun panics) if the pattern is not a valid regular expression.
+// Note that an ID with an integer type (such as IntID) must always be numeric, even without a pattern.
+func IDPattern(pattern string) func(*options) {
+	return func(opt *options) {
+		opt.idPattern = pattern
+	}
+}
+
+// RateLimitKey sets how clients are identified for the purposes of field rate limits (the "rateLimit" tag option).
+// By default, the client IP address is used.
+func RateLimitKey(key func(*http.Request) string) func(*options) {
+	return func(opt *options) {
+		opt.rateLimitKey = key
+	}
+}
+
+// RateLimit limits each client (see RateLimitKey) to rate requests per second, with bursts of up to burst requests.
+// Requests over the limit are rejected with HTTP status 429 (Too Many Requests).
+func RateLimit(rate float64, burst int) func(*options) {
+	return func(opt *options) {
+		opt.requestRate, opt.requestBurst = rate, burst
+	}
+}
+
+// MaxConcurrentRequests limits how many queries and mutations (not websocket connections) are handled at once.
+// Requests over the limit are rejected with HTTP status 429 (Too Many Requests).
+func MaxConcurrentRequests(n int) func(*options) {
+	return func(opt *options) {
+		opt.maxConcurrentRequests = n
+	}
+}
+
+// OperationTimeout limits how long a query or mutation request can take.  Resolvers can find out how
+// much of this time is left using RemainingBudget (eg to pass a tighter deadline to downstream calls).
+// Individual fields can also be given a tighter deadline using the "timeout" option of the egg: tag.
+func OperationTimeout(timeout time.Duration) func(*options) {
+	return func(opt *options) {
+		opt.operationTimeout = timeout
+	}
+}
+
+// MaxRequestSize limits the size (in bytes) of the body of a POST request - larger requests are rejected.
+// It also limits the size of websocket (and WebTransport) messages.  If not used (or zero) there is no limit.
+func MaxRequestSize(size int64) func(*options) {
+	return func(opt *options) {
+		opt.maxRequestSize = size
+	}
+}
+
+// MaxBatchSize limits the number of requests in a batch - a POST request whose body is a JSON array of requests,
+// which are executed concurrently, and whose response is an array of the results.  If not used (or zero) the limit
+// is 20.  A negative value means batches are rejected.
+func MaxBatchSize(n int) func(*options) {
+	return func(opt *options) {
+		opt.maxBatchSize = n
+	}
+}
+
+// MaxComplexity rejects operations whose estimated complexity is greater than limit, before they are executed.
+// Every field selected counts as one, multiplied (with its sub-selections) by the factors of the field's
+// "complexity" option (if any).  See the Complexity Limits section of the README.
+func MaxComplexity(limit int) func(*options) {
+	return func(opt *options) {
+		opt.maxComplexity = limit
+	}
+}
+
+// MaxErrors limits the number of errors in a response to n, followed by an error saying how many more errors
+// there were, eg "and 42 more errors".  Zero (the default) means no limit.
+func MaxErrors(n int) func(*options) {
+	return func(opt *options) {
+		opt.maxErrors = n
+	}
+}
+
+// SpecVersion selects the version of the GraphQL spec (eggql.June2018 or eggql.October2021) that the schema
+// must conform to.  The default is October2021.  If June2018 is used then building the handler fails if the schema
+// uses features added in the October 2021 spec (such as repeatable directives).  See COMPLIANCE.md for details.
+func SpecVersion(version string) func(*options) {
+	return func(opt *options) {
+		opt.specVersion = version
+	}
+}
+
+// VariableHook sets a function that can inspect and modify the variables of every operation before they are
+// checked against the types declared in the operation, eg to trim strings, normalise email addresses or inject
+// a tenant ID (obtained from the context).  Changes are seen wherever the variables are used, whether passed
+// directly as an argument or within a list or input object literal.  Returning an error rejects the operation.
+func VariableHook(hook func(ctx context.Context, variables map[string]interface{}) error) func(*options) {
+	return func(opt *options) {
+		opt.variableHook = hook
+	}
+}
+
+// ResolverMiddleware adds middleware that is called around the resolving of every field (except introspection),
+// eg for authorisation checks, logging, metrics or per-field rate limiting, without changing the resolvers.  The
+// middleware is passed information about the field (see ResolverInfo) and must call next to resolve it, unless it
+// returns an error (or its own value) instead.  Middleware is called in the order it is added.
+func ResolverMiddleware(mw ...ResolverMiddlewareFunc) func(*options) {
+	return func(opt *options) {
+		opt.resolverMiddleware = append(opt.resolverMiddleware, mw...)
+	}
+}
+
+// ResultArena turns on reuse of the memory (maps and slices) used to build the results of queries and mutations.
+// This memory is returned to a pool once the response has been sent, which reduces garbage collection (and GC
+// pauses) when a server sends many large responses.  (Resolver values that are cached are copied.)
+func ResultArena(on bool) func(*options) {
+	return func(opt *options) {
+		opt.resultArena = on
+	}
+}
+
+// Tracing adds the timing of the request (parsing, validation and each resolver) to the "tracing" extension of
+// query and mutation responses, in the Apollo Tracing format, so that tools like GraphQL Playground can display it.
+func Tracing(on bool) func(*options) {
+	return func(opt *options) {
+		opt.tracing = on
+	}
+}
+
+// SecretArgs marks resolver arguments, by name, as secret (as well as those with the {secret} option in their
+// egg: tag).  The values of secret arguments are redacted from error messages sent to clients and audit sinks.
+// Only whole values (not part of a longer word or number) of at least 4 characters are redacted.
+func SecretArgs(names ...string) func(*options) {
+	return func(opt *options) {
+		opt.secretArgs = append(opt.secretArgs, names...)
+	}
+}
+
+// FloatFormat sets how Float values in query results are formatted, using the format ('f', 'e' or 'g') and
+// precision of strconv.FormatFloat, eg FloatFormat('f', 2) gives two decimal places.  A precision of -1 uses the
+// fewest digits that exactly represent the value, eg FloatFormat('f', -1) always uses decimal form.
+func FloatFormat(format byte, precision int) func(*options) {
+	return func(opt *options) {
+		opt.floatFormat, opt.floatPrecision = format, precision
+	}
+}
+
+// CaseInsensitiveEnums allows clients to use enum values (in query arguments or variables) that differ only in case
+// from the values of the enum, eg "jedi" or "Jedi" for "JEDI".  The value is converted to the enum's value.
+func CaseInsensitiveEnums(on bool) func(*options) {
+	return func(opt *options) {
+		opt.caseInsensitiveEnums = on
+	}
+}
+
+// UnknownEnumMessage sets a function that makes the error message returned to the client when a query argument
+// or variable uses a value that is not in the enum.  The function is given the enum name, the value used, and
+// the valid values of the enum, eg to make a message listing the valid values.
+func UnknownEnumMessage(f func(enum, value string, valid []string) string) func(*options) {
+	return func(opt *options) {
+		opt.unknownEnumMessage = f
+	}
+}
+
+// IntEnums makes enums integers (the Go value) rather than names in results, and allows clients to use integers
+// (as well as names) in query arguments and variables, eg for internal services that prefer compact values.  It
+// only affects the named enums, or all enums if none are named.  The schema still declares the enums' names.
+func IntEnums(on bool, enums ...string) func(*options) {
+	return func(opt *options) {
+		opt.intEnums = on
+		opt.intEnumNames = enums
+	}
+}
+
+// PersistedOperations registers queries that clients can execute by name using a GET request, with variables given
+// as URL query parameters, eg "/graphql?operation=hero&episode=JEDI".  The map key is the operation name.  Since
+// the URL contains everything, responses can be cached (eg by a CDN).  URL parameters are converted to the types of
+// the variables declared in the query.  MustRun panics (logs a fatal error) if a query is not valid for the schema.
+func PersistedOperations(ops map[string]PersistedOperation) func(*options) {
+	return func(opt *options) {
+		opt.persistedOps = ops
+	}
+}
+
+// AutomaticPersistedQueries turns on automatic persisted queries (the Apollo APQ protocol) so that clients can send
+// the SHA-256 hash of a query (in the persistedQuery request extension) instead of the query text, which reduces
+// the size of requests.  Queries are saved in store, or an in-memory LRU store of 1000 queries if store is nil.
+// If allowList is true queries sent by clients are never saved, so only queries already in the store (eg see
+// NewLRUQueryStore) can be executed.
+func AutomaticPersistedQueries(store QueryStore, allowList bool) func(*options) {
+	return func(opt *options) {
+		if store == nil {
+			store = NewLRUQueryStore(1000)
+		}
+		opt.queryStore, opt.apqAllowList = store, allowList
+	}
+}
+
+// Audit sends a record of every executed operation (query, mutation or subscription) to the sink, for
+// an audit log or usage reporting.  Records are passed to the sink in batches of up to batchSize
+// records and are held no longer than flushInterval (zero values mean 100 records and 1 second).
+// If the sink does not keep up then requests are blocked once the queue of records is full.
+// Use Close to stop the go-routine that passes records to the sink when the handler is no longer needed.
+func Audit(sink AuditSink, batchSize int, flushInterval time.Duration) func(*options) {
+	return func(opt *options) {
+		opt.auditSink = sink
+		opt.auditBatchSize = batchSize
+		opt.auditFlushInterval = flushInterval
+	}
+}
+
+// DeprecationHeaders adds a Deprecation header (and a Sunset header if sunset is not zero) to the HTTP response
+// of a request that uses a deprecated field or argument.  The Deprecation header has the time of since, or "true"
+// if since is zero.
+func DeprecationHeaders(on bool, since, sunset time.Time) func(*options) {
+	return func(opt *options) {
+		opt.deprecationHeaders = on
+		opt.deprecatedSince, opt.sunset = since, sunset
+	}
+}
+
+// DeprecationUsage counts how many operations of each client use each deprecated field or argument - see
+// DeprecatedUsage
+func DeprecationUsage(on bool) func(*options) {
+	return func(opt *options) {
+		opt.deprecationUsage = on
+	}
+}
+
+// DeprecationUsageLimit sets the max. number of uses (deprecated field or argument, and client) counted by the
+// DeprecationUsage option, after which uses by other clients are counted under the client "*"
+func DeprecationUsageLimit(max int) func(*options) {
+	return func(opt *options) {
+		opt.maxDeprecatedUses = max
+	}
+}
+
+// Chaos injects artificial latency and errors into resolvers, for resilience testing of clients (eg how they
+// handle slow responses and partial results).  Each rule applies to the fields matching its pattern, which is
+// matched against the type and field name, eg "Query.*" or "*.name".  This option does nothing unless the program
+// is built with the "chaos" build tag (go build -tags chaos) so faults can never be injected in production builds.
+func Chaos(rules ...ChaosRule) func(*options) {
+	return func(opt *options) {
+		opt.chaosRules = append(opt.chaosRules, rules...)
+	}
+}
+
+// ServeDocs turns on serving of documentation of the schema.  A GET request to the handler's URL with
+// "/docs" appended (eg /graphql/docs) returns an HTML page describing every type, field, argument and
+// enum value, including descriptions and deprecations.  Add "?format=markdown" to get Markdown instead.
+func ServeDocs(on bool) func(*options) {
+	return func(opt *options) {
+		opt.serveDocs = on
+	}
+}
+
+// ServeSchema turns on serving of the schema.  A GET request to the handler's URL with "/schema" appended
+// (eg /graphql/schema) returns the GraphQL schema as SDL text, eg for use by code generators.
+func ServeSchema(on bool) func(*options) {
+	return func(opt *options) {
+		opt.serveSchema = on
+	}
+}
+
+// ServePlan turns on serving of execution plans, for debugging.  A GET request to the handler's URL with "/plan"
+// appended and the query in the "query" parameter (eg /graphql/plan?query={hero{name}}) returns, as JSON, how each
+// field would be resolved - the Go struct and field, whether it is cached, custom directives, etc.
+func ServePlan(on bool) func(*options) {
+	return func(opt *options) {
+		opt.servePlan = on
+	}
+}
+
+// Shadow registers candidate resolver functions (keyed by GraphQL type and field name, eg "Query.search") that are
+// run, in the background, as well as the current resolvers of query fields.  The client always gets the result of
+// the current resolver but a ShadowMismatch is passed to the observer (see Observer) whenever a candidate's result
+// differs.  A candidate must have the same signature as the resolver function it shadows.
+func Shadow(candidates map[string]interface{}) func(*options) {
+	return func(opt *options) {
+		opt.shadowCandidates = candidates
+	}
+}
+
+// Observer sets a function that is passed events that are not returned to clients, such as the differences found
+// by the Shadow option's candidate resolvers, eg to log them or update metrics.
+func Observer(f ObserverFunc) func(*options) {
+	return func(opt *options) {
+		opt.observer = f
+	}
+}
+
+// ContextFunc sets a function that makes the context passed to resolvers from the HTTP request, eg to add the user
+// ID from a JWT in the Authorization header or a cookie, so that resolvers can check that the user is authorised.
+// It is called for every HTTP request and for the upgrade request of a websocket, so the values are available to
+// all operations on the websocket.  If it returns an error the request is rejected (HTTP status 401).
+func ContextFunc(f func(ctx context.Context, r *http.Request) (context.Context, error)) func(*options) {
+	return func(opt *options) {
+		opt.contextFunc = f
+	}
+}
+
+// WebSocketContext sets a function that makes the context for all operations (subscriptions) on a websocket
+// when it is opened, eg to add values derived from the cookies or headers of the HTTP upgrade request.
+// The values remain available for the lifetime of the websocket (even for long-running subscriptions).
+// If the function returns an error the websocket is not opened (HTTP status 401 is returned).
+func WebSocketContext(f func(ctx context.Context, r *http.Request) (context.Context, error)) func(*options) {
+	return func(opt *options) {
+		opt.wsContext = f
+	}
+}
+
+// InitContext sets a function that is called with the payload of the connection_init message sent by a client
+// when it opens a websocket, to add values to the context of all operations on the websocket.  This is typically
+// used to authenticate the client using a token in the payload, since browsers can't set headers on the upgrade
+// request.  If it returns an error the websocket is closed.
+func InitContext(f func(ctx context.Context, payload map[string]interface{}) (context.Context, error)) func(*options) {
+	return func(opt *options) {
+		opt.initContext = f
+	}
+}
+
+// Strict makes it an error (MustRun panics) if a struct used to build the schema has an unexported field that looks
+// like it was meant to be a resolver (it has an egg: tag or is a func) or if a func field of the query, mutation or
+// subscription (or a struct nested in them) is nil, unless it has the "optional_func" option.  Without this option
+// such fields are silently ignored when the schema is built (a nil func causes an error when it is resolved).
+func Strict(on bool) func(*options) {
+	return func(opt *options) {
+		opt.strict = on
+	}
+}
+
+// DateTime turns on (the default) or off the DateTime scalar for time.Time fields and resolver arguments, which is
+// encoded as an RFC 3339 string (eg "2006-01-02T15:04:05Z") unless another format is given with DateTimeFormat.
+// When off a time.Time is only a DateTime if its type is given in the egg: tag, eg `egg:":DateTime!"`.
+func DateTime(on bool) func(*options) {
+	return func(opt *options) {
+		opt.noDateTime = !on
+	}
+}
+
+// DateTimeFormat sets the layout (see time.Format) used to encode and decode DateTime values, eg time.RFC3339Nano
+// or "2006-01-02" (date only).  The default is time.RFC3339.
+func DateTimeFormat(layout string) func(*options) {
+	return func(opt *options) {
+		opt.dateTimeFormat = layout
+	}
+}
+
+// RegisterTypes adds the object types of the given values (structs or pointers to structs) to the schema, even
+// though they are not reachable from the query, mutation or subscription structs.  This is needed for the concrete
+// types returned by resolvers of interface type (eg the implementations of a Character interface) instead of adding
+// dummy fields like _ [0]Human to the query struct, eg RegisterTypes(Human{}, Droid{}, Starship{}).
+func RegisterTypes(values ...interface{}) func(*options) {
+	return func(opt *options) {
+		opt.types = append(opt.types, values...)
+	}
+}
+
+// LiteralLimits sets the maximum length (in bytes) of a default value given in an egg: tag, the maximum number of
+// elements in a list default value (including all elements of nested lists) and the maximum number of values of an
+// enum.  A limit of zero (or less) means no limit.  If not given, the limits are 1024 bytes, 100 elements and 1000
+// enum values.  Exceeding a limit is an error when the schema is built.  The limits do not apply to named defaults.
+func LiteralLimits(maxLength, maxElements, maxEnumValues int) func(*options) {
+	return func(opt *options) {
+		opt.literalLimits = &[3]int{maxLength, maxElements, maxEnumValues}
+	}
+}
+
+// NamedDefault saves a default value for resolver argument(s) under a name.  A tag can then use the value by giving
+// the name after a dollar sign ($).  This is useful for long defaults (such as a list with many elements) that would
+// make the tag unwieldy or exceed the limits set by LiteralLimits.  For example, with the option
+// eggql.NamedDefault("primes", "[2,3,5,7,11,13]") you can use egg:"(list=$primes)".
+func NamedDefault(name, literal string) func(*options) {
+	return func(opt *options) {
+		if opt.namedDefaults == nil {
+			opt.namedDefaults = make(map[string]string)
+		}
+		opt.namedDefaults[name] = literal
+	}
+}
+
 // InitialTimeout sets the length time to wait from when the websocket is opened until the
 // "connection_init" message is received. If the message is not received from the client
 // within the time limit then an error message is returned to the client and the WS is closed.
@@ -72,3 +649,18 @@ func PongTimeout(timeout time.Duration) func(*options) {
 		opt.pongTimeout = timeout
 	}
 }
+
+// Subprotocols sets the websocket sub-protocols that are accepted, in order of preference - "graphql-transport-ws"
+// and/or "graphql-ws" (legacy).  If the client offers none of them the first is assumed (see RequireSubprotocol).
+func Subprotocols(protocols ...string) func(*options) {
+	return func(opt *options) {
+		opt.subprotocols = protocols
+	}
+}
+
+// RequireSubprotocol rejects websocket upgrade requests that do not offer one of the accepted sub-protocols
+func RequireSubprotocol(on bool) func(*options) {
+	return func(opt *options) {
+		opt.requireSubprotocol = on
+	}
+}
@@ -0,0 +1,68 @@
+package eggql
+
+// ordered.go has OrderedMap, a map that can be used for a GraphQL list that keeps the order of its elements
+
+// OrderedMap is a map that keeps its elements in the order their keys were first added.  It can be used (like a
+// Go map) as the type of a field, or the return type of a resolver function, for a GraphQL list, but the elements
+// are listed in order rather than sorted by key, which is how eggql lists a Go map.  The "subscript" and "field_id"
+// options use the keys (which must be an integer or string type) just as for a Go map.
+// The zero value is an empty map ready to use.  An OrderedMap is not safe for concurrent use, so it should not be
+// modified while a query may be using it.
+type OrderedMap[K comparable, V any] struct {
+	keys   []K
+	values []V
+	index  map[K]int // position of each key in keys (and values)
+}
+
+// Set adds a key and value to the end of the map, or replaces the value of a key already in the map (keeping its position)
+func (m *OrderedMap[K, V]) Set(key K, value V) {
+	if i, ok := m.index[key]; ok {
+		m.values[i] = value
+		return
+	}
+	if m.index == nil {
+		m.index = make(map[K]int)
+	}
+	m.index[key] = len(m.keys)
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+// Delete removes a key (and its value) from the map, returning false if the key was not found
+func (m *OrderedMap[K, V]) Delete(key K) bool {
+	i, ok := m.index[key]
+	if !ok {
+		return false
+	}
+	delete(m.index, key)
+	m.keys = append(m.keys[:i], m.keys[i+1:]...)
+	m.values = append(m.values[:i], m.values[i+1:]...)
+	for ; i < len(m.keys); i++ {
+		m.index[m.keys[i]] = i
+	}
+	return true
+}
+
+// Get returns the value of a key and true, or the zero value and false if the key is not in the map
+func (m OrderedMap[K, V]) Get(key K) (V, bool) {
+	if i, ok := m.index[key]; ok {
+		return m.values[i], true
+	}
+	var zero V
+	return zero, false
+}
+
+// Len returns the number of elements in the map
+func (m OrderedMap[K, V]) Len() int {
+	return len(m.keys)
+}
+
+// At returns the key and value of the i-th element (in order) where i must be less than Len()
+func (m OrderedMap[K, V]) At(i int) (K, V) {
+	return m.keys[i], m.values[i]
+}
+
+// Keys returns the keys of the map in order
+func (m OrderedMap[K, V]) Keys() []K {
+	return append([]K(nil), m.keys...)
+}
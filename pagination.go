@@ -0,0 +1,95 @@
+package eggql
+
+// pagination.go has generic types for cursor-based pagination (see https://graphql.org/learn/pagination/) as
+// recommended by the Relay connection spec, plus helpers to make cursors and to paginate a slice
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Connection is a page of a list of T (the "nodes") with a cursor for each, as used for cursor-based pagination.
+	// The GraphQL type name is the name of T followed by "Connection", eg a Connection[User] is a UserConnection.
+	Connection[T any] struct {
+		_          TagHolder `egg:"# A page of a list, with a cursor for each element"`
+		TotalCount int       `egg:"# The total number of elements in the list"`
+		Edges      []Edge[T] `egg:"# The elements of the page (and their cursors)"`
+		PageInfo   PageInfo  `egg:"# Information for getting the next or previous page"`
+	}
+
+	// Edge is an element (node) of a Connection and the cursor that identifies its position in the list
+	Edge[T any] struct {
+		_      TagHolder `egg:"# An element of a list and its cursor"`
+		Node   T
+		Cursor string
+	}
+
+	// PageInfo describes the page of a Connection - the cursors of its first and last elements (nil if the page is
+	// empty) and whether there are more elements after or before the page
+	PageInfo struct {
+		_               TagHolder `egg:"# Information for paginating a list"`
+		HasNextPage     bool
+		HasPreviousPage bool
+		StartCursor     *string
+		EndCursor       *string
+	}
+)
+
+// cursorPrefix is prepended to the offset of an element before it is encoded as an opaque cursor
+const cursorPrefix = "offset:"
+
+// OffsetCursor returns an opaque cursor (string) for the element of a list at an offset (zero-based)
+func OffsetCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// CursorOffset returns the offset of the element of a list from a cursor made by OffsetCursor
+func CursorOffset(cursor string) (int, error) {
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), cursorPrefix) {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(b), cursorPrefix))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return offset, nil
+}
+
+// Paginate returns a Connection with a page of list, of up to first elements (all if first is negative) after the
+// element with the cursor after (from the start if after is empty).  The cursors are made using OffsetCursor.  It
+// returns an error if after is not a valid cursor.  It is typically called by a resolver like this:
+//
+//	Users func(first int, after string) (eggql.Connection[User], error) `egg:"(first=-1,after=\"\")"`
+func Paginate[T any](list []T, first int, after string) (Connection[T], error) {
+	begin := 0
+	if after != "" {
+		offset, err := CursorOffset(after)
+		if err != nil {
+			return Connection[T]{}, err
+		}
+		begin = offset + 1
+	}
+	if begin > len(list) {
+		begin = len(list)
+	}
+	end := len(list)
+	if first >= 0 && begin+first < end {
+		end = begin + first
+	}
+
+	r := Connection[T]{TotalCount: len(list), Edges: make([]Edge[T], 0, end-begin)}
+	for i := begin; i < end; i++ {
+		r.Edges = append(r.Edges, Edge[T]{Node: list[i], Cursor: OffsetCursor(i)})
+	}
+	if len(r.Edges) > 0 {
+		r.PageInfo.StartCursor = &r.Edges[0].Cursor
+		r.PageInfo.EndCursor = &r.Edges[len(r.Edges)-1].Cursor
+	}
+	r.PageInfo.HasNextPage = end < len(list)
+	r.PageInfo.HasPreviousPage = begin > 0
+	return r, nil
+}
@@ -1,9 +1,12 @@
 package eggql
 
-// run.go provides the eggql.MustRun() function to quickly create a GraphQL HTTP handler
+// run.go provides the eggql.MustRun() function (and Run which returns an error) to quickly create a GraphQL HTTP handler
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/andrewwphillips/eggql/internal/handler"
 	"github.com/andrewwphillips/eggql/internal/schema"
@@ -30,11 +33,200 @@ import (
 // strings, are used to generate a GraphQL schema, whereas the actual *values* of these parameters
 // are the GraphQL "resolvers" used to obtain query results.)
 // 6) Zero or more options can follow the last *struct parameter
+// MustRun panics if the handler can't be created - use Run to handle the error.
 func MustRun(params ...interface{}) http.Handler {
+	h, err := Run(params...)
+	if err != nil {
+		panic(fmt.Errorf("eggql.MustRun - %w", err))
+	}
+	return h
+}
+
+// Run is like MustRun but returns an error, rather than terminating the program, if the handler can't be created
+// (eg a parameter is not valid or the schema can't be generated from the Go types), so that a server that embeds
+// eggql can report the problem in its own way.
+func Run(params ...interface{}) (http.Handler, error) {
+	enums, qms, schemaParams, allOptions, err := parseParams("Run", params)
+	if err != nil {
+		return nil, err
+	}
+	schemaStrings, err := buildSchema(schemaParams, allOptions)
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(schemaStrings, enums, qms, allOptions)
+}
+
+// FromSDL creates an http handler for a schema provided as GraphQL SDL text, rather than a schema generated from
+// Go types, for when the SDL must be the "source of truth".  The parameters after the SDL are the root query,
+// mutation and subscription structs (any of which may be nil) followed by any options, like MustRun (except that
+// enums are taken from the SDL).  The resolvers are bound to the fields in the SDL in the same way as usual
+// (using the struct field names or the egg: tag).  An error is returned if the SDL is invalid, if a non-null field
+// has no corresponding Go field (unless the struct has a wildcard resolver) or a resolver's argument is not
+// declared in the SDL.  Nullable fields that have no Go field resolve to null.
+func FromSDL(sdl string, rootValues ...interface{}) (http.Handler, error) {
+	_, qms, _, allOptions, err := parseParams("FromSDL", rootValues)
+	if err != nil {
+		return nil, err
+	}
+	var roots [3]interface{}
+	for i := range qms {
+		if len(qms[i]) > 0 {
+			roots[i] = qms[i][0]
+		}
+	}
+	enums, err := schema.Bind(strings.Join(append([]string{sdl}, allOptions.schemaExtensions...), "\n"), roots)
+	if err != nil {
+		return nil, err
+	}
+	for i := range qms {
+		if roots[i] == nil {
+			qms[i] = nil
+		}
+	}
+	return newHandler(append([]string{sdl}, allOptions.schemaExtensions...), enums, qms, allOptions,
+		handler.MissingResolverNull(true))
+}
+
+// newHandler creates the handler for the schema (SDL) strings and resolvers, with the handler options (plus any
+// extra handler options that are not set by eggql options)
+func newHandler(schemaStrings []string, enums map[string][]string, qms [3][]interface{}, allOptions options,
+	extra ...func(*handler.Handler),
+) (http.Handler, error) {
+	var idPattern *regexp.Regexp
+	if allOptions.idPattern != "" {
+		var err error
+		if idPattern, err = regexp.Compile(allOptions.idPattern); err != nil {
+			return nil, fmt.Errorf("invalid ID pattern: %w", err)
+		}
+	}
+	handlerOptions := []func(*handler.Handler){
+		handler.FuncCache(allOptions.funcCache),
+		handler.CacheTTL(allOptions.cacheTTL),
+		handler.CacheMaxEntries(allOptions.cacheMaxEntries),
+		handler.SharedCache(allOptions.cacheBackend),
+		handler.NoIntrospection(allOptions.noIntrospection),
+		handler.IntrospectionPolicy(allOptions.introspectionPolicy),
+		handler.LocalizedDescriptions(allOptions.descriptions),
+		handler.NoConcurrency(allOptions.noConcurrency),
+		handler.LazyInit(allOptions.lazyInit),
+		handler.MaxResolverGoroutines(allOptions.maxResolverGoroutines),
+		handler.RequestWorkers(allOptions.requestWorkers),
+		handler.NilResolverAllowed(allOptions.nilResolver),
+		handler.LookupDiagnostics(allOptions.lookupDiagnostics),
+		handler.OmitNulls(allOptions.omitNulls),
+		handler.AddTypename(allOptions.addTypename),
+		handler.IDPattern(idPattern),
+		handler.RateLimitKey(allOptions.rateLimitKey),
+		handler.RateLimit(allOptions.requestRate, allOptions.requestBurst),
+		handler.MaxConcurrentRequests(allOptions.maxConcurrentRequests),
+		handler.OperationTimeout(allOptions.operationTimeout),
+		handler.MaxRequestSize(allOptions.maxRequestSize),
+		handler.MaxBatchSize(allOptions.maxBatchSize),
+		handler.MaxComplexity(allOptions.maxComplexity),
+		handler.MaxErrors(allOptions.maxErrors),
+		handler.SpecVersion(allOptions.specVersion),
+		handler.VariableHook(allOptions.variableHook),
+		handler.ResolverMiddleware(allOptions.resolverMiddleware...),
+		handler.Chaos(allOptions.chaosRules...), // after other middleware so faults are seen by the middleware
+		handler.Directives(allOptions.directiveFuncs),
+		handler.ResultArena(allOptions.resultArena),
+		handler.Tracing(allOptions.tracing),
+		handler.SecretArgs(allOptions.secretArgs...),
+		handler.Types(allOptions.types...),
+		handler.DateTimeFormat(allOptions.dateTimeFormat),
+		handler.FloatFormat(allOptions.floatFormat, allOptions.floatPrecision),
+		handler.CaseInsensitiveEnums(allOptions.caseInsensitiveEnums),
+		handler.UnknownEnumMessage(allOptions.unknownEnumMessage),
+		handler.IntEnums(allOptions.intEnums, allOptions.intEnumNames...),
+		handler.PersistedOperations(allOptions.persistedOps),
+		handler.AutomaticPersistedQueries(allOptions.queryStore, allOptions.apqAllowList),
+		handler.Audit(allOptions.auditSink, allOptions.auditBatchSize, allOptions.auditFlushInterval),
+		handler.DeprecationHeaders(allOptions.deprecationHeaders, allOptions.deprecatedSince, allOptions.sunset),
+		handler.DeprecationUsage(allOptions.deprecationUsage),
+		handler.DeprecationUsageLimit(allOptions.maxDeprecatedUses),
+		handler.ServeDocs(allOptions.serveDocs),
+		handler.ServeSchema(allOptions.serveSchema),
+		handler.ServePlan(allOptions.servePlan),
+		handler.Shadow(allOptions.shadowCandidates),
+		handler.Observer(allOptions.observer),
+		handler.ContextFunc(allOptions.contextFunc),
+		handler.WebSocketContext(allOptions.wsContext),
+		handler.InitContext(allOptions.initContext),
+		handler.InitialTimeout(allOptions.initialTimeout),
+		handler.PingFrequency(allOptions.pingFrequency),
+		handler.PongTimeout(allOptions.pongTimeout),
+		handler.Subprotocols(allOptions.subprotocols...),
+		handler.RequireSubprotocol(allOptions.requireSubprotocol),
+	}
+	return handler.NewE(schemaStrings, enums, qms, append(handlerOptions, extra...)...)
+}
+
+// SchemaString returns the GraphQL schema (SDL) generated from the same parameters as MustRun, eg to save it to a
+// file or pass it to code generation tools.  Only the Strict, DateTime, DateTimeFormat, RegisterTypes, ExtendSchema,
+// Directive, LiteralLimits and NamedDefault options have an effect on the schema.
+func SchemaString(params ...interface{}) (string, error) {
+	_, _, schemaParams, allOptions, err := parseParams("SchemaString", params)
+	if err != nil {
+		return "", err
+	}
+	schemaStrings, err := buildSchema(schemaParams, allOptions)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(schemaStrings, "\n"), nil
+}
+
+// Verify checks that the schema generated from the query, mutation and subscription structs (any of which may be
+// nil) matches a schema (SDL), eg in a test where the SDL file is the "source of truth" of the API.  The error lists
+// the differences: missing types, fields, arguments and enum values, those not in the SDL, and different types or
+// default values.  Descriptions and directives are not compared.  The enums declared in the SDL can be used for
+// fields of the structs (eg `egg:":Episode!"`) as they are not passed to Verify.
+func Verify(schemaSDL string, q, m, s interface{}) error {
+	diffs, err := schema.Verify(schemaSDL, [3]interface{}{q, m, s})
+	if err != nil {
+		return err
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("the Go types do not match the schema:\n  %s", strings.Join(diffs, "\n  "))
+	}
+	return nil
+}
+
+// GenerateGo returns Go source code (in package pkg) declaring the structs, enums and scalars for a schema given
+// as SDL, so that a schema-first project can use eggql without translating each type by hand.  The root query,
+// mutation and subscription are structs with (nil) resolver funcs to pass to MustRun once completed.  The
+// egggen command (cmd/egggen) does the same from .graphql files.
+func GenerateGo(sdl, pkg string) ([]byte, error) {
+	return schema.GenerateGo(sdl, pkg)
+}
+
+// buildSchema generates the schema from the parameters for schema.Build (see parseParams) returning it followed
+// by any SDL added with the ExtendSchema option
+func buildSchema(schemaParams []interface{}, allOptions options) ([]string, error) {
+	var enums map[string][]string
+	if len(schemaParams) > 0 {
+		if e, ok := schemaParams[0].(map[string][]string); ok {
+			enums, schemaParams = e, schemaParams[1:]
+		}
+	}
+	s, err := schema.Build(enums, schemaParams...)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{s}, allOptions.schemaExtensions...), nil
+}
+
+// parseParams separates the parameters of MustRun (see above) into the enums, the query/mutation/subscription
+// structs, the parameters for schema.Build (or MustBuild) and the options.  It returns an error if a parameter is
+// invalid.
+func parseParams(funcName string, params []interface{}) (map[string][]string, [3][]interface{}, []interface{}, options,
+	error,
+) {
 	var enums map[string][]string
 	var qms [3][]interface{}
 
-	schemaParams := make([]interface{}, 0, 4) // parameters to schema.MustBuild
+	schemaParams := make([]interface{}, 0, 4) // parameters to schema.Build
 	p := params
 	// Check for enums
 	if len(p) > 0 {
@@ -56,23 +248,33 @@ func MustRun(params ...interface{}) http.Handler {
 	// Get any options from the rest of the parameters (if any)
 	var allOptions options
 	for _, param := range p {
-		if option, ok := param.(func(*options)); !ok {
-			panic("unexpected parameter type in MustRun - expected an option")
-		} else {
-			option(&allOptions)
+		option, ok := param.(func(*options))
+		if !ok {
+			return nil, qms, nil, allOptions, fmt.Errorf("unexpected parameter type (%T) in %s - expected an option",
+				param, funcName)
 		}
+		option(&allOptions)
 	}
-
-	return handler.New(
-		[]string{schema.MustBuild(schemaParams...)},
-		enums,
-		qms,
-		handler.FuncCache(allOptions.funcCache),
-		handler.NoIntrospection(allOptions.noIntrospection),
-		handler.NoConcurrency(allOptions.noConcurrency),
-		handler.NilResolverAllowed(allOptions.nilResolver),
-		handler.InitialTimeout(allOptions.initialTimeout),
-		handler.PingFrequency(allOptions.pingFrequency),
-		handler.PongTimeout(allOptions.pongTimeout),
-	)
+	if allOptions.strict {
+		schemaParams = append(schemaParams, schema.Strict())
+	}
+	if allOptions.noDateTime {
+		schemaParams = append(schemaParams, schema.DateTime(false))
+	}
+	if allOptions.dateTimeFormat != "" {
+		schemaParams = append(schemaParams, schema.DateTimeFormat(allOptions.dateTimeFormat))
+	}
+	if len(allOptions.types) > 0 {
+		schemaParams = append(schemaParams, schema.Types(allOptions.types...))
+	}
+	if len(allOptions.directives) > 0 {
+		schemaParams = append(schemaParams, schema.Directives(allOptions.directives...))
+	}
+	if l := allOptions.literalLimits; l != nil {
+		schemaParams = append(schemaParams, schema.LiteralLimits(l[0], l[1], l[2]))
+	}
+	for name, literal := range allOptions.namedDefaults {
+		schemaParams = append(schemaParams, schema.NamedDefault(name, literal))
+	}
+	return enums, qms, schemaParams, allOptions, nil
 }
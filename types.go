@@ -5,9 +5,11 @@ package eggql
 import (
 	"fmt"
 	"math/big"
+	"reflect"
 	"time"
 
 	"github.com/andrewwphillips/eggql/internal/field"
+	"github.com/andrewwphillips/eggql/internal/handler"
 )
 
 // ID is used when a standard GraphQL ID type is required.
@@ -16,6 +18,101 @@ import (
 // to guarantee uniqueness. It is stored as a string but can be encoded from an integer or string.
 type ID = field.ID
 
+// EnumValuer is implemented by a named integer type to make it a GraphQL enum (with the same name as the type)
+// without adding it to the map of enums.  EnumValues returns the names of the values, starting with the value zero.
+type EnumValuer = field.EnumValuer
+
+// Dynamic is an object whose fields are map entries, eg a JSON document, so that semi-structured data can be served
+// without declaring structs.  The object type must be given in the egg: tag and declared in SDL (see ExtendSchema).
+type Dynamic = field.Dynamic
+
+// Validator is implemented by an input type to check its values before they are passed to a resolver (the error
+// returned by Validate is the error of the field)
+type Validator = handler.Validator
+
+// IntID is an ID that is backed by an integer (int64).  Clients may supply it as an Int or as a String
+// (but it must be numeric) and it is always encoded as an Int in query results.
+type IntID = field.IntID
+
+// OperationRecord describes an executed operation - see the Audit option
+type OperationRecord = handler.OperationRecord
+
+// AuditSink receives records of executed operations - see the Audit option
+type AuditSink = handler.AuditSink
+
+// SchemaMeta provides info about the schema to resolvers - see Meta
+type SchemaMeta = handler.SchemaMeta
+
+// SchemaField describes a field of a type of the schema - see SchemaMeta
+type SchemaField = handler.SchemaField
+
+// CacheStat has statistics of the cache of one resolver - see CacheStats
+type CacheStat = handler.CacheStat
+
+// SmokeResult is the result of the query generated for a field of the root query - see SmokeTest
+type SmokeResult = handler.SmokeResult
+
+// DeprecatedUse counts the uses of a deprecated field or argument by a client - see DeprecatedUsage
+type DeprecatedUse = handler.DeprecatedUse
+
+// CacheBackend stores cached resolver values outside the process, eg in Redis - see the SharedCache option
+type CacheBackend = handler.CacheBackend
+
+// PersistedOperation is a query that clients can execute by name with a GET request - see the PersistedOperations option
+type PersistedOperation = handler.PersistedOperation
+
+// QueryStore saves queries (by hash) for automatic persisted queries - see the AutomaticPersistedQueries option
+type QueryStore = handler.QueryStore
+
+// LRUQueryStore is an in-memory QueryStore that discards the least recently used query when full
+type LRUQueryStore = handler.LRUQueryStore
+
+// NewLRUQueryStore creates an in-memory query store holding up to capacity queries (no limit if capacity is zero)
+// containing the given queries, eg the queries of an allow-list (see the AutomaticPersistedQueries option)
+func NewLRUQueryStore(capacity int, queries ...string) *LRUQueryStore {
+	return handler.NewLRUQueryStore(capacity, queries...)
+}
+
+// QueryHash returns the hash of a query used by automatic persisted queries (hex encoded SHA-256 of the query text)
+func QueryHash(query string) string {
+	return handler.QueryHash(query)
+}
+
+// Error is an error that a resolver can return (or wrap) to give the client a code and other details of the error
+// in the "extensions" of the error in the response (eg "code": "NOT_FOUND").  If Path is nil the path of the field
+// whose resolver returned the error is used.
+type Error = handler.Error
+
+// ResolverInfo describes the field being resolved - see the ResolverMiddleware option
+type ResolverInfo = handler.ResolverInfo
+
+// Resolver resolves a field, returning its value (as encoded in the results) - see the ResolverMiddleware option
+type Resolver = handler.Resolver
+
+// ResolverMiddlewareFunc is called around the resolving of a field - see the ResolverMiddleware option
+type ResolverMiddlewareFunc = handler.ResolverMiddlewareFunc
+
+// ChaosRule adds latency and/or errors to the resolvers of fields matching a pattern - see the Chaos option
+type ChaosRule = handler.ChaosRule
+
+// ChaosBuild is true if the program was built with the "chaos" build tag, without which the Chaos option does nothing
+const ChaosBuild = handler.ChaosBuild
+
+// DirectiveFunc is called when a field with a custom directive is resolved - see the Directive option
+type DirectiveFunc = handler.DirectiveFunc
+
+// ShadowMismatch describes a difference between the results of a resolver and its candidate - see the Shadow option
+type ShadowMismatch = handler.ShadowMismatch
+
+// RefreshError is passed to the observer when a stale cached value could not be refreshed - see the Observer option
+type RefreshError = handler.RefreshError
+
+// ObserverFunc is passed events that are not returned to clients, such as a ShadowMismatch - see the Observer option
+type ObserverFunc = handler.ObserverFunc
+
+// TransportStream is a bidirectional WebTransport stream - see ServeWebTransport
+type TransportStream = handler.TransportStream
+
 // TagHolder is used to declare a field with name "_" (underscore) in a struct to allow metadata (tags)
 // to be attached to a struct.  (Metadata can only be attached to fields, so we use an "_" field
 // to allow attaching metadata to the parent struct.)  This is currently just used to attach a
@@ -25,6 +122,65 @@ type ID = field.ID
 // struct if declared at the start.
 type TagHolder struct{}
 
+// FieldMeta is metadata for a struct field (description, directives and resolver arguments) registered
+// using Describe instead of (or as well as) the field's egg: tag.
+type FieldMeta = field.Meta
+
+// Describe registers metadata for the fields of a struct type, as an alternative to egg: tags.  This is
+// useful for generated code or long descriptions.  The map keys are the Go field names, or underscore (_)
+// for the struct itself (instead of using a TagHolder).  The metadata is merged with the tag: a non-empty
+// Description replaces the tag's description, Directives are added, and Args (in the same format as in the
+// tag, eg "episode:Episode=JEDI#the movie") replace the tag's arguments.
+// Describe must be called before the schema is built (eg before MustRun) and panics if t is not a struct
+// or a map key is not a field name.
+func Describe(t reflect.Type, m map[string]FieldMeta) {
+	if err := field.Describe(t, m); err != nil {
+		panic(err)
+	}
+}
+
+// SplitDescription returns the summary (first line) and the details (the rest) of a description.  By convention a
+// long description (in a tag after the #, or registered with Describe) is a one-line summary followed by a newline
+// and the details, eg `egg:"price#Price in cents\nDoes not include sales tax"`.  This is useful for a client or
+// tool that shows just the summary, eg in a list of the fields of a type.
+func SplitDescription(desc string) (summary, details string) {
+	return field.SplitDescription(desc)
+}
+
+// SetGenericTypeName sets a function that makes the GraphQL type name of a struct instantiated from a Go generic
+// type, from the name of the generic type and the (GraphQL) names of its type arguments, eg ("Connection", ["User"]).
+// If not set (or the function returns an empty string) the names of the type arguments are prefixed to the name,
+// eg "UserConnection".  It must be called before the schema is built (eg before MustRun).
+func SetGenericTypeName(f func(name string, typeArgs []string) string) {
+	field.SetGenericTypeName(f)
+}
+
+// Diagnostic describes a problem found by Lint with the egg: tag of a struct field
+type Diagnostic = field.Diagnostic
+
+// DiagnosticKind says what sort of problem a Diagnostic describes
+type DiagnosticKind = field.DiagnosticKind
+
+const (
+	BadTag         = field.BadTag         // tag can't be parsed, eg an unknown option
+	TypeMismatch   = field.TypeMismatch   // tag does not match the field type, eg wrong number of resolver args
+	SuspiciousName = field.SuspiciousName // invalid GraphQL name or a name used by more than one field
+)
+
+// Lint checks the egg: tags of the fields of the root structs (eg the query, mutation and subscription values
+// passed to New), and of all structs reachable from them, without building a schema.  Unlike New, which panics at
+// the first problem, Lint returns a Diagnostic for every problem found (or nil if none) which makes it suitable
+// for use in a test or a vet-style analyzer.  A root may be nil.
+func Lint(roots ...interface{}) []Diagnostic {
+	types := make([]reflect.Type, 0, len(roots))
+	for _, root := range roots {
+		if root != nil {
+			types = append(types, reflect.TypeOf(root))
+		}
+	}
+	return field.Lint(types...)
+}
+
 // Time is a custom scalar for representing a point in time
 type Time time.Time
 